@@ -0,0 +1,330 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/config"
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+
+	"github.com/op/go-logging"
+)
+
+// cliFatal prints an error of a headless command and exits with a failure status, so scripts can
+// tell a command failed.
+func cliFatal(args ...any) {
+	fmt.Fprintln(os.Stderr, strings.TrimSpace(fmt.Sprintln(args...)))
+	os.Exit(1)
+}
+
+// initCliDb opens the database for a headless command.
+func initCliDb() {
+	logger.InitConsoleLogger(logging.WARNING)
+	if err := database.InitDB(config.GetDBPath()); err != nil {
+		cliFatal("Failed to initialize database:", err)
+	}
+}
+
+// printJSON prints a value as indented JSON.
+func printJSON(value any) {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		cliFatal(err)
+	}
+	fmt.Println(string(data))
+}
+
+// printRestartNote tells the user that the running panel has to be restarted for Xray to pick up a
+// change, since a headless command cannot reach the Xray API of the running panel.
+func printRestartNote(needRestart bool) {
+	if needRestart {
+		fmt.Println("Restart the panel to apply the change to Xray: x-ui restart")
+	}
+}
+
+// runClientCommand handles "x-ui client add|del|list".
+func runClientCommand(args []string) {
+	usage := func() {
+		fmt.Println("Usage: x-ui client <add|del|list> [options]")
+	}
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+	inboundService := service.InboundService{}
+
+	switch args[0] {
+	case "list":
+		cmd := flag.NewFlagSet("client list", flag.ExitOnError)
+		inboundId := cmd.Int("inbound", 0, "Only list clients of this inbound ID")
+		asJSON := cmd.Bool("json", false, "Print JSON")
+		cmd.Parse(args[1:])
+		initCliDb()
+
+		inbounds, err := inboundService.GetAllInbounds()
+		if err != nil {
+			cliFatal("Failed to load inbounds:", err)
+		}
+		type clientRow struct {
+			InboundId int `json:"inboundId"`
+			model.Client
+		}
+		rows := []clientRow{}
+		for _, inbound := range inbounds {
+			if *inboundId != 0 && inbound.Id != *inboundId {
+				continue
+			}
+			clients, err := inboundService.GetClients(inbound)
+			if err != nil {
+				cliFatal("Failed to read clients of inbound", inbound.Id, err)
+			}
+			for _, client := range clients {
+				rows = append(rows, clientRow{InboundId: inbound.Id, Client: client})
+			}
+		}
+		if *asJSON {
+			printJSON(rows)
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "INBOUND\tEMAIL\tENABLE\tTOTAL GB\tEXPIRY\tEXTERNAL ID")
+		for _, row := range rows {
+			expiry := "never"
+			if row.ExpiryTime > 0 {
+				expiry = time.UnixMilli(row.ExpiryTime).Format(time.DateOnly)
+			} else if row.ExpiryTime < 0 {
+				expiry = fmt.Sprintf("%d days after first use", -row.ExpiryTime/86400000)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%t\t%d\t%s\t%s\n", row.InboundId, row.Email, row.Enable, row.TotalGB>>30, expiry, row.ExternalId)
+		}
+		w.Flush()
+
+	case "add":
+		cmd := flag.NewFlagSet("client add", flag.ExitOnError)
+		inboundId := cmd.Int("inbound", 0, "Inbound ID to add the client to (required)")
+		email := cmd.String("email", "", "Client email, random when empty")
+		totalGB := cmd.Int64("totalGB", 0, "Traffic quota in GB, 0 for unlimited")
+		expiryDays := cmd.Int("expiryDays", 0, "Validity in days, 0 for unlimited")
+		limitIp := cmd.Int("limitIp", 0, "IP limit, 0 for unlimited")
+		comment := cmd.String("comment", "", "Client comment")
+		asJSON := cmd.Bool("json", false, "Print the created client as JSON")
+		cmd.Parse(args[1:])
+		if *inboundId == 0 {
+			cmd.Usage()
+			os.Exit(2)
+		}
+		initCliDb()
+
+		inbound, client, needRestart, err := inboundService.AddPresetClient(*inboundId, service.ClientPreset{
+			Email:      *email,
+			TotalGB:    *totalGB << 30,
+			ExpiryDays: *expiryDays,
+			LimitIP:    *limitIp,
+			Comment:    *comment,
+		})
+		if err != nil {
+			cliFatal("Failed to add client:", err)
+		}
+		// Read the client back for the fields the service fills in, like its external ID
+		clients, err := inboundService.GetClients(inbound)
+		if err == nil {
+			for _, c := range clients {
+				if c.Email == client.Email {
+					client = &c
+					break
+				}
+			}
+		}
+		if *asJSON {
+			printJSON(client)
+		} else {
+			fmt.Printf("Client %s added to inbound %d\n", client.Email, inbound.Id)
+			if client.ID != "" {
+				fmt.Println("ID:", client.ID)
+			}
+			if client.Password != "" {
+				fmt.Println("Password:", client.Password)
+			}
+			fmt.Println("Subscription ID:", client.SubID)
+		}
+		printRestartNote(needRestart)
+
+	case "del":
+		cmd := flag.NewFlagSet("client del", flag.ExitOnError)
+		inboundId := cmd.Int("inbound", 0, "Inbound ID of the client, found by email when 0")
+		email := cmd.String("email", "", "Client email (required)")
+		cmd.Parse(args[1:])
+		if *email == "" {
+			cmd.Usage()
+			os.Exit(2)
+		}
+		initCliDb()
+
+		if *inboundId == 0 {
+			_, inbound, err := inboundService.GetClientInboundByEmail(*email)
+			if err != nil {
+				cliFatal("Failed to find client:", err)
+			}
+			if inbound == nil {
+				cliFatal("Client not found:", *email)
+			}
+			*inboundId = inbound.Id
+		}
+		needRestart, err := inboundService.DelInboundClientByEmail(*inboundId, *email)
+		if err != nil {
+			cliFatal("Failed to delete client:", err)
+		}
+		fmt.Printf("Client %s deleted from inbound %d\n", *email, *inboundId)
+		printRestartNote(needRestart)
+
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+// runInboundCommand handles "x-ui inbound list|export".
+func runInboundCommand(args []string) {
+	usage := func() {
+		fmt.Println("Usage: x-ui inbound <list|export> [options]")
+	}
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+	inboundService := service.InboundService{}
+
+	switch args[0] {
+	case "list":
+		cmd := flag.NewFlagSet("inbound list", flag.ExitOnError)
+		asJSON := cmd.Bool("json", false, "Print JSON")
+		cmd.Parse(args[1:])
+		initCliDb()
+
+		inbounds, err := inboundService.GetAllInbounds()
+		if err != nil {
+			cliFatal("Failed to load inbounds:", err)
+		}
+		if *asJSON {
+			printJSON(inbounds)
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tTAG\tPROTOCOL\tPORT\tENABLE\tCLIENTS\tREMARK")
+		for _, inbound := range inbounds {
+			clients, _ := inboundService.GetClients(inbound)
+			fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%t\t%d\t%s\n", inbound.Id, inbound.Tag, inbound.Protocol, inbound.Port, inbound.Enable, len(clients), inbound.Remark)
+		}
+		w.Flush()
+
+	case "export":
+		cmd := flag.NewFlagSet("inbound export", flag.ExitOnError)
+		id := cmd.Int("id", 0, "Inbound ID to export, all inbounds when 0")
+		withStats := cmd.Bool("stats", false, "Include traffic counters")
+		output := cmd.String("o", "", "Write to this file instead of stdout")
+		cmd.Parse(args[1:])
+		initCliDb()
+
+		userService := service.UserService{}
+		user, err := userService.GetFirstUser()
+		if err != nil {
+			cliFatal("Failed to load panel user:", err)
+		}
+		var export any
+		if *id != 0 {
+			export, err = inboundService.ExportInbound(user.Id, *id, *withStats)
+		} else {
+			export, err = inboundService.ExportInbounds(user.Id, *withStats)
+		}
+		if err != nil {
+			cliFatal("Failed to export inbounds:", err)
+		}
+		data, err := json.MarshalIndent(export, "", "  ")
+		if err != nil {
+			cliFatal(err)
+		}
+		if *output == "" {
+			fmt.Println(string(data))
+			return
+		}
+		if err := os.WriteFile(*output, data, 0o600); err != nil {
+			cliFatal("Failed to write export:", err)
+		}
+		fmt.Println("Inbounds exported to", *output)
+
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+// runBackupCommand handles "x-ui backup", writing a consistent copy of the database.
+func runBackupCommand(args []string) {
+	cmd := flag.NewFlagSet("backup", flag.ExitOnError)
+	output := cmd.String("o", "", "Backup file, x-ui-<time>.db in the current directory when empty")
+	cmd.Parse(args)
+	initCliDb()
+
+	if *output == "" {
+		*output = fmt.Sprintf("x-ui-%s.db", time.Now().Format("20060102-150405"))
+	}
+	serverService := service.ServerService{}
+	data, err := serverService.GetDb()
+	if err != nil {
+		cliFatal("Failed to read database:", err)
+	}
+	if err := os.WriteFile(*output, data, 0o600); err != nil {
+		cliFatal("Failed to write backup:", err)
+	}
+	fmt.Println("Database backed up to", *output)
+}
+
+// runSettingValueCommand handles "x-ui setting get [key]" and "x-ui setting set <key> <value>".
+// Keys are those of the settings API. Secret settings are only printed when asked for by key.
+func runSettingValueCommand(args []string) {
+	settingService := service.SettingService{}
+	switch {
+	case args[0] == "get" && len(args) <= 2:
+		initCliDb()
+		values, keys, err := settingService.GetSettingValues()
+		if err != nil {
+			cliFatal("Failed to read settings:", err)
+		}
+		if len(args) == 2 {
+			value, ok := values[args[1]]
+			if !ok {
+				cliFatal("Unknown setting:", args[1])
+			}
+			fmt.Println(value)
+			return
+		}
+		for _, key := range keys {
+			if service.IsSecretSetting(key) {
+				continue
+			}
+			fmt.Printf("%s=%v\n", key, values[key])
+		}
+	case args[0] == "set" && len(args) == 3:
+		initCliDb()
+		if err := settingService.SetSettingValue(args[1], args[2]); err != nil {
+			cliFatal("Failed to set setting:", err)
+		}
+		fmt.Printf("Setting %s updated, restart the panel to apply it: x-ui restart\n", args[1])
+	default:
+		fmt.Println("Usage: x-ui setting get [key] | x-ui setting set <key> <value>")
+		os.Exit(2)
+	}
+}
+
+// isSettingValueCommand reports whether the setting command is the get/set form rather than the flag form.
+func isSettingValueCommand(args []string) bool {
+	return len(args) > 0 && (args[0] == "get" || args[0] == "set")
+}
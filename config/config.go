@@ -100,6 +100,30 @@ func GetDBPath() string {
 	return fmt.Sprintf("%s/%s.db", GetDBFolderPath(), GetName())
 }
 
+// GetSettingsFilePath returns the path to the optional YAML file with panel setting overrides.
+func GetSettingsFilePath() string {
+	settingsFilePath := os.Getenv("XUI_SETTINGS_FILE")
+	if settingsFilePath != "" {
+		return settingsFilePath
+	}
+	return filepath.Join(GetDBFolderPath(), "settings.yaml")
+}
+
+// GetSecretKey returns the master key for secret settings from the XUI_SECRET_KEY environment variable, empty when unset.
+func GetSecretKey() string {
+	return os.Getenv("XUI_SECRET_KEY")
+}
+
+// GetSecretKeyPath returns the path to the key file holding the master key for secret settings when XUI_SECRET_KEY is unset.
+func GetSecretKeyPath() string {
+	return filepath.Join(GetDBFolderPath(), "secret.key")
+}
+
+// GetSessionRedisURL returns the Redis URL to store sessions in from the XUI_SESSION_REDIS environment variable, empty to keep them in cookies.
+func GetSessionRedisURL() string {
+	return os.Getenv("XUI_SESSION_REDIS")
+}
+
 // GetLogFolder returns the path to the log folder based on environment variables or platform defaults.
 func GetLogFolder() string {
 	logFolderPath := os.Getenv("XUI_LOG_FOLDER")
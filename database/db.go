@@ -5,6 +5,7 @@ package database
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
 	"io/fs"
 	"log"
@@ -24,6 +25,11 @@ import (
 
 var db *gorm.DB
 
+// SchemaVersion is the version of the database schema written by this build. It is stored in the
+// SQLite user_version header, so a backup can be checked before it is restored. Bump it when a
+// change to the models cannot be read by older builds.
+const SchemaVersion = 1
+
 const (
 	defaultUsername = "admin"
 	defaultPassword = "admin"
@@ -38,6 +44,23 @@ func initModels() error {
 		&model.InboundClientIps{},
 		&xray.ClientTraffic{},
 		&model.HistoryOfSeeders{},
+		&model.DepositToken{},
+		&model.Plan{},
+		&model.Payment{},
+		&model.Announcement{},
+		&model.Job{},
+		&model.OutboundPool{},
+		&model.OutboundProbe{},
+		&model.Customer{},
+		&model.TrafficPool{},
+		&model.SubProfile{},
+		&model.Approval{},
+		&model.ScheduledAction{},
+		&model.ScheduledActionRun{},
+		&model.TrafficAdjustment{},
+		&model.Voucher{},
+		&model.Referrer{},
+		&model.Referral{},
 	}
 	for _, model := range models {
 		if err := db.AutoMigrate(model); err != nil {
@@ -48,6 +71,18 @@ func initModels() error {
 	return nil
 }
 
+// stampSchemaVersion records the schema version in a database migrated by this build.
+func stampSchemaVersion() error {
+	var version int
+	if err := db.Raw("PRAGMA user_version;").Scan(&version).Error; err != nil {
+		return err
+	}
+	if version >= SchemaVersion {
+		return nil
+	}
+	return db.Exec(fmt.Sprintf("PRAGMA user_version = %d;", SchemaVersion)).Error
+}
+
 // initUser creates a default admin user if the users table is empty.
 func initUser() error {
 	empty, err := isTableEmpty("users")
@@ -142,10 +177,16 @@ func InitDB(dbPath string) error {
 	if err != nil {
 		return err
 	}
+	if err := trackWrites(db); err != nil {
+		return err
+	}
 
 	if err := initModels(); err != nil {
 		return err
 	}
+	if err := stampSchemaVersion(); err != nil {
+		return err
+	}
 
 	isUsersEmpty, err := isTableEmpty("users")
 	if err != nil {
@@ -226,3 +267,17 @@ func ValidateSQLiteDB(dbPath string) error {
 	}
 	return nil
 }
+
+// Vacuum rebuilds the SQLite database to return free pages to the file system and truncates the WAL file.
+func Vacuum() error {
+	if err := db.Exec("VACUUM;").Error; err != nil {
+		return err
+	}
+	return db.Exec("PRAGMA wal_checkpoint(TRUNCATE);").Error
+}
+
+// OpenReadOnly opens the SQLite database at the given path with a separate read-only connection,
+// leaving the panel's database untouched. The caller closes it.
+func OpenReadOnly(dbPath string) (*gorm.DB, error) {
+	return gorm.Open(sqlite.Open("file:"+dbPath+"?mode=ro"), &gorm.Config{Logger: logger.Discard})
+}
@@ -0,0 +1,75 @@
+// Package dbtest fills databases for the tests and benchmarks of the packages using the database.
+package dbtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/xray"
+
+	"github.com/google/uuid"
+	"github.com/op/go-logging"
+)
+
+// The database has Inbounds inbounds with Subs clients each, every subscription holding one
+// client on every inbound.
+const (
+	Inbounds = 20
+	Subs     = 500
+)
+
+// SubId returns the subscription ID of the j-th client of every inbound.
+func SubId(j int) string {
+	return fmt.Sprintf("sub%d", j)
+}
+
+// Email returns the email of the j-th client of the i-th inbound.
+func Email(i int, j int) string {
+	return fmt.Sprintf("user%d-%d", j, i)
+}
+
+// Setup opens a fresh database in a temporary directory, closed when the test ends, fills it with
+// the VLESS inbounds and their clients and returns the emails of the clients.
+func Setup(tb testing.TB) []string {
+	tb.Helper()
+	logger.InitConsoleLogger(logging.ERROR)
+	if err := database.InitDB(filepath.Join(tb.TempDir(), "x-ui.db")); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { database.CloseDB() })
+	db := database.GetDB()
+	emails := make([]string, 0, Inbounds*Subs)
+	for i := range Inbounds {
+		clients := make([]model.Client, 0, Subs)
+		traffics := make([]xray.ClientTraffic, 0, Subs)
+		for j := range Subs {
+			email, subId := Email(i, j), SubId(j)
+			clients = append(clients, model.Client{ID: uuid.NewString(), Email: email, SubID: subId, Enable: true})
+			traffics = append(traffics, xray.ClientTraffic{Email: email, SubId: subId, Enable: true})
+			emails = append(emails, email)
+		}
+		settings, err := json.Marshal(map[string]any{"clients": clients, "decryption": "none"})
+		if err != nil {
+			tb.Fatal(err)
+		}
+		inbound := &model.Inbound{
+			Remark:         fmt.Sprintf("inbound-%d", i),
+			Enable:         true,
+			Port:           10000 + i,
+			Protocol:       model.VLESS,
+			Settings:       string(settings),
+			StreamSettings: `{"network":"tcp","security":"none","tcpSettings":{"header":{"type":"none"}}}`,
+			Tag:            fmt.Sprintf("inbound-%d", 10000+i),
+			ClientStats:    traffics,
+		}
+		if err := db.Create(inbound).Error; err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return emails
+}
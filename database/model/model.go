@@ -2,7 +2,12 @@
 package model
 
 import (
+	"database/sql/driver"
+	"encoding/json"
 	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
 
 	"github.com/mhsanaei/3x-ui/v2/util/json_util"
 	"github.com/mhsanaei/3x-ui/v2/xray"
@@ -28,18 +33,34 @@ type User struct {
 	Id       int    `json:"id" gorm:"primaryKey;autoIncrement"`
 	Username string `json:"username"`
 	Password string `json:"password"`
-	ApiKey   string `json:"apiKey" gorm:"uniqueIndex"`
+	ApiKey   string `json:"-" gorm:"uniqueIndex"` // SHA-256 hash of the API key, the key itself is only shown when generated
 }
 
 // Inbound represents an Xray inbound configuration with traffic statistics and settings.
 type Inbound struct {
 	Id                   int                  `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`                                                    // Unique identifier
+	ExternalId           string               `json:"externalId" form:"externalId" gorm:"index"`                                                       // Stable UUID for external tools, generated when empty
 	UserId               int                  `json:"-"`                                                                                               // Associated user ID
 	Up                   int64                `json:"up" form:"up"`                                                                                    // Upload traffic in bytes
 	Down                 int64                `json:"down" form:"down"`                                                                                // Download traffic in bytes
 	Total                int64                `json:"total" form:"total"`                                                                              // Total traffic limit in bytes
 	AllTime              int64                `json:"allTime" form:"allTime" gorm:"default:0"`                                                         // All-time traffic usage
 	Remark               string               `json:"remark" form:"remark"`                                                                            // Human-readable remark
+	RemarkTemplate       string               `json:"remarkTemplate" form:"remarkTemplate"`                                                            // Link remark template overriding the panel setting
+	Group                string               `json:"group" form:"group" gorm:"index"`                                                                 // Group the inbound is listed under
+	SpeedLimit           int64                `json:"speedLimit" form:"speedLimit"`                                                                    // Rate cap in the unit of SpeedUnit, 0 for unlimited
+	SpeedBurst           int64                `json:"speedBurst" form:"speedBurst"`                                                                    // Burst allowance in KB, 0 for one second of the cap
+	SpeedUnit            string               `json:"speedUnit" form:"speedUnit"`                                                                      // Unit of SpeedLimit: empty for KB/s, "mbit" for Mbit/s
+	ConnLimit            int                  `json:"connLimit" form:"connLimit"`                                                                      // Maximum concurrent TCP connections, 0 for unlimited
+	ConnLimitPerIp       int                  `json:"connLimitPerIp" form:"connLimitPerIp"`                                                            // Maximum concurrent TCP connections per source IP, 0 for unlimited
+	PortHopRange         string               `json:"portHopRange" form:"portHopRange"`                                                                // Port range like 20000-30000 the inbound hops within, empty to disable
+	PortHopInterval      int                  `json:"portHopInterval" form:"portHopInterval"`                                                          // Minutes between port hops
+	PortHopAt            int64                `json:"portHopAt" gorm:"default:0"`                                                                      // Last port hop timestamp in milliseconds
+	ExtraPorts           string               `json:"extraPorts" form:"extraPorts"`                                                                    // More ports and ranges like 20000-20100,30000 the inbound listens on besides Port
+	SubPortMode          string               `json:"subPortMode" form:"subPortMode"`                                                                  // Port of subscription links: empty for Port, "random" for a random port the inbound listens on
+	ExtraListens         string               `json:"extraListens" form:"extraListens"`                                                                // More comma separated IP addresses the inbound listens on besides Listen
+	SubExclude           bool                 `json:"subExclude" form:"subExclude"`                                                                    // Leave the inbound out of subscriptions, its clients' direct links still work
+	Extension            string               `json:"extension" form:"extension"`                                                                      // JSON object deep-merged into the generated Xray inbound, for core options the panel does not model
 	Enable               bool                 `json:"enable" form:"enable" gorm:"index:idx_enable_traffic_reset,priority:1"`                           // Whether the inbound is enabled
 	ExpiryTime           int64                `json:"expiryTime" form:"expiryTime"`                                                                    // Expiration timestamp
 	TrafficReset         string               `json:"trafficReset" form:"trafficReset" gorm:"default:never;index:idx_enable_traffic_reset,priority:2"` // Traffic reset schedule
@@ -72,6 +93,336 @@ type InboundClientIps struct {
 	Ips         string `json:"ips" form:"ips"`
 }
 
+// DepositToken is a limited-use token that lets an external system create a client on a preset inbound.
+// Only a hash of the token is stored; the token itself is shown once when it is created.
+type DepositToken struct {
+	Id         int    `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	TokenHash  string `json:"-" gorm:"uniqueIndex"`                    // SHA-256 of the token
+	Remark     string `json:"remark" form:"remark"`                    // Human-readable remark
+	InboundId  int    `json:"inboundId" form:"inboundId"`              // Inbound the client is created on
+	TotalGB    int64  `json:"totalGB" form:"totalGB"`                  // Traffic quota of the created client in bytes
+	ExpiryDays int    `json:"expiryDays" form:"expiryDays"`            // Validity of the created client in days, 0 for unlimited
+	LimitIP    int    `json:"limitIp" form:"limitIp"`                  // IP limit of the created client
+	MaxUses    int    `json:"maxUses" form:"maxUses" gorm:"default:1"` // Number of clients the token can create
+	Uses       int    `json:"uses" gorm:"default:0"`                   // Number of clients created so far
+	ExpiresAt  int64  `json:"expiresAt" form:"expiresAt"`              // Token expiration timestamp in milliseconds, 0 for never
+	CreatedAt  int64  `json:"createdAt"`                               // Creation timestamp in milliseconds
+}
+
+// Plan is a purchasable client package that is provisioned on an inbound after a verified payment.
+type Plan struct {
+	Id         int        `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	Name       string     `json:"name" form:"name"`
+	Enable     bool       `json:"enable" form:"enable"`
+	Price      int64      `json:"price" form:"price"`           // Price in the currency's smallest unit
+	Currency   string     `json:"currency" form:"currency"`     // Currency code as reported by the payment provider
+	Prices     PlanPrices `json:"prices" gorm:"type:text"`      // Prices in further currencies
+	InboundId  int        `json:"inboundId" form:"inboundId"`   // Inbound the client is created on
+	InboundIds string     `json:"inboundIds" form:"inboundIds"` // Comma separated IDs of further inbounds the client can be created on instead
+	TotalGB    int64      `json:"totalGB" form:"totalGB"`       // Traffic quota of the created client in bytes
+	ExpiryDays int        `json:"expiryDays" form:"expiryDays"` // Validity of the created client in days, 0 for unlimited
+	LimitIP    int        `json:"limitIp" form:"limitIp"`       // IP limit of the created client
+}
+
+// PlanPrice is the price of a plan in one currency.
+type PlanPrice struct {
+	Price    int64  `json:"price"`    // Price in the currency's smallest unit
+	Currency string `json:"currency"` // Currency code as reported by the payment provider
+}
+
+// PlanPrices are the prices of a plan in further currencies, stored as JSON.
+type PlanPrices []PlanPrice
+
+// Value implements driver.Valuer.
+func (p PlanPrices) Value() (driver.Value, error) {
+	if len(p) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(p)
+	return string(data), err
+}
+
+// Scan implements sql.Scanner.
+func (p *PlanPrices) Scan(value any) error {
+	var raw []byte
+	switch v := value.(type) {
+	case nil:
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return fmt.Errorf("unsupported plan prices type %T", value)
+	}
+	*p = PlanPrices{}
+	if len(raw) == 0 {
+		return nil
+	}
+	return json.Unmarshal(raw, p)
+}
+
+// PriceIn returns the price of the plan in a currency, compared case-insensitively, and whether
+// the plan has one.
+func (p *Plan) PriceIn(currency string) (int64, bool) {
+	if strings.EqualFold(p.Currency, currency) {
+		return p.Price, true
+	}
+	for _, price := range p.Prices {
+		if strings.EqualFold(price.Currency, currency) {
+			return price.Price, true
+		}
+	}
+	return 0, false
+}
+
+// AllowedInbounds returns the IDs of the inbounds the client of the plan can be created on, the
+// default one first. IDs that can not be parsed are left out.
+func (p *Plan) AllowedInbounds() []int {
+	ids := []int{p.InboundId}
+	for _, field := range strings.Split(p.InboundIds, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(field))
+		if err == nil && id > 0 && id != p.InboundId {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Payment status values.
+const (
+	PaymentPending     = "pending"
+	PaymentProvisioned = "provisioned"
+	PaymentFailed      = "failed"
+)
+
+// Payment records a verified payment notification and the client provisioned for it.
+type Payment struct {
+	Id          int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	Provider    string `json:"provider" gorm:"uniqueIndex:idx_payment_reference,priority:1"`  // Payment provider name
+	Reference   string `json:"reference" gorm:"uniqueIndex:idx_payment_reference,priority:2"` // Payment ID at the provider
+	PlanId      int    `json:"planId"`
+	InboundId   int    `json:"inboundId"`   // Inbound chosen for the client, 0 for the plan's default
+	Amount      int64  `json:"amount"`      // Paid amount in the currency's smallest unit
+	Currency    string `json:"currency"`    // Paid currency
+	Email       string `json:"email"`       // Customer email used for delivery
+	TgID        int64  `json:"tgId"`        // Customer Telegram user ID used for delivery
+	ClientEmail string `json:"clientEmail"` // Email of the provisioned client
+	Referral    string `json:"referral"`    // Referral code the customer came with
+	Status      string `json:"status"`      // pending, provisioned or failed
+	Error       string `json:"error"`       // Last provisioning error
+	CreatedAt   int64  `json:"createdAt"`   // Creation timestamp in milliseconds
+}
+
+// Announcement is a message from the operator to all clients. It is shown in the client portal and on the
+// subscription page, can be broadcast via Telegram and can be injected into subscriptions as an info node.
+type Announcement struct {
+	Id        int    `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	Title     string `json:"title" form:"title"`
+	Message   string `json:"message" form:"message"`
+	Enable    bool   `json:"enable" form:"enable"`
+	ShowInSub bool   `json:"showInSub" form:"showInSub"` // Add an info node with the title at the top of subscriptions
+	ExpiresAt int64  `json:"expiresAt" form:"expiresAt"` // Expiration timestamp in milliseconds, 0 for never
+	CreatedAt int64  `json:"createdAt"`                  // Creation timestamp in milliseconds
+	SentAt    int64  `json:"sentAt"`                     // Last Telegram broadcast timestamp in milliseconds
+}
+
+// Customer owns the clients sharing its subscription ID across inbounds. Its quota and expiry
+// are counted over all of them, so a customer with clients on several protocols gets one plan.
+type Customer struct {
+	Id         int    `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	Name       string `json:"name" form:"name"`
+	SubId      string `json:"subId" form:"subId" gorm:"unique"` // Subscription ID of the clients, generated when empty and fixed afterwards
+	TotalGB    int64  `json:"totalGB" form:"totalGB"`           // Traffic quota in bytes over all clients, 0 for unlimited
+	ExpiryTime int64  `json:"expiryTime" form:"expiryTime"`     // Expiration timestamp in milliseconds, 0 for never
+	Comment    string `json:"comment" form:"comment"`
+	CreatedAt  int64  `json:"createdAt"` // Creation timestamp in milliseconds
+}
+
+// TrafficPool is a traffic budget shared by its clients on any inbounds. The traffic of the
+// clients is counted against it from the moment they join, and all of them are disabled once
+// it is used up.
+type TrafficPool struct {
+	Id        int    `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	Name      string `json:"name" form:"name" gorm:"unique"`
+	TotalGB   int64  `json:"totalGB" form:"totalGB"` // Shared traffic budget in bytes, 0 for unlimited
+	Up        int64  `json:"up"`                     // Upload traffic of the clients since the last reset in bytes
+	Down      int64  `json:"down"`                   // Download traffic of the clients since the last reset in bytes
+	Comment   string `json:"comment" form:"comment"`
+	CreatedAt int64  `json:"createdAt"` // Creation timestamp in milliseconds
+	ResetAt   int64  `json:"resetAt"`   // Last usage reset timestamp in milliseconds
+}
+
+// SubProfile is a named view of a subscription served at /sub/:subId/:profile, selecting some of
+// its inbounds and the output format, so one customer gets configs tailored to each device.
+type SubProfile struct {
+	Id         int    `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	SubId      string `json:"subId" form:"subId" gorm:"uniqueIndex:idx_sub_profile_name"` // Subscription the profile belongs to, empty for a profile of every subscription
+	Name       string `json:"name" form:"name" gorm:"uniqueIndex:idx_sub_profile_name"`   // Name in the profile URL, like mobile or router
+	InboundIds string `json:"inboundIds" form:"inboundIds"`                               // Comma separated IDs of the inbounds included, all when empty
+	Format     string `json:"format" form:"format"`                                       // Output format: empty for the subscription default, base64, plain or json
+	Options    string `json:"options" form:"options"`                                     // Link options as query parameters, like port=8443&deterministic=1
+	Comment    string `json:"comment" form:"comment"`
+}
+
+// OutboundPool is an external subscription whose entries run as outbounds behind a balancer.
+type OutboundPool struct {
+	Id          int    `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	Tag         string `json:"tag" form:"tag" gorm:"unique"`   // Balancer tag; the outbounds are tagged <tag>-1, <tag>-2 and so on
+	Url         string `json:"url" form:"url"`                 // Subscription URL returning share links, plain or base64 encoded
+	Interval    int    `json:"interval" form:"interval"`       // Minutes between fetches
+	Strategy    string `json:"strategy" form:"strategy"`       // Balancer strategy: random, roundRobin or leastPing
+	InboundTags string `json:"inboundTags" form:"inboundTags"` // Comma separated tags of the inbounds routed to the balancer, empty to route by hand
+	Enable      bool   `json:"enable" form:"enable"`           // Whether the outbounds are added to Xray
+	Outbounds   string `json:"outbounds"`                      // JSON array of the outbounds of the last successful fetch
+	FetchedAt   int64  `json:"fetchedAt"`                      // Last fetch timestamp in milliseconds
+	LastError   string `json:"lastError"`                      // Error of the last fetch, empty when it succeeded
+}
+
+// OutboundProbe is the result of one connection attempt to the server of an outbound.
+type OutboundProbe struct {
+	Id         int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	Tag        string `json:"tag" gorm:"index"`       // Outbound tag
+	Address    string `json:"address"`                // Server host and port that was dialed
+	Success    bool   `json:"success"`                // Whether the connection and the TLS handshake, if any, succeeded
+	TcpLatency int64  `json:"tcpLatency"`             // TCP connect time in milliseconds
+	TlsLatency int64  `json:"tlsLatency"`             // TLS handshake time in milliseconds, 0 without TLS
+	Error      string `json:"error"`                  // Why the probe failed
+	CreatedAt  int64  `json:"createdAt" gorm:"index"` // Probe timestamp in milliseconds
+}
+
+// Job status values.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCanceled  = "canceled"
+)
+
+// Job is a long running operation executed in the background, kept so its status can be polled.
+type Job struct {
+	Id         int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	Type       string `json:"type" gorm:"index"`      // Operation, e.g. geofile or importDB
+	Status     string `json:"status" gorm:"index"`    // queued, running, succeeded, failed or canceled
+	Progress   int    `json:"progress"`               // Completion in percent
+	Message    string `json:"message"`                // What the job is currently doing
+	Error      string `json:"error"`                  // Why the job failed
+	Result     string `json:"result"`                 // JSON result of a succeeded job
+	CreatedAt  int64  `json:"createdAt" gorm:"index"` // Creation timestamp in milliseconds
+	StartedAt  int64  `json:"startedAt"`              // Start timestamp in milliseconds
+	FinishedAt int64  `json:"finishedAt"`             // Finish timestamp in milliseconds
+}
+
+// Approval status values.
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalFailed   = "failed"
+	ApprovalRejected = "rejected"
+	ApprovalExpired  = "expired"
+)
+
+// Approval is a destructive operation held back until a second admin approves it.
+type Approval struct {
+	Id          int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	Action      string `json:"action"`              // Operation: delInbound, resetAllTraffics or importDB
+	Target      string `json:"target"`              // Object of the operation, the inbound ID for delInbound
+	Summary     string `json:"summary"`             // What the operation does, for the approver
+	Status      string `json:"status" gorm:"index"` // pending, approved, failed, rejected or expired
+	RequestedBy string `json:"requestedBy"`         // Admin who asked for it, user:<id> or telegram:<chat id>
+	DecidedBy   string `json:"decidedBy"`           // Admin who approved or rejected it
+	Error       string `json:"error"`               // Why the approved operation failed
+	CreatedAt   int64  `json:"createdAt"`           // Creation timestamp in milliseconds
+	ExpiresAt   int64  `json:"expiresAt"`           // Time the request expires unless approved, in milliseconds
+	DecidedAt   int64  `json:"decidedAt"`           // Approval or rejection timestamp in milliseconds
+}
+
+// ScheduledAction is an operation run once at a given time or repeatedly on a cron schedule.
+type ScheduledAction struct {
+	Id        int    `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	Name      string `json:"name" form:"name"`           // Label shown in lists
+	Action    string `json:"action" form:"action"`       // enableInbound, disableInbound, resetInboundTraffic, resetClientTraffic, enableClient, disableClient, delClient or backup
+	InboundId int    `json:"inboundId" form:"inboundId"` // Inbound the action applies to
+	Email     string `json:"email" form:"email"`         // Client the action applies to
+	RunAt     int64  `json:"runAt" form:"runAt"`         // Time of a one-off action in milliseconds, 0 for a recurring one
+	Schedule  string `json:"schedule" form:"schedule"`   // Cron expression of a recurring action in the panel time zone, like "0 3 * * *" or "@daily"
+	Enable    bool   `json:"enable" form:"enable"`       // Whether the action runs; one-off actions are disabled once they ran
+	NextRunAt int64  `json:"nextRunAt"`                  // Next run timestamp in milliseconds, 0 when there is none
+	LastRunAt int64  `json:"lastRunAt"`                  // Last run timestamp in milliseconds
+	LastError string `json:"lastError"`                  // Error of the last run, empty when it succeeded
+}
+
+// ScheduledActionRun is one execution of a scheduled action.
+type ScheduledActionRun struct {
+	Id        int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	ActionId  int    `json:"actionId" gorm:"index"` // Scheduled action that ran
+	Action    string `json:"action"`                // Operation it ran
+	StartedAt int64  `json:"startedAt"`             // Start timestamp in milliseconds
+	Duration  int64  `json:"duration"`              // Run time in milliseconds
+	Success   bool   `json:"success"`               // Whether the operation succeeded
+	Error     string `json:"error"`                 // Why it failed
+}
+
+// TrafficAdjustment records a manual correction of the traffic counters of a client, such as a
+// support credit, with who made it and why.
+type TrafficAdjustment struct {
+	Id         int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	Email      string `json:"email" gorm:"index"` // Client whose counters were corrected
+	InboundId  int    `json:"inboundId"`          // Inbound of the client
+	Up         int64  `json:"up"`                 // Change of the upload counter in bytes, negative for a credit
+	Down       int64  `json:"down"`               // Change of the download counter in bytes, negative for a credit
+	UpAfter    int64  `json:"upAfter"`            // Upload counter after the correction in bytes
+	DownAfter  int64  `json:"downAfter"`          // Download counter after the correction in bytes
+	Reason     string `json:"reason"`             // Why the counters were corrected
+	AdjustedBy string `json:"adjustedBy"`         // Admin who made the correction, user:<id>
+	CreatedAt  int64  `json:"createdAt"`          // Creation timestamp in milliseconds
+}
+
+// Voucher types, the unit of a voucher's value.
+const (
+	VoucherDays = "days" // Value is a number of days
+	VoucherGB   = "gb"   // Value is a number of GB
+)
+
+// Voucher is a single-use code that adds days or traffic to an existing client, or creates a new
+// client from its template on its inbound, when redeemed by the client portal or the Telegram bot.
+type Voucher struct {
+	Id          int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	Code        string `json:"code" gorm:"uniqueIndex"` // Code handed to the customer
+	Batch       string `json:"batch" gorm:"index"`      // Name of the batch the voucher was generated in
+	Type        string `json:"type"`                    // Unit of the value, days or gb
+	Value       int    `json:"value"`                   // Days or GB the voucher adds
+	InboundId   int    `json:"inboundId"`               // Inbound new clients are created on, 0 when the voucher only extends clients
+	TotalGB     int64  `json:"totalGB"`                 // Traffic quota of a created client in bytes, before a GB value is added
+	ExpiryDays  int    `json:"expiryDays"`              // Validity of a created client in days, before a days value is added
+	LimitIP     int    `json:"limitIp"`                 // IP limit of a created client
+	ExpiresAt   int64  `json:"expiresAt"`               // Voucher expiration timestamp in milliseconds, 0 for never
+	RedeemedAt  int64  `json:"redeemedAt"`              // Redemption timestamp in milliseconds, 0 while unused
+	RedeemedBy  string `json:"redeemedBy"`              // Email of the client the voucher was applied to
+	RedeemedVia string `json:"redeemedVia"`             // Where it was redeemed: portal, telegram or api
+	NewClient   bool   `json:"newClient"`               // Whether the redemption created the client
+	CreatedAt   int64  `json:"createdAt"`               // Creation timestamp in milliseconds
+}
+
+// Referrer is a reseller or affiliate, such as a Telegram sales channel, whose referral code
+// attributes the clients created with it to them.
+type Referrer struct {
+	Id        int    `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	Code      string `json:"code" form:"code" gorm:"uniqueIndex"` // Referral code, random when empty
+	Name      string `json:"name" form:"name"`                    // Name of the reseller or channel
+	Enable    bool   `json:"enable" form:"enable"`                // Whether new clients are attributed to the code
+	Remark    string `json:"remark" form:"remark"`                // Human-readable remark, such as commission terms
+	CreatedAt int64  `json:"createdAt"`                           // Creation timestamp in milliseconds
+}
+
+// Referral attributes a client to the referrer it was created for.
+type Referral struct {
+	Id         int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	ReferrerId int    `json:"referrerId" gorm:"index"`  // Referrer the client is attributed to
+	Email      string `json:"email" gorm:"uniqueIndex"` // Referred client
+	CreatedAt  int64  `json:"createdAt"`                // Attribution timestamp in milliseconds
+}
+
 // HistoryOfSeeders tracks which database seeders have been executed to prevent re-running.
 type HistoryOfSeeders struct {
 	Id         int    `json:"id" gorm:"primaryKey;autoIncrement"`
@@ -84,15 +435,119 @@ func (i *Inbound) GenXrayInboundConfig() *xray.InboundConfig {
 	if listen != "" {
 		listen = fmt.Sprintf("\"%v\"", listen)
 	}
+	ports := ""
+	if i.ExtraPorts != "" {
+		ports = strconv.Itoa(i.Port) + "," + i.ExtraPorts
+	}
 	return &xray.InboundConfig{
 		Listen:         json_util.RawMessage(listen),
 		Port:           i.Port,
+		Ports:          ports,
 		Protocol:       string(i.Protocol),
 		Settings:       json_util.RawMessage(i.Settings),
 		StreamSettings: json_util.RawMessage(i.StreamSettings),
 		Tag:            i.Tag,
 		Sniffing:       json_util.RawMessage(i.Sniffing),
+		Extension:      json_util.RawMessage(i.Extension),
+	}
+}
+
+// ExtraListenList returns the extra listen addresses of the inbound.
+func (i *Inbound) ExtraListenList() []string {
+	var listens []string
+	for _, listen := range strings.Split(i.ExtraListens, ",") {
+		if listen = strings.TrimSpace(listen); listen != "" && listen != i.Listen {
+			listens = append(listens, listen)
+		}
+	}
+	return listens
+}
+
+// ListenAddresses returns every address the inbound listens on, Listen first.
+func (i *Inbound) ListenAddresses() []string {
+	return append([]string{i.Listen}, i.ExtraListenList()...)
+}
+
+// GenXrayInboundConfigs generates the Xray inbound configurations of the Inbound model, one
+// per listen address. The extra addresses are served by copies tagged with xray.ListenTag.
+func (i *Inbound) GenXrayInboundConfigs() []*xray.InboundConfig {
+	config := i.GenXrayInboundConfig()
+	configs := []*xray.InboundConfig{config}
+	for _, listen := range i.ExtraListenList() {
+		extra := *config
+		extra.Listen = json_util.RawMessage(fmt.Sprintf("\"%v\"", listen))
+		extra.Tag = xray.ListenTag(i.Tag, listen)
+		configs = append(configs, &extra)
+	}
+	return configs
+}
+
+// SubPortRandom makes subscription links of an inbound with extra ports use a random port.
+const SubPortRandom = "random"
+
+// maxExtraPorts bounds the number of extra ports of an inbound.
+const maxExtraPorts = 1000
+
+// ParsePortList parses a comma separated list of ports and ranges like 20000-20100,30000
+// into the ports it covers, in order and without duplicates.
+func ParsePortList(list string) ([]int, error) {
+	var ports []int
+	seen := map[int]bool{}
+	for _, part := range strings.Split(list, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, isRange := strings.Cut(part, "-")
+		start, err1 := strconv.Atoi(strings.TrimSpace(from))
+		end, err2 := start, error(nil)
+		if isRange {
+			end, err2 = strconv.Atoi(strings.TrimSpace(to))
+		}
+		if err1 != nil || err2 != nil || start < 1 || end > 65535 || start > end {
+			return nil, fmt.Errorf("invalid port or range %q", part)
+		}
+		if len(ports)+end-start+1 > maxExtraPorts {
+			return nil, fmt.Errorf("more than %d ports", maxExtraPorts)
+		}
+		for port := start; port <= end; port++ {
+			if !seen[port] {
+				seen[port] = true
+				ports = append(ports, port)
+			}
+		}
+	}
+	return ports, nil
+}
+
+// ListenPorts returns every port the inbound listens on, Port first.
+func (i *Inbound) ListenPorts() []int {
+	ports := []int{i.Port}
+	extra, _ := ParsePortList(i.ExtraPorts)
+	for _, port := range extra {
+		if port != i.Port {
+			ports = append(ports, port)
+		}
+	}
+	return ports
+}
+
+// SubPort returns the port subscription links of the inbound use.
+func (i *Inbound) SubPort() int {
+	if i.SubPortMode != SubPortRandom || i.ExtraPorts == "" {
+		return i.Port
+	}
+	ports := i.ListenPorts()
+	return ports[rand.IntN(len(ports))]
+}
+
+// InSubscription reports whether the link of a client of the inbound goes into its subscription.
+// The client's own choice overrides the inbound's.
+func (i *Inbound) InSubscription(client Client) bool {
+	if client.SubExclude != nil {
+		return !*client.SubExclude
 	}
+	return !i.SubExclude
 }
 
 // Setting stores key-value configuration settings for the 3x-ui panel.
@@ -104,19 +559,28 @@ type Setting struct {
 
 // Client represents a client configuration for Xray inbounds with traffic limits and settings.
 type Client struct {
-	ID         string `json:"id"`                           // Unique client identifier
-	Security   string `json:"security"`                     // Security method (e.g., "auto", "aes-128-gcm")
-	Password   string `json:"password"`                     // Client password
-	Flow       string `json:"flow"`                         // Flow control (XTLS)
-	Email      string `json:"email"`                        // Client email identifier
-	LimitIP    int    `json:"limitIp"`                      // IP limit for this client
-	TotalGB    int64  `json:"totalGB" form:"totalGB"`       // Total traffic limit in GB
-	ExpiryTime int64  `json:"expiryTime" form:"expiryTime"` // Expiration timestamp
-	Enable     bool   `json:"enable" form:"enable"`         // Whether the client is enabled
-	TgID       int64  `json:"tgId" form:"tgId"`             // Telegram user ID for notifications
-	SubID      string `json:"subId" form:"subId"`           // Subscription identifier
-	Comment    string `json:"comment" form:"comment"`       // Client comment
-	Reset      int    `json:"reset" form:"reset"`           // Reset period in days
-	CreatedAt  int64  `json:"created_at,omitempty"`         // Creation timestamp
-	UpdatedAt  int64  `json:"updated_at,omitempty"`         // Last update timestamp
+	ID           string   `json:"id"`                                         // Unique client identifier
+	Security     string   `json:"security"`                                   // Security method (e.g., "auto", "aes-128-gcm")
+	Password     string   `json:"password"`                                   // Client password
+	Flow         string   `json:"flow"`                                       // Flow control (XTLS)
+	Email        string   `json:"email"`                                      // Client email identifier
+	LimitIP      int      `json:"limitIp"`                                    // IP limit for this client
+	TotalGB      int64    `json:"totalGB" form:"totalGB"`                     // Total traffic limit in GB
+	ExpiryTime   int64    `json:"expiryTime" form:"expiryTime"`               // Expiration timestamp
+	Enable       bool     `json:"enable" form:"enable"`                       // Whether the client is enabled
+	TgID         int64    `json:"tgId" form:"tgId"`                           // Telegram user ID for notifications
+	SubID        string   `json:"subId" form:"subId"`                         // Subscription identifier
+	Comment      string   `json:"comment" form:"comment"`                     // Client comment
+	Reset        int      `json:"reset" form:"reset"`                         // Reset period in days
+	CreatedAt    int64    `json:"created_at,omitempty"`                       // Creation timestamp
+	UpdatedAt    int64    `json:"updated_at,omitempty"`                       // Last update timestamp
+	Tags         []string `json:"tags,omitempty" form:"tags"`                 // Free-form tags such as "plan:pro"
+	SpeedLimit   int64    `json:"speedLimit,omitempty" form:"speedLimit"`     // Rate cap in the unit of SpeedUnit, 0 for unlimited
+	SpeedBurst   int64    `json:"speedBurst,omitempty" form:"speedBurst"`     // Burst allowance in KB, 0 for one second of the cap
+	SpeedUnit    string   `json:"speedUnit,omitempty" form:"speedUnit"`       // Unit of SpeedLimit: empty for KB/s, "mbit" for Mbit/s
+	ExpiryAction string   `json:"expiryAction,omitempty" form:"expiryAction"` // What happens at expiry: disable (default), delete, throttle or captive
+	ExternalId   string   `json:"externalId,omitempty" form:"externalId"`     // Stable UUID for external tools, generated when empty
+	Level        int      `json:"level,omitempty" form:"level"`               // Xray policy level the client's connections use
+	Fingerprint  string   `json:"fingerprint,omitempty" form:"fingerprint"`   // uTLS fingerprint in the client's links, the inbound's when empty
+	SubExclude   *bool    `json:"subExclude,omitempty" form:"subExclude"`     // Leave the client's link out of or in its subscription, the inbound's choice when unset
 }
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+)
+
+// writeVersion counts the writes committed to the database.
+var writeVersion atomic.Uint64
+
+// WriteVersion returns a counter that changes whenever a write to the database is committed, so
+// results derived from its contents can be cached until the next write. Read it before reading
+// the data a result is derived from: a write committed in between then changes it again.
+func WriteVersion() uint64 {
+	return writeVersion.Load()
+}
+
+// versionPool is the connection pool of the database, counting the writes done outside
+// transactions and the transactions committed.
+type versionPool struct {
+	*sql.DB
+}
+
+// versionTx is a transaction of the database, counting a write when it is committed.
+type versionTx struct {
+	*sql.Tx
+	db *sql.DB
+}
+
+// trackWrites makes the database count its writes in the write version.
+func trackWrites(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	db.ConnPool = &versionPool{DB: sqlDB}
+	db.Statement.ConnPool = db.ConnPool
+	return nil
+}
+
+func (p *versionPool) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	result, err := p.DB.ExecContext(ctx, query, args...)
+	writeVersion.Add(1)
+	return result, err
+}
+
+func (p *versionPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	tx, err := p.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &versionTx{Tx: tx, db: p.DB}, nil
+}
+
+func (p *versionPool) GetDBConn() (*sql.DB, error) {
+	return p.DB, nil
+}
+
+func (t *versionTx) Commit() error {
+	err := t.Tx.Commit()
+	writeVersion.Add(1)
+	return err
+}
+
+func (t *versionTx) GetDBConn() (*sql.DB, error) {
+	return t.db, nil
+}
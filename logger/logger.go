@@ -56,6 +56,22 @@ func InitLogger(level logging.Level) {
 	logger = newLogger
 }
 
+// InitConsoleLogger initializes logging to stderr only, for command line tools that run next to
+// the panel and must not truncate its log file.
+func InitConsoleLogger(level logging.Level) {
+	newLogger := logging.MustGetLogger("x-ui")
+	backend := logging.NewBackendFormatter(logging.NewLogBackend(os.Stderr, "", 0), newFormatter(false))
+	leveledBackend := logging.AddModuleLevel(backend)
+	leveledBackend.SetLevel(level, "x-ui")
+	newLogger.SetBackend(leveledBackend)
+	logger = newLogger
+}
+
+// GetLogFilePath returns the path of the panel's log file.
+func GetLogFilePath() string {
+	return filepath.Join(config.GetLogFolder(), logFileName)
+}
+
 // initDefaultBackend creates the console/syslog logging backend.
 // Windows: Uses stderr directly (no syslog support)
 // Unix-like: Attempts syslog, falls back to stderr
@@ -90,7 +106,7 @@ func initFileBackend() logging.Backend {
 		return nil
 	}
 
-	logPath := filepath.Join(logDir, logFileName)
+	logPath := GetLogFilePath()
 	file, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o660)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to open log file %s: %v\n", logPath, err)
@@ -89,7 +89,7 @@ func runWebServer() {
 
 	sigCh := make(chan os.Signal, 1)
 	// Trap shutdown signals
-	signal.Notify(sigCh, syscall.SIGHUP, syscall.SIGTERM)
+	signal.Notify(sigCh, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGINT)
 	for {
 		sig := <-sigCh
 
@@ -127,6 +127,10 @@ func runWebServer() {
 		default:
 			server.Stop()
 			subServer.Stop()
+			if err := database.Checkpoint(); err != nil {
+				logger.Warning("Error checkpointing database:", err)
+			}
+			database.CloseDB()
 			log.Println("Shutting down servers.")
 			return
 		}
@@ -381,6 +385,8 @@ func GetListenIP(getListen bool) {
 // migrateDb performs database migration operations for the 3x-ui panel.
 func migrateDb() {
 	inboundService := service.InboundService{}
+	settingService := service.SettingService{}
+	userService := service.UserService{}
 
 	err := database.InitDB(config.GetDBPath())
 	if err != nil {
@@ -388,6 +394,12 @@ func migrateDb() {
 	}
 	fmt.Println("Start migrating database...")
 	inboundService.MigrateDB()
+	if err := settingService.MigrateSecretSettings(); err != nil {
+		fmt.Println("Encrypting secret settings failed:", err)
+	}
+	if err := userService.MigrateApiKeys(); err != nil {
+		fmt.Println("Hashing API keys failed:", err)
+	}
 	fmt.Println("Migration done!")
 }
 
@@ -445,7 +457,11 @@ func main() {
 		fmt.Println("Commands:")
 		fmt.Println("    run            run web panel")
 		fmt.Println("    migrate        migrate form other/old x-ui")
-		fmt.Println("    setting        set settings")
+		fmt.Println("    setting        set settings, or get/set a single setting: setting get [key], setting set <key> <value>")
+		fmt.Println("    client         manage clients without the web panel: client add|del|list")
+		fmt.Println("    inbound        list or export inbounds: inbound list|export")
+		fmt.Println("    backup         write a copy of the database")
+		fmt.Println("    tui            show a live status screen in the terminal")
 	}
 
 	flag.Parse()
@@ -465,6 +481,10 @@ func main() {
 	case "migrate":
 		migrateDb()
 	case "setting":
+		if isSettingValueCommand(os.Args[2:]) {
+			runSettingValueCommand(os.Args[2:])
+			return
+		}
 		err := settingCmd.Parse(os.Args[2:])
 		if err != nil {
 			fmt.Println(err)
@@ -501,6 +521,14 @@ func main() {
 		} else {
 			updateCert(webCertFile, webKeyFile)
 		}
+	case "client":
+		runClientCommand(os.Args[2:])
+	case "inbound":
+		runInboundCommand(os.Args[2:])
+	case "backup":
+		runBackupCommand(os.Args[2:])
+	case "tui":
+		runTuiCommand(os.Args[2:])
 	default:
 		fmt.Println("Invalid subcommands")
 		fmt.Println()
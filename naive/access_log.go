@@ -0,0 +1,98 @@
+package naive
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+)
+
+// accessLogEntry holds the fields of a Caddy access log line the traffic is counted from.
+type accessLogEntry struct {
+	Request struct {
+		Headers map[string][]string `json:"headers"`
+	} `json:"request"`
+	BytesRead int64 `json:"bytes_read"` // Bytes the client sent
+	Size      int64 `json:"size"`       // Bytes sent to the client
+}
+
+// Usage is the traffic of an account.
+type Usage struct {
+	Up   int64
+	Down int64
+}
+
+// ReadAccessLog sums the traffic of each user in the access log from the given offset and
+// returns it with the offset to continue from. A log shorter than the offset was rolled over
+// and is read from its start, a negative offset skips to the end of the log so traffic counted
+// before the panel restarted is not counted again.
+func ReadAccessLog(offset int64) (map[string]*Usage, int64, error) {
+	file, err := os.Open(GetAccessLogPath())
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, offset, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, offset, err
+	}
+	if offset < 0 {
+		return nil, info.Size(), nil
+	}
+	if info.Size() < offset {
+		offset = 0
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, offset, err
+	}
+
+	usage := map[string]*Usage{}
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			// A partly written last line is read again next time
+			break
+		}
+		offset += int64(len(line))
+		var entry accessLogEntry
+		if json.Unmarshal(line, &entry) != nil {
+			continue
+		}
+		user := proxyUser(entry.Request.Headers)
+		if user == "" {
+			continue
+		}
+		u, ok := usage[user]
+		if !ok {
+			u = &Usage{}
+			usage[user] = u
+		}
+		u.Up += entry.BytesRead
+		u.Down += entry.Size
+	}
+	return usage, offset, nil
+}
+
+// proxyUser returns the user name of the basic proxy credentials of a request.
+func proxyUser(headers map[string][]string) string {
+	values := headers["Proxy-Authorization"]
+	if len(values) == 0 {
+		return ""
+	}
+	encoded, ok := strings.CutPrefix(values[0], "Basic ")
+	if !ok {
+		return ""
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return ""
+	}
+	user, _, _ := strings.Cut(string(decoded), ":")
+	return user
+}
@@ -0,0 +1,83 @@
+// Package naive runs a Caddy forward proxy serving NaiveProxy clients next to the Xray core.
+package naive
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// Account is a user name and password NaiveProxy clients authenticate with.
+type Account struct {
+	User     string
+	Password string
+}
+
+// Options configures the Caddy forward proxy.
+type Options struct {
+	Port     int
+	Domain   string
+	CertFile string // Empty to let Caddy obtain a certificate for Domain
+	KeyFile  string
+	Accounts []Account
+}
+
+// accessLogger is the name of the logger Caddy writes the access log of the proxy with.
+const accessLogger = "naive"
+
+// BuildConfig returns the Caddy JSON configuration of a forward proxy with probe resistance,
+// answering with 404 to unauthenticated requests, and an access log that keeps the proxy
+// credentials so the traffic can be counted per account.
+func BuildConfig(opts *Options) ([]byte, error) {
+	credentials := make([][]byte, 0, len(opts.Accounts))
+	for _, account := range opts.Accounts {
+		credentials = append(credentials, []byte(base64.StdEncoding.EncodeToString([]byte(account.User+":"+account.Password))))
+	}
+	server := map[string]any{
+		"listen": []string{fmt.Sprintf(":%d", opts.Port)},
+		"routes": []any{
+			map[string]any{"handle": []any{map[string]any{
+				"handler":          "forward_proxy",
+				"auth_credentials": credentials,
+				"hide_ip":          true,
+				"hide_via":         true,
+				"probe_resistance": map[string]any{},
+			}}},
+			map[string]any{"handle": []any{map[string]any{"handler": "static_response", "status_code": 404}}},
+		},
+		"tls_connection_policies": []any{map[string]any{}},
+		"automatic_https":         map[string]any{"disable_redirects": true},
+		"logs": map[string]any{
+			"default_logger_name":    accessLogger,
+			"should_log_credentials": true,
+		},
+	}
+	tls := map[string]any{}
+	if opts.CertFile != "" {
+		tls["certificates"] = map[string]any{
+			"load_files": []any{map[string]any{"certificate": opts.CertFile, "key": opts.KeyFile}},
+		}
+	} else {
+		tls["automation"] = map[string]any{
+			"policies": []any{map[string]any{"subjects": []string{opts.Domain}}},
+		}
+	}
+	config := map[string]any{
+		"admin": map[string]any{"disabled": true},
+		"logging": map[string]any{
+			"logs": map[string]any{
+				"default": map[string]any{"exclude": []string{"http.log.access." + accessLogger}},
+				accessLogger: map[string]any{
+					"writer":  map[string]any{"output": "file", "filename": GetAccessLogPath(), "roll_size_mb": 10, "roll_keep": 1},
+					"encoder": map[string]any{"format": "json"},
+					"include": []string{"http.log.access." + accessLogger},
+				},
+			},
+		},
+		"apps": map[string]any{
+			"http": map[string]any{"servers": map[string]any{"naive": server}},
+			"tls":  tls,
+		},
+	}
+	return json.MarshalIndent(config, "", "  ")
+}
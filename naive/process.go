@@ -0,0 +1,113 @@
+package naive
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"github.com/mhsanaei/3x-ui/v2/config"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+)
+
+// GetBinaryName returns the filename of the Caddy binary with the forwardproxy plugin for the
+// current OS and architecture.
+func GetBinaryName() string {
+	return fmt.Sprintf("caddy-%s-%s", runtime.GOOS, runtime.GOARCH)
+}
+
+// GetBinaryPath returns the full path to the Caddy binary.
+func GetBinaryPath() string {
+	return config.GetBinFolderPath() + "/" + GetBinaryName()
+}
+
+// GetConfigPath returns the path to the Caddy configuration file in the binary folder.
+func GetConfigPath() string {
+	return config.GetBinFolderPath() + "/naive.json"
+}
+
+// GetAccessLogPath returns the path to the access log the traffic is counted from.
+func GetAccessLogPath() string {
+	return config.GetLogFolder() + "/naive-access.log"
+}
+
+// Process is a Caddy process serving the forward proxy.
+type Process struct {
+	cmd     *exec.Cmd
+	config  []byte
+	exitErr error
+}
+
+// NewProcess creates a new Caddy process for the given configuration.
+func NewProcess(caddyConfig []byte) *Process {
+	return &Process{config: caddyConfig}
+}
+
+// IsRunning returns true if the Caddy process is currently running.
+func (p *Process) IsRunning() bool {
+	return p.cmd != nil && p.cmd.Process != nil && p.cmd.ProcessState == nil
+}
+
+// GetErr returns the error the Caddy process exited with.
+func (p *Process) GetErr() error {
+	return p.exitErr
+}
+
+// GetConfig returns the configuration the process was started with.
+func (p *Process) GetConfig() []byte {
+	return p.config
+}
+
+// Start writes the configuration and launches Caddy.
+func (p *Process) Start() error {
+	if p.IsRunning() {
+		return errors.New("caddy is already running")
+	}
+	if err := os.MkdirAll(config.GetLogFolder(), 0o770); err != nil {
+		logger.Warningf("Failed to create log folder: %s", err)
+	}
+	configPath := GetConfigPath()
+	if err := os.WriteFile(configPath, p.config, 0o600); err != nil {
+		return common.NewErrorf("Failed to write configuration file: %v", err)
+	}
+	cmd := exec.Command(GetBinaryPath(), "run", "--config", configPath)
+	p.cmd = cmd
+	cmd.Stdout = logWriter{}
+	cmd.Stderr = logWriter{}
+	go func() {
+		if err := cmd.Run(); err != nil {
+			logger.Error("Failure in running caddy:", err)
+			p.exitErr = err
+		}
+	}()
+	return nil
+}
+
+// Stop terminates the running Caddy process.
+func (p *Process) Stop() error {
+	if !p.IsRunning() {
+		return errors.New("caddy is not running")
+	}
+	if runtime.GOOS == "windows" {
+		return p.cmd.Process.Kill()
+	}
+	return p.cmd.Process.Signal(syscall.SIGTERM)
+}
+
+// logWriter forwards the output of Caddy to the panel log.
+type logWriter struct{}
+
+func (logWriter) Write(m []byte) (int, error) {
+	for line := range strings.SplitSeq(strings.TrimSpace(string(m)), "\n") {
+		if strings.Contains(line, `"level":"error"`) || strings.Contains(line, `"level":"fatal"`) {
+			logger.Error("CADDY: " + line)
+		} else if line != "" {
+			logger.Debug("CADDY: " + line)
+		}
+	}
+	return len(m), nil
+}
@@ -0,0 +1,84 @@
+package singbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/xray"
+)
+
+var clashClient = &http.Client{Timeout: 10 * time.Second}
+
+// connectionTraffic is the traffic of a connection as reported by the Clash API.
+type connectionTraffic struct {
+	Upload   int64 `json:"upload"`
+	Download int64 `json:"download"`
+}
+
+// clashConnections is the response of the Clash API connections endpoint.
+type clashConnections struct {
+	Connections []struct {
+		connectionTraffic
+		Id       string `json:"id"`
+		Metadata struct {
+			Type string `json:"type"` // Inbound type and tag, like vless/inbound-443
+		} `json:"metadata"`
+	} `json:"connections"`
+}
+
+// GetTraffic returns the traffic of each inbound since the last call, summed from the open
+// connections the Clash API lists. Traffic a connection makes after the last read before it
+// closes is not counted, and sing-box reports no traffic per client.
+func (p *Process) GetTraffic() ([]*xray.Traffic, error) {
+	if !p.IsRunning() {
+		return nil, fmt.Errorf("sing-box is not running")
+	}
+	req, err := http.NewRequest(http.MethodGet, "http://"+p.clashAddr+"/connections", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.clashSecret)
+	resp, err := clashClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("clash api: unexpected status %s", resp.Status)
+	}
+	var connections clashConnections
+	if err := json.NewDecoder(resp.Body).Decode(&connections); err != nil {
+		return nil, err
+	}
+
+	p.trafficMu.Lock()
+	defer p.trafficMu.Unlock()
+	traffics := map[string]*xray.Traffic{}
+	open := make(map[string]connectionTraffic, len(connections.Connections))
+	for _, conn := range connections.Connections {
+		open[conn.Id] = conn.connectionTraffic
+		last := p.connections[conn.Id]
+		_, tag, ok := strings.Cut(conn.Metadata.Type, "/")
+		if !ok || tag == "" {
+			continue
+		}
+		tag = xray.BaseTag(tag)
+		traffic, ok := traffics[tag]
+		if !ok {
+			traffic = &xray.Traffic{IsInbound: true, Tag: tag}
+			traffics[tag] = traffic
+		}
+		traffic.Up += max(conn.Upload-last.Upload, 0)
+		traffic.Down += max(conn.Download-last.Download, 0)
+	}
+	p.connections = open
+
+	result := make([]*xray.Traffic, 0, len(traffics))
+	for _, traffic := range traffics {
+		result = append(result, traffic)
+	}
+	return result, nil
+}
@@ -0,0 +1,245 @@
+package singbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/xray"
+)
+
+// BuildConfig converts the inbounds of a generated Xray configuration into a sing-box
+// configuration with a direct outbound and the Clash API on the given address. Inbounds using
+// protocols or transports sing-box has no equivalent for are skipped with a warning. The
+// routing and outbounds of the Xray template are not converted. Since the panel only creates
+// Xray inbounds, protocols that exist in sing-box alone, like hysteria2 and tuic, are not offered.
+func BuildConfig(xrayConfig *xray.Config, clashAddr, clashSecret string) ([]byte, error) {
+	inbounds := []any{}
+	for _, inbound := range xrayConfig.InboundConfigs {
+		if inbound.Tag == "api" {
+			continue
+		}
+		converted, err := convertInbound(&inbound)
+		if err != nil {
+			logger.Warning("sing-box: skipping inbound", inbound.Tag, ":", err)
+			continue
+		}
+		inbounds = append(inbounds, converted)
+	}
+	config := map[string]any{
+		"log":       map[string]any{"level": "warn", "timestamp": true},
+		"inbounds":  inbounds,
+		"outbounds": []any{map[string]any{"type": "direct", "tag": "direct"}},
+		"route":     map[string]any{"final": "direct"},
+		"experimental": map[string]any{
+			"clash_api": map[string]any{
+				"external_controller": clashAddr,
+				"secret":              clashSecret,
+			},
+		},
+	}
+	return json.MarshalIndent(config, "", "  ")
+}
+
+// convertInbound converts one Xray inbound into a sing-box inbound.
+func convertInbound(inbound *xray.InboundConfig) (map[string]any, error) {
+	if inbound.Ports != "" {
+		logger.Warning("sing-box: inbound", inbound.Tag, "listens on its first port only")
+	}
+	listen := "::"
+	if len(inbound.Listen) > 0 {
+		var address string
+		if err := json.Unmarshal(inbound.Listen, &address); err == nil && address != "" {
+			listen = address
+		}
+	}
+	settings := map[string]any{}
+	if len(inbound.Settings) > 0 {
+		if err := json.Unmarshal(inbound.Settings, &settings); err != nil {
+			return nil, err
+		}
+	}
+	stream := map[string]any{}
+	if len(inbound.StreamSettings) > 0 {
+		if err := json.Unmarshal(inbound.StreamSettings, &stream); err != nil {
+			return nil, err
+		}
+	}
+	clients, _ := settings["clients"].([]any)
+
+	result := map[string]any{
+		"tag":         inbound.Tag,
+		"listen":      listen,
+		"listen_port": inbound.Port,
+	}
+	switch inbound.Protocol {
+	case "vless":
+		result["type"] = "vless"
+		result["users"] = convertUsers(clients, func(client map[string]any) map[string]any {
+			user := map[string]any{"uuid": client["id"]}
+			if flow, _ := client["flow"].(string); flow != "" {
+				user["flow"] = flow
+			}
+			return user
+		})
+	case "vmess":
+		result["type"] = "vmess"
+		result["users"] = convertUsers(clients, func(client map[string]any) map[string]any {
+			return map[string]any{"uuid": client["id"], "alterId": 0}
+		})
+	case "trojan":
+		result["type"] = "trojan"
+		result["users"] = convertUsers(clients, func(client map[string]any) map[string]any {
+			return map[string]any{"password": client["password"]}
+		})
+	case "shadowsocks":
+		result["type"] = "shadowsocks"
+		result["method"] = settings["method"]
+		result["password"] = settings["password"]
+		if len(clients) > 0 {
+			result["users"] = convertUsers(clients, func(client map[string]any) map[string]any {
+				return map[string]any{"password": client["password"]}
+			})
+		}
+	case "mixed", "http":
+		result["type"] = inbound.Protocol
+		if accounts, _ := settings["accounts"].([]any); len(accounts) > 0 {
+			var users []any
+			for _, a := range accounts {
+				if account, ok := a.(map[string]any); ok {
+					users = append(users, map[string]any{"username": account["user"], "password": account["pass"]})
+				}
+			}
+			result["users"] = users
+		}
+	case "tunnel":
+		result["type"] = "direct"
+		if address, _ := settings["address"].(string); address != "" {
+			result["override_address"] = address
+		}
+		if port, _ := settings["port"].(float64); port > 0 {
+			result["override_port"] = int(port)
+		}
+	default:
+		return nil, fmt.Errorf("protocol %s is not supported", inbound.Protocol)
+	}
+
+	if transport, err := convertTransport(stream); err != nil {
+		return nil, err
+	} else if transport != nil {
+		result["transport"] = transport
+	}
+	if tls, err := convertTLS(stream); err != nil {
+		return nil, err
+	} else if tls != nil {
+		result["tls"] = tls
+	}
+	return result, nil
+}
+
+// convertUsers converts the clients of an inbound into sing-box users named by their email.
+func convertUsers(clients []any, convert func(map[string]any) map[string]any) []any {
+	users := []any{}
+	for _, c := range clients {
+		client, ok := c.(map[string]any)
+		if !ok {
+			continue
+		}
+		user := convert(client)
+		user["name"] = client["email"]
+		users = append(users, user)
+	}
+	return users
+}
+
+// convertTransport converts the network of Xray stream settings into a sing-box transport, nil
+// for plain TCP.
+func convertTransport(stream map[string]any) (map[string]any, error) {
+	network, _ := stream["network"].(string)
+	switch network {
+	case "", "tcp", "raw":
+		tcp, _ := stream["tcpSettings"].(map[string]any)
+		if tcp == nil {
+			tcp, _ = stream["rawSettings"].(map[string]any)
+		}
+		header, _ := tcp["header"].(map[string]any)
+		if headerType, _ := header["type"].(string); headerType != "" && headerType != "none" {
+			return nil, fmt.Errorf("tcp header %s is not supported", headerType)
+		}
+		return nil, nil
+	case "ws":
+		ws, _ := stream["wsSettings"].(map[string]any)
+		transport := map[string]any{"type": "ws", "path": ws["path"]}
+		if host, _ := ws["host"].(string); host != "" {
+			transport["headers"] = map[string]any{"Host": host}
+		}
+		return transport, nil
+	case "httpupgrade":
+		httpupgrade, _ := stream["httpupgradeSettings"].(map[string]any)
+		return map[string]any{"type": "httpupgrade", "path": httpupgrade["path"], "host": httpupgrade["host"]}, nil
+	case "grpc":
+		grpc, _ := stream["grpcSettings"].(map[string]any)
+		return map[string]any{"type": "grpc", "service_name": grpc["serviceName"]}, nil
+	default:
+		return nil, fmt.Errorf("transport %s is not supported", network)
+	}
+}
+
+// convertTLS converts the TLS or REALITY security of Xray stream settings into sing-box TLS
+// options, nil without security.
+func convertTLS(stream map[string]any) (map[string]any, error) {
+	switch stream["security"] {
+	case "tls":
+		settings, _ := stream["tlsSettings"].(map[string]any)
+		tls := map[string]any{"enabled": true}
+		if serverName, _ := settings["serverName"].(string); serverName != "" {
+			tls["server_name"] = serverName
+		}
+		if alpn, _ := settings["alpn"].([]any); len(alpn) > 0 {
+			tls["alpn"] = alpn
+		}
+		certificates, _ := settings["certificates"].([]any)
+		if len(certificates) == 0 {
+			return nil, fmt.Errorf("tls without certificate")
+		}
+		certificate, _ := certificates[0].(map[string]any)
+		if file, _ := certificate["certificateFile"].(string); file != "" {
+			tls["certificate_path"] = file
+			tls["key_path"] = certificate["keyFile"]
+		} else {
+			tls["certificate"] = certificate["certificate"]
+			tls["key"] = certificate["key"]
+		}
+		return tls, nil
+	case "reality":
+		settings, _ := stream["realitySettings"].(map[string]any)
+		target, _ := settings["target"].(string)
+		if target == "" {
+			target, _ = settings["dest"].(string)
+		}
+		host, port, err := net.SplitHostPort(target)
+		if err != nil {
+			host, port = target, "443"
+		}
+		serverPort, _ := strconv.Atoi(port)
+		tls := map[string]any{
+			"enabled": true,
+			"reality": map[string]any{
+				"enabled":     true,
+				"handshake":   map[string]any{"server": host, "server_port": serverPort},
+				"private_key": settings["privateKey"],
+				"short_id":    settings["shortIds"],
+			},
+		}
+		if serverNames, _ := settings["serverNames"].([]any); len(serverNames) > 0 {
+			tls["server_name"] = serverNames[0]
+		}
+		return tls, nil
+	case nil, "", "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("security %v is not supported", stream["security"])
+	}
+}
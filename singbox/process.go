@@ -0,0 +1,204 @@
+// Package singbox runs the inbounds of the panel on sing-box instead of Xray.
+package singbox
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/config"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/util/random"
+	"github.com/mhsanaei/3x-ui/v2/xray"
+)
+
+// GetBinaryName returns the sing-box binary filename for the current OS and architecture.
+func GetBinaryName() string {
+	return fmt.Sprintf("sing-box-%s-%s", runtime.GOOS, runtime.GOARCH)
+}
+
+// GetBinaryPath returns the full path to the sing-box binary executable.
+func GetBinaryPath() string {
+	return config.GetBinFolderPath() + "/" + GetBinaryName()
+}
+
+// GetConfigPath returns the path to the sing-box configuration file in the binary folder.
+func GetConfigPath() string {
+	return config.GetBinFolderPath() + "/sing-box.json"
+}
+
+// Process is a sing-box process serving the inbounds of a generated Xray configuration.
+type Process struct {
+	cmd       *exec.Cmd
+	config    *xray.Config
+	version   string
+	logWriter *logWriter
+	exitErr   error
+	startTime time.Time
+
+	clashAddr   string
+	clashSecret string
+
+	trafficMu   sync.Mutex
+	connections map[string]connectionTraffic // Traffic of the open connections at the last read by ID
+
+	onlineClients []string
+}
+
+// NewProcess creates a new sing-box process for the inbounds of the Xray configuration.
+func NewProcess(xrayConfig *xray.Config) *Process {
+	return &Process{
+		config:      xrayConfig,
+		version:     "Unknown",
+		logWriter:   &logWriter{},
+		startTime:   time.Now(),
+		connections: map[string]connectionTraffic{},
+	}
+}
+
+// IsRunning returns true if the sing-box process is currently running.
+func (p *Process) IsRunning() bool {
+	return p.cmd != nil && p.cmd.Process != nil && p.cmd.ProcessState == nil
+}
+
+// GetErr returns the last error encountered by the sing-box process.
+func (p *Process) GetErr() error {
+	return p.exitErr
+}
+
+// GetResult returns the last log line or error from the sing-box process.
+func (p *Process) GetResult() string {
+	if p.logWriter.lastLine == "" && p.exitErr != nil {
+		return p.exitErr.Error()
+	}
+	return p.logWriter.lastLine
+}
+
+// GetVersion returns the version of the sing-box binary.
+func (p *Process) GetVersion() string {
+	return p.version
+}
+
+// GetAPIPort returns 0 as sing-box has no Xray API, so changes are applied by a restart.
+func (p *Process) GetAPIPort() int {
+	return 0
+}
+
+// GetConfig returns the Xray configuration the sing-box configuration was built from.
+func (p *Process) GetConfig() *xray.Config {
+	return p.config
+}
+
+// GetOnlineClients returns the online clients, which sing-box does not report.
+func (p *Process) GetOnlineClients() []string {
+	return p.onlineClients
+}
+
+// SetOnlineClients sets the list of online clients.
+func (p *Process) SetOnlineClients(users []string) {
+	p.onlineClients = users
+}
+
+// GetUptime returns the uptime of the sing-box process in seconds.
+func (p *Process) GetUptime() uint64 {
+	return uint64(time.Since(p.startTime).Seconds())
+}
+
+// refreshVersion reads the version from the output of sing-box version.
+func (p *Process) refreshVersion() {
+	output, err := exec.Command(GetBinaryPath(), "version").Output()
+	if err != nil {
+		return
+	}
+	firstLine, _, _ := strings.Cut(string(output), "\n")
+	if fields := strings.Fields(firstLine); len(fields) >= 3 {
+		p.version = fields[2]
+	}
+}
+
+// Start writes the sing-box configuration and launches sing-box with the Clash API on a free
+// local port.
+func (p *Process) Start() (err error) {
+	if p.IsRunning() {
+		return errors.New("sing-box is already running")
+	}
+	defer func() {
+		if err != nil {
+			logger.Error("Failure in running sing-box process: ", err)
+			p.exitErr = err
+		}
+	}()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	p.clashAddr = listener.Addr().String()
+	listener.Close()
+	p.clashSecret = random.Seq(32)
+
+	data, err := BuildConfig(p.config, p.clashAddr, p.clashSecret)
+	if err != nil {
+		return common.NewErrorf("Failed to generate sing-box configuration: %v", err)
+	}
+	configPath := GetConfigPath()
+	if err := os.WriteFile(configPath, data, 0o600); err != nil {
+		return common.NewErrorf("Failed to write configuration file: %v", err)
+	}
+
+	cmd := exec.Command(GetBinaryPath(), "run", "-c", configPath)
+	p.cmd = cmd
+	cmd.Stdout = p.logWriter
+	cmd.Stderr = p.logWriter
+
+	go func() {
+		if err := cmd.Run(); err != nil {
+			if runtime.GOOS != "windows" || !strings.Contains(err.Error(), "exit status 1") {
+				logger.Error("Failure in running sing-box:", err)
+			}
+			p.exitErr = err
+		}
+	}()
+
+	p.refreshVersion()
+	return nil
+}
+
+// Stop terminates the running sing-box process.
+func (p *Process) Stop() error {
+	if !p.IsRunning() {
+		return errors.New("sing-box is not running")
+	}
+	if runtime.GOOS == "windows" {
+		return p.cmd.Process.Kill()
+	}
+	return p.cmd.Process.Signal(syscall.SIGTERM)
+}
+
+// logWriter forwards the output of sing-box to the panel log and keeps its last line.
+type logWriter struct {
+	lastLine string
+}
+
+func (lw *logWriter) Write(m []byte) (int, error) {
+	for line := range strings.SplitSeq(strings.TrimSpace(string(m)), "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		if strings.Contains(line, "ERROR") || strings.Contains(line, "FATAL") {
+			logger.Error("SING-BOX: " + line)
+		} else {
+			logger.Debug("SING-BOX: " + line)
+		}
+		lw.lastLine = line
+	}
+	return len(m), nil
+}
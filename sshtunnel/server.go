@@ -0,0 +1,311 @@
+// Package sshtunnel runs an embedded SSH server that only forwards TCP connections, so clients
+// of the panel can use SSH tunnel apps without system accounts on the server.
+package sshtunnel
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/logger"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Account is a user name and password a tunnel client authenticates with.
+type Account struct {
+	User     string
+	Password string
+	MaxConns int // Concurrent SSH connections allowed, 0 for unlimited
+}
+
+// Usage is the traffic of an account.
+type Usage struct {
+	Up   int64
+	Down int64
+}
+
+// Session is an open SSH connection of an account.
+type Session struct {
+	User       string    `json:"user"`
+	RemoteAddr string    `json:"remoteAddr"`
+	StartedAt  time.Time `json:"startedAt"`
+	Channels   int64     `json:"channels"` // Forwarded connections open right now
+	Up         int64     `json:"up"`       // Bytes the client sent in this session
+	Down       int64     `json:"down"`     // Bytes sent to the client in this session
+}
+
+// session tracks an SSH connection and the traffic of its forwarded channels.
+type session struct {
+	conn      *ssh.ServerConn
+	startedAt time.Time
+	channels  atomic.Int64
+	up        atomic.Int64
+	down      atomic.Int64
+	takenUp   int64 // Traffic already taken, guarded by the server mutex
+	takenDown int64
+}
+
+// take adds the traffic of the session since the last take to the pending traffic of its user.
+// The server mutex has to be held.
+func (s *Server) take(sess *session, user string) {
+	up, down := sess.up.Load(), sess.down.Load()
+	s.addPending(user, up-sess.takenUp, down-sess.takenDown)
+	sess.takenUp, sess.takenDown = up, down
+}
+
+// GenerateHostKey returns a new ed25519 host key in OpenSSH PEM format.
+func GenerateHostKey() (string, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(block)), nil
+}
+
+// Server is an SSH server that allows nothing but direct-tcpip port forwarding.
+type Server struct {
+	listener net.Listener
+	config   *ssh.ServerConfig
+
+	mu       sync.Mutex
+	accounts map[string]Account
+	sessions map[*session]string // User of each open session
+	pending  map[string]*Usage   // Traffic of closed sessions not yet taken
+}
+
+// NewServer creates a server with the given PEM encoded host key.
+func NewServer(hostKey string) (*Server, error) {
+	signer, err := ssh.ParsePrivateKey([]byte(hostKey))
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		accounts: map[string]Account{},
+		sessions: map[*session]string{},
+		pending:  map[string]*Usage{},
+	}
+	s.config = &ssh.ServerConfig{
+		PasswordCallback: s.checkPassword,
+		ServerVersion:    "SSH-2.0-OpenSSH_9.6",
+	}
+	s.config.AddHostKey(signer)
+	return s, nil
+}
+
+// checkPassword authenticates a user against the accounts and the connection limit.
+func (s *Server) checkPassword(meta ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	account, ok := s.accounts[meta.User()]
+	if !ok || subtle.ConstantTimeCompare([]byte(account.Password), password) != 1 {
+		return nil, errors.New("invalid credentials")
+	}
+	if account.MaxConns > 0 && s.countSessions(meta.User()) >= account.MaxConns {
+		return nil, errors.New("too many connections")
+	}
+	return nil, nil
+}
+
+func (s *Server) countSessions(user string) int {
+	count := 0
+	for _, u := range s.sessions {
+		if u == user {
+			count++
+		}
+	}
+	return count
+}
+
+// SetAccounts replaces the accounts and closes the sessions of users that are gone or whose
+// password changed.
+func (s *Server) SetAccounts(accounts []Account) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.accounts
+	s.accounts = make(map[string]Account, len(accounts))
+	for _, account := range accounts {
+		s.accounts[account.User] = account
+	}
+	for sess, user := range s.sessions {
+		if account, ok := s.accounts[user]; !ok || account.Password != old[user].Password {
+			sess.conn.Close()
+		}
+	}
+}
+
+// Listen starts accepting connections on the given port.
+func (s *Server) Listen(port int) error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					logger.Warning("SSH tunnel accept failed:", err)
+				}
+				return
+			}
+			go s.handle(conn)
+		}
+	}()
+	return nil
+}
+
+// Close stops listening and closes all sessions.
+func (s *Server) Close() error {
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sess := range s.sessions {
+		sess.conn.Close()
+	}
+	return err
+}
+
+func (s *Server) handle(netConn net.Conn) {
+	netConn.SetDeadline(time.Now().Add(30 * time.Second))
+	conn, chans, reqs, err := ssh.NewServerConn(netConn, s.config)
+	if err != nil {
+		netConn.Close()
+		return
+	}
+	netConn.SetDeadline(time.Time{})
+	sess := &session{conn: conn, startedAt: time.Now()}
+	s.mu.Lock()
+	s.sessions[sess] = conn.User()
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.sessions, sess)
+		s.take(sess, conn.User())
+		s.mu.Unlock()
+	}()
+
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "direct-tcpip" {
+			newChannel.Reject(ssh.Prohibited, "only port forwarding is allowed")
+			continue
+		}
+		go s.forward(sess, newChannel)
+	}
+}
+
+// forward connects a direct-tcpip channel to the host it asks for.
+func (s *Server) forward(sess *session, newChannel ssh.NewChannel) {
+	var target struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, "invalid forward request")
+		return
+	}
+	addr := net.JoinHostPort(target.Host, fmt.Sprint(target.Port))
+	remote, err := net.DialTimeout("tcp", addr, 10*time.Second)
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		remote.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	sess.channels.Add(1)
+	defer sess.channels.Add(-1)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		io.Copy(&counter{w: remote, n: &sess.up}, channel)
+		remote.(*net.TCPConn).CloseWrite()
+	}()
+	go func() {
+		defer wg.Done()
+		io.Copy(&counter{w: channel, n: &sess.down}, remote)
+		channel.CloseWrite()
+	}()
+	wg.Wait()
+	channel.Close()
+	remote.Close()
+}
+
+func (s *Server) addPending(user string, up, down int64) {
+	if up == 0 && down == 0 {
+		return
+	}
+	usage, ok := s.pending[user]
+	if !ok {
+		usage = &Usage{}
+		s.pending[user] = usage
+	}
+	usage.Up += up
+	usage.Down += down
+}
+
+// TakeTraffic returns the traffic of each user since the last call.
+func (s *Server) TakeTraffic() map[string]*Usage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sess, user := range s.sessions {
+		s.take(sess, user)
+	}
+	usage := s.pending
+	s.pending = map[string]*Usage{}
+	return usage
+}
+
+// Sessions returns the open sessions.
+func (s *Server) Sessions() []Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sessions := make([]Session, 0, len(s.sessions))
+	for sess, user := range s.sessions {
+		sessions = append(sessions, Session{
+			User:       user,
+			RemoteAddr: sess.conn.RemoteAddr().String(),
+			StartedAt:  sess.startedAt,
+			Channels:   sess.channels.Load(),
+			Up:         sess.up.Load(),
+			Down:       sess.down.Load(),
+		})
+	}
+	return sessions
+}
+
+// counter counts the bytes written through it.
+type counter struct {
+	w io.Writer
+	n *atomic.Int64
+}
+
+func (c *counter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n.Add(int64(n))
+	return n, err
+}
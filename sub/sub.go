@@ -43,8 +43,10 @@ func setEmbeddedTemplates(engine *gin.Engine) error {
 
 // Server represents the subscription server that serves subscription links and JSON configurations.
 type Server struct {
-	httpServer *http.Server
-	listener   net.Listener
+	httpServer   *http.Server
+	listener     net.Listener
+	certReloader *network.CertReloader
+	http3Server  *network.Http3Server
 
 	sub            *SUBController
 	settingService service.SettingService
@@ -71,12 +73,30 @@ func (s *Server) initRouter() (*gin.Engine, error) {
 	gin.SetMode(gin.ReleaseMode)
 
 	engine := gin.Default()
+	engine.Use(middleware.EndpointStatsMiddleware(service.EndpointRecorder("sub")))
+	engine.Use(middleware.CompressMiddleware())
 
 	subDomain, err := s.settingService.GetSubDomain()
 	if err != nil {
 		return nil, err
 	}
 
+	subCloudflareOnly, err := s.settingService.GetSubCloudflareOnly()
+	if err != nil {
+		return nil, err
+	}
+	if subCloudflareOnly {
+		engine.Use(middleware.CloudflareOnlyMiddleware())
+	}
+
+	subRateLimit, err := s.settingService.GetSubRateLimit()
+	if err != nil {
+		return nil, err
+	}
+	if subRateLimit > 0 {
+		engine.Use(middleware.RateLimitMiddleware("sub", subRateLimit))
+	}
+
 	if subDomain != "" {
 		engine.Use(middleware.DomainValidatorMiddleware(subDomain))
 	}
@@ -113,16 +133,11 @@ func (s *Server) initRouter() (*gin.Engine, error) {
 		return nil, err
 	}
 
-	ShowInfo, err := s.settingService.GetSubShowInfo()
+	RemarkOptions, err := s.settingService.GetRemarkOptions()
 	if err != nil {
 		return nil, err
 	}
 
-	RemarkModel, err := s.settingService.GetRemarkModel()
-	if err != nil {
-		RemarkModel = "-ieo"
-	}
-
 	SubUpdates, err := s.settingService.GetSubUpdates()
 	if err != nil {
 		SubUpdates = "10"
@@ -198,9 +213,9 @@ func (s *Server) initRouter() (*gin.Engine, error) {
 	}
 
 	if assetsFS != nil {
-		engine.StaticFS("/assets", assetsFS)
+		engine.Group("/assets", middleware.ETagMiddleware()).StaticFS("", assetsFS)
 		if linksPathForAssets != "/assets" {
-			engine.StaticFS(linksPathForAssets, assetsFS)
+			engine.Group(linksPathForAssets, middleware.ETagMiddleware()).StaticFS("", assetsFS)
 		}
 
 		// Add middleware to handle dynamic asset paths with subid
@@ -230,7 +245,7 @@ func (s *Server) initRouter() (*gin.Engine, error) {
 	g := engine.Group("/")
 
 	s.sub = NewSUBController(
-		g, LinksPath, JsonPath, subJsonEnable, Encrypt, ShowInfo, RemarkModel, SubUpdates,
+		g, LinksPath, JsonPath, subJsonEnable, Encrypt, RemarkOptions, SubUpdates,
 		SubJsonFragment, SubJsonNoises, SubJsonMux, SubJsonRules, SubTitle)
 
 	return engine, nil
@@ -299,20 +314,23 @@ func (s *Server) Start() (err error) {
 		return err
 	}
 
+	socket, err := s.settingService.GetSubSocket()
+	if err != nil {
+		return err
+	}
 	listenAddr := net.JoinHostPort(listen, strconv.Itoa(port))
-	listener, err := net.Listen("tcp", listenAddr)
+	listener, err := network.Listen(listenAddr, socket, "sub", 1)
 	if err != nil {
 		return err
 	}
 
 	if certFile != "" || keyFile != "" {
-		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		certReloader, err := network.NewCertReloader(certFile, keyFile)
 		if err == nil {
-			c := &tls.Config{
-				Certificates: []tls.Certificate{cert},
-			}
+			s.certReloader = certReloader
+			go certReloader.Watch(s.ctx, network.CertWatchInterval)
 			listener = network.NewAutoHttpsListener(listener)
-			listener = tls.NewListener(listener, c)
+			listener = tls.NewListener(listener, certReloader.TLSConfig())
 			logger.Info("Sub server running HTTPS on", listener.Addr())
 		} else {
 			logger.Error("Error loading certificates:", err)
@@ -323,8 +341,22 @@ func (s *Server) Start() (err error) {
 	}
 	s.listener = listener
 
+	var handler http.Handler = engine
+	if s.certReloader != nil && socket == "" {
+		if http3Enable, err := s.settingService.GetSubHttp3(); err == nil && http3Enable {
+			http3Server, err := network.NewHttp3Server(listenAddr, engine, s.certReloader.TLSConfig())
+			if err == nil {
+				s.http3Server = http3Server
+				handler = http3Server.AltSvc(engine)
+				logger.Info("Sub server running HTTP/3 on", listenAddr)
+			} else {
+				logger.Warning("Error starting HTTP/3 server:", err)
+			}
+		}
+	}
+
 	s.httpServer = &http.Server{
-		Handler: engine,
+		Handler: handler,
 	}
 
 	go func() {
@@ -346,9 +378,20 @@ func (s *Server) Stop() error {
 	if s.listener != nil {
 		err2 = s.listener.Close()
 	}
+	if s.http3Server != nil {
+		s.http3Server.Close()
+	}
 	return common.Combine(err1, err2)
 }
 
+// ReloadCert reloads the TLS certificate from disk. It fails when the server is not serving HTTPS.
+func (s *Server) ReloadCert() error {
+	if s.certReloader == nil {
+		return common.NewError("server is not running HTTPS")
+	}
+	return s.certReloader.Reload()
+}
+
 // GetCtx returns the server's context for cancellation and deadline management.
 func (s *Server) GetCtx() context.Context {
 	return s.ctx
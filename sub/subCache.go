@@ -0,0 +1,179 @@
+package sub
+
+import (
+	"container/list"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/xray"
+)
+
+// subCacheSize bounds the number of outputs and response versions kept. The least recently used
+// ones are dropped first.
+const subCacheSize = 10000
+
+// subDataVersion identifies the data the output of a subscription was generated from: the writes
+// to the database, the health of the inbounds and, for remarks counting the remaining time, the
+// minute. The output only has to be generated again when it changes.
+type subDataVersion struct {
+	database uint64
+	health   uint64
+	minute   int64
+}
+
+// subCacheEntry is the output generated for a subscription request with the version of the data
+// it was generated from.
+type subCacheEntry struct {
+	version       subDataVersion
+	timeDependent bool
+	value         any
+}
+
+// subResult is the output of GetSubs kept in the cache.
+type subResult struct {
+	links      []string
+	lastOnline int64
+	traffic    xray.ClientTraffic
+}
+
+// jsonResult is the output of GetJson kept in the cache.
+type jsonResult struct {
+	body   string
+	header string
+}
+
+// subVersion is the ETag of the last response to a subscription request and when it changed.
+type subVersion struct {
+	etag     string
+	modified time.Time
+}
+
+var (
+	subCache    = newLRUCache[*subCacheEntry](subCacheSize)
+	subVersions = newLRUCache[*subVersion](subCacheSize)
+)
+
+// lruCache is a map bounded in size, dropping its least recently used entry when full.
+type lruCache[V any] struct {
+	lock  sync.Mutex
+	size  int
+	order *list.List // Elements holding lruItem values, most recently used first
+	items map[string]*list.Element
+}
+
+// lruItem is an entry of an lruCache.
+type lruItem[V any] struct {
+	key   string
+	value V
+}
+
+func newLRUCache[V any](size int) *lruCache[V] {
+	return &lruCache[V]{size: size, order: list.New(), items: map[string]*list.Element{}}
+}
+
+// get returns the value of key and marks it as recently used.
+func (c *lruCache[V]) get(key string) (V, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	element, ok := c.items[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*lruItem[V]).value, true
+}
+
+// put sets the value of key, dropping the least recently used entry when the cache is full.
+func (c *lruCache[V]) put(key string, value V) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if element, ok := c.items[key]; ok {
+		element.Value.(*lruItem[V]).value = value
+		c.order.MoveToFront(element)
+		return
+	}
+	c.items[key] = c.order.PushFront(&lruItem[V]{key: key, value: value})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruItem[V]).key)
+	}
+}
+
+// dataVersion returns the current version of the data subscriptions are generated from. It is
+// read before the data, so a write in between makes the output stale right away.
+func (s *SubService) dataVersion() subDataVersion {
+	return subDataVersion{
+		database: database.WriteVersion(),
+		health:   s.inboundHealthService.HealthVersion(),
+		minute:   time.Now().Unix() / 60,
+	}
+}
+
+// cacheKey returns the key the output of a subscription kind is cached under for the request,
+// empty when the output must not be cached because its links are randomized on every request.
+func (req *subRequest) cacheKey(kind string, subId string) string {
+	if req.seed == "" {
+		return ""
+	}
+	stats := ""
+	if req.query.Stats != nil {
+		stats = strconv.FormatBool(*req.query.Stats)
+	}
+	profile := ""
+	if req.profile != nil {
+		profile = req.profile.Name
+	}
+	return fmt.Sprintf("%s:%q:%q:%q:%s:%t:%d:%q", kind, subId, profile, req.address, stats, req.query.Deterministic, req.query.Port, req.query.Label)
+}
+
+// timeDependent reports whether the remarks of a subscription count the remaining time, so its
+// output changes every minute.
+func (s *SubService) timeDependent(req *subRequest, inbounds []*model.Inbound) bool {
+	if s.remarkOptions.ShowInfo || s.remarkOptions.Template != "" || req.query.Label != "" || (req.query.Stats != nil && *req.query.Stats) {
+		return true
+	}
+	for _, inbound := range inbounds {
+		if inbound.RemarkTemplate != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// cached returns the output cached under key when it was generated from the current version of
+// the data.
+func cached(key string, version subDataVersion) (any, bool) {
+	if key == "" {
+		return nil, false
+	}
+	entry, ok := subCache.get(key)
+	if !ok || entry.version.database != version.database || entry.version.health != version.health ||
+		(entry.timeDependent && entry.version.minute != version.minute) {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+// storeCached keeps the output generated for key from the version of the data.
+func storeCached(key string, version subDataVersion, timeDependent bool, value any) {
+	if key == "" {
+		return
+	}
+	subCache.put(key, &subCacheEntry{version: version, timeDependent: timeDependent, value: value})
+}
+
+// lastModified returns when the response with the ETag first became the response to the request.
+func lastModified(request string, etag string) time.Time {
+	if version, ok := subVersions.get(request); ok && version.etag == etag {
+		return version.modified
+	}
+	version := &subVersion{etag: etag, modified: time.Now()}
+	subVersions.put(request, version)
+	return version.modified
+}
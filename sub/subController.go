@@ -3,9 +3,16 @@ package sub
 import (
 	"encoding/base64"
 	"fmt"
+	"net/url"
 	"strings"
 
 	"github.com/mhsanaei/3x-ui/v2/config"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/link"
+	"github.com/mhsanaei/3x-ui/v2/web/locale"
+	"github.com/mhsanaei/3x-ui/v2/web/middleware"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
 
 	"github.com/gin-gonic/gin"
 )
@@ -19,8 +26,10 @@ type SUBController struct {
 	subEncrypt     bool
 	updateInterval string
 
-	subService     *SubService
-	subJsonService *SubJsonService
+	subService        *SubService
+	subJsonService    *SubJsonService
+	subProfileService service.SubProfileService
+	subSignService    service.SubSignService
 }
 
 // NewSUBController creates a new subscription controller with the given configuration.
@@ -30,8 +39,7 @@ func NewSUBController(
 	jsonPath string,
 	jsonEnabled bool,
 	encrypt bool,
-	showInfo bool,
-	rModel string,
+	remarkOptions link.RemarkOptions,
 	update string,
 	jsonFragment string,
 	jsonNoise string,
@@ -39,7 +47,7 @@ func NewSUBController(
 	jsonRules string,
 	subTitle string,
 ) *SUBController {
-	sub := NewSubService(showInfo, rModel)
+	sub := NewSubService(remarkOptions)
 	a := &SUBController{
 		subTitle:       subTitle,
 		subPath:        subPath,
@@ -58,8 +66,10 @@ func NewSUBController(
 // initRouter registers HTTP routes for subscription links and JSON endpoints
 // on the provided router group.
 func (a *SUBController) initRouter(g *gin.RouterGroup) {
+	g.GET("/.well-known/sub-signing-key", a.signingKey)
 	gLink := g.Group(a.subPath)
 	gLink.GET(":subid", a.subs)
+	gLink.GET(":subid/:profile", a.profileSubs)
 	if a.jsonEnabled {
 		gJson := g.Group(a.subJsonPath)
 		gJson.GET(":subid", a.subJsons)
@@ -68,9 +78,60 @@ func (a *SUBController) initRouter(g *gin.RouterGroup) {
 
 // subs handles HTTP requests for subscription links, returning either HTML page or base64-encoded subscription data.
 func (a *SUBController) subs(c *gin.Context) {
+	query, err := link.ParseQuery(c.Request.URL.Query())
+	if err != nil {
+		c.String(400, err.Error())
+		return
+	}
+	a.serveSubs(c, c.Param("subid"), query, nil, a.subEncrypt)
+}
+
+// profileSubs handles HTTP requests for a subscription profile, serving the inbounds and format
+// it selects with its link options, which the query of the request can override.
+func (a *SUBController) profileSubs(c *gin.Context) {
 	subId := c.Param("subid")
+	profile, err := a.subProfileService.GetProfile(subId, c.Param("profile"))
+	if err != nil {
+		c.String(500, "Error!")
+		return
+	}
+	if profile == nil {
+		c.String(404, "Not Found")
+		return
+	}
+	values, err := url.ParseQuery(profile.Options)
+	if err != nil {
+		values = url.Values{}
+	}
+	for key, value := range c.Request.URL.Query() {
+		values[key] = value
+	}
+	query, err := link.ParseQuery(values)
+	if err != nil {
+		c.String(400, err.Error())
+		return
+	}
+	switch profile.Format {
+	case "json":
+		if !a.jsonEnabled {
+			c.String(404, "Not Found")
+			return
+		}
+		a.serveJson(c, subId, query, profile)
+	case "base64":
+		a.serveSubs(c, subId, query, profile, true)
+	case "plain":
+		a.serveSubs(c, subId, query, profile, false)
+	default:
+		a.serveSubs(c, subId, query, profile, a.subEncrypt)
+	}
+}
+
+// serveSubs answers with the subscription links of a subscription, encoded in base64 when
+// encrypt is set, or with its info page when the request asks for HTML.
+func (a *SUBController) serveSubs(c *gin.Context, subId string, query link.QueryOptions, profile *model.SubProfile, encrypt bool) {
 	scheme, host, hostWithPort, hostHeader := a.subService.ResolveRequest(c)
-	subs, lastOnline, traffic, err := a.subService.GetSubs(subId, host)
+	subs, lastOnline, traffic, err := a.subService.GetSubs(subId, host, query, profile)
 	if err != nil || len(subs) == 0 {
 		c.String(400, "Error!")
 	} else {
@@ -102,46 +163,63 @@ func (a *SUBController) subs(c *gin.Context) {
 			}
 			page := a.subService.BuildPageData(subId, hostHeader, traffic, lastOnline, subs, subURL, subJsonURL, basePathStr)
 			c.HTML(200, "subpage.html", gin.H{
-				"title":        "subscription.title",
-				"cur_ver":      config.GetVersion(),
-				"host":         page.Host,
-				"base_path":    page.BasePath,
-				"sId":          page.SId,
-				"download":     page.Download,
-				"upload":       page.Upload,
-				"total":        page.Total,
-				"used":         page.Used,
-				"remained":     page.Remained,
-				"expire":       page.Expire,
-				"lastOnline":   page.LastOnline,
-				"datepicker":   page.Datepicker,
-				"downloadByte": page.DownloadByte,
-				"uploadByte":   page.UploadByte,
-				"totalByte":    page.TotalByte,
-				"subUrl":       page.SubUrl,
-				"subJsonUrl":   page.SubJsonUrl,
-				"result":       page.Result,
+				"title":         "subscription.title",
+				"cur_ver":       config.GetVersion(),
+				"host":          page.Host,
+				"base_path":     page.BasePath,
+				"sId":           page.SId,
+				"download":      page.Download,
+				"upload":        page.Upload,
+				"total":         page.Total,
+				"used":          page.Used,
+				"remained":      page.Remained,
+				"expire":        page.Expire,
+				"lastOnline":    page.LastOnline,
+				"datepicker":    page.Datepicker,
+				"downloadByte":  page.DownloadByte,
+				"uploadByte":    page.UploadByte,
+				"totalByte":     page.TotalByte,
+				"subUrl":        page.SubUrl,
+				"subJsonUrl":    page.SubJsonUrl,
+				"result":        page.Result,
+				"announcements": page.Announcements,
+				"brand":         page.Brand,
+				"languages":     locale.GetCustomLanguages(),
 			})
 			return
 		}
 
+		// Announcements only go into subscriptions fetched by clients, the page shows them on its own
+		if infoLinks := a.subService.GetAnnouncementLinks(); len(infoLinks) > 0 {
+			result = strings.Join(infoLinks, "\n") + "\n" + result
+		}
+
 		// Add headers
 		header := fmt.Sprintf("upload=%d; download=%d; total=%d; expire=%d", traffic.Up, traffic.Down, traffic.Total, traffic.ExpiryTime/1000)
 		a.ApplyCommonHeaders(c, header, a.updateInterval, a.subTitle)
 
-		if a.subEncrypt {
-			c.String(200, base64.StdEncoding.EncodeToString([]byte(result)))
+		if encrypt {
+			a.writeSub(c, base64.StdEncoding.EncodeToString([]byte(result)))
 		} else {
-			c.String(200, result)
+			a.writeSub(c, result)
 		}
 	}
 }
 
 // subJsons handles HTTP requests for JSON subscription configurations.
 func (a *SUBController) subJsons(c *gin.Context) {
-	subId := c.Param("subid")
+	query, err := link.ParseQuery(c.Request.URL.Query())
+	if err != nil {
+		c.String(400, err.Error())
+		return
+	}
+	a.serveJson(c, c.Param("subid"), query, nil)
+}
+
+// serveJson answers with the JSON configuration of a subscription.
+func (a *SUBController) serveJson(c *gin.Context, subId string, query link.QueryOptions, profile *model.SubProfile) {
 	_, host, _, _ := a.subService.ResolveRequest(c)
-	jsonSub, header, err := a.subJsonService.GetJson(subId, host)
+	jsonSub, header, err := a.subJsonService.GetJson(subId, host, query, profile)
 	if err != nil || len(jsonSub) == 0 {
 		c.String(400, "Error!")
 	} else {
@@ -149,8 +227,42 @@ func (a *SUBController) subJsons(c *gin.Context) {
 		// Add headers
 		a.ApplyCommonHeaders(c, header, a.updateInterval, a.subTitle)
 
-		c.String(200, jsonSub)
+		a.writeSub(c, jsonSub)
+	}
+}
+
+// writeSub sends a subscription body with its ETag and the time it last changed, or 304 Not
+// Modified when the client already has it. When signing is enabled the body goes with its digest
+// and detached Ed25519 signature.
+func (a *SUBController) writeSub(c *gin.Context, body string) {
+	etag := middleware.BodyETag([]byte(body))
+	if middleware.NotModified(c, etag, lastModified(c.Request.Host+c.Request.URL.RequestURI(), etag)) {
+		return
+	}
+	signature, err := a.subSignService.Sign([]byte(body))
+	if err != nil {
+		logger.Warning("Unable to sign subscription:", err)
+	} else if signature != nil {
+		c.Writer.Header().Set("Content-Digest", "sha-256=:"+signature.Digest+":")
+		c.Writer.Header().Set("Subscription-Signature", fmt.Sprintf("keyid=%s; alg=ed25519; sig=%s", signature.KeyId, signature.Signature))
+		// Keep CDNs and the compress middleware from rewriting the body the digest and signature are over
+		c.Writer.Header().Add("Cache-Control", "no-transform")
+	}
+	c.String(200, body)
+}
+
+// signingKey publishes the public key subscriptions are signed with while signing is enabled.
+func (a *SUBController) signingKey(c *gin.Context) {
+	key, err := a.subSignService.GetPublicKey()
+	if err != nil {
+		c.String(500, "Error!")
+		return
+	}
+	if !key.Enabled {
+		c.String(404, "Not Found")
+		return
 	}
+	c.JSON(200, key)
 }
 
 // ApplyCommonHeaders sets common HTTP headers for subscription responses including user info, update interval, and profile title.
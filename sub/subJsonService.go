@@ -4,12 +4,11 @@ import (
 	_ "embed"
 	"encoding/json"
 	"fmt"
-	"strings"
 
 	"github.com/mhsanaei/3x-ui/v2/database/model"
 	"github.com/mhsanaei/3x-ui/v2/logger"
 	"github.com/mhsanaei/3x-ui/v2/util/json_util"
-	"github.com/mhsanaei/3x-ui/v2/util/random"
+	"github.com/mhsanaei/3x-ui/v2/util/link"
 	"github.com/mhsanaei/3x-ui/v2/web/service"
 	"github.com/mhsanaei/3x-ui/v2/xray"
 )
@@ -69,17 +68,31 @@ func NewSubJsonService(fragment string, noises string, mux string, rules string,
 	}
 }
 
-// GetJson generates a JSON subscription configuration for the given subscription ID and host.
-func (s *SubJsonService) GetJson(subId string, host string) (string, string, error) {
+// GetJson generates a JSON subscription configuration for the given subscription ID and host
+// with the link options of the request. A profile, when given, limits the inbounds of the config.
+func (s *SubJsonService) GetJson(subId string, host string, query link.QueryOptions, profile *model.SubProfile) (string, string, error) {
+	req := &subRequest{address: host, query: query, seed: s.SubService.linkSeed(subId), profile: profile}
+	cacheKey := req.cacheKey("json", subId)
+	version := s.SubService.dataVersion()
+	if value, ok := cached(cacheKey, version); ok {
+		cachedResult := value.(*jsonResult)
+		return cachedResult.body, cachedResult.header, nil
+	}
 	inbounds, err := s.SubService.getInboundsBySubId(subId)
-	if err != nil || len(inbounds) == 0 {
+	if err != nil {
 		return "", "", err
 	}
+	inbounds = req.profileInbounds(inbounds)
+	if len(inbounds) == 0 {
+		return "", "", nil
+	}
 
 	var header string
 	var traffic xray.ClientTraffic
 	var clientTraffics []xray.ClientTraffic
 	var configArray []json_util.RawMessage
+	var failingConfigs []json_util.RawMessage
+	healthMode, _ := s.SubService.settingService.GetHealthCheckMode()
 
 	// Prepare Inbounds
 	for _, inbound := range inbounds {
@@ -90,6 +103,7 @@ func (s *SubJsonService) GetJson(subId string, host string) (string, string, err
 		if clients == nil {
 			continue
 		}
+		inbound.Port = inbound.SubPort()
 		if len(inbound.Listen) > 0 && inbound.Listen[0] == '@' {
 			listen, port, streamSettings, err := s.SubService.getFallbackMaster(inbound.Listen, inbound.StreamSettings)
 			if err == nil {
@@ -100,14 +114,20 @@ func (s *SubJsonService) GetJson(subId string, host string) (string, string, err
 		}
 
 		for _, client := range clients {
-			if client.Enable && client.SubID == subId {
+			if client.Enable && client.SubID == subId && inbound.InSubscription(client) {
 				clientTraffics = append(clientTraffics, s.SubService.getClientTraffics(inbound.ClientStats, client.Email))
-				newConfigs := s.getConfig(inbound, client, host)
-				configArray = append(configArray, newConfigs...)
+				newConfigs := s.getConfig(req, inbound, client)
+				if s.SubService.inboundHealthService.IsInboundDown(inbound.Id) {
+					failingConfigs = append(failingConfigs, newConfigs...)
+				} else {
+					configArray = append(configArray, newConfigs...)
+				}
 			}
 		}
 	}
 
+	configArray = service.ArrangeByHealth(healthMode, configArray, failingConfigs)
+
 	if len(configArray) == 0 {
 		return "", "", nil
 	}
@@ -144,20 +164,33 @@ func (s *SubJsonService) GetJson(subId string, host string) (string, string, err
 	}
 
 	header = fmt.Sprintf("upload=%d; download=%d; total=%d; expire=%d", traffic.Up, traffic.Down, traffic.Total, traffic.ExpiryTime/1000)
+	storeCached(cacheKey, version, s.SubService.timeDependent(req, inbounds), &jsonResult{body: string(finalJson), header: header})
 	return string(finalJson), header, nil
 }
 
-func (s *SubJsonService) getConfig(inbound *model.Inbound, client model.Client, host string) []json_util.RawMessage {
+func (s *SubJsonService) getConfig(req *subRequest, inbound *model.Inbound, client model.Client) []json_util.RawMessage {
 	var newJsonArray []json_util.RawMessage
-	stream := s.streamData(inbound.StreamSettings)
+	stream := s.streamData(req, inbound.StreamSettings)
 
 	externalProxies, ok := stream["externalProxy"].([]any)
-	if !ok || len(externalProxies) == 0 {
+	if (!ok || len(externalProxies) == 0) && inbound.ExtraListens != "" {
+		// Multi-homed inbounds get a config for each address they listen on
+		externalProxies = nil
+		for _, listen := range inbound.ListenAddresses() {
+			externalProxies = append(externalProxies, map[string]any{
+				"forceTls": "same",
+				"dest":     listen,
+				"port":     float64(s.subPort(req, inbound)),
+				"remark":   listen,
+			})
+		}
+		defer func(listen string) { inbound.Listen = listen }(inbound.Listen)
+	} else if !ok || len(externalProxies) == 0 {
 		externalProxies = []any{
 			map[string]any{
 				"forceTls": "same",
-				"dest":     host,
-				"port":     float64(inbound.Port),
+				"dest":     req.address,
+				"port":     float64(s.subPort(req, inbound)),
 				"remark":   "",
 			},
 		}
@@ -182,17 +215,19 @@ func (s *SubJsonService) getConfig(inbound *model.Inbound, client model.Client,
 				delete(newStream, "tlsSettings")
 			}
 		}
+		if client.Fingerprint != "" {
+			for _, key := range []string{"tlsSettings", "realitySettings"} {
+				if settings, ok := newStream[key].(map[string]any); ok {
+					settings["fingerprint"] = client.Fingerprint
+				}
+			}
+		}
 		streamSettings, _ := json.MarshalIndent(newStream, "", "  ")
 
 		var newOutbounds []json_util.RawMessage
 
-		switch inbound.Protocol {
-		case "vmess":
-			newOutbounds = append(newOutbounds, s.genVnext(inbound, streamSettings, client))
-		case "vless":
-			newOutbounds = append(newOutbounds, s.genVless(inbound, streamSettings, client))
-		case "trojan", "shadowsocks":
-			newOutbounds = append(newOutbounds, s.genServer(inbound, streamSettings, client))
+		if outbound := s.genOutbound(inbound, streamSettings, client); outbound != nil {
+			newOutbounds = append(newOutbounds, outbound)
 		}
 
 		newOutbounds = append(newOutbounds, s.defaultOutbounds...)
@@ -201,7 +236,7 @@ func (s *SubJsonService) getConfig(inbound *model.Inbound, client model.Client,
 			newConfigJson[key] = value
 		}
 		newConfigJson["outbounds"] = newOutbounds
-		newConfigJson["remarks"] = s.SubService.genRemark(inbound, client.Email, extPrxy["remark"].(string))
+		newConfigJson["remarks"] = s.SubService.genRemark(req, inbound, client.Email, extPrxy["remark"].(string))
 
 		newConfig, _ := json.MarshalIndent(newConfigJson, "", "  ")
 		newJsonArray = append(newJsonArray, newConfig)
@@ -210,176 +245,42 @@ func (s *SubJsonService) getConfig(inbound *model.Inbound, client model.Client,
 	return newJsonArray
 }
 
-func (s *SubJsonService) streamData(stream string) map[string]any {
+// streamData returns the stream settings of the configs of an inbound with the stream settings,
+// going through the fragment outbound when one is configured.
+func (s *SubJsonService) streamData(req *subRequest, stream string) map[string]any {
 	var streamSettings map[string]any
 	json.Unmarshal([]byte(stream), &streamSettings)
-	security, _ := streamSettings["security"].(string)
-	switch security {
-	case "tls":
-		streamSettings["tlsSettings"] = s.tlsData(streamSettings["tlsSettings"].(map[string]any))
-	case "reality":
-		streamSettings["realitySettings"] = s.realityData(streamSettings["realitySettings"].(map[string]any))
-	}
-	delete(streamSettings, "sockopt")
-
+	streamSettings = link.ClientStream(streamSettings, s.SubService.linkOptions(req))
 	if s.fragment != "" {
 		streamSettings["sockopt"] = json_util.RawMessage(`{"dialerProxy": "fragment", "tcpKeepAliveIdle": 100, "tcpMptcp": true, "penetrate": true}`)
 	}
-
-	// remove proxy protocol
-	network, _ := streamSettings["network"].(string)
-	switch network {
-	case "tcp":
-		streamSettings["tcpSettings"] = s.removeAcceptProxy(streamSettings["tcpSettings"])
-	case "ws":
-		streamSettings["wsSettings"] = s.removeAcceptProxy(streamSettings["wsSettings"])
-	case "httpupgrade":
-		streamSettings["httpupgradeSettings"] = s.removeAcceptProxy(streamSettings["httpupgradeSettings"])
-	}
 	return streamSettings
 }
 
-func (s *SubJsonService) removeAcceptProxy(setting any) map[string]any {
-	netSettings, ok := setting.(map[string]any)
-	if ok {
-		delete(netSettings, "acceptProxyProtocol")
-	}
-	return netSettings
-}
-
-func (s *SubJsonService) tlsData(tData map[string]any) map[string]any {
-	tlsData := make(map[string]any, 1)
-	tlsClientSettings, _ := tData["settings"].(map[string]any)
-
-	tlsData["serverName"] = tData["serverName"]
-	tlsData["alpn"] = tData["alpn"]
-	if allowInsecure, ok := tlsClientSettings["allowInsecure"].(bool); ok {
-		tlsData["allowInsecure"] = allowInsecure
-	}
-	if fingerprint, ok := tlsClientSettings["fingerprint"].(string); ok {
-		tlsData["fingerprint"] = fingerprint
-	}
-	return tlsData
-}
-
-func (s *SubJsonService) realityData(rData map[string]any) map[string]any {
-	rltyData := make(map[string]any, 1)
-	rltyClientSettings, _ := rData["settings"].(map[string]any)
-
-	rltyData["show"] = false
-	rltyData["publicKey"] = rltyClientSettings["publicKey"]
-	rltyData["fingerprint"] = rltyClientSettings["fingerprint"]
-	rltyData["mldsa65Verify"] = rltyClientSettings["mldsa65Verify"]
-
-	// Set random data
-	rltyData["spiderX"] = "/" + random.Seq(15)
-	shortIds, ok := rData["shortIds"].([]any)
-	if ok && len(shortIds) > 0 {
-		rltyData["shortId"] = shortIds[random.Num(len(shortIds))].(string)
-	} else {
-		rltyData["shortId"] = ""
-	}
-	serverNames, ok := rData["serverNames"].([]any)
-	if ok && len(serverNames) > 0 {
-		rltyData["serverName"] = serverNames[random.Num(len(serverNames))].(string)
-	} else {
-		rltyData["serverName"] = ""
-	}
-
-	return rltyData
-}
-
-func (s *SubJsonService) genVnext(inbound *model.Inbound, streamSettings json_util.RawMessage, client model.Client) json_util.RawMessage {
-	outbound := Outbound{}
-	usersData := make([]UserVnext, 1)
-
-	usersData[0].ID = client.ID
-	usersData[0].Email = client.Email
-	usersData[0].Security = client.Security
-	vnextData := make([]VnextSetting, 1)
-	vnextData[0] = VnextSetting{
-		Address: inbound.Listen,
-		Port:    inbound.Port,
-		Users:   usersData,
-	}
-
-	outbound.Protocol = string(inbound.Protocol)
-	outbound.Tag = "proxy"
-	if s.mux != "" {
-		outbound.Mux = json_util.RawMessage(s.mux)
-	}
-	outbound.StreamSettings = streamSettings
-	outbound.Settings = map[string]any{
-		"vnext": vnextData,
-	}
-
-	result, _ := json.MarshalIndent(outbound, "", "  ")
-	return result
-}
-
-func (s *SubJsonService) genVless(inbound *model.Inbound, streamSettings json_util.RawMessage, client model.Client) json_util.RawMessage {
-	outbound := Outbound{}
-	outbound.Protocol = string(inbound.Protocol)
-	outbound.Tag = "proxy"
-	if s.mux != "" {
-		outbound.Mux = json_util.RawMessage(s.mux)
-	}
-	outbound.StreamSettings = streamSettings
-	settings := make(map[string]any)
-	settings["address"] = inbound.Listen
-	settings["port"] = inbound.Port
-	settings["id"] = client.ID
-	if client.Flow != "" {
-		settings["flow"] = client.Flow
-	}
-
-	// Add encryption for VLESS outbound from inbound settings
-	var inboundSettings map[string]any
-	json.Unmarshal([]byte(inbound.Settings), &inboundSettings)
-	if encryption, ok := inboundSettings["encryption"].(string); ok {
-		settings["encryption"] = encryption
+// subPort returns the port of configs connecting to the server itself.
+func (s *SubJsonService) subPort(req *subRequest, inbound *model.Inbound) int {
+	if req.query.Port > 0 {
+		return req.query.Port
 	}
-
-	outbound.Settings = settings
-	result, _ := json.MarshalIndent(outbound, "", "  ")
-	return result
+	return inbound.Port
 }
 
-func (s *SubJsonService) genServer(inbound *model.Inbound, streamSettings json_util.RawMessage, client model.Client) json_util.RawMessage {
-	outbound := Outbound{}
-
-	serverData := make([]ServerSetting, 1)
-	serverData[0] = ServerSetting{
-		Address:  inbound.Listen,
-		Port:     inbound.Port,
-		Level:    8,
-		Password: client.Password,
+// genOutbound returns the proxy outbound connecting to the inbound as the client, or nil when the
+// protocol has none.
+func (s *SubJsonService) genOutbound(inbound *model.Inbound, streamSettings json_util.RawMessage, client model.Client) json_util.RawMessage {
+	settings := link.OutboundSettings(inbound, client, inbound.Listen, inbound.Port)
+	if settings == nil {
+		return nil
 	}
-
-	if inbound.Protocol == model.Shadowsocks {
-		var inboundSettings map[string]any
-		json.Unmarshal([]byte(inbound.Settings), &inboundSettings)
-		method, _ := inboundSettings["method"].(string)
-		serverData[0].Method = method
-
-		// server password in multi-user 2022 protocols
-		if strings.HasPrefix(method, "2022") {
-			if serverPassword, ok := inboundSettings["password"].(string); ok {
-				serverData[0].Password = fmt.Sprintf("%s:%s", serverPassword, client.Password)
-			}
-		}
+	outbound := Outbound{
+		Protocol:       string(inbound.Protocol),
+		Tag:            "proxy",
+		StreamSettings: streamSettings,
+		Settings:       settings,
 	}
-
-	outbound.Protocol = string(inbound.Protocol)
-	outbound.Tag = "proxy"
 	if s.mux != "" {
 		outbound.Mux = json_util.RawMessage(s.mux)
 	}
-	outbound.StreamSettings = streamSettings
-	outbound.Settings = map[string]any{
-		"servers": serverData,
-	}
-
 	result, _ := json.MarshalIndent(outbound, "", "  ")
 	return result
 }
@@ -391,24 +292,3 @@ type Outbound struct {
 	Mux            json_util.RawMessage `json:"mux,omitempty"`
 	Settings       map[string]any       `json:"settings,omitempty"`
 }
-
-type VnextSetting struct {
-	Address string      `json:"address"`
-	Port    int         `json:"port"`
-	Users   []UserVnext `json:"users"`
-}
-
-type UserVnext struct {
-	ID       string `json:"id"`
-	Email    string `json:"email,omitempty"`
-	Security string `json:"security,omitempty"`
-}
-
-type ServerSetting struct {
-	Password string `json:"password"`
-	Level    int    `json:"level"`
-	Address  string `json:"address"`
-	Port     int    `json:"port"`
-	Flow     string `json:"flow,omitempty"`
-	Method   string `json:"method,omitempty"`
-}
@@ -1,12 +1,9 @@
 package sub
 
 import (
-	"encoding/base64"
 	"fmt"
 	"net"
-	"net/url"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/goccy/go-json"
@@ -15,49 +12,73 @@ import (
 	"github.com/mhsanaei/3x-ui/v2/database/model"
 	"github.com/mhsanaei/3x-ui/v2/logger"
 	"github.com/mhsanaei/3x-ui/v2/util/common"
-	"github.com/mhsanaei/3x-ui/v2/util/random"
+	"github.com/mhsanaei/3x-ui/v2/util/link"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
 	"github.com/mhsanaei/3x-ui/v2/web/service"
 	"github.com/mhsanaei/3x-ui/v2/xray"
 )
 
 // SubService provides business logic for generating subscription links and managing subscription data.
 type SubService struct {
-	address        string
-	showInfo       bool
-	remarkModel    string
-	datepicker     string
-	inboundService service.InboundService
-	settingService service.SettingService
+	remarkOptions        link.RemarkOptions
+	datepicker           string
+	inboundService       service.InboundService
+	settingService       service.SettingService
+	announcementService  service.AnnouncementService
+	inboundHealthService service.InboundHealthService
+	naiveService         service.NaiveService
+	sshTunnelService     service.SSHTunnelService
+	customerService      service.CustomerService
 }
 
 // NewSubService creates a new subscription service with the given configuration.
-func NewSubService(showInfo bool, remarkModel string) *SubService {
+func NewSubService(remarkOptions link.RemarkOptions) *SubService {
 	return &SubService{
-		showInfo:    showInfo,
-		remarkModel: remarkModel,
+		remarkOptions: remarkOptions,
 	}
 }
 
-// GetSubs retrieves subscription links for a given subscription ID and host.
-func (s *SubService) GetSubs(subId string, host string) ([]string, int64, xray.ClientTraffic, error) {
-	s.address = host
+// subRequest holds the options of a single subscription request. The controllers share one
+// SubService between concurrent requests, so they are passed down instead of kept on the service.
+type subRequest struct {
+	address string
+	query   link.QueryOptions
+	seed    string
+	profile *model.SubProfile
+}
+
+// GetSubs retrieves subscription links for a given subscription ID and host, generated with the
+// link options of the request. A profile, when given, limits the inbounds the links are for.
+func (s *SubService) GetSubs(subId string, host string, query link.QueryOptions, profile *model.SubProfile) ([]string, int64, xray.ClientTraffic, error) {
+	req := &subRequest{address: host, query: query, seed: s.linkSeed(subId), profile: profile}
 	var result []string
 	var traffic xray.ClientTraffic
 	var lastOnline int64
 	var clientTraffics []xray.ClientTraffic
+	var err error
+	s.datepicker, err = s.settingService.GetDatepicker()
+	if err != nil {
+		s.datepicker = "gregorian"
+	}
+	cacheKey := req.cacheKey("links", subId)
+	version := s.dataVersion()
+	if value, ok := cached(cacheKey, version); ok {
+		cachedResult := value.(*subResult)
+		return cachedResult.links, cachedResult.lastOnline, cachedResult.traffic, nil
+	}
+
 	inbounds, err := s.getInboundsBySubId(subId)
 	if err != nil {
 		return nil, 0, traffic, err
 	}
+	inbounds = req.profileInbounds(inbounds)
 
 	if len(inbounds) == 0 {
 		return nil, 0, traffic, common.NewError("No inbounds found with ", subId)
 	}
-
-	s.datepicker, err = s.settingService.GetDatepicker()
-	if err != nil {
-		s.datepicker = "gregorian"
-	}
+	healthMode, _ := s.settingService.GetHealthCheckMode()
+	accountEndpoints := s.getAccountEndpoints(req)
+	var failingLinks []string
 	for _, inbound := range inbounds {
 		clients, err := s.inboundService.GetClients(inbound)
 		if err != nil {
@@ -66,6 +87,7 @@ func (s *SubService) GetSubs(subId string, host string) ([]string, int64, xray.C
 		if clients == nil {
 			continue
 		}
+		inbound.Port = inbound.SubPort()
 		if len(inbound.Listen) > 0 && inbound.Listen[0] == '@' {
 			listen, port, streamSettings, err := s.getFallbackMaster(inbound.Listen, inbound.StreamSettings)
 			if err == nil {
@@ -75,9 +97,21 @@ func (s *SubService) GetSubs(subId string, host string) ([]string, int64, xray.C
 			}
 		}
 		for _, client := range clients {
-			if client.Enable && client.SubID == subId {
-				link := s.getLink(inbound, client.Email)
-				result = append(result, link)
+			if client.Enable && client.SubID == subId && inbound.InSubscription(client) {
+				link := s.getLink(req, inbound, client.Email)
+				if s.inboundHealthService.IsInboundDown(inbound.Id) {
+					failingLinks = append(failingLinks, link)
+				} else {
+					result = append(result, link)
+				}
+				for _, endpoint := range accountEndpoints {
+					if !endpoint.inboundIds[inbound.Id] {
+						continue
+					}
+					if accountLink := s.getAccountLink(req, endpoint, inbound, &client); accountLink != "" {
+						result = append(result, accountLink)
+					}
+				}
 				ct := s.getClientTraffics(inbound.ClientStats, client.Email)
 				clientTraffics = append(clientTraffics, ct)
 				if ct.LastOnline > lastOnline {
@@ -87,6 +121,8 @@ func (s *SubService) GetSubs(subId string, host string) ([]string, int64, xray.C
 		}
 	}
 
+	result = service.ArrangeByHealth(healthMode, result, failingLinks)
+
 	// Prepare statistics
 	for index, clientTraffic := range clientTraffics {
 		if index == 0 {
@@ -109,20 +145,73 @@ func (s *SubService) GetSubs(subId string, host string) ([]string, int64, xray.C
 			}
 		}
 	}
+	// The quota and expiry of the customer owning the subscription apply to all its clients
+	if customer, err := s.customerService.GetCustomerBySubId(subId); err == nil && customer != nil {
+		if customer.TotalGB > 0 {
+			traffic.Total = customer.TotalGB
+		}
+		if customer.ExpiryTime > 0 {
+			traffic.ExpiryTime = customer.ExpiryTime
+		}
+	}
+	storeCached(cacheKey, version, s.timeDependent(req, inbounds), &subResult{links: result, lastOnline: lastOnline, traffic: traffic})
 	return result, lastOnline, traffic, nil
 }
 
+// accountEndpoint is a server outside the core the clients of some inbounds log in to with
+// their email and secret, like the NaiveProxy forward proxy or the SSH tunnel server.
+type accountEndpoint struct {
+	host       string
+	port       int
+	inboundIds map[int]bool
+	remark     string
+	build      func(user, password, host string, port int, remark string) string
+}
+
+// getAccountEndpoints returns the enabled servers clients get account links to.
+func (s *SubService) getAccountEndpoints(req *subRequest) []*accountEndpoint {
+	var endpoints []*accountEndpoint
+	if enable, err := s.settingService.GetNaiveEnable(); err == nil && enable {
+		domain, _ := s.settingService.GetNaiveDomain()
+		port, err := s.settingService.GetNaivePort()
+		inboundIds, _ := s.naiveService.GetNaiveInboundIds()
+		if domain != "" && err == nil && len(inboundIds) > 0 {
+			endpoints = append(endpoints, &accountEndpoint{host: domain, port: port, inboundIds: inboundIds, remark: "Naive", build: link.Naive})
+		}
+	}
+	if enable, err := s.settingService.GetSshEnable(); err == nil && enable {
+		host, _ := s.settingService.GetSshHost()
+		if host == "" {
+			host = req.address
+		}
+		port, err := s.settingService.GetSshPort()
+		inboundIds, _ := s.sshTunnelService.GetSshInboundIds()
+		if err == nil && len(inboundIds) > 0 {
+			endpoints = append(endpoints, &accountEndpoint{host: host, port: port, inboundIds: inboundIds, remark: "SSH", build: link.SSH})
+		}
+	}
+	return endpoints
+}
+
+// getAccountLink returns the link of the client to the server.
+func (s *SubService) getAccountLink(req *subRequest, endpoint *accountEndpoint, inbound *model.Inbound, client *model.Client) string {
+	password := service.ClientSecret(client)
+	if password == "" {
+		return ""
+	}
+	return endpoint.build(client.Email, password, endpoint.host, endpoint.port, s.genRemark(req, inbound, client.Email, endpoint.remark))
+}
+
+// getInboundsBySubId returns the enabled inbounds with a client of the subscription, found through
+// the indexed subscription ID of the client traffic rows. Only the traffic of the subscription's
+// clients is loaded with them.
 func (s *SubService) getInboundsBySubId(subId string) ([]*model.Inbound, error) {
 	db := database.GetDB()
 	var inbounds []*model.Inbound
-	err := db.Model(model.Inbound{}).Preload("ClientStats").Where(`id in (
-		SELECT DISTINCT inbounds.id
-		FROM inbounds,
-			JSON_EACH(JSON_EXTRACT(inbounds.settings, '$.clients')) AS client 
-		WHERE
-			protocol in ('vmess','vless','trojan','shadowsocks')
-			AND JSON_EXTRACT(client.value, '$.subId') = ? AND enable = ?
-	)`, subId, true).Find(&inbounds).Error
+	err := db.Model(model.Inbound{}).Preload("ClientStats", "sub_id = ?", subId).
+		Where("id IN (SELECT inbound_id FROM client_traffics WHERE sub_id = ?)", subId).
+		Where("protocol IN ? AND enable = ?", []model.Protocol{model.VMESS, model.VLESS, model.Trojan, model.Shadowsocks}, true).
+		Order("id").Find(&inbounds).Error
 	if err != nil {
 		return nil, err
 	}
@@ -161,876 +250,71 @@ func (s *SubService) getFallbackMaster(dest string, streamSettings string) (stri
 	return inbound.Listen, inbound.Port, string(modifiedStream), nil
 }
 
-func (s *SubService) getLink(inbound *model.Inbound, email string) string {
-	switch inbound.Protocol {
-	case "vmess":
-		return s.genVmessLink(inbound, email)
-	case "vless":
-		return s.genVlessLink(inbound, email)
-	case "trojan":
-		return s.genTrojanLink(inbound, email)
-	case "shadowsocks":
-		return s.genShadowsocksLink(inbound, email)
-	}
-	return ""
-}
-
-func (s *SubService) genVmessLink(inbound *model.Inbound, email string) string {
-	if inbound.Protocol != model.VMESS {
-		return ""
-	}
-	obj := map[string]any{
-		"v":    "2",
-		"add":  s.address,
-		"port": inbound.Port,
-		"type": "none",
-	}
-	var stream map[string]any
-	json.Unmarshal([]byte(inbound.StreamSettings), &stream)
-	network, _ := stream["network"].(string)
-	obj["net"] = network
-	switch network {
-	case "tcp":
-		tcp, _ := stream["tcpSettings"].(map[string]any)
-		header, _ := tcp["header"].(map[string]any)
-		typeStr, _ := header["type"].(string)
-		obj["type"] = typeStr
-		if typeStr == "http" {
-			request := header["request"].(map[string]any)
-			requestPath, _ := request["path"].([]any)
-			obj["path"] = requestPath[0].(string)
-			headers, _ := request["headers"].(map[string]any)
-			obj["host"] = searchHost(headers)
-		}
-	case "kcp":
-		kcp, _ := stream["kcpSettings"].(map[string]any)
-		header, _ := kcp["header"].(map[string]any)
-		obj["type"], _ = header["type"].(string)
-		obj["path"], _ = kcp["seed"].(string)
-	case "ws":
-		ws, _ := stream["wsSettings"].(map[string]any)
-		obj["path"] = ws["path"].(string)
-		if host, ok := ws["host"].(string); ok && len(host) > 0 {
-			obj["host"] = host
-		} else {
-			headers, _ := ws["headers"].(map[string]any)
-			obj["host"] = searchHost(headers)
-		}
-	case "grpc":
-		grpc, _ := stream["grpcSettings"].(map[string]any)
-		obj["path"] = grpc["serviceName"].(string)
-		obj["authority"] = grpc["authority"].(string)
-		if grpc["multiMode"].(bool) {
-			obj["type"] = "multi"
-		}
-	case "httpupgrade":
-		httpupgrade, _ := stream["httpupgradeSettings"].(map[string]any)
-		obj["path"] = httpupgrade["path"].(string)
-		if host, ok := httpupgrade["host"].(string); ok && len(host) > 0 {
-			obj["host"] = host
-		} else {
-			headers, _ := httpupgrade["headers"].(map[string]any)
-			obj["host"] = searchHost(headers)
-		}
-	case "xhttp":
-		xhttp, _ := stream["xhttpSettings"].(map[string]any)
-		obj["path"] = xhttp["path"].(string)
-		if host, ok := xhttp["host"].(string); ok && len(host) > 0 {
-			obj["host"] = host
-		} else {
-			headers, _ := xhttp["headers"].(map[string]any)
-			obj["host"] = searchHost(headers)
-		}
-		obj["mode"] = xhttp["mode"].(string)
-	}
-	security, _ := stream["security"].(string)
-	obj["tls"] = security
-	if security == "tls" {
-		tlsSetting, _ := stream["tlsSettings"].(map[string]any)
-		alpns, _ := tlsSetting["alpn"].([]any)
-		if len(alpns) > 0 {
-			var alpn []string
-			for _, a := range alpns {
-				alpn = append(alpn, a.(string))
-			}
-			obj["alpn"] = strings.Join(alpn, ",")
-		}
-		if sniValue, ok := searchKey(tlsSetting, "serverName"); ok {
-			obj["sni"], _ = sniValue.(string)
-		}
-
-		tlsSettings, _ := searchKey(tlsSetting, "settings")
-		if tlsSetting != nil {
-			if fpValue, ok := searchKey(tlsSettings, "fingerprint"); ok {
-				obj["fp"], _ = fpValue.(string)
-			}
-			if insecure, ok := searchKey(tlsSettings, "allowInsecure"); ok {
-				obj["allowInsecure"], _ = insecure.(bool)
-			}
-		}
-	}
-
-	clients, _ := s.inboundService.GetClients(inbound)
-	clientIndex := -1
-	for i, client := range clients {
-		if client.Email == email {
-			clientIndex = i
-			break
-		}
-	}
-	obj["id"] = clients[clientIndex].ID
-	obj["scy"] = clients[clientIndex].Security
-
-	externalProxies, _ := stream["externalProxy"].([]any)
-
-	if len(externalProxies) > 0 {
-		links := ""
-		for index, externalProxy := range externalProxies {
-			ep, _ := externalProxy.(map[string]any)
-			newSecurity, _ := ep["forceTls"].(string)
-			newObj := map[string]any{}
-			for key, value := range obj {
-				if !(newSecurity == "none" && (key == "alpn" || key == "sni" || key == "fp" || key == "allowInsecure")) {
-					newObj[key] = value
-				}
-			}
-			newObj["ps"] = s.genRemark(inbound, email, ep["remark"].(string))
-			newObj["add"] = ep["dest"].(string)
-			newObj["port"] = int(ep["port"].(float64))
-
-			if newSecurity != "same" {
-				newObj["tls"] = newSecurity
-			}
-			if index > 0 {
-				links += "\n"
-			}
-			jsonStr, _ := json.MarshalIndent(newObj, "", "  ")
-			links += "vmess://" + base64.StdEncoding.EncodeToString(jsonStr)
-		}
-		return links
-	}
-
-	obj["ps"] = s.genRemark(inbound, email, "")
-
-	jsonStr, _ := json.MarshalIndent(obj, "", "  ")
-	return "vmess://" + base64.StdEncoding.EncodeToString(jsonStr)
+func (s *SubService) getLink(req *subRequest, inbound *model.Inbound, email string) string {
+	return link.Generate(inbound, email, s.linkOptions(req))
 }
 
-func (s *SubService) genVlessLink(inbound *model.Inbound, email string) string {
-	address := s.address
-	if inbound.Protocol != model.VLESS {
-		return ""
-	}
-	var stream map[string]any
-	json.Unmarshal([]byte(inbound.StreamSettings), &stream)
-	clients, _ := s.inboundService.GetClients(inbound)
-	clientIndex := -1
-	for i, client := range clients {
-		if client.Email == email {
-			clientIndex = i
-			break
-		}
-	}
-	uuid := clients[clientIndex].ID
-	port := inbound.Port
-	streamNetwork := stream["network"].(string)
-	params := make(map[string]string)
-	params["type"] = streamNetwork
-
-	// Add encryption parameter for VLESS from inbound settings
-	var settings map[string]any
-	json.Unmarshal([]byte(inbound.Settings), &settings)
-	if encryption, ok := settings["encryption"].(string); ok {
-		params["encryption"] = encryption
-	}
-
-	switch streamNetwork {
-	case "tcp":
-		tcp, _ := stream["tcpSettings"].(map[string]any)
-		header, _ := tcp["header"].(map[string]any)
-		typeStr, _ := header["type"].(string)
-		if typeStr == "http" {
-			request := header["request"].(map[string]any)
-			requestPath, _ := request["path"].([]any)
-			params["path"] = requestPath[0].(string)
-			headers, _ := request["headers"].(map[string]any)
-			params["host"] = searchHost(headers)
-			params["headerType"] = "http"
-		}
-	case "kcp":
-		kcp, _ := stream["kcpSettings"].(map[string]any)
-		header, _ := kcp["header"].(map[string]any)
-		params["headerType"] = header["type"].(string)
-		params["seed"] = kcp["seed"].(string)
-	case "ws":
-		ws, _ := stream["wsSettings"].(map[string]any)
-		params["path"] = ws["path"].(string)
-		if host, ok := ws["host"].(string); ok && len(host) > 0 {
-			params["host"] = host
-		} else {
-			headers, _ := ws["headers"].(map[string]any)
-			params["host"] = searchHost(headers)
-		}
-	case "grpc":
-		grpc, _ := stream["grpcSettings"].(map[string]any)
-		params["serviceName"] = grpc["serviceName"].(string)
-		params["authority"], _ = grpc["authority"].(string)
-		if grpc["multiMode"].(bool) {
-			params["mode"] = "multi"
-		}
-	case "httpupgrade":
-		httpupgrade, _ := stream["httpupgradeSettings"].(map[string]any)
-		params["path"] = httpupgrade["path"].(string)
-		if host, ok := httpupgrade["host"].(string); ok && len(host) > 0 {
-			params["host"] = host
-		} else {
-			headers, _ := httpupgrade["headers"].(map[string]any)
-			params["host"] = searchHost(headers)
-		}
-	case "xhttp":
-		xhttp, _ := stream["xhttpSettings"].(map[string]any)
-		params["path"] = xhttp["path"].(string)
-		if host, ok := xhttp["host"].(string); ok && len(host) > 0 {
-			params["host"] = host
-		} else {
-			headers, _ := xhttp["headers"].(map[string]any)
-			params["host"] = searchHost(headers)
-		}
-		params["mode"] = xhttp["mode"].(string)
-	}
-	security, _ := stream["security"].(string)
-	if security == "tls" {
-		params["security"] = "tls"
-		tlsSetting, _ := stream["tlsSettings"].(map[string]any)
-		alpns, _ := tlsSetting["alpn"].([]any)
-		var alpn []string
-		for _, a := range alpns {
-			alpn = append(alpn, a.(string))
-		}
-		if len(alpn) > 0 {
-			params["alpn"] = strings.Join(alpn, ",")
-		}
-		if sniValue, ok := searchKey(tlsSetting, "serverName"); ok {
-			params["sni"], _ = sniValue.(string)
-		}
-
-		tlsSettings, _ := searchKey(tlsSetting, "settings")
-		if tlsSetting != nil {
-			if fpValue, ok := searchKey(tlsSettings, "fingerprint"); ok {
-				params["fp"], _ = fpValue.(string)
-			}
-			if insecure, ok := searchKey(tlsSettings, "allowInsecure"); ok {
-				if insecure.(bool) {
-					params["allowInsecure"] = "1"
-				}
-			}
-		}
-
-		if streamNetwork == "tcp" && len(clients[clientIndex].Flow) > 0 {
-			params["flow"] = clients[clientIndex].Flow
-		}
-	}
-
-	if security == "reality" {
-		params["security"] = "reality"
-		realitySetting, _ := stream["realitySettings"].(map[string]any)
-		realitySettings, _ := searchKey(realitySetting, "settings")
-		if realitySetting != nil {
-			if sniValue, ok := searchKey(realitySetting, "serverNames"); ok {
-				sNames, _ := sniValue.([]any)
-				params["sni"] = sNames[random.Num(len(sNames))].(string)
-			}
-			if pbkValue, ok := searchKey(realitySettings, "publicKey"); ok {
-				params["pbk"], _ = pbkValue.(string)
-			}
-			if sidValue, ok := searchKey(realitySetting, "shortIds"); ok {
-				shortIds, _ := sidValue.([]any)
-				params["sid"] = shortIds[random.Num(len(shortIds))].(string)
-			}
-			if fpValue, ok := searchKey(realitySettings, "fingerprint"); ok {
-				if fp, ok := fpValue.(string); ok && len(fp) > 0 {
-					params["fp"] = fp
-				}
-			}
-			if pqvValue, ok := searchKey(realitySettings, "mldsa65Verify"); ok {
-				if pqv, ok := pqvValue.(string); ok && len(pqv) > 0 {
-					params["pqv"] = pqv
-				}
-			}
-			params["spx"] = "/" + random.Seq(15)
-		}
-
-		if streamNetwork == "tcp" && len(clients[clientIndex].Flow) > 0 {
-			params["flow"] = clients[clientIndex].Flow
-		}
-	}
-
-	if security != "tls" && security != "reality" {
-		params["security"] = "none"
-	}
-
-	externalProxies, _ := stream["externalProxy"].([]any)
-
-	if len(externalProxies) > 0 {
-		links := ""
-		for index, externalProxy := range externalProxies {
-			ep, _ := externalProxy.(map[string]any)
-			newSecurity, _ := ep["forceTls"].(string)
-			dest, _ := ep["dest"].(string)
-			port := int(ep["port"].(float64))
-			link := fmt.Sprintf("vless://%s@%s:%d", uuid, dest, port)
-
-			if newSecurity != "same" {
-				params["security"] = newSecurity
-			} else {
-				params["security"] = security
-			}
-			url, _ := url.Parse(link)
-			q := url.Query()
-
-			for k, v := range params {
-				if !(newSecurity == "none" && (k == "alpn" || k == "sni" || k == "fp" || k == "allowInsecure")) {
-					q.Add(k, v)
-				}
-			}
-
-			// Set the new query values on the URL
-			url.RawQuery = q.Encode()
-
-			url.Fragment = s.genRemark(inbound, email, ep["remark"].(string))
-
-			if index > 0 {
-				links += "\n"
-			}
-			links += url.String()
-		}
-		return links
-	}
-
-	link := fmt.Sprintf("vless://%s@%s:%d", uuid, address, port)
-	url, _ := url.Parse(link)
-	q := url.Query()
-
-	for k, v := range params {
-		q.Add(k, v)
-	}
-
-	// Set the new query values on the URL
-	url.RawQuery = q.Encode()
-
-	url.Fragment = s.genRemark(inbound, email, "")
-	return url.String()
+// linkOptions returns the options the links of the request are generated with.
+func (s *SubService) linkOptions(req *subRequest) link.Options {
+	opts := req.query.Apply(req.address, s.remarkOptions)
+	opts.Seed = req.seed
+	return opts
 }
 
-func (s *SubService) genTrojanLink(inbound *model.Inbound, email string) string {
-	address := s.address
-	if inbound.Protocol != model.Trojan {
-		return ""
-	}
-	var stream map[string]any
-	json.Unmarshal([]byte(inbound.StreamSettings), &stream)
-	clients, _ := s.inboundService.GetClients(inbound)
-	clientIndex := -1
-	for i, client := range clients {
-		if client.Email == email {
-			clientIndex = i
-			break
-		}
-	}
-	password := clients[clientIndex].Password
-	port := inbound.Port
-	streamNetwork := stream["network"].(string)
-	params := make(map[string]string)
-	params["type"] = streamNetwork
-
-	switch streamNetwork {
-	case "tcp":
-		tcp, _ := stream["tcpSettings"].(map[string]any)
-		header, _ := tcp["header"].(map[string]any)
-		typeStr, _ := header["type"].(string)
-		if typeStr == "http" {
-			request := header["request"].(map[string]any)
-			requestPath, _ := request["path"].([]any)
-			params["path"] = requestPath[0].(string)
-			headers, _ := request["headers"].(map[string]any)
-			params["host"] = searchHost(headers)
-			params["headerType"] = "http"
-		}
-	case "kcp":
-		kcp, _ := stream["kcpSettings"].(map[string]any)
-		header, _ := kcp["header"].(map[string]any)
-		params["headerType"] = header["type"].(string)
-		params["seed"] = kcp["seed"].(string)
-	case "ws":
-		ws, _ := stream["wsSettings"].(map[string]any)
-		params["path"] = ws["path"].(string)
-		if host, ok := ws["host"].(string); ok && len(host) > 0 {
-			params["host"] = host
-		} else {
-			headers, _ := ws["headers"].(map[string]any)
-			params["host"] = searchHost(headers)
-		}
-	case "grpc":
-		grpc, _ := stream["grpcSettings"].(map[string]any)
-		params["serviceName"] = grpc["serviceName"].(string)
-		params["authority"], _ = grpc["authority"].(string)
-		if grpc["multiMode"].(bool) {
-			params["mode"] = "multi"
-		}
-	case "httpupgrade":
-		httpupgrade, _ := stream["httpupgradeSettings"].(map[string]any)
-		params["path"] = httpupgrade["path"].(string)
-		if host, ok := httpupgrade["host"].(string); ok && len(host) > 0 {
-			params["host"] = host
-		} else {
-			headers, _ := httpupgrade["headers"].(map[string]any)
-			params["host"] = searchHost(headers)
-		}
-	case "xhttp":
-		xhttp, _ := stream["xhttpSettings"].(map[string]any)
-		params["path"] = xhttp["path"].(string)
-		if host, ok := xhttp["host"].(string); ok && len(host) > 0 {
-			params["host"] = host
-		} else {
-			headers, _ := xhttp["headers"].(map[string]any)
-			params["host"] = searchHost(headers)
-		}
-		params["mode"] = xhttp["mode"].(string)
+// profileInbounds returns the inbounds the profile of the request selects, all of them when it
+// selects none.
+func (req *subRequest) profileInbounds(inbounds []*model.Inbound) []*model.Inbound {
+	if req.profile == nil {
+		return inbounds
 	}
-	security, _ := stream["security"].(string)
-	if security == "tls" {
-		params["security"] = "tls"
-		tlsSetting, _ := stream["tlsSettings"].(map[string]any)
-		alpns, _ := tlsSetting["alpn"].([]any)
-		var alpn []string
-		for _, a := range alpns {
-			alpn = append(alpn, a.(string))
-		}
-		if len(alpn) > 0 {
-			params["alpn"] = strings.Join(alpn, ",")
-		}
-		if sniValue, ok := searchKey(tlsSetting, "serverName"); ok {
-			params["sni"], _ = sniValue.(string)
-		}
-
-		tlsSettings, _ := searchKey(tlsSetting, "settings")
-		if tlsSetting != nil {
-			if fpValue, ok := searchKey(tlsSettings, "fingerprint"); ok {
-				params["fp"], _ = fpValue.(string)
-			}
-			if insecure, ok := searchKey(tlsSettings, "allowInsecure"); ok {
-				if insecure.(bool) {
-					params["allowInsecure"] = "1"
-				}
-			}
-		}
+	ids := service.ParseInboundIds(req.profile.InboundIds)
+	if len(ids) == 0 {
+		return inbounds
 	}
-
-	if security == "reality" {
-		params["security"] = "reality"
-		realitySetting, _ := stream["realitySettings"].(map[string]any)
-		realitySettings, _ := searchKey(realitySetting, "settings")
-		if realitySetting != nil {
-			if sniValue, ok := searchKey(realitySetting, "serverNames"); ok {
-				sNames, _ := sniValue.([]any)
-				params["sni"] = sNames[random.Num(len(sNames))].(string)
-			}
-			if pbkValue, ok := searchKey(realitySettings, "publicKey"); ok {
-				params["pbk"], _ = pbkValue.(string)
-			}
-			if sidValue, ok := searchKey(realitySetting, "shortIds"); ok {
-				shortIds, _ := sidValue.([]any)
-				params["sid"] = shortIds[random.Num(len(shortIds))].(string)
-			}
-			if fpValue, ok := searchKey(realitySettings, "fingerprint"); ok {
-				if fp, ok := fpValue.(string); ok && len(fp) > 0 {
-					params["fp"] = fp
-				}
-			}
-			if pqvValue, ok := searchKey(realitySettings, "mldsa65Verify"); ok {
-				if pqv, ok := pqvValue.(string); ok && len(pqv) > 0 {
-					params["pqv"] = pqv
-				}
-			}
-			params["spx"] = "/" + random.Seq(15)
-		}
-
-		if streamNetwork == "tcp" && len(clients[clientIndex].Flow) > 0 {
-			params["flow"] = clients[clientIndex].Flow
-		}
-	}
-
-	if security != "tls" && security != "reality" {
-		params["security"] = "none"
-	}
-
-	externalProxies, _ := stream["externalProxy"].([]any)
-
-	if len(externalProxies) > 0 {
-		links := ""
-		for index, externalProxy := range externalProxies {
-			ep, _ := externalProxy.(map[string]any)
-			newSecurity, _ := ep["forceTls"].(string)
-			dest, _ := ep["dest"].(string)
-			port := int(ep["port"].(float64))
-			link := fmt.Sprintf("trojan://%s@%s:%d", password, dest, port)
-
-			if newSecurity != "same" {
-				params["security"] = newSecurity
-			} else {
-				params["security"] = security
-			}
-			url, _ := url.Parse(link)
-			q := url.Query()
-
-			for k, v := range params {
-				if !(newSecurity == "none" && (k == "alpn" || k == "sni" || k == "fp" || k == "allowInsecure")) {
-					q.Add(k, v)
-				}
-			}
-
-			// Set the new query values on the URL
-			url.RawQuery = q.Encode()
-
-			url.Fragment = s.genRemark(inbound, email, ep["remark"].(string))
-
-			if index > 0 {
-				links += "\n"
-			}
-			links += url.String()
+	selected := make([]*model.Inbound, 0, len(inbounds))
+	for _, inbound := range inbounds {
+		if ids[inbound.Id] {
+			selected = append(selected, inbound)
 		}
-		return links
-	}
-
-	link := fmt.Sprintf("trojan://%s@%s:%d", password, address, port)
-
-	url, _ := url.Parse(link)
-	q := url.Query()
-
-	for k, v := range params {
-		q.Add(k, v)
 	}
-
-	// Set the new query values on the URL
-	url.RawQuery = q.Encode()
-
-	url.Fragment = s.genRemark(inbound, email, "")
-	return url.String()
+	return selected
 }
 
-func (s *SubService) genShadowsocksLink(inbound *model.Inbound, email string) string {
-	address := s.address
-	if inbound.Protocol != model.Shadowsocks {
+// linkSeed returns the seed of the links of a subscription, so they only change when its
+// inbounds do. Links are randomized on every request when the setting asks for it.
+func (s *SubService) linkSeed(subId string) string {
+	if randomize, err := s.settingService.GetSubRandomize(); err == nil && randomize {
 		return ""
 	}
-	var stream map[string]any
-	json.Unmarshal([]byte(inbound.StreamSettings), &stream)
-	clients, _ := s.inboundService.GetClients(inbound)
-
-	var settings map[string]any
-	json.Unmarshal([]byte(inbound.Settings), &settings)
-	inboundPassword := settings["password"].(string)
-	method := settings["method"].(string)
-	clientIndex := -1
-	for i, client := range clients {
-		if client.Email == email {
-			clientIndex = i
-			break
-		}
-	}
-	streamNetwork := stream["network"].(string)
-	params := make(map[string]string)
-	params["type"] = streamNetwork
-
-	switch streamNetwork {
-	case "tcp":
-		tcp, _ := stream["tcpSettings"].(map[string]any)
-		header, _ := tcp["header"].(map[string]any)
-		typeStr, _ := header["type"].(string)
-		if typeStr == "http" {
-			request := header["request"].(map[string]any)
-			requestPath, _ := request["path"].([]any)
-			params["path"] = requestPath[0].(string)
-			headers, _ := request["headers"].(map[string]any)
-			params["host"] = searchHost(headers)
-			params["headerType"] = "http"
-		}
-	case "kcp":
-		kcp, _ := stream["kcpSettings"].(map[string]any)
-		header, _ := kcp["header"].(map[string]any)
-		params["headerType"] = header["type"].(string)
-		params["seed"] = kcp["seed"].(string)
-	case "ws":
-		ws, _ := stream["wsSettings"].(map[string]any)
-		params["path"] = ws["path"].(string)
-		if host, ok := ws["host"].(string); ok && len(host) > 0 {
-			params["host"] = host
-		} else {
-			headers, _ := ws["headers"].(map[string]any)
-			params["host"] = searchHost(headers)
-		}
-	case "grpc":
-		grpc, _ := stream["grpcSettings"].(map[string]any)
-		params["serviceName"] = grpc["serviceName"].(string)
-		params["authority"], _ = grpc["authority"].(string)
-		if grpc["multiMode"].(bool) {
-			params["mode"] = "multi"
-		}
-	case "httpupgrade":
-		httpupgrade, _ := stream["httpupgradeSettings"].(map[string]any)
-		params["path"] = httpupgrade["path"].(string)
-		if host, ok := httpupgrade["host"].(string); ok && len(host) > 0 {
-			params["host"] = host
-		} else {
-			headers, _ := httpupgrade["headers"].(map[string]any)
-			params["host"] = searchHost(headers)
-		}
-	case "xhttp":
-		xhttp, _ := stream["xhttpSettings"].(map[string]any)
-		params["path"] = xhttp["path"].(string)
-		if host, ok := xhttp["host"].(string); ok && len(host) > 0 {
-			params["host"] = host
-		} else {
-			headers, _ := xhttp["headers"].(map[string]any)
-			params["host"] = searchHost(headers)
-		}
-		params["mode"] = xhttp["mode"].(string)
-	}
-
-	security, _ := stream["security"].(string)
-	if security == "tls" {
-		params["security"] = "tls"
-		tlsSetting, _ := stream["tlsSettings"].(map[string]any)
-		alpns, _ := tlsSetting["alpn"].([]any)
-		var alpn []string
-		for _, a := range alpns {
-			alpn = append(alpn, a.(string))
-		}
-		if len(alpn) > 0 {
-			params["alpn"] = strings.Join(alpn, ",")
-		}
-		if sniValue, ok := searchKey(tlsSetting, "serverName"); ok {
-			params["sni"], _ = sniValue.(string)
-		}
-
-		tlsSettings, _ := searchKey(tlsSetting, "settings")
-		if tlsSetting != nil {
-			if fpValue, ok := searchKey(tlsSettings, "fingerprint"); ok {
-				params["fp"], _ = fpValue.(string)
-			}
-			if insecure, ok := searchKey(tlsSettings, "allowInsecure"); ok {
-				if insecure.(bool) {
-					params["allowInsecure"] = "1"
-				}
-			}
-		}
-	}
-
-	encPart := fmt.Sprintf("%s:%s", method, clients[clientIndex].Password)
-	if method[0] == '2' {
-		encPart = fmt.Sprintf("%s:%s:%s", method, inboundPassword, clients[clientIndex].Password)
-	}
-
-	externalProxies, _ := stream["externalProxy"].([]any)
-
-	if len(externalProxies) > 0 {
-		links := ""
-		for index, externalProxy := range externalProxies {
-			ep, _ := externalProxy.(map[string]any)
-			newSecurity, _ := ep["forceTls"].(string)
-			dest, _ := ep["dest"].(string)
-			port := int(ep["port"].(float64))
-			link := fmt.Sprintf("ss://%s@%s:%d", base64.StdEncoding.EncodeToString([]byte(encPart)), dest, port)
-
-			if newSecurity != "same" {
-				params["security"] = newSecurity
-			} else {
-				params["security"] = security
-			}
-			url, _ := url.Parse(link)
-			q := url.Query()
-
-			for k, v := range params {
-				if !(newSecurity == "none" && (k == "alpn" || k == "sni" || k == "fp" || k == "allowInsecure")) {
-					q.Add(k, v)
-				}
-			}
-
-			// Set the new query values on the URL
-			url.RawQuery = q.Encode()
-
-			url.Fragment = s.genRemark(inbound, email, ep["remark"].(string))
-
-			if index > 0 {
-				links += "\n"
-			}
-			links += url.String()
-		}
-		return links
-	}
-
-	link := fmt.Sprintf("ss://%s@%s:%d", base64.StdEncoding.EncodeToString([]byte(encPart)), address, inbound.Port)
-	url, _ := url.Parse(link)
-	q := url.Query()
-
-	for k, v := range params {
-		q.Add(k, v)
-	}
-
-	// Set the new query values on the URL
-	url.RawQuery = q.Encode()
-
-	url.Fragment = s.genRemark(inbound, email, "")
-	return url.String()
-}
-
-func (s *SubService) genRemark(inbound *model.Inbound, email string, extra string) string {
-	separationChar := string(s.remarkModel[0])
-	orderChars := s.remarkModel[1:]
-	orders := map[byte]string{
-		'i': "",
-		'e': "",
-		'o': "",
-	}
-	if len(email) > 0 {
-		orders['e'] = email
-	}
-	if len(inbound.Remark) > 0 {
-		orders['i'] = inbound.Remark
-	}
-	if len(extra) > 0 {
-		orders['o'] = extra
-	}
-
-	var remark []string
-	for i := 0; i < len(orderChars); i++ {
-		char := orderChars[i]
-		order, exists := orders[char]
-		if exists && order != "" {
-			remark = append(remark, order)
-		}
-	}
-
-	if s.showInfo {
-		statsExist := false
-		var stats xray.ClientTraffic
-		for _, clientStat := range inbound.ClientStats {
-			if clientStat.Email == email {
-				stats = clientStat
-				statsExist = true
-				break
-			}
-		}
-
-		// Get remained days
-		if statsExist {
-			if !stats.Enable {
-				return fmt.Sprintf("⛔️N/A%s%s", separationChar, strings.Join(remark, separationChar))
-			}
-			if vol := stats.Total - (stats.Up + stats.Down); vol > 0 {
-				remark = append(remark, fmt.Sprintf("%s%s", common.FormatTraffic(vol), "📊"))
-			}
-			now := time.Now().Unix()
-			switch exp := stats.ExpiryTime / 1000; {
-			case exp > 0:
-				remainingSeconds := exp - now
-				days := remainingSeconds / 86400
-				hours := (remainingSeconds % 86400) / 3600
-				minutes := (remainingSeconds % 3600) / 60
-				if days > 0 {
-					if hours > 0 {
-						remark = append(remark, fmt.Sprintf("%dD,%dH⏳", days, hours))
-					} else {
-						remark = append(remark, fmt.Sprintf("%dD⏳", days))
-					}
-				} else if hours > 0 {
-					remark = append(remark, fmt.Sprintf("%dH⏳", hours))
-				} else {
-					remark = append(remark, fmt.Sprintf("%dM⏳", minutes))
-				}
-			case exp < 0:
-				days := exp / -86400
-				hours := (exp % -86400) / 3600
-				minutes := (exp % -3600) / 60
-				if days > 0 {
-					if hours > 0 {
-						remark = append(remark, fmt.Sprintf("%dD,%dH⏳", days, hours))
-					} else {
-						remark = append(remark, fmt.Sprintf("%dD⏳", days))
-					}
-				} else if hours > 0 {
-					remark = append(remark, fmt.Sprintf("%dH⏳", hours))
-				} else {
-					remark = append(remark, fmt.Sprintf("%dM⏳", minutes))
-				}
-			}
-		}
-	}
-	return strings.Join(remark, separationChar)
+	return subId
 }
 
-func searchKey(data any, key string) (any, bool) {
-	switch val := data.(type) {
-	case map[string]any:
-		for k, v := range val {
-			if k == key {
-				return v, true
-			}
-			if result, ok := searchKey(v, key); ok {
-				return result, true
-			}
-		}
-	case []any:
-		for _, v := range val {
-			if result, ok := searchKey(v, key); ok {
-				return result, true
-			}
-		}
-	}
-	return nil, false
-}
-
-func searchHost(headers any) string {
-	data, _ := headers.(map[string]any)
-	for k, v := range data {
-		if strings.EqualFold(k, "host") {
-			switch v.(type) {
-			case []any:
-				hosts, _ := v.([]any)
-				if len(hosts) > 0 {
-					return hosts[0].(string)
-				} else {
-					return ""
-				}
-			case any:
-				return v.(string)
-			}
-		}
-	}
-
-	return ""
+func (s *SubService) genRemark(req *subRequest, inbound *model.Inbound, email string, extra string) string {
+	return link.BuildRemark(inbound, email, extra, req.query.Remark(s.remarkOptions))
 }
 
 // PageData is a view model for subpage.html
 // PageData contains data for rendering the subscription information page.
 type PageData struct {
-	Host         string
-	BasePath     string
-	SId          string
-	Download     string
-	Upload       string
-	Total        string
-	Used         string
-	Remained     string
-	Expire       int64
-	LastOnline   int64
-	Datepicker   string
-	DownloadByte int64
-	UploadByte   int64
-	TotalByte    int64
-	SubUrl       string
-	SubJsonUrl   string
-	Result       []string
+	Host          string
+	BasePath      string
+	SId           string
+	Download      string
+	Upload        string
+	Total         string
+	Used          string
+	Remained      string
+	Expire        int64
+	LastOnline    int64
+	Datepicker    string
+	DownloadByte  int64
+	UploadByte    int64
+	TotalByte     int64
+	SubUrl        string
+	SubJsonUrl    string
+	Result        []string
+	Announcements string // Active announcements as JSON
+	Brand         *entity.Branding
 }
 
 // ResolveRequest extracts scheme and host info from request/headers consistently.
@@ -1166,26 +450,47 @@ func (s *SubService) BuildPageData(subId string, hostHeader string, traffic xray
 	}
 
 	return PageData{
-		Host:         hostHeader,
-		BasePath:     basePath,
-		SId:          subId,
-		Download:     download,
-		Upload:       upload,
-		Total:        total,
-		Used:         used,
-		Remained:     remained,
-		Expire:       traffic.ExpiryTime / 1000,
-		LastOnline:   lastOnline,
-		Datepicker:   datepicker,
-		DownloadByte: traffic.Down,
-		UploadByte:   traffic.Up,
-		TotalByte:    traffic.Total,
-		SubUrl:       subURL,
-		SubJsonUrl:   subJsonURL,
-		Result:       subs,
+		Host:          hostHeader,
+		BasePath:      basePath,
+		SId:           subId,
+		Download:      download,
+		Upload:        upload,
+		Total:         total,
+		Used:          used,
+		Remained:      remained,
+		Expire:        traffic.ExpiryTime / 1000,
+		LastOnline:    lastOnline,
+		Datepicker:    datepicker,
+		DownloadByte:  traffic.Down,
+		UploadByte:    traffic.Up,
+		TotalByte:     traffic.Total,
+		SubUrl:        subURL,
+		SubJsonUrl:    subJsonURL,
+		Result:        subs,
+		Announcements: s.getAnnouncementsJson(),
+		Brand:         s.settingService.GetBranding(),
 	}
 }
 
+// getAnnouncementsJson returns the active announcements as JSON for the subscription page.
+func (s *SubService) getAnnouncementsJson() string {
+	announcements, err := s.announcementService.GetActiveAnnouncements()
+	if err != nil {
+		logger.Warning("SubService - GetActiveAnnouncements:", err)
+		return "[]"
+	}
+	data, err := json.Marshal(announcements)
+	if err != nil {
+		return "[]"
+	}
+	return string(data)
+}
+
+// GetAnnouncementLinks returns the info nodes of announcements shown at the top of subscriptions.
+func (s *SubService) GetAnnouncementLinks() []string {
+	return s.announcementService.GetAnnouncementLinks()
+}
+
 func getHostFromXFH(s string) (string, error) {
 	if strings.Contains(s, ":") {
 		realHost, _, err := net.SplitHostPort(s)
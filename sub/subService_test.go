@@ -0,0 +1,97 @@
+package sub
+
+import (
+	"testing"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/dbtest"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/util/link"
+)
+
+func TestGetSubsCache(t *testing.T) {
+	dbtest.Setup(t)
+	s := NewSubService(link.RemarkOptions{Model: "-ieo"})
+	getLinks := func() []string {
+		t.Helper()
+		links, _, _, err := s.GetSubs("sub0", "vpn.example.com", link.QueryOptions{}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return links
+	}
+	if links := getLinks(); len(links) != dbtest.Inbounds {
+		t.Fatalf("got %d links, want %d", len(links), dbtest.Inbounds)
+	}
+
+	db := database.GetDB()
+	if err := db.Model(&model.Inbound{}).Where("tag = ?", "inbound-10000").Update("enable", false).Error; err != nil {
+		t.Fatal(err)
+	}
+	if links := getLinks(); len(links) != dbtest.Inbounds-1 {
+		t.Fatalf("got %d links after disabling an inbound, want %d", len(links), dbtest.Inbounds-1)
+	}
+
+	tx := db.Begin()
+	if err := tx.Model(&model.Inbound{}).Where("tag = ?", "inbound-10000").Update("enable", true).Error; err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+	// The output generated before the commit must not outlive it
+	getLinks()
+	if err := tx.Commit().Error; err != nil {
+		t.Fatal(err)
+	}
+	if links := getLinks(); len(links) != dbtest.Inbounds {
+		t.Fatalf("got %d links after enabling the inbound again, want %d", len(links), dbtest.Inbounds)
+	}
+}
+
+func BenchmarkGetInboundsBySubId(b *testing.B) {
+	dbtest.Setup(b)
+	s := NewSubService(link.RemarkOptions{Model: "-ieo"})
+	i := 0
+	for b.Loop() {
+		inbounds, err := s.getInboundsBySubId(dbtest.SubId(i % dbtest.Subs))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(inbounds) != dbtest.Inbounds {
+			b.Fatalf("got %d inbounds, want %d", len(inbounds), dbtest.Inbounds)
+		}
+		i++
+	}
+}
+
+func BenchmarkGetSubs(b *testing.B) {
+	dbtest.Setup(b)
+	s := NewSubService(link.RemarkOptions{Model: "-ieo"})
+	i := 0
+	for b.Loop() {
+		links, _, _, err := s.GetSubs(dbtest.SubId(i%dbtest.Subs), "vpn.example.com", link.QueryOptions{}, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(links) != dbtest.Inbounds {
+			b.Fatalf("got %d links, want %d", len(links), dbtest.Inbounds)
+		}
+		i++
+	}
+}
+
+func BenchmarkGetSubsCached(b *testing.B) {
+	dbtest.Setup(b)
+	s := NewSubService(link.RemarkOptions{Model: "-ieo"})
+	if _, _, _, err := s.GetSubs("sub0", "vpn.example.com", link.QueryOptions{}, nil); err != nil {
+		b.Fatal(err)
+	}
+	for b.Loop() {
+		links, _, _, err := s.GetSubs("sub0", "vpn.example.com", link.QueryOptions{}, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(links) != dbtest.Inbounds {
+			b.Fatalf("got %d links, want %d", len(links), dbtest.Inbounds)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/config"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+)
+
+// ANSI escape sequences used by the status screen.
+const (
+	ansiClear      = "\033[H\033[2J"
+	ansiHideCursor = "\033[?25l"
+	ansiShowCursor = "\033[?25h"
+	ansiBold       = "\033[1m"
+	ansiGreen      = "\033[32m"
+	ansiRed        = "\033[31m"
+	ansiReset      = "\033[0m"
+)
+
+// runTuiCommand handles "x-ui tui", a status screen refreshed in place until interrupted.
+func runTuiCommand(args []string) {
+	cmd := flag.NewFlagSet("tui", flag.ExitOnError)
+	interval := cmd.Duration("interval", 2*time.Second, "Refresh interval")
+	logLines := cmd.Int("logs", 10, "Number of recent log lines to show")
+	once := cmd.Bool("once", false, "Print the screen once and exit")
+	cmd.Parse(args)
+	if *interval < time.Second {
+		*interval = time.Second
+	}
+	initCliDb()
+
+	tuiService := service.TuiService{}
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	if !*once {
+		fmt.Print(ansiHideCursor)
+		defer fmt.Print(ansiShowCursor)
+	}
+
+	var last *service.TuiSnapshot
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		snapshot, err := tuiService.Snapshot(last, *logLines)
+		if err != nil {
+			fmt.Print(ansiShowCursor)
+			cliFatal("Failed to read panel state:", err)
+		}
+		if *once {
+			fmt.Print(renderTui(snapshot, *interval))
+			return
+		}
+		fmt.Print(ansiClear + renderTui(snapshot, *interval))
+		last = snapshot
+		select {
+		case <-sigCh:
+			fmt.Println()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// renderTui draws one screen of the status view.
+func renderTui(snapshot *service.TuiSnapshot, interval time.Duration) string {
+	var b strings.Builder
+	status := snapshot.Status
+	fmt.Fprintf(&b, "%s%s %s%s  %s  (refresh %v, Ctrl+C to quit)\n\n", ansiBold, config.GetName(), config.GetVersion(), ansiReset, snapshot.T.Format(time.DateTime), interval)
+
+	xrayState := ansiRed + "stopped" + ansiReset
+	if snapshot.Xray.Running {
+		xrayState = fmt.Sprintf("%srunning%s  pid %d  up %v", ansiGreen, ansiReset, snapshot.Xray.Pid, snapshot.Xray.Uptime)
+	}
+	fmt.Fprintf(&b, "Xray    %s\n", xrayState)
+	fmt.Fprintf(&b, "CPU     %.1f%% of %d cores   Load %s\n", status.Cpu, status.LogicalPro, formatLoads(status.Loads))
+	fmt.Fprintf(&b, "Memory  %s / %s   Swap %s / %s   Disk %s / %s\n",
+		common.FormatTraffic(int64(status.Mem.Current)), common.FormatTraffic(int64(status.Mem.Total)),
+		common.FormatTraffic(int64(status.Swap.Current)), common.FormatTraffic(int64(status.Swap.Total)),
+		common.FormatTraffic(int64(status.Disk.Current)), common.FormatTraffic(int64(status.Disk.Total)))
+	fmt.Fprintf(&b, "Network ↑ %s/s  ↓ %s/s   TCP %d  UDP %d\n\n",
+		common.FormatTraffic(int64(status.NetIO.Up)), common.FormatTraffic(int64(status.NetIO.Down)), status.TcpCount, status.UdpCount)
+
+	fmt.Fprintf(&b, "%sInbounds%s\n", ansiBold, ansiReset)
+	fmt.Fprintf(&b, "  %-4s %-24s %-12s %-6s %-8s %-9s %-12s %-12s\n", "ID", "REMARK", "PROTOCOL", "PORT", "STATE", "ONLINE", "UP/s", "DOWN/s")
+	for _, inbound := range snapshot.Inbounds {
+		state := "on"
+		if !inbound.Enable {
+			state = "off"
+		}
+		fmt.Fprintf(&b, "  %-4d %-24s %-12s %-6d %-8s %-9s %-12s %-12s\n",
+			inbound.Id, truncateText(inbound.Remark, 24), inbound.Protocol, inbound.Port, state,
+			fmt.Sprintf("%d/%d", inbound.Online, inbound.Clients),
+			common.FormatTraffic(inbound.UpRate), common.FormatTraffic(inbound.DownRate))
+	}
+	if len(snapshot.Inbounds) == 0 {
+		b.WriteString("  no inbounds\n")
+	}
+
+	fmt.Fprintf(&b, "\n%sOnline clients (%d)%s\n", ansiBold, len(snapshot.Online), ansiReset)
+	if len(snapshot.Online) > 0 {
+		b.WriteString("  " + truncateText(strings.Join(snapshot.Online, ", "), 400) + "\n")
+	}
+
+	if len(snapshot.Logs) > 0 {
+		fmt.Fprintf(&b, "\n%sRecent log%s\n", ansiBold, ansiReset)
+		for _, line := range snapshot.Logs {
+			b.WriteString("  " + truncateText(line, 160) + "\n")
+		}
+	}
+	return b.String()
+}
+
+// formatLoads formats the 1, 5 and 15 minute load averages.
+func formatLoads(loads []float64) string {
+	parts := make([]string, 0, len(loads))
+	for _, load := range loads {
+		parts = append(parts, fmt.Sprintf("%.2f", load))
+	}
+	return strings.Join(parts, " ")
+}
+
+// truncateText shortens text to at most n runes.
+func truncateText(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return string(runes[:n-1]) + "…"
+}
@@ -0,0 +1,71 @@
+// Package tunnel publishes the panel through a Cloudflare Tunnel or a Tor onion service, for
+// servers whose panel port can not be reached from outside.
+package tunnel
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha3"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/base64"
+	"strings"
+
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+)
+
+// onionVersion is the version byte of v3 onion addresses.
+const onionVersion = 3
+
+// onionSecretKeyHeader starts the secret key file of an onion service, padded to 32 bytes.
+const onionSecretKeyHeader = "== ed25519v1-secret: type0 =="
+
+// GenerateOnionKey returns a new onion service key, the seed of an ed25519 key in base64.
+func GenerateOnionKey() (string, error) {
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(seed), nil
+}
+
+// parseOnionKey returns the seed of an onion service key.
+func parseOnionKey(key string) ([]byte, error) {
+	seed, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, common.NewError("invalid onion service key")
+	}
+	return seed, nil
+}
+
+// OnionHostname returns the v3 onion address of the onion service with the key.
+func OnionHostname(key string) (string, error) {
+	seed, err := parseOnionKey(key)
+	if err != nil {
+		return "", err
+	}
+	publicKey := ed25519.NewKeyFromSeed(seed).Public().(ed25519.PublicKey)
+	data := append([]byte(".onion checksum"), publicKey...)
+	checksum := sha3.Sum256(append(data, onionVersion))
+	address := make([]byte, 0, len(publicKey)+3)
+	address = append(address, publicKey...)
+	address = append(address, checksum[:2]...)
+	address = append(address, onionVersion)
+	return strings.ToLower(base32.StdEncoding.EncodeToString(address)) + ".onion", nil
+}
+
+// onionSecretKeyFile returns the content of the hs_ed25519_secret_key file of the onion service
+// with the key: the header and the expanded ed25519 secret key Tor signs with.
+func onionSecretKeyFile(key string) ([]byte, error) {
+	seed, err := parseOnionKey(key)
+	if err != nil {
+		return nil, err
+	}
+	expanded := sha512.Sum512(seed)
+	expanded[0] &= 248
+	expanded[31] &= 127
+	expanded[31] |= 64
+	file := make([]byte, 32, 32+len(expanded))
+	copy(file, onionSecretKeyHeader)
+	return append(file, expanded[:]...), nil
+}
@@ -0,0 +1,248 @@
+package tunnel
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/config"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+)
+
+// Modes the panel can be published in.
+const (
+	Cloudflare = "cloudflare"
+	Tor        = "tor"
+)
+
+// quickTunnelHostname matches the hostname cloudflared logs for a quick tunnel.
+var quickTunnelHostname = regexp.MustCompile(`https://([a-z0-9-]+\.trycloudflare\.com)`)
+
+// Options configures the tunnel to the panel.
+type Options struct {
+	Mode     string // Cloudflare or Tor
+	Scheme   string // Scheme the panel is served with, http or https
+	Address  string // Host and port the panel is reached on locally
+	Socket   string // Unix socket the panel listens on, used instead of Address when set
+	Token    string // Cloudflare tunnel token, empty for a quick tunnel on trycloudflare.com
+	OnionKey string // Onion service key, see GenerateOnionKey
+}
+
+// GetBinaryPath returns the path to the cloudflared or tor binary of the mode, the one in the
+// binary folder when it is there and otherwise the one found in PATH.
+func GetBinaryPath(mode string) string {
+	name := "cloudflared"
+	if mode == Tor {
+		name = "tor"
+	}
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	path := filepath.Join(config.GetBinFolderPath(), name)
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+	if found, err := exec.LookPath(name); err == nil {
+		return found
+	}
+	return path
+}
+
+// GetTorFolder returns the folder Tor keeps its configuration, data and onion service in.
+func GetTorFolder() string {
+	return filepath.Join(config.GetBinFolderPath(), "tor")
+}
+
+// Process is a cloudflared or tor process publishing the panel.
+type Process struct {
+	cmd      *exec.Cmd
+	opts     Options
+	exitErr  error
+	done     chan struct{}
+	hostname string
+	lock     sync.Mutex
+}
+
+// NewProcess creates a new tunnel process with the given options.
+func NewProcess(opts Options) *Process {
+	return &Process{opts: opts}
+}
+
+// IsRunning returns true if the tunnel process is currently running.
+func (p *Process) IsRunning() bool {
+	return p.cmd != nil && p.cmd.Process != nil && p.cmd.ProcessState == nil
+}
+
+// GetErr returns the error the tunnel process exited with.
+func (p *Process) GetErr() error {
+	return p.exitErr
+}
+
+// GetOptions returns the options the process was started with.
+func (p *Process) GetOptions() Options {
+	return p.opts
+}
+
+// GetHostname returns the hostname cloudflared reported for a quick tunnel, empty until it did.
+func (p *Process) GetHostname() string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.hostname
+}
+
+// Start launches cloudflared or tor.
+func (p *Process) Start() error {
+	if p.IsRunning() {
+		return errors.New("tunnel is already running")
+	}
+	var cmd *exec.Cmd
+	var err error
+	switch p.opts.Mode {
+	case Cloudflare:
+		cmd = p.cloudflaredCommand()
+	case Tor:
+		cmd, err = p.torCommand()
+	default:
+		err = common.NewError("unknown tunnel mode:", p.opts.Mode)
+	}
+	if err != nil {
+		return err
+	}
+	p.cmd = cmd
+	p.done = make(chan struct{})
+	cmd.Stdout = logWriter{process: p}
+	cmd.Stderr = logWriter{process: p}
+	go func() {
+		defer close(p.done)
+		if err := cmd.Run(); err != nil {
+			logger.Error("Failure in running tunnel:", err)
+			p.exitErr = err
+		}
+	}()
+	return nil
+}
+
+// cloudflaredCommand returns the command running a tunnel with the token, or a quick tunnel to
+// the panel without one. Tunnels with a token get their origin from the Cloudflare dashboard.
+func (p *Process) cloudflaredCommand() *exec.Cmd {
+	args := []string{"tunnel", "--no-autoupdate"}
+	if p.opts.Token != "" {
+		cmd := exec.Command(GetBinaryPath(Cloudflare), append(args, "run")...)
+		// Passed in the environment so it does not show in the process list
+		cmd.Env = append(os.Environ(), "TUNNEL_TOKEN="+p.opts.Token)
+		return cmd
+	}
+	if p.opts.Socket != "" {
+		args = append(args, "--unix-socket", p.opts.Socket)
+	} else {
+		args = append(args, "--url", p.opts.Scheme+"://"+p.opts.Address)
+	}
+	if p.opts.Scheme == "https" {
+		// The panel certificate is for its own domain, not the local address
+		args = append(args, "--no-tls-verify")
+	}
+	return exec.Command(GetBinaryPath(Cloudflare), args...)
+}
+
+// torCommand writes the onion service key and the Tor configuration and returns the command
+// running Tor with it. The onion service listens on port 443 when the panel is served with
+// HTTPS and on port 80 otherwise.
+func (p *Process) torCommand() (*exec.Cmd, error) {
+	secretKey, err := onionSecretKeyFile(p.opts.OnionKey)
+	if err != nil {
+		return nil, err
+	}
+	folder := GetTorFolder()
+	serviceDir := filepath.Join(folder, "onion")
+	dataDir := filepath.Join(folder, "data")
+	// Tor refuses to use folders others can read
+	for _, dir := range []string{serviceDir, dataDir} {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, err
+		}
+		if err := os.Chmod(dir, 0o700); err != nil {
+			return nil, err
+		}
+	}
+	// Tor derives the public key and hostname files from the secret key again
+	os.Remove(filepath.Join(serviceDir, "hs_ed25519_public_key"))
+	os.Remove(filepath.Join(serviceDir, "hostname"))
+	if err := os.WriteFile(filepath.Join(serviceDir, "hs_ed25519_secret_key"), secretKey, 0o600); err != nil {
+		return nil, common.NewErrorf("Failed to write onion service key: %v", err)
+	}
+
+	target := p.opts.Address
+	if p.opts.Socket != "" {
+		target = "unix:" + p.opts.Socket
+	}
+	port := 80
+	if p.opts.Scheme == "https" {
+		port = 443
+	}
+	torrc := strings.Join([]string{
+		"DataDirectory " + dataDir,
+		"SocksPort 0",
+		"Log notice stdout",
+		"HiddenServiceDir " + serviceDir,
+		fmt.Sprintf("HiddenServicePort %d %s", port, target),
+	}, "\n") + "\n"
+	configPath := filepath.Join(folder, "torrc")
+	if err := os.WriteFile(configPath, []byte(torrc), 0o600); err != nil {
+		return nil, common.NewErrorf("Failed to write configuration file: %v", err)
+	}
+	return exec.Command(GetBinaryPath(Tor), "-f", configPath), nil
+}
+
+// Stop terminates the running tunnel process and waits a few seconds for it to exit, so a new
+// one can take over its files.
+func (p *Process) Stop() error {
+	if !p.IsRunning() {
+		return errors.New("tunnel is not running")
+	}
+	var err error
+	if runtime.GOOS == "windows" {
+		err = p.cmd.Process.Kill()
+	} else {
+		err = p.cmd.Process.Signal(syscall.SIGTERM)
+	}
+	if err != nil {
+		return err
+	}
+	select {
+	case <-p.done:
+	case <-time.After(5 * time.Second):
+		logger.Warning("Timed out waiting for the tunnel to stop")
+	}
+	return nil
+}
+
+// logWriter forwards the output of cloudflared and tor to the panel log and picks up the
+// hostname of quick tunnels from it.
+type logWriter struct {
+	process *Process
+}
+
+func (w logWriter) Write(m []byte) (int, error) {
+	for line := range strings.SplitSeq(strings.TrimSpace(string(m)), "\n") {
+		if match := quickTunnelHostname.FindStringSubmatch(line); match != nil {
+			w.process.lock.Lock()
+			w.process.hostname = match[1]
+			w.process.lock.Unlock()
+		}
+		if strings.Contains(line, " ERR ") || strings.Contains(line, "[err]") || strings.Contains(line, "[warn]") {
+			logger.Warning("TUNNEL: " + line)
+		} else if line != "" {
+			logger.Debug("TUNNEL: " + line)
+		}
+	}
+	return len(m), nil
+}
@@ -0,0 +1,78 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error codes returned in the code field of failed API responses. They are stable and
+// can be used by automation instead of matching the localized message. Each code has a
+// translated description under the errors.<CODE> translation key.
+const (
+	ErrCodeInternal             = "INTERNAL_ERROR"          // Unclassified failure
+	ErrCodeInvalidRequest       = "INVALID_REQUEST"         // The request body or parameters could not be parsed or are invalid
+	ErrCodeUnauthorized         = "UNAUTHORIZED"            // The session expired or no valid credentials were sent
+	ErrCodeInvalidCredentials   = "INVALID_CREDENTIALS"     // Wrong username, password or two-factor code
+	ErrCodeNotFound             = "NOT_FOUND"               // The requested record does not exist
+	ErrCodeReadOnly             = "READ_ONLY"               // The panel is in read-only mode
+	ErrCodeApiVersion           = "UNSUPPORTED_API_VERSION" // The X-API-Version request header names a version the route does not serve
+	ErrCodeValidation           = "VALIDATION_FAILED"       // The request was understood but a value failed validation
+	ErrCodeSettingInvalid       = "SETTING_INVALID"         // A setting value failed validation
+	ErrCodeInboundNotFound      = "INBOUND_NOT_FOUND"       // No inbound with the given ID, tag or client
+	ErrCodeInboundPortInUse     = "INBOUND_PORT_IN_USE"     // Another inbound listens on the same port
+	ErrCodeClientNotFound       = "CLIENT_NOT_FOUND"        // No client with the given email or ID
+	ErrCodeClientEmailDuplicate = "CLIENT_EMAIL_DUPLICATE"  // A client with the same email already exists
+	ErrCodeClientIdEmpty        = "CLIENT_ID_EMPTY"         // A client is missing its ID, password or email
+	ErrCodeClientLastRemaining  = "CLIENT_LAST_REMAINING"   // The last client of an inbound cannot be removed
+	ErrCodeApprovalDecided      = "APPROVAL_DECIDED"        // The approval request was already approved, rejected or expired
+	ErrCodeApprovalSameAdmin    = "APPROVAL_SAME_ADMIN"     // The admin who made an approval request cannot approve it
+	ErrCodeForbidden            = "FORBIDDEN"               // The route is reserved for the super admin
+)
+
+// CodeError is an error carrying a stable error code and optional structured details.
+type CodeError struct {
+	Code    string
+	Details map[string]any
+	err     error
+}
+
+// Error returns the error message.
+func (e *CodeError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *CodeError) Unwrap() error {
+	return e.err
+}
+
+// NewCodeError creates a new error with an error code and details from the given arguments.
+func NewCodeError(code string, details map[string]any, a ...any) error {
+	return &CodeError{Code: code, Details: details, err: NewError(a...)}
+}
+
+// NewCodeErrorf creates a new error with an error code and a formatted message.
+func NewCodeErrorf(code string, format string, a ...any) error {
+	return &CodeError{Code: code, err: fmt.Errorf(format, a...)}
+}
+
+// WithCode attaches an error code to an existing error, keeping a code it already has.
+func WithCode(code string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var codeErr *CodeError
+	if errors.As(err, &codeErr) {
+		return err
+	}
+	return &CodeError{Code: code, err: err}
+}
+
+// GetErrorCode returns the code and details of an error, or ErrCodeInternal when it has none.
+func GetErrorCode(err error) (string, map[string]any) {
+	var codeErr *CodeError
+	if errors.As(err, &codeErr) {
+		return codeErr.Code, codeErr.Details
+	}
+	return ErrCodeInternal, nil
+}
@@ -2,9 +2,16 @@
 package crypto
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
+// ApiKeyHashPrefix marks an API key hashed with HashApiKey.
+const ApiKeyHashPrefix = "sha256:"
+
 // HashPasswordAsBcrypt generates a bcrypt hash of the given password.
 func HashPasswordAsBcrypt(password string) (string, error) {
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -16,3 +23,15 @@ func CheckPasswordHash(hash, password string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
+
+// HashApiKey returns the SHA-256 hash of an API key. API keys are long random strings, so an
+// unsalted hash is enough and keys can still be looked up by their hash.
+func HashApiKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return ApiKeyHashPrefix + hex.EncodeToString(sum[:])
+}
+
+// IsHashedApiKey reports whether the value was hashed with HashApiKey.
+func IsHashedApiKey(value string) bool {
+	return strings.HasPrefix(value, ApiKeyHashPrefix)
+}
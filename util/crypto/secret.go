@@ -0,0 +1,96 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SecretPrefix marks a value encrypted with EncryptSecret.
+const SecretPrefix = "enc:v1:"
+
+// SecretKeySize is the size of the AES-256 key used for secrets.
+const SecretKeySize = 32
+
+// IsEncryptedSecret reports whether the value was encrypted with EncryptSecret.
+func IsEncryptedSecret(value string) bool {
+	return strings.HasPrefix(value, SecretPrefix)
+}
+
+// EncryptSecret encrypts the value with AES-256-GCM. Empty and already encrypted values are returned unchanged.
+func EncryptSecret(key []byte, value string) (string, error) {
+	if value == "" || IsEncryptedSecret(value) {
+		return value, nil
+	}
+	aead, err := newSecretCipher(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), nil)
+	return SecretPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptSecret decrypts a value encrypted with EncryptSecret. Plaintext values are returned unchanged.
+func DecryptSecret(key []byte, value string) (string, error) {
+	if !IsEncryptedSecret(value) {
+		return value, nil
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(value, SecretPrefix))
+	if err != nil {
+		return "", err
+	}
+	aead, err := newSecretCipher(key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("encrypted secret is too short")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("encrypted secret could not be decrypted, the key may have changed")
+	}
+	return string(plain), nil
+}
+
+// LoadOrCreateSecretKey reads the secret key from the file, creating the file with a new random key when it does not exist.
+func LoadOrCreateSecretKey(path string) ([]byte, error) {
+	key, err := os.ReadFile(path)
+	if err == nil {
+		if len(key) != SecretKeySize {
+			return nil, errors.New("secret key file " + path + " has an invalid size")
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	key = make([]byte, SecretKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, key, 0o600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func newSecretCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
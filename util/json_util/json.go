@@ -2,6 +2,7 @@
 package json_util
 
 import (
+	"encoding/json"
 	"errors"
 )
 
@@ -25,3 +26,36 @@ func (m *RawMessage) UnmarshalJSON(data []byte) error {
 	*m = append((*m)[0:0], data...)
 	return nil
 }
+
+// Merge deep-merges the JSON object patch into the JSON object base. Nested objects are merged
+// key by key, other values of patch replace those of base and null removes a key.
+func Merge(base, patch []byte) ([]byte, error) {
+	var dst, src map[string]any
+	if err := json.Unmarshal(base, &dst); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &src); err != nil {
+		return nil, err
+	}
+	if dst == nil {
+		dst = map[string]any{}
+	}
+	mergeObjects(dst, src)
+	return json.Marshal(dst)
+}
+
+func mergeObjects(dst, src map[string]any) {
+	for key, value := range src {
+		if value == nil {
+			delete(dst, key)
+			continue
+		}
+		from, ok := value.(map[string]any)
+		to, isObject := dst[key].(map[string]any)
+		if ok && isObject {
+			mergeObjects(to, from)
+			continue
+		}
+		dst[key] = value
+	}
+}
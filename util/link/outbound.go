@@ -0,0 +1,235 @@
+package link
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+)
+
+// ClientOutbound is an Xray outbound connecting to an inbound as one of its clients, with the
+// remark its share link has.
+type ClientOutbound struct {
+	Remark   string         `json:"remark"`
+	Outbound map[string]any `json:"outbound"`
+	Config   map[string]any `json:"config,omitempty"` // Complete client config around the outbound, when asked for
+}
+
+// vnextServer is a server of vmess outbound settings.
+type vnextServer struct {
+	Address string      `json:"address"`
+	Port    int         `json:"port"`
+	Users   []vnextUser `json:"users"`
+}
+
+// vnextUser is a user of a vmess outbound server.
+type vnextUser struct {
+	ID       string `json:"id"`
+	Email    string `json:"email,omitempty"`
+	Security string `json:"security,omitempty"`
+}
+
+// outboundServer is a server of trojan and shadowsocks outbound settings.
+type outboundServer struct {
+	Password string `json:"password"`
+	Level    int    `json:"level"`
+	Address  string `json:"address"`
+	Port     int    `json:"port"`
+	Flow     string `json:"flow,omitempty"`
+	Method   string `json:"method,omitempty"`
+}
+
+// ClientStream turns the parsed stream settings of an inbound into those of an outbound
+// connecting to it. TLS and REALITY settings keep what clients need, with the REALITY server
+// name, short ID and spiderX picked like in links, and server-only options are dropped. External
+// proxies are left for the caller.
+func ClientStream(stream map[string]any, opts Options) map[string]any {
+	switch getString(stream, "security") {
+	case "tls":
+		stream["tlsSettings"] = clientTLS(getObject(stream, "tlsSettings"))
+	case "reality":
+		stream["realitySettings"] = clientReality(getObject(stream, "realitySettings"), opts)
+	}
+	delete(stream, "sockopt")
+
+	switch network := getString(stream, "network"); network {
+	case "tcp", "ws", "httpupgrade":
+		if settings := getObject(stream, network+"Settings"); settings != nil {
+			delete(settings, "acceptProxyProtocol")
+		}
+	case "xhttp":
+		// Client options and the extra object, including a downloadSettings split, are kept
+		if settings := getObject(stream, "xhttpSettings"); settings != nil {
+			delete(settings, "noSSEHeader")
+			delete(settings, "scMaxBufferedPosts")
+			delete(settings, "scStreamUpServerSecs")
+		}
+	}
+	return stream
+}
+
+// clientTLS returns the TLS settings of a client of an inbound with the TLS settings.
+func clientTLS(tlsSettings map[string]any) map[string]any {
+	settings := getObject(tlsSettings, "settings")
+	client := map[string]any{
+		"serverName": tlsSettings["serverName"],
+		"alpn":       tlsSettings["alpn"],
+	}
+	if allowInsecure, ok := settings["allowInsecure"].(bool); ok {
+		client["allowInsecure"] = allowInsecure
+	}
+	if fingerprint, ok := settings["fingerprint"].(string); ok {
+		client["fingerprint"] = fingerprint
+	}
+	return client
+}
+
+// clientReality returns the REALITY settings of a client of an inbound with the REALITY settings.
+func clientReality(realitySettings map[string]any, opts Options) map[string]any {
+	settings := getObject(realitySettings, "settings")
+	shortIds := realitySettings["shortIds"]
+	serverNames := realitySettings["serverNames"]
+	return map[string]any{
+		"show":          false,
+		"publicKey":     settings["publicKey"],
+		"fingerprint":   settings["fingerprint"],
+		"mldsa65Verify": settings["mldsa65Verify"],
+		"spiderX":       opts.SpiderX(),
+		"shortId":       pickString(shortIds, opts.Index(listLen(shortIds), "shortId")),
+		"serverName":    pickString(serverNames, opts.Index(listLen(serverNames), "serverName")),
+	}
+}
+
+// OutboundSettings returns the settings of an outbound connecting to the inbound at the address
+// and port as the client, or nil when the protocol has no client outbound.
+func OutboundSettings(inbound *model.Inbound, client model.Client, address string, port int) map[string]any {
+	inboundSettings := parseObject(inbound.Settings)
+	switch inbound.Protocol {
+	case model.VMESS:
+		return map[string]any{
+			"vnext": []vnextServer{{
+				Address: address,
+				Port:    port,
+				Users:   []vnextUser{{ID: client.ID, Email: client.Email, Security: client.Security}},
+			}},
+		}
+	case model.VLESS:
+		settings := map[string]any{"address": address, "port": port, "id": client.ID}
+		if client.Flow != "" {
+			settings["flow"] = client.Flow
+		}
+		if encryption, ok := inboundSettings["encryption"].(string); ok {
+			settings["encryption"] = encryption
+		}
+		return settings
+	case model.Trojan, model.Shadowsocks:
+		server := outboundServer{Address: address, Port: port, Level: 8, Password: client.Password}
+		if inbound.Protocol == model.Shadowsocks {
+			server.Method = getString(inboundSettings, "method")
+			// Multi-user 2022 methods take the server key along with the user key
+			if serverPassword, ok := inboundSettings["password"].(string); ok && strings.HasPrefix(server.Method, "2022") {
+				server.Password = fmt.Sprintf("%s:%s", serverPassword, client.Password)
+			}
+		}
+		return map[string]any{"servers": []outboundServer{server}}
+	}
+	return nil
+}
+
+// ClientOutbounds returns the outbounds connecting to the inbound as the client with the email,
+// one for each external proxy like the share links. Nil is returned when the protocol has no
+// client outbound or the client does not exist.
+func ClientOutbounds(inbound *model.Inbound, email string, opts Options) []ClientOutbound {
+	var settings struct {
+		Clients []model.Client `json:"clients"`
+	}
+	if err := json.Unmarshal([]byte(inbound.Settings), &settings); err != nil {
+		return nil
+	}
+	var client *model.Client
+	for i := range settings.Clients {
+		if settings.Clients[i].Email == email {
+			client = &settings.Clients[i]
+			break
+		}
+	}
+	if client == nil {
+		return nil
+	}
+
+	stream := ClientStream(parseObject(inbound.StreamSettings), opts)
+	proxies := linkProxies(inbound, stream, opts.port(inbound))
+	if len(proxies) == 0 {
+		proxies = []externalProxy{{ForceTls: "same", Dest: opts.Address, Port: opts.port(inbound)}}
+	}
+	delete(stream, "externalProxy")
+
+	var outbounds []ClientOutbound
+	for _, ep := range proxies {
+		proxySettings := OutboundSettings(inbound, *client, ep.Dest, ep.Port)
+		if proxySettings == nil {
+			return nil
+		}
+		proxyStream := make(map[string]any, len(stream))
+		for key, value := range stream {
+			proxyStream[key] = value
+		}
+		switch ep.ForceTls {
+		case "tls":
+			if proxyStream["security"] != "tls" {
+				proxyStream["security"] = "tls"
+				proxyStream["tlsSettings"] = map[string]any{}
+			}
+		case "none":
+			proxyStream["security"] = "none"
+			delete(proxyStream, "tlsSettings")
+		}
+		if client.Fingerprint != "" {
+			for _, key := range []string{"tlsSettings", "realitySettings"} {
+				if security, ok := proxyStream[key].(map[string]any); ok {
+					security["fingerprint"] = client.Fingerprint
+				}
+			}
+		}
+		outbounds = append(outbounds, ClientOutbound{
+			Remark: opts.remark(inbound, email, ep.Remark),
+			Outbound: map[string]any{
+				"tag":            "proxy",
+				"protocol":       string(inbound.Protocol),
+				"settings":       proxySettings,
+				"streamSettings": proxyStream,
+			},
+		})
+	}
+	return outbounds
+}
+
+// ClientConfig returns a minimal Xray client config around the outbound: a mixed proxy on
+// 127.0.0.1:10808 routing everything through the outbound, with private addresses going direct.
+func ClientConfig(outbound map[string]any, remark string) map[string]any {
+	return map[string]any{
+		"remarks": remark,
+		"log":     map[string]any{"loglevel": "warning"},
+		"inbounds": []any{map[string]any{
+			"tag":      "mixed",
+			"listen":   "127.0.0.1",
+			"port":     10808,
+			"protocol": "mixed",
+			"settings": map[string]any{"auth": "noauth", "udp": true},
+			"sniffing": map[string]any{"enabled": true, "destOverride": []string{"http", "tls", "quic"}},
+		}},
+		"outbounds": []any{
+			outbound,
+			map[string]any{"tag": "direct", "protocol": "freedom"},
+			map[string]any{"tag": "block", "protocol": "blackhole"},
+		},
+		"routing": map[string]any{
+			"domainStrategy": "AsIs",
+			"rules": []any{
+				map[string]any{"type": "field", "ip": []string{"geoip:private"}, "outboundTag": "direct"},
+				map[string]any{"type": "field", "network": "tcp,udp", "outboundTag": "proxy"},
+			},
+		},
+	}
+}
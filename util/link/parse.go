@@ -0,0 +1,187 @@
+package link
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ParseOutbound converts a vless://, trojan:// or ss:// share link into an Xray outbound
+// without a tag. The remark of the link is returned alongside.
+func ParseOutbound(shareLink string) (map[string]any, string, error) {
+	shareLink = strings.TrimSpace(shareLink)
+	scheme, _, _ := strings.Cut(shareLink, "://")
+	if scheme == "ss" {
+		shareLink = normalizeShadowsocks(shareLink)
+	}
+	u, err := url.Parse(shareLink)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid link: %w", err)
+	}
+	address := u.Hostname()
+	port, err := strconv.Atoi(u.Port())
+	if address == "" || err != nil || port < 1 || port > 65535 {
+		return nil, "", fmt.Errorf("invalid link address %q", u.Host)
+	}
+	q := u.Query()
+
+	outbound := map[string]any{}
+	switch u.Scheme {
+	case "vless":
+		id := u.User.Username()
+		if id == "" {
+			return nil, "", fmt.Errorf("vless link without id")
+		}
+		user := map[string]any{"id": id, "encryption": "none"}
+		if encryption := q.Get("encryption"); encryption != "" {
+			user["encryption"] = encryption
+		}
+		if flow := q.Get("flow"); flow != "" {
+			user["flow"] = flow
+		}
+		outbound["protocol"] = "vless"
+		outbound["settings"] = map[string]any{
+			"vnext": []any{map[string]any{"address": address, "port": port, "users": []any{user}}},
+		}
+	case "trojan":
+		password := u.User.Username()
+		if password == "" {
+			return nil, "", fmt.Errorf("trojan link without password")
+		}
+		outbound["protocol"] = "trojan"
+		outbound["settings"] = map[string]any{
+			"servers": []any{map[string]any{"address": address, "port": port, "password": password}},
+		}
+	case "ss":
+		method, password, ok := shadowsocksUser(u.User)
+		if !ok {
+			return nil, "", fmt.Errorf("shadowsocks link without method and password")
+		}
+		outbound["protocol"] = "shadowsocks"
+		outbound["settings"] = map[string]any{
+			"servers": []any{map[string]any{"address": address, "port": port, "method": method, "password": password}},
+		}
+	default:
+		return nil, "", fmt.Errorf("unsupported link scheme %q", u.Scheme)
+	}
+	outbound["streamSettings"] = streamFromParams(q)
+	return outbound, u.Fragment, nil
+}
+
+// normalizeShadowsocks rewrites the legacy ss://BASE64(method:password@host:port)#remark form
+// into the SIP002 form the rest of the parser understands.
+func normalizeShadowsocks(shareLink string) string {
+	body := strings.TrimPrefix(shareLink, "ss://")
+	body, fragment, hasFragment := strings.Cut(body, "#")
+	if strings.Contains(body, "@") {
+		return shareLink
+	}
+	decoded, ok := DecodeBase64(body)
+	if !ok {
+		return shareLink
+	}
+	userInfo, hostPort, ok := strings.Cut(decoded, "@")
+	if !ok {
+		return shareLink
+	}
+	shareLink = "ss://" + base64.RawURLEncoding.EncodeToString([]byte(userInfo)) + "@" + hostPort
+	if hasFragment {
+		shareLink += "#" + fragment
+	}
+	return shareLink
+}
+
+// shadowsocksUser extracts the method and password of a SIP002 user info, which is either
+// base64 of method:password or, for 2022 methods, the percent-encoded pair.
+func shadowsocksUser(user *url.Userinfo) (string, string, bool) {
+	if user == nil {
+		return "", "", false
+	}
+	if password, ok := user.Password(); ok {
+		return user.Username(), password, user.Username() != ""
+	}
+	decoded, ok := DecodeBase64(user.Username())
+	if !ok {
+		return "", "", false
+	}
+	method, password, ok := strings.Cut(decoded, ":")
+	return method, password, ok && method != ""
+}
+
+// DecodeBase64 decodes standard or URL-safe base64 with or without padding, as found in
+// share links and subscriptions.
+func DecodeBase64(s string) (string, bool) {
+	s = strings.TrimRight(s, "=")
+	for _, encoding := range []*base64.Encoding{base64.RawURLEncoding, base64.RawStdEncoding} {
+		if data, err := encoding.DecodeString(s); err == nil {
+			return string(data), true
+		}
+	}
+	return "", false
+}
+
+// streamFromParams builds the stream settings of an outbound from the query of a share link.
+func streamFromParams(q url.Values) map[string]any {
+	network := q.Get("type")
+	if network == "" || network == "raw" {
+		network = "tcp"
+	}
+	stream := map[string]any{"network": network}
+	path, host := q.Get("path"), q.Get("host")
+	switch network {
+	case "tcp":
+		if q.Get("headerType") == "http" {
+			request := map[string]any{"path": []any{orDefault(path, "/")}}
+			if host != "" {
+				request["headers"] = map[string]any{"Host": strings.Split(host, ",")}
+			}
+			stream["tcpSettings"] = map[string]any{"header": map[string]any{"type": "http", "request": request}}
+		}
+	case "ws":
+		stream["wsSettings"] = map[string]any{"path": orDefault(path, "/"), "host": host}
+	case "httpupgrade":
+		stream["httpupgradeSettings"] = map[string]any{"path": orDefault(path, "/"), "host": host}
+	case "xhttp":
+		stream["xhttpSettings"] = map[string]any{"path": orDefault(path, "/"), "host": host, "mode": orDefault(q.Get("mode"), "auto")}
+	case "grpc":
+		stream["grpcSettings"] = map[string]any{"serviceName": q.Get("serviceName"), "multiMode": q.Get("mode") == "multi"}
+	case "kcp":
+		kcp := map[string]any{"header": map[string]any{"type": orDefault(q.Get("headerType"), "none")}}
+		if seed := q.Get("seed"); seed != "" {
+			kcp["seed"] = seed
+		}
+		stream["kcpSettings"] = kcp
+	}
+
+	security := orDefault(q.Get("security"), "none")
+	stream["security"] = security
+	switch security {
+	case "tls":
+		tls := map[string]any{"serverName": q.Get("sni"), "fingerprint": q.Get("fp")}
+		if alpn := q.Get("alpn"); alpn != "" {
+			tls["alpn"] = strings.Split(alpn, ",")
+		}
+		if q.Get("allowInsecure") == "1" || q.Get("allowInsecure") == "true" {
+			tls["allowInsecure"] = true
+		}
+		stream["tlsSettings"] = tls
+	case "reality":
+		stream["realitySettings"] = map[string]any{
+			"serverName":  q.Get("sni"),
+			"fingerprint": orDefault(q.Get("fp"), "chrome"),
+			"publicKey":   q.Get("pbk"),
+			"shortId":     q.Get("sid"),
+			"spiderX":     q.Get("spx"),
+		}
+	}
+	return stream
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
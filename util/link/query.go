@@ -0,0 +1,71 @@
+package link
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+)
+
+// QueryOptions holds the link options a subscription or API request sets with query parameters:
+//
+//	stats=1|0        append remaining traffic and time to model remarks, or leave them out
+//	deterministic=1  use the first REALITY server name and short ID and a fixed spiderX
+//	label=TEMPLATE   remark template for all links, e.g. "{remark} {email}[ {days}d]"
+//	port=N           port of links to the server itself, external proxies keep their own
+type QueryOptions struct {
+	Stats         *bool  // Overrides RemarkOptions.ShowInfo when set
+	Deterministic bool   // Pick server names and short IDs deterministically
+	Label         string // Remark template overriding all others
+	Port          int    // Port override, 0 keeps the inbound port
+}
+
+// ParseQuery reads the link options of a request from its query parameters.
+func ParseQuery(query url.Values) (QueryOptions, error) {
+	var q QueryOptions
+	if value := query.Get("stats"); value != "" {
+		stats, err := strconv.ParseBool(value)
+		if err != nil {
+			return q, common.NewCodeError(common.ErrCodeValidation, nil, "invalid stats parameter:", value)
+		}
+		q.Stats = &stats
+	}
+	if value := query.Get("deterministic"); value != "" {
+		deterministic, err := strconv.ParseBool(value)
+		if err != nil {
+			return q, common.NewCodeError(common.ErrCodeValidation, nil, "invalid deterministic parameter:", value)
+		}
+		q.Deterministic = deterministic
+	}
+	q.Label = strings.TrimSpace(query.Get("label"))
+	if value := query.Get("port"); value != "" {
+		port, err := strconv.Atoi(value)
+		if err != nil || port <= 0 || port > 65535 {
+			return q, common.NewCodeError(common.ErrCodeValidation, nil, "invalid port parameter:", value)
+		}
+		q.Port = port
+	}
+	return q, nil
+}
+
+// Remark returns the remark options with the requested stats and label applied.
+func (q QueryOptions) Remark(opts RemarkOptions) RemarkOptions {
+	if q.Stats != nil {
+		opts.ShowInfo = *q.Stats
+	}
+	if q.Label != "" {
+		opts.Label = q.Label
+	}
+	return opts
+}
+
+// Apply returns the options generating links to the address with the requested options.
+func (q QueryOptions) Apply(address string, remark RemarkOptions) Options {
+	return Options{
+		Address:       address,
+		Remark:        q.Remark(remark).Func(),
+		Port:          q.Port,
+		Deterministic: q.Deterministic,
+	}
+}
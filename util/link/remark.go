@@ -0,0 +1,226 @@
+package link
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/xray"
+)
+
+// DefaultRemarkModel is the legacy remark model: "-" separator, then inbound remark, email and external proxy remark.
+const DefaultRemarkModel = "-ieo"
+
+// RemarkOptions controls how link remarks are built.
+//
+// Template takes precedence over Model. A template is plain text with {placeholders}:
+//
+//	{remark} {email} {extra} {status} {traffic} {used} {total} {up} {down} {days} {expiry}
+//
+// Text wrapped in [brackets] is only kept when every placeholder inside it is non-empty,
+// e.g. "{remark}[-{email}][-{traffic}][-{days}d]".
+type RemarkOptions struct {
+	Model    string // Separator followed by order chars: i (inbound remark), e (email), o (external proxy remark)
+	Template string // Remark template, overrides Model when set
+	ShowInfo bool   // Append remaining traffic and time when using Model
+	Label    string // Template requested for a single request, overrides the inbound's and the configured one
+	Emoji    bool   // Decorate status, traffic and time with emoji
+}
+
+// Func returns a RemarkFunc that builds remarks with these options.
+// An inbound's own remark template overrides the configured one.
+func (o RemarkOptions) Func() RemarkFunc {
+	return func(inbound *model.Inbound, email string, extra string) string {
+		return BuildRemark(inbound, email, extra, o)
+	}
+}
+
+// BuildRemark builds the remark of a client link.
+func BuildRemark(inbound *model.Inbound, email string, extra string, opts RemarkOptions) string {
+	stats, statsExist := clientStats(inbound, email)
+	template := opts.Template
+	if inbound.RemarkTemplate != "" {
+		template = inbound.RemarkTemplate
+	}
+	if opts.Label != "" {
+		template = opts.Label
+	}
+	if template != "" {
+		values := remarkValues(inbound, email, extra, stats, statsExist, opts.Emoji)
+		return RenderRemark(template, values)
+	}
+	return modelRemark(inbound, email, extra, stats, statsExist, opts)
+}
+
+// RenderRemark substitutes {placeholders} in template with values.
+// Bracketed sections are dropped when any placeholder inside them is empty; unknown placeholders are kept as-is.
+func RenderRemark(template string, values map[string]string) string {
+	var out, section strings.Builder
+	inSection, sectionEmpty := false, false
+	write := func(s string) {
+		if inSection {
+			section.WriteString(s)
+		} else {
+			out.WriteString(s)
+		}
+	}
+	for i := 0; i < len(template); i++ {
+		switch c := template[i]; c {
+		case '[':
+			if !inSection {
+				inSection, sectionEmpty = true, false
+				section.Reset()
+				continue
+			}
+		case ']':
+			if inSection {
+				if !sectionEmpty {
+					out.WriteString(section.String())
+				}
+				inSection = false
+				continue
+			}
+		case '{':
+			if end := strings.IndexByte(template[i:], '}'); end > 0 {
+				name := template[i+1 : i+end]
+				if value, ok := values[name]; ok {
+					if value == "" {
+						sectionEmpty = true
+					}
+					write(value)
+					i += end
+					continue
+				}
+			}
+		}
+		write(template[i : i+1])
+	}
+	// An unterminated section is treated as plain text
+	if inSection && !sectionEmpty {
+		out.WriteString(section.String())
+	}
+	return strings.TrimSpace(out.String())
+}
+
+func clientStats(inbound *model.Inbound, email string) (xray.ClientTraffic, bool) {
+	for _, clientStat := range inbound.ClientStats {
+		if clientStat.Email == email {
+			return clientStat, true
+		}
+	}
+	return xray.ClientTraffic{}, false
+}
+
+// remarkValues returns the template values for a client. Values that do not apply are empty.
+func remarkValues(inbound *model.Inbound, email string, extra string, stats xray.ClientTraffic, statsExist bool, emoji bool) map[string]string {
+	values := map[string]string{
+		"remark":  inbound.Remark,
+		"email":   email,
+		"extra":   extra,
+		"status":  "",
+		"traffic": "",
+		"used":    "",
+		"total":   "",
+		"up":      "",
+		"down":    "",
+		"days":    "",
+		"expiry":  "",
+	}
+	if !statsExist {
+		return values
+	}
+	if !stats.Enable {
+		values["status"] = "N/A"
+		if emoji {
+			values["status"] = "⛔️N/A"
+		}
+	}
+	values["used"] = common.FormatTraffic(stats.Up + stats.Down)
+	values["up"] = common.FormatTraffic(stats.Up)
+	values["down"] = common.FormatTraffic(stats.Down)
+	if stats.Total > 0 {
+		values["total"] = common.FormatTraffic(stats.Total)
+		if vol := stats.Total - (stats.Up + stats.Down); vol > 0 {
+			values["traffic"] = common.FormatTraffic(vol)
+		}
+	}
+	if remaining, ok := remainingSeconds(stats.ExpiryTime); ok {
+		values["days"] = strconv.FormatInt(remaining/86400, 10)
+		values["expiry"] = formatRemaining(remaining)
+	}
+	return values
+}
+
+// remainingSeconds returns the time left for an expiry in milliseconds.
+// Negative expiry times mean the countdown starts on first use and hold the full duration.
+func remainingSeconds(expiryTime int64) (int64, bool) {
+	switch exp := expiryTime / 1000; {
+	case exp > 0:
+		return exp - time.Now().Unix(), true
+	case exp < 0:
+		return -exp, true
+	}
+	return 0, false
+}
+
+func formatRemaining(seconds int64) string {
+	days := seconds / 86400
+	hours := (seconds % 86400) / 3600
+	minutes := (seconds % 3600) / 60
+	if days > 0 {
+		if hours > 0 {
+			return fmt.Sprintf("%dD,%dH", days, hours)
+		}
+		return fmt.Sprintf("%dD", days)
+	} else if hours > 0 {
+		return fmt.Sprintf("%dH", hours)
+	}
+	return fmt.Sprintf("%dM", minutes)
+}
+
+// modelRemark builds a remark from the legacy remark model, optionally followed by usage info.
+func modelRemark(inbound *model.Inbound, email string, extra string, stats xray.ClientTraffic, statsExist bool, opts RemarkOptions) string {
+	remarkModel := opts.Model
+	if len(remarkModel) < 2 {
+		remarkModel = DefaultRemarkModel
+	}
+	separationChar := remarkModel[:1]
+	orders := map[byte]string{
+		'i': inbound.Remark,
+		'e': email,
+		'o': extra,
+	}
+
+	var remark []string
+	for i := 1; i < len(remarkModel); i++ {
+		if order := orders[remarkModel[i]]; order != "" {
+			remark = append(remark, order)
+		}
+	}
+
+	if opts.ShowInfo && statsExist {
+		decorate := func(s, icon string) string {
+			if opts.Emoji {
+				return s + icon
+			}
+			return s
+		}
+		if !stats.Enable {
+			status := "N/A"
+			if opts.Emoji {
+				status = "⛔️N/A"
+			}
+			return strings.Join(append([]string{status}, remark...), separationChar)
+		}
+		if vol := stats.Total - (stats.Up + stats.Down); vol > 0 {
+			remark = append(remark, decorate(common.FormatTraffic(vol), "📊"))
+		}
+		if remaining, ok := remainingSeconds(stats.ExpiryTime); ok {
+			remark = append(remark, decorate(formatRemaining(remaining), "⏳"))
+		}
+	}
+	return strings.Join(remark, separationChar)
+}
@@ -0,0 +1,92 @@
+// Package redis connects the panel to the Redis server its replicas share sessions and
+// short-lived state through, using the connection pool of the redigo client.
+package redis
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/config"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	// dialTimeout bounds connecting to Redis and every command round trip.
+	dialTimeout = 5 * time.Second
+	// poolMaxIdle and poolMaxActive bound the idle and open connections of a pool.
+	poolMaxIdle   = 8
+	poolMaxActive = 64
+	// poolIdleTimeout closes connections idle for longer.
+	poolIdleTimeout = 5 * time.Minute
+	// poolCheckIdle pings connections idle for longer before they are reused.
+	poolCheckIdle = time.Minute
+)
+
+var (
+	sharedOnce sync.Once
+	sharedPool *redis.Pool
+	sharedErr  error
+)
+
+// NewPool creates a connection pool from a URL of the form redis://[[user]:password@]host[:port][/db],
+// or rediss:// for TLS.
+func NewPool(rawURL string) (*redis.Pool, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("redis: unsupported scheme %q", u.Scheme)
+	}
+	return &redis.Pool{
+		MaxIdle:     poolMaxIdle,
+		MaxActive:   poolMaxActive,
+		IdleTimeout: poolIdleTimeout,
+		Wait:        true,
+		Dial: func() (redis.Conn, error) {
+			return redis.DialURL(rawURL,
+				redis.DialConnectTimeout(dialTimeout),
+				redis.DialReadTimeout(dialTimeout),
+				redis.DialWriteTimeout(dialTimeout))
+		},
+		TestOnBorrow: func(c redis.Conn, lastUsed time.Time) error {
+			if time.Since(lastUsed) < poolCheckIdle {
+				return nil
+			}
+			_, err := c.Do("PING")
+			return err
+		},
+	}, nil
+}
+
+// Ping checks that Redis can be reached through the pool.
+func Ping(pool *redis.Pool) error {
+	conn := pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("PING")
+	return err
+}
+
+// Shared returns the pool of the Redis server set by XUI_SESSION_REDIS, or nil when none is set.
+// The pool is created and checked on first use.
+func Shared() (*redis.Pool, error) {
+	sharedOnce.Do(func() {
+		redisURL := config.GetSessionRedisURL()
+		if redisURL == "" {
+			return
+		}
+		pool, err := NewPool(redisURL)
+		if err == nil {
+			err = Ping(pool)
+		}
+		if err != nil {
+			sharedErr = err
+			return
+		}
+		sharedPool = pool
+	})
+	return sharedPool, sharedErr
+}
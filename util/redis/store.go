@@ -0,0 +1,187 @@
+package redis
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/logger"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	// storeKeyPrefix namespaces the keys of the shared store in a shared Redis database.
+	storeKeyPrefix = "x-ui:state:"
+	// storeUpdateRetries bounds the retries of an update that raced with another replica.
+	storeUpdateRetries = 10
+	// memoryCleanupInterval is how often expired entries of the memory store are dropped.
+	memoryCleanupInterval = time.Minute
+)
+
+// errUpdateConflict is returned when an update kept racing with updates of other replicas.
+var errUpdateConflict = errors.New("redis: key changed too often during update")
+
+// Store keeps short-lived state, like login codes and rate limit counters, that every panel
+// replica needs to see.
+type Store interface {
+	// Incr increments the counter at key, which expires window after its first increment, and
+	// returns the new count with the time left until the counter expires.
+	Incr(key string, window time.Duration) (int64, time.Duration, error)
+	// Update passes the value of key, nil when it does not exist, to fn and stores the value fn
+	// returns for the returned time, or deletes the key when fn returns a nil value. Nothing is
+	// changed when fn fails. Concurrent updates of a key see each other's result.
+	Update(key string, fn func(value []byte) ([]byte, time.Duration, error)) error
+}
+
+var (
+	storeOnce   sync.Once
+	sharedStore Store
+)
+
+// SharedStore returns the store in the Redis server set by XUI_SESSION_REDIS, or a store in process
+// memory when none is set or it can not be reached.
+func SharedStore() Store {
+	storeOnce.Do(func() {
+		pool, err := Shared()
+		if err != nil {
+			logger.Warning("Redis unavailable, keeping shared state in memory:", err)
+		}
+		if pool == nil {
+			sharedStore = newMemoryStore()
+			return
+		}
+		sharedStore = &poolStore{pool: pool}
+	})
+	return sharedStore
+}
+
+// poolStore keeps the state in Redis.
+type poolStore struct {
+	pool *redis.Pool
+}
+
+// incrScript increments a counter and starts its expiry on the first increment, in one step.
+var incrScript = redis.NewScript(1, `
+local count = redis.call('INCR', KEYS[1])
+if count == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return {count, redis.call('PTTL', KEYS[1])}`)
+
+func (s *poolStore) Incr(key string, window time.Duration) (int64, time.Duration, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+	reply, err := redis.Int64s(incrScript.Do(conn, storeKeyPrefix+key, window.Milliseconds()))
+	if err != nil {
+		return 0, 0, err
+	}
+	return reply[0], time.Duration(reply[1]) * time.Millisecond, nil
+}
+
+// Update reads and writes the key in a transaction watching it, retrying when another replica
+// changed the key in between.
+func (s *poolStore) Update(key string, fn func(value []byte) ([]byte, time.Duration, error)) error {
+	key = storeKeyPrefix + key
+	conn := s.pool.Get()
+	defer conn.Close()
+	for range storeUpdateRetries {
+		if _, err := conn.Do("WATCH", key); err != nil {
+			return err
+		}
+		value, err := redis.Bytes(conn.Do("GET", key))
+		if errors.Is(err, redis.ErrNil) {
+			value = nil
+		} else if err != nil {
+			conn.Do("UNWATCH")
+			return err
+		}
+		next, ttl, err := fn(value)
+		if err != nil {
+			conn.Do("UNWATCH")
+			return err
+		}
+		conn.Send("MULTI")
+		if next == nil {
+			conn.Send("DEL", key)
+		} else {
+			conn.Send("SET", key, next, "PX", max(ttl.Milliseconds(), 1))
+		}
+		reply, err := conn.Do("EXEC")
+		if err != nil {
+			return err
+		}
+		if reply != nil {
+			return nil
+		}
+	}
+	return errUpdateConflict
+}
+
+// memoryEntry is a value of the memory store with its expiry.
+type memoryEntry struct {
+	value     []byte
+	count     int64
+	expiresAt time.Time
+}
+
+// memoryStore keeps the state in process memory, for a panel running without replicas.
+type memoryStore struct {
+	lock        sync.Mutex
+	entries     map[string]*memoryEntry
+	lastCleanup time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{entries: map[string]*memoryEntry{}, lastCleanup: time.Now()}
+}
+
+// get returns the live entry of key, dropping expired entries now and then. The lock must be held.
+func (s *memoryStore) get(key string, now time.Time) *memoryEntry {
+	if now.Sub(s.lastCleanup) > memoryCleanupInterval {
+		for k, entry := range s.entries {
+			if now.After(entry.expiresAt) {
+				delete(s.entries, k)
+			}
+		}
+		s.lastCleanup = now
+	}
+	entry, ok := s.entries[key]
+	if !ok || now.After(entry.expiresAt) {
+		return nil
+	}
+	return entry
+}
+
+func (s *memoryStore) Incr(key string, window time.Duration) (int64, time.Duration, error) {
+	now := time.Now()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	entry := s.get(key, now)
+	if entry == nil {
+		entry = &memoryEntry{expiresAt: now.Add(window)}
+		s.entries[key] = entry
+	}
+	entry.count++
+	return entry.count, entry.expiresAt.Sub(now), nil
+}
+
+func (s *memoryStore) Update(key string, fn func(value []byte) ([]byte, time.Duration, error)) error {
+	now := time.Now()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var value []byte
+	if entry := s.get(key, now); entry != nil {
+		value = entry.value
+	}
+	next, ttl, err := fn(value)
+	if err != nil {
+		return err
+	}
+	if next == nil {
+		delete(s.entries, key)
+		return nil
+	}
+	s.entries[key] = &memoryEntry{value: next, expiresAt: now.Add(ttl)}
+	return nil
+}
@@ -8,6 +8,21 @@ class DBInbound {
         this.total = 0;
         this.allTime = 0;
         this.remark = "";
+        this.remarkTemplate = "";
+        this.group = "";
+        this.speedLimit = 0;
+        this.speedBurst = 0;
+        this.speedUnit = "";
+        this.connLimit = 0;
+        this.connLimitPerIp = 0;
+        this.portHopRange = "";
+        this.portHopInterval = 0;
+        this.portHopAt = 0;
+        this.extraPorts = "";
+        this.subPortMode = "";
+        this.subExclude = false;
+        this.extraListens = "";
+        this.extension = "";
         this.enable = true;
         this.expiryTime = 0;
         this.trafficReset = "never";
@@ -144,8 +159,8 @@ class DBInbound {
         }
     }
 
-    genInboundLinks(remarkModel) {
+    genInboundLinks(remarkModel, remarkTemplate = '') {
         const inbound = this.toInbound();
-        return inbound.genInboundLinks(this.remark, remarkModel);
+        return inbound.genInboundLinks(this.remark, remarkModel, this.remarkTemplate || remarkTemplate);
     }
 }
\ No newline at end of file
@@ -496,6 +496,8 @@ class xHTTPStreamSettings extends XrayCommonClass {
         noSSEHeader = false,
         xPaddingBytes = "100-1000",
         mode = MODE_OPTION.AUTO,
+        noGRPCHeader = false,
+        extra = '',
     ) {
         super();
         this.path = path;
@@ -507,6 +509,30 @@ class xHTTPStreamSettings extends XrayCommonClass {
         this.noSSEHeader = noSSEHeader;
         this.xPaddingBytes = xPaddingBytes;
         this.mode = mode;
+        this.noGRPCHeader = noGRPCHeader;
+        this.extra = extra;
+    }
+
+    // extraJson parses the extra text, keeping invalid input as-is so the server can reject it with a message.
+    get extraJson() {
+        if (ObjectUtil.isEmpty(this.extra)) return undefined;
+        try {
+            return JSON.parse(this.extra);
+        } catch (e) {
+            return this.extra;
+        }
+    }
+
+    // linkExtra returns the compact extra blob for share links: client side options that differ from
+    // the Xray defaults merged with the user supplied extra object.
+    linkExtra() {
+        const extra = {};
+        if (this.xPaddingBytes && this.xPaddingBytes !== "100-1000") extra.xPaddingBytes = this.xPaddingBytes;
+        if (this.noGRPCHeader) extra.noGRPCHeader = true;
+        if (this.scMaxEachPostBytes && this.scMaxEachPostBytes !== "1000000") extra.scMaxEachPostBytes = this.scMaxEachPostBytes;
+        const custom = this.extraJson;
+        if (custom && typeof custom === 'object' && !Array.isArray(custom)) Object.assign(extra, custom);
+        return Object.keys(extra).length > 0 ? JSON.stringify(extra) : '';
     }
 
     addHeader(name, value) {
@@ -528,6 +554,8 @@ class xHTTPStreamSettings extends XrayCommonClass {
             json.noSSEHeader,
             json.xPaddingBytes,
             json.mode,
+            json.noGRPCHeader,
+            json.extra ? JSON.stringify(json.extra, null, 2) : '',
         );
     }
 
@@ -542,6 +570,8 @@ class xHTTPStreamSettings extends XrayCommonClass {
             noSSEHeader: this.noSSEHeader,
             xPaddingBytes: this.xPaddingBytes,
             mode: this.mode,
+            noGRPCHeader: this.noGRPCHeader,
+            extra: this.extraJson,
         };
     }
 }
@@ -1225,7 +1255,7 @@ class Inbound extends XrayCommonClass {
         this.sniffing = new Sniffing();
     }
 
-    genVmessLink(address = '', port = this.port, forceTls, remark = '', clientId, security) {
+    genVmessLink(address = '', port = this.port, forceTls, remark = '', clientId, security, fingerprint = '') {
         if (this.protocol !== Protocols.VMESS) {
             return '';
         }
@@ -1279,8 +1309,9 @@ class Inbound extends XrayCommonClass {
             if (!ObjectUtil.isEmpty(this.stream.tls.sni)) {
                 obj.sni = this.stream.tls.sni;
             }
-            if (!ObjectUtil.isEmpty(this.stream.tls.settings.fingerprint)) {
-                obj.fp = this.stream.tls.settings.fingerprint;
+            const fp = fingerprint || this.stream.tls.settings.fingerprint;
+            if (!ObjectUtil.isEmpty(fp)) {
+                obj.fp = fp;
             }
             if (this.stream.tls.alpn.length > 0) {
                 obj.alpn = this.stream.tls.alpn.join(',');
@@ -1293,7 +1324,7 @@ class Inbound extends XrayCommonClass {
         return 'vmess://' + Base64.encode(JSON.stringify(obj, null, 2));
     }
 
-    genVLESSLink(address = '', port = this.port, forceTls, remark = '', clientId, flow) {
+    genVLESSLink(address = '', port = this.port, forceTls, remark = '', clientId, flow, fingerprint = '') {
         const uuid = clientId;
         const type = this.stream.network;
         const security = forceTls == 'same' ? this.stream.security : forceTls;
@@ -1342,13 +1373,17 @@ class Inbound extends XrayCommonClass {
                 params.set("path", xhttp.path);
                 params.set("host", xhttp.host?.length > 0 ? xhttp.host : this.getHeader(xhttp, 'host'));
                 params.set("mode", xhttp.mode);
+                const extra = xhttp.linkExtra();
+                if (extra.length > 0) {
+                    params.set("extra", extra);
+                }
                 break;
         }
 
         if (security === 'tls') {
             params.set("security", "tls");
             if (this.stream.isTls) {
-                params.set("fp", this.stream.tls.settings.fingerprint);
+                params.set("fp", fingerprint || this.stream.tls.settings.fingerprint);
                 params.set("alpn", this.stream.tls.alpn);
                 if (this.stream.tls.settings.allowInsecure) {
                     params.set("allowInsecure", "1");
@@ -1368,7 +1403,7 @@ class Inbound extends XrayCommonClass {
         else if (security === 'reality') {
             params.set("security", "reality");
             params.set("pbk", this.stream.reality.settings.publicKey);
-            params.set("fp", this.stream.reality.settings.fingerprint);
+            params.set("fp", fingerprint || this.stream.reality.settings.fingerprint);
             if (!ObjectUtil.isArrEmpty(this.stream.reality.serverNames)) {
                 params.set("sni", this.stream.reality.serverNames.split(",")[0]);
             }
@@ -1399,7 +1434,7 @@ class Inbound extends XrayCommonClass {
         return url.toString();
     }
 
-    genSSLink(address = '', port = this.port, forceTls, remark = '', clientPassword) {
+    genSSLink(address = '', port = this.port, forceTls, remark = '', clientPassword, fingerprint = '') {
         let settings = this.settings;
         const type = this.stream.network;
         const security = forceTls == 'same' ? this.stream.security : forceTls;
@@ -1453,7 +1488,7 @@ class Inbound extends XrayCommonClass {
         if (security === 'tls') {
             params.set("security", "tls");
             if (this.stream.isTls) {
-                params.set("fp", this.stream.tls.settings.fingerprint);
+                params.set("fp", fingerprint || this.stream.tls.settings.fingerprint);
                 params.set("alpn", this.stream.tls.alpn);
                 if (this.stream.tls.settings.allowInsecure) {
                     params.set("allowInsecure", "1");
@@ -1481,7 +1516,7 @@ class Inbound extends XrayCommonClass {
         return url.toString();
     }
 
-    genTrojanLink(address = '', port = this.port, forceTls, remark = '', clientPassword) {
+    genTrojanLink(address = '', port = this.port, forceTls, remark = '', clientPassword, fingerprint = '') {
         const security = forceTls == 'same' ? this.stream.security : forceTls;
         const type = this.stream.network;
         const params = new Map();
@@ -1534,7 +1569,7 @@ class Inbound extends XrayCommonClass {
         if (security === 'tls') {
             params.set("security", "tls");
             if (this.stream.isTls) {
-                params.set("fp", this.stream.tls.settings.fingerprint);
+                params.set("fp", fingerprint || this.stream.tls.settings.fingerprint);
                 params.set("alpn", this.stream.tls.alpn);
                 if (this.stream.tls.settings.allowInsecure) {
                     params.set("allowInsecure", "1");
@@ -1551,7 +1586,7 @@ class Inbound extends XrayCommonClass {
         else if (security === 'reality') {
             params.set("security", "reality");
             params.set("pbk", this.stream.reality.settings.publicKey);
-            params.set("fp", this.stream.reality.settings.fingerprint);
+            params.set("fp", fingerprint || this.stream.reality.settings.fingerprint);
             if (!ObjectUtil.isArrEmpty(this.stream.reality.serverNames)) {
                 params.set("sni", this.stream.reality.serverNames.split(",")[0]);
             }
@@ -1604,18 +1639,36 @@ class Inbound extends XrayCommonClass {
     genLink(address = '', port = this.port, forceTls = 'same', remark = '', client) {
         switch (this.protocol) {
             case Protocols.VMESS:
-                return this.genVmessLink(address, port, forceTls, remark, client.id, client.security);
+                return this.genVmessLink(address, port, forceTls, remark, client.id, client.security, client.fingerprint);
             case Protocols.VLESS:
-                return this.genVLESSLink(address, port, forceTls, remark, client.id, client.flow);
+                return this.genVLESSLink(address, port, forceTls, remark, client.id, client.flow, client.fingerprint);
             case Protocols.SHADOWSOCKS:
-                return this.genSSLink(address, port, forceTls, remark, this.isSSMultiUser ? client.password : '');
+                return this.genSSLink(address, port, forceTls, remark, this.isSSMultiUser ? client.password : '', client.fingerprint);
             case Protocols.TROJAN:
-                return this.genTrojanLink(address, port, forceTls, remark, client.password);
+                return this.genTrojanLink(address, port, forceTls, remark, client.password, client.fingerprint);
             default: return '';
         }
     }
 
-    genAllLinks(remark = '', remarkModel = '-ieo', client) {
+    // renderRemark mirrors link.RenderRemark on the server: {placeholders} are substituted and
+    // [bracketed] sections are dropped when a placeholder inside them is empty.
+    static renderRemark(template, values) {
+        const render = (text) => {
+            let empty = false;
+            const out = text.replace(/\{(\w+)\}/g, (match, name) => {
+                if (!(name in values)) return match;
+                if (!values[name]) empty = true;
+                return values[name];
+            });
+            return { out, empty };
+        };
+        return template.replace(/\[([^\]]*)\]/g, (match, inner) => {
+            const { out, empty } = render(inner);
+            return empty ? '' : out;
+        }).replace(/\{(\w+)\}/g, (match, name) => name in values ? values[name] : match).trim();
+    }
+
+    genAllLinks(remark = '', remarkModel = '-ieo', client, remarkTemplate = '') {
         let result = [];
         let email = client ? client.email : '';
         let addr = !ObjectUtil.isEmpty(this.listen) && this.listen !== "0.0.0.0" ? this.listen : location.hostname;
@@ -1627,8 +1680,18 @@ class Inbound extends XrayCommonClass {
             'e': email,
             'o': '',
         };
+        const genRemark = () => {
+            if (!ObjectUtil.isEmpty(remarkTemplate)) {
+                // Usage placeholders are only known to the server, so they render empty here
+                return Inbound.renderRemark(remarkTemplate, {
+                    remark: orders['i'], email: orders['e'], extra: orders['o'],
+                    status: '', traffic: '', used: '', total: '', up: '', down: '', days: '', expiry: '',
+                });
+            }
+            return orderChars.split('').map(char => orders[char]).filter(x => x.length > 0).join(separationChar);
+        };
         if (ObjectUtil.isArrEmpty(this.stream.externalProxy)) {
-            let r = orderChars.split('').map(char => orders[char]).filter(x => x.length > 0).join(separationChar);
+            let r = genRemark();
             result.push({
                 remark: r,
                 link: this.genLink(addr, port, 'same', r, client)
@@ -1636,7 +1699,7 @@ class Inbound extends XrayCommonClass {
         } else {
             this.stream.externalProxy.forEach((ep) => {
                 orders['o'] = ep.remark;
-                let r = orderChars.split('').map(char => orders[char]).filter(x => x.length > 0).join(separationChar);
+                let r = genRemark();
                 result.push({
                     remark: r,
                     link: this.genLink(ep.dest, ep.port, ep.forceTls, r, client)
@@ -1646,12 +1709,12 @@ class Inbound extends XrayCommonClass {
         return result;
     }
 
-    genInboundLinks(remark = '', remarkModel = '-ieo') {
+    genInboundLinks(remark = '', remarkModel = '-ieo', remarkTemplate = '') {
         let addr = !ObjectUtil.isEmpty(this.listen) && this.listen !== "0.0.0.0" ? this.listen : location.hostname;
         if (this.clients) {
             let links = [];
             this.clients.forEach((client) => {
-                this.genAllLinks(remark, remarkModel, client).forEach(l => {
+                this.genAllLinks(remark, remarkModel, client, remarkTemplate).forEach(l => {
                     links.push(l.link);
                 })
             });
@@ -1792,7 +1855,16 @@ Inbound.VmessSettings.VMESS = class extends XrayCommonClass {
         comment = '',
         reset = 0,
         created_at = undefined,
-        updated_at = undefined
+        updated_at = undefined,
+        tags = [],
+        speedLimit = 0,
+        speedBurst = 0,
+        expiryAction = '',
+        externalId = undefined,
+        level = 0,
+        fingerprint = '',
+        subExclude = undefined,
+        speedUnit = '',
     ) {
         super();
         this.id = id;
@@ -1808,6 +1880,15 @@ Inbound.VmessSettings.VMESS = class extends XrayCommonClass {
         this.reset = reset;
         this.created_at = created_at;
         this.updated_at = updated_at;
+        this.tags = tags;
+        this.speedLimit = speedLimit;
+        this.speedBurst = speedBurst;
+        this.expiryAction = expiryAction;
+        this.externalId = externalId;
+        this.level = level;
+        this.fingerprint = fingerprint;
+        this.subExclude = subExclude;
+        this.speedUnit = speedUnit;
     }
 
     static fromJson(json = {}) {
@@ -1825,6 +1906,15 @@ Inbound.VmessSettings.VMESS = class extends XrayCommonClass {
             json.reset,
             json.created_at,
             json.updated_at,
+            json.tags,
+            json.speedLimit,
+            json.speedBurst,
+            json.expiryAction,
+            json.externalId,
+            json.level,
+            json.fingerprint,
+            json.subExclude,
+            json.speedUnit,
         );
     }
     get _expiryTime() {
@@ -1932,7 +2022,16 @@ Inbound.VLESSSettings.VLESS = class extends XrayCommonClass {
         comment = '',
         reset = 0,
         created_at = undefined,
-        updated_at = undefined
+        updated_at = undefined,
+        tags = [],
+        speedLimit = 0,
+        speedBurst = 0,
+        expiryAction = '',
+        externalId = undefined,
+        level = 0,
+        fingerprint = '',
+        subExclude = undefined,
+        speedUnit = '',
     ) {
         super();
         this.id = id;
@@ -1948,6 +2047,15 @@ Inbound.VLESSSettings.VLESS = class extends XrayCommonClass {
         this.reset = reset;
         this.created_at = created_at;
         this.updated_at = updated_at;
+        this.tags = tags;
+        this.speedLimit = speedLimit;
+        this.speedBurst = speedBurst;
+        this.expiryAction = expiryAction;
+        this.externalId = externalId;
+        this.level = level;
+        this.fingerprint = fingerprint;
+        this.subExclude = subExclude;
+        this.speedUnit = speedUnit;
     }
 
     static fromJson(json = {}) {
@@ -1965,6 +2073,15 @@ Inbound.VLESSSettings.VLESS = class extends XrayCommonClass {
             json.reset,
             json.created_at,
             json.updated_at,
+            json.tags,
+            json.speedLimit,
+            json.speedBurst,
+            json.expiryAction,
+            json.externalId,
+            json.level,
+            json.fingerprint,
+            json.subExclude,
+            json.speedUnit,
         );
     }
 
@@ -2077,7 +2194,16 @@ Inbound.TrojanSettings.Trojan = class extends XrayCommonClass {
         comment = '',
         reset = 0,
         created_at = undefined,
-        updated_at = undefined
+        updated_at = undefined,
+        tags = [],
+        speedLimit = 0,
+        speedBurst = 0,
+        expiryAction = '',
+        externalId = undefined,
+        level = 0,
+        fingerprint = '',
+        subExclude = undefined,
+        speedUnit = '',
     ) {
         super();
         this.password = password;
@@ -2092,6 +2218,15 @@ Inbound.TrojanSettings.Trojan = class extends XrayCommonClass {
         this.reset = reset;
         this.created_at = created_at;
         this.updated_at = updated_at;
+        this.tags = tags;
+        this.speedLimit = speedLimit;
+        this.speedBurst = speedBurst;
+        this.expiryAction = expiryAction;
+        this.externalId = externalId;
+        this.level = level;
+        this.fingerprint = fingerprint;
+        this.subExclude = subExclude;
+        this.speedUnit = speedUnit;
     }
 
     toJson() {
@@ -2108,6 +2243,14 @@ Inbound.TrojanSettings.Trojan = class extends XrayCommonClass {
             reset: this.reset,
             created_at: this.created_at,
             updated_at: this.updated_at,
+            tags: this.tags,
+            speedLimit: this.speedLimit,
+            speedBurst: this.speedBurst,
+            expiryAction: this.expiryAction,
+            level: this.level,
+            fingerprint: this.fingerprint,
+            subExclude: this.subExclude,
+            speedUnit: this.speedUnit,
         };
     }
 
@@ -2125,6 +2268,15 @@ Inbound.TrojanSettings.Trojan = class extends XrayCommonClass {
             json.reset,
             json.created_at,
             json.updated_at,
+            json.tags,
+            json.speedLimit,
+            json.speedBurst,
+            json.expiryAction,
+            json.externalId,
+            json.level,
+            json.fingerprint,
+            json.subExclude,
+            json.speedUnit,
         );
     }
 
@@ -2246,7 +2398,16 @@ Inbound.ShadowsocksSettings.Shadowsocks = class extends XrayCommonClass {
         comment = '',
         reset = 0,
         created_at = undefined,
-        updated_at = undefined
+        updated_at = undefined,
+        tags = [],
+        speedLimit = 0,
+        speedBurst = 0,
+        expiryAction = '',
+        externalId = undefined,
+        level = 0,
+        fingerprint = '',
+        subExclude = undefined,
+        speedUnit = '',
     ) {
         super();
         this.method = method;
@@ -2262,6 +2423,15 @@ Inbound.ShadowsocksSettings.Shadowsocks = class extends XrayCommonClass {
         this.reset = reset;
         this.created_at = created_at;
         this.updated_at = updated_at;
+        this.tags = tags;
+        this.speedLimit = speedLimit;
+        this.speedBurst = speedBurst;
+        this.expiryAction = expiryAction;
+        this.externalId = externalId;
+        this.level = level;
+        this.fingerprint = fingerprint;
+        this.subExclude = subExclude;
+        this.speedUnit = speedUnit;
     }
 
     toJson() {
@@ -2279,6 +2449,14 @@ Inbound.ShadowsocksSettings.Shadowsocks = class extends XrayCommonClass {
             reset: this.reset,
             created_at: this.created_at,
             updated_at: this.updated_at,
+            tags: this.tags,
+            speedLimit: this.speedLimit,
+            speedBurst: this.speedBurst,
+            expiryAction: this.expiryAction,
+            level: this.level,
+            fingerprint: this.fingerprint,
+            subExclude: this.subExclude,
+            speedUnit: this.speedUnit,
         };
     }
 
@@ -2297,6 +2475,15 @@ Inbound.ShadowsocksSettings.Shadowsocks = class extends XrayCommonClass {
             json.reset,
             json.created_at,
             json.updated_at,
+            json.tags,
+            json.speedLimit,
+            json.speedBurst,
+            json.expiryAction,
+            json.externalId,
+            json.level,
+            json.fingerprint,
+            json.subExclude,
+            json.speedUnit,
         );
     }
 
@@ -4,6 +4,8 @@ class AllSetting {
         this.webListen = "";
         this.webDomain = "";
         this.webPort = 2053;
+        this.webSocket = "";
+        this.webHttp3 = false;
         this.webCertFile = "";
         this.webKeyFile = "";
         this.webBasePath = "/";
@@ -12,6 +14,8 @@ class AllSetting {
         this.expireDiff = 0;
         this.trafficDiff = 0;
         this.remarkModel = "-ieo";
+        this.remarkTemplate = "";
+        this.remarkEmoji = true;
         this.datepicker = "gregorian";
         this.tgBotEnable = false;
         this.tgBotToken = "";
@@ -22,6 +26,8 @@ class AllSetting {
         this.tgBotBackup = false;
         this.tgBotLoginNotify = true;
         this.tgCpu = 80;
+        this.tgDisk = 90;
+        this.tgDbSize = 0;
         this.tgLang = "en-US";
         this.twoFactorEnable = false;
         this.twoFactorToken = "";
@@ -32,6 +38,8 @@ class AllSetting {
         this.subTitle = "";
         this.subListen = "";
         this.subPort = 2096;
+        this.subSocket = "";
+        this.subHttp3 = false;
         this.subPath = "/sub/";
         this.subJsonPath = "/json/";
         this.subDomain = "";
@@ -39,9 +47,13 @@ class AllSetting {
         this.externalTrafficInformURI = "";
         this.subCertFile = "";
         this.subKeyFile = "";
+        this.subRateLimit = 0;
+        this.subCloudflareOnly = false;
         this.subUpdates = 12;
         this.subEncrypt = true;
         this.subShowInfo = true;
+        this.subRandomize = false;
+        this.subSign = false;
         this.subURI = "";
         this.subJsonURI = "";
         this.subJsonFragment = "";
@@ -72,6 +84,88 @@ class AllSetting {
         this.ldapDefaultTotalGB = 0;
         this.ldapDefaultExpiryDays = 0;
         this.ldapDefaultLimitIP = 0;
+        this.paymentEnable = false;
+        this.paymentStripeSecret = "";
+        this.paymentHmacSecret = "";
+        this.referralLinkTemplate = "";
+        this.smtpHost = "";
+        this.smtpPort = 587;
+        this.smtpUsername = "";
+        this.smtpPassword = "";
+        this.smtpFrom = "";
+        this.speedLimitInterface = "";
+        this.expiryThrottleSpeed = 16;
+        this.expiryCaptiveOutbound = "";
+        this.portalEnable = false;
+        this.healthCheckMode = "";
+        this.firewallBackend = "";
+        this.firewallPanelAllowIps = "";
+        this.maintenanceEnable = false;
+        this.maintenanceHour = 4;
+        this.maintenanceRetentionDays = 90;
+        this.xrayRestartDelay = 5;
+        this.coreType = "xray";
+        this.onlineDetectionMode = "";
+        this.onlineIdleWindow = 0;
+        this.onlineMinBytes = 1;
+        this.onlineLogScanInterval = 10;
+        this.trafficInterval = 10;
+        this.trafficClientUplink = true;
+        this.trafficClientDownlink = true;
+        this.trafficResetOnRead = true;
+        this.outboundProbeInterval = 5;
+        this.outboundProbeDeprioritize = false;
+        this.naiveEnable = false;
+        this.naivePort = 8443;
+        this.naiveDomain = "";
+        this.naiveCertFile = "";
+        this.naiveKeyFile = "";
+        this.naiveInboundIds = "";
+        this.sshEnable = false;
+        this.sshPort = 2222;
+        this.sshHost = "";
+        this.sshInboundIds = "";
+        this.adBlockEnable = false;
+        this.adBlockCategories = "geosite:category-ads-all,ext:geosite_IR.dat:malware,ext:geosite_IR.dat:phishing";
+        this.adBlockExcludeInboundIds = "";
+        this.geofileUpdateInterval = 0;
+        this.realityCheckInterval = 0;
+        this.realityMaxLatency = 1000;
+        this.realityBlockedDomains = "";
+        this.realityFallbackTargets = "";
+        this.realityAutoRotate = false;
+        this.decoyMode = "";
+        this.decoyUrl = "";
+        this.decoyBanThreshold = 0;
+        this.decoyBanMinutes = 60;
+        this.decoyAbuseIpdbKey = "";
+        this.tunnelMode = "";
+        this.tunnelToken = "";
+        this.tunnelHostname = "";
+        this.approvalEnable = false;
+        this.approvalMinClients = 10;
+        this.approvalWindow = 60;
+        this.updateCheckEnable = true;
+        this.updateCheckNotify = false;
+        this.profilingEnable = false;
+        this.ipCheckEnable = false;
+        this.ipCheckInterval = 5;
+        this.ipChangeWebhook = "";
+        this.ddnsProvider = "";
+        this.ddnsDomain = "";
+        this.ddnsToken = "";
+        this.ddnsZoneId = "";
+        this.dnsProvider = "";
+        this.dnsApiToken = "";
+        this.dnsZoneId = "";
+        this.dnsAutoRecord = false;
+        this.dnsProxied = false;
+        this.dnsCnameTarget = "";
+        this.brandName = "";
+        this.brandLogoUrl = "";
+        this.brandFaviconUrl = "";
+        this.brandPrimaryColor = "";
+        this.brandSupportContact = "";
 
         if (data == null) {
             return
@@ -22,6 +22,11 @@
     datepicker: el.getAttribute('data-datepicker') || 'gregorian',
   };
 
+  let announcements = [];
+  try {
+    announcements = JSON.parse(el.getAttribute('data-announcements') || '[]') || [];
+  } catch (e) { /* ignore */ }
+
   // Normalize lastOnline to milliseconds if it looks like seconds
   if (data.lastOnlineMs && data.lastOnlineMs < 10_000_000_000) {
     data.lastOnlineMs *= 1000;
@@ -91,6 +96,7 @@
       themeSwitcher,
       app: data,
       links: rawLinks,
+      announcements,
       lang: '',
       viewportWidth: (typeof window !== 'undefined' ? window.innerWidth : 1024),
     },
@@ -37,7 +37,7 @@ class HttpUtil {
             return msg;
         } catch (error) {
             console.error('GET request failed:', error);
-            const errorMsg = new Msg(false, error.response?.data?.message || error.message || 'Request failed');
+            const errorMsg = new Msg(false, error.response?.data?.msg || error.response?.data?.message || error.message || 'Request failed');
             this._handleMsg(errorMsg);
             return errorMsg;
         }
@@ -51,7 +51,7 @@ class HttpUtil {
             return msg;
         } catch (error) {
             console.error('POST request failed:', error);
-            const errorMsg = new Msg(false, error.response?.data?.message || error.message || 'Request failed');
+            const errorMsg = new Msg(false, error.response?.data?.msg || error.response?.data?.message || error.message || 'Request failed');
             this._handleMsg(errorMsg);
             return errorMsg;
         }
@@ -836,6 +836,18 @@ class LanguageManager {
         window.location.reload();
     }
 
+    static addLanguages(languages) {
+        languages.forEach((lang) => {
+            if (!LanguageManager.isSupportLanguage(lang.tag)) {
+                LanguageManager.supportedLanguages.push({
+                    name: lang.name,
+                    value: lang.tag,
+                    icon: "🌐",
+                });
+            }
+        });
+    }
+
     static isSupportLanguage(language) {
         const languageFilter = LanguageManager.supportedLanguages.filter((lang) => {
             return lang.value === language
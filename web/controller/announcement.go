@@ -0,0 +1,164 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AnnouncementController handles announcements to clients.
+type AnnouncementController struct {
+	announcementService service.AnnouncementService
+}
+
+// NewAnnouncementController creates a new AnnouncementController and sets up its routes.
+func NewAnnouncementController(g *gin.RouterGroup) *AnnouncementController {
+	a := &AnnouncementController{}
+	a.initRouter(g)
+	return a
+}
+
+// initRouter initializes the routes for managing announcements.
+func (a *AnnouncementController) initRouter(g *gin.RouterGroup) {
+	g.GET("/list", a.getAnnouncements)
+	g.POST("/add", a.addAnnouncement)
+	g.POST("/update/:id", a.updateAnnouncement)
+	g.POST("/del/:id", a.delAnnouncement)
+	g.POST("/broadcast/:id", a.broadcastAnnouncement)
+}
+
+// initRouterV2 sets up the announcement routes of the REST API.
+func (a *AnnouncementController) initRouterV2(g *gin.RouterGroup) {
+	g.GET("", a.getAnnouncements)
+	g.POST("", createdStatus, a.addAnnouncement)
+	g.PUT("/:id", a.updateAnnouncement)
+	g.DELETE("/:id", a.delAnnouncement)
+	g.POST("/:id/broadcast", a.broadcastAnnouncement)
+}
+
+// BroadcastResponse defines the response of a Telegram broadcast.
+type BroadcastResponse struct {
+	Recipients int `json:"recipients" example:"42"` // Number of Telegram accounts the announcement was sent to
+}
+
+// getAnnouncements lists all announcements.
+// @Summary      List announcements
+// @Description  Get all announcements, newest first
+// @Tags         announcements
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=[]model.Announcement}
+// @Failure      401  {object}  entity.Msg
+// @Router       /announcements/list [get]
+// @Router       /v2/announcements [get]
+func (a *AnnouncementController) getAnnouncements(c *gin.Context) {
+	announcements, err := a.announcementService.GetAnnouncements()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonObj(c, announcements, nil)
+}
+
+// addAnnouncement creates an announcement.
+// @Summary      Create announcement
+// @Description  Create an announcement shown in the client portal and on the subscription page while enabled. With showInSub it is also added as an info node at the top of subscriptions.
+// @Tags         announcements
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        data  body      model.Announcement  true  "Announcement"
+// @Success      200   {object}  entity.Msg{obj=model.Announcement}
+// @Failure      400   {object}  entity.Msg
+// @Router       /announcements/add [post]
+// @Router       /v2/announcements [post]
+func (a *AnnouncementController) addAnnouncement(c *gin.Context) {
+	announcement := &model.Announcement{}
+	if err := c.ShouldBind(announcement); err != nil {
+		jsonMsg(c, I18nWeb(c, "create"), err)
+		return
+	}
+	err := a.announcementService.AddAnnouncement(announcement)
+	jsonMsgObj(c, I18nWeb(c, "create"), announcement, err)
+}
+
+// updateAnnouncement updates an announcement.
+// @Summary      Update announcement
+// @Description  Update the content and visibility of an announcement
+// @Tags         announcements
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id    path      int                 true  "Announcement ID"
+// @Param        data  body      model.Announcement  true  "Announcement"
+// @Success      200   {object}  entity.Msg{obj=model.Announcement}
+// @Failure      400   {object}  entity.Msg
+// @Router       /announcements/update/{id} [post]
+// @Router       /v2/announcements/{id} [put]
+func (a *AnnouncementController) updateAnnouncement(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "update"), err)
+		return
+	}
+	announcement := &model.Announcement{}
+	if err := c.ShouldBind(announcement); err != nil {
+		jsonMsg(c, I18nWeb(c, "update"), err)
+		return
+	}
+	announcement.Id = id
+	err = a.announcementService.UpdateAnnouncement(announcement)
+	jsonMsgObj(c, I18nWeb(c, "update"), announcement, err)
+}
+
+// delAnnouncement deletes an announcement.
+// @Summary      Delete announcement
+// @Description  Delete an announcement
+// @Tags         announcements
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Announcement ID"
+// @Success      200  {object}  entity.Msg
+// @Failure      400  {object}  entity.Msg
+// @Router       /announcements/del/{id} [post]
+// @Router       /v2/announcements/{id} [delete]
+func (a *AnnouncementController) delAnnouncement(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "delete"), err)
+		return
+	}
+	err = a.announcementService.DelAnnouncement(id)
+	jsonMsg(c, I18nWeb(c, "delete"), err)
+}
+
+// broadcastAnnouncement sends an announcement to all clients via Telegram.
+// @Summary      Broadcast announcement
+// @Description  Send an announcement to the Telegram accounts of all clients. Each account receives it once.
+// @Tags         announcements
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Announcement ID"
+// @Success      200  {object}  entity.Msg{obj=BroadcastResponse}
+// @Failure      400  {object}  entity.Msg
+// @Router       /announcements/broadcast/{id} [post]
+// @Router       /v2/announcements/{id}/broadcast [post]
+func (a *AnnouncementController) broadcastAnnouncement(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	recipients, err := a.announcementService.BroadcastAnnouncement(id)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonObj(c, &BroadcastResponse{Recipients: recipients}, nil)
+}
@@ -1,8 +1,13 @@
 package controller
 
 import (
+	"context"
 	"net/http"
+	"runtime"
+	"runtime/debug"
 
+	"github.com/mhsanaei/3x-ui/v2/config"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
 	"github.com/mhsanaei/3x-ui/v2/web/middleware"
 	"github.com/mhsanaei/3x-ui/v2/web/service"
 	"github.com/mhsanaei/3x-ui/v2/web/session"
@@ -13,9 +18,28 @@ import (
 // APIController handles the main API routes for the 3x-ui panel, including inbounds and server management.
 type APIController struct {
 	BaseController
-	inboundController *InboundController
-	serverController  *ServerController
-	Tgbot             service.Tgbot
+	inboundController      *InboundController
+	serverController       *ServerController
+	depositController      *DepositController
+	paymentController      *PaymentController
+	announcementController *AnnouncementController
+	dnsController          *DNSController
+	backupController       *BackupController
+	applyController        *ApplyController
+	jobController          *JobController
+	outboundPoolController *OutboundPoolController
+	customerController     *CustomerController
+	trafficPoolController  *TrafficPoolController
+	subProfileController   *SubProfileController
+	approvalController     *ApprovalController
+	scheduleController     *ScheduleController
+	xrayController         *XrayController
+	debugController        *DebugController
+	voucherController      *VoucherController
+	referralController     *ReferralController
+	Tgbot                  service.Tgbot
+	xrayService            service.XrayService
+	jobService             service.JobService
 }
 
 // NewAPIController creates a new APIController instance and initializes its routes.
@@ -45,17 +69,162 @@ func (a *APIController) initRouter(g *gin.RouterGroup) {
 	api := g.Group("/panel/api")
 	api.Use(middleware.ApiKeyAuth())
 	api.Use(a.checkAPIAuth)
+	api.GET("/version", a.getVersion)
+
+	// Legacy API, deprecated in favor of the REST API below
+	legacy := api.Group("")
+	legacy.Use(middleware.ApiVersionMiddleware(middleware.ApiVersionLegacy))
 
 	// Inbounds API
-	inbounds := api.Group("/inbounds")
+	inbounds := legacy.Group("/inbounds")
 	a.inboundController = NewInboundController(inbounds)
 
 	// Server API
-	server := api.Group("/server")
+	server := legacy.Group("/server")
 	a.serverController = NewServerController(server)
 
+	// Deposit tokens API
+	deposit := legacy.Group("/deposit")
+	a.depositController = NewDepositController(deposit)
+
+	// Deposit token redemption is authenticated by the token itself
+	g.POST("/panel/api/deposit/redeem/:token", middleware.ApiVersionMiddleware(middleware.ApiVersionLegacy), a.depositController.redeem)
+
+	// Payments API
+	payment := legacy.Group("/payment")
+	a.paymentController = NewPaymentController(payment)
+
+	// Payment webhooks are authenticated by the provider's signature
+	g.POST("/panel/api/payment/webhook/:provider", a.paymentController.webhook)
+
+	// Announcements API
+	announcements := legacy.Group("/announcements")
+	a.announcementController = NewAnnouncementController(announcements)
+
+	// DNS records API
+	dns := legacy.Group("/dns")
+	a.dnsController = NewDNSController(dns)
+
+	// Backup verification API
+	backup := legacy.Group("/backup")
+	a.backupController = NewBackupController(backup)
+
+	// Declarative configuration API
+	a.applyController = NewApplyController(legacy)
+
+	// Background jobs API
+	jobs := legacy.Group("/jobs")
+	a.jobController = NewJobController(jobs)
+
+	// Outbound pools API
+	outboundPools := legacy.Group("/outboundPools")
+	a.outboundPoolController = NewOutboundPoolController(outboundPools)
+
+	// Customers API
+	customers := legacy.Group("/customers")
+	a.customerController = NewCustomerController(customers)
+
+	// Traffic pools API
+	trafficPools := legacy.Group("/trafficPools")
+	a.trafficPoolController = NewTrafficPoolController(trafficPools)
+
+	// Subscription profiles API
+	subProfiles := legacy.Group("/subProfiles")
+	a.subProfileController = NewSubProfileController(subProfiles)
+
+	// Approval requests API
+	approvals := legacy.Group("/approvals")
+	a.approvalController = NewApprovalController(approvals)
+
+	// Scheduled actions API
+	schedules := legacy.Group("/schedules")
+	a.scheduleController = NewScheduleController(schedules)
+
+	// Xray configuration and runtime API
+	xray := legacy.Group("/xray")
+	a.xrayController = NewXrayController(xray)
+
+	// Profiling and debug dump API
+	profiling := legacy.Group("/debug")
+	a.debugController = NewDebugController(profiling)
+
+	// Vouchers API
+	vouchers := legacy.Group("/vouchers")
+	a.voucherController = NewVoucherController(vouchers)
+
+	// Referrers API
+	referrers := legacy.Group("/referrers")
+	a.referralController = NewReferralController(referrers)
+
 	// Extra routes
-	api.GET("/backuptotgbot", a.BackuptoTgbot)
+	legacy.GET("/backuptotgbot", a.BackuptoTgbot)
+
+	// REST API: the same handlers on resource routes with REST verbs, answering failures
+	// with a matching HTTP status. The routes above stay for compatibility.
+	v2 := api.Group("/v2")
+	v2.Use(middleware.ApiVersionMiddleware(middleware.ApiVersionCurrent), restStatus)
+	a.inboundController.initRouterV2(v2.Group("/inbounds"))
+	a.inboundController.initClientRouterV2(v2.Group("/clients"))
+	a.serverController.initRouter(v2.Group("/server"))
+	a.depositController.initRouterV2(v2.Group("/deposit"))
+	a.paymentController.initRouterV2(v2.Group("/payment"))
+	a.announcementController.initRouterV2(v2.Group("/announcements"))
+	a.dnsController.initRouterV2(v2.Group("/dns"))
+	a.backupController.initRouter(v2.Group("/backup"))
+	a.applyController.initRouter(v2)
+	a.jobController.initRouterV2(v2.Group("/jobs"))
+	a.outboundPoolController.initRouterV2(v2.Group("/outboundPools"))
+	a.customerController.initRouterV2(v2.Group("/customers"))
+	a.trafficPoolController.initRouterV2(v2.Group("/trafficPools"))
+	a.subProfileController.initRouterV2(v2.Group("/subProfiles"))
+	a.approvalController.initRouterV2(v2.Group("/approvals"))
+	a.scheduleController.initRouterV2(v2.Group("/schedules"))
+	a.xrayController.initRouter(v2.Group("/xray"))
+	a.debugController.initRouter(v2.Group("/debug"))
+	a.voucherController.initRouterV2(v2.Group("/vouchers"))
+	a.referralController.initRouterV2(v2.Group("/referrers"))
+	v2.POST("/backuptotgbot", a.BackuptoTgbot)
+	g.POST("/panel/api/v2/deposit/redeem/:token", middleware.ApiVersionMiddleware(middleware.ApiVersionCurrent), restStatus, a.depositController.redeem)
+}
+
+// getVersion reports the supported API versions and the panel build.
+// @Summary      Get API version
+// @Description  Report the supported API versions with their route prefix, deprecation and sunset time, and the panel build. Legacy routes answer with Deprecation, Sunset and Link headers pointing to their successor; every versioned route answers with an X-API-Version header, and a request pinning another version with that header is rejected with UNSUPPORTED_API_VERSION.
+// @Tags         version
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=entity.ApiVersionInfo}
+// @Router       /version [get]
+func (a *APIController) getVersion(c *gin.Context) {
+	info := &entity.ApiVersionInfo{
+		Current: middleware.ApiVersionCurrent,
+		Versions: []entity.ApiVersion{
+			{
+				Version:     middleware.ApiVersionLegacy,
+				Prefix:      "/panel/api",
+				Status:      "deprecated",
+				Deprecation: middleware.ApiLegacyDeprecation.Unix(),
+				Sunset:      middleware.ApiLegacySunset.Unix(),
+			},
+			{
+				Version: middleware.ApiVersionCurrent,
+				Prefix:  "/panel/api/v2",
+				Status:  "current",
+			},
+		},
+		PanelVersion: config.GetVersion(),
+		XrayVersion:  a.xrayService.GetXrayVersion(),
+		GoVersion:    runtime.Version(),
+	}
+	if buildInfo, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range buildInfo.Settings {
+			if setting.Key == "vcs.revision" {
+				info.Commit = setting.Value
+			}
+		}
+	}
+	jsonObj(c, info, nil)
 }
 
 // BackuptoTgbot sends a backup of the panel data to Telegram bot admins.
@@ -65,9 +234,19 @@ func (a *APIController) initRouter(g *gin.RouterGroup) {
 // @Accept       json
 // @Produce      json
 // @Security     ApiKeyAuth
-// @Success      200  {object}  entity.Msg
-// @Failure      401  {object}  entity.Msg
+// @Param        async  query     bool  false  "Run as a background job and answer with the job"
+// @Success      200    {object}  entity.Msg
+// @Failure      401    {object}  entity.Msg
 // @Router       /backuptotgbot [get]
+// @Router       /v2/backuptotgbot [post]
 func (a *APIController) BackuptoTgbot(c *gin.Context) {
+	if isAsync(c) {
+		job, err := a.jobService.Enqueue("backupToTgbot", func(ctx context.Context, report service.JobProgressFunc) (any, error) {
+			a.Tgbot.SendBackupToAdmins()
+			return nil, nil
+		})
+		jsonJob(c, I18nWeb(c, "pages.index.jobQueued"), job, err)
+		return
+	}
 	a.Tgbot.SendBackupToAdmins()
 }
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+	"github.com/mhsanaei/3x-ui/v2/web/session"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxApplyDocumentSize bounds the size of an apply document.
+const maxApplyDocumentSize = 8 << 20
+
+// ApplyController handles declarative configuration documents.
+type ApplyController struct {
+	applyService service.ApplyService
+}
+
+// NewApplyController creates a new ApplyController and sets up its routes.
+func NewApplyController(g *gin.RouterGroup) *ApplyController {
+	a := &ApplyController{}
+	a.initRouter(g)
+	return a
+}
+
+// initRouter initializes the apply and state routes. The REST API serves the same routes.
+func (a *ApplyController) initRouter(g *gin.RouterGroup) {
+	g.POST("/apply", a.apply)
+	g.GET("/state", a.getState)
+}
+
+// apply brings the panel to the state declared in a YAML or JSON document.
+// @Summary      Apply declarative configuration
+// @Description  Compare a YAML or JSON document of desired settings and inbounds, clients included in the inbound settings, with the current state and create, update and delete what differs. Inbounds are identified by external ID or by listen address and port; with prune set, inbounds not listed are deleted, or held for approval like deletions in the panel when two-person approval requires it. The document returned by the state endpoint can be applied as is. Applying the same document again changes nothing. With dryRun only the plan is returned.
+// @Tags         apply
+// @Accept       application/x-yaml
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        document  body      entity.ApplyDocument  true   "Desired state"
+// @Param        dryRun    query     bool                  false  "Only compute the plan"
+// @Success      200       {object}  entity.Msg{obj=entity.ApplyPlan}
+// @Failure      400       {object}  entity.Msg
+// @Router       /apply [post]
+// @Router       /v2/apply [post]
+func (a *ApplyController) apply(c *gin.Context) {
+	data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxApplyDocumentSize))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.applyFailed"), err)
+		return
+	}
+	doc, err := service.ParseApplyDocument(data)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.applyFailed"), err)
+		return
+	}
+	dryRun := c.Query("dryRun") == "true"
+	plan, err := a.applyService.Apply(doc, session.GetLoginUser(c).Id, dryRun)
+	if err == nil && !dryRun && len(plan.Changes) > 0 {
+		logger.Infof("Configuration applied from %s with %d changes", getRemoteIp(c), len(plan.Changes))
+	}
+	if err != nil {
+		jsonMsgObj(c, I18nWeb(c, "pages.settings.toasts.applyFailed"), plan, err)
+		return
+	}
+	jsonObj(c, plan, nil)
+}
+
+// getState returns the panel state as an apply document.
+// @Summary      Get panel state
+// @Description  Return the settings and inbounds, clients included in the inbound settings, as one deterministic document in the form the apply endpoint accepts. Secret settings, client credentials and private keys are left out unless secrets is set. The response carries an ETag; a request with a matching If-None-Match header is answered with 304 Not Modified, so configuration management tools can detect drift cheaply.
+// @Tags         apply
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        secrets        query     bool    false  "Include secrets"
+// @Param        If-None-Match  header    string  false  "ETag of a previous response"
+// @Success      200            {object}  entity.Msg{obj=entity.PanelState}
+// @Success      304
+// @Failure      400            {object}  entity.Msg
+// @Router       /state [get]
+// @Router       /v2/state [get]
+func (a *ApplyController) getState(c *gin.Context) {
+	state, etag, err := a.applyService.State(c.Query("secrets") == "true")
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.getSettings"), err)
+		return
+	}
+	c.Header("ETag", etag)
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	jsonObj(c, state, nil)
+}
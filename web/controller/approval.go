@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"io"
+	"strconv"
+
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+	"github.com/mhsanaei/3x-ui/v2/web/session"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ApprovalController handles the approval requests of destructive operations.
+type ApprovalController struct {
+	approvalService service.ApprovalService
+}
+
+// NewApprovalController creates a new ApprovalController and sets up its routes.
+func NewApprovalController(g *gin.RouterGroup) *ApprovalController {
+	a := &ApprovalController{}
+	a.initRouter(g)
+	return a
+}
+
+// initRouter initializes the routes for deciding approval requests.
+func (a *ApprovalController) initRouter(g *gin.RouterGroup) {
+	g.GET("/list", a.getApprovals)
+	g.POST("/approve/:id", a.approve)
+	g.POST("/reject/:id", a.reject)
+}
+
+// initRouterV2 sets up the approval routes of the REST API.
+func (a *ApprovalController) initRouterV2(g *gin.RouterGroup) {
+	g.GET("", a.getApprovals)
+	g.POST("/:id/approve", a.approve)
+	g.POST("/:id/reject", a.reject)
+}
+
+// approvalAdmin returns the admin making the request, as approval requests name them.
+func approvalAdmin(c *gin.Context) string {
+	return service.ApprovalAdmin(session.GetLoginUser(c).Id)
+}
+
+// holdForApproval answers with a pending approval request when the operation needs one and
+// reports whether it did, in which case the handler must not run the operation. The payload is
+// read and kept for the operation only when a request is created.
+func holdForApproval(c *gin.Context, action string, target string, payload io.Reader) bool {
+	var approvalService service.ApprovalService
+	approval, err := approvalService.Require(action, target, approvalAdmin(c), payload)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return true
+	}
+	if approval == nil {
+		return false
+	}
+	c.Set(acceptedStatusKey, true)
+	jsonMsgObj(c, I18nWeb(c, "approvalPending"), approval, nil)
+	return true
+}
+
+// getApprovals lists approval requests.
+// @Summary      List approval requests
+// @Description  Get the approval requests of destructive operations, newest first. Pending requests expire when they are not approved within the approval window.
+// @Tags         approvals
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=[]model.Approval}
+// @Failure      401  {object}  entity.Msg
+// @Router       /approvals/list [get]
+// @Router       /v2/approvals [get]
+func (a *ApprovalController) getApprovals(c *gin.Context) {
+	approvals, err := a.approvalService.GetApprovals()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonObj(c, approvals, nil)
+}
+
+// approve approves a pending request and runs its operation.
+// @Summary      Approve request
+// @Description  Approve a pending request and run its operation. The admin who made the request can not approve it. The request is answered with the approval, whose status is failed with the error when the operation failed.
+// @Tags         approvals
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Approval request ID"
+// @Success      200  {object}  entity.Msg{obj=model.Approval}
+// @Failure      400  {object}  entity.Msg
+// @Router       /approvals/approve/{id} [post]
+// @Router       /v2/approvals/{id}/approve [post]
+func (a *ApprovalController) approve(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "update"), err)
+		return
+	}
+	approval, err := a.approvalService.Approve(id, approvalAdmin(c))
+	jsonMsgObj(c, I18nWeb(c, "update"), approval, err)
+}
+
+// reject rejects a pending request.
+// @Summary      Reject request
+// @Description  Reject a pending request, or withdraw it when made by the same admin
+// @Tags         approvals
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Approval request ID"
+// @Success      200  {object}  entity.Msg{obj=model.Approval}
+// @Failure      400  {object}  entity.Msg
+// @Router       /approvals/reject/{id} [post]
+// @Router       /v2/approvals/{id}/reject [post]
+func (a *ApprovalController) reject(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "update"), err)
+		return
+	}
+	approval, err := a.approvalService.Reject(id, approvalAdmin(c))
+	jsonMsgObj(c, I18nWeb(c, "update"), approval, err)
+}
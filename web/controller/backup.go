@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BackupController handles checks of database backups.
+type BackupController struct {
+	backupService service.BackupService
+}
+
+// NewBackupController creates a new BackupController and sets up its routes.
+func NewBackupController(g *gin.RouterGroup) *BackupController {
+	a := &BackupController{}
+	a.initRouter(g)
+	return a
+}
+
+// initRouter initializes the routes for checking backups. The REST API serves the same routes.
+func (a *BackupController) initRouter(g *gin.RouterGroup) {
+	g.POST("/verify", a.verifyBackup)
+}
+
+// verifyBackup checks a database backup without restoring it.
+// @Summary      Verify backup
+// @Description  Check a database backup without touching the live database: the file is opened read-only from a temporary copy, its schema version and SQLite integrity are checked, the inbounds, clients and users are counted and the secret settings are test-decrypted with this panel's master key. valid is false when the backup cannot be restored.
+// @Tags         backup
+// @Accept       multipart/form-data
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        db   formData  file  true  "Database backup file"
+// @Success      200  {object}  entity.Msg{obj=entity.BackupVerification}
+// @Failure      400  {object}  entity.Msg
+// @Router       /backup/verify [post]
+// @Router       /v2/backup/verify [post]
+func (a *BackupController) verifyBackup(c *gin.Context) {
+	file, header, err := c.Request.FormFile("db")
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.index.readDatabaseError"), err)
+		return
+	}
+	defer file.Close()
+	result, err := a.backupService.VerifyBackup(file, header.Size)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.index.readDatabaseError"), err)
+		return
+	}
+	jsonObj(c, result, nil)
+}
@@ -0,0 +1,237 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CustomerController handles customers owning clients on several inbounds.
+type CustomerController struct {
+	customerService service.CustomerService
+	xrayService     service.XrayService
+}
+
+// NewCustomerController creates a new CustomerController and sets up its routes.
+func NewCustomerController(g *gin.RouterGroup) *CustomerController {
+	a := &CustomerController{}
+	a.initRouter(g)
+	return a
+}
+
+// initRouter initializes the routes for managing customers.
+func (a *CustomerController) initRouter(g *gin.RouterGroup) {
+	g.GET("/list", a.getCustomers)
+	g.GET("/get/:id", a.getCustomer)
+	g.POST("/add", a.addCustomer)
+	g.POST("/update/:id", a.updateCustomer)
+	g.POST("/del/:id", a.delCustomer)
+	g.POST("/addClient/:id", a.addCustomerClient)
+	g.POST("/resetTraffic/:id", a.resetCustomerTraffic)
+}
+
+// initRouterV2 sets up the customer routes of the REST API.
+func (a *CustomerController) initRouterV2(g *gin.RouterGroup) {
+	g.GET("", a.getCustomers)
+	g.GET("/:id", a.getCustomer)
+	g.POST("", createdStatus, a.addCustomer)
+	g.PUT("/:id", a.updateCustomer)
+	g.DELETE("/:id", a.delCustomer)
+	g.POST("/:id/clients", createdStatus, a.addCustomerClient)
+	g.POST("/:id/resetTraffic", a.resetCustomerTraffic)
+}
+
+// CustomerClientRequest defines the client to create for a customer.
+type CustomerClientRequest struct {
+	InboundId int    `json:"inboundId" form:"inboundId" example:"1"`    // Inbound the client is created on
+	Email     string `json:"email" form:"email" example:"alice-trojan"` // Client email, random when empty
+}
+
+// getCustomers lists all customers.
+// @Summary      List customers
+// @Description  Get all customers with the traffic, online state and clients of each, summed over the clients sharing their subscription ID
+// @Tags         customers
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=[]entity.CustomerStats}
+// @Failure      401  {object}  entity.Msg
+// @Router       /customers/list [get]
+// @Router       /v2/customers [get]
+func (a *CustomerController) getCustomers(c *gin.Context) {
+	customers, err := a.customerService.GetCustomers()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonObj(c, customers, nil)
+}
+
+// getCustomer returns a customer.
+// @Summary      Get customer
+// @Description  Get a customer with the traffic, online state and clients summed over the clients sharing its subscription ID
+// @Tags         customers
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Customer ID"
+// @Success      200  {object}  entity.Msg{obj=entity.CustomerStats}
+// @Failure      400  {object}  entity.Msg
+// @Router       /customers/get/{id} [get]
+// @Router       /v2/customers/{id} [get]
+func (a *CustomerController) getCustomer(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	customer, err := a.customerService.GetCustomer(id)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonObj(c, customer, nil)
+}
+
+// addCustomer creates a customer.
+// @Summary      Create customer
+// @Description  Create a customer with a quota and expiry counted over all clients sharing its subscription ID. The subscription ID is generated when empty; clients already using it become clients of the customer. Once the quota is used up or the customer expires, all its clients are disabled.
+// @Tags         customers
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        data  body      model.Customer  true  "Customer"
+// @Success      200   {object}  entity.Msg{obj=model.Customer}
+// @Failure      400   {object}  entity.Msg
+// @Router       /customers/add [post]
+// @Router       /v2/customers [post]
+func (a *CustomerController) addCustomer(c *gin.Context) {
+	customer := &model.Customer{}
+	if err := c.ShouldBind(customer); err != nil {
+		jsonMsg(c, I18nWeb(c, "create"), err)
+		return
+	}
+	err := a.customerService.AddCustomer(customer)
+	jsonMsgObj(c, I18nWeb(c, "create"), customer, err)
+}
+
+// updateCustomer updates a customer.
+// @Summary      Update customer
+// @Description  Update the name, quota, expiry and comment of a customer. The subscription ID can not be changed. Clients disabled because the customer was depleted are enabled again when the new quota and expiry allow it.
+// @Tags         customers
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id    path      int             true  "Customer ID"
+// @Param        data  body      model.Customer  true  "Customer"
+// @Success      200   {object}  entity.Msg{obj=model.Customer}
+// @Failure      400   {object}  entity.Msg
+// @Router       /customers/update/{id} [post]
+// @Router       /v2/customers/{id} [put]
+func (a *CustomerController) updateCustomer(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "update"), err)
+		return
+	}
+	customer := &model.Customer{}
+	if err := c.ShouldBind(customer); err != nil {
+		jsonMsg(c, I18nWeb(c, "update"), err)
+		return
+	}
+	customer.Id = id
+	needRestart, err := a.customerService.UpdateCustomer(customer)
+	jsonMsgObj(c, I18nWeb(c, "update"), customer, err)
+	if err == nil && needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+// delCustomer deletes a customer.
+// @Summary      Delete customer
+// @Description  Delete a customer. Its clients are kept with their own quota and expiry.
+// @Tags         customers
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Customer ID"
+// @Success      200  {object}  entity.Msg
+// @Failure      400  {object}  entity.Msg
+// @Router       /customers/del/{id} [post]
+// @Router       /v2/customers/{id} [delete]
+func (a *CustomerController) delCustomer(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "delete"), err)
+		return
+	}
+	err = a.customerService.DelCustomer(id)
+	jsonMsg(c, I18nWeb(c, "delete"), err)
+}
+
+// addCustomerClient creates a client for a customer.
+// @Summary      Add customer client
+// @Description  Create a client with generated credentials and the subscription ID of the customer on a vmess, vless, trojan or shadowsocks inbound. The client has no quota or expiry of its own.
+// @Tags         customers
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id    path      int                    true  "Customer ID"
+// @Param        data  body      CustomerClientRequest  true  "Client"
+// @Success      200   {object}  entity.Msg{obj=model.Client}
+// @Failure      400   {object}  entity.Msg
+// @Router       /customers/addClient/{id} [post]
+// @Router       /v2/customers/{id}/clients [post]
+func (a *CustomerController) addCustomerClient(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	req := &CustomerClientRequest{}
+	if err := c.ShouldBind(req); err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	client, needRestart, err := a.customerService.AddCustomerClient(id, req.InboundId, req.Email)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonMsgObj(c, I18nWeb(c, "pages.inbounds.toasts.inboundClientAddSuccess"), client, nil)
+	if needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+// resetCustomerTraffic resets the traffic of all clients of a customer.
+// @Summary      Reset customer traffic
+// @Description  Reset the traffic of all clients of a customer and enable them again
+// @Tags         customers
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Customer ID"
+// @Success      200  {object}  entity.Msg
+// @Failure      400  {object}  entity.Msg
+// @Router       /customers/resetTraffic/{id} [post]
+// @Router       /v2/customers/{id}/resetTraffic [post]
+func (a *CustomerController) resetCustomerTraffic(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	needRestart, err := a.customerService.ResetCustomerTraffic(id)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.resetInboundClientTrafficSuccess"), nil)
+	if needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+}
@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"strings"
+
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+	"github.com/mhsanaei/3x-ui/v2/web/session"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DebugController serves pprof and goroutine and heap dumps of the panel process. The routes
+// exist only while profiling is enabled in the settings and answer the super admin only.
+type DebugController struct {
+	debugService   service.DebugService
+	settingService service.SettingService
+	userService    service.UserService
+}
+
+// NewDebugController creates a new DebugController and sets up its routes.
+func NewDebugController(g *gin.RouterGroup) *DebugController {
+	a := &DebugController{}
+	a.initRouter(g)
+	return a
+}
+
+// initRouter initializes the debug routes, which are the same in the REST API.
+func (a *DebugController) initRouter(g *gin.RouterGroup) {
+	g.Use(a.checkProfiling)
+	g.GET("/stats", a.getStats)
+	g.GET("/dump/:kind", a.getDump)
+	g.GET("/pprof/*name", a.getPprof)
+}
+
+// checkProfiling hides the debug routes while profiling is disabled and rejects admins other
+// than the super admin.
+func (a *DebugController) checkProfiling(c *gin.Context) {
+	if enable, err := a.settingService.GetProfilingEnable(); err != nil || !enable {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	user := session.GetLoginUser(c)
+	if user == nil || !a.userService.IsSuperAdmin(user.Id) {
+		jsonMsg(c, "", common.NewCodeError(common.ErrCodeForbidden, nil, "debug routes are reserved for the super admin"))
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+// getStats returns the goroutines and memory statistics of the panel process.
+// @Summary      Get process statistics
+// @Description  Get the goroutines and heap statistics of the panel process, to watch memory growth over time. Only served to the super admin while profiling is enabled.
+// @Tags         debug
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=entity.ProcessStats}
+// @Failure      403  {object}  entity.Msg
+// @Failure      404  {object}  entity.Msg
+// @Router       /debug/stats [get]
+// @Router       /v2/debug/stats [get]
+func (a *DebugController) getStats(c *gin.Context) {
+	jsonObj(c, a.debugService.GetProcessStats(), nil)
+}
+
+// getDump downloads a goroutine or heap dump of the panel process.
+// @Summary      Download goroutine or heap dump
+// @Description  Download the full stacks of all goroutines as text, or a heap profile taken after a garbage collection for go tool pprof. Only served to the super admin while profiling is enabled.
+// @Tags         debug
+// @Produce      application/octet-stream
+// @Security     ApiKeyAuth
+// @Param        kind  path      string  true  "goroutine or heap"
+// @Success      200   {file}    file
+// @Failure      403   {object}  entity.Msg
+// @Failure      422   {object}  entity.Msg
+// @Router       /debug/dump/{kind} [get]
+// @Router       /v2/debug/dump/{kind} [get]
+func (a *DebugController) getDump(c *gin.Context) {
+	filename, dump, err := a.debugService.GetDump(c.Param("kind"))
+	if err != nil {
+		jsonMsg(c, "", err)
+		return
+	}
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	c.Data(http.StatusOK, "application/octet-stream", dump)
+}
+
+// getPprof serves the pprof index and profiles, for go tool pprof pointed at the route.
+// @Summary      pprof profiles
+// @Description  Serve the standard pprof index and profiles of the panel process, such as heap, goroutine, allocs, profile for a CPU profile over the seconds parameter and trace. Only served to the super admin while profiling is enabled.
+// @Tags         debug
+// @Produce      application/octet-stream
+// @Security     ApiKeyAuth
+// @Param        name  path      string  true  "Profile name, empty for the index"
+// @Success      200   {file}    file
+// @Failure      403   {object}  entity.Msg
+// @Router       /debug/pprof/{name} [get]
+// @Router       /v2/debug/pprof/{name} [get]
+func (a *DebugController) getPprof(c *gin.Context) {
+	switch name := strings.TrimPrefix(c.Param("name"), "/"); name {
+	case "":
+		// The index links the profiles relative to the route
+		c.Request.URL.Path = "/debug/pprof/"
+		pprof.Index(c.Writer, c.Request)
+	case "cmdline":
+		pprof.Cmdline(c.Writer, c.Request)
+	case "profile":
+		pprof.Profile(c.Writer, c.Request)
+	case "symbol":
+		pprof.Symbol(c.Writer, c.Request)
+	case "trace":
+		pprof.Trace(c.Writer, c.Request)
+	default:
+		pprof.Handler(name).ServeHTTP(c.Writer, c.Request)
+	}
+}
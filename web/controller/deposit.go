@@ -0,0 +1,184 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/link"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DepositController handles deposit tokens, which allow creating a single client on a preset inbound
+// without an API key.
+type DepositController struct {
+	depositService service.DepositService
+	xrayService    service.XrayService
+}
+
+// NewDepositController creates a new DepositController and sets up its routes.
+func NewDepositController(g *gin.RouterGroup) *DepositController {
+	a := &DepositController{}
+	a.initRouter(g)
+	return a
+}
+
+// initRouter initializes the routes for managing deposit tokens.
+func (a *DepositController) initRouter(g *gin.RouterGroup) {
+	g.GET("/list", a.getDepositTokens)
+	g.POST("/add", a.addDepositToken)
+	g.POST("/del/:id", a.delDepositToken)
+}
+
+// initRouterV2 sets up the deposit token routes of the REST API.
+func (a *DepositController) initRouterV2(g *gin.RouterGroup) {
+	g.GET("", a.getDepositTokens)
+	g.POST("", createdStatus, a.addDepositToken)
+	g.DELETE("/:id", a.delDepositToken)
+}
+
+// AddDepositTokenResponse defines the response of a created deposit token.
+type AddDepositTokenResponse struct {
+	Token        string              `json:"token" example:"3fGx9kQ2mWp7vTn1Lr8sYd4hJc6bZa0e"` // Token to hand to the external system, only returned once
+	DepositToken *model.DepositToken `json:"depositToken"`                                     // Stored token settings
+}
+
+// DepositRedeemRequest defines the request body for redeeming a deposit token.
+type DepositRedeemRequest struct {
+	Email    string `json:"email" form:"email" example:"user@example.com"` // Client email, random when empty
+	Referral string `json:"ref" form:"ref" example:"channel42"`            // Referral code the client is attributed to
+}
+
+// ProvisionedClientResponse describes a client created from a deposit token or a plan.
+type ProvisionedClientResponse struct {
+	Email  string `json:"email" example:"user@example.com"`                                        // Client email
+	SubId  string `json:"subId" example:"k3p9xq2m7v1t8n4r"`                                        // Client subscription ID
+	SubURL string `json:"subUrl,omitempty" example:"https://sub.example.com/sub/k3p9xq2m7v1t8n4r"` // Subscription URL, set when the subscription URI is configured
+	Link   string `json:"link" example:"vless://uuid@host:port?type=tcp#email"`                    // Generated config link
+}
+
+// getDepositTokens lists all deposit tokens.
+// @Summary      List deposit tokens
+// @Description  Get all deposit tokens with their preset quota and usage
+// @Tags         deposit
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=[]model.DepositToken}
+// @Failure      401  {object}  entity.Msg
+// @Router       /deposit/list [get]
+// @Router       /v2/deposit [get]
+func (a *DepositController) getDepositTokens(c *gin.Context) {
+	tokens, err := a.depositService.GetDepositTokens()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonObj(c, tokens, nil)
+}
+
+// addDepositToken creates a deposit token for an inbound.
+// @Summary      Create deposit token
+// @Description  Create a limited-use token that lets an external system create one client per use on the given inbound with a preset quota. The token is only returned once.
+// @Tags         deposit
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        data  body      model.DepositToken  true  "Inbound, quota and usage limit"
+// @Success      200   {object}  entity.Msg{obj=AddDepositTokenResponse}
+// @Failure      400   {object}  entity.Msg
+// @Router       /deposit/add [post]
+// @Router       /v2/deposit [post]
+func (a *DepositController) addDepositToken(c *gin.Context) {
+	depositToken := &model.DepositToken{}
+	err := c.ShouldBind(depositToken)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "create"), err)
+		return
+	}
+	token, err := a.depositService.AddDepositToken(depositToken)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "create"), err)
+		return
+	}
+	jsonMsgObj(c, I18nWeb(c, "create"), &AddDepositTokenResponse{
+		Token:        token,
+		DepositToken: depositToken,
+	}, nil)
+}
+
+// delDepositToken deletes a deposit token.
+// @Summary      Delete deposit token
+// @Description  Delete a deposit token. Clients already created with it are kept.
+// @Tags         deposit
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Deposit token ID"
+// @Success      200  {object}  entity.Msg
+// @Failure      400  {object}  entity.Msg
+// @Router       /deposit/del/{id} [post]
+// @Router       /v2/deposit/{id} [delete]
+func (a *DepositController) delDepositToken(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "delete"), err)
+		return
+	}
+	err = a.depositService.DelDepositToken(id)
+	jsonMsg(c, I18nWeb(c, "delete"), err)
+}
+
+// redeem creates a client using a deposit token. This route does not require authentication.
+// @Summary      Redeem deposit token
+// @Description  Create a client on the token's inbound with the token's preset quota. Each call consumes one use of the token.
+// @Tags         deposit
+// @Accept       json
+// @Produce      json
+// @Param        token  path      string                true   "Deposit token"
+// @Param        data   body      DepositRedeemRequest  false  "Client email and referral code"
+// @Success      200    {object}  entity.Msg{obj=ProvisionedClientResponse}
+// @Failure      400    {object}  entity.Msg
+// @Router       /deposit/redeem/{token} [post]
+// @Router       /v2/deposit/redeem/{token} [post]
+func (a *DepositController) redeem(c *gin.Context) {
+	request := &DepositRedeemRequest{}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBind(request); err != nil {
+			jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+			return
+		}
+	}
+	inbound, client, needRestart, err := a.depositService.RedeemDepositToken(c.Param("token"), request.Email, request.Referral)
+	if err != nil {
+		logger.Warning("Deposit token redemption failed from", getRemoteIp(c), ":", err)
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	if needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+	jsonMsgObj(c, I18nWeb(c, "pages.inbounds.toasts.inboundClientAddSuccess"), newProvisionedClientResponse(c, inbound, client), nil)
+}
+
+// newProvisionedClientResponse returns the subscription and link of a created client.
+func newProvisionedClientResponse(c *gin.Context, inbound *model.Inbound, client *model.Client) *ProvisionedClientResponse {
+	var settingService service.SettingService
+	remarkOptions, err := settingService.GetRemarkOptions()
+	if err != nil {
+		logger.Warning("Unable to get remark settings, using defaults:", err)
+	}
+	response := &ProvisionedClientResponse{
+		Email: client.Email,
+		SubId: client.SubID,
+		Link:  getLink(inbound, getHost(c), client.Email, remarkOptions, link.QueryOptions{}),
+	}
+	if subEnable, _ := settingService.GetSubEnable(); subEnable {
+		if subURI, _ := settingService.GetSubURI(); subURI != "" {
+			response.SubURL = subURI + client.SubID
+		}
+	}
+	return response
+}
@@ -0,0 +1,237 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+	"github.com/mhsanaei/3x-ui/v2/web/session"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DNSController handles DNS records managed through the configured DNS provider.
+type DNSController struct {
+	dnsService      service.DNSService
+	inboundService  service.InboundService
+	cdnSetupService service.CdnSetupService
+}
+
+// NewDNSController creates a new DNSController and sets up its routes.
+func NewDNSController(g *gin.RouterGroup) *DNSController {
+	a := &DNSController{}
+	a.initRouter(g)
+	return a
+}
+
+// initRouter initializes the routes for managing DNS records.
+func (a *DNSController) initRouter(g *gin.RouterGroup) {
+	g.POST("/record", a.setRecord)
+	g.POST("/record/del", a.delRecord)
+	g.POST("/inbound/:id", a.syncInbound)
+	g.POST("/acme/present", a.presentAcmeChallenge)
+	g.POST("/acme/cleanup", a.cleanupAcmeChallenge)
+	g.POST("/cdn/setup", a.setupCdn)
+	g.POST("/cdn/check/:id", a.checkCdn)
+}
+
+// initRouterV2 sets up the DNS routes of the REST API.
+func (a *DNSController) initRouterV2(g *gin.RouterGroup) {
+	g.PUT("/records", a.setRecord)
+	g.DELETE("/records", a.delRecord)
+	g.POST("/inbounds/:id", a.syncInbound)
+	g.POST("/acme", a.presentAcmeChallenge)
+	g.DELETE("/acme", a.cleanupAcmeChallenge)
+	g.POST("/cdn", createdStatus, a.setupCdn)
+	g.GET("/cdn/inbounds/:id", a.checkCdn)
+}
+
+// setRecord creates or updates a DNS record.
+// @Summary      Set DNS record
+// @Description  Create an A, AAAA, CNAME or TXT record, or update the existing record of the same type and name, through the configured DNS provider
+// @Tags         dns
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        record  body      entity.DNSRecord  true  "DNS record"
+// @Success      200     {object}  entity.Msg
+// @Failure      400     {object}  entity.Msg
+// @Router       /dns/record [post]
+// @Router       /v2/dns/records [put]
+func (a *DNSController) setRecord(c *gin.Context) {
+	record := entity.DNSRecord{}
+	if err := c.ShouldBind(&record); err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.dnsRecordSet"), err)
+		return
+	}
+	err := a.dnsService.SetRecord(record)
+	jsonMsg(c, I18nWeb(c, "pages.settings.toasts.dnsRecordSet"), err)
+}
+
+// delRecord removes a DNS record.
+// @Summary      Delete DNS record
+// @Description  Remove the records of the given type and name through the configured DNS provider, only those with the given content when it is set
+// @Tags         dns
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        record  body      entity.DNSRecord  true  "DNS record"
+// @Success      200     {object}  entity.Msg
+// @Failure      400     {object}  entity.Msg
+// @Router       /dns/record/del [post]
+// @Router       /v2/dns/records [delete]
+func (a *DNSController) delRecord(c *gin.Context) {
+	record := entity.DNSRecord{}
+	if err := c.ShouldBind(&record); err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.dnsRecordDeleted"), err)
+		return
+	}
+	err := a.dnsService.DeleteRecord(record)
+	jsonMsg(c, I18nWeb(c, "pages.settings.toasts.dnsRecordDeleted"), err)
+}
+
+// syncInbound points the domains of an inbound at this server.
+// @Summary      Sync inbound DNS records
+// @Description  Create or update the records of the inbound's TLS server name and external proxy domains: a CNAME record to the configured target, or A and AAAA records to the public addresses
+// @Tags         dns
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Inbound ID"
+// @Success      200  {object}  entity.Msg{obj=[]entity.DNSRecord}
+// @Failure      400  {object}  entity.Msg
+// @Failure      404  {object}  entity.Msg
+// @Router       /dns/inbound/{id} [post]
+// @Router       /v2/dns/inbounds/{id} [post]
+func (a *DNSController) syncInbound(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.dnsInboundSynced"), err)
+		return
+	}
+	inbound, err := a.inboundService.GetInbound(id)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	records, err := a.dnsService.SyncInboundRecords(inbound)
+	jsonMsgObj(c, I18nWeb(c, "pages.settings.toasts.dnsInboundSynced"), records, err)
+}
+
+// presentAcmeChallenge publishes an ACME DNS-01 challenge.
+// @Summary      Present ACME challenge
+// @Description  Publish the TXT record _acme-challenge.<domain> of an ACME DNS-01 challenge, for use by the certificate client's DNS hook. Wildcard domains use the record of their base domain.
+// @Tags         dns
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        challenge  body      entity.AcmeChallenge  true  "ACME challenge"
+// @Success      200        {object}  entity.Msg
+// @Failure      400        {object}  entity.Msg
+// @Router       /dns/acme/present [post]
+// @Router       /v2/dns/acme [post]
+func (a *DNSController) presentAcmeChallenge(c *gin.Context) {
+	challenge := entity.AcmeChallenge{}
+	if err := c.ShouldBind(&challenge); err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.dnsAcmePresented"), err)
+		return
+	}
+	err := a.dnsService.PresentAcmeChallenge(challenge)
+	jsonMsg(c, I18nWeb(c, "pages.settings.toasts.dnsAcmePresented"), err)
+}
+
+// cleanupAcmeChallenge removes an ACME DNS-01 challenge.
+// @Summary      Clean up ACME challenge
+// @Description  Remove the TXT record of an ACME DNS-01 challenge once the certificate is issued. Without a value all challenge records of the domain are removed.
+// @Tags         dns
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        challenge  body      entity.AcmeChallenge  true  "ACME challenge"
+// @Success      200        {object}  entity.Msg
+// @Failure      400        {object}  entity.Msg
+// @Router       /dns/acme/cleanup [post]
+// @Router       /v2/dns/acme [delete]
+func (a *DNSController) cleanupAcmeChallenge(c *gin.Context) {
+	challenge := entity.AcmeChallenge{}
+	if err := c.ShouldBind(&challenge); err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.dnsAcmeCleaned"), err)
+		return
+	}
+	err := a.dnsService.CleanupAcmeChallenge(challenge)
+	jsonMsg(c, I18nWeb(c, "pages.settings.toasts.dnsAcmeCleaned"), err)
+}
+
+// CdnSetupRequest defines the domain and inbound the CDN assistant sets up.
+type CdnSetupRequest struct {
+	Domain    string `json:"domain" form:"domain" example:"cdn.example.com"`           // Domain in a Cloudflare zone
+	ApiToken  string `json:"apiToken" form:"apiToken" example:"cf-token"`              // Cloudflare API token with DNS edit rights, the DNS provider token when empty
+	Transport string `json:"transport" form:"transport" example:"xhttp"`               // xhttp or ws
+	Port      int    `json:"port" form:"port" example:"443"`                           // Inbound port, 443 with a certificate and 80 without when 0
+	CertFile  string `json:"certFile" form:"certFile" example:"/root/cert/origin.pem"` // Origin certificate file, plain HTTP behind Flexible SSL without it
+	KeyFile   string `json:"keyFile" form:"keyFile" example:"/root/cert/origin.key"`   // Key file of the certificate
+	Remark    string `json:"remark" form:"remark" example:"CDN"`                       // Inbound remark
+	Email     string `json:"email" form:"email" example:"alice"`                       // Email of the client, random when empty
+}
+
+// setupCdn sets up an inbound behind Cloudflare.
+// @Summary      Set up inbound behind Cloudflare
+// @Description  Create a VLESS XHTTP or WebSocket inbound for the domain with a matching host, server name and external proxy, point proxied A and AAAA records of the domain at this server, restart Xray and request the inbound through Cloudflare. Returns the records, the SSL/TLS mode the zone needs, the reachability check, and the link and subscription URL of the created client. The inbound and records are kept when the check fails; check again later with the check route.
+// @Tags         dns
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        data  body      CdnSetupRequest  true  "Domain and inbound"
+// @Success      200   {object}  entity.Msg{obj=entity.CdnSetup}
+// @Failure      400   {object}  entity.Msg
+// @Router       /dns/cdn/setup [post]
+// @Router       /v2/dns/cdn [post]
+func (a *DNSController) setupCdn(c *gin.Context) {
+	req := &CdnSetupRequest{}
+	if err := c.ShouldBind(req); err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	result, err := a.cdnSetupService.Setup(service.CdnSetupOptions{
+		Domain:    req.Domain,
+		ApiToken:  req.ApiToken,
+		Transport: req.Transport,
+		Port:      req.Port,
+		CertFile:  req.CertFile,
+		KeyFile:   req.KeyFile,
+		Remark:    req.Remark,
+		Email:     req.Email,
+		UserId:    session.GetLoginUser(c).Id,
+	})
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonMsgObj(c, I18nWeb(c, "pages.inbounds.toasts.inboundCreateSuccess"), result, nil)
+}
+
+// checkCdn checks an inbound is reachable through the CDN.
+// @Summary      Check inbound through CDN
+// @Description  Request the WebSocket or XHTTP path of an inbound through the domain of its first external proxy and report whether Cloudflare reached the inbound
+// @Tags         dns
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Inbound ID"
+// @Success      200  {object}  entity.Msg{obj=entity.CdnCheck}
+// @Failure      400  {object}  entity.Msg
+// @Router       /dns/cdn/check/{id} [post]
+// @Router       /v2/dns/cdn/inbounds/{id} [get]
+func (a *DNSController) checkCdn(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	check, err := a.cdnSetupService.CheckInboundCdn(id)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonObj(c, check, nil)
+}
@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HealthController handles the liveness and readiness probes of containers and load balancers.
+type HealthController struct {
+	serverService service.ServerService
+	userService   service.UserService
+}
+
+// NewHealthController creates a new HealthController and sets up its routes.
+func NewHealthController(g *gin.RouterGroup) *HealthController {
+	a := &HealthController{}
+	a.initRouter(g)
+	return a
+}
+
+// initRouter initializes the probe routes under the web base path.
+func (a *HealthController) initRouter(g *gin.RouterGroup) {
+	g.GET("/healthz", a.healthz)
+	g.GET("/readyz", a.checkApiKey, a.readyz)
+}
+
+// checkApiKey lets requests with a valid API key through and answers others with 404, like the
+// API does. Probes cannot log in, so the session is not checked.
+func (a *HealthController) checkApiKey(c *gin.Context) {
+	apiKey := c.GetHeader("X-API-Key")
+	if apiKey == "" {
+		apiKey = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	}
+	if apiKey != "" {
+		if user, err := a.userService.GetUserByApiKey(apiKey); err == nil && user != nil {
+			c.Next()
+			return
+		}
+	}
+	c.AbortWithStatus(http.StatusNotFound)
+}
+
+// healthz reports that the web server is up. It needs no authentication, only the web base path.
+func (a *HealthController) healthz(c *gin.Context) {
+	c.String(http.StatusOK, "ok")
+}
+
+// readyz reports whether the panel is ready to serve clients: 200 when every check passes and
+// 503 otherwise, with the result of each check.
+func (a *HealthController) readyz(c *gin.Context) {
+	readiness := a.serverService.CheckReadiness()
+	status := http.StatusOK
+	if !readiness.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, readiness)
+}
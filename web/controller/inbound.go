@@ -1,25 +1,42 @@
 package controller
 
 import (
+	"context"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"io"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/mhsanaei/3x-ui/v2/database/model"
 	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/util/link"
 	"github.com/mhsanaei/3x-ui/v2/util/random"
+	"github.com/mhsanaei/3x-ui/v2/util/spreadsheet"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+	"github.com/mhsanaei/3x-ui/v2/web/middleware"
 	"github.com/mhsanaei/3x-ui/v2/web/service"
 	"github.com/mhsanaei/3x-ui/v2/web/session"
 
 	"github.com/gin-gonic/gin"
 )
 
+// maxClientImportSize bounds the size of a client import file.
+const maxClientImportSize = 8 << 20
+
 // InboundController handles HTTP requests related to Xray inbounds management.
 type InboundController struct {
-	inboundService service.InboundService
-	xrayService    service.XrayService
+	inboundService       service.InboundService
+	inboundHealthService service.InboundHealthService
+	realityCheckService  service.RealityCheckService
+	dnsService           service.DNSService
+	settingService       service.SettingService
+	xrayService          service.XrayService
+	jobService           service.JobService
 }
 
 // NewInboundController creates a new InboundController and sets up its routes.
@@ -32,15 +49,22 @@ func NewInboundController(g *gin.RouterGroup) *InboundController {
 // initRouter initializes the routes for inbound-related operations.
 func (a *InboundController) initRouter(g *gin.RouterGroup) {
 
-	g.GET("/list", a.getInbounds)
+	g.GET("/list", middleware.ETagMiddleware(), a.getInbounds)
 	g.GET("/get/:id", a.getInbound)
+	g.GET("/getByExternalId/:externalId", a.getInboundByExternalId)
+	g.GET("/getClientByExternalId/:externalId", a.getClientByExternalId)
 	g.GET("/getClientTraffics/:email", a.getClientTraffics)
 	g.GET("/getClientTrafficsById/:id", a.getClientTrafficsById)
 
 	g.POST("/add", a.addInbound)
+	g.GET("/presets", a.getInboundPresets)
+	g.POST("/addPreset", a.addPresetInbound)
+	g.POST("/wizard", a.inboundWizard)
 	g.POST("/del/:id", a.delInbound)
 	g.POST("/update/:id", a.updateInbound)
-	g.POST("/clientIps/:email", a.getClientIps)
+	g.POST("/:id/enable", a.enableInbound)
+	g.POST("/:id/disable", a.disableInbound)
+	g.POST("/clientIps/:email", middleware.ReadOnlyAllowed, a.getClientIps)
 	g.POST("/clearClientIps/:email", a.clearClientIps)
 	g.POST("/addClient", a.addInboundClient)
 	g.POST("/addClientWithLink", a.addInboundClientWithLink)
@@ -51,10 +75,105 @@ func (a *InboundController) initRouter(g *gin.RouterGroup) {
 	g.POST("/resetAllClientTraffics/:id", a.resetAllClientTraffics)
 	g.POST("/delDepletedClients/:id", a.delDepletedClients)
 	g.POST("/import", a.importInbound)
-	g.POST("/onlines", a.onlines)
-	g.POST("/lastOnline", a.lastOnline)
+	g.POST("/:id/importClients", a.importClients)
+	g.GET("/exportClients", a.exportClients)
+	g.GET("/export", a.exportInbounds)
+	g.GET("/:id/export", a.exportInbound)
+	g.POST("/onlines", middleware.ReadOnlyAllowed, a.onlines)
+	g.GET("/speeds", a.speeds)
+	g.POST("/lastOnline", middleware.ReadOnlyAllowed, a.lastOnline)
+	g.GET("/inactiveClients", a.getInactiveClients)
+	g.POST("/inactiveClients/disable", a.disableInactiveClients)
 	g.POST("/updateClientTraffic/:email", a.updateClientTraffic)
+	g.POST("/adjustClientTraffic/:email", a.adjustClientTraffic)
+	g.GET("/trafficAdjustments", a.getTrafficAdjustments)
+	g.POST("/pauseClient/:email", a.pauseClient)
+	g.POST("/resumeClient/:email", a.resumeClient)
 	g.POST("/:id/delClientByEmail/:email", a.delInboundClientByEmail)
+	g.GET("/:id/sniffing", a.getInboundSniffing)
+	g.POST("/:id/updateSniffing", a.updateInboundSniffing)
+	g.GET("/:id/sockopt", a.getInboundSockopt)
+	g.POST("/:id/updateSockopt", a.updateInboundSockopt)
+	g.GET("/:id/certificate", a.getInboundCertificate)
+	g.POST("/:id/certificate", a.setInboundCertificate)
+	g.POST("/:id/mldsa65/rotate", a.rotateInboundMldsa65)
+	g.POST("/:id/mldsa65/del", a.delInboundMldsa65)
+	g.POST("/:id/convert", a.convertInbound)
+	g.GET("/:id/clientOutbound/:email", a.getClientOutbound)
+	g.GET("/clientTags", a.getClientTags)
+	g.GET("/clientsByTag", a.getClientsByTag)
+	g.POST("/clientsByTag/action", a.clientActionByTag)
+	g.GET("/groups", a.getInboundGroups)
+	g.POST("/groups/action", a.inboundGroupAction)
+	g.GET("/health", a.getInboundHealth)
+	g.GET("/realityChecks", a.getRealityChecks)
+	g.POST("/realityChecks/run", a.runRealityChecks)
+}
+
+// initRouterV2 sets up the inbound routes of the REST API.
+func (a *InboundController) initRouterV2(g *gin.RouterGroup) {
+	g.GET("", middleware.ETagMiddleware(), a.getInbounds)
+	g.POST("", createdStatus, a.addInbound)
+	g.GET("/presets", a.getInboundPresets)
+	g.POST("/presets", createdStatus, a.addPresetInbound)
+	g.POST("/wizard", a.inboundWizard)
+	g.GET("/:id", a.getInbound)
+	g.GET("/ext/:externalId", a.getInboundByExternalId)
+	g.PUT("/:id", a.updateInbound)
+	g.DELETE("/:id", a.delInbound)
+	g.POST("/:id/enable", a.enableInbound)
+	g.POST("/:id/disable", a.disableInbound)
+	g.GET("/:id/export", a.exportInbound)
+	g.GET("/:id/sniffing", a.getInboundSniffing)
+	g.PUT("/:id/sniffing", a.updateInboundSniffing)
+	g.GET("/:id/sockopt", a.getInboundSockopt)
+	g.PUT("/:id/sockopt", a.updateInboundSockopt)
+	g.GET("/:id/certificate", a.getInboundCertificate)
+	g.PUT("/:id/certificate", a.setInboundCertificate)
+	g.POST("/:id/mldsa65/rotate", a.rotateInboundMldsa65)
+	g.DELETE("/:id/mldsa65", a.delInboundMldsa65)
+	g.POST("/:id/convert", a.convertInbound)
+	g.GET("/:id/clientOutbound/:email", a.getClientOutbound)
+	g.DELETE("/:id/clients/:clientId", a.delInboundClient)
+	g.DELETE("/:id/clientsByEmail/:email", a.delInboundClientByEmail)
+	g.DELETE("/:id/clientTraffic/:email", a.resetClientTraffic)
+	g.DELETE("/:id/traffic", a.resetAllClientTraffics)
+	g.DELETE("/:id/depletedClients", a.delDepletedClients)
+	g.DELETE("/traffic", a.resetAllTraffics)
+	g.GET("/export", a.exportInbounds)
+	g.POST("/import", createdStatus, a.importInbound)
+	g.POST("/:id/clients/import", a.importClients)
+	g.GET("/onlines", a.onlines)
+	g.GET("/speeds", a.speeds)
+	g.GET("/lastOnline", a.lastOnline)
+	g.GET("/groups", a.getInboundGroups)
+	g.POST("/groups/action", a.inboundGroupAction)
+	g.GET("/health", a.getInboundHealth)
+	g.GET("/realityChecks", a.getRealityChecks)
+	g.POST("/realityChecks/run", a.runRealityChecks)
+}
+
+// initClientRouterV2 sets up the client routes of the REST API.
+func (a *InboundController) initClientRouterV2(g *gin.RouterGroup) {
+	g.POST("", createdStatus, a.addInboundClient)
+	g.POST("/withLink", createdStatus, a.addInboundClientWithLink)
+	g.GET("/export", a.exportClients)
+	g.GET("/inactive", a.getInactiveClients)
+	g.POST("/inactive/disable", a.disableInactiveClients)
+	g.PUT("/:clientId", a.updateInboundClient)
+	g.GET("/ext/:externalId", a.getClientByExternalId)
+	g.GET("/byId/:id/traffic", a.getClientTrafficsById)
+	g.GET("/email/:email/traffic", a.getClientTraffics)
+	g.PUT("/email/:email/traffic", a.updateClientTraffic)
+	g.POST("/email/:email/traffic/adjustments", createdStatus, a.adjustClientTraffic)
+	g.GET("/trafficAdjustments", a.getTrafficAdjustments)
+	g.GET("/email/:email/ips", a.getClientIps)
+	g.DELETE("/email/:email/ips", a.clearClientIps)
+	g.POST("/email/:email/pause", a.pauseClient)
+	g.POST("/email/:email/resume", a.resumeClient)
+	g.GET("/tags", a.getClientTags)
+	g.GET("/byTag", a.getClientsByTag)
+	g.POST("/byTag/action", a.clientActionByTag)
 }
 
 // getInbounds retrieves the list of inbounds for the logged-in user.
@@ -68,6 +187,7 @@ func (a *InboundController) initRouter(g *gin.RouterGroup) {
 // @Failure      400  {object}  entity.Msg
 // @Failure      401  {object}  entity.Msg
 // @Router       /inbounds/list [get]
+// @Router       /v2/inbounds [get]
 func (a *InboundController) getInbounds(c *gin.Context) {
 	user := session.GetLoginUser(c)
 	inbounds, err := a.inboundService.GetInbounds(user.Id)
@@ -90,6 +210,7 @@ func (a *InboundController) getInbounds(c *gin.Context) {
 // @Failure      400  {object}  entity.Msg
 // @Failure      404  {object}  entity.Msg
 // @Router       /inbounds/get/{id} [get]
+// @Router       /v2/inbounds/{id} [get]
 func (a *InboundController) getInbound(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -104,6 +225,99 @@ func (a *InboundController) getInbound(c *gin.Context) {
 	jsonObj(c, inbound, nil)
 }
 
+// getClientOutbound renders the Xray outbounds connecting to an inbound as one of its clients.
+// @Summary      Get client outbound
+// @Description  Get the ready-to-paste Xray outbound connecting to the inbound as the client, one for each external proxy like the share links. With full=true each comes with a minimal client config around it, a mixed proxy on 127.0.0.1:10808. Takes the same link options as subscriptions.
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id             path      int     true   "Inbound ID"
+// @Param        email          path      string  true   "Client email"
+// @Param        full           query     bool    false  "Include a complete client config"
+// @Param        port           query     int     false  "Port to connect to instead of the inbound port"
+// @Param        label          query     string  false  "Remark of the outbounds"
+// @Param        deterministic  query     bool    false  "Use the first REALITY server name and short ID"
+// @Success      200            {object}  entity.Msg{obj=[]link.ClientOutbound}
+// @Failure      400            {object}  entity.Msg
+// @Failure      404            {object}  entity.Msg
+// @Router       /inbounds/{id}/clientOutbound/{email} [get]
+// @Router       /v2/inbounds/{id}/clientOutbound/{email} [get]
+func (a *InboundController) getClientOutbound(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "get"), err)
+		return
+	}
+	query, err := link.ParseQuery(c.Request.URL.Query())
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "get"), err)
+		return
+	}
+	inbound, err := a.inboundService.GetInbound(id)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	remarkOptions, err := a.settingService.GetRemarkOptions()
+	if err != nil {
+		logger.Warning("Unable to get remark settings, using defaults:", err)
+	}
+	outbounds := link.ClientOutbounds(inbound, c.Param("email"), query.Apply(getHost(c), remarkOptions))
+	if outbounds == nil {
+		jsonMsg(c, I18nWeb(c, "get"), common.NewCodeError(common.ErrCodeClientNotFound, nil, "no client outbound for", c.Param("email")))
+		return
+	}
+	if c.Query("full") == "true" {
+		for i := range outbounds {
+			outbounds[i].Config = link.ClientConfig(outbounds[i].Outbound, outbounds[i].Remark)
+		}
+	}
+	jsonObj(c, outbounds, nil)
+}
+
+// getInboundByExternalId retrieves an inbound by its stable external ID.
+// @Summary      Get inbound by external ID
+// @Description  Get an inbound by the UUID in its externalId field. Unlike the numeric ID the external ID can be chosen on create and is kept across backups, imports and re-creation, for tools like Terraform that track resources by their own ID.
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        externalId  path      string  true  "Inbound external ID"
+// @Success      200         {object}  entity.Msg{obj=model.Inbound}
+// @Failure      404         {object}  entity.Msg
+// @Router       /inbounds/getByExternalId/{externalId} [get]
+// @Router       /v2/inbounds/ext/{externalId} [get]
+func (a *InboundController) getInboundByExternalId(c *gin.Context) {
+	inbound, err := a.inboundService.GetInboundByExternalId(c.Param("externalId"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	jsonObj(c, inbound, nil)
+}
+
+// getClientByExternalId retrieves a client by its stable external ID.
+// @Summary      Get client by external ID
+// @Description  Get a client by the UUID in its externalId field, with the numeric and external ID of the inbound it belongs to
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        externalId  path      string  true  "Client external ID"
+// @Success      200         {object}  entity.Msg{obj=entity.ExternalClient}
+// @Failure      404         {object}  entity.Msg
+// @Router       /inbounds/getClientByExternalId/{externalId} [get]
+// @Router       /v2/clients/ext/{externalId} [get]
+func (a *InboundController) getClientByExternalId(c *gin.Context) {
+	inbound, client, err := a.inboundService.GetClientByExternalId(c.Param("externalId"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	jsonObj(c, entity.ExternalClient{InboundId: inbound.Id, InboundExternalId: inbound.ExternalId, Client: *client}, nil)
+}
+
 // getClientTraffics retrieves client traffic information by email.
 // @Summary      Get client traffic by email
 // @Description  Retrieve traffic statistics for a specific client by email address
@@ -115,6 +329,7 @@ func (a *InboundController) getInbound(c *gin.Context) {
 // @Success      200    {object}  entity.Msg
 // @Failure      400    {object}  entity.Msg
 // @Router       /inbounds/getClientTraffics/{email} [get]
+// @Router       /v2/clients/email/{email}/traffic [get]
 func (a *InboundController) getClientTraffics(c *gin.Context) {
 	email := c.Param("email")
 	clientTraffics, err := a.inboundService.GetClientTrafficByEmail(email)
@@ -136,6 +351,7 @@ func (a *InboundController) getClientTraffics(c *gin.Context) {
 // @Success      200  {object}  entity.Msg
 // @Failure      400  {object}  entity.Msg
 // @Router       /inbounds/getClientTrafficsById/{id} [get]
+// @Router       /v2/clients/byId/{id}/traffic [get]
 func (a *InboundController) getClientTrafficsById(c *gin.Context) {
 	id := c.Param("id")
 	clientTraffics, err := a.inboundService.GetClientTrafficByID(id)
@@ -148,7 +364,7 @@ func (a *InboundController) getClientTrafficsById(c *gin.Context) {
 
 // addInbound creates a new inbound configuration.
 // @Summary      Add new inbound
-// @Description  Create a new inbound configuration
+// @Description  Create a new inbound configuration. externalId is a UUID generated when omitted; when an inbound with the given externalId exists it is returned unchanged, so retrying a create is safe. Omitted fields default to: enable false, listen all addresses, total, expiryTime, speedLimit, connLimit and connLimitPerIp 0 (unlimited or never), trafficReset "never", portHopRange and extraPorts empty (no hopping, main port only). Clients without an externalId get one generated.
 // @Tags         inbounds
 // @Accept       json
 // @Produce      json
@@ -157,6 +373,7 @@ func (a *InboundController) getClientTrafficsById(c *gin.Context) {
 // @Success      200      {object}  entity.Msg{obj=model.Inbound}
 // @Failure      400      {object}  entity.Msg
 // @Router       /inbounds/add [post]
+// @Router       /v2/inbounds [post]
 func (a *InboundController) addInbound(c *gin.Context) {
 	inbound := &model.Inbound{}
 	err := c.ShouldBind(inbound)
@@ -181,11 +398,218 @@ func (a *InboundController) addInbound(c *gin.Context) {
 	if needRestart {
 		a.xrayService.SetToNeedRestart()
 	}
+	a.dnsService.AutoRecordInbound(inbound)
+}
+
+// InboundPresetRequest defines the inbound to create from a preset.
+type InboundPresetRequest struct {
+	Preset      string `json:"preset" form:"preset" example:"reality-vision"`              // Preset name
+	Remark      string `json:"remark" form:"remark" example:"Reality"`                     // Inbound remark, the preset title when empty
+	Port        int    `json:"port" form:"port" example:"443"`                             // Inbound port, the preset default when 0
+	Domain      string `json:"domain" form:"domain" example:"cdn.example.com"`             // Domain proxied by the CDN, for the CDN presets
+	Target      string `json:"target" form:"target" example:"www.microsoft.com:443"`       // Reality target site
+	ServerNames string `json:"serverNames" form:"serverNames" example:"www.microsoft.com"` // Comma separated Reality server names
+	Mldsa65     bool   `json:"mldsa65" form:"mldsa65" example:"false"`                     // Sign Reality handshakes with a post-quantum ML-DSA-65 key
+	CertFile    string `json:"certFile" form:"certFile" example:"/root/cert/cert.pem"`     // Certificate file for TLS
+	KeyFile     string `json:"keyFile" form:"keyFile" example:"/root/cert/key.pem"`        // Key file of the certificate
+	Email       string `json:"email" form:"email" example:"alice"`                         // Email of the first client, random when empty
+}
+
+// getInboundPresets lists the inbound presets.
+// @Summary      List inbound presets
+// @Description  Get the presets inbounds can be created from with recommended anti-DPI parameters
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=[]service.InboundPreset}
+// @Failure      401  {object}  entity.Msg
+// @Router       /inbounds/presets [get]
+// @Router       /v2/inbounds/presets [get]
+func (a *InboundController) getInboundPresets(c *gin.Context) {
+	jsonObj(c, service.InboundPresets, nil)
+}
+
+// addPresetInbound creates an inbound from a preset.
+// @Summary      Create inbound from preset
+// @Description  Create a VLESS inbound set up by a preset (reality-vision, xhttp-cdn or ws-tls-cloudflare) with one client, generated Reality keys and short IDs or a random path, sniffing and, for the CDN presets, an external proxy pointing links to the domain on port 443.
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        data  body      InboundPresetRequest  true  "Preset and its values"
+// @Success      200   {object}  entity.Msg{obj=model.Inbound}
+// @Failure      400   {object}  entity.Msg
+// @Router       /inbounds/addPreset [post]
+// @Router       /v2/inbounds/presets [post]
+func (a *InboundController) addPresetInbound(c *gin.Context) {
+	req := &InboundPresetRequest{}
+	if err := c.ShouldBind(req); err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	inbound, err := service.BuildPresetInbound(service.InboundPresetOptions{
+		Preset:      req.Preset,
+		Remark:      req.Remark,
+		Port:        req.Port,
+		Domain:      req.Domain,
+		Target:      req.Target,
+		ServerNames: req.ServerNames,
+		Mldsa65:     req.Mldsa65,
+		CertFile:    req.CertFile,
+		KeyFile:     req.KeyFile,
+		Email:       req.Email,
+	})
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	inbound.UserId = session.GetLoginUser(c).Id
+	inbound.Tag = fmt.Sprintf("inbound-%v", inbound.Port)
+
+	inbound, needRestart, err := a.inboundService.AddInbound(inbound)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonMsgObj(c, I18nWeb(c, "pages.inbounds.toasts.inboundCreateSuccess"), inbound, nil)
+	if needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+	a.dnsService.AutoRecordInbound(inbound)
+}
+
+// InboundWizardRequest describes the inbound wanted from the wizard in high-level terms.
+type InboundWizardRequest struct {
+	Protocol    string `json:"protocol" form:"protocol" example:"vless"`                   // vless, vmess, trojan or shadowsocks, vless when empty
+	Transport   string `json:"transport" form:"transport" example:"xhttp"`                 // tcp, ws, grpc, xhttp or httpupgrade, chosen when empty
+	Security    string `json:"security" form:"security" example:"tls"`                     // none, tls or reality, chosen when empty
+	Domain      string `json:"domain" form:"domain" example:"vpn.example.com"`             // Domain clients reach the server at
+	BehindCdn   bool   `json:"behindCdn" form:"behindCdn" example:"true"`                  // Whether clients connect through a CDN proxying the domain
+	Port        int    `json:"port" form:"port" example:"443"`                             // Inbound port, chosen from the security when 0
+	Remark      string `json:"remark" form:"remark" example:"Main"`                        // Inbound remark
+	Target      string `json:"target" form:"target" example:"www.microsoft.com:443"`       // Reality target site
+	ServerNames string `json:"serverNames" form:"serverNames" example:"www.microsoft.com"` // Comma separated Reality server names
+	CertFile    string `json:"certFile" form:"certFile" example:"/root/cert/cert.pem"`     // Certificate file for TLS, the panel certificate when empty
+	KeyFile     string `json:"keyFile" form:"keyFile" example:"/root/cert/key.pem"`        // Key file of the certificate
+	Email       string `json:"email" form:"email" example:"alice"`                         // Email of the first client, random when empty
+	Create      bool   `json:"create" form:"create" example:"false"`                       // Create the inbound instead of only returning it
+}
+
+// inboundWizard builds a complete inbound from a high-level description and optionally creates it.
+// @Summary      Inbound wizard
+// @Description  Build a validated inbound from the protocol, transport, security, domain and whether it is behind a CDN, with a client, certificates, keys, paths and sniffing filled in. Values left out are chosen to fit the others, and combinations that cannot work are rejected with the reason. The inbound is returned for review, or created when create is true.
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        data  body      InboundWizardRequest  true  "Wanted inbound"
+// @Success      200   {object}  entity.Msg{obj=model.Inbound}
+// @Success      201   {object}  entity.Msg{obj=model.Inbound}
+// @Failure      400   {object}  entity.Msg
+// @Router       /inbounds/wizard [post]
+// @Router       /v2/inbounds/wizard [post]
+func (a *InboundController) inboundWizard(c *gin.Context) {
+	req := &InboundWizardRequest{}
+	if err := c.ShouldBind(req); err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	inbound, err := a.inboundService.BuildWizardInbound(service.InboundWizardOptions{
+		Protocol:    model.Protocol(strings.ToLower(strings.TrimSpace(req.Protocol))),
+		Transport:   strings.ToLower(strings.TrimSpace(req.Transport)),
+		Security:    strings.ToLower(strings.TrimSpace(req.Security)),
+		Domain:      req.Domain,
+		BehindCdn:   req.BehindCdn,
+		Port:        req.Port,
+		Remark:      req.Remark,
+		Target:      req.Target,
+		ServerNames: req.ServerNames,
+		CertFile:    req.CertFile,
+		KeyFile:     req.KeyFile,
+		Email:       req.Email,
+		UserId:      session.GetLoginUser(c).Id,
+	})
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	if !req.Create {
+		jsonObj(c, inbound, nil)
+		return
+	}
+
+	inbound, needRestart, err := a.inboundService.AddInbound(inbound)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	c.Set(createdStatusKey, true)
+	jsonMsgObj(c, I18nWeb(c, "pages.inbounds.toasts.inboundCreateSuccess"), inbound, nil)
+	if needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+	a.dnsService.AutoRecordInbound(inbound)
+}
+
+// InboundConvertRequest describes the transport and security an inbound is converted to.
+type InboundConvertRequest struct {
+	Transport   string `json:"transport" form:"transport" example:"xhttp"`                 // tcp, ws, grpc, xhttp or httpupgrade, the current one when empty
+	Security    string `json:"security" form:"security" example:"reality"`                 // none, tls or reality, the current one when empty
+	Domain      string `json:"domain" form:"domain" example:"vpn.example.com"`             // Domain clients reach the server at, the TLS server name when empty
+	BehindCdn   bool   `json:"behindCdn" form:"behindCdn" example:"false"`                 // Whether clients connect through a CDN proxying the domain
+	Target      string `json:"target" form:"target" example:"www.microsoft.com:443"`       // Reality target site, new keys are generated when set
+	ServerNames string `json:"serverNames" form:"serverNames" example:"www.microsoft.com"` // Comma separated Reality server names
+	CertFile    string `json:"certFile" form:"certFile" example:"/root/cert/cert.pem"`     // Certificate file for TLS
+	KeyFile     string `json:"keyFile" form:"keyFile" example:"/root/cert/key.pem"`        // Key file of the certificate
+}
+
+// convertInbound moves an inbound to another transport and security.
+// @Summary      Convert inbound
+// @Description  Convert an inbound to another transport and security, for example from WebSocket with TLS to XHTTP with REALITY. Clients, port, tag and traffic are kept and the new keys and paths are generated, so subscriptions serve the new links right away. REALITY keys are kept when the inbound stays on REALITY, and the TLS settings when it stays on TLS without a new certificate.
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id    path      int                    true  "Inbound ID"
+// @Param        data  body      InboundConvertRequest  true  "New transport and security"
+// @Success      200   {object}  entity.Msg{obj=model.Inbound}
+// @Failure      400   {object}  entity.Msg
+// @Router       /inbounds/{id}/convert [post]
+// @Router       /v2/inbounds/{id}/convert [post]
+func (a *InboundController) convertInbound(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.inboundUpdateSuccess"), err)
+		return
+	}
+	req := &InboundConvertRequest{}
+	if err := c.ShouldBind(req); err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.inboundUpdateSuccess"), err)
+		return
+	}
+	inbound, needRestart, err := a.inboundService.ConvertInbound(id, service.InboundWizardOptions{
+		Transport:   strings.ToLower(strings.TrimSpace(req.Transport)),
+		Security:    strings.ToLower(strings.TrimSpace(req.Security)),
+		Domain:      req.Domain,
+		BehindCdn:   req.BehindCdn,
+		Target:      req.Target,
+		ServerNames: req.ServerNames,
+		CertFile:    req.CertFile,
+		KeyFile:     req.KeyFile,
+	})
+	if needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+	if err == nil {
+		logger.Infof("Inbound %d converted from %s", id, getRemoteIp(c))
+	}
+	jsonMsgObj(c, I18nWeb(c, "pages.inbounds.toasts.inboundUpdateSuccess"), inbound, err)
 }
 
 // delInbound deletes an inbound configuration by its ID.
 // @Summary      Delete inbound
-// @Description  Delete an inbound configuration by its ID
+// @Description  Delete an inbound configuration by its ID. With two-person approval enabled, deleting an inbound with more clients than the threshold answers with a pending approval request instead.
 // @Tags         inbounds
 // @Accept       json
 // @Produce      json
@@ -194,12 +618,16 @@ func (a *InboundController) addInbound(c *gin.Context) {
 // @Success      200  {object}  entity.Msg
 // @Failure      400  {object}  entity.Msg
 // @Router       /inbounds/del/{id} [post]
+// @Router       /v2/inbounds/{id} [delete]
 func (a *InboundController) delInbound(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.inboundDeleteSuccess"), err)
 		return
 	}
+	if holdForApproval(c, service.ApprovalDelInbound, strconv.Itoa(id), nil) {
+		return
+	}
 	needRestart, err := a.inboundService.DelInbound(id)
 	if err != nil {
 		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
@@ -223,6 +651,7 @@ func (a *InboundController) delInbound(c *gin.Context) {
 // @Success      200      {object}  entity.Msg{obj=model.Inbound}
 // @Failure      400      {object}  entity.Msg
 // @Router       /inbounds/update/{id} [post]
+// @Router       /v2/inbounds/{id} [put]
 func (a *InboundController) updateInbound(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -246,6 +675,56 @@ func (a *InboundController) updateInbound(c *gin.Context) {
 	if needRestart {
 		a.xrayService.SetToNeedRestart()
 	}
+	a.dnsService.AutoRecordInbound(inbound)
+}
+
+// enableInbound enables an inbound and adds it to the running Xray instance.
+// @Summary      Enable inbound
+// @Description  Enable an inbound without changing the rest of its configuration
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Inbound ID"
+// @Success      200  {object}  entity.Msg
+// @Failure      400  {object}  entity.Msg
+// @Router       /inbounds/{id}/enable [post]
+// @Router       /v2/inbounds/{id}/enable [post]
+func (a *InboundController) enableInbound(c *gin.Context) {
+	a.setInboundEnable(c, true)
+}
+
+// disableInbound disables an inbound and removes it from the running Xray instance.
+// @Summary      Disable inbound
+// @Description  Disable an inbound without deleting it or changing the rest of its configuration
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Inbound ID"
+// @Success      200  {object}  entity.Msg
+// @Failure      400  {object}  entity.Msg
+// @Router       /inbounds/{id}/disable [post]
+// @Router       /v2/inbounds/{id}/disable [post]
+func (a *InboundController) disableInbound(c *gin.Context) {
+	a.setInboundEnable(c, false)
+}
+
+func (a *InboundController) setInboundEnable(c *gin.Context, enable bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.inboundUpdateSuccess"), err)
+		return
+	}
+	_, needRestart, err := a.inboundService.SetInboundEnable(id, enable)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	if needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+	jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.inboundUpdateSuccess"), nil)
 }
 
 // getClientIps retrieves the IP addresses associated with a client by email.
@@ -259,6 +738,7 @@ func (a *InboundController) updateInbound(c *gin.Context) {
 // @Success      200    {object}  entity.Msg
 // @Failure      400    {object}  entity.Msg
 // @Router       /inbounds/clientIps/{email} [post]
+// @Router       /v2/clients/email/{email}/ips [get]
 func (a *InboundController) getClientIps(c *gin.Context) {
 	email := c.Param("email")
 
@@ -282,6 +762,7 @@ func (a *InboundController) getClientIps(c *gin.Context) {
 // @Success      200    {object}  entity.Msg
 // @Failure      400    {object}  entity.Msg
 // @Router       /inbounds/clearClientIps/{email} [post]
+// @Router       /v2/clients/email/{email}/ips [delete]
 func (a *InboundController) clearClientIps(c *gin.Context) {
 	email := c.Param("email")
 
@@ -295,7 +776,7 @@ func (a *InboundController) clearClientIps(c *gin.Context) {
 
 // addInboundClient adds a new client to an existing inbound.
 // @Summary      Add inbound client
-// @Description  Add a new client to an existing inbound
+// @Description  Add a new client to an existing inbound. Clients without an externalId get a generated UUID; clients whose externalId already exists are skipped, so retrying a create is safe. Omitted fields default to: enable false, limitIp, totalGB, expiryTime and reset 0 (unlimited or never), expiryAction "disable".
 // @Tags         inbounds
 // @Accept       json
 // @Produce      json
@@ -304,6 +785,7 @@ func (a *InboundController) clearClientIps(c *gin.Context) {
 // @Success      200   {object}  entity.Msg
 // @Failure      400   {object}  entity.Msg
 // @Router       /inbounds/addClient [post]
+// @Router       /v2/clients [post]
 func (a *InboundController) addInboundClient(c *gin.Context) {
 	data := &model.Inbound{}
 	err := c.ShouldBind(data)
@@ -343,10 +825,15 @@ type AddClientWithLinkResponse struct {
 // @Accept       json
 // @Produce      json
 // @Security     ApiKeyAuth
-// @Param        data  body      AddClientWithLinkRequest  true  "Inbound ID and client email"
+// @Param        data           body      AddClientWithLinkRequest  true   "Inbound ID and client email"
+// @Param        stats          query     bool                      false  "Append remaining traffic and time to the remark"
+// @Param        deterministic  query     bool                      false  "Use the first REALITY server name and short ID"
+// @Param        label          query     string                    false  "Remark template of the link"
+// @Param        port           query     int                       false  "Port of the link instead of the inbound port"
 // @Success      200   {object}  entity.Msg{obj=AddClientWithLinkResponse}
 // @Failure      400   {object}  entity.Msg
 // @Router       /inbounds/addClientWithLink [post]
+// @Router       /v2/clients/withLink [post]
 func (a *InboundController) addInboundClientWithLink(c *gin.Context) {
 	request := &AddClientWithLinkRequest{}
 	err := c.ShouldBind(request)
@@ -354,6 +841,11 @@ func (a *InboundController) addInboundClientWithLink(c *gin.Context) {
 		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.inboundUpdateSuccess"), err)
 		return
 	}
+	query, err := link.ParseQuery(c.Request.URL.Query())
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
 
 	// Get the inbound to determine the protocol
 	inbound, err := a.inboundService.GetInbound(request.Id)
@@ -463,23 +955,24 @@ func (a *InboundController) addInboundClientWithLink(c *gin.Context) {
 	}
 
 	// Get server address from request host
-	host := c.Request.Host
-	// Remove port if present
-	if colonIdx := strings.Index(host, ":"); colonIdx != -1 {
-		host = host[:colonIdx]
+	host := getHost(c)
+
+	remarkOptions, err := a.settingService.GetRemarkOptions()
+	if err != nil {
+		logger.Warning("Unable to get remark settings, using defaults:", err)
 	}
 
 	// Generate the config link using the getLink function from util.go
-	link := getLink(inbound, host, request.Email)
-	
+	clientLink := getLink(inbound, host, request.Email, remarkOptions, query)
+
 	// Log if link generation failed
-	if link == "" {
+	if clientLink == "" {
 		logger.Warning("Failed to generate link for client: ", request.Email, " protocol: ", inbound.Protocol, " host: ", host)
 	}
 
 	// Prepare response object
 	response := map[string]string{
-		"link":  link,
+		"link":  clientLink,
 		"uuid":  responseUUID,
 		"email": request.Email,
 	}
@@ -502,6 +995,7 @@ func (a *InboundController) addInboundClientWithLink(c *gin.Context) {
 // @Success      200       {object}  entity.Msg
 // @Failure      400       {object}  entity.Msg
 // @Router       /inbounds/{id}/delClient/{clientId} [post]
+// @Router       /v2/inbounds/{id}/clients/{clientId} [delete]
 func (a *InboundController) delInboundClient(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -533,6 +1027,7 @@ func (a *InboundController) delInboundClient(c *gin.Context) {
 // @Success      200       {object}  entity.Msg
 // @Failure      400       {object}  entity.Msg
 // @Router       /inbounds/updateClient/{clientId} [post]
+// @Router       /v2/clients/{clientId} [put]
 func (a *InboundController) updateInboundClient(c *gin.Context) {
 	clientId := c.Param("clientId")
 
@@ -566,6 +1061,7 @@ func (a *InboundController) updateInboundClient(c *gin.Context) {
 // @Success      200    {object}  entity.Msg
 // @Failure      400    {object}  entity.Msg
 // @Router       /inbounds/{id}/resetClientTraffic/{email} [post]
+// @Router       /v2/inbounds/{id}/clientTraffic/{email} [delete]
 func (a *InboundController) resetClientTraffic(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -587,7 +1083,7 @@ func (a *InboundController) resetClientTraffic(c *gin.Context) {
 
 // resetAllTraffics resets all traffic counters across all inbounds.
 // @Summary      Reset all traffics
-// @Description  Reset all traffic counters across all inbounds
+// @Description  Reset all traffic counters across all inbounds. With two-person approval enabled this answers with a pending approval request instead.
 // @Tags         inbounds
 // @Accept       json
 // @Produce      json
@@ -595,7 +1091,11 @@ func (a *InboundController) resetClientTraffic(c *gin.Context) {
 // @Success      200  {object}  entity.Msg
 // @Failure      400  {object}  entity.Msg
 // @Router       /inbounds/resetAllTraffics [post]
+// @Router       /v2/inbounds/traffic [delete]
 func (a *InboundController) resetAllTraffics(c *gin.Context) {
+	if holdForApproval(c, service.ApprovalResetAllTraffics, "", nil) {
+		return
+	}
 	err := a.inboundService.ResetAllTraffics()
 	if err != nil {
 		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
@@ -617,6 +1117,7 @@ func (a *InboundController) resetAllTraffics(c *gin.Context) {
 // @Success      200  {object}  entity.Msg
 // @Failure      400  {object}  entity.Msg
 // @Router       /inbounds/resetAllClientTraffics/{id} [post]
+// @Router       /v2/inbounds/{id}/traffic [delete]
 func (a *InboundController) resetAllClientTraffics(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -635,8 +1136,9 @@ func (a *InboundController) resetAllClientTraffics(c *gin.Context) {
 }
 
 // importInbound imports an inbound configuration from provided data.
+// The data may also be an array of inbounds as produced by the export-all endpoint.
 // @Summary      Import inbound
-// @Description  Import an inbound configuration from provided JSON data
+// @Description  Import an inbound configuration from provided JSON data. An array imports several inbounds and stops at the first failure.
 // @Tags         inbounds
 // @Accept       json
 // @Produce      json
@@ -645,16 +1147,52 @@ func (a *InboundController) resetAllClientTraffics(c *gin.Context) {
 // @Success      200   {object}  entity.Msg{obj=model.Inbound}
 // @Failure      400   {object}  entity.Msg
 // @Router       /inbounds/import [post]
+// @Router       /v2/inbounds/import [post]
 func (a *InboundController) importInbound(c *gin.Context) {
+	data := []byte(strings.TrimSpace(c.PostForm("data")))
+	user := session.GetLoginUser(c)
+	if len(data) > 0 && data[0] == '[' {
+		var inbounds []*model.Inbound
+		err := json.Unmarshal(data, &inbounds)
+		if err != nil {
+			jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+			return
+		}
+		imported := make([]*model.Inbound, 0, len(inbounds))
+		needRestart := false
+		for _, inbound := range inbounds {
+			var restart bool
+			inbound, restart, err = a.addImportedInbound(user.Id, inbound)
+			needRestart = needRestart || restart
+			if err != nil {
+				break
+			}
+			imported = append(imported, inbound)
+		}
+		jsonMsgObj(c, I18nWeb(c, "pages.inbounds.toasts.inboundCreateSuccess"), imported, err)
+		if needRestart {
+			a.xrayService.SetToNeedRestart()
+		}
+		return
+	}
+
 	inbound := &model.Inbound{}
-	err := json.Unmarshal([]byte(c.PostForm("data")), inbound)
+	err := json.Unmarshal(data, inbound)
 	if err != nil {
 		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
 		return
 	}
-	user := session.GetLoginUser(c)
+	inbound, needRestart, err := a.addImportedInbound(user.Id, inbound)
+	jsonMsgObj(c, I18nWeb(c, "pages.inbounds.toasts.inboundCreateSuccess"), inbound, err)
+	if err == nil && needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+// addImportedInbound adds an imported inbound for a user under a fresh ID and a tag derived from its listen address.
+func (a *InboundController) addImportedInbound(userId int, inbound *model.Inbound) (*model.Inbound, bool, error) {
 	inbound.Id = 0
-	inbound.UserId = user.Id
+	inbound.UserId = userId
 	if inbound.Listen == "" || inbound.Listen == "0.0.0.0" || inbound.Listen == "::" || inbound.Listen == "::0" {
 		inbound.Tag = fmt.Sprintf("inbound-%v", inbound.Port)
 	} else {
@@ -666,71 +1204,336 @@ func (a *InboundController) importInbound(c *gin.Context) {
 		inbound.ClientStats[index].Enable = true
 	}
 
-	needRestart := false
-	inbound, needRestart, err = a.inboundService.AddInbound(inbound)
-	jsonMsgObj(c, I18nWeb(c, "pages.inbounds.toasts.inboundCreateSuccess"), inbound, err)
-	if err == nil && needRestart {
-		a.xrayService.SetToNeedRestart()
-	}
+	return a.inboundService.AddInbound(inbound)
 }
 
-// delDepletedClients deletes clients in an inbound who have exhausted their traffic limits.
-// @Summary      Delete depleted clients
-// @Description  Delete clients in an inbound who have exhausted their traffic limits
+// importClients creates the clients listed in a CSV file or XLSX workbook on an inbound.
+// @Summary      Import clients
+// @Description  Create the clients listed in a CSV file or in the first sheet of an XLSX workbook, sent as the file form field or as the request body. The columns are email, quota in GB, expiry, Telegram user ID and comment, in this order or named by a header row. The expiry is a date such as 2025-12-31, a number of days from now, a negative number of days counted from the first connection or a Unix timestamp in milliseconds, empty for never. Clients the inbound already has are skipped, updated with the columns of the file or reported as errors as onDuplicate says; invalid rows are reported and the others imported. With dryRun nothing is changed. With report=csv the rows that failed are answered as a CSV file.
 // @Tags         inbounds
-// @Accept       json
+// @Accept       multipart/form-data
+// @Accept       text/csv
 // @Produce      json
+// @Produce      text/csv
 // @Security     ApiKeyAuth
-// @Param        id   path      int  true  "Inbound ID"
-// @Success      200  {object}  entity.Msg
-// @Failure      400  {object}  entity.Msg
-// @Router       /inbounds/delDepletedClients/{id} [post]
-func (a *InboundController) delDepletedClients(c *gin.Context) {
+// @Param        id           path      int     true   "Inbound ID"
+// @Param        file         formData  file    false  "CSV or XLSX file"
+// @Param        onDuplicate  query     string  false  "skip (default), update or error"
+// @Param        dryRun       query     bool    false  "Only report what the import would do"
+// @Param        report       query     string  false  "csv to download the rows that failed"
+// @Success      200          {object}  entity.Msg{obj=entity.ClientImportResult}
+// @Failure      400          {object}  entity.Msg
+// @Router       /inbounds/{id}/importClients [post]
+// @Router       /v2/inbounds/{id}/clients/import [post]
+func (a *InboundController) importClients(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.inboundUpdateSuccess"), err)
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.inboundClientAddSuccess"), err)
 		return
 	}
-	err = a.inboundService.DelDepletedClients(id)
+	var reader io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		file, _, err := c.Request.FormFile("file")
+		if err != nil {
+			jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.inboundClientAddSuccess"), err)
+			return
+		}
+		defer file.Close()
+		reader = file
+	}
+	data, err := io.ReadAll(io.LimitReader(reader, maxClientImportSize+1))
+	if err == nil && len(data) > maxClientImportSize {
+		err = common.NewCodeError(common.ErrCodeValidation, nil, "the file is larger than", maxClientImportSize>>20, "MB")
+	}
 	if err != nil {
-		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.inboundClientAddSuccess"), err)
 		return
 	}
-	jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.delDepletedClientsSuccess"), nil)
-}
 
-// onlines retrieves the list of currently online clients.
-// @Summary      Get online clients
-// @Description  Retrieve the list of currently online clients
-// @Tags         inbounds
-// @Accept       json
-// @Produce      json
-// @Security     ApiKeyAuth
-// @Success      200  {object}  entity.Msg
-// @Failure      400  {object}  entity.Msg
-// @Router       /inbounds/onlines [post]
-func (a *InboundController) onlines(c *gin.Context) {
-	jsonObj(c, a.inboundService.GetOnlineClients(), nil)
+	result, needRestart, err := a.inboundService.ImportClients(id, data, c.Query("onDuplicate"), c.Query("dryRun") == "true")
+	if needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.inboundClientAddSuccess"), err)
+		return
+	}
+	if !result.DryRun {
+		logger.Infof("Imported clients into inbound %d from %s: %d created, %d updated, %d skipped, %d failed",
+			id, getRemoteIp(c), result.Created, result.Updated, result.Skipped, result.Failed)
+	}
+	if c.Query("report") == "csv" {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=import-errors-%d.csv", id))
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		writer := csv.NewWriter(c.Writer)
+		writer.Write([]string{"row", "email", "error"})
+		for _, row := range result.Rows {
+			if row.Action == "error" {
+				writer.Write([]string{strconv.Itoa(row.Row), row.Email, row.Error})
+			}
+		}
+		writer.Flush()
+		return
+	}
+	jsonObj(c, result, nil)
 }
 
-// lastOnline retrieves the last online timestamps for clients.
-// @Summary      Get last online clients
-// @Description  Retrieve the last online timestamps for clients
+// exportClients exports the clients of the logged-in user's inbounds as a CSV file or XLSX workbook.
+// @Summary      Export clients
+// @Description  Export the clients of all inbounds of the user, or of the listed ones, as CSV or XLSX with the chosen columns under a header row. Columns are inbound, email, uuid, enable, quota, usage, up, down, adjusted (net manual traffic corrections), expiry, lastOnline, subId, subLink, tgId and comment; email, uuid, usage, expiry, lastOnline and subLink by default. Quota and traffic are in GB and times in the panel time zone, so a file with the import columns can be imported again.
 // @Tags         inbounds
 // @Accept       json
-// @Produce      json
+// @Produce      text/csv
+// @Produce      application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
 // @Security     ApiKeyAuth
-// @Success      200  {object}  entity.Msg
-// @Failure      400  {object}  entity.Msg
-// @Router       /inbounds/lastOnline [post]
-func (a *InboundController) lastOnline(c *gin.Context) {
-	data, err := a.inboundService.GetClientsLastOnline()
-	jsonObj(c, data, err)
+// @Param        inbounds  query     string  false  "Comma-separated inbound IDs, all inbounds when empty"
+// @Param        columns   query     string  false  "Comma-separated columns"
+// @Param        format    query     string  false  "csv (default) or xlsx"
+// @Success      200
+// @Failure      400       {object}  entity.Msg
+// @Router       /inbounds/exportClients [get]
+// @Router       /v2/clients/export [get]
+func (a *InboundController) exportClients(c *gin.Context) {
+	var inboundIds []int
+	for _, value := range strings.Split(c.Query("inbounds"), ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+			return
+		}
+		inboundIds = append(inboundIds, id)
+	}
+	var columns []string
+	for _, column := range strings.Split(c.Query("columns"), ",") {
+		if column = strings.TrimSpace(column); column != "" {
+			columns = append(columns, column)
+		}
+	}
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "xlsx" {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), common.NewCodeError(common.ErrCodeValidation, nil, "invalid export format:", format))
+		return
+	}
+
+	rows, err := a.inboundService.ExportClients(session.GetLoginUser(c).Id, inboundIds, columns)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	filename := "clients-" + time.Now().Format("20060102-150405") + "." + format
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	if format == "xlsx" {
+		c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		if err := spreadsheet.WriteXLSX(c.Writer, "Clients", rows); err != nil {
+			logger.Warning("Unable to write client export:", err)
+		}
+		return
+	}
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	writer := csv.NewWriter(c.Writer)
+	writer.WriteAll(rows)
 }
 
-// updateClientTraffic updates the traffic statistics for a client by email.
-// @Summary      Update client traffic
-// @Description  Update the traffic statistics for a client by email
+// exportInbound exports an inbound with its clients as a bundle accepted by the import endpoint.
+// @Summary      Export inbound
+// @Description  Export an inbound with its clients as a self-contained JSON bundle that can be passed to the import endpoint. Traffic counters are only included with stats=true.
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id     path      int   true   "Inbound ID"
+// @Param        stats  query     bool  false  "Include traffic counters of the inbound and its clients"
+// @Success      200    {object}  entity.Msg{obj=model.Inbound}
+// @Failure      400    {object}  entity.Msg
+// @Router       /inbounds/{id}/export [get]
+// @Router       /v2/inbounds/{id}/export [get]
+func (a *InboundController) exportInbound(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "get"), err)
+		return
+	}
+	user := session.GetLoginUser(c)
+	inbound, err := a.inboundService.ExportInbound(user.Id, id, c.Query("stats") == "true")
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	jsonObj(c, inbound, nil)
+}
+
+// exportInbounds exports all inbounds of the logged-in user as bundles accepted by the import endpoint.
+// @Summary      Export all inbounds
+// @Description  Export all inbounds with their clients as a JSON array that can be passed to the import endpoint. Traffic counters are only included with stats=true.
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        stats  query     bool  false  "Include traffic counters of the inbounds and their clients"
+// @Success      200    {object}  entity.Msg{obj=[]model.Inbound}
+// @Failure      400    {object}  entity.Msg
+// @Router       /inbounds/export [get]
+// @Router       /v2/inbounds/export [get]
+func (a *InboundController) exportInbounds(c *gin.Context) {
+	user := session.GetLoginUser(c)
+	inbounds, err := a.inboundService.ExportInbounds(user.Id, c.Query("stats") == "true")
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	jsonObj(c, inbounds, nil)
+}
+
+// delDepletedClients deletes clients in an inbound who have exhausted their traffic limits.
+// @Summary      Delete depleted clients
+// @Description  Delete clients in an inbound who have exhausted their traffic limits
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Inbound ID"
+// @Success      200  {object}  entity.Msg
+// @Failure      400  {object}  entity.Msg
+// @Router       /inbounds/delDepletedClients/{id} [post]
+// @Router       /v2/inbounds/{id}/depletedClients [delete]
+func (a *InboundController) delDepletedClients(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.inboundUpdateSuccess"), err)
+		return
+	}
+	err = a.inboundService.DelDepletedClients(id)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.delDepletedClientsSuccess"), nil)
+}
+
+// onlines retrieves the list of currently online clients.
+// @Summary      Get online clients
+// @Description  Retrieve the list of currently online clients
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg
+// @Failure      400  {object}  entity.Msg
+// @Router       /inbounds/onlines [post]
+// @Router       /v2/inbounds/onlines [get]
+func (a *InboundController) onlines(c *gin.Context) {
+	jsonObj(c, a.inboundService.GetOnlineClients(), nil)
+}
+
+// speeds retrieves the current transfer rates of the online clients.
+// @Summary      Get client speeds
+// @Description  Retrieve the upload and download rate of each client transferring data, measured between the last two traffic collections, fastest first
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        limit  query     int  false  "Return only the fastest clients"
+// @Success      200    {object}  entity.Msg{obj=[]entity.ClientSpeed}
+// @Failure      400    {object}  entity.Msg
+// @Router       /inbounds/speeds [get]
+// @Router       /v2/inbounds/speeds [get]
+func (a *InboundController) speeds(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonObj(c, a.xrayService.GetClientSpeeds(limit), nil)
+}
+
+// lastOnline retrieves the last online timestamps for clients.
+// @Summary      Get last online clients
+// @Description  Retrieve the last online timestamps for clients
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg
+// @Failure      400  {object}  entity.Msg
+// @Router       /inbounds/lastOnline [post]
+// @Router       /v2/inbounds/lastOnline [get]
+func (a *InboundController) lastOnline(c *gin.Context) {
+	data, err := a.inboundService.GetClientsLastOnline()
+	jsonObj(c, data, err)
+}
+
+// inactiveClientsQuery reads the inbound and the number of days of an inactive clients request.
+func inactiveClientsQuery(c *gin.Context) (int, int, error) {
+	inboundId, err := strconv.Atoi(c.DefaultQuery("inboundId", c.DefaultPostForm("inboundId", "0")))
+	if err != nil {
+		return 0, 0, err
+	}
+	days, err := strconv.Atoi(c.DefaultQuery("days", c.DefaultPostForm("days", "30")))
+	return inboundId, days, err
+}
+
+// getInactiveClients lists the clients not online for a number of days.
+// @Summary      List inactive clients
+// @Description  List the clients of the user's inbounds that were not online for the given number of days, longest inactive first. Clients never online count from their creation.
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        days       query     int  false  "Days without being online, 30 by default"
+// @Param        inboundId  query     int  false  "Only the clients of this inbound"
+// @Success      200        {object}  entity.Msg{obj=[]entity.InactiveClient}
+// @Failure      400        {object}  entity.Msg
+// @Router       /inbounds/inactiveClients [get]
+// @Router       /v2/clients/inactive [get]
+func (a *InboundController) getInactiveClients(c *gin.Context) {
+	inboundId, days, err := inactiveClientsQuery(c)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	clients, err := a.inboundService.GetInactiveClients(session.GetLoginUser(c).Id, inboundId, days)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	jsonObj(c, clients, nil)
+}
+
+// disableInactiveClients disables the clients not online for a number of days.
+// @Summary      Disable inactive clients
+// @Description  Disable the enabled clients the inactive clients list reports for the same days and inbound, and answer with the clients disabled
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        days       query     int  false  "Days without being online, 30 by default"
+// @Param        inboundId  query     int  false  "Only the clients of this inbound"
+// @Success      200        {object}  entity.Msg{obj=[]entity.InactiveClient}
+// @Failure      400        {object}  entity.Msg
+// @Router       /inbounds/inactiveClients/disable [post]
+// @Router       /v2/clients/inactive/disable [post]
+func (a *InboundController) disableInactiveClients(c *gin.Context) {
+	inboundId, days, err := inactiveClientsQuery(c)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.inboundUpdateSuccess"), err)
+		return
+	}
+	clients, needRestart, err := a.inboundService.DisableInactiveClients(session.GetLoginUser(c).Id, inboundId, days)
+	if needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+	if err == nil {
+		logger.Infof("Disabled %d clients inactive for %d days from %s", len(clients), days, getRemoteIp(c))
+	}
+	jsonMsgObj(c, I18nWeb(c, "pages.inbounds.toasts.inboundUpdateSuccess"), clients, err)
+}
+
+// updateClientTraffic updates the traffic statistics for a client by email.
+// @Summary      Update client traffic
+// @Description  Overwrite the traffic counters of a client by email, without a record of the change. Use the traffic adjustment route for corrections that have to be traceable.
 // @Tags         inbounds
 // @Accept       json
 // @Produce      json
@@ -740,6 +1543,7 @@ func (a *InboundController) lastOnline(c *gin.Context) {
 // @Success      200      {object}  entity.Msg
 // @Failure      400      {object}  entity.Msg
 // @Router       /inbounds/updateClientTraffic/{email} [post]
+// @Router       /v2/clients/email/{email}/traffic [put]
 func (a *InboundController) updateClientTraffic(c *gin.Context) {
 	email := c.Param("email")
 
@@ -765,6 +1569,113 @@ func (a *InboundController) updateClientTraffic(c *gin.Context) {
 	jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.inboundClientUpdateSuccess"), nil)
 }
 
+// TrafficAdjustmentRequest is a manual correction of the traffic counters of a client.
+type TrafficAdjustmentRequest struct {
+	Up     int64  `json:"up" form:"up" example:"0"`                                  // Bytes added to the upload counter, negative to credit them back
+	Down   int64  `json:"down" form:"down" example:"-1073741824"`                    // Bytes added to the download counter, negative to credit them back
+	Reason string `json:"reason" form:"reason" example:"Outage credit, ticket 4512"` // Why the counters are corrected, required
+}
+
+// adjustClientTraffic corrects the traffic counters of a client by relative amounts.
+// @Summary      Adjust client traffic
+// @Description  Add to or credit back from the upload and download counters of a client by a number of bytes, with a required reason. Counters are not taken below zero. The correction is recorded with the admin who made it and shows in the traffic adjustments, the customer statistics and the adjusted column of client exports.
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        email       path      string                    true  "Client email address"
+// @Param        adjustment  body      TrafficAdjustmentRequest  true  "Correction"
+// @Success      200         {object}  entity.Msg{obj=model.TrafficAdjustment}
+// @Failure      400         {object}  entity.Msg
+// @Router       /inbounds/adjustClientTraffic/{email} [post]
+// @Router       /v2/clients/email/{email}/traffic/adjustments [post]
+func (a *InboundController) adjustClientTraffic(c *gin.Context) {
+	var request TrafficAdjustmentRequest
+	if err := c.ShouldBind(&request); err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	adjustment, err := a.inboundService.AdjustClientTraffic(c.Param("email"), request.Up, request.Down, request.Reason, approvalAdmin(c))
+	jsonMsgObj(c, I18nWeb(c, "pages.inbounds.toasts.inboundClientUpdateSuccess"), adjustment, err)
+}
+
+// getTrafficAdjustments lists the manual traffic corrections.
+// @Summary      List traffic adjustments
+// @Description  List the manual corrections of client traffic counters, newest first, with the reason and the admin who made each, optionally of one client and within a time range
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        email  query     string  false  "Client email address"
+// @Param        from   query     int     false  "Start time in milliseconds"
+// @Param        to     query     int     false  "End time in milliseconds, exclusive"
+// @Success      200    {object}  entity.Msg{obj=[]model.TrafficAdjustment}
+// @Failure      400    {object}  entity.Msg
+// @Router       /inbounds/trafficAdjustments [get]
+// @Router       /v2/clients/trafficAdjustments [get]
+func (a *InboundController) getTrafficAdjustments(c *gin.Context) {
+	from, err := strconv.ParseInt(c.DefaultQuery("from", "0"), 10, 64)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	to, err := strconv.ParseInt(c.DefaultQuery("to", "0"), 10, 64)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	adjustments, err := a.inboundService.GetTrafficAdjustments(c.Query("email"), from, to)
+	jsonObj(c, adjustments, err)
+}
+
+// pauseClient pauses a client, freezing its remaining days.
+// @Summary      Pause client
+// @Description  Disable a client and freeze its remaining days until it is resumed. Traffic counters are kept.
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        email  path      string  true  "Client email address"
+// @Success      200    {object}  entity.Msg
+// @Failure      400    {object}  entity.Msg
+// @Router       /inbounds/pauseClient/{email} [post]
+// @Router       /v2/clients/email/{email}/pause [post]
+func (a *InboundController) pauseClient(c *gin.Context) {
+	needRestart, err := a.inboundService.PauseClient(c.Param("email"))
+	if needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.inboundClientUpdateSuccess"), nil)
+}
+
+// resumeClient resumes a paused client.
+// @Summary      Resume client
+// @Description  Enable a paused client and extend its expiry time by the length of the pause
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        email  path      string  true  "Client email address"
+// @Success      200    {object}  entity.Msg
+// @Failure      400    {object}  entity.Msg
+// @Router       /inbounds/resumeClient/{email} [post]
+// @Router       /v2/clients/email/{email}/resume [post]
+func (a *InboundController) resumeClient(c *gin.Context) {
+	needRestart, err := a.inboundService.ResumeClient(c.Param("email"))
+	if needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.inboundClientUpdateSuccess"), nil)
+}
+
 // delInboundClientByEmail deletes a client from an inbound by email address.
 // @Summary      Delete client by email
 // @Description  Delete a client from an inbound by email address
@@ -777,6 +1688,7 @@ func (a *InboundController) updateClientTraffic(c *gin.Context) {
 // @Success      200    {object}  entity.Msg
 // @Failure      400    {object}  entity.Msg
 // @Router       /inbounds/{id}/delClientByEmail/{email} [post]
+// @Router       /v2/inbounds/{id}/clientsByEmail/{email} [delete]
 func (a *InboundController) delInboundClientByEmail(c *gin.Context) {
 	inboundId, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -796,3 +1708,462 @@ func (a *InboundController) delInboundClientByEmail(c *gin.Context) {
 		a.xrayService.SetToNeedRestart()
 	}
 }
+
+// getInboundSniffing retrieves the structured sniffing configuration of an inbound.
+// @Summary      Get inbound sniffing
+// @Description  Get the sniffing configuration of an inbound, or the protocol default when none is set
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Inbound ID"
+// @Success      200  {object}  entity.Msg{obj=entity.InboundSniffing}
+// @Failure      400  {object}  entity.Msg
+// @Router       /inbounds/{id}/sniffing [get]
+// @Router       /v2/inbounds/{id}/sniffing [get]
+func (a *InboundController) getInboundSniffing(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "get"), err)
+		return
+	}
+	sniffing, err := a.inboundService.GetInboundSniffing(id)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	jsonObj(c, sniffing, nil)
+}
+
+// updateInboundSniffing replaces the sniffing configuration of an inbound.
+// @Summary      Update inbound sniffing
+// @Description  Validate and store the sniffing configuration of an inbound
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id        path      int                     true  "Inbound ID"
+// @Param        sniffing  body      entity.InboundSniffing  true  "Sniffing configuration"
+// @Success      200       {object}  entity.Msg
+// @Failure      400       {object}  entity.Msg
+// @Router       /inbounds/{id}/updateSniffing [post]
+// @Router       /v2/inbounds/{id}/sniffing [put]
+func (a *InboundController) updateInboundSniffing(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.inboundUpdateSuccess"), err)
+		return
+	}
+	sniffing := &entity.InboundSniffing{}
+	if err := c.ShouldBind(sniffing); err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.inboundUpdateSuccess"), err)
+		return
+	}
+	needRestart, err := a.inboundService.UpdateInboundSniffing(id, sniffing)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.inboundUpdateSuccess"), nil)
+	if needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+// getInboundSockopt retrieves the structured sockopt fields of an inbound.
+// @Summary      Get inbound sockopt
+// @Description  Get mark, tproxy, domainStrategy, interface and the tcp dialer options like tcpMptcp from the stream settings of an inbound
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Inbound ID"
+// @Success      200  {object}  entity.Msg{obj=entity.InboundSockopt}
+// @Failure      400  {object}  entity.Msg
+// @Router       /inbounds/{id}/sockopt [get]
+// @Router       /v2/inbounds/{id}/sockopt [get]
+func (a *InboundController) getInboundSockopt(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "get"), err)
+		return
+	}
+	sockopt, err := a.inboundService.GetInboundSockopt(id)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	jsonObj(c, sockopt, nil)
+}
+
+// updateInboundSockopt merges the structured sockopt fields into the stream settings of an inbound.
+// @Summary      Update inbound sockopt
+// @Description  Validate mark, tproxy, domainStrategy, interface and the tcp dialer options against the host and the running core and store them, keeping other sockopt options
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id       path      int                    true  "Inbound ID"
+// @Param        sockopt  body      entity.InboundSockopt  true  "Sockopt fields"
+// @Success      200      {object}  entity.Msg
+// @Failure      400      {object}  entity.Msg
+// @Router       /inbounds/{id}/updateSockopt [post]
+// @Router       /v2/inbounds/{id}/sockopt [put]
+func (a *InboundController) updateInboundSockopt(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.inboundUpdateSuccess"), err)
+		return
+	}
+	sockopt := service.DefaultSockopt()
+	if err := c.ShouldBind(sockopt); err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.inboundUpdateSuccess"), err)
+		return
+	}
+	needRestart, err := a.inboundService.UpdateInboundSockopt(id, sockopt)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.inboundUpdateSuccess"), nil)
+	if needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+// InboundCertificateRequest carries a PEM certificate chain and its private key.
+type InboundCertificateRequest struct {
+	Cert string `json:"cert" form:"cert"` // PEM certificate chain, leaf first
+	Key  string `json:"key" form:"key"`   // PEM private key of the leaf certificate
+}
+
+// maxCertUploadSize bounds the size of an uploaded certificate chain or key.
+const maxCertUploadSize = 1 << 20
+
+// getInboundCertificate returns the details of the TLS certificate of an inbound.
+// @Summary      Get inbound certificate
+// @Description  Get the subject, domains, validity and trust of the first certificate in the TLS settings of an inbound
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Inbound ID"
+// @Success      200  {object}  entity.Msg{obj=entity.InboundCertificate}
+// @Failure      400  {object}  entity.Msg
+// @Router       /inbounds/{id}/certificate [get]
+// @Router       /v2/inbounds/{id}/certificate [get]
+func (a *InboundController) getInboundCertificate(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	certificate, err := a.inboundService.GetInboundCertificate(id)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	jsonObj(c, certificate, nil)
+}
+
+// setInboundCertificate uploads or rotates the TLS certificate of an inbound.
+// @Summary      Set inbound certificate
+// @Description  Upload a PEM certificate chain and its private key as the cert and key files of a form or as text. The key has to match the certificate, each certificate of the chain has to be signed by the next one and the certificate has to be valid now. The files are stored in the certificate folder of the panel, readable by the panel user only, and the TLS settings of the inbound are pointed at them. Uploading again rotates the certificate.
+// @Tags         inbounds
+// @Accept       multipart/form-data
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id    path      int                        true   "Inbound ID"
+// @Param        data  body      InboundCertificateRequest  false  "Certificate and key as text"
+// @Param        cert  formData  file                       false  "Certificate chain file"
+// @Param        key   formData  file                       false  "Private key file"
+// @Success      200   {object}  entity.Msg{obj=entity.InboundCertificate}
+// @Failure      400   {object}  entity.Msg
+// @Router       /inbounds/{id}/certificate [post]
+// @Router       /v2/inbounds/{id}/certificate [put]
+func (a *InboundController) setInboundCertificate(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.inboundUpdateSuccess"), err)
+		return
+	}
+	request := &InboundCertificateRequest{}
+	if err := c.ShouldBind(request); err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.inboundUpdateSuccess"), err)
+		return
+	}
+	values := map[string]*string{"cert": &request.Cert, "key": &request.Key}
+	for field, value := range values {
+		file, _, err := c.Request.FormFile(field)
+		if err != nil {
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(file, maxCertUploadSize))
+		file.Close()
+		if err != nil {
+			jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.inboundUpdateSuccess"), err)
+			return
+		}
+		*value = string(data)
+	}
+	certificate, needRestart, err := a.inboundService.SetInboundCertificate(id, []byte(request.Cert), []byte(request.Key))
+	if needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+	if err == nil {
+		logger.Infof("Certificate of inbound %d set from %s", id, getRemoteIp(c))
+	}
+	jsonMsgObj(c, I18nWeb(c, "pages.inbounds.toasts.inboundUpdateSuccess"), certificate, err)
+}
+
+// rotateInboundMldsa65 generates a new post-quantum signing key for a REALITY inbound.
+// @Summary      Rotate inbound ML-DSA-65 key
+// @Description  Generate a new ML-DSA-65 seed with the Xray core for a REALITY inbound, turning on post-quantum signing of the handshake when it was off. Fails when the running core has no ML-DSA-65 support. Clients need the returned verify key, which their links and subscriptions carry from then on.
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Inbound ID"
+// @Success      200  {object}  entity.Msg{obj=string}
+// @Failure      400  {object}  entity.Msg
+// @Router       /inbounds/{id}/mldsa65/rotate [post]
+// @Router       /v2/inbounds/{id}/mldsa65/rotate [post]
+func (a *InboundController) rotateInboundMldsa65(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.inboundUpdateSuccess"), err)
+		return
+	}
+	verify, needRestart, err := a.inboundService.RotateInboundMldsa65(id)
+	if needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+	if err == nil {
+		logger.Infof("ML-DSA-65 key of inbound %d rotated from %s", id, getRemoteIp(c))
+	}
+	jsonMsgObj(c, I18nWeb(c, "pages.inbounds.toasts.inboundUpdateSuccess"), verify, err)
+}
+
+// delInboundMldsa65 turns off post-quantum signing for a REALITY inbound.
+// @Summary      Remove inbound ML-DSA-65 key
+// @Description  Remove the ML-DSA-65 seed and verify key of a REALITY inbound
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Inbound ID"
+// @Success      200  {object}  entity.Msg
+// @Failure      400  {object}  entity.Msg
+// @Router       /inbounds/{id}/mldsa65/del [post]
+// @Router       /v2/inbounds/{id}/mldsa65 [delete]
+func (a *InboundController) delInboundMldsa65(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.inboundUpdateSuccess"), err)
+		return
+	}
+	needRestart, err := a.inboundService.DelInboundMldsa65(id)
+	if needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+	jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.inboundUpdateSuccess"), err)
+}
+
+// ClientTagActionRequest defines a bulk action on all clients carrying the given tags.
+type ClientTagActionRequest struct {
+	Tags   []string `json:"tags" form:"tags" example:"plan:pro"`    // Clients must carry all of these tags
+	Action string   `json:"action" form:"action" example:"disable"` // enable, disable, resetTraffic or delete
+}
+
+// getClientTags lists the client tags in use.
+// @Summary      List client tags
+// @Description  Get every client tag in use with the number of clients carrying it
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=map[string]int}
+// @Failure      400  {object}  entity.Msg
+// @Router       /inbounds/clientTags [get]
+// @Router       /v2/clients/tags [get]
+func (a *InboundController) getClientTags(c *gin.Context) {
+	tags, err := a.inboundService.GetClientTags()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	jsonObj(c, tags, nil)
+}
+
+// getClientsByTag lists the traffic records of clients carrying the given tags.
+// @Summary      List clients by tag
+// @Description  Get the traffic records of clients carrying all of the given tags
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        tag  query     []string  true  "Client tag, repeat to require several tags"  collectionFormat(multi)
+// @Success      200  {object}  entity.Msg{obj=[]xray.ClientTraffic}
+// @Failure      400  {object}  entity.Msg
+// @Router       /inbounds/clientsByTag [get]
+// @Router       /v2/clients/byTag [get]
+func (a *InboundController) getClientsByTag(c *gin.Context) {
+	traffics, err := a.inboundService.GetClientTrafficsByTags(c.QueryArray("tag"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	jsonObj(c, traffics, nil)
+}
+
+// clientActionByTag applies a bulk action to all clients carrying the given tags.
+// @Summary      Bulk client action by tag
+// @Description  Enable, disable, reset traffic of or delete all clients carrying all of the given tags. Returns the number of affected clients.
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        data   body      ClientTagActionRequest  true   "Tags and action"
+// @Param        async  query     bool                    false  "Run as a background job and answer with the job"
+// @Success      200    {object}  entity.Msg{obj=int}
+// @Failure      400    {object}  entity.Msg
+// @Router       /inbounds/clientsByTag/action [post]
+// @Router       /v2/clients/byTag/action [post]
+func (a *InboundController) clientActionByTag(c *gin.Context) {
+	request := &ClientTagActionRequest{}
+	if err := c.ShouldBind(request); err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.inboundUpdateSuccess"), err)
+		return
+	}
+	if isAsync(c) {
+		job, err := a.jobService.Enqueue("clientActionByTag", func(ctx context.Context, report service.JobProgressFunc) (any, error) {
+			affected, needRestart, err := a.inboundService.ApplyClientActionByTags(request.Tags, request.Action)
+			if needRestart {
+				a.xrayService.SetToNeedRestart()
+			}
+			return affected, err
+		})
+		jsonJob(c, I18nWeb(c, "pages.index.jobQueued"), job, err)
+		return
+	}
+	affected, needRestart, err := a.inboundService.ApplyClientActionByTags(request.Tags, request.Action)
+	if needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+	if err != nil {
+		jsonMsgObj(c, I18nWeb(c, "somethingWentWrong"), affected, err)
+		return
+	}
+	jsonMsgObj(c, I18nWeb(c, "pages.inbounds.toasts.inboundUpdateSuccess"), affected, nil)
+}
+
+// InboundGroupActionRequest defines an action on all inbounds of a group.
+type InboundGroupActionRequest struct {
+	Group  string `json:"group" form:"group" example:"project-a"` // Group name
+	Action string `json:"action" form:"action" example:"disable"` // enable, disable or resetTraffic
+}
+
+// getInboundGroups lists inbound groups with aggregated statistics.
+// @Summary      List inbound groups
+// @Description  Get per-group inbound and client counts, online clients and traffic of the authenticated user's inbounds
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=[]entity.InboundGroup}
+// @Failure      400  {object}  entity.Msg
+// @Router       /inbounds/groups [get]
+// @Router       /v2/inbounds/groups [get]
+func (a *InboundController) getInboundGroups(c *gin.Context) {
+	user := session.GetLoginUser(c)
+	groups, err := a.inboundService.GetInboundGroups(user.Id)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	jsonObj(c, groups, nil)
+}
+
+// inboundGroupAction applies an action to all inbounds of a group.
+// @Summary      Inbound group action
+// @Description  Enable, disable or reset the traffic of all inbounds in a group. Returns the number of affected inbounds.
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        data  body      InboundGroupActionRequest  true  "Group and action"
+// @Success      200   {object}  entity.Msg{obj=int}
+// @Failure      400   {object}  entity.Msg
+// @Router       /inbounds/groups/action [post]
+// @Router       /v2/inbounds/groups/action [post]
+func (a *InboundController) inboundGroupAction(c *gin.Context) {
+	request := &InboundGroupActionRequest{}
+	if err := c.ShouldBind(request); err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.inboundUpdateSuccess"), err)
+		return
+	}
+	user := session.GetLoginUser(c)
+	affected, needRestart, err := a.inboundService.ApplyInboundGroupAction(user.Id, request.Group, request.Action)
+	if needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+	if err != nil {
+		jsonMsgObj(c, I18nWeb(c, "somethingWentWrong"), affected, err)
+		return
+	}
+	jsonMsgObj(c, I18nWeb(c, "pages.inbounds.toasts.inboundUpdateSuccess"), affected, nil)
+}
+
+// getInboundHealth returns the latest health check results of the inbounds.
+// @Summary      Get inbound health
+// @Description  Get the latest health check result of each checked inbound. Empty while health checks are disabled.
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=[]entity.InboundHealth}
+// @Failure      401  {object}  entity.Msg
+// @Router       /inbounds/health [get]
+// @Router       /v2/inbounds/health [get]
+func (a *InboundController) getInboundHealth(c *gin.Context) {
+	jsonObj(c, a.inboundHealthService.GetInboundHealth(), nil)
+}
+
+// getRealityChecks returns the latest checks of the REALITY targets.
+// @Summary      Get REALITY target checks
+// @Description  Get the latest check of the target of each enabled REALITY inbound: whether it completed a TLS 1.3 handshake for the server name within the latency limit and is not a blocked domain
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=[]entity.RealityCheck}
+// @Failure      401  {object}  entity.Msg
+// @Router       /inbounds/realityChecks [get]
+// @Router       /v2/inbounds/realityChecks [get]
+func (a *InboundController) getRealityChecks(c *gin.Context) {
+	jsonObj(c, a.realityCheckService.GetChecks(), nil)
+}
+
+// runRealityChecks checks the REALITY targets now.
+// @Summary      Run REALITY target checks
+// @Description  Check the targets of all enabled REALITY inbounds now. Targets failing twice in a row are reported to the Telegram admins and, when rotation is enabled, replaced with the first healthy fallback target.
+// @Tags         inbounds
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=[]entity.RealityCheck}
+// @Failure      400  {object}  entity.Msg
+// @Router       /inbounds/realityChecks/run [post]
+// @Router       /v2/inbounds/realityChecks/run [post]
+func (a *InboundController) runRealityChecks(c *gin.Context) {
+	needRestart, err := a.realityCheckService.Check()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonObj(c, a.realityCheckService.GetChecks(), nil)
+	if needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/web/middleware"
 	"github.com/mhsanaei/3x-ui/v2/web/service"
 	"github.com/mhsanaei/3x-ui/v2/web/session"
 
@@ -41,8 +43,8 @@ func (a *IndexController) initRouter(g *gin.RouterGroup) {
 	g.GET("/", a.index)
 	g.GET("/logout", a.logout)
 
-	g.POST("/login", a.login)
-	g.POST("/getTwoFactorEnable", a.getTwoFactorEnable)
+	g.POST("/login", middleware.ReadOnlyAllowed, a.login)
+	g.POST("/getTwoFactorEnable", middleware.ReadOnlyAllowed, a.getTwoFactorEnable)
 }
 
 // index handles the root route, redirecting logged-in users to the panel or showing the login page.
@@ -59,15 +61,15 @@ func (a *IndexController) login(c *gin.Context) {
 	var form LoginForm
 
 	if err := c.ShouldBind(&form); err != nil {
-		pureJsonMsg(c, http.StatusOK, false, I18nWeb(c, "pages.login.toasts.invalidFormData"))
+		jsonError(c, http.StatusOK, common.ErrCodeInvalidRequest, I18nWeb(c, "pages.login.toasts.invalidFormData"))
 		return
 	}
 	if form.Username == "" {
-		pureJsonMsg(c, http.StatusOK, false, I18nWeb(c, "pages.login.toasts.emptyUsername"))
+		jsonError(c, http.StatusOK, common.ErrCodeInvalidRequest, I18nWeb(c, "pages.login.toasts.emptyUsername"))
 		return
 	}
 	if form.Password == "" {
-		pureJsonMsg(c, http.StatusOK, false, I18nWeb(c, "pages.login.toasts.emptyPassword"))
+		jsonError(c, http.StatusOK, common.ErrCodeInvalidRequest, I18nWeb(c, "pages.login.toasts.emptyPassword"))
 		return
 	}
 
@@ -79,7 +81,7 @@ func (a *IndexController) login(c *gin.Context) {
 	if user == nil {
 		logger.Warningf("wrong username: \"%s\", password: \"%s\", IP: \"%s\"", safeUser, safePass, getRemoteIp(c))
 		a.tgbot.UserLoginNotify(safeUser, safePass, getRemoteIp(c), timeStr, 0)
-		pureJsonMsg(c, http.StatusOK, false, I18nWeb(c, "pages.login.toasts.wrongUsernameOrPassword"))
+		jsonError(c, http.StatusOK, common.ErrCodeInvalidCredentials, I18nWeb(c, "pages.login.toasts.wrongUsernameOrPassword"))
 		return
 	}
 
@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxJobList bounds the number of jobs returned by the job list.
+const maxJobList = 100
+
+// JobController handles the status and cancellation of background jobs.
+type JobController struct {
+	jobService service.JobService
+}
+
+// NewJobController creates a new JobController and sets up its routes.
+func NewJobController(g *gin.RouterGroup) *JobController {
+	a := &JobController{}
+	a.initRouter(g)
+	return a
+}
+
+// initRouter initializes the routes for background jobs.
+func (a *JobController) initRouter(g *gin.RouterGroup) {
+	g.GET("/list", a.getJobs)
+	g.GET("/:id", a.getJob)
+	g.POST("/:id/cancel", a.cancelJob)
+}
+
+// initRouterV2 sets up the background job routes of the REST API.
+func (a *JobController) initRouterV2(g *gin.RouterGroup) {
+	g.GET("", a.getJobs)
+	g.GET("/:id", a.getJob)
+	g.DELETE("/:id", a.cancelJob)
+}
+
+// getJobs lists the most recent background jobs.
+// @Summary      List jobs
+// @Description  Get the most recent background jobs, newest first
+// @Tags         jobs
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        limit  query     int  false  "Number of jobs, 20 by default and at most 100"
+// @Success      200    {object}  entity.Msg{obj=[]model.Job}
+// @Failure      400    {object}  entity.Msg
+// @Router       /jobs/list [get]
+// @Router       /v2/jobs [get]
+func (a *JobController) getJobs(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jobs, err := a.jobService.GetJobs(min(max(limit, 1), maxJobList))
+	jsonObj(c, jobs, err)
+}
+
+// getJob returns the status of a background job.
+// @Summary      Get job
+// @Description  Get the status, progress and result of a background job. Heavy operations called with async=true answer with the job to poll here.
+// @Tags         jobs
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Job ID"
+// @Success      200  {object}  entity.Msg{obj=model.Job}
+// @Failure      404  {object}  entity.Msg
+// @Router       /jobs/{id} [get]
+// @Router       /v2/jobs/{id} [get]
+func (a *JobController) getJob(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	job, err := a.jobService.GetJob(id)
+	jsonObj(c, job, err)
+}
+
+// cancelJob cancels a queued or running background job.
+// @Summary      Cancel job
+// @Description  Cancel a queued job, or ask a running job to stop at its next cancellation point
+// @Tags         jobs
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Job ID"
+// @Success      200  {object}  entity.Msg
+// @Failure      400  {object}  entity.Msg
+// @Router       /jobs/{id}/cancel [post]
+// @Router       /v2/jobs/{id} [delete]
+func (a *JobController) cancelJob(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	err = a.jobService.CancelJob(id)
+	jsonMsg(c, I18nWeb(c, "pages.index.jobCanceled"), err)
+}
@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OutboundPoolController handles external subscriptions imported as outbound pools.
+type OutboundPoolController struct {
+	outboundPoolService service.OutboundPoolService
+	xrayService         service.XrayService
+}
+
+// NewOutboundPoolController creates a new OutboundPoolController and sets up its routes.
+func NewOutboundPoolController(g *gin.RouterGroup) *OutboundPoolController {
+	a := &OutboundPoolController{}
+	a.initRouter(g)
+	return a
+}
+
+// initRouter initializes the routes for managing outbound pools.
+func (a *OutboundPoolController) initRouter(g *gin.RouterGroup) {
+	g.GET("/list", a.getPools)
+	g.POST("/add", a.addPool)
+	g.POST("/update/:id", a.updatePool)
+	g.POST("/del/:id", a.delPool)
+	g.POST("/refresh/:id", a.refreshPool)
+}
+
+// initRouterV2 sets up the outbound pool routes of the REST API.
+func (a *OutboundPoolController) initRouterV2(g *gin.RouterGroup) {
+	g.GET("", a.getPools)
+	g.POST("", createdStatus, a.addPool)
+	g.PUT("/:id", a.updatePool)
+	g.DELETE("/:id", a.delPool)
+	g.POST("/:id/refresh", a.refreshPool)
+}
+
+// getPools lists all outbound pools.
+// @Summary      List outbound pools
+// @Description  Get all external subscriptions imported as outbound pools with their last fetched outbounds
+// @Tags         outboundPools
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=[]model.OutboundPool}
+// @Failure      401  {object}  entity.Msg
+// @Router       /outboundPools/list [get]
+// @Router       /v2/outboundPools [get]
+func (a *OutboundPoolController) getPools(c *gin.Context) {
+	pools, err := a.outboundPoolService.GetPools()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonObj(c, pools, nil)
+}
+
+// addPool registers an external subscription as an outbound pool.
+// @Summary      Create outbound pool
+// @Description  Register a subscription URL. Its vless, trojan and shadowsocks links become outbounds tagged <tag>-1, <tag>-2 and so on behind a balancer with the pool tag, refreshed every interval minutes. With inboundTags the inbounds are routed to the balancer.
+// @Tags         outboundPools
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        data  body      model.OutboundPool  true  "Outbound pool"
+// @Success      200   {object}  entity.Msg{obj=model.OutboundPool}
+// @Failure      400   {object}  entity.Msg
+// @Router       /outboundPools/add [post]
+// @Router       /v2/outboundPools [post]
+func (a *OutboundPoolController) addPool(c *gin.Context) {
+	pool := &model.OutboundPool{}
+	if err := c.ShouldBind(pool); err != nil {
+		jsonMsg(c, I18nWeb(c, "create"), err)
+		return
+	}
+	err := a.outboundPoolService.AddPool(pool)
+	jsonMsgObj(c, I18nWeb(c, "create"), pool, err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+// updatePool updates an outbound pool.
+// @Summary      Update outbound pool
+// @Description  Update the subscription URL, interval, balancer strategy and routing of an outbound pool. A changed URL is fetched at once.
+// @Tags         outboundPools
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id    path      int                 true  "Outbound pool ID"
+// @Param        data  body      model.OutboundPool  true  "Outbound pool"
+// @Success      200   {object}  entity.Msg{obj=model.OutboundPool}
+// @Failure      400   {object}  entity.Msg
+// @Router       /outboundPools/update/{id} [post]
+// @Router       /v2/outboundPools/{id} [put]
+func (a *OutboundPoolController) updatePool(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "update"), err)
+		return
+	}
+	pool := &model.OutboundPool{}
+	if err := c.ShouldBind(pool); err != nil {
+		jsonMsg(c, I18nWeb(c, "update"), err)
+		return
+	}
+	pool.Id = id
+	err = a.outboundPoolService.UpdatePool(pool)
+	jsonMsgObj(c, I18nWeb(c, "update"), pool, err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+// delPool deletes an outbound pool.
+// @Summary      Delete outbound pool
+// @Description  Delete an outbound pool together with its outbounds and balancer
+// @Tags         outboundPools
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Outbound pool ID"
+// @Success      200  {object}  entity.Msg
+// @Failure      400  {object}  entity.Msg
+// @Router       /outboundPools/del/{id} [post]
+// @Router       /v2/outboundPools/{id} [delete]
+func (a *OutboundPoolController) delPool(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "delete"), err)
+		return
+	}
+	err = a.outboundPoolService.DelPool(id)
+	jsonMsg(c, I18nWeb(c, "delete"), err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+// refreshPool fetches the subscription of an outbound pool now.
+// @Summary      Refresh outbound pool
+// @Description  Fetch the subscription of an outbound pool now instead of waiting for its interval
+// @Tags         outboundPools
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Outbound pool ID"
+// @Success      200  {object}  entity.Msg{obj=model.OutboundPool}
+// @Failure      400  {object}  entity.Msg
+// @Router       /outboundPools/refresh/{id} [post]
+// @Router       /v2/outboundPools/{id}/refresh [post]
+func (a *OutboundPoolController) refreshPool(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	pool, changed, err := a.outboundPoolService.RefreshPool(id)
+	jsonMsgObj(c, I18nWeb(c, "somethingWentWrong"), pool, err)
+	if changed {
+		a.xrayService.SetToNeedRestart()
+	}
+}
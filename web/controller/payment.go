@@ -0,0 +1,276 @@
+package controller
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxWebhookBodySize limits the size of payment webhook requests.
+const maxWebhookBodySize = 1 << 20
+
+// PaymentController handles plans, recorded payments and payment provider webhooks.
+type PaymentController struct {
+	paymentService service.PaymentService
+	xrayService    service.XrayService
+}
+
+// NewPaymentController creates a new PaymentController and sets up its routes.
+func NewPaymentController(g *gin.RouterGroup) *PaymentController {
+	a := &PaymentController{}
+	a.initRouter(g)
+	return a
+}
+
+// initRouter initializes the routes for managing plans and listing payments.
+func (a *PaymentController) initRouter(g *gin.RouterGroup) {
+	g.GET("/plans", a.getPlans)
+	g.GET("/plans/get/:id", a.getPlan)
+	g.POST("/plans/add", a.addPlan)
+	g.POST("/plans/update/:id", a.updatePlan)
+	g.POST("/plans/del/:id", a.delPlan)
+	g.POST("/plans/provision/:id", a.provisionPlan)
+	g.GET("/list", a.getPayments)
+}
+
+// initRouterV2 sets up the plan and payment routes of the REST API.
+func (a *PaymentController) initRouterV2(g *gin.RouterGroup) {
+	g.GET("", a.getPayments)
+	g.GET("/plans", a.getPlans)
+	g.GET("/plans/:id", a.getPlan)
+	g.POST("/plans", createdStatus, a.addPlan)
+	g.PUT("/plans/:id", a.updatePlan)
+	g.DELETE("/plans/:id", a.delPlan)
+	g.POST("/plans/:id/clients", createdStatus, a.provisionPlan)
+}
+
+// getPlans lists all plans.
+// @Summary      List plans
+// @Description  Get all purchasable plans
+// @Tags         payment
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=[]model.Plan}
+// @Failure      401  {object}  entity.Msg
+// @Router       /payment/plans [get]
+// @Router       /v2/payment/plans [get]
+func (a *PaymentController) getPlans(c *gin.Context) {
+	plans, err := a.paymentService.GetPlans()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonObj(c, plans, nil)
+}
+
+// getPlan returns a plan.
+// @Summary      Get plan
+// @Description  Get a purchasable plan with its prices, inbounds and the quota of the provisioned client
+// @Tags         payment
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Plan ID"
+// @Success      200  {object}  entity.Msg{obj=model.Plan}
+// @Failure      404  {object}  entity.Msg
+// @Router       /payment/plans/get/{id} [get]
+// @Router       /v2/payment/plans/{id} [get]
+func (a *PaymentController) getPlan(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "get"), err)
+		return
+	}
+	plan, err := a.paymentService.GetPlan(id)
+	jsonObj(c, plan, err)
+}
+
+// addPlan creates a plan.
+// @Summary      Create plan
+// @Description  Create a purchasable plan with a price, optional prices in further currencies, the inbounds the client can be created on and the quota of the provisioned client
+// @Tags         payment
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        data  body      model.Plan  true  "Plan"
+// @Success      200   {object}  entity.Msg{obj=model.Plan}
+// @Failure      400   {object}  entity.Msg
+// @Router       /payment/plans/add [post]
+// @Router       /v2/payment/plans [post]
+func (a *PaymentController) addPlan(c *gin.Context) {
+	plan := &model.Plan{}
+	err := c.ShouldBind(plan)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "create"), err)
+		return
+	}
+	err = a.paymentService.AddPlan(plan)
+	jsonMsgObj(c, I18nWeb(c, "create"), plan, err)
+}
+
+// updatePlan updates a plan.
+// @Summary      Update plan
+// @Description  Update a plan. Clients already provisioned for it are not changed.
+// @Tags         payment
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id    path      int         true  "Plan ID"
+// @Param        data  body      model.Plan  true  "Plan"
+// @Success      200   {object}  entity.Msg{obj=model.Plan}
+// @Failure      400   {object}  entity.Msg
+// @Router       /payment/plans/update/{id} [post]
+// @Router       /v2/payment/plans/{id} [put]
+func (a *PaymentController) updatePlan(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "update"), err)
+		return
+	}
+	plan := &model.Plan{}
+	err = c.ShouldBind(plan)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "update"), err)
+		return
+	}
+	plan.Id = id
+	err = a.paymentService.UpdatePlan(plan)
+	jsonMsgObj(c, I18nWeb(c, "update"), plan, err)
+}
+
+// delPlan deletes a plan.
+// @Summary      Delete plan
+// @Description  Delete a plan. Clients already provisioned for it are kept.
+// @Tags         payment
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Plan ID"
+// @Success      200  {object}  entity.Msg
+// @Failure      400  {object}  entity.Msg
+// @Router       /payment/plans/del/{id} [post]
+// @Router       /v2/payment/plans/{id} [delete]
+func (a *PaymentController) delPlan(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "delete"), err)
+		return
+	}
+	err = a.paymentService.DelPlan(id)
+	jsonMsg(c, I18nWeb(c, "delete"), err)
+}
+
+// PlanProvisionRequest defines the client to create from a plan.
+type PlanProvisionRequest struct {
+	InboundId int    `json:"inboundId" form:"inboundId" example:"0"`        // One of the plan's inbounds, its default when 0
+	Email     string `json:"email" form:"email" example:"user@example.com"` // Client email, random when empty
+	SubId     string `json:"subId" form:"subId" example:"k3p9xq2m7v1t8n4r"` // Subscription ID, random when empty
+	TgId      int64  `json:"tgId" form:"tgId" example:"123456789"`          // Telegram user ID for notifications
+	Comment   string `json:"comment" form:"comment" example:"Order 1042"`   // Client comment, the plan name when empty
+	Referral  string `json:"ref" form:"ref" example:"channel42"`            // Referral code the client is attributed to
+}
+
+// provisionPlan creates the client of a plan.
+// @Summary      Provision plan
+// @Description  Create a client with the quota, validity and IP limit of a plan on one of its inbounds, as payment webhooks do, for bots and other integrations selling plans
+// @Tags         payment
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id    path      int                   true   "Plan ID"
+// @Param        data  body      PlanProvisionRequest  false  "Client"
+// @Success      200   {object}  entity.Msg{obj=ProvisionedClientResponse}
+// @Failure      400   {object}  entity.Msg
+// @Router       /payment/plans/provision/{id} [post]
+// @Router       /v2/payment/plans/{id}/clients [post]
+func (a *PaymentController) provisionPlan(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	request := &PlanProvisionRequest{}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBind(request); err != nil {
+			jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+			return
+		}
+	}
+	plan, err := a.paymentService.GetPlan(id)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	inbound, client, needRestart, err := a.paymentService.ProvisionPlan(plan, request.InboundId, service.ClientPreset{
+		Email:    request.Email,
+		SubID:    request.SubId,
+		TgID:     request.TgId,
+		Comment:  request.Comment,
+		Referral: request.Referral,
+	})
+	if needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonMsgObj(c, I18nWeb(c, "pages.inbounds.toasts.inboundClientAddSuccess"), newProvisionedClientResponse(c, inbound, client), nil)
+}
+
+// getPayments lists recorded payments.
+// @Summary      List payments
+// @Description  Get all verified payments with their provisioning status, newest first
+// @Tags         payment
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=[]model.Payment}
+// @Failure      401  {object}  entity.Msg
+// @Router       /payment/list [get]
+// @Router       /v2/payment [get]
+func (a *PaymentController) getPayments(c *gin.Context) {
+	payments, err := a.paymentService.GetPayments()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonObj(c, payments, nil)
+}
+
+// webhook receives payment notifications. This route is authenticated by the provider's signature.
+// Failures are answered with an error status so that providers retry the delivery.
+// @Summary      Payment webhook
+// @Description  Receive a signed payment notification and provision the purchased client. Supported providers: stripe, hmac. A referral code in the ref metadata or field attributes the client to its referrer.
+// @Tags         payment
+// @Accept       json
+// @Produce      json
+// @Param        provider  path      string  true  "Payment provider"
+// @Success      200       {object}  entity.Msg
+// @Failure      400       {object}  entity.Msg
+// @Router       /payment/webhook/{provider} [post]
+func (a *PaymentController) webhook(c *gin.Context) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookBodySize))
+	if err != nil {
+		jsonError(c, http.StatusBadRequest, common.ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	needRestart, err := a.paymentService.HandleWebhook(c.Param("provider"), c.Request.Header, body)
+	if err != nil {
+		logger.Warning("Payment webhook", c.Param("provider"), "from", getRemoteIp(c), "failed:", err)
+		jsonError(c, http.StatusBadRequest, common.ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	if needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+	pureJsonMsg(c, http.StatusOK, true, "")
+}
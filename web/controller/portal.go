@@ -0,0 +1,178 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/web/middleware"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+	"github.com/mhsanaei/3x-ui/v2/web/session"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// portalLoginRateLimit bounds the login and code requests each client address may make per minute.
+const portalLoginRateLimit = 10
+
+// PortalLoginForm is the login request of the self-service portal.
+// Customers log in with their subscription ID, or with their email and a one-time code sent via Telegram.
+type PortalLoginForm struct {
+	SubId string `json:"subId" form:"subId"`
+	Email string `json:"email" form:"email"`
+	Code  string `json:"code" form:"code"`
+}
+
+// PortalVoucherForm is the voucher redemption request of the self-service portal.
+type PortalVoucherForm struct {
+	Code  string `json:"code" form:"code"`
+	Email string `json:"email" form:"email"` // Client to extend, a new client is created when empty
+}
+
+// PortalController handles the self-service portal of end customers.
+// It has its own login kept apart from the panel login and grants no access to the panel.
+type PortalController struct {
+	portalService  service.PortalService
+	settingService service.SettingService
+	xrayService    service.XrayService
+}
+
+// NewPortalController creates a new PortalController and sets up its routes, keeping portal
+// logins in the sessions of the given middleware.
+func NewPortalController(g *gin.RouterGroup, portalSessions gin.HandlerFunc) *PortalController {
+	a := &PortalController{}
+	a.initRouter(g, portalSessions)
+	return a
+}
+
+// initRouter sets up the portal page and its API. Logins and login codes are rate limited per
+// client address on top of the limits per email of the portal service.
+func (a *PortalController) initRouter(g *gin.RouterGroup, portalSessions gin.HandlerFunc) {
+	g = g.Group("/portal")
+	g.Use(a.checkEnabled, portalSessions)
+
+	loginLimit := middleware.RateLimitMiddleware("portal", portalLoginRateLimit)
+	g.GET("/", a.index)
+	g.POST("/api/login", middleware.ReadOnlyAllowed, loginLimit, a.login)
+	g.POST("/api/code", middleware.ReadOnlyAllowed, loginLimit, a.sendCode)
+	g.POST("/api/logout", middleware.ReadOnlyAllowed, a.logout)
+
+	api := g.Group("/api")
+	api.Use(a.checkPortalLogin)
+	api.GET("/info", a.info)
+	api.POST("/rotate", a.rotate)
+	api.POST("/voucher", a.redeemVoucher)
+}
+
+// checkEnabled hides the portal while it is disabled in the settings.
+func (a *PortalController) checkEnabled(c *gin.Context) {
+	if enable, err := a.settingService.GetPortalEnable(); err != nil || !enable {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	c.Next()
+}
+
+// checkPortalLogin rejects portal API requests without a portal login.
+func (a *PortalController) checkPortalLogin(c *gin.Context) {
+	if session.GetPortalSubId(c) == "" {
+		jsonError(c, http.StatusUnauthorized, common.ErrCodeUnauthorized, I18nWeb(c, "pages.login.loginAgain"))
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+// index renders the portal page.
+func (a *PortalController) index(c *gin.Context) {
+	html(c, "portal.html", "pages.portal.title", gin.H{"loggedIn": session.GetPortalSubId(c) != ""})
+}
+
+// login logs a customer in to the portal.
+func (a *PortalController) login(c *gin.Context) {
+	var form PortalLoginForm
+	if err := c.ShouldBind(&form); err != nil {
+		jsonError(c, http.StatusOK, common.ErrCodeInvalidRequest, I18nWeb(c, "pages.login.toasts.invalidFormData"))
+		return
+	}
+
+	subId := strings.TrimSpace(form.SubId)
+	var err error
+	if subId != "" {
+		err = a.portalService.CheckSubId(subId)
+	} else {
+		subId, err = a.portalService.CheckLoginCode(form.Email, form.Code)
+	}
+	if err != nil {
+		logger.Warning("Portal login failed from", getRemoteIp(c), ":", err)
+		jsonMsg(c, I18nWeb(c, "pages.portal.loginFailed"), err)
+		return
+	}
+
+	session.SetPortalSubId(c, subId)
+	if err := sessions.Default(c).Save(); err != nil {
+		logger.Warning("Unable to save session: ", err)
+		return
+	}
+	jsonMsg(c, I18nWeb(c, "pages.login.toasts.successLogin"), nil)
+}
+
+// sendCode sends a one-time login code to the Telegram account linked to a client.
+func (a *PortalController) sendCode(c *gin.Context) {
+	var form PortalLoginForm
+	if err := c.ShouldBind(&form); err != nil {
+		jsonError(c, http.StatusOK, common.ErrCodeInvalidRequest, I18nWeb(c, "pages.login.toasts.invalidFormData"))
+		return
+	}
+	err := a.portalService.SendLoginCode(form.Email)
+	jsonMsg(c, I18nWeb(c, "pages.portal.codeSent"), err)
+}
+
+// logout ends the portal login.
+func (a *PortalController) logout(c *gin.Context) {
+	session.ClearPortalSubId(c)
+	if err := sessions.Default(c).Save(); err != nil {
+		logger.Warning("Unable to save session after clearing:", err)
+	}
+	jsonMsg(c, "", nil)
+}
+
+// info returns the usage and config links of the logged in customer.
+func (a *PortalController) info(c *gin.Context) {
+	info, err := a.portalService.GetPortalInfo(session.GetPortalSubId(c), getHost(c))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonObj(c, info, nil)
+}
+
+// rotate replaces the credentials of the logged in customer's clients.
+func (a *PortalController) rotate(c *gin.Context) {
+	needRestart, err := a.portalService.RotateCredentials(session.GetPortalSubId(c))
+	if needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+	jsonMsg(c, I18nWeb(c, "pages.portal.rotated"), err)
+}
+
+// redeemVoucher applies a voucher to one of the logged in customer's clients or adds a new client.
+func (a *PortalController) redeemVoucher(c *gin.Context) {
+	var form PortalVoucherForm
+	if err := c.ShouldBind(&form); err != nil {
+		jsonError(c, http.StatusOK, common.ErrCodeInvalidRequest, I18nWeb(c, "pages.login.toasts.invalidFormData"))
+		return
+	}
+	redemption, needRestart, err := a.portalService.RedeemVoucher(session.GetPortalSubId(c), form.Code, form.Email)
+	if err != nil {
+		logger.Warning("Voucher redemption failed from", getRemoteIp(c), ":", err)
+		jsonMsg(c, I18nWeb(c, "pages.portal.voucherFailed"), err)
+		return
+	}
+	if needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+	jsonMsgObj(c, I18nWeb(c, "pages.portal.voucherRedeemed"), redemption, nil)
+}
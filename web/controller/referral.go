@@ -0,0 +1,290 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReferralController handles referrers, their referral links and the clients attributed to them.
+type ReferralController struct {
+	referralService service.ReferralService
+}
+
+// NewReferralController creates a new ReferralController and sets up its routes.
+func NewReferralController(g *gin.RouterGroup) *ReferralController {
+	a := &ReferralController{}
+	a.initRouter(g)
+	return a
+}
+
+// initRouter initializes the routes for managing referrers and referrals.
+func (a *ReferralController) initRouter(g *gin.RouterGroup) {
+	g.GET("/list", a.getReferrers)
+	g.POST("/add", a.addReferrer)
+	g.POST("/update/:id", a.updateReferrer)
+	g.POST("/del/:id", a.delReferrer)
+	g.GET("/link/:id", a.getReferralLink)
+	g.GET("/report", a.getReferralReport)
+	g.GET("/clients", a.getReferrals)
+	g.POST("/attach/:email", a.attachReferral)
+	g.POST("/detach/:email", a.detachReferral)
+}
+
+// initRouterV2 sets up the referral routes of the REST API.
+func (a *ReferralController) initRouterV2(g *gin.RouterGroup) {
+	g.GET("", a.getReferrers)
+	g.POST("", createdStatus, a.addReferrer)
+	g.PUT("/:id", a.updateReferrer)
+	g.DELETE("/:id", a.delReferrer)
+	g.GET("/:id/link", a.getReferralLink)
+	g.GET("/report", a.getReferralReport)
+	g.GET("/clients", a.getReferrals)
+	g.PUT("/clients/:email", a.attachReferral)
+	g.DELETE("/clients/:email", a.detachReferral)
+}
+
+// AddReferrerResponse defines the response of a created referrer.
+type AddReferrerResponse struct {
+	Referrer *model.Referrer `json:"referrer"`                                                      // Stored referrer
+	Link     string          `json:"link,omitempty" example:"https://t.me/ShopBot?start=channel42"` // Referral link, set when the referral link template is configured
+}
+
+// ReferralAttachRequest defines the referral code a client is attributed to.
+type ReferralAttachRequest struct {
+	Code string `json:"code" form:"code" example:"channel42"` // Referral code
+}
+
+// getReferrers lists all referrers.
+// @Summary      List referrers
+// @Description  Get all referrers with their referral code
+// @Tags         referrals
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=[]model.Referrer}
+// @Failure      400  {object}  entity.Msg
+// @Router       /referrers/list [get]
+// @Router       /v2/referrers [get]
+func (a *ReferralController) getReferrers(c *gin.Context) {
+	referrers, err := a.referralService.GetReferrers()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonObj(c, referrers, nil)
+}
+
+// addReferrer creates a referrer and its referral link.
+// @Summary      Create referrer
+// @Description  Create a referrer such as a reseller's Telegram sales channel, with a random referral code when none is given, and return its referral link. Clients created by payments, plans and deposit tokens with the code in their ref field are attributed to the referrer.
+// @Tags         referrals
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        data  body      model.Referrer  true  "Referrer"
+// @Success      200   {object}  entity.Msg{obj=AddReferrerResponse}
+// @Failure      400   {object}  entity.Msg
+// @Router       /referrers/add [post]
+// @Router       /v2/referrers [post]
+func (a *ReferralController) addReferrer(c *gin.Context) {
+	referrer := &model.Referrer{}
+	if err := c.ShouldBind(referrer); err != nil {
+		jsonMsg(c, I18nWeb(c, "create"), err)
+		return
+	}
+	if err := a.referralService.AddReferrer(referrer); err != nil {
+		jsonMsg(c, I18nWeb(c, "create"), err)
+		return
+	}
+	link, err := a.referralService.GetReferralLink(referrer.Id)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "create"), err)
+		return
+	}
+	jsonMsgObj(c, I18nWeb(c, "create"), &AddReferrerResponse{
+		Referrer: referrer,
+		Link:     link.Link,
+	}, nil)
+}
+
+// updateReferrer updates a referrer.
+// @Summary      Update referrer
+// @Description  Update the code, name, remark or state of a referrer. Clients attributed under its old code stay attributed.
+// @Tags         referrals
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id    path      int             true  "Referrer ID"
+// @Param        data  body      model.Referrer  true  "Referrer"
+// @Success      200   {object}  entity.Msg{obj=model.Referrer}
+// @Failure      400   {object}  entity.Msg
+// @Router       /referrers/update/{id} [post]
+// @Router       /v2/referrers/{id} [put]
+func (a *ReferralController) updateReferrer(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "update"), err)
+		return
+	}
+	referrer := &model.Referrer{}
+	if err := c.ShouldBind(referrer); err != nil {
+		jsonMsg(c, I18nWeb(c, "update"), err)
+		return
+	}
+	referrer.Id = id
+	err = a.referralService.UpdateReferrer(referrer)
+	jsonMsgObj(c, I18nWeb(c, "update"), referrer, err)
+}
+
+// delReferrer deletes a referrer.
+// @Summary      Delete referrer
+// @Description  Delete a referrer and the attribution of its clients. The clients are kept.
+// @Tags         referrals
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Referrer ID"
+// @Success      200  {object}  entity.Msg
+// @Failure      400  {object}  entity.Msg
+// @Router       /referrers/del/{id} [post]
+// @Router       /v2/referrers/{id} [delete]
+func (a *ReferralController) delReferrer(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "delete"), err)
+		return
+	}
+	err = a.referralService.DelReferrer(id)
+	jsonMsg(c, I18nWeb(c, "delete"), err)
+}
+
+// getReferralLink returns the referral link of a referrer.
+// @Summary      Get referral link
+// @Description  Get the referral link of a referrer, built from the referral link template setting
+// @Tags         referrals
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Referrer ID"
+// @Success      200  {object}  entity.Msg{obj=entity.ReferralLink}
+// @Failure      400  {object}  entity.Msg
+// @Router       /referrers/link/{id} [get]
+// @Router       /v2/referrers/{id}/link [get]
+func (a *ReferralController) getReferralLink(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	link, err := a.referralService.GetReferralLink(id)
+	jsonObj(c, link, err)
+}
+
+// getReferralReport reports the clients and revenue of every referrer.
+// @Summary      Referral report
+// @Description  Get for every referrer the clients attributed within a time range, how many of them were created by a payment and the revenue by currency
+// @Tags         referrals
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        from  query     int  false  "Start time in milliseconds"
+// @Param        to    query     int  false  "End time in milliseconds, exclusive"
+// @Success      200   {object}  entity.Msg{obj=[]entity.ReferrerReport}
+// @Failure      400   {object}  entity.Msg
+// @Router       /referrers/report [get]
+// @Router       /v2/referrers/report [get]
+func (a *ReferralController) getReferralReport(c *gin.Context) {
+	from, to, err := getTimeRange(c)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	report, err := a.referralService.GetReferralReport(from, to)
+	jsonObj(c, report, err)
+}
+
+// getReferrals lists the attributed clients.
+// @Summary      List referrals
+// @Description  List the clients attributed to referrers, newest first, optionally of one referrer and within a time range
+// @Tags         referrals
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        referrerId  query     int  false  "Referrer ID"
+// @Param        from        query     int  false  "Start time in milliseconds"
+// @Param        to          query     int  false  "End time in milliseconds, exclusive"
+// @Success      200         {object}  entity.Msg{obj=[]model.Referral}
+// @Failure      400         {object}  entity.Msg
+// @Router       /referrers/clients [get]
+// @Router       /v2/referrers/clients [get]
+func (a *ReferralController) getReferrals(c *gin.Context) {
+	referrerId, err := strconv.Atoi(c.DefaultQuery("referrerId", "0"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	from, to, err := getTimeRange(c)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	referrals, err := a.referralService.GetReferrals(referrerId, from, to)
+	jsonObj(c, referrals, err)
+}
+
+// attachReferral attributes an existing client to a referrer.
+// @Summary      Attach referral code
+// @Description  Attribute an existing client to the referrer with the given code, replacing an earlier attribution
+// @Tags         referrals
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        email  path      string                 true  "Client email address"
+// @Param        data   body      ReferralAttachRequest  true  "Referral code"
+// @Success      200    {object}  entity.Msg
+// @Failure      400    {object}  entity.Msg
+// @Router       /referrers/attach/{email} [post]
+// @Router       /v2/referrers/clients/{email} [put]
+func (a *ReferralController) attachReferral(c *gin.Context) {
+	request := &ReferralAttachRequest{}
+	if err := c.ShouldBind(request); err != nil {
+		jsonMsg(c, I18nWeb(c, "update"), err)
+		return
+	}
+	err := a.referralService.AttachReferral(c.Param("email"), request.Code)
+	jsonMsg(c, I18nWeb(c, "update"), err)
+}
+
+// detachReferral removes the attribution of a client.
+// @Summary      Detach referral code
+// @Description  Remove the attribution of a client to its referrer
+// @Tags         referrals
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        email  path      string  true  "Client email address"
+// @Success      200    {object}  entity.Msg
+// @Failure      400    {object}  entity.Msg
+// @Router       /referrers/detach/{email} [post]
+// @Router       /v2/referrers/clients/{email} [delete]
+func (a *ReferralController) detachReferral(c *gin.Context) {
+	err := a.referralService.DetachReferral(c.Param("email"))
+	jsonMsg(c, I18nWeb(c, "delete"), err)
+}
+
+// getTimeRange reads the optional from and to query parameters, in milliseconds.
+func getTimeRange(c *gin.Context) (int64, int64, error) {
+	from, err := strconv.ParseInt(c.DefaultQuery("from", "0"), 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	to, err := strconv.ParseInt(c.DefaultQuery("to", "0"), 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return from, to, nil
+}
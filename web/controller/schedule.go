@@ -0,0 +1,188 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxScheduleRunList caps the number of executions returned at once.
+const maxScheduleRunList = 500
+
+// ScheduleController handles one-off and recurring scheduled actions.
+type ScheduleController struct {
+	scheduleService service.ScheduleService
+}
+
+// NewScheduleController creates a new ScheduleController and sets up its routes.
+func NewScheduleController(g *gin.RouterGroup) *ScheduleController {
+	a := &ScheduleController{}
+	a.initRouter(g)
+	return a
+}
+
+// initRouter initializes the routes for managing scheduled actions.
+func (a *ScheduleController) initRouter(g *gin.RouterGroup) {
+	g.GET("/list", a.getActions)
+	g.POST("/add", a.addAction)
+	g.POST("/update/:id", a.updateAction)
+	g.POST("/del/:id", a.delAction)
+	g.GET("/runs", a.getRuns)
+	g.POST("/run/:id", a.runAction)
+}
+
+// initRouterV2 sets up the scheduled action routes of the REST API.
+func (a *ScheduleController) initRouterV2(g *gin.RouterGroup) {
+	g.GET("", a.getActions)
+	g.POST("", createdStatus, a.addAction)
+	g.PUT("/:id", a.updateAction)
+	g.DELETE("/:id", a.delAction)
+	g.GET("/runs", a.getRuns)
+	g.POST("/:id/run", a.runAction)
+}
+
+// getActions lists the scheduled actions.
+// @Summary      List scheduled actions
+// @Description  Get the scheduled actions, those running next first
+// @Tags         schedules
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=[]model.ScheduledAction}
+// @Failure      401  {object}  entity.Msg
+// @Router       /schedules/list [get]
+// @Router       /v2/schedules [get]
+func (a *ScheduleController) getActions(c *gin.Context) {
+	actions, err := a.scheduleService.GetActions()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonObj(c, actions, nil)
+}
+
+// addAction creates a scheduled action.
+// @Summary      Create scheduled action
+// @Description  Schedule an action to run once at runAt (Unix milliseconds) or on a recurring cron schedule in the panel time zone, such as "0 3 1 * *". Inbound actions need inboundId, client actions need email, and resetClientTraffic and delClient need both. One-off actions are disabled after they ran.
+// @Tags         schedules
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        data  body      model.ScheduledAction  true  "Scheduled action"
+// @Success      200   {object}  entity.Msg{obj=model.ScheduledAction}
+// @Failure      400   {object}  entity.Msg
+// @Router       /schedules/add [post]
+// @Router       /v2/schedules [post]
+func (a *ScheduleController) addAction(c *gin.Context) {
+	action := &model.ScheduledAction{}
+	if err := c.ShouldBind(action); err != nil {
+		jsonMsg(c, I18nWeb(c, "create"), err)
+		return
+	}
+	err := a.scheduleService.AddAction(action)
+	jsonMsgObj(c, I18nWeb(c, "create"), action, err)
+}
+
+// updateAction updates a scheduled action.
+// @Summary      Update scheduled action
+// @Description  Update a scheduled action and compute when it runs next
+// @Tags         schedules
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id    path      int                    true  "Scheduled action ID"
+// @Param        data  body      model.ScheduledAction  true  "Scheduled action"
+// @Success      200   {object}  entity.Msg{obj=model.ScheduledAction}
+// @Failure      400   {object}  entity.Msg
+// @Router       /schedules/update/{id} [post]
+// @Router       /v2/schedules/{id} [put]
+func (a *ScheduleController) updateAction(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "update"), err)
+		return
+	}
+	action := &model.ScheduledAction{}
+	if err := c.ShouldBind(action); err != nil {
+		jsonMsg(c, I18nWeb(c, "update"), err)
+		return
+	}
+	action.Id = id
+	err = a.scheduleService.UpdateAction(action)
+	jsonMsgObj(c, I18nWeb(c, "update"), action, err)
+}
+
+// delAction deletes a scheduled action.
+// @Summary      Delete scheduled action
+// @Description  Delete a scheduled action with its execution history
+// @Tags         schedules
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Scheduled action ID"
+// @Success      200  {object}  entity.Msg
+// @Failure      400  {object}  entity.Msg
+// @Router       /schedules/del/{id} [post]
+// @Router       /v2/schedules/{id} [delete]
+func (a *ScheduleController) delAction(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "delete"), err)
+		return
+	}
+	err = a.scheduleService.DelAction(id)
+	jsonMsg(c, I18nWeb(c, "delete"), err)
+}
+
+// getRuns lists the executions of scheduled actions.
+// @Summary      List scheduled action runs
+// @Description  Get the latest executions of scheduled actions, newest first
+// @Tags         schedules
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        actionId  query     int  false  "Only the executions of this scheduled action"
+// @Param        limit     query     int  false  "Number of executions, 100 by default and at most 500"
+// @Success      200       {object}  entity.Msg{obj=[]model.ScheduledActionRun}
+// @Failure      400       {object}  entity.Msg
+// @Router       /schedules/runs [get]
+// @Router       /v2/schedules/runs [get]
+func (a *ScheduleController) getRuns(c *gin.Context) {
+	actionId, err := strconv.Atoi(c.DefaultQuery("actionId", "0"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	runs, err := a.scheduleService.GetRuns(actionId, min(max(limit, 1), maxScheduleRunList))
+	jsonObj(c, runs, err)
+}
+
+// runAction runs a scheduled action now.
+// @Summary      Run scheduled action
+// @Description  Run a scheduled action right away without changing when it runs next. The request is answered with the execution, which holds the error when the action failed.
+// @Tags         schedules
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Scheduled action ID"
+// @Success      200  {object}  entity.Msg{obj=model.ScheduledActionRun}
+// @Failure      404  {object}  entity.Msg
+// @Router       /schedules/run/{id} [post]
+// @Router       /v2/schedules/{id}/run [post]
+func (a *ScheduleController) runAction(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "update"), err)
+		return
+	}
+	run, err := a.scheduleService.RunAction(id)
+	jsonMsgObj(c, I18nWeb(c, "update"), run, err)
+}
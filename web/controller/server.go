@@ -1,13 +1,18 @@
 package controller
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"regexp"
 	"strconv"
 	"time"
 
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
 	"github.com/mhsanaei/3x-ui/v2/web/global"
+	"github.com/mhsanaei/3x-ui/v2/web/middleware"
 	"github.com/mhsanaei/3x-ui/v2/web/service"
 
 	"github.com/gin-gonic/gin"
@@ -19,8 +24,19 @@ var filenameRegex = regexp.MustCompile(`^[a-zA-Z0-9_\-.]+$`)
 type ServerController struct {
 	BaseController
 
-	serverService  service.ServerService
-	settingService service.SettingService
+	serverService   service.ServerService
+	settingService  service.SettingService
+	firewallService service.FirewallService
+	panelService    service.PanelService
+	jobService      service.JobService
+
+	maintenanceService service.MaintenanceService
+	publicIPService    service.PublicIPService
+	sshTunnelService   service.SSHTunnelService
+	endpointStats      service.EndpointStatsService
+	decoyService       service.DecoyService
+	tunnelService      service.TunnelService
+	updateCheckService service.UpdateCheckService
 
 	lastStatus *service.Status
 
@@ -49,16 +65,36 @@ func (a *ServerController) initRouter(g *gin.RouterGroup) {
 	g.GET("/getNewmldsa65", a.getNewmldsa65)
 	g.GET("/getNewmlkem768", a.getNewmlkem768)
 	g.GET("/getNewVlessEnc", a.getNewVlessEnc)
+	g.GET("/firewall", a.getFirewallState)
+	g.GET("/sshSessions", a.getSshSessions)
+	g.GET("/endpointStats", a.getEndpointStats)
+	g.GET("/subRequestStats", a.getSubRequestStats)
+	g.GET("/decoy/probes", a.getDecoyProbes)
+	g.GET("/decoy/bans", a.getDecoyBans)
+	g.GET("/tunnel", a.getTunnel)
+	g.GET("/updates", a.getUpdates)
+	g.GET("/service/:unit/status", a.getUnitStatus)
+	g.GET("/service/:unit/journal", a.getUnitJournal)
 
 	g.POST("/stopXrayService", a.stopXrayService)
 	g.POST("/restartXrayService", a.restartXrayService)
 	g.POST("/installXray/:version", a.installXray)
 	g.POST("/updateGeofile", a.updateGeofile)
 	g.POST("/updateGeofile/:fileName", a.updateGeofile)
-	g.POST("/logs/:count", a.getLogs)
-	g.POST("/xraylogs/:count", a.getXrayLogs)
+	g.POST("/logs/:count", middleware.ReadOnlyAllowed, a.getLogs)
+	g.POST("/xraylogs/:count", middleware.ReadOnlyAllowed, a.getXrayLogs)
 	g.POST("/importDB", a.importDB)
+	g.POST("/vacuumDB", a.vacuumDB)
+	g.POST("/maintenance", a.runMaintenance)
+	g.POST("/checkPublicIP", a.checkPublicIP)
 	g.POST("/getNewEchCert", a.getNewEchCert)
+	g.POST("/firewall/apply", a.applyFirewall)
+	g.POST("/tune", a.tune)
+	g.POST("/restartPanel", a.restartPanel)
+	g.POST("/reboot", a.reboot)
+	g.POST("/reloadCert", a.reloadCert)
+	g.POST("/endpointStats/reset", a.resetEndpointStats)
+	g.POST("/decoy/unban/:ip", a.unbanDecoy)
 }
 
 // refreshStatus updates the cached server status and collects CPU history.
@@ -91,6 +127,7 @@ func (a *ServerController) startTask() {
 // @Success      200  {object}  entity.Msg{obj=service.Status}
 // @Failure      401  {object}  entity.Msg
 // @Router       /server/status [get]
+// @Router       /v2/server/status [get]
 func (a *ServerController) status(c *gin.Context) { jsonObj(c, a.lastStatus, nil) }
 
 // getCpuHistoryBucket retrieves aggregated CPU usage history based on the specified time bucket.
@@ -104,6 +141,7 @@ func (a *ServerController) status(c *gin.Context) { jsonObj(c, a.lastStatus, nil
 // @Success      200     {object}  entity.Msg
 // @Failure      400     {object}  entity.Msg
 // @Router       /server/cpuHistory/{bucket} [get]
+// @Router       /v2/server/cpuHistory/{bucket} [get]
 func (a *ServerController) getCpuHistoryBucket(c *gin.Context) {
 	bucketStr := c.Param("bucket")
 	bucket, err := strconv.Atoi(bucketStr)
@@ -137,6 +175,7 @@ func (a *ServerController) getCpuHistoryBucket(c *gin.Context) {
 // @Success      200  {object}  entity.Msg
 // @Failure      401  {object}  entity.Msg
 // @Router       /server/getXrayVersion [get]
+// @Router       /v2/server/getXrayVersion [get]
 func (a *ServerController) getXrayVersion(c *gin.Context) {
 	now := time.Now().Unix()
 	if now-a.lastGetVersionsTime <= 60 { // 1 minute cache
@@ -167,6 +206,7 @@ func (a *ServerController) getXrayVersion(c *gin.Context) {
 // @Success      200      {object}  entity.Msg
 // @Failure      400      {object}  entity.Msg
 // @Router       /server/installXray/{version} [post]
+// @Router       /v2/server/installXray/{version} [post]
 func (a *ServerController) installXray(c *gin.Context) {
 	version := c.Param("version")
 	err := a.serverService.UpdateXray(version)
@@ -181,9 +221,12 @@ func (a *ServerController) installXray(c *gin.Context) {
 // @Produce      json
 // @Security     ApiKeyAuth
 // @Param        fileName  path      string  false  "Geo file name"
+// @Param        async     query     bool    false  "Run as a background job and answer with the job"
 // @Success      200       {object}  entity.Msg
 // @Failure      400       {object}  entity.Msg
 // @Router       /server/updateGeofile/{fileName} [post]
+// @Router       /v2/server/updateGeofile [post]
+// @Router       /v2/server/updateGeofile/{fileName} [post]
 func (a *ServerController) updateGeofile(c *gin.Context) {
 	fileName := c.Param("fileName")
 
@@ -194,6 +237,14 @@ func (a *ServerController) updateGeofile(c *gin.Context) {
 		return
 	}
 
+	if isAsync(c) {
+		job, err := a.jobService.Enqueue("geofile", func(ctx context.Context, report service.JobProgressFunc) (any, error) {
+			return nil, a.serverService.UpdateGeofileWithProgress(ctx, fileName, report)
+		})
+		jsonJob(c, I18nWeb(c, "pages.index.jobQueued"), job, err)
+		return
+	}
+
 	err := a.serverService.UpdateGeofile(fileName)
 	jsonMsg(c, I18nWeb(c, "pages.index.geofileUpdatePopover"), err)
 }
@@ -208,6 +259,7 @@ func (a *ServerController) updateGeofile(c *gin.Context) {
 // @Success      200  {object}  entity.Msg
 // @Failure      400  {object}  entity.Msg
 // @Router       /server/stopXrayService [post]
+// @Router       /v2/server/stopXrayService [post]
 func (a *ServerController) stopXrayService(c *gin.Context) {
 	err := a.serverService.StopXrayService()
 	if err != nil {
@@ -227,6 +279,7 @@ func (a *ServerController) stopXrayService(c *gin.Context) {
 // @Success      200  {object}  entity.Msg
 // @Failure      400  {object}  entity.Msg
 // @Router       /server/restartXrayService [post]
+// @Router       /v2/server/restartXrayService [post]
 func (a *ServerController) restartXrayService(c *gin.Context) {
 	err := a.serverService.RestartXrayService()
 	if err != nil {
@@ -249,6 +302,7 @@ func (a *ServerController) restartXrayService(c *gin.Context) {
 // @Success      200     {object}  entity.Msg
 // @Failure      400     {object}  entity.Msg
 // @Router       /server/logs/{count} [post]
+// @Router       /v2/server/logs/{count} [post]
 func (a *ServerController) getLogs(c *gin.Context) {
 	count := c.Param("count")
 	level := c.PostForm("level")
@@ -272,6 +326,7 @@ func (a *ServerController) getLogs(c *gin.Context) {
 // @Success      200         {object}  entity.Msg
 // @Failure      400         {object}  entity.Msg
 // @Router       /server/xraylogs/{count} [post]
+// @Router       /v2/server/xraylogs/{count} [post]
 func (a *ServerController) getXrayLogs(c *gin.Context) {
 	count := c.Param("count")
 	filter := c.PostForm("filter")
@@ -326,6 +381,7 @@ func (a *ServerController) getXrayLogs(c *gin.Context) {
 // @Success      200  {object}  entity.Msg
 // @Failure      400  {object}  entity.Msg
 // @Router       /server/getConfigJson [get]
+// @Router       /v2/server/getConfigJson [get]
 func (a *ServerController) getConfigJson(c *gin.Context) {
 	configJson, err := a.serverService.GetConfigJson()
 	if err != nil {
@@ -345,6 +401,7 @@ func (a *ServerController) getConfigJson(c *gin.Context) {
 // @Success      200  {file}    file
 // @Failure      400  {object}  entity.Msg
 // @Router       /server/getDb [get]
+// @Router       /v2/server/getDb [get]
 func (a *ServerController) getDb(c *gin.Context) {
 	db, err := a.serverService.GetDb()
 	if err != nil {
@@ -374,15 +431,17 @@ func isValidFilename(filename string) bool {
 
 // importDB imports a database file and restarts the Xray service.
 // @Summary      Import database
-// @Description  Import a database file and restart the Xray service
+// @Description  Import a database file and restart the Xray service. With two-person approval enabled the file is kept and a pending approval request is answered instead.
 // @Tags         server
 // @Accept       multipart/form-data
 // @Produce      json
 // @Security     ApiKeyAuth
-// @Param        db   formData  file  true  "Database file"
-// @Success      200  {object}  entity.Msg
-// @Failure      400  {object}  entity.Msg
+// @Param        db     formData  file  true   "Database file"
+// @Param        async  query     bool  false  "Run as a background job and answer with the job"
+// @Success      200    {object}  entity.Msg
+// @Failure      400    {object}  entity.Msg
 // @Router       /server/importDB [post]
+// @Router       /v2/server/importDB [post]
 func (a *ServerController) importDB(c *gin.Context) {
 	// Get the file from the request body
 	file, _, err := c.Request.FormFile("db")
@@ -391,6 +450,23 @@ func (a *ServerController) importDB(c *gin.Context) {
 		return
 	}
 	defer file.Close()
+	if holdForApproval(c, service.ApprovalImportDB, "", file) {
+		return
+	}
+	if isAsync(c) {
+		// The uploaded file is removed when the request ends, so the job imports a copy
+		data, err := io.ReadAll(file)
+		if err != nil {
+			jsonMsg(c, I18nWeb(c, "pages.index.readDatabaseError"), err)
+			return
+		}
+		job, err := a.jobService.Enqueue("importDB", func(ctx context.Context, report service.JobProgressFunc) (any, error) {
+			defer a.serverService.RestartXrayService()
+			return nil, a.serverService.ImportDB(memoryFile{bytes.NewReader(data)})
+		})
+		jsonJob(c, I18nWeb(c, "pages.index.jobQueued"), job, err)
+		return
+	}
 	// Always restart Xray before return
 	defer a.serverService.RestartXrayService()
 	// lastGetStatusTime removed; no longer needed
@@ -403,6 +479,70 @@ func (a *ServerController) importDB(c *gin.Context) {
 	jsonObj(c, I18nWeb(c, "pages.index.importDatabaseSuccess"), nil)
 }
 
+// vacuumDB compacts the database.
+// @Summary      Compact database
+// @Description  Rebuild the database to return the space of deleted rows to the file system and truncate the WAL file
+// @Tags         server
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        async  query     bool  false  "Run as a background job and answer with the job"
+// @Success      200    {object}  entity.Msg{obj=entity.VacuumResult}
+// @Failure      400    {object}  entity.Msg
+// @Router       /server/vacuumDB [post]
+// @Router       /v2/server/vacuumDB [post]
+func (a *ServerController) vacuumDB(c *gin.Context) {
+	if isAsync(c) {
+		job, err := a.jobService.Enqueue("vacuumDB", func(ctx context.Context, report service.JobProgressFunc) (any, error) {
+			return a.serverService.VacuumDB()
+		})
+		jsonJob(c, I18nWeb(c, "pages.index.jobQueued"), job, err)
+		return
+	}
+	result, err := a.serverService.VacuumDB()
+	jsonMsgObj(c, I18nWeb(c, "pages.index.vacuumDatabaseSuccess"), result, err)
+}
+
+// runMaintenance runs the database maintenance right away.
+// @Summary      Run database maintenance
+// @Description  Remove the traffic and IP log rows of deleted clients, trim finished payments, used deposit tokens and expired announcements older than the retention, then analyze and compact the database
+// @Tags         server
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        async  query     bool  false  "Run as a background job and answer with the job"
+// @Success      200    {object}  entity.Msg{obj=entity.MaintenanceReport}
+// @Failure      400    {object}  entity.Msg
+// @Router       /server/maintenance [post]
+// @Router       /v2/server/maintenance [post]
+func (a *ServerController) runMaintenance(c *gin.Context) {
+	if isAsync(c) {
+		job, err := a.jobService.Enqueue("maintenance", func(ctx context.Context, report service.JobProgressFunc) (any, error) {
+			return a.maintenanceService.RunMaintenance()
+		})
+		jsonJob(c, I18nWeb(c, "pages.index.jobQueued"), job, err)
+		return
+	}
+	report, err := a.maintenanceService.RunMaintenance()
+	jsonMsgObj(c, I18nWeb(c, "pages.index.vacuumDatabaseSuccess"), report, err)
+}
+
+// checkPublicIP checks the public IP address for a change right away.
+// @Summary      Check public IP
+// @Description  Detect the public IPv4 and IPv6 address. On a change since the last check, update the DDNS record, replace the old address in inbound listen addresses, external proxies and subscription settings, call the IP change webhook and notify the Telegram admins.
+// @Tags         server
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=entity.PublicIPCheck}
+// @Failure      400  {object}  entity.Msg
+// @Router       /server/checkPublicIP [post]
+// @Router       /v2/server/checkPublicIP [post]
+func (a *ServerController) checkPublicIP(c *gin.Context) {
+	check, err := a.publicIPService.CheckPublicIP()
+	jsonObj(c, check, err)
+}
+
 // getNewX25519Cert generates a new X25519 certificate.
 // @Summary      Generate X25519 certificate
 // @Description  Generate a new X25519 certificate
@@ -413,6 +553,7 @@ func (a *ServerController) importDB(c *gin.Context) {
 // @Success      200  {object}  entity.Msg
 // @Failure      400  {object}  entity.Msg
 // @Router       /server/getNewX25519Cert [get]
+// @Router       /v2/server/getNewX25519Cert [get]
 func (a *ServerController) getNewX25519Cert(c *gin.Context) {
 	cert, err := a.serverService.GetNewX25519Cert()
 	if err != nil {
@@ -432,6 +573,7 @@ func (a *ServerController) getNewX25519Cert(c *gin.Context) {
 // @Success      200  {object}  entity.Msg
 // @Failure      400  {object}  entity.Msg
 // @Router       /server/getNewmldsa65 [get]
+// @Router       /v2/server/getNewmldsa65 [get]
 func (a *ServerController) getNewmldsa65(c *gin.Context) {
 	cert, err := a.serverService.GetNewmldsa65()
 	if err != nil {
@@ -452,6 +594,7 @@ func (a *ServerController) getNewmldsa65(c *gin.Context) {
 // @Success      200  {object}  entity.Msg
 // @Failure      400  {object}  entity.Msg
 // @Router       /server/getNewEchCert [post]
+// @Router       /v2/server/getNewEchCert [post]
 func (a *ServerController) getNewEchCert(c *gin.Context) {
 	sni := c.PostForm("sni")
 	cert, err := a.serverService.GetNewEchCert(sni)
@@ -472,6 +615,7 @@ func (a *ServerController) getNewEchCert(c *gin.Context) {
 // @Success      200  {object}  entity.Msg
 // @Failure      400  {object}  entity.Msg
 // @Router       /server/getNewVlessEnc [get]
+// @Router       /v2/server/getNewVlessEnc [get]
 func (a *ServerController) getNewVlessEnc(c *gin.Context) {
 	out, err := a.serverService.GetNewVlessEnc()
 	if err != nil {
@@ -491,6 +635,7 @@ func (a *ServerController) getNewVlessEnc(c *gin.Context) {
 // @Success      200  {object}  entity.Msg
 // @Failure      400  {object}  entity.Msg
 // @Router       /server/getNewUUID [get]
+// @Router       /v2/server/getNewUUID [get]
 func (a *ServerController) getNewUUID(c *gin.Context) {
 	uuidResp, err := a.serverService.GetNewUUID()
 	if err != nil {
@@ -511,6 +656,7 @@ func (a *ServerController) getNewUUID(c *gin.Context) {
 // @Success      200  {object}  entity.Msg
 // @Failure      400  {object}  entity.Msg
 // @Router       /server/getNewmlkem768 [get]
+// @Router       /v2/server/getNewmlkem768 [get]
 func (a *ServerController) getNewmlkem768(c *gin.Context) {
 	out, err := a.serverService.GetNewmlkem768()
 	if err != nil {
@@ -519,3 +665,326 @@ func (a *ServerController) getNewmlkem768(c *gin.Context) {
 	}
 	jsonObj(c, out, nil)
 }
+
+// getFirewallState returns the firewall rules managed by the panel.
+// @Summary      Get firewall state
+// @Description  Get the ports the panel opens, the panel port restriction and the rules the firewall backend currently holds
+// @Tags         server
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=entity.FirewallState}
+// @Failure      400  {object}  entity.Msg
+// @Router       /server/firewall [get]
+// @Router       /v2/server/firewall [get]
+func (a *ServerController) getFirewallState(c *gin.Context) {
+	state, err := a.firewallService.GetFirewallState()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonObj(c, state, nil)
+}
+
+// getSshSessions returns the open sessions of the SSH tunnel server.
+// @Summary      List SSH tunnel sessions
+// @Description  List the open sessions of the SSH tunnel server with their user, remote address, forwarded connections and traffic
+// @Tags         server
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=[]sshtunnel.Session}
+// @Router       /server/sshSessions [get]
+// @Router       /v2/server/sshSessions [get]
+func (a *ServerController) getSshSessions(c *gin.Context) {
+	jsonObj(c, a.sshTunnelService.GetSessions(), nil)
+}
+
+// applyFirewall applies the firewall rules right away.
+// @Summary      Apply firewall rules
+// @Description  Apply the firewall rules now instead of waiting for the next periodic run, restoring rules removed by hand
+// @Tags         server
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg
+// @Failure      400  {object}  entity.Msg
+// @Router       /server/firewall/apply [post]
+// @Router       /v2/server/firewall/apply [post]
+func (a *ServerController) applyFirewall(c *gin.Context) {
+	err := a.firewallService.Reapply()
+	jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+}
+
+// TuneRequest defines the request body for network tuning.
+type TuneRequest struct {
+	Preview  bool `json:"preview" form:"preview" example:"true"`    // Only report what would change
+	Rollback bool `json:"rollback" form:"rollback" example:"false"` // Restore the values from before the tuning
+}
+
+// tune applies or rolls back the curated network sysctls.
+// @Summary      Tune network settings
+// @Description  Apply BBR congestion control, higher file descriptor limits and larger TCP buffers, or roll them back. With preview nothing is changed and the response shows what would change.
+// @Tags         server
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        data  body      TuneRequest  false  "Preview and rollback flags"
+// @Success      200   {object}  entity.Msg{obj=[]entity.SysctlChange}
+// @Failure      400   {object}  entity.Msg
+// @Router       /server/tune [post]
+// @Router       /v2/server/tune [post]
+func (a *ServerController) tune(c *gin.Context) {
+	request := &TuneRequest{}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBind(request); err != nil {
+			jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+			return
+		}
+	}
+	var changes []entity.SysctlChange
+	var err error
+	if request.Rollback {
+		changes, err = a.serverService.RollbackSysctls(request.Preview)
+	} else {
+		changes, err = a.serverService.TuneSysctls(request.Preview)
+	}
+	jsonMsgObj(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), changes, err)
+}
+
+// restartPanel restarts the panel process after a delay.
+// @Summary      Restart panel
+// @Description  Restart the panel after a short delay, so the response still reaches the caller
+// @Tags         server
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg
+// @Failure      400  {object}  entity.Msg
+// @Router       /server/restartPanel [post]
+// @Router       /v2/server/restartPanel [post]
+func (a *ServerController) restartPanel(c *gin.Context) {
+	err := a.panelService.RestartPanel(time.Second * 3)
+	jsonMsg(c, I18nWeb(c, "pages.settings.restartPanelSuccess"), err)
+}
+
+// reboot reboots the host after a delay.
+// @Summary      Reboot host
+// @Description  Reboot the machine after a short delay, so the response still reaches the caller. Only supported on Linux.
+// @Tags         server
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg
+// @Failure      400  {object}  entity.Msg
+// @Router       /server/reboot [post]
+// @Router       /v2/server/reboot [post]
+func (a *ServerController) reboot(c *gin.Context) {
+	err := a.serverService.RebootHost(time.Second * 3)
+	jsonMsg(c, I18nWeb(c, "pages.settings.rebootSuccess"), err)
+}
+
+// reloadCert reloads the TLS certificates of the panel and subscription servers.
+// @Summary      Reload TLS certificates
+// @Description  Reload the panel and subscription certificates from disk without restarting, so sessions and connections are kept. Changed certificate files are also picked up automatically.
+// @Tags         server
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg
+// @Failure      400  {object}  entity.Msg
+// @Router       /server/reloadCert [post]
+func (a *ServerController) reloadCert(c *gin.Context) {
+	err := a.panelService.ReloadCerts()
+	jsonMsg(c, I18nWeb(c, "pages.settings.reloadCertSuccess"), err)
+}
+
+// getUnitStatus returns the state of a systemd unit.
+// @Summary      Get service status
+// @Description  Get the systemd state of the x-ui or xray service
+// @Tags         server
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        unit  path      string  true  "Unit name"  Enums(x-ui, xray)
+// @Success      200   {object}  entity.Msg{obj=entity.UnitStatus}
+// @Failure      400   {object}  entity.Msg
+// @Router       /server/service/{unit}/status [get]
+// @Router       /v2/server/service/{unit}/status [get]
+func (a *ServerController) getUnitStatus(c *gin.Context) {
+	status, err := a.serverService.GetUnitStatus(c.Param("unit"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonObj(c, status, nil)
+}
+
+// getUnitJournal returns the journal tail of a systemd unit.
+// @Summary      Get service journal
+// @Description  Get the last lines of the systemd journal of the x-ui or xray service
+// @Tags         server
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        unit   path      string  true   "Unit name"  Enums(x-ui, xray)
+// @Param        lines  query     int     false  "Number of lines, 100 by default"
+// @Success      200    {object}  entity.Msg{obj=[]string}
+// @Failure      400    {object}  entity.Msg
+// @Router       /server/service/{unit}/journal [get]
+// @Router       /v2/server/service/{unit}/journal [get]
+func (a *ServerController) getUnitJournal(c *gin.Context) {
+	lines, err := strconv.Atoi(c.DefaultQuery("lines", "100"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	journal, err := a.serverService.GetUnitJournal(c.Param("unit"), lines)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonObj(c, journal, nil)
+}
+
+// memoryFile serves an uploaded file kept in memory as a multipart.File.
+type memoryFile struct {
+	*bytes.Reader
+}
+
+// Close does nothing, the data is released with the reader.
+func (memoryFile) Close() error {
+	return nil
+}
+
+// getEndpointStats reports the requests and bytes served per endpoint.
+// @Summary      Get endpoint traffic
+// @Description  Get the number of requests, failed requests and response bytes the panel (web) and subscription (sub) servers served per route since the panel started or the counters were reset
+// @Tags         server
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=entity.EndpointStatsReport}
+// @Failure      401  {object}  entity.Msg
+// @Router       /server/endpointStats [get]
+// @Router       /v2/server/endpointStats [get]
+func (a *ServerController) getEndpointStats(c *gin.Context) {
+	jsonObj(c, a.endpointStats.GetEndpointStats(), nil)
+}
+
+// getSubRequestStats reports the most requested subscriptions.
+// @Summary      Get subscription request traffic
+// @Description  Get the successful requests, response bytes and distinct client addresses per subscription ID on the subscription server, most requested first, to spot subscription URLs that are hammered or scraped
+// @Tags         server
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        limit  query     int  false  "Maximum number of subscriptions, 100 by default and all with 0"
+// @Success      200    {object}  entity.Msg{obj=[]entity.SubRequestStats}
+// @Failure      401    {object}  entity.Msg
+// @Router       /server/subRequestStats [get]
+// @Router       /v2/server/subRequestStats [get]
+func (a *ServerController) getSubRequestStats(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "get"), err)
+		return
+	}
+	jsonObj(c, a.endpointStats.GetSubRequestStats(limit), nil)
+}
+
+// resetEndpointStats clears the endpoint and subscription request counters.
+// @Summary      Reset endpoint traffic
+// @Description  Clear the endpoint and subscription request counters
+// @Tags         server
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg
+// @Failure      401  {object}  entity.Msg
+// @Router       /server/endpointStats/reset [post]
+// @Router       /v2/server/endpointStats/reset [post]
+func (a *ServerController) resetEndpointStats(c *gin.Context) {
+	a.endpointStats.Reset()
+	jsonMsg(c, I18nWeb(c, "reset"), nil)
+}
+
+// getDecoyProbes lists the recent requests answered with the decoy.
+// @Summary      Get panel probes
+// @Description  Get the most recent requests outside the web base path that were answered with the decoy, newest first, with the AbuseIPDB score of their address when it was looked up
+// @Tags         server
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=[]entity.DecoyProbe}
+// @Failure      401  {object}  entity.Msg
+// @Router       /server/decoy/probes [get]
+// @Router       /v2/server/decoy/probes [get]
+func (a *ServerController) getDecoyProbes(c *gin.Context) {
+	jsonObj(c, a.decoyService.GetProbes(), nil)
+}
+
+// getDecoyBans lists the addresses banned for probing the panel.
+// @Summary      Get banned addresses
+// @Description  Get the addresses whose connections are dropped for probing the panel, with the end and reason of their ban
+// @Tags         server
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=[]entity.DecoyBan}
+// @Failure      401  {object}  entity.Msg
+// @Router       /server/decoy/bans [get]
+// @Router       /v2/server/decoy/bans [get]
+func (a *ServerController) getDecoyBans(c *gin.Context) {
+	jsonObj(c, a.decoyService.GetBans(), nil)
+}
+
+// unbanDecoy lifts the ban of an address.
+// @Summary      Unban address
+// @Description  Lift the ban of an address banned for probing the panel and forget its probes
+// @Tags         server
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        ip   path      string  true  "Banned address"
+// @Success      200  {object}  entity.Msg
+// @Failure      401  {object}  entity.Msg
+// @Router       /server/decoy/unban/{ip} [post]
+// @Router       /v2/server/decoy/unban/{ip} [post]
+func (a *ServerController) unbanDecoy(c *gin.Context) {
+	a.decoyService.Unban(c.Param("ip"))
+	jsonMsg(c, I18nWeb(c, "delete"), nil)
+}
+
+// getTunnel reports the tunnel the panel is published through.
+// @Summary      Get panel tunnel
+// @Description  Get the state of the Cloudflare tunnel or Tor onion service the panel is published through, with its public hostname and the URL of the panel
+// @Tags         server
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=entity.TunnelStatus}
+// @Failure      401  {object}  entity.Msg
+// @Router       /server/tunnel [get]
+// @Router       /v2/server/tunnel [get]
+func (a *ServerController) getTunnel(c *gin.Context) {
+	status, err := a.tunnelService.GetStatus()
+	jsonObj(c, status, err)
+}
+
+// getUpdates lists the panel and Xray releases newer than the installed versions.
+// @Summary      Get available updates
+// @Description  List the panel and Xray releases newer than the installed versions with their changelogs, newest first, and whether one of them mentions a security fix. The result of the last check is served for up to an hour unless refresh is set.
+// @Tags         server
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        refresh  query     bool  false  "Fetch the releases again"
+// @Success      200      {object}  entity.Msg{obj=entity.UpdateInfo}
+// @Failure      400      {object}  entity.Msg
+// @Router       /server/updates [get]
+// @Router       /v2/server/updates [get]
+func (a *ServerController) getUpdates(c *gin.Context) {
+	info, err := a.updateCheckService.GetUpdates(c.Query("refresh") == "true")
+	jsonObj(c, info, err)
+}
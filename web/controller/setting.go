@@ -1,11 +1,18 @@
 package controller
 
 import (
+	"encoding/json"
 	"errors"
+	"io"
+	"strconv"
 	"time"
 
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
 	"github.com/mhsanaei/3x-ui/v2/util/crypto"
 	"github.com/mhsanaei/3x-ui/v2/web/entity"
+	"github.com/mhsanaei/3x-ui/v2/web/locale"
+	"github.com/mhsanaei/3x-ui/v2/web/middleware"
 	"github.com/mhsanaei/3x-ui/v2/web/service"
 	"github.com/mhsanaei/3x-ui/v2/web/session"
 
@@ -25,6 +32,8 @@ type SettingController struct {
 	settingService service.SettingService
 	userService    service.UserService
 	panelService   service.PanelService
+	xrayService    service.XrayService
+	subSignService service.SubSignService
 }
 
 // NewSettingController creates a new SettingController and initializes its routes.
@@ -38,14 +47,27 @@ func NewSettingController(g *gin.RouterGroup) *SettingController {
 func (a *SettingController) initRouter(g *gin.RouterGroup) {
 	g = g.Group("/setting")
 
-	g.POST("/all", a.getAllSetting)
-	g.POST("/defaultSettings", a.getDefaultSettings)
+	g.POST("/all", middleware.ReadOnlyAllowed, a.getAllSetting)
+	g.POST("/defaultSettings", middleware.ReadOnlyAllowed, a.getDefaultSettings)
 	g.POST("/update", a.updateSetting)
 	g.POST("/updateUser", a.updateUser)
 	g.POST("/restartPanel", a.restartPanel)
 	g.GET("/getDefaultJsonConfig", a.getDefaultXrayConfig)
 	g.GET("/getApiKey", a.getApiKey)
 	g.POST("/generateApiKey", a.generateApiKey)
+	g.POST("/export", middleware.ReadOnlyAllowed, a.exportSettings)
+	g.POST("/import", a.importSettings)
+	g.POST("/effective", middleware.ReadOnlyAllowed, a.getEffectiveSettings)
+	g.GET("/readOnly", a.getReadOnly)
+	g.POST("/readOnly", middleware.ReadOnlyAllowed, a.setReadOnly)
+	g.GET("/adBlock", a.getAdBlock)
+	g.POST("/adBlock", a.setAdBlock)
+	g.GET("/subSignKey", a.getSubSignKey)
+	g.POST("/subSignKey/rotate", a.rotateSubSignKey)
+	g.GET("/translations", a.getTranslations)
+	g.GET("/translations/:lang", a.getTranslationMessages)
+	g.POST("/translations/:lang", a.uploadTranslation)
+	g.POST("/translations/:lang/delete", a.deleteTranslation)
 }
 
 // getAllSetting retrieves all current settings.
@@ -67,6 +89,25 @@ func (a *SettingController) getAllSetting(c *gin.Context) {
 	jsonObj(c, allSetting, nil)
 }
 
+// getEffectiveSettings retrieves every setting with the value in effect and its source.
+// @Summary      Get effective settings
+// @Description  Retrieve the value in effect for every setting and whether it comes from an environment variable, the settings file, the database or the default
+// @Tags         settings
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=[]entity.EffectiveSetting}
+// @Failure      400  {object}  entity.Msg
+// @Router       /setting/effective [post]
+func (a *SettingController) getEffectiveSettings(c *gin.Context) {
+	settings, err := a.settingService.GetEffectiveSettings()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.getSettings"), err)
+		return
+	}
+	jsonObj(c, settings, nil)
+}
+
 // getDefaultSettings retrieves the default settings based on the host.
 // @Summary      Get default settings
 // @Description  Retrieve the default settings based on the host
@@ -178,14 +219,14 @@ func (a *SettingController) getDefaultXrayConfig(c *gin.Context) {
 	jsonObj(c, defaultJsonConfig, nil)
 }
 
-// getApiKey retrieves the current user's API key
-// @Summary      Get API key
-// @Description  Retrieve the current user's API key
+// getApiKey reports whether the current user has an API key
+// @Summary      Get API key status
+// @Description  Report whether the current user has an API key. Keys are stored hashed and only returned when generated.
 // @Tags         settings
 // @Accept       json
 // @Produce      json
 // @Security     ApiKeyAuth
-// @Success      200  {object}  entity.Msg{obj=string}
+// @Success      200  {object}  entity.Msg{obj=bool}
 // @Failure      401  {object}  entity.Msg
 // @Router       /setting/getApiKey [get]
 func (a *SettingController) getApiKey(c *gin.Context) {
@@ -195,17 +236,17 @@ func (a *SettingController) getApiKey(c *gin.Context) {
 		return
 	}
 	
-	apiKey, err := a.userService.GetApiKey(user.Id)
+	hasApiKey, err := a.userService.HasApiKey(user.Id)
 	if err != nil {
 		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.getApiKey"), err)
 		return
 	}
-	jsonObj(c, apiKey, nil)
+	jsonObj(c, hasApiKey, nil)
 }
 
 // generateApiKey generates a new API key for the current user
 // @Summary      Generate API key
-// @Description  Generate a new API key for the current user
+// @Description  Generate a new API key for the current user, replacing the old one. The key is only returned here, since it is stored hashed.
 // @Tags         settings
 // @Accept       json
 // @Produce      json
@@ -227,3 +268,274 @@ func (a *SettingController) generateApiKey(c *gin.Context) {
 	}
 	jsonObj(c, apiKey, nil)
 }
+
+// exportSettings exports the selected settings sections as a portable JSON bundle.
+// @Summary      Export settings
+// @Description  Export panel settings grouped by section (panel, security, telegram, subscription, ldap), optionally with the Xray template
+// @Tags         settings
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        sections     formData  string  false  "Comma separated sections, all when empty"
+// @Param        includeXray  formData  bool    false  "Include the Xray template config"
+// @Success      200          {object}  entity.Msg{obj=entity.SettingsBundle}
+// @Failure      400          {object}  entity.Msg
+// @Router       /setting/export [post]
+func (a *SettingController) exportSettings(c *gin.Context) {
+	sections, err := service.ParseSettingSections(c.PostForm("sections"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.getSettings"), err)
+		return
+	}
+	includeXray, _ := strconv.ParseBool(c.PostForm("includeXray"))
+	bundle, err := a.settingService.ExportSettings(sections, includeXray)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.getSettings"), err)
+		return
+	}
+	jsonObj(c, bundle, nil)
+}
+
+// importSettings imports the selected sections of a settings bundle produced by exportSettings.
+// @Summary      Import settings
+// @Description  Validate and apply the selected sections of a settings bundle. A panel restart is required to apply them.
+// @Tags         settings
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        data         formData  string  true   "Settings bundle JSON"
+// @Param        sections     formData  string  false  "Comma separated sections, all when empty"
+// @Param        includeXray  formData  bool    false  "Also import the Xray template config"
+// @Success      200          {object}  entity.Msg
+// @Failure      400          {object}  entity.Msg
+// @Router       /setting/import [post]
+func (a *SettingController) importSettings(c *gin.Context) {
+	bundle := &entity.SettingsBundle{}
+	err := json.Unmarshal([]byte(c.PostForm("data")), bundle)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+		return
+	}
+	sections, err := service.ParseSettingSections(c.PostForm("sections"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+		return
+	}
+	includeXray, _ := strconv.ParseBool(c.PostForm("includeXray"))
+	xrayChanged, err := a.settingService.ImportSettings(bundle, sections, includeXray)
+	if err == nil && xrayChanged {
+		a.xrayService.SetToNeedRestart()
+	}
+	jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+}
+
+// AdBlockForm defines the request body for switching ad blocking.
+type AdBlockForm struct {
+	Enable bool `json:"enable" form:"enable" example:"true"` // Whether ad, malware and phishing domains are blocked
+}
+
+// ReadOnlyForm defines the request body for switching read-only mode.
+type ReadOnlyForm struct {
+	Enable        bool   `json:"enable" form:"enable" example:"true"`                 // Whether the panel should be read-only
+	TwoFactorCode string `json:"twoFactorCode" form:"twoFactorCode" example:"123456"` // Current two-factor authentication code
+}
+
+// getReadOnly reports whether the panel is in read-only mode.
+// @Summary      Get read-only mode
+// @Description  Report whether the panel is in read-only mode
+// @Tags         settings
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=bool}
+// @Failure      400  {object}  entity.Msg
+// @Router       /setting/readOnly [get]
+func (a *SettingController) getReadOnly(c *gin.Context) {
+	readOnly, err := a.settingService.GetReadOnlyMode()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.getSettings"), err)
+		return
+	}
+	jsonObj(c, readOnly, nil)
+}
+
+// setReadOnly switches read-only mode on or off.
+// @Summary      Set read-only mode
+// @Description  Switch read-only mode on or off. While it is on, every request that could change anything is rejected with 423 Locked, while traffic statistics keep being collected. Requires an interactive login with two-factor authentication enabled and a current code, API keys are refused.
+// @Tags         settings
+// @Accept       json
+// @Produce      json
+// @Param        data  body      ReadOnlyForm  true  "Read-only mode and two-factor code"
+// @Success      200   {object}  entity.Msg
+// @Failure      400   {object}  entity.Msg
+// @Router       /setting/readOnly [post]
+func (a *SettingController) setReadOnly(c *gin.Context) {
+	form := &ReadOnlyForm{}
+	if err := c.ShouldBind(form); err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+		return
+	}
+	if c.GetBool("api_key_auth") {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), common.NewCodeError(common.ErrCodeUnauthorized, nil, I18nWeb(c, "pages.settings.readOnlyNoApiKey")))
+		return
+	}
+	if !a.userService.CheckTwoFactorCode(form.TwoFactorCode) {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), common.NewCodeError(common.ErrCodeInvalidCredentials, nil, I18nWeb(c, "pages.settings.readOnlyTwoFactor")))
+		return
+	}
+	err := a.settingService.SetReadOnlyMode(form.Enable)
+	if err == nil {
+		logger.Warningf("Read-only mode set to %v by %s from %s", form.Enable, session.GetLoginUser(c).Username, getRemoteIp(c))
+	}
+	jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+}
+
+// getSubSignKey returns the public key subscriptions are signed with.
+// @Summary      Get subscription signing key
+// @Description  Get the Ed25519 public key subscription payloads are signed with and its key ID, generating the key on first use
+// @Tags         settings
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=entity.SubSignKey}
+// @Failure      400  {object}  entity.Msg
+// @Router       /setting/subSignKey [get]
+func (a *SettingController) getSubSignKey(c *gin.Context) {
+	key, err := a.subSignService.GetPublicKey()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.getSettings"), err)
+		return
+	}
+	jsonObj(c, key, nil)
+}
+
+// rotateSubSignKey replaces the key subscriptions are signed with.
+// @Summary      Rotate subscription signing key
+// @Description  Replace the Ed25519 key subscription payloads are signed with. Clients pinning the old public key have to fetch the new one.
+// @Tags         settings
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=entity.SubSignKey}
+// @Failure      400  {object}  entity.Msg
+// @Router       /setting/subSignKey/rotate [post]
+func (a *SettingController) rotateSubSignKey(c *gin.Context) {
+	key, err := a.subSignService.RotateKey()
+	jsonMsgObj(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), key, err)
+}
+
+// getTranslations lists the languages the panel can be shown in.
+// @Summary      List translations
+// @Description  List the built-in languages and the ones registered by uploaded translation bundles
+// @Tags         settings
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=[]locale.LanguageInfo}
+// @Router       /setting/translations [get]
+func (a *SettingController) getTranslations(c *gin.Context) {
+	jsonObj(c, locale.GetLanguages(), nil)
+}
+
+// getTranslationMessages returns the messages in effect for a language.
+// @Summary      Get translation messages
+// @Description  Return the messages in effect for a language as flat dotted IDs, English messages filling the gaps. Use prefix to select a group, e.g. pages.inbounds.toasts for the messages returned by the inbound API.
+// @Tags         settings
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        lang    path      string  true   "Language tag, e.g. en-US"
+// @Param        prefix  query     string  false  "Only return message IDs starting with this prefix"
+// @Success      200     {object}  entity.Msg{obj=map[string]string}
+// @Failure      400     {object}  entity.Msg
+// @Router       /setting/translations/{lang} [get]
+func (a *SettingController) getTranslationMessages(c *gin.Context) {
+	messages, err := locale.GetMessages(c.Param("lang"), c.Query("prefix"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.getSettings"), err)
+		return
+	}
+	jsonObj(c, messages, nil)
+}
+
+// uploadTranslation stores a custom translation bundle for a language.
+// @Summary      Upload translation
+// @Description  Upload a JSON translation bundle for a language. It overrides the built-in messages it contains, or registers a new language when the panel does not ship one. Messages may be nested objects or dotted IDs, e.g. {"pages":{"login":{"hello":"Hallo"}}}. Uploading again replaces the previous bundle.
+// @Tags         settings
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        lang  path      string  true  "Language tag, e.g. de-DE"
+// @Param        data  body      object  true  "Translation messages"
+// @Success      200   {object}  entity.Msg
+// @Failure      400   {object}  entity.Msg
+// @Router       /setting/translations/{lang} [post]
+func (a *SettingController) uploadTranslation(c *gin.Context) {
+	data, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20+1))
+	if err == nil {
+		err = locale.SaveCustomTranslation(c.Param("lang"), data)
+	}
+	if err == nil {
+		logger.Infof("Custom translation for %s uploaded from %s", c.Param("lang"), getRemoteIp(c))
+	}
+	jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+}
+
+// deleteTranslation removes the custom translation bundle of a language.
+// @Summary      Delete translation
+// @Description  Remove the uploaded translation bundle of a language, restoring the built-in messages
+// @Tags         settings
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        lang  path      string  true  "Language tag"
+// @Success      200   {object}  entity.Msg
+// @Failure      400   {object}  entity.Msg
+// @Router       /setting/translations/{lang}/delete [post]
+func (a *SettingController) deleteTranslation(c *gin.Context) {
+	err := locale.DeleteCustomTranslation(c.Param("lang"))
+	jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+}
+
+// getAdBlock reports whether ad blocking is on.
+// @Summary      Get ad blocking
+// @Description  Report whether the domains of the ad, malware and phishing lists are blocked
+// @Tags         settings
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=bool}
+// @Failure      400  {object}  entity.Msg
+// @Router       /setting/adBlock [get]
+func (a *SettingController) getAdBlock(c *gin.Context) {
+	enable, err := a.settingService.GetAdBlockEnable()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.getSettings"), err)
+		return
+	}
+	jsonObj(c, enable, nil)
+}
+
+// setAdBlock switches ad blocking on or off.
+// @Summary      Set ad blocking
+// @Description  Switch the blocking of the ad, malware and phishing lists on or off and restart Xray to apply it. The lists and the inbounds left unfiltered are set in the settings; the geofiles holding the lists are updated daily unless another geofile update interval is set, starting with the next panel restart.
+// @Tags         settings
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        data  body      AdBlockForm  true  "Ad blocking"
+// @Success      200   {object}  entity.Msg
+// @Failure      400   {object}  entity.Msg
+// @Router       /setting/adBlock [post]
+func (a *SettingController) setAdBlock(c *gin.Context) {
+	form := &AdBlockForm{}
+	if err := c.ShouldBind(form); err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+		return
+	}
+	err := a.settingService.SetAdBlockEnable(form.Enable)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+	jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+}
@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SubProfileController handles named subscription profiles.
+type SubProfileController struct {
+	subProfileService service.SubProfileService
+}
+
+// NewSubProfileController creates a new SubProfileController and sets up its routes.
+func NewSubProfileController(g *gin.RouterGroup) *SubProfileController {
+	a := &SubProfileController{}
+	a.initRouter(g)
+	return a
+}
+
+// initRouter initializes the routes for managing subscription profiles.
+func (a *SubProfileController) initRouter(g *gin.RouterGroup) {
+	g.GET("/list", a.getProfiles)
+	g.POST("/add", a.addProfile)
+	g.POST("/update/:id", a.updateProfile)
+	g.POST("/del/:id", a.delProfile)
+}
+
+// initRouterV2 sets up the subscription profile routes of the REST API.
+func (a *SubProfileController) initRouterV2(g *gin.RouterGroup) {
+	g.GET("", a.getProfiles)
+	g.POST("", createdStatus, a.addProfile)
+	g.PUT("/:id", a.updateProfile)
+	g.DELETE("/:id", a.delProfile)
+}
+
+// getProfiles lists subscription profiles.
+// @Summary      List subscription profiles
+// @Description  Get the subscription profiles, or only those a subscription can use: its own and the shared ones
+// @Tags         subProfiles
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        subId  query     string  false  "Subscription ID"
+// @Success      200    {object}  entity.Msg{obj=[]model.SubProfile}
+// @Failure      401    {object}  entity.Msg
+// @Router       /subProfiles/list [get]
+// @Router       /v2/subProfiles [get]
+func (a *SubProfileController) getProfiles(c *gin.Context) {
+	profiles, err := a.subProfileService.GetProfiles(c.Query("subId"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonObj(c, profiles, nil)
+}
+
+// addProfile creates a subscription profile.
+// @Summary      Create subscription profile
+// @Description  Create a named view of a subscription served at /sub/{subId}/{name}, with the inbounds it includes, the output format (base64, plain or json) and link options as query parameters. A profile without a subscription ID is available to every subscription, one with an ID takes precedence for that subscription.
+// @Tags         subProfiles
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        data  body      model.SubProfile  true  "Subscription profile"
+// @Success      200   {object}  entity.Msg{obj=model.SubProfile}
+// @Failure      400   {object}  entity.Msg
+// @Router       /subProfiles/add [post]
+// @Router       /v2/subProfiles [post]
+func (a *SubProfileController) addProfile(c *gin.Context) {
+	profile := &model.SubProfile{}
+	if err := c.ShouldBind(profile); err != nil {
+		jsonMsg(c, I18nWeb(c, "create"), err)
+		return
+	}
+	err := a.subProfileService.AddProfile(profile)
+	jsonMsgObj(c, I18nWeb(c, "create"), profile, err)
+}
+
+// updateProfile updates a subscription profile.
+// @Summary      Update subscription profile
+// @Description  Update the subscription, name, inbounds, format and link options of a subscription profile
+// @Tags         subProfiles
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id    path      int               true  "Subscription profile ID"
+// @Param        data  body      model.SubProfile  true  "Subscription profile"
+// @Success      200   {object}  entity.Msg{obj=model.SubProfile}
+// @Failure      400   {object}  entity.Msg
+// @Router       /subProfiles/update/{id} [post]
+// @Router       /v2/subProfiles/{id} [put]
+func (a *SubProfileController) updateProfile(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "update"), err)
+		return
+	}
+	profile := &model.SubProfile{}
+	if err := c.ShouldBind(profile); err != nil {
+		jsonMsg(c, I18nWeb(c, "update"), err)
+		return
+	}
+	profile.Id = id
+	err = a.subProfileService.UpdateProfile(profile)
+	jsonMsgObj(c, I18nWeb(c, "update"), profile, err)
+}
+
+// delProfile deletes a subscription profile.
+// @Summary      Delete subscription profile
+// @Description  Delete a subscription profile, its URL stops working
+// @Tags         subProfiles
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Subscription profile ID"
+// @Success      200  {object}  entity.Msg
+// @Failure      400  {object}  entity.Msg
+// @Router       /subProfiles/del/{id} [post]
+// @Router       /v2/subProfiles/{id} [delete]
+func (a *SubProfileController) delProfile(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "delete"), err)
+		return
+	}
+	err = a.subProfileService.DelProfile(id)
+	jsonMsg(c, I18nWeb(c, "delete"), err)
+}
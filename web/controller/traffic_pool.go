@@ -0,0 +1,207 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TrafficPoolController handles traffic budgets shared by clients.
+type TrafficPoolController struct {
+	trafficPoolService service.TrafficPoolService
+	xrayService        service.XrayService
+}
+
+// NewTrafficPoolController creates a new TrafficPoolController and sets up its routes.
+func NewTrafficPoolController(g *gin.RouterGroup) *TrafficPoolController {
+	a := &TrafficPoolController{}
+	a.initRouter(g)
+	return a
+}
+
+// initRouter initializes the routes for managing traffic pools.
+func (a *TrafficPoolController) initRouter(g *gin.RouterGroup) {
+	g.GET("/list", a.getPools)
+	g.POST("/add", a.addPool)
+	g.POST("/update/:id", a.updatePool)
+	g.POST("/del/:id", a.delPool)
+	g.POST("/setClients/:id", a.setPoolClients)
+	g.POST("/reset/:id", a.resetPool)
+}
+
+// initRouterV2 sets up the traffic pool routes of the REST API.
+func (a *TrafficPoolController) initRouterV2(g *gin.RouterGroup) {
+	g.GET("", a.getPools)
+	g.POST("", createdStatus, a.addPool)
+	g.PUT("/:id", a.updatePool)
+	g.DELETE("/:id", a.delPool)
+	g.PUT("/:id/clients", a.setPoolClients)
+	g.POST("/:id/reset", a.resetPool)
+}
+
+// TrafficPoolClientsRequest defines the clients of a traffic pool.
+type TrafficPoolClientsRequest struct {
+	Emails []string `json:"emails" form:"emails" example:"alice,bob"` // Emails of the clients drawing from the pool
+}
+
+// getPools lists all traffic pools.
+// @Summary      List traffic pools
+// @Description  Get all traffic pools with their usage, remaining budget and clients
+// @Tags         trafficPools
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=[]entity.TrafficPoolStats}
+// @Failure      401  {object}  entity.Msg
+// @Router       /trafficPools/list [get]
+// @Router       /v2/trafficPools [get]
+func (a *TrafficPoolController) getPools(c *gin.Context) {
+	pools, err := a.trafficPoolService.GetPools()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonObj(c, pools, nil)
+}
+
+// addPool creates a traffic pool.
+// @Summary      Create traffic pool
+// @Description  Create a traffic budget shared by clients on any inbounds, like a family or team plan. The traffic of its clients is counted against it from the moment they join, and all of them are disabled once it is used up.
+// @Tags         trafficPools
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        data  body      model.TrafficPool  true  "Traffic pool"
+// @Success      200   {object}  entity.Msg{obj=model.TrafficPool}
+// @Failure      400   {object}  entity.Msg
+// @Router       /trafficPools/add [post]
+// @Router       /v2/trafficPools [post]
+func (a *TrafficPoolController) addPool(c *gin.Context) {
+	pool := &model.TrafficPool{}
+	if err := c.ShouldBind(pool); err != nil {
+		jsonMsg(c, I18nWeb(c, "create"), err)
+		return
+	}
+	err := a.trafficPoolService.AddPool(pool)
+	jsonMsgObj(c, I18nWeb(c, "create"), pool, err)
+}
+
+// updatePool updates a traffic pool.
+// @Summary      Update traffic pool
+// @Description  Update the name, budget and comment of a traffic pool. Clients disabled because the pool was used up are enabled again when the new budget allows it.
+// @Tags         trafficPools
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id    path      int                true  "Traffic pool ID"
+// @Param        data  body      model.TrafficPool  true  "Traffic pool"
+// @Success      200   {object}  entity.Msg{obj=model.TrafficPool}
+// @Failure      400   {object}  entity.Msg
+// @Router       /trafficPools/update/{id} [post]
+// @Router       /v2/trafficPools/{id} [put]
+func (a *TrafficPoolController) updatePool(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "update"), err)
+		return
+	}
+	pool := &model.TrafficPool{}
+	if err := c.ShouldBind(pool); err != nil {
+		jsonMsg(c, I18nWeb(c, "update"), err)
+		return
+	}
+	pool.Id = id
+	needRestart, err := a.trafficPoolService.UpdatePool(pool)
+	jsonMsgObj(c, I18nWeb(c, "update"), pool, err)
+	if err == nil && needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+// delPool deletes a traffic pool.
+// @Summary      Delete traffic pool
+// @Description  Delete a traffic pool. Its clients keep their own quota and expiry and are enabled again when they are within them.
+// @Tags         trafficPools
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Traffic pool ID"
+// @Success      200  {object}  entity.Msg
+// @Failure      400  {object}  entity.Msg
+// @Router       /trafficPools/del/{id} [post]
+// @Router       /v2/trafficPools/{id} [delete]
+func (a *TrafficPoolController) delPool(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "delete"), err)
+		return
+	}
+	needRestart, err := a.trafficPoolService.DelPool(id)
+	jsonMsg(c, I18nWeb(c, "delete"), err)
+	if err == nil && needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+// setPoolClients replaces the clients of a traffic pool.
+// @Summary      Set traffic pool clients
+// @Description  Replace the clients drawing from a traffic pool. A client belongs to one pool at most, so clients of other pools move over. Clients leaving the pool are enabled again when they are within their own limits.
+// @Tags         trafficPools
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id    path      int                        true  "Traffic pool ID"
+// @Param        data  body      TrafficPoolClientsRequest  true  "Clients"
+// @Success      200   {object}  entity.Msg
+// @Failure      400   {object}  entity.Msg
+// @Router       /trafficPools/setClients/{id} [post]
+// @Router       /v2/trafficPools/{id}/clients [put]
+func (a *TrafficPoolController) setPoolClients(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "update"), err)
+		return
+	}
+	req := &TrafficPoolClientsRequest{}
+	if err := c.ShouldBind(req); err != nil {
+		jsonMsg(c, I18nWeb(c, "update"), err)
+		return
+	}
+	needRestart, err := a.trafficPoolService.SetPoolClients(id, req.Emails)
+	jsonMsg(c, I18nWeb(c, "update"), err)
+	if err == nil && needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+// resetPool resets the usage of a traffic pool.
+// @Summary      Reset traffic pool
+// @Description  Reset the usage of a traffic pool, for example at the start of a billing period, and enable its clients again when they are within their own limits
+// @Tags         trafficPools
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Traffic pool ID"
+// @Success      200  {object}  entity.Msg
+// @Failure      400  {object}  entity.Msg
+// @Router       /trafficPools/reset/{id} [post]
+// @Router       /v2/trafficPools/{id}/reset [post]
+func (a *TrafficPoolController) resetPool(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	needRestart, err := a.trafficPoolService.ResetPool(id)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.resetInboundClientTrafficSuccess"), nil)
+	if needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+}
@@ -0,0 +1,208 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// VoucherController handles vouchers, single-use codes that extend a client or create a new one.
+type VoucherController struct {
+	voucherService service.VoucherService
+	xrayService    service.XrayService
+}
+
+// NewVoucherController creates a new VoucherController and sets up its routes.
+func NewVoucherController(g *gin.RouterGroup) *VoucherController {
+	a := &VoucherController{}
+	a.initRouter(g)
+	return a
+}
+
+// initRouter initializes the routes for managing vouchers.
+func (a *VoucherController) initRouter(g *gin.RouterGroup) {
+	g.GET("/list", a.getVouchers)
+	g.GET("/report", a.getVoucherReport)
+	g.POST("/generate", a.generateVouchers)
+	g.POST("/redeem", a.redeemVoucher)
+	g.POST("/del/:id", a.delVoucher)
+	g.POST("/delBatch/:batch", a.delVoucherBatch)
+}
+
+// initRouterV2 sets up the voucher routes of the REST API.
+func (a *VoucherController) initRouterV2(g *gin.RouterGroup) {
+	g.GET("", a.getVouchers)
+	g.GET("/report", a.getVoucherReport)
+	g.POST("", createdStatus, a.generateVouchers)
+	g.POST("/redemptions", a.redeemVoucher)
+	g.DELETE("/:id", a.delVoucher)
+	g.DELETE("/batches/:batch", a.delVoucherBatch)
+}
+
+// VoucherGenerateRequest defines a batch of vouchers to generate.
+type VoucherGenerateRequest struct {
+	Count      int    `json:"count" form:"count" example:"50"`                    // Number of vouchers, up to 1000
+	Prefix     string `json:"prefix" form:"prefix" example:"SUMMER"`              // Letters and digits put before every code
+	Batch      string `json:"batch" form:"batch" example:"summer-sale"`           // Batch name, the current time when empty
+	Type       string `json:"type" form:"type" example:"days"`                    // Unit of the value, days or gb
+	Value      int    `json:"value" form:"value" example:"30"`                    // Days or GB each voucher adds
+	InboundId  int    `json:"inboundId" form:"inboundId" example:"1"`             // Inbound new clients are created on, 0 to only extend clients
+	TotalGB    int64  `json:"totalGB" form:"totalGB" example:"0"`                 // Traffic quota of a created client in bytes, before a GB value is added
+	ExpiryDays int    `json:"expiryDays" form:"expiryDays" example:"0"`           // Validity of a created client in days, before a days value is added
+	LimitIP    int    `json:"limitIp" form:"limitIp" example:"0"`                 // IP limit of a created client
+	ExpiresAt  int64  `json:"expiresAt" form:"expiresAt" example:"1767225600000"` // Voucher expiration timestamp in milliseconds, 0 for never
+}
+
+// VoucherRedeemRequest defines the voucher to redeem and the client it is applied to.
+type VoucherRedeemRequest struct {
+	Code  string `json:"code" form:"code" example:"SUMMER-7KQ2-MX9P-4TRD"` // Voucher code
+	Email string `json:"email" form:"email" example:"user@example.com"`    // Client to extend, a new client is created when empty
+}
+
+// getVouchers lists the vouchers.
+// @Summary      List vouchers
+// @Description  Get the vouchers, newest first, optionally of one batch and with one redemption status
+// @Tags         vouchers
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        batch   query     string  false  "Batch name"
+// @Param        status  query     string  false  "available, redeemed or expired"
+// @Success      200     {object}  entity.Msg{obj=[]model.Voucher}
+// @Failure      400     {object}  entity.Msg
+// @Router       /vouchers/list [get]
+// @Router       /v2/vouchers [get]
+func (a *VoucherController) getVouchers(c *gin.Context) {
+	vouchers, err := a.voucherService.GetVouchers(c.Query("batch"), c.Query("status"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonObj(c, vouchers, nil)
+}
+
+// getVoucherReport reports the redemption status of every batch.
+// @Summary      Voucher report
+// @Description  Get the number of generated, redeemed, expired and available vouchers of every batch and how many redemptions created a client
+// @Tags         vouchers
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=[]entity.VoucherBatchReport}
+// @Failure      400  {object}  entity.Msg
+// @Router       /vouchers/report [get]
+// @Router       /v2/vouchers/report [get]
+func (a *VoucherController) getVoucherReport(c *gin.Context) {
+	report, err := a.voucherService.GetVoucherReport()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonObj(c, report, nil)
+}
+
+// generateVouchers creates a batch of vouchers.
+// @Summary      Generate vouchers
+// @Description  Generate a batch of single-use vouchers adding days or GB. Redeemed with a client email they extend that client, otherwise they create a new client on the inbound with the template quota plus the voucher value.
+// @Tags         vouchers
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        data  body      VoucherGenerateRequest  true  "Batch, value and client template"
+// @Success      200   {object}  entity.Msg{obj=[]model.Voucher}
+// @Failure      400   {object}  entity.Msg
+// @Router       /vouchers/generate [post]
+// @Router       /v2/vouchers [post]
+func (a *VoucherController) generateVouchers(c *gin.Context) {
+	request := &VoucherGenerateRequest{}
+	if err := c.ShouldBind(request); err != nil {
+		jsonMsg(c, I18nWeb(c, "create"), err)
+		return
+	}
+	vouchers, err := a.voucherService.GenerateVouchers(&model.Voucher{
+		Batch:      request.Batch,
+		Type:       request.Type,
+		Value:      request.Value,
+		InboundId:  request.InboundId,
+		TotalGB:    request.TotalGB,
+		ExpiryDays: request.ExpiryDays,
+		LimitIP:    request.LimitIP,
+		ExpiresAt:  request.ExpiresAt,
+	}, request.Count, request.Prefix)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "create"), err)
+		return
+	}
+	jsonMsgObj(c, I18nWeb(c, "create"), vouchers, nil)
+}
+
+// redeemVoucher redeems a voucher on behalf of a customer.
+// @Summary      Redeem voucher
+// @Description  Apply a voucher to the client with the given email, or create a new client from the voucher's template when no email is given
+// @Tags         vouchers
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        data  body      VoucherRedeemRequest  true  "Voucher code and client"
+// @Success      200   {object}  entity.Msg{obj=entity.VoucherRedemption}
+// @Failure      400   {object}  entity.Msg
+// @Router       /vouchers/redeem [post]
+// @Router       /v2/vouchers/redemptions [post]
+func (a *VoucherController) redeemVoucher(c *gin.Context) {
+	request := &VoucherRedeemRequest{}
+	if err := c.ShouldBind(request); err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	redemption, needRestart, err := a.voucherService.RedeemVoucher(request.Code, request.Email, service.ClientPreset{}, "api")
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	if needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+	jsonObj(c, redemption, nil)
+}
+
+// delVoucher deletes a voucher.
+// @Summary      Delete voucher
+// @Description  Delete a voucher. Clients it was applied to are kept.
+// @Tags         vouchers
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        id   path      int  true  "Voucher ID"
+// @Success      200  {object}  entity.Msg
+// @Failure      400  {object}  entity.Msg
+// @Router       /vouchers/del/{id} [post]
+// @Router       /v2/vouchers/{id} [delete]
+func (a *VoucherController) delVoucher(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "delete"), err)
+		return
+	}
+	err = a.voucherService.DelVoucher(id)
+	jsonMsg(c, I18nWeb(c, "delete"), err)
+}
+
+// delVoucherBatch deletes the unused vouchers of a batch.
+// @Summary      Delete voucher batch
+// @Description  Delete the unused vouchers of a batch, for example when a batch leaked. Redeemed vouchers are kept for reporting.
+// @Tags         vouchers
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        batch  path      string  true  "Batch name"
+// @Success      200    {object}  entity.Msg{obj=int}
+// @Failure      400    {object}  entity.Msg
+// @Router       /vouchers/delBatch/{batch} [post]
+// @Router       /v2/vouchers/batches/{batch} [delete]
+func (a *VoucherController) delVoucherBatch(c *gin.Context) {
+	deleted, err := a.voucherService.DelVoucherBatch(c.Param("batch"))
+	jsonMsgObj(c, I18nWeb(c, "delete"), deleted, err)
+}
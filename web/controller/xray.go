@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// XrayController exposes the configuration the panel runs Xray with and the state of the running core.
+type XrayController struct {
+	xrayService service.XrayService
+}
+
+// NewXrayController creates a new XrayController and sets up its routes.
+func NewXrayController(g *gin.RouterGroup) *XrayController {
+	a := &XrayController{}
+	a.initRouter(g)
+	return a
+}
+
+// initRouter initializes the Xray routes, which are the same in the REST API.
+func (a *XrayController) initRouter(g *gin.RouterGroup) {
+	g.GET("/effectiveConfig", a.getEffectiveConfig)
+	g.GET("/effectiveConfig/diff", a.getEffectiveConfigDiff)
+	g.GET("/runtime", a.getRuntime)
+}
+
+// redactQuery reports whether secrets are to be left out of a configuration, which they are
+// unless redact=false is asked for.
+func redactQuery(c *gin.Context) bool {
+	redact, err := strconv.ParseBool(c.DefaultQuery("redact", "true"))
+	return err != nil || redact
+}
+
+// getEffectiveConfig returns the configuration the panel hands to Xray.
+// @Summary      Get effective Xray configuration
+// @Description  Get the exact configuration the panel hands to Xray on its next start, built from the template and the enabled inbounds. Client IDs, passwords and private keys are redacted unless redact=false.
+// @Tags         xray
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        redact  query     bool  false  "Redact secrets, true by default"
+// @Success      200     {object}  entity.Msg{obj=map[string]any}
+// @Failure      400     {object}  entity.Msg
+// @Router       /xray/effectiveConfig [get]
+// @Router       /v2/xray/effectiveConfig [get]
+func (a *XrayController) getEffectiveConfig(c *gin.Context) {
+	config, err := a.xrayService.GetEffectiveConfig(redactQuery(c))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "get"), err)
+		return
+	}
+	jsonObj(c, config, nil)
+}
+
+// getEffectiveConfigDiff compares the effective configuration with the running one.
+// @Summary      Compare effective and running Xray configuration
+// @Description  List the differences between the configuration the panel would hand to Xray now and the one the running core was started with, by JSON path with inbounds and outbounds matched by tag, to see why a change did not take effect yet. Secrets are redacted unless redact=false.
+// @Tags         xray
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        redact  query     bool  false  "Redact secrets, true by default"
+// @Success      200     {object}  entity.Msg{obj=entity.XrayConfigDiff}
+// @Failure      400     {object}  entity.Msg
+// @Router       /xray/effectiveConfig/diff [get]
+// @Router       /v2/xray/effectiveConfig/diff [get]
+func (a *XrayController) getEffectiveConfigDiff(c *gin.Context) {
+	diff, err := a.xrayService.DiffEffectiveConfig(redactQuery(c))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "get"), err)
+		return
+	}
+	jsonObj(c, diff, nil)
+}
+
+// getRuntime returns what the running core has loaded.
+// @Summary      Get Xray runtime state
+// @Description  Ask the running core for its loaded inbounds and outbounds, the users each inbound holds and the goroutines, memory and uptime of the process, compared with the configuration the panel hands to Xray, to confirm that inbounds and clients changed without a restart took effect.
+// @Tags         xray
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=entity.XrayRuntime}
+// @Failure      400  {object}  entity.Msg
+// @Router       /xray/runtime [get]
+// @Router       /v2/xray/runtime [get]
+func (a *XrayController) getRuntime(c *gin.Context) {
+	runtime, err := a.xrayService.GetRuntime()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "get"), err)
+		return
+	}
+	jsonObj(c, runtime, nil)
+}
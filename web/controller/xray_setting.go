@@ -1,6 +1,10 @@
 package controller
 
 import (
+	"strconv"
+
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+	"github.com/mhsanaei/3x-ui/v2/web/middleware"
 	"github.com/mhsanaei/3x-ui/v2/web/service"
 
 	"github.com/gin-gonic/gin"
@@ -8,12 +12,13 @@ import (
 
 // XraySettingController handles Xray configuration and settings operations.
 type XraySettingController struct {
-	XraySettingService service.XraySettingService
-	SettingService     service.SettingService
-	InboundService     service.InboundService
-	OutboundService    service.OutboundService
-	XrayService        service.XrayService
-	WarpService        service.WarpService
+	XraySettingService   service.XraySettingService
+	SettingService       service.SettingService
+	InboundService       service.InboundService
+	OutboundService      service.OutboundService
+	OutboundProbeService service.OutboundProbeService
+	XrayService          service.XrayService
+	WarpService          service.WarpService
 }
 
 // NewXraySettingController creates a new XraySettingController and initializes its routes.
@@ -29,11 +34,21 @@ func (a *XraySettingController) initRouter(g *gin.RouterGroup) {
 	g.GET("/getDefaultJsonConfig", a.getDefaultXrayConfig)
 	g.GET("/getOutboundsTraffic", a.getOutboundsTraffic)
 	g.GET("/getXrayResult", a.getXrayResult)
+	g.GET("/pendingChanges", a.getPendingChanges)
+	g.GET("/outbounds/:tag/sockopt", a.getOutboundSockopt)
+	g.GET("/policyLevels", a.getPolicyLevels)
+	g.GET("/outbounds/probes", a.getOutboundProbes)
+	g.GET("/outbounds/probeSummary", a.getOutboundProbeSummary)
 
-	g.POST("/", a.getXraySetting)
+	g.POST("/", middleware.ReadOnlyAllowed, a.getXraySetting)
 	g.POST("/warp/:action", a.warp)
 	g.POST("/update", a.updateSetting)
 	g.POST("/resetOutboundsTraffic", a.resetOutboundsTraffic)
+	g.POST("/applyChanges", a.applyChanges)
+	g.POST("/outbounds/:tag/updateSockopt", a.updateOutboundSockopt)
+	g.POST("/updatePolicyLevels", a.updatePolicyLevels)
+	g.POST("/outbounds/chain", a.chainOutbound)
+	g.POST("/outbounds/probe", a.probeOutbounds)
 }
 
 // getXraySetting retrieves the Xray configuration template and inbound tags.
@@ -78,6 +93,118 @@ func (a *XraySettingController) updateSetting(c *gin.Context) {
 	jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
 }
 
+// getOutboundSockopt retrieves the structured sockopt fields of an outbound.
+// @Summary      Get outbound sockopt
+// @Description  Get the sockopt and dialer options like tcpMptcp and dialerProxy of an outbound of the Xray template
+// @Tags         xray
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        tag  path      string  true  "Outbound tag"
+// @Success      200  {object}  entity.Msg{obj=entity.InboundSockopt}
+// @Failure      400  {object}  entity.Msg
+// @Router       /xray/outbounds/{tag}/sockopt [get]
+func (a *XraySettingController) getOutboundSockopt(c *gin.Context) {
+	sockopt, err := a.XraySettingService.GetOutboundSockopt(c.Param("tag"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.getSettings"), err)
+		return
+	}
+	jsonObj(c, sockopt, nil)
+}
+
+// updateOutboundSockopt merges the structured sockopt fields into an outbound of the Xray template.
+// @Summary      Update outbound sockopt
+// @Description  Validate the sockopt and dialer options against the host and the running core and store them, keeping other sockopt options
+// @Tags         xray
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        tag      path      string                 true  "Outbound tag"
+// @Param        sockopt  body      entity.InboundSockopt  true  "Sockopt fields"
+// @Success      200      {object}  entity.Msg
+// @Failure      400      {object}  entity.Msg
+// @Router       /xray/outbounds/{tag}/updateSockopt [post]
+func (a *XraySettingController) updateOutboundSockopt(c *gin.Context) {
+	sockopt := service.DefaultSockopt()
+	if err := c.ShouldBind(sockopt); err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+		return
+	}
+	err := a.XraySettingService.UpdateOutboundSockopt(c.Param("tag"), sockopt)
+	jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+	if err == nil {
+		a.XrayService.SetToNeedRestart()
+	}
+}
+
+// chainOutbound routes inbounds through an upstream server given by its share link.
+// @Summary      Chain inbounds through an upstream server
+// @Description  Create an outbound from a vless, trojan or shadowsocks share link and a routing rule sending the chosen inbounds through it
+// @Tags         xray
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        request  body      entity.ChainOutboundRequest  true  "Share link, outbound tag and inbound tags"
+// @Success      200      {object}  entity.Msg
+// @Failure      400      {object}  entity.Msg
+// @Router       /xray/outbounds/chain [post]
+func (a *XraySettingController) chainOutbound(c *gin.Context) {
+	req := &entity.ChainOutboundRequest{}
+	if err := c.ShouldBind(req); err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+		return
+	}
+	outbound, err := a.XraySettingService.ChainOutbound(req)
+	jsonMsgObj(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), outbound, err)
+	if err == nil {
+		a.XrayService.SetToNeedRestart()
+	}
+}
+
+// getPolicyLevels retrieves the policy levels of the Xray template.
+// @Summary      Get policy levels
+// @Description  Get the Xray policy levels by level number
+// @Tags         xray
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=map[string]entity.PolicyLevel}
+// @Failure      400  {object}  entity.Msg
+// @Router       /xray/policyLevels [get]
+func (a *XraySettingController) getPolicyLevels(c *gin.Context) {
+	levels, err := a.SettingService.GetPolicyLevels()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.getSettings"), err)
+		return
+	}
+	jsonObj(c, levels, nil)
+}
+
+// updatePolicyLevels replaces the policy levels of the Xray template.
+// @Summary      Update policy levels
+// @Description  Validate and store the Xray policy levels by level number. Levels clients are assigned to cannot be removed
+// @Tags         xray
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        levels  body      map[string]entity.PolicyLevel  true  "Policy levels by level number"
+// @Success      200     {object}  entity.Msg
+// @Failure      400     {object}  entity.Msg
+// @Router       /xray/updatePolicyLevels [post]
+func (a *XraySettingController) updatePolicyLevels(c *gin.Context) {
+	levels := map[string]*entity.PolicyLevel{}
+	if err := c.ShouldBindJSON(&levels); err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+		return
+	}
+	err := a.XraySettingService.UpdatePolicyLevels(levels)
+	jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+	if err == nil {
+		a.XrayService.SetToNeedRestart()
+	}
+}
+
 // getDefaultXrayConfig retrieves the default Xray configuration.
 // @Summary      Get default Xray config
 // @Description  Retrieve the default Xray configuration
@@ -111,6 +238,43 @@ func (a *XraySettingController) getXrayResult(c *gin.Context) {
 	jsonObj(c, a.XrayService.GetXrayResult(), nil)
 }
 
+// getPendingChanges reports the changes waiting for Xray to be restarted.
+// @Summary      Get pending changes
+// @Description  Report whether changes are waiting for the debounced Xray restart and when they will be applied
+// @Tags         xray
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=entity.PendingChanges}
+// @Failure      400  {object}  entity.Msg
+// @Router       /xray/pendingChanges [get]
+func (a *XraySettingController) getPendingChanges(c *gin.Context) {
+	jsonObj(c, a.XrayService.GetPendingChanges(), nil)
+}
+
+// applyChanges restarts Xray at once to apply pending changes.
+// @Summary      Apply pending changes
+// @Description  Restart Xray at once to apply pending changes instead of waiting for the restart delay
+// @Tags         xray
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=bool}
+// @Failure      400  {object}  entity.Msg
+// @Router       /xray/applyChanges [post]
+func (a *XraySettingController) applyChanges(c *gin.Context) {
+	applied, err := a.XrayService.ApplyChanges()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.xray.applyChanges"), err)
+		return
+	}
+	if !applied {
+		jsonMsgObj(c, I18nWeb(c, "pages.xray.noPendingChanges"), false, nil)
+		return
+	}
+	jsonMsgObj(c, I18nWeb(c, "pages.xray.restartSuccess"), true, nil)
+}
+
 // warp handles Warp-related operations based on the action parameter.
 // @Summary      Handle Warp operations
 // @Description  Handle Warp-related operations (data, del, config, reg, license)
@@ -187,3 +351,72 @@ func (a *XraySettingController) resetOutboundsTraffic(c *gin.Context) {
 	}
 	jsonObj(c, "", nil)
 }
+
+// getOutboundProbes retrieves the stored probe results of the outbounds.
+// @Summary      Get outbound probes
+// @Description  Get the TCP and TLS handshake latency measured for the outbounds, newest first. Results are kept for a week
+// @Tags         xray
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        tag    query     string  false  "Outbound tag, all outbounds when empty"
+// @Param        since  query     int     false  "Only probes from this timestamp in milliseconds"
+// @Param        limit  query     int     false  "Maximum number of probes, at most 1000"
+// @Success      200    {object}  entity.Msg{obj=[]model.OutboundProbe}
+// @Failure      400    {object}  entity.Msg
+// @Router       /xray/outbounds/probes [get]
+func (a *XraySettingController) getOutboundProbes(c *gin.Context) {
+	since, err := strconv.ParseInt(c.DefaultQuery("since", "0"), 10, 64)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	probes, err := a.OutboundProbeService.GetProbes(c.Query("tag"), since, limit)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonObj(c, probes, nil)
+}
+
+// getOutboundProbeSummary retrieves the success rate and latency of the outbounds.
+// @Summary      Get outbound probe summary
+// @Description  Get the success rate and average latency of each outbound probed in the last 24 hours, and whether its last probes all failed
+// @Tags         xray
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=[]entity.OutboundProbeSummary}
+// @Failure      400  {object}  entity.Msg
+// @Router       /xray/outbounds/probeSummary [get]
+func (a *XraySettingController) getOutboundProbeSummary(c *gin.Context) {
+	summaries, err := a.OutboundProbeService.GetProbeSummaries()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonObj(c, summaries, nil)
+}
+
+// probeOutbounds probes the outbounds now.
+// @Summary      Probe outbounds
+// @Description  Measure the TCP and TLS handshake latency of the servers of all outbounds now instead of waiting for the probe interval
+// @Tags         xray
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200  {object}  entity.Msg{obj=[]model.OutboundProbe}
+// @Failure      400  {object}  entity.Msg
+// @Router       /xray/outbounds/probe [post]
+func (a *XraySettingController) probeOutbounds(c *gin.Context) {
+	probes, changed, err := a.OutboundProbeService.ProbeOutbounds()
+	jsonObj(c, probes, err)
+	if changed {
+		a.XrayService.SetToNeedRestart()
+	}
+}
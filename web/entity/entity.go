@@ -3,38 +3,55 @@ package entity
 
 import (
 	"crypto/tls"
+	"encoding/json"
 	"math"
 	"net"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/mhsanaei/3x-ui/v2/database/model"
 	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/xray"
 )
 
 // Msg represents a standard API response message with success status, message text, and optional data object.
 type Msg struct {
-	Success bool   `json:"success"` // Indicates if the operation was successful
-	Msg     string `json:"msg"`     // Response message text
-	Obj     any    `json:"obj"`     // Optional data object
+	Success bool           `json:"success"`           // Indicates if the operation was successful
+	Msg     string         `json:"msg"`               // Response message text
+	Obj     any            `json:"obj"`               // Optional data object
+	Code    string         `json:"code,omitempty"`    // Stable error code of a failed operation, e.g. INBOUND_PORT_IN_USE
+	Details map[string]any `json:"details,omitempty"` // Structured error details, e.g. the conflicting port
 }
 
+var speedLimitIfaceRegex = regexp.MustCompile(`^[A-Za-z0-9_.:@-]{1,15}$`)
+
+var brandColorRegex = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
 // AllSetting contains all configuration settings for the 3x-ui panel including web server, Telegram bot, and subscription settings.
 type AllSetting struct {
 	// Web server settings
 	WebListen     string `json:"webListen" form:"webListen"`         // Web server listen IP address
 	WebDomain     string `json:"webDomain" form:"webDomain"`         // Web server domain for domain validation
 	WebPort       int    `json:"webPort" form:"webPort"`             // Web server port number
+	WebSocket     string `json:"webSocket" form:"webSocket"`         // Unix socket path or "systemd" to listen on instead of the TCP port
+	WebHttp3      bool   `json:"webHttp3" form:"webHttp3"`           // Also serve HTTP/3 over QUIC on the UDP port when HTTPS is enabled
 	WebCertFile   string `json:"webCertFile" form:"webCertFile"`     // Path to SSL certificate file for web server
 	WebKeyFile    string `json:"webKeyFile" form:"webKeyFile"`       // Path to SSL private key file for web server
 	WebBasePath   string `json:"webBasePath" form:"webBasePath"`     // Base path for web panel URLs
 	SessionMaxAge int    `json:"sessionMaxAge" form:"sessionMaxAge"` // Session maximum age in minutes
 
 	// UI settings
-	PageSize    int    `json:"pageSize" form:"pageSize"`       // Number of items per page in lists
-	ExpireDiff  int    `json:"expireDiff" form:"expireDiff"`   // Expiration warning threshold in days
-	TrafficDiff int    `json:"trafficDiff" form:"trafficDiff"` // Traffic warning threshold percentage
-	RemarkModel string `json:"remarkModel" form:"remarkModel"` // Remark model pattern for inbounds
-	Datepicker  string `json:"datepicker" form:"datepicker"`   // Date picker format
+	PageSize       int    `json:"pageSize" form:"pageSize"`             // Number of items per page in lists
+	ExpireDiff     int    `json:"expireDiff" form:"expireDiff"`         // Expiration warning threshold in days
+	TrafficDiff    int    `json:"trafficDiff" form:"trafficDiff"`       // Traffic warning threshold percentage
+	RemarkModel    string `json:"remarkModel" form:"remarkModel"`       // Remark model pattern for inbounds
+	RemarkTemplate string `json:"remarkTemplate" form:"remarkTemplate"` // Remark template for links, overrides the remark model
+	RemarkEmoji    bool   `json:"remarkEmoji" form:"remarkEmoji"`       // Decorate link remarks with emoji
+	Datepicker     string `json:"datepicker" form:"datepicker"`         // Date picker format
 
 	// Telegram bot settings
 	TgBotEnable      bool   `json:"tgBotEnable" form:"tgBotEnable"`           // Enable Telegram bot notifications
@@ -46,6 +63,8 @@ type AllSetting struct {
 	TgBotBackup      bool   `json:"tgBotBackup" form:"tgBotBackup"`           // Enable database backup via Telegram
 	TgBotLoginNotify bool   `json:"tgBotLoginNotify" form:"tgBotLoginNotify"` // Send login notifications
 	TgCpu            int    `json:"tgCpu" form:"tgCpu"`                       // CPU usage threshold for alerts
+	TgDisk           int    `json:"tgDisk" form:"tgDisk"`                     // Disk and inode usage threshold of the data directory for alerts, in percent
+	TgDbSize         int    `json:"tgDbSize" form:"tgDbSize"`                 // Database size threshold for alerts, in MB
 	TgLang           string `json:"tgLang" form:"tgLang"`                     // Telegram bot language
 
 	// Security settings
@@ -60,15 +79,21 @@ type AllSetting struct {
 	SubTitle                    string `json:"subTitle" form:"subTitle"`                                       // Subscription title
 	SubListen                   string `json:"subListen" form:"subListen"`                                     // Subscription server listen IP
 	SubPort                     int    `json:"subPort" form:"subPort"`                                         // Subscription server port
+	SubSocket                   string `json:"subSocket" form:"subSocket"`                                     // Unix socket path or "systemd" to listen on instead of the TCP port
+	SubHttp3                    bool   `json:"subHttp3" form:"subHttp3"`                                       // Also serve HTTP/3 over QUIC on the UDP port when HTTPS is enabled
 	SubPath                     string `json:"subPath" form:"subPath"`                                         // Base path for subscription URLs
 	SubDomain                   string `json:"subDomain" form:"subDomain"`                                     // Domain for subscription server validation
 	SubCertFile                 string `json:"subCertFile" form:"subCertFile"`                                 // SSL certificate file for subscription server
 	SubKeyFile                  string `json:"subKeyFile" form:"subKeyFile"`                                   // SSL private key file for subscription server
+	SubRateLimit                int    `json:"subRateLimit" form:"subRateLimit"`                               // Requests per minute each client address may make to the subscription server, 0 for unlimited
+	SubCloudflareOnly           bool   `json:"subCloudflareOnly" form:"subCloudflareOnly"`                     // Only accept subscription server connections from Cloudflare
 	SubUpdates                  int    `json:"subUpdates" form:"subUpdates"`                                   // Subscription update interval in minutes
 	ExternalTrafficInformEnable bool   `json:"externalTrafficInformEnable" form:"externalTrafficInformEnable"` // Enable external traffic reporting
 	ExternalTrafficInformURI    string `json:"externalTrafficInformURI" form:"externalTrafficInformURI"`       // URI for external traffic reporting
 	SubEncrypt                  bool   `json:"subEncrypt" form:"subEncrypt"`                                   // Encrypt subscription responses
 	SubShowInfo                 bool   `json:"subShowInfo" form:"subShowInfo"`                                 // Show client information in subscriptions
+	SubRandomize                bool   `json:"subRandomize" form:"subRandomize"`                               // Pick REALITY server names and short IDs at random on every request instead of by subscription ID
+	SubSign                     bool   `json:"subSign" form:"subSign"`                                         // Sign subscription payloads with the Ed25519 key of the panel
 	SubURI                      string `json:"subURI" form:"subURI"`                                           // Subscription server URI
 	SubJsonPath                 string `json:"subJsonPath" form:"subJsonPath"`                                 // Path for JSON subscription endpoint
 	SubJsonURI                  string `json:"subJsonURI" form:"subJsonURI"`                                   // JSON subscription server URI
@@ -100,6 +125,173 @@ type AllSetting struct {
 	LdapDefaultExpiryDays int    `json:"ldapDefaultExpiryDays" form:"ldapDefaultExpiryDays"`
 	LdapDefaultLimitIP    int    `json:"ldapDefaultLimitIP" form:"ldapDefaultLimitIP"`
 	// JSON subscription routing rules
+
+	// Payment settings
+	PaymentEnable        bool   `json:"paymentEnable" form:"paymentEnable"`               // Accept payment provider webhooks
+	PaymentStripeSecret  string `json:"paymentStripeSecret" form:"paymentStripeSecret"`   // Stripe webhook signing secret
+	PaymentHmacSecret    string `json:"paymentHmacSecret" form:"paymentHmacSecret"`       // Shared secret for HMAC signed webhooks
+	ReferralLinkTemplate string `json:"referralLinkTemplate" form:"referralLinkTemplate"` // Referral link with {code} in place of the referral code
+	SmtpHost             string `json:"smtpHost" form:"smtpHost"`                         // SMTP server used to deliver subscription links
+	SmtpPort             int    `json:"smtpPort" form:"smtpPort"`                         // SMTP server port
+	SmtpUsername         string `json:"smtpUsername" form:"smtpUsername"`                 // SMTP username
+	SmtpPassword         string `json:"smtpPassword" form:"smtpPassword"`                 // SMTP password
+	SmtpFrom             string `json:"smtpFrom" form:"smtpFrom"`                         // Sender address of delivery emails
+
+	// Speed limit settings
+	SpeedLimitInterface   string `json:"speedLimitInterface" form:"speedLimitInterface"`     // Network interface shaped with tc, empty to disable speed limits
+	ExpiryThrottleSpeed   int    `json:"expiryThrottleSpeed" form:"expiryThrottleSpeed"`     // Speed in KB/s of expired clients with the throttle action
+	ExpiryCaptiveOutbound string `json:"expiryCaptiveOutbound" form:"expiryCaptiveOutbound"` // Outbound tag expired clients with the captive action are routed to
+
+	// Client portal settings
+	PortalEnable bool `json:"portalEnable" form:"portalEnable"` // Enable the self-service portal for clients
+
+	// Inbound health check settings
+	HealthCheckMode string `json:"healthCheckMode" form:"healthCheckMode"` // What subscriptions do with failing inbounds: empty to disable checks, "reorder" or "drop"
+
+	// Firewall settings
+	FirewallBackend       string `json:"firewallBackend" form:"firewallBackend"`             // Firewall managed by the panel: ufw, nftables or iptables, empty to disable
+	FirewallPanelAllowIps string `json:"firewallPanelAllowIps" form:"firewallPanelAllowIps"` // Comma separated IPs and networks the panel port is limited to, empty for everyone
+
+	// Branding settings
+	BrandName           string `json:"brandName" form:"brandName"`                     // Name shown instead of 3X-UI, empty for the default branding
+	BrandLogoUrl        string `json:"brandLogoUrl" form:"brandLogoUrl"`               // Logo shown on the login page, in the sidebar and on the subscription page
+	BrandFaviconUrl     string `json:"brandFaviconUrl" form:"brandFaviconUrl"`         // Favicon of the panel and the subscription page
+	BrandPrimaryColor   string `json:"brandPrimaryColor" form:"brandPrimaryColor"`     // Primary color as #rrggbb, empty for the default theme
+	BrandSupportContact string `json:"brandSupportContact" form:"brandSupportContact"` // Support URL, Telegram @handle or email address shown to clients
+
+	// Public IP change detection and DDNS settings
+	IpCheckEnable   bool   `json:"ipCheckEnable" form:"ipCheckEnable"`     // Check the public IP address for changes
+	IpCheckInterval int    `json:"ipCheckInterval" form:"ipCheckInterval"` // Minutes between public IP checks
+	IpChangeWebhook string `json:"ipChangeWebhook" form:"ipChangeWebhook"` // URL the change is posted to as JSON, empty to disable
+	DdnsProvider    string `json:"ddnsProvider" form:"ddnsProvider"`       // DDNS provider updated on a change: cloudflare or duckdns, empty to disable
+	DdnsDomain      string `json:"ddnsDomain" form:"ddnsDomain"`           // Record name, or the DuckDNS subdomain
+	DdnsToken       string `json:"ddnsToken" form:"ddnsToken"`             // Cloudflare API token or DuckDNS token
+	DdnsZoneId      string `json:"ddnsZoneId" form:"ddnsZoneId"`           // Cloudflare zone ID, looked up from the domain when empty
+
+	// DNS provider settings
+	DnsProvider    string `json:"dnsProvider" form:"dnsProvider"`       // DNS provider managing inbound domain records and ACME challenges: cloudflare, empty to disable
+	DnsApiToken    string `json:"dnsApiToken" form:"dnsApiToken"`       // API token of the DNS provider, stored encrypted
+	DnsZoneId      string `json:"dnsZoneId" form:"dnsZoneId"`           // Zone ID, looked up from each domain when empty
+	DnsAutoRecord  bool   `json:"dnsAutoRecord" form:"dnsAutoRecord"`   // Create records for the domains of added and updated inbounds
+	DnsProxied     bool   `json:"dnsProxied" form:"dnsProxied"`         // Create records proxied through the provider's CDN
+	DnsCnameTarget string `json:"dnsCnameTarget" form:"dnsCnameTarget"` // Create CNAME records to this host instead of A/AAAA records to the public IP
+
+	// Database maintenance settings
+	MaintenanceEnable        bool `json:"maintenanceEnable" form:"maintenanceEnable"`               // Run the database maintenance every day
+	MaintenanceHour          int  `json:"maintenanceHour" form:"maintenanceHour"`                   // Hour of the day the maintenance runs at, in the panel's time zone
+	MaintenanceRetentionDays int  `json:"maintenanceRetentionDays" form:"maintenanceRetentionDays"` // Days finished payments, used deposit tokens and expired announcements are kept, 0 to keep them forever
+
+	// Xray restart settings
+	XrayRestartDelay int    `json:"xrayRestartDelay" form:"xrayRestartDelay"` // Seconds without further changes before Xray is restarted to apply them
+	CoreType         string `json:"coreType" form:"coreType"`                 // Proxy core the inbounds run on: xray or sing-box
+
+	// Online client detection settings
+	OnlineDetectionMode   string `json:"onlineDetectionMode" form:"onlineDetectionMode"`     // How online clients and their IPs are found: empty for traffic and the access log, "strict" for traffic in both directions within one collection, "api" for the Xray online stats
+	OnlineIdleWindow      int    `json:"onlineIdleWindow" form:"onlineIdleWindow"`           // Seconds a client stays online after its last traffic, 0 for one traffic interval
+	OnlineMinBytes        int    `json:"onlineMinBytes" form:"onlineMinBytes"`               // Bytes of traffic in one collection that count as activity
+	OnlineLogScanInterval int    `json:"onlineLogScanInterval" form:"onlineLogScanInterval"` // Seconds between scans of the access log for client IPs
+
+	// Traffic statistics collection settings
+	TrafficInterval       int  `json:"trafficInterval" form:"trafficInterval"`             // Seconds between traffic collections
+	TrafficClientUplink   bool `json:"trafficClientUplink" form:"trafficClientUplink"`     // Count the uplink traffic of each client
+	TrafficClientDownlink bool `json:"trafficClientDownlink" form:"trafficClientDownlink"` // Count the downlink traffic of each client
+	TrafficResetOnRead    bool `json:"trafficResetOnRead" form:"trafficResetOnRead"`       // Reset the Xray counters on every collection, otherwise the panel counts the difference to the previous read
+
+	// Outbound probing settings
+	OutboundProbeInterval     int  `json:"outboundProbeInterval" form:"outboundProbeInterval"`         // Minutes between outbound probes, 0 to disable them
+	OutboundProbeDeprioritize bool `json:"outboundProbeDeprioritize" form:"outboundProbeDeprioritize"` // Take outbounds failing their last probes out of their balancers
+
+	// NaiveProxy settings
+	NaiveEnable     bool   `json:"naiveEnable" form:"naiveEnable"`         // Run a Caddy forward proxy for NaiveProxy clients
+	NaivePort       int    `json:"naivePort" form:"naivePort"`             // Port the forward proxy listens on
+	NaiveDomain     string `json:"naiveDomain" form:"naiveDomain"`         // Domain of the forward proxy certificate and links
+	NaiveCertFile   string `json:"naiveCertFile" form:"naiveCertFile"`     // Certificate file, empty to let Caddy obtain one for the domain
+	NaiveKeyFile    string `json:"naiveKeyFile" form:"naiveKeyFile"`       // Key file of the certificate
+	NaiveInboundIds string `json:"naiveInboundIds" form:"naiveInboundIds"` // Comma separated IDs of the inbounds whose clients get proxy accounts
+
+	// SSH tunnel settings
+	SshEnable     bool   `json:"sshEnable" form:"sshEnable"`         // Run an SSH server that only forwards connections for the clients
+	SshPort       int    `json:"sshPort" form:"sshPort"`             // Port the SSH server listens on
+	SshHost       string `json:"sshHost" form:"sshHost"`             // Host put in ssh links, the subscription host when empty
+	SshInboundIds string `json:"sshInboundIds" form:"sshInboundIds"` // Comma separated IDs of the inbounds whose clients get SSH accounts
+
+	// Ad and malware blocking settings
+	AdBlockEnable            bool   `json:"adBlockEnable" form:"adBlockEnable"`                       // Block the domains of the ad, malware and phishing lists
+	AdBlockCategories        string `json:"adBlockCategories" form:"adBlockCategories"`               // Comma separated geosite lists to block
+	AdBlockExcludeInboundIds string `json:"adBlockExcludeInboundIds" form:"adBlockExcludeInboundIds"` // Comma separated IDs of the inbounds left unfiltered
+	GeofileUpdateInterval    int    `json:"geofileUpdateInterval" form:"geofileUpdateInterval"`       // Hours between automatic geofile updates, 0 to disable them
+
+	// REALITY target check settings
+	RealityCheckInterval   int    `json:"realityCheckInterval" form:"realityCheckInterval"`     // Minutes between checks of the REALITY targets, 0 to disable them
+	RealityMaxLatency      int    `json:"realityMaxLatency" form:"realityMaxLatency"`           // Longest acceptable handshake with a target in milliseconds, 0 for no limit
+	RealityBlockedDomains  string `json:"realityBlockedDomains" form:"realityBlockedDomains"`   // Comma separated domains known to be blocked, never to be used as targets
+	RealityFallbackTargets string `json:"realityFallbackTargets" form:"realityFallbackTargets"` // Comma separated targets to rotate to, in order of preference
+	RealityAutoRotate      bool   `json:"realityAutoRotate" form:"realityAutoRotate"`           // Replace bad targets with the first healthy fallback target
+
+	// Decoy settings for requests outside the web base path
+	DecoyMode         string `json:"decoyMode" form:"decoyMode"`                 // Answer to requests outside the base path: empty for 404, "nginx", "proxy" or "drop"
+	DecoyUrl          string `json:"decoyUrl" form:"decoyUrl"`                   // Site the proxy mode serves
+	DecoyBanThreshold int    `json:"decoyBanThreshold" form:"decoyBanThreshold"` // Probes within 10 minutes before an address is banned, 0 to never ban
+	DecoyBanMinutes   int    `json:"decoyBanMinutes" form:"decoyBanMinutes"`     // Minutes a banned address is dropped for
+	DecoyAbuseIpdbKey string `json:"decoyAbuseIpdbKey" form:"decoyAbuseIpdbKey"` // AbuseIPDB API key probing addresses are looked up with, empty to skip the lookup
+
+	// Tunnel settings for panels that can not be reached directly
+	TunnelMode     string `json:"tunnelMode" form:"tunnelMode"`         // Publish the panel through "cloudflare" or "tor", empty to not publish it
+	TunnelToken    string `json:"tunnelToken" form:"tunnelToken"`       // Cloudflare tunnel token, empty for a quick tunnel on trycloudflare.com
+	TunnelHostname string `json:"tunnelHostname" form:"tunnelHostname"` // Public hostname of the Cloudflare tunnel with the token
+
+	// Two-person approval settings for destructive operations
+	ApprovalEnable     bool `json:"approvalEnable" form:"approvalEnable"`         // Hold destructive operations until a second admin approves them
+	ApprovalMinClients int  `json:"approvalMinClients" form:"approvalMinClients"` // Deleting an inbound needs approval when it has more clients than this
+	ApprovalWindow     int  `json:"approvalWindow" form:"approvalWindow"`         // Minutes a request can be approved in before it expires
+
+	// Update check settings
+	UpdateCheckEnable bool `json:"updateCheckEnable" form:"updateCheckEnable"` // Look for new panel and Xray releases twice a day
+	UpdateCheckNotify bool `json:"updateCheckNotify" form:"updateCheckNotify"` // Tell the Telegram admins about new releases
+
+	// Debug settings
+	ProfilingEnable bool `json:"profilingEnable" form:"profilingEnable"` // Serve pprof and goroutine and heap dumps to the super admin
+}
+
+// SettingsBundle is a portable snapshot of panel settings grouped by section,
+// used to export settings from one instance and import them into another.
+type SettingsBundle struct {
+	Version            string                    `json:"version"`                      // Panel version that produced the bundle
+	ExportedAt         int64                     `json:"exportedAt"`                   // Export timestamp (unix seconds)
+	Sections           map[string]map[string]any `json:"sections"`                     // Settings keyed by section, then by setting key
+	XrayTemplateConfig json.RawMessage           `json:"xrayTemplateConfig,omitempty"` // Optional Xray template config
+}
+
+// InboundSniffing is the structured form of an inbound's sniffing configuration.
+type InboundSniffing struct {
+	Enabled      bool     `json:"enabled" form:"enabled"`           // Whether traffic sniffing is enabled
+	DestOverride []string `json:"destOverride" form:"destOverride"` // Protocols whose sniffed destination overrides the original one
+	MetadataOnly bool     `json:"metadataOnly" form:"metadataOnly"` // Sniff using connection metadata only
+	RouteOnly    bool     `json:"routeOnly" form:"routeOnly"`       // Use sniffed domain for routing only
+}
+
+// InboundSockopt is the structured form of the commonly used sockopt fields of an inbound's stream settings.
+// Outbounds share it for the dialer options of theirs.
+type InboundSockopt struct {
+	Mark                 int    `json:"mark" form:"mark"`                                           // SO_MARK applied to outgoing connections
+	Tproxy               string `json:"tproxy" form:"tproxy"`                                       // Transparent proxy mode: off, redirect or tproxy
+	DomainStrategy       string `json:"domainStrategy" form:"domainStrategy"`                       // Domain resolution strategy
+	Interface            string `json:"interface" form:"interface"`                                 // Network interface to bind to
+	TcpMptcp             bool   `json:"tcpMptcp,omitempty" form:"tcpMptcp"`                         // Use Multipath TCP, needs kernel support
+	TcpNoDelay           bool   `json:"tcpNoDelay,omitempty" form:"tcpNoDelay"`                     // Disable Nagle's algorithm
+	TcpCongestion        string `json:"tcpCongestion,omitempty" form:"tcpCongestion"`               // TCP congestion control algorithm like bbr, empty for the system default
+	TcpKeepAliveIdle     int    `json:"tcpKeepAliveIdle,omitempty" form:"tcpKeepAliveIdle"`         // Idle seconds before keepalive probes, 0 for the system default
+	TcpKeepAliveInterval int    `json:"tcpKeepAliveInterval,omitempty" form:"tcpKeepAliveInterval"` // Seconds between keepalive probes, 0 for the system default
+	TcpUserTimeout       int    `json:"tcpUserTimeout,omitempty" form:"tcpUserTimeout"`             // Milliseconds unacknowledged data may stay before the connection is closed, 0 for the system default
+	DialerProxy          string `json:"dialerProxy,omitempty" form:"dialerProxy"`                   // Tag of the outbound to dial through, outbounds only
+}
+
+// EffectiveSetting describes the value a setting currently resolves to and where it came from.
+type EffectiveSetting struct {
+	Key    string `json:"key"`    // Setting key
+	Value  any    `json:"value"`  // Value in effect
+	Source string `json:"source"` // One of env, file, database or default
+	EnvVar string `json:"envVar"` // Environment variable that overrides this setting
 }
 
 // CheckValid validates all settings in the AllSetting struct, checking IP addresses, ports, SSL certificates, and other configuration values.
@@ -126,7 +318,201 @@ func (s *AllSetting) CheckValid() error {
 		return common.NewError("Sub port is not a valid port:", s.SubPort)
 	}
 
-	if (s.SubPort == s.WebPort) && (s.WebListen == s.SubListen) {
+	if s.SmtpPort <= 0 || s.SmtpPort > math.MaxUint16 {
+		return common.NewError("SMTP port is not a valid port:", s.SmtpPort)
+	}
+
+	if s.SpeedLimitInterface != "" && !speedLimitIfaceRegex.MatchString(s.SpeedLimitInterface) {
+		return common.NewError("Speed limit interface is not a valid interface name:", s.SpeedLimitInterface)
+	}
+
+	if s.BrandPrimaryColor != "" && !brandColorRegex.MatchString(s.BrandPrimaryColor) {
+		return common.NewError("brand color must be a #rrggbb color:", s.BrandPrimaryColor)
+	}
+	for _, brandUrl := range []string{s.BrandLogoUrl, s.BrandFaviconUrl} {
+		if brandUrl != "" && !strings.HasPrefix(brandUrl, "https://") && !strings.HasPrefix(brandUrl, "http://") && !strings.HasPrefix(brandUrl, "/") {
+			return common.NewError("brand image must be an http(s) URL or an absolute path:", brandUrl)
+		}
+	}
+
+	if s.SubRateLimit < 0 {
+		return common.NewError("subscription rate limit must not be negative:", s.SubRateLimit)
+	}
+
+	if s.TgDisk < 0 || s.TgDisk > 100 {
+		return common.NewError("disk usage threshold must be between 0 and 100:", s.TgDisk)
+	}
+
+	if s.TgDbSize < 0 {
+		return common.NewError("database size threshold must not be negative:", s.TgDbSize)
+	}
+
+	if s.IpCheckInterval < 1 {
+		return common.NewError("public IP check interval must be at least 1 minute:", s.IpCheckInterval)
+	}
+	if s.IpChangeWebhook != "" && !strings.HasPrefix(s.IpChangeWebhook, "https://") && !strings.HasPrefix(s.IpChangeWebhook, "http://") {
+		return common.NewError("IP change webhook must be an http(s) URL:", s.IpChangeWebhook)
+	}
+	switch s.DdnsProvider {
+	case "", "cloudflare", "duckdns":
+	default:
+		return common.NewError("invalid DDNS provider:", s.DdnsProvider)
+	}
+	switch s.DnsProvider {
+	case "", "cloudflare":
+	default:
+		return common.NewError("invalid DNS provider:", s.DnsProvider)
+	}
+
+	if s.MaintenanceHour < 0 || s.MaintenanceHour > 23 {
+		return common.NewError("maintenance hour must be between 0 and 23:", s.MaintenanceHour)
+	}
+
+	if s.MaintenanceRetentionDays < 0 {
+		return common.NewError("maintenance retention must not be negative:", s.MaintenanceRetentionDays)
+	}
+
+	if s.XrayRestartDelay < 0 || s.XrayRestartDelay > 300 {
+		return common.NewError("xray restart delay must be between 0 and 300 seconds:", s.XrayRestartDelay)
+	}
+
+	switch s.CoreType {
+	case "", "xray", "sing-box":
+	default:
+		return common.NewError("invalid core type:", s.CoreType)
+	}
+
+	if s.TrafficInterval < 1 || s.TrafficInterval > 3600 {
+		return common.NewError("traffic interval must be between 1 and 3600 seconds:", s.TrafficInterval)
+	}
+
+	if s.OutboundProbeInterval < 0 || s.OutboundProbeInterval > 1440 {
+		return common.NewError("outbound probe interval must be between 0 and 1440 minutes:", s.OutboundProbeInterval)
+	}
+
+	if s.NaiveEnable {
+		if s.NaivePort <= 0 || s.NaivePort > math.MaxUint16 {
+			return common.NewError("naive port is not a valid port:", s.NaivePort)
+		}
+		if s.NaiveDomain == "" {
+			return common.NewError("naive domain is required")
+		}
+		if (s.NaiveCertFile == "") != (s.NaiveKeyFile == "") {
+			return common.NewError("naive certificate and key files must be set together")
+		}
+	}
+	if err := checkInboundIds("naive", s.NaiveInboundIds); err != nil {
+		return err
+	}
+
+	if s.SshEnable && (s.SshPort <= 0 || s.SshPort > math.MaxUint16) {
+		return common.NewError("ssh port is not a valid port:", s.SshPort)
+	}
+	if err := checkInboundIds("ssh", s.SshInboundIds); err != nil {
+		return err
+	}
+
+	if s.AdBlockEnable && strings.TrimSpace(s.AdBlockCategories) == "" {
+		return common.NewError("ad block lists are required")
+	}
+	for list := range strings.SplitSeq(s.AdBlockCategories, ",") {
+		list = strings.TrimSpace(list)
+		if list != "" && !strings.HasPrefix(list, "geosite:") && !strings.HasPrefix(list, "ext:") {
+			return common.NewError("ad block list is neither a geosite: nor an ext: list:", list)
+		}
+	}
+	if err := checkInboundIds("ad block", s.AdBlockExcludeInboundIds); err != nil {
+		return err
+	}
+	if s.GeofileUpdateInterval < 0 || s.GeofileUpdateInterval > 720 {
+		return common.NewError("geofile update interval must be between 0 and 720 hours:", s.GeofileUpdateInterval)
+	}
+
+	if s.RealityCheckInterval < 0 || s.RealityCheckInterval > 1440 {
+		return common.NewError("reality check interval must be between 0 and 1440 minutes:", s.RealityCheckInterval)
+	}
+	if s.RealityMaxLatency < 0 {
+		return common.NewError("reality max latency must not be negative:", s.RealityMaxLatency)
+	}
+	if s.RealityAutoRotate && strings.TrimSpace(s.RealityFallbackTargets) == "" {
+		return common.NewError("reality fallback targets are required to rotate targets")
+	}
+
+	switch s.OnlineDetectionMode {
+	case "", "strict", "api":
+	default:
+		return common.NewError("invalid online detection mode:", s.OnlineDetectionMode)
+	}
+	if s.OnlineIdleWindow < 0 || s.OnlineIdleWindow > 3600 {
+		return common.NewError("online idle window must be between 0 and 3600 seconds:", s.OnlineIdleWindow)
+	}
+	if s.OnlineMinBytes < 1 {
+		return common.NewError("online minimum bytes must be at least 1:", s.OnlineMinBytes)
+	}
+	if s.OnlineLogScanInterval < 1 || s.OnlineLogScanInterval > 3600 {
+		return common.NewError("online log scan interval must be between 1 and 3600 seconds:", s.OnlineLogScanInterval)
+	}
+
+	switch s.HealthCheckMode {
+	case "", "reorder", "drop":
+	default:
+		return common.NewError("invalid health check mode:", s.HealthCheckMode)
+	}
+
+	switch s.DecoyMode {
+	case "", "nginx", "drop":
+	case "proxy":
+		if u, err := url.Parse(s.DecoyUrl); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return common.NewError("invalid decoy URL:", s.DecoyUrl)
+		}
+	default:
+		return common.NewError("invalid decoy mode:", s.DecoyMode)
+	}
+	if s.DecoyBanThreshold < 0 {
+		return common.NewError("decoy ban threshold must not be negative:", s.DecoyBanThreshold)
+	}
+	if s.DecoyBanMinutes < 1 {
+		return common.NewError("decoy ban minutes must be at least 1:", s.DecoyBanMinutes)
+	}
+
+	switch s.TunnelMode {
+	case "", "cloudflare", "tor":
+	default:
+		return common.NewError("invalid tunnel mode:", s.TunnelMode)
+	}
+
+	if s.ApprovalMinClients < 0 {
+		return common.NewError("approval client threshold must not be negative:", s.ApprovalMinClients)
+	}
+	if s.ApprovalWindow < 1 {
+		return common.NewError("approval window must be at least 1 minute:", s.ApprovalWindow)
+	}
+
+	switch s.FirewallBackend {
+	case "", "ufw", "nftables", "iptables":
+	default:
+		return common.NewError("invalid firewall backend:", s.FirewallBackend)
+	}
+	for _, ip := range strings.Split(s.FirewallPanelAllowIps, ",") {
+		ip = strings.TrimSpace(ip)
+		if ip == "" || net.ParseIP(ip) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(ip); err != nil {
+			return common.NewError("invalid panel allow IP:", ip)
+		}
+	}
+
+	for _, socket := range []string{s.WebSocket, s.SubSocket} {
+		if socket != "" && socket != "systemd" && !filepath.IsAbs(socket) {
+			return common.NewError("socket must be empty, systemd or an absolute path:", socket)
+		}
+	}
+	if s.WebSocket != "" && s.WebSocket != "systemd" && s.WebSocket == s.SubSocket {
+		return common.NewError("Sub and Web could not use the same socket:", s.WebSocket)
+	}
+
+	if s.WebSocket == "" && s.SubSocket == "" && (s.SubPort == s.WebPort) && (s.WebListen == s.SubListen) {
 		return common.NewError("Sub and Web could not use same ip:port, ", s.SubListen, ":", s.SubPort, " & ", s.WebListen, ":", s.WebPort)
 	}
 
@@ -171,3 +557,611 @@ func (s *AllSetting) CheckValid() error {
 
 	return nil
 }
+
+// checkInboundIds checks a comma separated list of inbound IDs of the named feature.
+func checkInboundIds(feature string, value string) error {
+	for id := range strings.SplitSeq(value, ",") {
+		if id = strings.TrimSpace(id); id == "" {
+			continue
+		}
+		if _, err := strconv.Atoi(id); err != nil {
+			return common.NewErrorf("invalid %s inbound id: %s", feature, id)
+		}
+	}
+	return nil
+}
+
+// CustomerStats is a customer with the traffic of all its clients.
+type CustomerStats struct {
+	model.Customer
+	Up         int64            `json:"up"`         // Upload traffic of all clients in bytes
+	Down       int64            `json:"down"`       // Download traffic of all clients in bytes
+	Adjusted   int64            `json:"adjusted"`   // Net manual traffic corrections of all clients in bytes, negative for credits
+	Depleted   bool             `json:"depleted"`   // Quota used up or expired, so the clients are disabled
+	Online     bool             `json:"online"`     // Whether any client is online
+	LastOnline int64            `json:"lastOnline"` // Latest time any client was online in milliseconds
+	Clients    []CustomerClient `json:"clients"`    // Clients sharing the subscription ID
+}
+
+// CustomerClient is a client of a customer on one inbound.
+type CustomerClient struct {
+	InboundId  int    `json:"inboundId"`
+	Email      string `json:"email"`
+	Up         int64  `json:"up"`
+	Down       int64  `json:"down"`
+	Adjusted   int64  `json:"adjusted"` // Net manual traffic corrections in bytes, negative for credits
+	Enable     bool   `json:"enable"`   // Whether the client can connect
+	Online     bool   `json:"online"`
+	LastOnline int64  `json:"lastOnline"`
+}
+
+// InboundCertificate describes the TLS certificate of an inbound.
+type InboundCertificate struct {
+	InboundId  int      `json:"inboundId"`            // Inbound the certificate is used by
+	CertFile   string   `json:"certFile"`             // Certificate chain file, empty for an inline certificate
+	KeyFile    string   `json:"keyFile"`              // Private key file, empty for an inline key
+	Managed    bool     `json:"managed"`              // Whether the files are in the folder the panel manages them in
+	Subject    string   `json:"subject"`              // Common name of the certificate
+	Issuer     string   `json:"issuer"`               // Common name of the issuer
+	DNSNames   []string `json:"dnsNames"`             // Domains the certificate is valid for
+	NotBefore  int64    `json:"notBefore"`            // Start of the validity in milliseconds
+	NotAfter   int64    `json:"notAfter"`             // End of the validity in milliseconds
+	ChainSize  int      `json:"chainSize"`            // Number of certificates in the chain, the leaf included
+	Trusted    bool     `json:"trusted"`              // Whether the chain leads to a root the system trusts
+	TrustError string   `json:"trustError,omitempty"` // Why the chain is not trusted
+}
+
+// InactiveClient is a client that was not online for a while.
+type InactiveClient struct {
+	InboundId  int    `json:"inboundId"`  // Inbound the client belongs to
+	Inbound    string `json:"inbound"`    // Remark of the inbound
+	Email      string `json:"email"`      // Client email
+	Enable     bool   `json:"enable"`     // Whether the client can connect
+	LastOnline int64  `json:"lastOnline"` // Last time the client was online in milliseconds, 0 when never
+	CreatedAt  int64  `json:"createdAt"`  // Creation time of the client in milliseconds, 0 when unknown
+	Up         int64  `json:"up"`         // Upload traffic in bytes
+	Down       int64  `json:"down"`       // Download traffic in bytes
+}
+
+// TrafficPoolStats is a traffic pool with its clients.
+type TrafficPoolStats struct {
+	model.TrafficPool
+	Remaining int64               `json:"remaining"` // Bytes left of the budget, 0 for unlimited pools
+	Depleted  bool                `json:"depleted"`  // Budget used up, so the clients are disabled
+	Clients   []TrafficPoolClient `json:"clients"`   // Clients drawing from the pool
+}
+
+// TrafficPoolClient is a client drawing from a traffic pool.
+type TrafficPoolClient struct {
+	InboundId int    `json:"inboundId"`
+	Email     string `json:"email"`
+	Up        int64  `json:"up"`     // Upload traffic of the client since its own last reset
+	Down      int64  `json:"down"`   // Download traffic of the client since its own last reset
+	Enable    bool   `json:"enable"` // Whether the client can connect
+	Online    bool   `json:"online"`
+}
+
+// InboundGroup holds aggregated statistics of the inbounds assigned to a group.
+type InboundGroup struct {
+	Name            string `json:"name"`            // Group name, empty for ungrouped inbounds
+	Inbounds        int    `json:"inbounds"`        // Number of inbounds
+	EnabledInbounds int    `json:"enabledInbounds"` // Number of enabled inbounds
+	Clients         int    `json:"clients"`         // Number of clients
+	EnabledClients  int    `json:"enabledClients"`  // Number of enabled clients
+	OnlineClients   int    `json:"onlineClients"`   // Number of clients currently online
+	Up              int64  `json:"up"`              // Upload traffic of the inbounds in bytes
+	Down            int64  `json:"down"`            // Download traffic of the inbounds in bytes
+	AllTime         int64  `json:"allTime"`         // All-time traffic of the inbounds in bytes
+}
+
+// PortalClient is what a customer sees about one of their clients in the self-service portal.
+type PortalClient struct {
+	Email         string `json:"email"`         // Client email
+	Enable        bool   `json:"enable"`        // Whether the client can connect
+	Paused        bool   `json:"paused"`        // Whether the client is paused
+	Remark        string `json:"remark"`        // Remark of the inbound
+	Protocol      string `json:"protocol"`      // Protocol of the inbound
+	Up            int64  `json:"up"`            // Upload traffic in bytes
+	Down          int64  `json:"down"`          // Download traffic in bytes
+	Total         int64  `json:"total"`         // Traffic limit in bytes, 0 for unlimited
+	ExpiryTime    int64  `json:"expiryTime"`    // Expiration timestamp, negative while waiting for the first use
+	ExpiryPending bool   `json:"expiryPending"` // Whether the expiry timer waits for the first use
+	Link          string `json:"link"`          // Config link, empty when the inbound is disabled
+}
+
+// PortalInfo holds the subscription and clients of a customer logged in to the self-service portal.
+type PortalInfo struct {
+	SubId         string                `json:"subId"`         // Subscription ID
+	SubURL        string                `json:"subUrl"`        // Subscription URL, empty when subscriptions are disabled
+	Clients       []PortalClient        `json:"clients"`       // Clients sharing the subscription ID
+	Announcements []*model.Announcement `json:"announcements"` // Active announcements
+}
+
+// InboundHealth is the result of the latest health check of an inbound.
+type InboundHealth struct {
+	InboundId int    `json:"inboundId"` // Inbound ID
+	Healthy   bool   `json:"healthy"`   // Whether the inbound is considered reachable
+	Failures  int    `json:"failures"`  // Consecutive failed checks
+	Error     string `json:"error"`     // Error of the latest failed check
+	CheckedAt int64  `json:"checkedAt"` // Timestamp of the latest check in milliseconds
+}
+
+// RealityCheck is the result of checking the target of a REALITY inbound.
+type RealityCheck struct {
+	InboundId  int    `json:"inboundId"`  // Inbound ID
+	Remark     string `json:"remark"`     // Inbound remark
+	Target     string `json:"target"`     // Target address the handshake went to
+	ServerName string `json:"serverName"` // Server name sent in the handshake
+	Healthy    bool   `json:"healthy"`    // Whether the target completed a TLS 1.3 handshake in time
+	LatencyMs  int64  `json:"latencyMs"`  // Duration of the connection and handshake in milliseconds
+	Failures   int    `json:"failures"`   // Consecutive failed checks of this target
+	Error      string `json:"error"`      // Why the latest check failed
+	CheckedAt  int64  `json:"checkedAt"`  // Timestamp of the latest check in milliseconds
+}
+
+// FirewallState describes the firewall rules managed by the panel.
+type FirewallState struct {
+	Backend       string   `json:"backend"`       // Firewall backend, empty while disabled
+	Ports         []int    `json:"ports"`         // Ports opened for TCP and UDP
+	PanelPort     int      `json:"panelPort"`     // Port of the panel
+	PanelAllowIps []string `json:"panelAllowIps"` // IPs and networks the panel port is limited to, empty for everyone
+	Rules         string   `json:"rules"`         // Rules currently held by the backend as listed by it
+}
+
+// SysctlChange describes a kernel setting changed by the network tuning.
+type SysctlChange struct {
+	Key     string `json:"key"`     // sysctl key
+	Old     string `json:"old"`     // Value before the change
+	New     string `json:"new"`     // Value after the change
+	Changed bool   `json:"changed"` // Whether the value differs, in preview mode whether it would be changed
+	Error   string `json:"error"`   // Why the value could not be read or changed
+}
+
+// UnitStatus describes the state of a systemd unit as reported by systemctl.
+type UnitStatus struct {
+	Unit        string `json:"unit"`        // Unit name without the .service suffix
+	Description string `json:"description"` // Unit description
+	LoadState   string `json:"loadState"`   // loaded, not-found, ...
+	ActiveState string `json:"activeState"` // active, inactive, failed, ...
+	SubState    string `json:"subState"`    // running, dead, exited, ...
+	MainPID     int    `json:"mainPid"`     // PID of the main process, 0 when not running
+	Restarts    int    `json:"restarts"`    // Number of automatic restarts by systemd
+	ActiveSince string `json:"activeSince"` // When the unit entered the active state
+}
+
+// VacuumResult describes the database size before and after compacting it.
+type VacuumResult struct {
+	SizeBefore uint64 `json:"sizeBefore"` // Size of the database and its WAL file before compacting, in bytes
+	SizeAfter  uint64 `json:"sizeAfter"`  // Size of the database and its WAL file after compacting, in bytes
+}
+
+// MaintenanceReport describes what a database maintenance run removed and how the database size changed.
+type MaintenanceReport struct {
+	OrphanedTraffics  int64  `json:"orphanedTraffics"`  // Traffic rows of clients that no longer exist
+	OrphanedClientIps int64  `json:"orphanedClientIps"` // IP log rows of clients that no longer exist
+	Payments          int64  `json:"payments"`          // Finished payments older than the retention
+	DepositTokens     int64  `json:"depositTokens"`     // Expired or used up deposit tokens older than the retention
+	Announcements     int64  `json:"announcements"`     // Announcements expired longer than the retention
+	SizeBefore        uint64 `json:"sizeBefore"`        // Size of the database and its WAL file before the run, in bytes
+	SizeAfter         uint64 `json:"sizeAfter"`         // Size of the database and its WAL file after the run, in bytes
+	Duration          int64  `json:"duration"`          // Duration of the run in milliseconds
+}
+
+// PendingChanges describes configuration changes waiting for Xray to be restarted.
+type PendingChanges struct {
+	Pending       bool  `json:"pending"`       // Whether changes are waiting to be applied
+	Changes       int64 `json:"changes"`       // Number of changes made since the last restart
+	FirstChangeAt int64 `json:"firstChangeAt"` // Time of the first pending change, in milliseconds
+	LastChangeAt  int64 `json:"lastChangeAt"`  // Time of the last pending change, in milliseconds
+	ApplyAt       int64 `json:"applyAt"`       // Time the changes are applied at unless more follow, in milliseconds
+}
+
+// XrayConfigDiff compares the configuration the panel would hand to Xray with the running one.
+type XrayConfigDiff struct {
+	Running     bool               `json:"running"`     // Whether the core is running
+	NeedRestart bool               `json:"needRestart"` // Whether changes are waiting for a restart
+	Equal       bool               `json:"equal"`       // Whether the running core uses the effective configuration
+	Changes     []XrayConfigChange `json:"changes"`     // Differences from the running configuration
+}
+
+// XrayConfigChange is a difference between the running and the effective Xray configuration.
+type XrayConfigChange struct {
+	Path      string `json:"path"`                // JSON path of the value, with list items by tag or index
+	Type      string `json:"type"`                // added, removed or changed
+	Running   any    `json:"running,omitempty"`   // Value in the running configuration
+	Effective any    `json:"effective,omitempty"` // Value in the effective configuration
+}
+
+// XrayRuntime describes what the running Xray core has loaded next to what the panel handed it,
+// to confirm that changes applied without a restart took effect.
+type XrayRuntime struct {
+	Stats            *xray.SysStats       `json:"stats"`            // Goroutines, memory and uptime of the core process
+	Inbounds         []XrayRuntimeInbound `json:"inbounds"`         // Inbounds loaded in the core
+	Outbounds        []string             `json:"outbounds"`        // Tags of the outbounds loaded in the core
+	MissingInbounds  []string             `json:"missingInbounds"`  // Tags of inbounds in the configuration the core has not loaded
+	MissingOutbounds []string             `json:"missingOutbounds"` // Tags of outbounds in the configuration the core has not loaded
+	InSync           bool                 `json:"inSync"`           // Whether the loaded inbounds, outbounds and users match the configuration
+}
+
+// XrayRuntimeInbound is an inbound loaded in the running Xray core.
+type XrayRuntimeInbound struct {
+	Tag           string `json:"tag"`                     // Inbound tag
+	Users         *int64 `json:"users,omitempty"`         // Users the core holds, unset for inbounds without users
+	ExpectedUsers *int   `json:"expectedUsers,omitempty"` // Users in the configuration, unset when it lists none or the inbound is not in it
+}
+
+// ProcessStats describes the goroutines and memory of the panel process.
+type ProcessStats struct {
+	GoVersion   string `json:"goVersion"`   // Go version the panel was built with
+	Uptime      int64  `json:"uptime"`      // Seconds since the panel process started
+	Goroutines  int    `json:"goroutines"`  // Goroutines currently running
+	HeapAlloc   uint64 `json:"heapAlloc"`   // Bytes of allocated heap objects
+	HeapInuse   uint64 `json:"heapInuse"`   // Bytes in in-use heap spans
+	HeapObjects uint64 `json:"heapObjects"` // Allocated heap objects
+	Sys         uint64 `json:"sys"`         // Bytes of memory obtained from the OS
+	NumGC       uint32 `json:"numGC"`       // Completed garbage collections
+	LastGC      int64  `json:"lastGC"`      // Time of the last garbage collection in milliseconds, 0 before the first
+}
+
+// UpdateInfo lists the panel and Xray releases newer than the installed versions.
+type UpdateInfo struct {
+	PanelVersion string        `json:"panelVersion"`    // Installed panel version
+	XrayVersion  string        `json:"xrayVersion"`     // Version of the installed Xray core
+	Panel        []ReleaseNote `json:"panel"`           // Newer panel releases, newest first
+	Xray         []ReleaseNote `json:"xray"`            // Newer Xray releases, newest first
+	Security     bool          `json:"security"`        // Whether one of the newer releases mentions a security fix
+	CheckedAt    int64         `json:"checkedAt"`       // Time of the check, in milliseconds
+	Error        string        `json:"error,omitempty"` // Why the releases could not be fetched
+}
+
+// ReleaseNote is a release with its changelog.
+type ReleaseNote struct {
+	Version     string `json:"version"`     // Tag of the release
+	Name        string `json:"name"`        // Title of the release
+	PublishedAt string `json:"publishedAt"` // Publication time in RFC 3339
+	Url         string `json:"url"`         // Page of the release
+	Notes       string `json:"notes"`       // Changelog in Markdown
+	Security    bool   `json:"security"`    // Whether the release mentions a security fix or a CVE
+}
+
+// ChainOutboundRequest asks to send the traffic of some inbounds through an upstream server given by its share link.
+type ChainOutboundRequest struct {
+	Link        string   `json:"link" form:"link"`               // vless://, trojan:// or ss:// share link of the upstream server
+	Tag         string   `json:"tag" form:"tag"`                 // Tag of the new outbound, picked from "chain" when empty
+	InboundTags []string `json:"inboundTags" form:"inboundTags"` // Tags of the inbounds routed through the upstream server
+}
+
+// OutboundProbeSummary sums up the recent probes of an outbound.
+type OutboundProbeSummary struct {
+	Tag           string  `json:"tag"`           // Outbound tag
+	Probes        int     `json:"probes"`        // Probes in the last 24 hours
+	Successes     int     `json:"successes"`     // Successful probes in the last 24 hours
+	SuccessRate   float64 `json:"successRate"`   // Share of successful probes from 0 to 1
+	Latency       int64   `json:"latency"`       // Average TCP connect plus TLS handshake time of the successful probes in milliseconds
+	LastProbeAt   int64   `json:"lastProbeAt"`   // Timestamp of the last probe in milliseconds
+	Deprioritized bool    `json:"deprioritized"` // Whether the last probes all failed, so the outbound is taken out of its balancers when enabled
+}
+
+// PolicyLevel holds the options of an Xray policy level. Unset durations and sizes keep the Xray defaults.
+// The traffic stats and online detection settings of the panel override the stats options when Xray starts.
+type PolicyLevel struct {
+	Handshake         *int `json:"handshake,omitempty"`         // Seconds allowed for the handshake of a new connection
+	ConnIdle          *int `json:"connIdle,omitempty"`          // Seconds an idle connection stays open
+	UplinkOnly        *int `json:"uplinkOnly,omitempty"`        // Seconds a connection stays open after the downlink closed
+	DownlinkOnly      *int `json:"downlinkOnly,omitempty"`      // Seconds a connection stays open after the uplink closed
+	BufferSize        *int `json:"bufferSize,omitempty"`        // Buffer size of each connection in KB, 0 to disable buffering
+	StatsUserUplink   bool `json:"statsUserUplink,omitempty"`   // Count the uplink traffic of the users of the level
+	StatsUserDownlink bool `json:"statsUserDownlink,omitempty"` // Count the downlink traffic of the users of the level
+	StatsUserOnline   bool `json:"statsUserOnline,omitempty"`   // Track the online connections of the users of the level
+}
+
+// ClientSpeed is the current transfer rate of a client, measured between the last two traffic collections.
+type ClientSpeed struct {
+	Email string `json:"email"` // Client email
+	Up    int64  `json:"up"`    // Upload rate in bytes per second
+	Down  int64  `json:"down"`  // Download rate in bytes per second
+}
+
+// Branding holds the white-label settings used by the panel pages, the subscription page, Telegram and email.
+type Branding struct {
+	Name         string `json:"name"`         // Brand name, empty for the default branding
+	LogoUrl      string `json:"logoUrl"`      // Logo URL
+	FaviconUrl   string `json:"faviconUrl"`   // Favicon URL
+	PrimaryColor string `json:"primaryColor"` // Primary color as #rrggbb
+	Support      string `json:"support"`      // Support contact as entered
+	SupportLink  string `json:"supportLink"`  // Support contact as a link, empty when it is not a URL, handle or email address
+}
+
+// ApiVersion describes one version of the panel API.
+type ApiVersion struct {
+	Version     int    `json:"version"`               // API version number
+	Prefix      string `json:"prefix"`                // Route prefix of the version
+	Status      string `json:"status"`                // "current" or "deprecated"
+	Deprecation int64  `json:"deprecation,omitempty"` // Unix time the version was deprecated
+	Sunset      int64  `json:"sunset,omitempty"`      // Unix time after which the version may be removed
+}
+
+// ApiVersionInfo reports the supported API versions and the panel build.
+type ApiVersionInfo struct {
+	Current      int          `json:"current"`      // Current API version
+	Versions     []ApiVersion `json:"versions"`     // Supported API versions
+	PanelVersion string       `json:"panelVersion"` // Panel release version
+	XrayVersion  string       `json:"xrayVersion"`  // Version of the running Xray core
+	GoVersion    string       `json:"goVersion"`    // Go version the panel was built with
+	Commit       string       `json:"commit"`       // VCS revision of the build, when recorded
+}
+
+// PublicIPCheck is the result of a public IP check.
+type PublicIPCheck struct {
+	IPv4            string   `json:"ipv4"`                      // Detected public IPv4 address, empty when none was found
+	IPv6            string   `json:"ipv6"`                      // Detected public IPv6 address, empty when none was found
+	OldIPv4         string   `json:"oldIpv4"`                   // IPv4 address found by the previous check
+	OldIPv6         string   `json:"oldIpv6"`                   // IPv6 address found by the previous check
+	Changed         bool     `json:"changed"`                   // Whether an address changed since the previous check
+	DdnsUpdated     bool     `json:"ddnsUpdated"`               // Whether the DDNS record was updated
+	UpdatedInbounds []int    `json:"updatedInbounds,omitempty"` // Inbounds whose listen address or external proxy was updated
+	UpdatedSettings []string `json:"updatedSettings,omitempty"` // Subscription settings that embedded the old address
+	Errors          []string `json:"errors,omitempty"`          // DDNS and webhook failures
+}
+
+// DNSRecord is a DNS record managed through the configured DNS provider.
+type DNSRecord struct {
+	Type    string `json:"type" form:"type"`       // Record type: A, AAAA, CNAME or TXT
+	Name    string `json:"name" form:"name"`       // Fully qualified record name
+	Content string `json:"content" form:"content"` // Address, target host or text of the record
+	TTL     int    `json:"ttl" form:"ttl"`         // Time to live in seconds, 0 or 1 for automatic
+	Proxied bool   `json:"proxied" form:"proxied"` // Whether the record is proxied through the provider's CDN
+}
+
+// CdnCheck is the result of reaching an inbound through the CDN proxying its domain.
+type CdnCheck struct {
+	URL       string `json:"url"`       // URL requested through the CDN
+	Reachable bool   `json:"reachable"` // Whether the CDN forwarded the request to the inbound
+	ViaCdn    bool   `json:"viaCdn"`    // Whether the response came from Cloudflare
+	Status    int    `json:"status"`    // HTTP status of the response, 0 when there was none
+	Error     string `json:"error"`     // Why the inbound could not be reached
+}
+
+// CdnSetup is the outcome of setting up an inbound behind Cloudflare.
+type CdnSetup struct {
+	InboundId int         `json:"inboundId"` // ID of the created inbound
+	Email     string      `json:"email"`     // Email of the client created on it
+	Records   []DNSRecord `json:"records"`   // Proxied records pointing the domain at this server
+	SslMode   string      `json:"sslMode"`   // Cloudflare SSL/TLS mode the zone needs: flexible or full
+	Check     CdnCheck    `json:"check"`     // Reachability of the inbound through the CDN
+	Link      string      `json:"link"`      // Share link of the client
+	SubURL    string      `json:"subUrl"`    // Subscription URL of the client, empty when subscriptions are off
+}
+
+// AcmeChallenge is an ACME DNS-01 challenge published as a TXT record.
+type AcmeChallenge struct {
+	Domain string `json:"domain" form:"domain"` // Domain the certificate is issued for
+	Value  string `json:"value" form:"value"`   // Key authorization digest of the challenge
+}
+
+// BackupVerification is the result of checking a database backup without restoring it.
+type BackupVerification struct {
+	Valid                bool     `json:"valid"`                // Whether the backup can be restored by this panel
+	SchemaVersion        int      `json:"schemaVersion"`        // Schema version of the backup, 0 for backups of builds that did not record it
+	CurrentSchemaVersion int      `json:"currentSchemaVersion"` // Schema version of this panel
+	Integrity            string   `json:"integrity"`            // Result of the SQLite integrity check, "ok" when the file is sound
+	Users                int64    `json:"users"`                // Number of panel users
+	Inbounds             int64    `json:"inbounds"`             // Number of inbounds
+	Clients              int      `json:"clients"`              // Number of clients configured in the inbounds
+	ClientTraffics       int64    `json:"clientTraffics"`       // Number of client traffic records
+	Settings             int64    `json:"settings"`             // Number of stored settings
+	Secrets              int      `json:"secrets"`              // Number of encrypted secret settings
+	SecretsReadable      bool     `json:"secretsReadable"`      // Whether the secret settings can be decrypted with this panel's master key
+	Warnings             []string `json:"warnings,omitempty"`   // Issues that do not prevent a restore
+	Errors               []string `json:"errors,omitempty"`     // Issues that prevent a restore
+}
+
+// ApplyDocument is the declarative desired state accepted by the apply endpoint as YAML or JSON.
+type ApplyDocument struct {
+	Settings map[string]any `json:"settings"` // Panel settings to set, keyed like the settings API; settings not listed are left unchanged
+	Inbounds []ApplyInbound `json:"inbounds"` // Desired inbounds, identified by external ID or by listen address and port
+	Prune    bool           `json:"prune"`    // Delete inbounds that are not listed
+}
+
+// ApplyInbound is the desired state of an inbound. Omitted fields take their default value; traffic
+// counters are kept, as are the keys of settings and its clients that are not declared, clients being
+// matched by email. settings, streamSettings and sniffing may be given as objects or JSON strings.
+type ApplyInbound struct {
+	ExternalId      string         `json:"externalId"` // Matches the inbound by external ID before the tag; generated on create when empty
+	Remark          string         `json:"remark"`
+	RemarkTemplate  string         `json:"remarkTemplate"`
+	Group           string         `json:"group"`
+	Enable          *bool          `json:"enable"` // Defaults to true
+	Listen          string         `json:"listen"`
+	Port            int            `json:"port"`
+	Protocol        model.Protocol `json:"protocol"`
+	Total           int64          `json:"total"`
+	ExpiryTime      int64          `json:"expiryTime"`
+	TrafficReset    string         `json:"trafficReset"` // Defaults to never
+	SpeedLimit      int64          `json:"speedLimit"`
+	SpeedBurst      int64          `json:"speedBurst"`
+	SpeedUnit       string         `json:"speedUnit"` // Unit of SpeedLimit: empty for KB/s, "mbit" for Mbit/s
+	ConnLimit       int            `json:"connLimit"`
+	ConnLimitPerIp  int            `json:"connLimitPerIp"`
+	PortHopRange    string         `json:"portHopRange"`
+	PortHopInterval int            `json:"portHopInterval"`
+	ExtraPorts      string         `json:"extraPorts"`
+	SubPortMode     string         `json:"subPortMode"`
+	SubExclude      bool           `json:"subExclude"`
+	ExtraListens    string         `json:"extraListens"`
+	Settings        any            `json:"settings"`
+	StreamSettings  any            `json:"streamSettings"`
+	Sniffing        any            `json:"sniffing"`  // Defaults to the protocol's default sniffing
+	Extension       any            `json:"extension"` // JSON object deep-merged into the generated Xray inbound
+}
+
+// ApplyChange is one change of an apply plan.
+type ApplyChange struct {
+	Action  string   `json:"action"`            // create, update or delete
+	Kind    string   `json:"kind"`              // setting, inbound or client
+	Key     string   `json:"key"`               // Setting key, inbound tag or client email
+	Inbound string   `json:"inbound,omitempty"` // Tag of the inbound a client change belongs to
+	Fields  []string `json:"fields,omitempty"`  // Changed fields of an inbound or client update
+}
+
+// ApplyPlan is the difference between the current and the desired state, and whether it was applied.
+type ApplyPlan struct {
+	DryRun    bool              `json:"dryRun"`              // Whether only the plan was computed
+	Applied   bool              `json:"applied"`             // Whether all changes were applied
+	Changes   []ApplyChange     `json:"changes"`             // Changes in the order they are applied
+	Unchanged int               `json:"unchanged"`           // Number of listed settings and inbounds already in the desired state
+	Approvals []*model.Approval `json:"approvals,omitempty"` // Approval requests filed for inbound deletions held back
+}
+
+// ExternalClient is a client looked up by its external ID, with the inbound it belongs to.
+type ExternalClient struct {
+	InboundId         int          `json:"inboundId"`         // ID of the inbound the client belongs to
+	InboundExternalId string       `json:"inboundExternalId"` // External ID of the inbound the client belongs to
+	Client            model.Client `json:"client"`            // The client
+}
+
+// PanelState is the panel configuration in the form of an apply document, returned by the state endpoint.
+type PanelState struct {
+	Settings map[string]any `json:"settings"` // Panel settings keyed like the settings API, without those overridden by the environment
+	Inbounds []ApplyInbound `json:"inbounds"` // Inbounds sorted by tag, clients included in their settings
+	Secrets  bool           `json:"secrets"`  // Whether secret settings, client credentials and private keys are included
+}
+
+// Readiness reports whether the panel is ready to serve, with the result of every check.
+type Readiness struct {
+	Ready  bool             `json:"ready"`  // Whether every check passed
+	Checks []ReadinessCheck `json:"checks"` // Checks in a stable order: database, xray, config
+}
+
+// ReadinessCheck is the result of one readiness check.
+type ReadinessCheck struct {
+	Name  string `json:"name"`            // Check name
+	Ok    bool   `json:"ok"`              // Whether the check passed
+	Error string `json:"error,omitempty"` // Why the check failed
+}
+
+// SubSignKey is the public key subscription payloads are signed with.
+type SubSignKey struct {
+	Algorithm string `json:"algorithm"` // Signature algorithm, always ed25519
+	KeyId     string `json:"keyId"`     // ID of the key sent with every signature, changing when the key is rotated
+	PublicKey string `json:"publicKey"` // Raw public key in standard base64
+	Enabled   bool   `json:"enabled"`   // Whether subscriptions are signed
+}
+
+// EndpointStats counts the requests a panel or subscription server endpoint answered.
+type EndpointStats struct {
+	Server      string `json:"server"`      // web or sub
+	Endpoint    string `json:"endpoint"`    // Route pattern, empty for requests matching no route
+	Requests    int64  `json:"requests"`    // Requests answered
+	Errors      int64  `json:"errors"`      // Requests answered with a 4xx or 5xx status
+	Bytes       int64  `json:"bytes"`       // Response body bytes sent
+	LastRequest int64  `json:"lastRequest"` // Time of the last request in Unix milliseconds
+}
+
+// EndpointStatsReport is the list of endpoint counters with the time counting started.
+type EndpointStatsReport struct {
+	Since     int64           `json:"since"`     // Start or last reset of the counters in Unix milliseconds
+	Endpoints []EndpointStats `json:"endpoints"` // Counters by server and endpoint
+}
+
+// SubRequestStats counts the successful requests for a subscription on the subscription server.
+type SubRequestStats struct {
+	SubId       string `json:"subId"`       // Subscription ID
+	Requests    int64  `json:"requests"`    // Requests answered
+	Bytes       int64  `json:"bytes"`       // Response body bytes sent
+	Clients     int    `json:"clients"`     // Distinct addresses the requests came from, counted up to 1000
+	LastIp      string `json:"lastIp"`      // Address of the last request
+	LastRequest int64  `json:"lastRequest"` // Time of the last request in Unix milliseconds
+}
+
+// DecoyProbe is a request outside the web base path answered with the decoy.
+type DecoyProbe struct {
+	Ip        string `json:"ip"`        // Client address
+	Method    string `json:"method"`    // HTTP method
+	Path      string `json:"path"`      // Requested path with the query
+	UserAgent string `json:"userAgent"` // User agent header
+	Time      int64  `json:"time"`      // Time of the request in Unix milliseconds
+	Score     int    `json:"score"`     // AbuseIPDB confidence score of the address from 0 to 100, -1 when unknown
+}
+
+// DecoyBan is an address dropped for probing the panel.
+type DecoyBan struct {
+	Ip     string `json:"ip"`     // Banned address
+	Until  int64  `json:"until"`  // End of the ban in Unix milliseconds
+	Reason string `json:"reason"` // Why the address was banned
+}
+
+// TunnelStatus is the state of the tunnel the panel is published through.
+type TunnelStatus struct {
+	Mode     string `json:"mode"`            // "cloudflare", "tor" or empty when the panel is not published
+	Running  bool   `json:"running"`         // Whether cloudflared or tor is running
+	Hostname string `json:"hostname"`        // Public hostname, empty until it is known
+	Url      string `json:"url"`             // Public URL of the panel, empty until the hostname is known
+	Error    string `json:"error,omitempty"` // Error cloudflared or tor exited with
+}
+
+// ClientImportRow is the outcome of one row of a client import.
+type ClientImportRow struct {
+	Row    int    `json:"row"`             // Line of the row in the file, starting at 1
+	Email  string `json:"email"`           // Client email
+	Action string `json:"action"`          // create, update, skip or error
+	Error  string `json:"error,omitempty"` // Why the row was rejected or skipped
+}
+
+// ClientImportResult reports what a client import did, or would do in a dry run.
+type ClientImportResult struct {
+	DryRun  bool              `json:"dryRun"`  // Whether nothing was changed
+	Created int               `json:"created"` // Clients created
+	Updated int               `json:"updated"` // Existing clients updated
+	Skipped int               `json:"skipped"` // Rows left out for clients that already exist
+	Failed  int               `json:"failed"`  // Rows rejected
+	Rows    []ClientImportRow `json:"rows"`    // Outcome of every row
+}
+
+// VoucherBatchReport sums up the redemption status of the vouchers of one batch.
+type VoucherBatchReport struct {
+	Batch      string `json:"batch"`      // Batch name
+	Type       string `json:"type"`       // Unit of the value, days or gb
+	Value      int    `json:"value"`      // Days or GB each voucher adds
+	InboundId  int    `json:"inboundId"`  // Inbound new clients are created on, 0 when the vouchers only extend clients
+	Total      int    `json:"total"`      // Vouchers generated
+	Redeemed   int    `json:"redeemed"`   // Vouchers redeemed
+	NewClients int    `json:"newClients"` // Redemptions that created a client
+	Expired    int    `json:"expired"`    // Unused vouchers past their expiration
+	Available  int    `json:"available"`  // Vouchers that can still be redeemed
+	CreatedAt  int64  `json:"createdAt"`  // Generation of the first voucher in Unix milliseconds
+}
+
+// VoucherRedemption is the outcome of redeeming a voucher.
+type VoucherRedemption struct {
+	Code      string `json:"code"`      // Redeemed voucher code
+	Email     string `json:"email"`     // Client the voucher was applied to
+	SubId     string `json:"subId"`     // Subscription ID of a created client
+	NewClient bool   `json:"newClient"` // Whether the client was created
+	Type      string `json:"type"`      // Unit of the value, days or gb
+	Value     int    `json:"value"`     // Days or GB added
+}
+
+// ReferralLink is the link a referrer hands out to attribute new clients to them.
+type ReferralLink struct {
+	Code string `json:"code"` // Referral code
+	Link string `json:"link"` // Referral link, empty while no referral link template is set
+}
+
+// ReferralRevenue is the amount paid in one currency by the clients of a referrer.
+type ReferralRevenue struct {
+	Currency string `json:"currency"` // Paid currency
+	Amount   int64  `json:"amount"`   // Paid amount in the currency's smallest unit
+}
+
+// ReferrerReport sums up the clients attributed to a referrer and what they paid.
+type ReferrerReport struct {
+	ReferrerId   int               `json:"referrerId"`   // Referrer ID
+	Code         string            `json:"code"`         // Referral code
+	Name         string            `json:"name"`         // Name of the reseller or channel
+	Enable       bool              `json:"enable"`       // Whether new clients are attributed to the code
+	Clients      int               `json:"clients"`      // Clients attributed to the referrer
+	PaidClients  int               `json:"paidClients"`  // Attributed clients created by a payment
+	Revenue      []ReferralRevenue `json:"revenue"`      // Paid amounts by currency
+	LastReferral int64             `json:"lastReferral"` // Time of the last attribution in Unix milliseconds, 0 when none
+}
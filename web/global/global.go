@@ -17,11 +17,13 @@ var (
 type WebServer interface {
 	GetCron() *cron.Cron     // Get the cron scheduler
 	GetCtx() context.Context // Get the server context
+	ReloadCert() error       // Reload the TLS certificate from disk
 }
 
 // SubServer interface defines methods for accessing the subscription server instance.
 type SubServer interface {
 	GetCtx() context.Context // Get the server context
+	ReloadCert() error       // Reload the TLS certificate from disk
 }
 
 // SetWebServer sets the global web server instance.
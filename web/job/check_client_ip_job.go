@@ -15,11 +15,14 @@ import (
 	"github.com/mhsanaei/3x-ui/v2/database"
 	"github.com/mhsanaei/3x-ui/v2/database/model"
 	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
 	"github.com/mhsanaei/3x-ui/v2/xray"
 )
 
-// CheckClientIpJob monitors client IP addresses from access logs and manages IP blocking based on configured limits.
+// CheckClientIpJob monitors client IP addresses from access logs or the Xray online stats and
+// manages IP blocking based on configured limits.
 type CheckClientIpJob struct {
+	xrayService   service.XrayService
 	lastClear     int64
 	disAllowedIps []string
 }
@@ -39,25 +42,25 @@ func (j *CheckClientIpJob) Run() {
 
 	shouldClearAccessLog := false
 	iplimitActive := j.hasLimitIp()
+	speedLimitActive := j.hasSpeedLimit()
 	f2bInstalled := j.checkFail2BanInstalled()
-	isAccessLogAvailable := j.checkAccessLogAvailable(iplimitActive)
+	if iplimitActive && !f2bInstalled && runtime.GOOS != "windows" {
+		logger.Warning("[LimitIP] Fail2Ban is not installed, Please install Fail2Ban from the x-ui bash menu.")
+	}
+	// Client speed limits match the recorded IPs with tc, so they are recorded without Fail2Ban too
+	recordIps := speedLimitActive || (iplimitActive && (f2bInstalled || runtime.GOOS == "windows"))
 
-	if isAccessLogAvailable {
-		if runtime.GOOS == "windows" {
-			if iplimitActive {
-				shouldClearAccessLog = j.processLogFile()
-			}
-		} else {
-			if iplimitActive {
-				if f2bInstalled {
-					shouldClearAccessLog = j.processLogFile()
-				} else {
-					if !f2bInstalled {
-						logger.Warning("[LimitIP] Fail2Ban is not installed, Please install Fail2Ban from the x-ui bash menu.")
-					}
-				}
-			}
+	if j.xrayService.UsesOnlineStats() {
+		if recordIps {
+			j.processOnlineStats()
 		}
+		return
+	}
+
+	isAccessLogAvailable := j.checkAccessLogAvailable(iplimitActive, speedLimitActive)
+
+	if isAccessLogAvailable && recordIps {
+		shouldClearAccessLog = j.processLogFile()
 	}
 
 	if shouldClearAccessLog || (isAccessLogAvailable && time.Now().Unix()-j.lastClear > 3600) {
@@ -115,6 +118,38 @@ func (j *CheckClientIpJob) hasLimitIp() bool {
 	return false
 }
 
+// hasSpeedLimit reports whether speed limits are enabled and an enabled client has a speed limit
+// or is throttled at expiry, so the IPs of clients are needed to match their traffic.
+func (j *CheckClientIpJob) hasSpeedLimit() bool {
+	settingService := service.SettingService{}
+	if iface, err := settingService.GetSpeedLimitInterface(); err != nil || iface == "" {
+		return false
+	}
+
+	db := database.GetDB()
+	var inbounds []*model.Inbound
+	err := db.Model(model.Inbound{}).Where("enable = ?", true).Find(&inbounds).Error
+	if err != nil {
+		return false
+	}
+
+	for _, inbound := range inbounds {
+		if inbound.Settings == "" {
+			continue
+		}
+
+		settings := map[string][]model.Client{}
+		json.Unmarshal([]byte(inbound.Settings), &settings)
+		for _, client := range settings["clients"] {
+			if client.Enable && (client.SpeedLimit > 0 || client.ExpiryAction == service.ExpiryActionThrottle) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
 func (j *CheckClientIpJob) processLogFile() bool {
 
 	ipRegex := regexp.MustCompile(`from (?:tcp:|udp:)?\[?([0-9a-fA-F\.:]+)\]?:\d+ accepted`)
@@ -153,14 +188,41 @@ func (j *CheckClientIpJob) processLogFile() bool {
 		inboundClientIps[email][ip] = struct{}{}
 	}
 
-	shouldCleanLog := false
+	clientIps := make(map[string][]string, len(inboundClientIps))
 	for email, uniqueIps := range inboundClientIps {
-
 		ips := make([]string, 0, len(uniqueIps))
 		for ip := range uniqueIps {
 			ips = append(ips, ip)
 		}
 		sort.Strings(ips)
+		clientIps[email] = ips
+	}
+
+	return j.processClientIps(clientIps)
+}
+
+// processOnlineStats checks the IPs of the clients connected right now, as reported by the
+// Xray online stats, so the IP limit works without an access log.
+func (j *CheckClientIpJob) processOnlineStats() {
+	if !j.xrayService.IsXrayRunning() {
+		return
+	}
+	clientIps, err := j.xrayService.GetOnlineClientIps()
+	if err != nil {
+		logger.Warning("[LimitIP] get online client IPs from xray failed:", err)
+		return
+	}
+	j.processClientIps(clientIps)
+}
+
+// processClientIps stores the IPs seen for each client and logs the IPs over their limit for
+// Fail2Ban. It reports whether a client with an IP limit was seen.
+func (j *CheckClientIpJob) processClientIps(clientIps map[string][]string) bool {
+	shouldCleanLog := false
+	for email, ips := range clientIps {
+		if len(ips) == 0 {
+			continue
+		}
 
 		clientIpsRecord, err := j.getInboundClientIps(email)
 		if err != nil {
@@ -181,7 +243,7 @@ func (j *CheckClientIpJob) checkFail2BanInstalled() bool {
 	return err == nil
 }
 
-func (j *CheckClientIpJob) checkAccessLogAvailable(iplimitActive bool) bool {
+func (j *CheckClientIpJob) checkAccessLogAvailable(iplimitActive bool, speedLimitActive bool) bool {
 	accessLogPath, err := xray.GetAccessLogPath()
 	if err != nil {
 		return false
@@ -191,6 +253,9 @@ func (j *CheckClientIpJob) checkAccessLogAvailable(iplimitActive bool) bool {
 		if iplimitActive {
 			logger.Warning("[LimitIP] Access log path is not set, Please configure the access log path in Xray configs.")
 		}
+		if speedLimitActive {
+			logger.Warning("[SpeedLimit] Access log path is not set, client speed limits are not applied. Please configure the access log path in Xray configs or use the API online detection.")
+		}
 		return false
 	}
 
@@ -0,0 +1,23 @@
+package job
+
+import (
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+)
+
+// CheckPublicIPJob watches the public IP address of the server and handles changes.
+type CheckPublicIPJob struct {
+	publicIPService service.PublicIPService
+}
+
+// NewCheckPublicIPJob creates a new public IP check job instance.
+func NewCheckPublicIPJob() *CheckPublicIPJob {
+	return new(CheckPublicIPJob)
+}
+
+// Run detects the public IP address and updates DDNS, inbounds and subscriptions on a change.
+func (j *CheckPublicIPJob) Run() {
+	if _, err := j.publicIPService.CheckPublicIP(); err != nil {
+		logger.Warning("Public IP check failed:", err)
+	}
+}
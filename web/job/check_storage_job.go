@@ -0,0 +1,72 @@
+package job
+
+import (
+	"strconv"
+
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+)
+
+// CheckStorageJob watches the disk and inode usage of the data directory and the database size,
+// and alerts the Telegram admins once when a threshold is crossed.
+type CheckStorageJob struct {
+	tgbotService   service.Tgbot
+	settingService service.SettingService
+	serverService  service.ServerService
+
+	diskAlerted   bool
+	inodesAlerted bool
+	dbSizeAlerted bool
+}
+
+// NewCheckStorageJob creates a new storage monitoring job instance.
+func NewCheckStorageJob() *CheckStorageJob {
+	return new(CheckStorageJob)
+}
+
+// Run compares the storage status with the configured thresholds.
+func (j *CheckStorageJob) Run() {
+	status := j.serverService.GetStorageStatus()
+
+	diskThreshold, _ := j.settingService.GetTgDisk()
+	if diskThreshold > 0 && status.Total > 0 {
+		percent := float64(status.Current) * 100 / float64(status.Total)
+		over := percent > float64(diskThreshold)
+		if over && !j.diskAlerted {
+			j.alert("tgbot.messages.diskThreshold",
+				"Percent=="+strconv.FormatFloat(percent, 'f', 2, 64),
+				"Threshold=="+strconv.Itoa(diskThreshold))
+		}
+		j.diskAlerted = over
+	}
+	if diskThreshold > 0 && status.InodesTotal > 0 {
+		percent := float64(status.InodesCurrent) * 100 / float64(status.InodesTotal)
+		over := percent > float64(diskThreshold)
+		if over && !j.inodesAlerted {
+			j.alert("tgbot.messages.inodeThreshold",
+				"Percent=="+strconv.FormatFloat(percent, 'f', 2, 64),
+				"Threshold=="+strconv.Itoa(diskThreshold))
+		}
+		j.inodesAlerted = over
+	}
+
+	dbSizeThreshold, _ := j.settingService.GetTgDbSize()
+	if dbSizeThreshold > 0 {
+		size := (status.DbSize + status.WalSize) / 1024 / 1024
+		over := size > uint64(dbSizeThreshold)
+		if over && !j.dbSizeAlerted {
+			j.alert("tgbot.messages.dbSizeThreshold",
+				"Size=="+strconv.FormatUint(size, 10),
+				"Threshold=="+strconv.Itoa(dbSizeThreshold))
+		}
+		j.dbSizeAlerted = over
+	}
+}
+
+func (j *CheckStorageJob) alert(name string, params ...string) {
+	msg := j.tgbotService.I18nBot(name, params...)
+	logger.Warning(msg)
+	if j.tgbotService.IsRunning() {
+		j.tgbotService.SendMsgToTgbotAdmins(msg)
+	}
+}
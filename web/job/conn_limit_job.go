@@ -0,0 +1,23 @@
+package job
+
+import (
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+)
+
+// ConnLimitJob keeps the iptables rules in line with the connection limits of the inbounds.
+type ConnLimitJob struct {
+	connLimitService service.ConnLimitService
+}
+
+// NewConnLimitJob creates a new connection limit job instance.
+func NewConnLimitJob() *ConnLimitJob {
+	return new(ConnLimitJob)
+}
+
+// Run applies the current connection limits.
+func (j *ConnLimitJob) Run() {
+	if err := j.connLimitService.Apply(); err != nil {
+		logger.Warning("Apply connection limits failed:", err)
+	}
+}
@@ -0,0 +1,23 @@
+package job
+
+import (
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+)
+
+// FirewallJob keeps the firewall rules in line with the enabled inbounds.
+type FirewallJob struct {
+	firewallService service.FirewallService
+}
+
+// NewFirewallJob creates a new firewall job instance.
+func NewFirewallJob() *FirewallJob {
+	return new(FirewallJob)
+}
+
+// Run applies the current firewall rules.
+func (j *FirewallJob) Run() {
+	if err := j.firewallService.Apply(); err != nil {
+		logger.Warning("Apply firewall rules failed:", err)
+	}
+}
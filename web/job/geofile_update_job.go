@@ -0,0 +1,25 @@
+package job
+
+import (
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+)
+
+// GeofileUpdateJob downloads fresh geofiles, keeping the ad block lists current.
+type GeofileUpdateJob struct {
+	serverService service.ServerService
+}
+
+// NewGeofileUpdateJob creates a new geofile update job instance.
+func NewGeofileUpdateJob() *GeofileUpdateJob {
+	return new(GeofileUpdateJob)
+}
+
+// Run downloads all geofiles and restarts Xray to load them.
+func (j *GeofileUpdateJob) Run() {
+	if err := j.serverService.UpdateGeofile(""); err != nil {
+		logger.Warning("Geofile update failed:", err)
+		return
+	}
+	logger.Info("Geofiles updated")
+}
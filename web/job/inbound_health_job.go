@@ -0,0 +1,23 @@
+package job
+
+import (
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+)
+
+// InboundHealthJob checks that the inbounds accept connections.
+type InboundHealthJob struct {
+	inboundHealthService service.InboundHealthService
+}
+
+// NewInboundHealthJob creates a new inbound health check job instance.
+func NewInboundHealthJob() *InboundHealthJob {
+	return new(InboundHealthJob)
+}
+
+// Run checks the health of all enabled inbounds.
+func (j *InboundHealthJob) Run() {
+	if err := j.inboundHealthService.Check(); err != nil {
+		logger.Warning("Inbound health check failed:", err)
+	}
+}
@@ -0,0 +1,23 @@
+package job
+
+import (
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+)
+
+// MaintenanceJob runs the daily database maintenance.
+type MaintenanceJob struct {
+	maintenanceService service.MaintenanceService
+}
+
+// NewMaintenanceJob creates a new database maintenance job instance.
+func NewMaintenanceJob() *MaintenanceJob {
+	return new(MaintenanceJob)
+}
+
+// Run prunes and compacts the database.
+func (j *MaintenanceJob) Run() {
+	if _, err := j.maintenanceService.RunMaintenance(); err != nil {
+		logger.Warning("Database maintenance failed:", err)
+	}
+}
@@ -0,0 +1,33 @@
+package job
+
+import (
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+)
+
+// NaiveJob keeps the NaiveProxy forward proxy in line with the settings and clients and counts
+// its traffic to the clients.
+type NaiveJob struct {
+	naiveService service.NaiveService
+	xrayService  service.XrayService
+}
+
+// NewNaiveJob creates a new NaiveProxy job instance.
+func NewNaiveJob() *NaiveJob {
+	return new(NaiveJob)
+}
+
+// Run counts the traffic of the forward proxy and then starts, stops or restarts it so clients
+// disabled by the traffic they made lose their account.
+func (j *NaiveJob) Run() {
+	needRestart, err := j.naiveService.CollectTraffic()
+	if err != nil {
+		logger.Warning("Collecting naive traffic failed:", err)
+	}
+	if needRestart {
+		j.xrayService.SetToNeedRestart()
+	}
+	if err := j.naiveService.Sync(); err != nil {
+		logger.Warning("Syncing the naive forward proxy failed:", err)
+	}
+}
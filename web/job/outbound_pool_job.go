@@ -0,0 +1,28 @@
+package job
+
+import (
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+)
+
+// OutboundPoolJob refetches the subscriptions of outbound pools once their interval has passed.
+type OutboundPoolJob struct {
+	outboundPoolService service.OutboundPoolService
+	xrayService         service.XrayService
+}
+
+// NewOutboundPoolJob creates a new outbound pool refresh job instance.
+func NewOutboundPoolJob() *OutboundPoolJob {
+	return new(OutboundPoolJob)
+}
+
+// Run refreshes the due pools and restarts Xray when their outbounds changed.
+func (j *OutboundPoolJob) Run() {
+	changed, err := j.outboundPoolService.RefreshDuePools()
+	if err != nil {
+		logger.Warning("Outbound pool refresh failed:", err)
+	}
+	if changed {
+		j.xrayService.SetToNeedRestart()
+	}
+}
@@ -0,0 +1,29 @@
+package job
+
+import (
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+)
+
+// OutboundProbeJob measures the latency and availability of the servers of the outbounds.
+type OutboundProbeJob struct {
+	outboundProbeService service.OutboundProbeService
+	xrayService          service.XrayService
+}
+
+// NewOutboundProbeJob creates a new outbound probe job instance.
+func NewOutboundProbeJob() *OutboundProbeJob {
+	return new(OutboundProbeJob)
+}
+
+// Run probes the outbounds and restarts Xray when failing outbounds have to be taken out of
+// their balancers or put back.
+func (j *OutboundProbeJob) Run() {
+	_, changed, err := j.outboundProbeService.ProbeOutbounds()
+	if err != nil {
+		logger.Warning("Outbound probe failed:", err)
+	}
+	if changed {
+		j.xrayService.SetToNeedRestart()
+	}
+}
@@ -0,0 +1,28 @@
+package job
+
+import (
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+)
+
+// PortHopJob moves inbounds with port hopping to a new port once their hop interval has passed.
+type PortHopJob struct {
+	inboundService service.InboundService
+	xrayService    service.XrayService
+}
+
+// NewPortHopJob creates a new port hopping job instance.
+func NewPortHopJob() *PortHopJob {
+	return new(PortHopJob)
+}
+
+// Run hops the ports of all inbounds that are due.
+func (j *PortHopJob) Run() {
+	needRestart, err := j.inboundService.HopPorts()
+	if err != nil {
+		logger.Warning("Port hopping failed:", err)
+	}
+	if needRestart {
+		j.xrayService.SetToNeedRestart()
+	}
+}
@@ -0,0 +1,28 @@
+package job
+
+import (
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+)
+
+// RealityCheckJob checks the targets of the REALITY inbounds.
+type RealityCheckJob struct {
+	realityCheckService service.RealityCheckService
+	xrayService         service.XrayService
+}
+
+// NewRealityCheckJob creates a new REALITY target check job instance.
+func NewRealityCheckJob() *RealityCheckJob {
+	return new(RealityCheckJob)
+}
+
+// Run checks the REALITY targets and restarts Xray when a target was replaced.
+func (j *RealityCheckJob) Run() {
+	needRestart, err := j.realityCheckService.Check()
+	if err != nil {
+		logger.Warning("REALITY target check failed:", err)
+	}
+	if needRestart {
+		j.xrayService.SetToNeedRestart()
+	}
+}
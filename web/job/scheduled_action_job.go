@@ -0,0 +1,23 @@
+package job
+
+import (
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+)
+
+// ScheduledActionJob runs the scheduled actions whose time has come.
+type ScheduledActionJob struct {
+	scheduleService service.ScheduleService
+}
+
+// NewScheduledActionJob creates a new scheduled action job instance.
+func NewScheduledActionJob() *ScheduledActionJob {
+	return new(ScheduledActionJob)
+}
+
+// Run runs the due scheduled actions.
+func (j *ScheduledActionJob) Run() {
+	if err := j.scheduleService.RunDueActions(); err != nil {
+		logger.Warning("Running scheduled actions failed:", err)
+	}
+}
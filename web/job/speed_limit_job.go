@@ -0,0 +1,23 @@
+package job
+
+import (
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+)
+
+// SpeedLimitJob keeps the traffic control rules in line with the inbound and client speed limits.
+type SpeedLimitJob struct {
+	speedLimitService service.SpeedLimitService
+}
+
+// NewSpeedLimitJob creates a new speed limit job instance.
+func NewSpeedLimitJob() *SpeedLimitJob {
+	return new(SpeedLimitJob)
+}
+
+// Run applies the current speed limits. Client IPs change over time, so this runs periodically.
+func (j *SpeedLimitJob) Run() {
+	if err := j.speedLimitService.Apply(); err != nil {
+		logger.Warning("Apply speed limits failed:", err)
+	}
+}
@@ -0,0 +1,33 @@
+package job
+
+import (
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+)
+
+// SSHTunnelJob keeps the SSH tunnel server in line with the settings and clients and counts
+// its traffic to the clients.
+type SSHTunnelJob struct {
+	sshTunnelService service.SSHTunnelService
+	xrayService      service.XrayService
+}
+
+// NewSSHTunnelJob creates a new SSH tunnel job instance.
+func NewSSHTunnelJob() *SSHTunnelJob {
+	return new(SSHTunnelJob)
+}
+
+// Run counts the forwarded traffic and then updates the server so clients disabled by the
+// traffic they made lose their account.
+func (j *SSHTunnelJob) Run() {
+	needRestart, err := j.sshTunnelService.CollectTraffic()
+	if err != nil {
+		logger.Warning("Collecting SSH tunnel traffic failed:", err)
+	}
+	if needRestart {
+		j.xrayService.SetToNeedRestart()
+	}
+	if err := j.sshTunnelService.Sync(); err != nil {
+		logger.Warning("Syncing the SSH tunnel server failed:", err)
+	}
+}
@@ -0,0 +1,24 @@
+package job
+
+import (
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+)
+
+// TunnelJob keeps the tunnel the panel is published through in line with the settings and
+// restarts it when it exited.
+type TunnelJob struct {
+	tunnelService service.TunnelService
+}
+
+// NewTunnelJob creates a new tunnel job instance.
+func NewTunnelJob() *TunnelJob {
+	return new(TunnelJob)
+}
+
+// Run starts, stops or restarts the tunnel.
+func (j *TunnelJob) Run() {
+	if err := j.tunnelService.Sync(); err != nil {
+		logger.Warning("Syncing the panel tunnel failed:", err)
+	}
+}
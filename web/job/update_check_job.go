@@ -0,0 +1,23 @@
+package job
+
+import (
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+)
+
+// UpdateCheckJob looks for new panel and Xray releases.
+type UpdateCheckJob struct {
+	updateCheckService service.UpdateCheckService
+}
+
+// NewUpdateCheckJob creates a new update check job instance.
+func NewUpdateCheckJob() *UpdateCheckJob {
+	return new(UpdateCheckJob)
+}
+
+// Run checks for new releases, notifying the Telegram admins when enabled.
+func (j *UpdateCheckJob) Run() {
+	if _, err := j.updateCheckService.Check(); err != nil {
+		logger.Warning("Update check failed:", err)
+	}
+}
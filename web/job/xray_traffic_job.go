@@ -40,12 +40,21 @@ func (j *XrayTrafficJob) Run() {
 	if err != nil {
 		logger.Warning("add outbound traffic failed:", err)
 	}
+	if j.xrayService.UsesOnlineStats() {
+		if err := j.xrayService.RefreshOnlineClients(); err != nil {
+			logger.Warning("get online clients from xray failed:", err)
+		}
+	}
+	needRestart2, err := j.inboundService.ApplyExpiryActions()
+	if err != nil {
+		logger.Warning("apply expiry actions failed:", err)
+	}
 	if ExternalTrafficInformEnable, err := j.settingService.GetExternalTrafficInformEnable(); ExternalTrafficInformEnable {
 		j.informTrafficToExternalAPI(traffics, clientTraffics)
 	} else if err != nil {
 		logger.Warning("get ExternalTrafficInformEnable failed:", err)
 	}
-	if needRestart0 || needRestart1 {
+	if needRestart0 || needRestart1 || needRestart2 {
 		j.xrayService.SetToNeedRestart()
 	}
 }
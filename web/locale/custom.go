@@ -0,0 +1,216 @@
+package locale
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mhsanaei/3x-ui/v2/config"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+// maxCustomTranslationSize limits the size of an uploaded translation bundle.
+const maxCustomTranslationSize = 1 << 20
+
+// LanguageInfo describes a language the panel can be shown in.
+type LanguageInfo struct {
+	Tag     string `json:"tag"`     // Language tag, e.g. en-US
+	Name    string `json:"name"`    // Name of the language in itself
+	BuiltIn bool   `json:"builtIn"` // Whether the panel ships a translation for this language
+	Custom  bool   `json:"custom"`  // Whether an uploaded bundle overrides or adds messages
+}
+
+// getCustomTranslationDir returns the folder holding the uploaded translation bundles.
+func getCustomTranslationDir() string {
+	return filepath.Join(config.GetDBFolderPath(), "translation")
+}
+
+// getCustomTranslationPath returns the file of the uploaded translation bundle for a language tag.
+func getCustomTranslationPath(tag string) string {
+	return filepath.Join(getCustomTranslationDir(), "translate."+tag+".json")
+}
+
+// ParseLanguage validates a language tag and returns it in canonical form.
+func ParseLanguage(lang string) (string, error) {
+	tag, err := language.Parse(strings.ReplaceAll(lang, "_", "-"))
+	if err != nil || tag == language.Und {
+		return "", common.NewErrorf("invalid language tag: %s", lang)
+	}
+	return tag.String(), nil
+}
+
+// parseCustomTranslations adds the uploaded translation bundles to the i18n bundle
+// and returns the language tags that have one.
+func parseCustomTranslations(bundle *i18n.Bundle, messages map[string]map[string]string) (map[string]bool, error) {
+	custom := make(map[string]bool)
+	files, err := filepath.Glob(filepath.Join(getCustomTranslationDir(), "translate.*.json"))
+	if err != nil {
+		return custom, err
+	}
+	var errs []string
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		file, err := bundle.ParseMessageFileBytes(data, path)
+		if err != nil {
+			errs = append(errs, filepath.Base(path)+": "+err.Error())
+			continue
+		}
+		raw := map[string]any{}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			errs = append(errs, filepath.Base(path)+": "+err.Error())
+			continue
+		}
+		tag := file.Tag.String()
+		addMessages(messages, tag, raw)
+		custom[tag] = true
+	}
+	if len(errs) > 0 {
+		return custom, common.NewError(strings.Join(errs, "; "))
+	}
+	return custom, nil
+}
+
+// addMessages flattens nested translation maps into dotted message IDs.
+func addMessages(messages map[string]map[string]string, tag string, raw map[string]any) {
+	if messages[tag] == nil {
+		messages[tag] = make(map[string]string)
+	}
+	var walk func(prefix string, m map[string]any)
+	walk = func(prefix string, m map[string]any) {
+		for k, v := range m {
+			id := k
+			if prefix != "" {
+				id = prefix + "." + k
+			}
+			switch v := v.(type) {
+			case string:
+				messages[tag][id] = v
+			case map[string]any:
+				// Plural forms are kept by their "other" form
+				if other, ok := v["other"].(string); ok {
+					messages[tag][id] = other
+				} else {
+					walk(id, v)
+				}
+			}
+		}
+	}
+	walk("", raw)
+}
+
+// GetLanguages returns the built-in languages and the ones registered by uploaded bundles.
+func GetLanguages() []LanguageInfo {
+	bundle := getBundle()
+	bundleMu.RLock()
+	defer bundleMu.RUnlock()
+
+	languages := make([]LanguageInfo, 0, len(bundle.LanguageTags()))
+	for _, tag := range bundle.LanguageTags() {
+		name := display.Self.Name(tag)
+		if name == "" {
+			name = tag.String()
+		}
+		languages = append(languages, LanguageInfo{
+			Tag:     tag.String(),
+			Name:    name,
+			BuiltIn: builtInLanguage[tag.String()],
+			Custom:  customLanguage[tag.String()],
+		})
+	}
+	sort.Slice(languages, func(i, j int) bool { return languages[i].Tag < languages[j].Tag })
+	return languages
+}
+
+// GetCustomLanguages returns the languages registered by uploaded bundles that the panel does not ship.
+func GetCustomLanguages() []LanguageInfo {
+	var languages []LanguageInfo
+	for _, lang := range GetLanguages() {
+		if !lang.BuiltIn {
+			languages = append(languages, lang)
+		}
+	}
+	return languages
+}
+
+// GetMessages returns the messages in effect for a language, the English ones overridden by the
+// built-in and the uploaded translations. Only IDs starting with prefix are returned when it is set.
+func GetMessages(lang string, prefix string) (map[string]string, error) {
+	tag, err := ParseLanguage(lang)
+	if err != nil {
+		return nil, err
+	}
+	getBundle()
+	bundleMu.RLock()
+	defer bundleMu.RUnlock()
+	if _, ok := translations[tag]; !ok {
+		return nil, common.NewErrorf("unknown language: %s", tag)
+	}
+
+	messages := make(map[string]string)
+	for _, source := range []string{"en-US", tag} {
+		for id, text := range translations[source] {
+			if strings.HasPrefix(id, prefix) {
+				messages[id] = text
+			}
+		}
+	}
+	return messages, nil
+}
+
+// SaveCustomTranslation stores an uploaded JSON translation bundle for a language and reloads the
+// translations. Message IDs may be nested objects or dotted keys; a new language tag registers a new
+// language, falling back to English for missing messages.
+func SaveCustomTranslation(lang string, data []byte) error {
+	tag, err := ParseLanguage(lang)
+	if err != nil {
+		return err
+	}
+	if len(data) > maxCustomTranslationSize {
+		return common.NewErrorf("translation bundle is larger than %d bytes", maxCustomTranslationSize)
+	}
+	// Check the bundle parses before it can break the reload
+	raw := map[string]any{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return common.NewError("invalid translation bundle:", err)
+	}
+	if len(raw) == 0 {
+		return common.NewError("translation bundle is empty")
+	}
+	check := i18n.NewBundle(language.MustParse("en-US"))
+	if _, err := check.ParseMessageFileBytes(data, "translate."+tag+".json"); err != nil {
+		return common.NewError("invalid translation bundle:", err)
+	}
+
+	if err := os.MkdirAll(getCustomTranslationDir(), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(getCustomTranslationPath(tag), data, 0o644); err != nil {
+		return err
+	}
+	return reloadBundle()
+}
+
+// DeleteCustomTranslation removes the uploaded translation bundle of a language and reloads the translations.
+func DeleteCustomTranslation(lang string) error {
+	tag, err := ParseLanguage(lang)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(getCustomTranslationPath(tag)); err != nil {
+		if os.IsNotExist(err) {
+			return common.NewErrorf("no custom translation for %s", tag)
+		}
+		return err
+	}
+	return reloadBundle()
+}
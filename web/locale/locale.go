@@ -7,6 +7,7 @@ import (
 	"io/fs"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/mhsanaei/3x-ui/v2/logger"
 
@@ -20,6 +21,13 @@ var (
 	i18nBundle   *i18n.Bundle
 	LocalizerWeb *i18n.Localizer
 	LocalizerBot *i18n.Localizer
+
+	bundleMu        sync.RWMutex
+	translationFS   fs.FS // Built-in translation files, nil falls back to the local web directory
+	botSettings     SettingService
+	translations    map[string]map[string]string // Flattened messages by language tag, for export
+	builtInLanguage map[string]bool              // Language tags shipped with the panel
+	customLanguage  map[string]bool              // Language tags with an uploaded custom bundle
 )
 
 // I18nType represents the type of interface for internationalization.
@@ -36,24 +44,83 @@ type SettingService interface {
 }
 
 // InitLocalizer initializes the internationalization system with embedded translation files.
+// Custom translation bundles uploaded through the settings API are loaded on top of the built-in ones.
 func InitLocalizer(i18nFS embed.FS, settingService SettingService) error {
+	bundleMu.Lock()
+	translationFS = i18nFS
+	botSettings = settingService
+	bundleMu.Unlock()
+
+	return reloadBundle()
+}
+
+// reloadBundle rebuilds the bundle from the built-in and the custom translation files and swaps it in.
+func reloadBundle() error {
+	bundleMu.RLock()
+	builtin := translationFS
+	bundleMu.RUnlock()
+	if builtin == nil {
+		builtin = os.DirFS("web")
+	}
+
 	// set default bundle to english
-	i18nBundle = i18n.NewBundle(language.MustParse("en-US"))
-	i18nBundle.RegisterUnmarshalFunc("toml", toml.Unmarshal)
+	bundle := i18n.NewBundle(language.MustParse("en-US"))
+	bundle.RegisterUnmarshalFunc("toml", toml.Unmarshal)
+	messages := make(map[string]map[string]string)
 
 	// parse files
-	if err := parseTranslationFiles(i18nFS, i18nBundle); err != nil {
+	if err := parseTranslationFiles(builtin, bundle, messages); err != nil {
 		return err
 	}
+	builtIn := make(map[string]bool, len(messages))
+	for tag := range messages {
+		builtIn[tag] = true
+	}
+	custom, err := parseCustomTranslations(bundle, messages)
+	if err != nil {
+		// A broken custom bundle must not keep the panel from starting
+		logger.Warning("i18n custom translations:", err)
+	}
+
+	bundleMu.Lock()
+	i18nBundle = bundle
+	translations = messages
+	builtInLanguage = builtIn
+	customLanguage = custom
+	settingService := botSettings
+	bundleMu.Unlock()
 
 	// setup bot locale
-	if err := initTGBotLocalizer(settingService); err != nil {
-		return err
+	if settingService != nil {
+		if err := initTGBotLocalizer(settingService); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// getBundle returns the current bundle, loading it from disk when the localizer was never initialized.
+func getBundle() *i18n.Bundle {
+	bundleMu.RLock()
+	bundle := i18nBundle
+	bundleMu.RUnlock()
+	if bundle != nil {
+		return bundle
+	}
+	// Try lazy-load from disk when running sub server without InitLocalizer
+	if err := reloadBundle(); err != nil {
+		logger.Warning("i18n lazy load failed:", err)
+	}
+	bundleMu.Lock()
+	defer bundleMu.Unlock()
+	if i18nBundle == nil {
+		// Ensure bundle is initialized so creating a Localizer won't panic
+		i18nBundle = i18n.NewBundle(language.MustParse("en-US"))
+	}
+	return i18nBundle
+}
+
 // createTemplateData creates a template data map from parameters with optional separator.
 func createTemplateData(params []string, separator ...string) map[string]any {
 	var sep string = "=="
@@ -112,7 +179,7 @@ func initTGBotLocalizer(settingService SettingService) error {
 		return err
 	}
 
-	LocalizerBot = i18n.NewLocalizer(i18nBundle, botLang)
+	LocalizerBot = i18n.NewLocalizer(getBundle(), botLang)
 	return nil
 }
 
@@ -122,15 +189,6 @@ func initTGBotLocalizer(settingService SettingService) error {
 // Also provides the I18n function in the context for template rendering.
 func LocalizerMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Ensure bundle is initialized so creating a Localizer won't panic
-		if i18nBundle == nil {
-			i18nBundle = i18n.NewBundle(language.MustParse("en-US"))
-			i18nBundle.RegisterUnmarshalFunc("toml", toml.Unmarshal)
-			// Try lazy-load from disk when running sub server without InitLocalizer
-			if err := loadTranslationsFromDisk(i18nBundle); err != nil {
-				logger.Warning("i18n lazy load failed:", err)
-			}
-		}
 		var lang string
 
 		if cookie, err := c.Request.Cookie("lang"); err == nil {
@@ -139,7 +197,7 @@ func LocalizerMiddleware() gin.HandlerFunc {
 			lang = c.GetHeader("Accept-Language")
 		}
 
-		LocalizerWeb = i18n.NewLocalizer(i18nBundle, lang)
+		LocalizerWeb = i18n.NewLocalizer(getBundle(), lang)
 
 		c.Set("localizer", LocalizerWeb)
 		c.Set("I18n", I18n)
@@ -147,27 +205,9 @@ func LocalizerMiddleware() gin.HandlerFunc {
 	}
 }
 
-// loadTranslationsFromDisk attempts to load translation files from "web/translation" using the local filesystem.
-func loadTranslationsFromDisk(bundle *i18n.Bundle) error {
-	root := os.DirFS("web")
-	return fs.WalkDir(root, "translation", func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if d.IsDir() {
-			return nil
-		}
-		data, err := fs.ReadFile(root, path)
-		if err != nil {
-			return err
-		}
-		_, err = bundle.ParseMessageFileBytes(data, path)
-		return err
-	})
-}
-
-// parseTranslationFiles parses embedded translation files and adds them to the i18n bundle.
-func parseTranslationFiles(i18nFS embed.FS, i18nBundle *i18n.Bundle) error {
+// parseTranslationFiles parses the built-in translation files, adds them to the i18n bundle
+// and records their flattened messages by language tag.
+func parseTranslationFiles(i18nFS fs.FS, i18nBundle *i18n.Bundle, messages map[string]map[string]string) error {
 	err := fs.WalkDir(i18nFS, "translation",
 		func(path string, d fs.DirEntry, err error) error {
 			if err != nil {
@@ -178,13 +218,21 @@ func parseTranslationFiles(i18nFS embed.FS, i18nBundle *i18n.Bundle) error {
 				return nil
 			}
 
-			data, err := i18nFS.ReadFile(path)
+			data, err := fs.ReadFile(i18nFS, path)
 			if err != nil {
 				return err
 			}
 
-			_, err = i18nBundle.ParseMessageFileBytes(data, path)
-			return err
+			file, err := i18nBundle.ParseMessageFileBytes(data, path)
+			if err != nil {
+				return err
+			}
+			raw := map[string]any{}
+			if err := toml.Unmarshal(data, &raw); err != nil {
+				return err
+			}
+			addMessages(messages, file.Tag.String(), raw)
+			return nil
 		})
 	if err != nil {
 		return err
@@ -34,6 +34,7 @@ func ApiKeyAuth() gin.HandlerFunc {
 			if err == nil && user != nil {
 				// Set the user in session for this request
 				session.SetLoginUser(c, user)
+				c.Set("api_key_auth", true)
 				c.Next()
 				return
 			}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+	"github.com/mhsanaei/3x-ui/v2/web/locale"
+
+	"github.com/gin-gonic/gin"
+)
+
+// API versions. Version 1 is the legacy route group under /panel/api, version 2 the REST route group under /panel/api/v2.
+const (
+	ApiVersionLegacy  = 1
+	ApiVersionCurrent = 2
+)
+
+// ApiVersionHeader is the request and response header carrying the API version.
+const ApiVersionHeader = "X-API-Version"
+
+// Deprecation and sunset of the legacy API. Legacy routes keep working unchanged until the sunset date.
+var (
+	ApiLegacyDeprecation = time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC)
+	ApiLegacySunset      = time.Date(2027, time.October, 16, 0, 0, 0, 0, time.UTC)
+)
+
+// ApiVersionMiddleware serves a route group as the given API version. Every response carries the
+// version in the X-API-Version header. A client pinning another version with the same request
+// header is rejected, so it never silently talks to a different version than it was written for.
+// Responses of the legacy version carry Deprecation, Sunset and successor Link headers.
+func ApiVersionMiddleware(version int) gin.HandlerFunc {
+	served := strconv.Itoa(version)
+	return func(c *gin.Context) {
+		c.Header(ApiVersionHeader, served)
+		if version == ApiVersionLegacy {
+			c.Header("Deprecation", "@"+strconv.FormatInt(ApiLegacyDeprecation.Unix(), 10))
+			c.Header("Sunset", ApiLegacySunset.Format(http.TimeFormat))
+			c.Header("Link", "<"+c.GetString("base_path")+"panel/api/v"+strconv.Itoa(ApiVersionCurrent)+">; rel=\"successor-version\"")
+		}
+
+		requested := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(c.GetHeader(ApiVersionHeader))), "v")
+		if requested != "" && requested != served {
+			c.AbortWithStatusJSON(http.StatusBadRequest, entity.Msg{
+				Success: false,
+				Msg:     locale.I18n(locale.Web, "errors."+common.ErrCodeApiVersion),
+				Code:    common.ErrCodeApiVersion,
+				Details: map[string]any{"requested": requested, "served": version},
+			})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// cloudflareRanges are the address ranges Cloudflare connects from, as published at https://www.cloudflare.com/ips/.
+var cloudflareRanges = parseCIDRs(
+	"173.245.48.0/20", "103.21.244.0/22", "103.22.200.0/22", "103.31.4.0/22",
+	"141.101.64.0/18", "108.162.192.0/18", "190.93.240.0/20", "188.114.96.0/20",
+	"197.234.240.0/22", "198.41.128.0/17", "162.158.0.0/15", "104.16.0.0/13",
+	"104.24.0.0/14", "172.64.0.0/13", "131.0.72.0/22",
+	"2400:cb00::/32", "2606:4700::/32", "2803:f800::/32", "2405:b500::/32",
+	"2405:8100::/32", "2a06:98c0::/29", "2c0f:f248::/32",
+)
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}
+
+// IsCloudflareIP reports whether an address belongs to Cloudflare.
+func IsCloudflareIP(ip net.IP) bool {
+	for _, ipNet := range cloudflareRanges {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// remotePeerIP returns the address of the direct peer of a request, ignoring any forwarding headers.
+// A peer on a unix socket is a reverse proxy on the same host, so it is reported as the loopback address.
+func remotePeerIP(c *gin.Context) net.IP {
+	if addr, ok := c.Request.Context().Value(http.LocalAddrContextKey).(net.Addr); ok && addr.Network() == "unix" {
+		return net.IPv4(127, 0, 0, 1)
+	}
+	host, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+	if err != nil {
+		host = c.Request.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// RealClientIP returns the address of the client behind a request. Forwarding headers are only
+// trusted from Cloudflare (CF-Connecting-IP) and from a reverse proxy on a loopback or private address
+// or a unix socket.
+func RealClientIP(c *gin.Context) string {
+	peer := remotePeerIP(c)
+	if peer == nil {
+		return c.Request.RemoteAddr
+	}
+	if IsCloudflareIP(peer) {
+		if ip := net.ParseIP(strings.TrimSpace(c.GetHeader("CF-Connecting-IP"))); ip != nil {
+			return ip.String()
+		}
+	}
+	if peer.IsLoopback() || peer.IsPrivate() {
+		if ip := net.ParseIP(strings.TrimSpace(c.GetHeader("X-Real-IP"))); ip != nil {
+			return ip.String()
+		}
+		forwarded, _, _ := strings.Cut(c.GetHeader("X-Forwarded-For"), ",")
+		if ip := net.ParseIP(strings.TrimSpace(forwarded)); ip != nil {
+			return ip.String()
+		}
+	}
+	return peer.String()
+}
+
+// CloudflareOnlyMiddleware rejects connections that do not come from Cloudflare, so an origin
+// behind the Cloudflare proxy cannot be reached directly. Loopback and unix socket connections are
+// still allowed.
+func CloudflareOnlyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		peer := remotePeerIP(c)
+		if peer == nil || !(IsCloudflareIP(peer) || peer.IsLoopback()) {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		c.Next()
+	}
+}
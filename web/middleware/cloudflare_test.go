@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newClientIPEngine returns an engine answering /ip with the client IP of the request.
+func newClientIPEngine(middlewares ...gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(middlewares...)
+	engine.GET("/ip", func(c *gin.Context) { c.String(http.StatusOK, RealClientIP(c)) })
+	return engine
+}
+
+// serveUnix serves the engine on a unix socket and returns a client connecting to it.
+func serveUnix(t *testing.T, engine *gin.Engine) *http.Client {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "panel.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: engine}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", path)
+		},
+	}}
+}
+
+func getClientIP(t *testing.T, client *http.Client, header http.Header) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, "http://panel/ip", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header = header
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestRealClientIP(t *testing.T) {
+	tests := []struct {
+		name   string
+		remote string
+		header http.Header
+		want   string
+	}{
+		{"direct", "203.0.113.7:4000", nil, "203.0.113.7"},
+		{"untrusted forwarded", "203.0.113.7:4000", http.Header{"X-Real-Ip": {"198.51.100.1"}}, "203.0.113.7"},
+		{"loopback proxy", "127.0.0.1:4000", http.Header{"X-Real-Ip": {"198.51.100.1"}}, "198.51.100.1"},
+		{"private proxy", "10.0.0.2:4000", http.Header{"X-Forwarded-For": {"198.51.100.1, 10.0.0.3"}}, "198.51.100.1"},
+		{"cloudflare", "104.16.0.1:4000", http.Header{"Cf-Connecting-Ip": {"198.51.100.1"}}, "198.51.100.1"},
+	}
+	engine := newClientIPEngine()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/ip", nil)
+			req.RemoteAddr = test.remote
+			for key, values := range test.header {
+				req.Header[key] = values
+			}
+			rec := httptest.NewRecorder()
+			engine.ServeHTTP(rec, req)
+			if rec.Body.String() != test.want {
+				t.Errorf("got %q, want %q", rec.Body.String(), test.want)
+			}
+		})
+	}
+}
+
+func TestRealClientIPUnixSocket(t *testing.T) {
+	client := serveUnix(t, newClientIPEngine(CloudflareOnlyMiddleware()))
+
+	status, ip := getClientIP(t, client, http.Header{"X-Real-Ip": {"198.51.100.1"}})
+	if status != http.StatusOK || ip != "198.51.100.1" {
+		t.Errorf("X-Real-IP over the socket: got %d %q, want 200 \"198.51.100.1\"", status, ip)
+	}
+	status, ip = getClientIP(t, client, http.Header{"X-Forwarded-For": {"198.51.100.2, 10.0.0.3"}})
+	if status != http.StatusOK || ip != "198.51.100.2" {
+		t.Errorf("X-Forwarded-For over the socket: got %d %q, want 200 \"198.51.100.2\"", status, ip)
+	}
+	status, ip = getClientIP(t, client, nil)
+	if status != http.StatusOK || ip != "127.0.0.1" {
+		t.Errorf("no forwarding headers over the socket: got %d %q, want 200 \"127.0.0.1\"", status, ip)
+	}
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCompressMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(CompressMiddleware())
+	engine.GET("/plain", func(c *gin.Context) { c.String(http.StatusOK, "body") })
+	engine.GET("/signed", func(c *gin.Context) {
+		c.Header("Cache-Control", "private, no-transform")
+		c.String(http.StatusOK, "body")
+	})
+
+	tests := []struct {
+		path     string
+		encoding string
+		body     string
+	}{
+		{"/plain", "gzip", ""},
+		{"/signed", "", "body"},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, test.path, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, req)
+		if got := rec.Header().Get("Content-Encoding"); got != test.encoding {
+			t.Errorf("%s: Content-Encoding %q, want %q", test.path, got, test.encoding)
+		}
+		if test.body != "" && rec.Body.String() != test.body {
+			t.Errorf("%s: body %q, want %q", test.path, rec.Body.String(), test.body)
+		}
+	}
+}
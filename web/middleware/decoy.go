@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+// nginxWelcomePage is the page a fresh nginx install serves at its root.
+const nginxWelcomePage = `<!DOCTYPE html>
+<html>
+<head>
+<title>Welcome to nginx!</title>
+<style>
+html { color-scheme: light dark; }
+body { width: 35em; margin: 0 auto;
+font-family: Tahoma, Verdana, Arial, sans-serif; }
+</style>
+</head>
+<body>
+<h1>Welcome to nginx!</h1>
+<p>If you see this page, the nginx web server is successfully installed and
+working. Further configuration is required.</p>
+
+<p>For online documentation and support please refer to
+<a href="http://nginx.org/">nginx.org</a>.<br/>
+Commercial support is available at
+<a href="http://nginx.com/">nginx.com</a>.</p>
+
+<p><em>Thank you for using nginx.</em></p>
+</body>
+</html>
+`
+
+// nginxNotFoundPage is the 404 page of nginx.
+const nginxNotFoundPage = `<html>
+<head><title>404 Not Found</title></head>
+<body>
+<center><h1>404 Not Found</h1></center>
+<hr><center>nginx</center>
+</body>
+</html>
+`
+
+// DecoyHandler returns the handler answering requests with the decoy of the mode: "nginx" for
+// the pages of a default nginx install, "proxy" for the site at the target URL and "drop" to
+// close the connection without an answer. Nil is returned for any other mode.
+func DecoyHandler(mode string, target string) gin.HandlerFunc {
+	switch mode {
+	case "nginx":
+		return func(c *gin.Context) {
+			c.Header("Server", "nginx")
+			if c.Request.URL.Path == "/" || c.Request.URL.Path == "/index.html" {
+				c.Data(http.StatusOK, "text/html", []byte(nginxWelcomePage))
+			} else {
+				c.Data(http.StatusNotFound, "text/html", []byte(nginxNotFoundPage))
+			}
+			c.Abort()
+		}
+	case "proxy":
+		u, err := url.Parse(target)
+		if err != nil || u.Host == "" {
+			return nil
+		}
+		proxy := httputil.NewSingleHostReverseProxy(u)
+		director := proxy.Director
+		proxy.Director = func(req *http.Request) {
+			director(req)
+			req.Host = u.Host
+		}
+		return func(c *gin.Context) {
+			proxy.ServeHTTP(c.Writer, c.Request)
+			c.Abort()
+		}
+	case "drop":
+		return DropConnection
+	}
+	return nil
+}
+
+// DropConnection closes the connection of the request without sending anything, like the 444
+// status of nginx. Connections that can not be taken over get an empty 444 answer instead.
+func DropConnection(c *gin.Context) {
+	c.Abort()
+	if conn, _, err := c.Writer.Hijack(); err == nil {
+		conn.Close()
+		return
+	}
+	c.Status(444)
+}
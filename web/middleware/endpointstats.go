@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// EndpointRecorder records a request answered by a server: the route it matched, empty when
+// none did, the subscription ID in its path, the client address, the status and the number of
+// body bytes sent.
+type EndpointRecorder func(endpoint string, subId string, ip string, status int, bytes int)
+
+// EndpointStatsMiddleware passes every request to the recorder once it has been answered. It
+// has to come before the compression middleware so the bytes actually sent are counted.
+func EndpointStatsMiddleware(record EndpointRecorder) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		record(c.FullPath(), c.Param("subid"), RealClientIP(c), c.Writer.Status(), max(c.Writer.Size(), 0))
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/redis"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimitMiddleware limits every client address to perMinute requests per minute. Clients over
+// the limit get 429 Too Many Requests. The counters are kept in the shared store, so replicas
+// behind one load balancer enforce one limit; name keeps the counters of different limits apart.
+func RateLimitMiddleware(name string, perMinute int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		count, left, err := redis.SharedStore().Incr("ratelimit:"+name+":"+RealClientIP(c), time.Minute)
+		if err != nil {
+			// A failing store must not take the limited routes down with it
+			logger.Warning("rate limit failed:", err)
+			c.Next()
+			return
+		}
+		if count > int64(perMinute) {
+			c.Header("Retry-After", strconv.Itoa(max(int(math.Ceil(left.Seconds())), 1)))
+			c.AbortWithStatus(http.StatusTooManyRequests)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"reflect"
+	"runtime"
+	"slices"
+
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+	"github.com/mhsanaei/3x-ui/v2/web/locale"
+	"github.com/mhsanaei/3x-ui/v2/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readOnlyAllowedName is the handler name ReadOnlyAllowed is listed under in a route's handlers.
+var readOnlyAllowedName = runtime.FuncForPC(reflect.ValueOf(ReadOnlyAllowed).Pointer()).Name()
+
+// ReadOnlyAllowed marks a POST route that does not change anything, like login or a query, so it
+// keeps working in read-only mode. It is registered among the handlers of the route and does
+// nothing itself, so the mark goes with the route to every group it is registered in.
+func ReadOnlyAllowed(c *gin.Context) {}
+
+// ReadOnlyMiddleware rejects requests that could change anything with 423 Locked while the panel
+// is in read-only mode: all but GET, HEAD and OPTIONS requests, except for routes marked with
+// ReadOnlyAllowed. Background jobs are not affected, so traffic statistics keep being collected.
+func ReadOnlyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		settingService := service.SettingService{}
+		if readOnly, err := settingService.GetReadOnlyMode(); err != nil || !readOnly {
+			c.Next()
+			return
+		}
+		if slices.Contains(c.HandlerNames(), readOnlyAllowedName) {
+			c.Next()
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusLocked, entity.Msg{
+			Success: false,
+			Msg:     locale.I18n(locale.Web, "pages.settings.readOnlyActive"),
+			Code:    common.ErrCodeReadOnly,
+		})
+	}
+}
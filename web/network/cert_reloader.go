@@ -0,0 +1,107 @@
+package network
+
+import (
+	"context"
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/logger"
+)
+
+// CertWatchInterval is how often the panel and subscription servers check their certificate
+// files for changes.
+const CertWatchInterval = 30 * time.Second
+
+// CertReloader serves a TLS certificate pair from disk and reloads it when the files change,
+// so renewed certificates are picked up without restarting the listener.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+}
+
+// NewCertReloader loads the certificate pair and returns a reloader serving it.
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the certificate pair from disk. The current certificate is kept when loading fails.
+func (r *CertReloader) Reload() error {
+	certMod, keyMod := r.modTimes()
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.certMod = certMod
+	r.keyMod = keyMod
+	r.mu.Unlock()
+	return nil
+}
+
+// GetCertificate returns the current certificate, for use as tls.Config.GetCertificate.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// TLSConfig returns a TLS configuration serving the current certificate.
+func (r *CertReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		GetCertificate: r.GetCertificate,
+	}
+}
+
+// Watch checks the certificate files every interval until ctx is done and reloads them when
+// either file has changed. Tools like certbot replace both files one after another, so a pair
+// that does not load yet is retried on the next check.
+func (r *CertReloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		certMod, keyMod := r.modTimes()
+		r.mu.RLock()
+		changed := !certMod.Equal(r.certMod) || !keyMod.Equal(r.keyMod)
+		r.mu.RUnlock()
+		if !changed {
+			continue
+		}
+		if err := r.Reload(); err != nil {
+			logger.Warning("Error reloading certificate", r.certFile+":", err)
+			continue
+		}
+		logger.Info("Reloaded certificate", r.certFile)
+	}
+}
+
+// modTimes returns the modification times of the certificate and key files, zero for files
+// that cannot be read.
+func (r *CertReloader) modTimes() (certMod, keyMod time.Time) {
+	if fi, err := os.Stat(r.certFile); err == nil {
+		certMod = fi.ModTime()
+	}
+	if fi, err := os.Stat(r.keyFile); err == nil {
+		keyMod = fi.ModTime()
+	}
+	return
+}
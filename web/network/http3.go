@@ -0,0 +1,58 @@
+package network
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// altSvcMaxAge is how long clients may remember that HTTP/3 is available, in seconds.
+const altSvcMaxAge = 86400
+
+// Http3Server serves HTTP/3 over QUIC on the UDP port matching an HTTPS listener.
+type Http3Server struct {
+	server *http3.Server
+	conn   net.PacketConn
+	port   int
+}
+
+// NewHttp3Server listens on the UDP address addr and serves handler over HTTP/3 with the
+// certificates of tlsConfig.
+func NewHttp3Server(addr string, handler http.Handler, tlsConfig *tls.Config) (*Http3Server, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &Http3Server{
+		server: &http3.Server{
+			Handler:   handler,
+			TLSConfig: http3.ConfigureTLSConfig(tlsConfig),
+		},
+		conn: conn,
+		port: conn.LocalAddr().(*net.UDPAddr).Port,
+	}
+	go s.server.Serve(conn)
+	return s, nil
+}
+
+// AltSvc wraps handler to advertise the HTTP/3 server to clients of the HTTPS listener, so
+// browsers switch to QUIC on their next requests.
+func (s *Http3Server) AltSvc(handler http.Handler) http.Handler {
+	altSvc := fmt.Sprintf(`h3=":%d"; ma=%d`, s.port, altSvcMaxAge)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && r.ProtoMajor < 3 {
+			w.Header().Set("Alt-Svc", altSvc)
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// Close stops the HTTP/3 server and its UDP listener.
+func (s *Http3Server) Close() error {
+	err := s.server.Close()
+	s.conn.Close()
+	return err
+}
@@ -0,0 +1,91 @@
+package network
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+)
+
+// SocketSystemd selects the socket passed by systemd socket activation instead of a unix socket path.
+const SocketSystemd = "systemd"
+
+// listenFdsStart is the first file descriptor systemd passes, see sd_listen_fds(3).
+const listenFdsStart = 3
+
+var (
+	systemdOnce  sync.Once
+	systemdFiles []*os.File
+	systemdNames []string
+)
+
+// Listen opens the listener of a server. With an empty socket it listens on TCP at addr.
+// With SocketSystemd it uses the socket systemd passed under the given name, or by position
+// when the socket unit does not name its sockets. Otherwise socket is the path of a unix socket,
+// which is created readable and writable for its owner and group only.
+func Listen(addr, socket, name string, index int) (net.Listener, error) {
+	switch {
+	case socket == "":
+		return net.Listen("tcp", addr)
+	case socket == SocketSystemd:
+		return listenSystemd(name, index)
+	default:
+		return listenUnix(socket)
+	}
+}
+
+// listenUnix listens on a unix socket, replacing a socket file left over from a previous run.
+func listenUnix(path string) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, common.NewError("not a socket:", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o660); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// listenSystemd returns a listener for a socket passed by systemd. The passed descriptors stay
+// open, so the servers can listen on them again after a restart on SIGHUP.
+func listenSystemd(name string, index int) (net.Listener, error) {
+	systemdOnce.Do(func() {
+		if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+			return
+		}
+		count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+		if err != nil || count <= 0 {
+			return
+		}
+		if names := os.Getenv("LISTEN_FDNAMES"); names != "" {
+			systemdNames = strings.Split(names, ":")
+		}
+		for i := 0; i < count; i++ {
+			systemdFiles = append(systemdFiles, os.NewFile(uintptr(listenFdsStart+i), "systemd-socket-"+strconv.Itoa(i)))
+		}
+	})
+	if len(systemdFiles) == 0 {
+		return nil, common.NewError("no socket was passed by systemd")
+	}
+	for i, fdName := range systemdNames {
+		if fdName == name && i < len(systemdFiles) {
+			return net.FileListener(systemdFiles[i])
+		}
+	}
+	if index < len(systemdFiles) {
+		return net.FileListener(systemdFiles[index])
+	}
+	return nil, common.NewErrorf("systemd passed no socket named %s or at position %d", name, index)
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"encoding/json"
+	"slices"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/xray"
+)
+
+// adBlockOutboundTag is the tag of the blackhole outbound blocked domains are routed to.
+const adBlockOutboundTag = "blocked"
+
+// addAdBlockRule routes the domains of the ad block lists to the blackhole outbound for all
+// enabled inbounds but the excluded ones, ahead of the rules of the template and the pools.
+func (s *XrayService) addAdBlockRule(xrayConfig *xray.Config) error {
+	enable, err := s.settingService.GetAdBlockEnable()
+	if err != nil || !enable {
+		return err
+	}
+	categories, err := s.settingService.GetAdBlockCategories()
+	if err != nil {
+		return err
+	}
+	domains := splitTrimmed(categories)
+	excludeIds, err := s.settingService.GetAdBlockExcludeInboundIds()
+	if err != nil {
+		return err
+	}
+	excluded := ParseInboundIds(excludeIds)
+	var inbounds []*model.Inbound
+	if err := database.GetDB().Model(model.Inbound{}).Where("enable = ?", true).Find(&inbounds).Error; err != nil {
+		return err
+	}
+	var inboundTags []string
+	for _, inbound := range inbounds {
+		if !excluded[inbound.Id] {
+			inboundTags = append(inboundTags, inbound.Tag)
+		}
+	}
+	if len(domains) == 0 || len(inboundTags) == 0 {
+		return nil
+	}
+
+	var outbounds []map[string]any
+	if len(xrayConfig.OutboundConfigs) > 0 {
+		if err := json.Unmarshal(xrayConfig.OutboundConfigs, &outbounds); err != nil {
+			return err
+		}
+	}
+	if !slices.ContainsFunc(outbounds, func(outbound map[string]any) bool { return outbound["tag"] == adBlockOutboundTag }) {
+		outbounds = append(outbounds, map[string]any{"tag": adBlockOutboundTag, "protocol": "blackhole", "settings": map[string]any{}})
+		if xrayConfig.OutboundConfigs, err = json.Marshal(outbounds); err != nil {
+			return err
+		}
+	}
+
+	routing := map[string]any{}
+	if len(xrayConfig.RouterConfig) > 0 {
+		if err := json.Unmarshal(xrayConfig.RouterConfig, &routing); err != nil {
+			return err
+		}
+	}
+	rules, _ := routing["rules"].([]any)
+	at := 0
+	for at < len(rules) {
+		if rule, _ := rules[at].(map[string]any); rule["outboundTag"] != "api" {
+			break
+		}
+		at++
+	}
+	rule := map[string]any{
+		"type":        "field",
+		"inboundTag":  inboundTags,
+		"domain":      domains,
+		"outboundTag": adBlockOutboundTag,
+	}
+	routing["rules"] = slices.Insert(rules, at, any(rule))
+	xrayConfig.RouterConfig, err = json.Marshal(routing)
+	return err
+}
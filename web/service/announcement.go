@@ -0,0 +1,154 @@
+package service
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+)
+
+// AnnouncementService manages announcements to clients and delivers them via Telegram.
+type AnnouncementService struct {
+	inboundService InboundService
+	tgbot          Tgbot
+}
+
+// GetAnnouncements returns all announcements, newest first.
+func (s *AnnouncementService) GetAnnouncements() ([]*model.Announcement, error) {
+	db := database.GetDB()
+	var announcements []*model.Announcement
+	err := db.Model(model.Announcement{}).Order("id desc").Find(&announcements).Error
+	if err != nil {
+		return nil, err
+	}
+	return announcements, nil
+}
+
+// GetActiveAnnouncements returns the enabled announcements that have not expired, newest first.
+func (s *AnnouncementService) GetActiveAnnouncements() ([]*model.Announcement, error) {
+	db := database.GetDB()
+	var announcements []*model.Announcement
+	err := db.Model(model.Announcement{}).
+		Where("enable = ? AND (expires_at = 0 OR expires_at > ?)", true, time.Now().UnixMilli()).
+		Order("id desc").Find(&announcements).Error
+	if err != nil {
+		return nil, err
+	}
+	return announcements, nil
+}
+
+// AddAnnouncement validates and stores a new announcement.
+func (s *AnnouncementService) AddAnnouncement(announcement *model.Announcement) error {
+	if err := checkAnnouncement(announcement); err != nil {
+		return err
+	}
+	announcement.Id = 0
+	announcement.CreatedAt = time.Now().UnixMilli()
+	announcement.SentAt = 0
+	return database.GetDB().Create(announcement).Error
+}
+
+// UpdateAnnouncement updates the content and visibility of an announcement.
+func (s *AnnouncementService) UpdateAnnouncement(announcement *model.Announcement) error {
+	if err := checkAnnouncement(announcement); err != nil {
+		return err
+	}
+	db := database.GetDB()
+	old := &model.Announcement{}
+	if err := db.First(old, announcement.Id).Error; err != nil {
+		return err
+	}
+	old.Title = announcement.Title
+	old.Message = announcement.Message
+	old.Enable = announcement.Enable
+	old.ShowInSub = announcement.ShowInSub
+	old.ExpiresAt = announcement.ExpiresAt
+	if err := db.Save(old).Error; err != nil {
+		return err
+	}
+	*announcement = *old
+	return nil
+}
+
+// DelAnnouncement deletes an announcement.
+func (s *AnnouncementService) DelAnnouncement(id int) error {
+	db := database.GetDB()
+	return db.Delete(model.Announcement{}, id).Error
+}
+
+func checkAnnouncement(announcement *model.Announcement) error {
+	announcement.Title = strings.TrimSpace(announcement.Title)
+	announcement.Message = strings.TrimSpace(announcement.Message)
+	if announcement.Title == "" {
+		return common.NewError("announcement title is required")
+	}
+	if announcement.ExpiresAt < 0 {
+		return common.NewError("invalid expiresAt:", announcement.ExpiresAt)
+	}
+	return nil
+}
+
+// BroadcastAnnouncement sends an announcement to the Telegram accounts of all clients.
+// Each account receives it once, however many clients it is linked to. Returns the number of recipients.
+func (s *AnnouncementService) BroadcastAnnouncement(id int) (int, error) {
+	if !s.tgbot.IsRunning() {
+		return 0, common.NewError("Telegram bot is not running")
+	}
+	db := database.GetDB()
+	announcement := &model.Announcement{}
+	if err := db.First(announcement, id).Error; err != nil {
+		return 0, err
+	}
+
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return 0, err
+	}
+	tgIds := map[int64]bool{}
+	for _, inbound := range inbounds {
+		clients, err := s.inboundService.GetClients(inbound)
+		if err != nil {
+			continue
+		}
+		for _, client := range clients {
+			if client.TgID != 0 {
+				tgIds[client.TgID] = true
+			}
+		}
+	}
+
+	msg := fmt.Sprintf("📢 <b>%s</b>", html.EscapeString(announcement.Title))
+	if announcement.Message != "" {
+		msg += "\r\n\r\n" + html.EscapeString(announcement.Message)
+	}
+	for tgId := range tgIds {
+		s.tgbot.SendMsgToTgbot(tgId, msg)
+	}
+
+	announcement.SentAt = time.Now().UnixMilli()
+	if err := db.Model(announcement).Update("sent_at", announcement.SentAt).Error; err != nil {
+		return len(tgIds), err
+	}
+	return len(tgIds), nil
+}
+
+// GetAnnouncementLinks returns an info node for each active announcement shown in subscriptions.
+// The nodes point to an unroutable address, so clients list the title but can not connect through them.
+func (s *AnnouncementService) GetAnnouncementLinks() []string {
+	announcements, err := s.GetActiveAnnouncements()
+	if err != nil {
+		return nil
+	}
+	var links []string
+	for _, announcement := range announcements {
+		if announcement.ShowInSub {
+			links = append(links, "vless://00000000-0000-0000-0000-000000000000@0.0.0.0:1?encryption=none&type=tcp#"+url.PathEscape("ℹ️ "+announcement.Title))
+		}
+	}
+	return links
+}
@@ -0,0 +1,608 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/util/reflect_util"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+
+	"github.com/goccy/go-yaml"
+)
+
+// Apply plan actions and kinds.
+const (
+	ApplyCreate = "create"
+	ApplyUpdate = "update"
+	ApplyDelete = "delete"
+
+	ApplyKindSetting = "setting"
+	ApplyKindInbound = "inbound"
+	ApplyKindClient  = "client"
+)
+
+// ApplyService brings the panel to a declared state. It compares a document of desired settings
+// and inbounds with the current state, and creates, updates and deletes what differs. Applying
+// the same document again changes nothing, so it can be run from a deployment pipeline.
+type ApplyService struct {
+	inboundService  InboundService
+	settingService  SettingService
+	xrayService     XrayService
+	approvalService ApprovalService
+}
+
+// applyInboundUpdate is an inbound of the document matched to an existing inbound.
+type applyInboundUpdate struct {
+	current *model.Inbound
+	desired *model.Inbound
+}
+
+// ParseApplyDocument parses a YAML or JSON apply document.
+func ParseApplyDocument(data []byte) (*entity.ApplyDocument, error) {
+	doc := &entity.ApplyDocument{}
+	if err := yaml.Unmarshal(data, doc); err != nil {
+		return nil, common.NewCodeError(common.ErrCodeInvalidRequest, nil, "apply document invalid:", err)
+	}
+	return doc, nil
+}
+
+// Apply computes the plan for the document and, unless dryRun is set, applies it. Settings are
+// applied first, then inbounds are deleted, updated and created in that order, so a port freed by a
+// deleted inbound can be reused. Applying stops at the first failure; the plan is returned with
+// Applied false and the document can be applied again once the cause is fixed. Deleting an inbound
+// that needs approval files an approval request instead, listed in the plan, and the plan is not
+// Applied until the request is approved.
+func (s *ApplyService) Apply(doc *entity.ApplyDocument, userId int, dryRun bool) (*entity.ApplyPlan, error) {
+	plan := &entity.ApplyPlan{DryRun: dryRun, Changes: []entity.ApplyChange{}}
+
+	settingChanges, settingValues, err := s.planSettings(doc.Settings, plan)
+	if err != nil {
+		return plan, err
+	}
+	creates, updates, deletes, err := s.planInbounds(doc, plan)
+	if err != nil {
+		return plan, err
+	}
+	if dryRun {
+		return plan, nil
+	}
+	deletes, err = s.holdDeletes(deletes, userId, plan)
+	if err != nil {
+		return plan, err
+	}
+
+	for _, key := range settingChanges {
+		if err := s.settingService.saveSetting(key, settingValues[key]); err != nil {
+			return plan, err
+		}
+	}
+	needRestart := false
+	defer func() {
+		if needRestart {
+			s.xrayService.SetToNeedRestart()
+		}
+	}()
+	for _, inbound := range deletes {
+		restart, err := s.inboundService.DelInbound(inbound.Id)
+		needRestart = needRestart || restart
+		if err != nil {
+			return plan, fmt.Errorf("delete inbound %s: %w", inbound.Tag, err)
+		}
+	}
+	for _, update := range updates {
+		_, restart, err := s.inboundService.UpdateInbound(update.desired)
+		needRestart = needRestart || restart
+		if err != nil {
+			return plan, common.WithCode(common.ErrCodeValidation, fmt.Errorf("update inbound %s: %w", update.current.Tag, err))
+		}
+	}
+	for _, inbound := range creates {
+		inbound.UserId = userId
+		_, restart, err := s.inboundService.AddInbound(inbound)
+		needRestart = needRestart || restart
+		if err != nil {
+			return plan, common.WithCode(common.ErrCodeValidation, fmt.Errorf("create inbound %s: %w", inbound.Tag, err))
+		}
+	}
+	plan.Applied = len(plan.Approvals) == 0
+	return plan, nil
+}
+
+// holdDeletes files approval requests for the inbounds to delete that need one, adding them to the
+// plan, and returns the inbounds that can be deleted right away.
+func (s *ApplyService) holdDeletes(deletes []*model.Inbound, userId int, plan *entity.ApplyPlan) ([]*model.Inbound, error) {
+	ready := make([]*model.Inbound, 0, len(deletes))
+	for _, inbound := range deletes {
+		approval, err := s.approvalService.Require(ApprovalDelInbound, strconv.Itoa(inbound.Id), ApprovalAdmin(userId), nil)
+		if err != nil {
+			return nil, fmt.Errorf("delete inbound %s: %w", inbound.Tag, err)
+		}
+		if approval != nil {
+			plan.Approvals = append(plan.Approvals, approval)
+			continue
+		}
+		ready = append(ready, inbound)
+	}
+	return ready, nil
+}
+
+// planSettings compares the desired settings with the current ones. It returns the changed keys and the
+// values to store, after checking the resulting settings are valid.
+func (s *ApplyService) planSettings(desired map[string]any, plan *entity.ApplyPlan) ([]string, map[string]string, error) {
+	if len(desired) == 0 {
+		return nil, nil, nil
+	}
+	allSetting, err := s.settingService.GetAllSetting()
+	if err != nil {
+		return nil, nil, err
+	}
+	values, err := allSettingToMap(allSetting)
+	if err != nil {
+		return nil, nil, err
+	}
+	for key, value := range desired {
+		if _, known := values[key]; !known {
+			return nil, nil, common.NewCodeError(common.ErrCodeSettingInvalid, map[string]any{"key": key}, "unknown setting:", key)
+		}
+		if _, overridden := getSettingOverride(key); overridden {
+			return nil, nil, common.NewCodeError(common.ErrCodeSettingInvalid, map[string]any{"key": key}, "setting is overridden by the environment or settings file:", key)
+		}
+		values[key] = value
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return nil, nil, err
+	}
+	merged := &entity.AllSetting{}
+	if err := json.Unmarshal(data, merged); err != nil {
+		return nil, nil, common.NewCodeError(common.ErrCodeSettingInvalid, nil, "settings invalid:", err)
+	}
+	if err := merged.CheckValid(); err != nil {
+		return nil, nil, common.WithCode(common.ErrCodeSettingInvalid, err)
+	}
+
+	currentValues := settingStrings(allSetting)
+	mergedValues := settingStrings(merged)
+	changed := []string{}
+	for key := range desired {
+		if currentValues[key] == mergedValues[key] {
+			plan.Unchanged++
+			continue
+		}
+		changed = append(changed, key)
+	}
+	sort.Strings(changed)
+	for _, key := range changed {
+		plan.Changes = append(plan.Changes, entity.ApplyChange{Action: ApplyUpdate, Kind: ApplyKindSetting, Key: key})
+	}
+	return changed, mergedValues, nil
+}
+
+// settingStrings returns the settings as the strings they are stored as, keyed by their json tag.
+func settingStrings(allSetting *entity.AllSetting) map[string]string {
+	values := map[string]string{}
+	v := reflect.ValueOf(allSetting).Elem()
+	for _, field := range reflect_util.GetFields(v.Type()) {
+		values[field.Tag.Get("json")] = fmt.Sprint(v.FieldByName(field.Name).Interface())
+	}
+	return values
+}
+
+// planInbounds compares the desired inbounds with the current ones by external ID when one is
+// declared, otherwise by tag, which follows from the listen address and port.
+func (s *ApplyService) planInbounds(doc *entity.ApplyDocument, plan *entity.ApplyPlan) ([]*model.Inbound, []applyInboundUpdate, []*model.Inbound, error) {
+	if len(doc.Inbounds) == 0 && !doc.Prune {
+		return nil, nil, nil, nil
+	}
+	currentInbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	current := map[string]*model.Inbound{}
+	currentByExternalId := map[string]*model.Inbound{}
+	for _, inbound := range currentInbounds {
+		current[inbound.Tag] = inbound
+		if inbound.ExternalId != "" {
+			currentByExternalId[inbound.ExternalId] = inbound
+		}
+	}
+
+	var creates []*model.Inbound
+	var updates []applyInboundUpdate
+	var deletes []*model.Inbound
+	var createChanges, updateChanges, deleteChanges []entity.ApplyChange
+	declared := map[string]bool{}
+	kept := map[int]bool{}
+	for i := range doc.Inbounds {
+		desired, err := applyInboundModel(&doc.Inbounds[i])
+		if err != nil {
+			return nil, nil, nil, common.NewCodeErrorf(common.ErrCodeValidation, "inbound %d: %v", i+1, err)
+		}
+		if declared[desired.Tag] {
+			return nil, nil, nil, common.NewCodeError(common.ErrCodeValidation, map[string]any{"tag": desired.Tag}, "inbound listed twice:", desired.Tag)
+		}
+		declared[desired.Tag] = true
+
+		existing, ok := currentByExternalId[desired.ExternalId]
+		if !ok {
+			existing, ok = current[desired.Tag]
+		}
+		if ok {
+			kept[existing.Id] = true
+		}
+		if !ok {
+			if desired.Settings != "" {
+				desired.Settings = mergeUndeclaredSettings("{}", desired.Settings)
+			}
+			creates = append(creates, desired)
+			createChanges = append(createChanges, entity.ApplyChange{Action: ApplyCreate, Kind: ApplyKindInbound, Key: desired.Tag})
+			continue
+		}
+		desired.Settings = mergeUndeclaredSettings(existing.Settings, desired.Settings)
+		desired.StreamSettings = keepStreamSecrets(existing.StreamSettings, desired.StreamSettings)
+		fields := diffInbound(existing, desired)
+		if len(fields) == 0 {
+			plan.Unchanged++
+			continue
+		}
+		// Keep what the document does not declare, like traffic counters
+		updated := *existing
+		updated.ClientStats = nil
+		copyDeclaredInbound(&updated, desired)
+		updates = append(updates, applyInboundUpdate{current: existing, desired: &updated})
+		updateChanges = append(updateChanges, entity.ApplyChange{Action: ApplyUpdate, Kind: ApplyKindInbound, Key: desired.Tag, Fields: fields})
+		if slices.Contains(fields, "settings") {
+			updateChanges = append(updateChanges, diffClients(desired.Tag, existing.Settings, desired.Settings)...)
+		}
+	}
+	if doc.Prune {
+		for _, inbound := range currentInbounds {
+			if kept[inbound.Id] {
+				continue
+			}
+			deletes = append(deletes, inbound)
+			deleteChanges = append(deleteChanges, entity.ApplyChange{Action: ApplyDelete, Kind: ApplyKindInbound, Key: inbound.Tag})
+		}
+	}
+	plan.Changes = append(plan.Changes, deleteChanges...)
+	plan.Changes = append(plan.Changes, updateChanges...)
+	plan.Changes = append(plan.Changes, createChanges...)
+	return creates, updates, deletes, nil
+}
+
+// applyInboundModel converts a declared inbound to the inbound model with its defaults applied.
+func applyInboundModel(declared *entity.ApplyInbound) (*model.Inbound, error) {
+	if declared.Port < 1 || declared.Port > 65535 {
+		return nil, common.NewError("invalid port:", declared.Port)
+	}
+	if declared.Protocol == "" {
+		return nil, common.NewError("protocol is required")
+	}
+	if err := checkExternalId(declared.ExternalId); err != nil {
+		return nil, err
+	}
+	inbound := &model.Inbound{
+		ExternalId:      declared.ExternalId,
+		Remark:          declared.Remark,
+		RemarkTemplate:  declared.RemarkTemplate,
+		Group:           strings.TrimSpace(declared.Group),
+		Enable:          declared.Enable == nil || *declared.Enable,
+		Listen:          declared.Listen,
+		Port:            declared.Port,
+		Protocol:        declared.Protocol,
+		Total:           declared.Total,
+		ExpiryTime:      declared.ExpiryTime,
+		TrafficReset:    declared.TrafficReset,
+		SpeedLimit:      declared.SpeedLimit,
+		SpeedBurst:      declared.SpeedBurst,
+		SpeedUnit:       declared.SpeedUnit,
+		ConnLimit:       declared.ConnLimit,
+		ConnLimitPerIp:  declared.ConnLimitPerIp,
+		PortHopRange:    declared.PortHopRange,
+		PortHopInterval: declared.PortHopInterval,
+		ExtraPorts:      declared.ExtraPorts,
+		SubPortMode:     declared.SubPortMode,
+		SubExclude:      declared.SubExclude,
+		ExtraListens:    declared.ExtraListens,
+		Tag:             inboundTag(declared.Listen, declared.Port),
+	}
+	if inbound.TrafficReset == "" {
+		inbound.TrafficReset = "never"
+	}
+	var err error
+	if inbound.Settings, err = applyJSON(declared.Settings); err != nil {
+		return nil, common.NewError("settings:", err)
+	}
+	if inbound.StreamSettings, err = applyJSON(declared.StreamSettings); err != nil {
+		return nil, common.NewError("streamSettings:", err)
+	}
+	if inbound.Extension, err = applyJSON(declared.Extension); err != nil {
+		return nil, common.NewError("extension:", err)
+	}
+	sniffing := declared.Sniffing
+	if sniffing == nil {
+		sniffing = DefaultSniffing(inbound.Protocol)
+	}
+	if inbound.Sniffing, err = applyJSON(sniffing); err != nil {
+		return nil, common.NewError("sniffing:", err)
+	}
+	return inbound, nil
+}
+
+// inboundTag returns the tag the panel gives an inbound listening on the address and port.
+func inboundTag(listen string, port int) string {
+	if listen == "" || listen == "0.0.0.0" || listen == "::" || listen == "::0" {
+		return fmt.Sprintf("inbound-%v", port)
+	}
+	return fmt.Sprintf("inbound-%v:%v", listen, port)
+}
+
+// applyJSON stores a declared object, or an object given as JSON string, as indented JSON.
+func applyJSON(value any) (string, error) {
+	if value == nil {
+		return "", nil
+	}
+	if text, ok := value.(string); ok {
+		if strings.TrimSpace(text) == "" {
+			return "", nil
+		}
+		if err := json.Unmarshal([]byte(text), &value); err != nil {
+			return "", err
+		}
+	}
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// copyDeclaredInbound copies the fields an apply document declares.
+func copyDeclaredInbound(dst *model.Inbound, src *model.Inbound) {
+	dst.Remark = src.Remark
+	dst.RemarkTemplate = src.RemarkTemplate
+	dst.Group = src.Group
+	dst.Enable = src.Enable
+	dst.Listen = src.Listen
+	dst.Port = src.Port
+	dst.Protocol = src.Protocol
+	dst.Total = src.Total
+	dst.ExpiryTime = src.ExpiryTime
+	dst.TrafficReset = src.TrafficReset
+	dst.SpeedLimit = src.SpeedLimit
+	dst.SpeedBurst = src.SpeedBurst
+	dst.SpeedUnit = src.SpeedUnit
+	dst.ConnLimit = src.ConnLimit
+	dst.ConnLimitPerIp = src.ConnLimitPerIp
+	dst.PortHopRange = src.PortHopRange
+	dst.PortHopInterval = src.PortHopInterval
+	dst.ExtraPorts = src.ExtraPorts
+	dst.SubPortMode = src.SubPortMode
+	dst.SubExclude = src.SubExclude
+	dst.ExtraListens = src.ExtraListens
+	dst.Settings = src.Settings
+	dst.StreamSettings = src.StreamSettings
+	dst.Sniffing = src.Sniffing
+	dst.Extension = src.Extension
+}
+
+// diffInbound returns the declared fields that differ between the current and the desired inbound.
+func diffInbound(current *model.Inbound, desired *model.Inbound) []string {
+	fields := []string{}
+	compare := []struct {
+		name     string
+		from, to any
+	}{
+		{"remark", current.Remark, desired.Remark},
+		{"remarkTemplate", current.RemarkTemplate, desired.RemarkTemplate},
+		{"group", current.Group, desired.Group},
+		{"enable", current.Enable, desired.Enable},
+		{"protocol", current.Protocol, desired.Protocol},
+		{"total", current.Total, desired.Total},
+		{"expiryTime", current.ExpiryTime, desired.ExpiryTime},
+		{"trafficReset", current.TrafficReset, desired.TrafficReset},
+		{"speedLimit", current.SpeedLimit, desired.SpeedLimit},
+		{"speedBurst", current.SpeedBurst, desired.SpeedBurst},
+		{"speedUnit", current.SpeedUnit, desired.SpeedUnit},
+		{"connLimit", current.ConnLimit, desired.ConnLimit},
+		{"connLimitPerIp", current.ConnLimitPerIp, desired.ConnLimitPerIp},
+		{"portHopRange", current.PortHopRange, desired.PortHopRange},
+		{"portHopInterval", current.PortHopInterval, desired.PortHopInterval},
+		{"extraPorts", current.ExtraPorts, desired.ExtraPorts},
+		{"subPortMode", current.SubPortMode, desired.SubPortMode},
+		{"subExclude", current.SubExclude, desired.SubExclude},
+		{"extraListens", current.ExtraListens, desired.ExtraListens},
+	}
+	for _, c := range compare {
+		if c.from != c.to {
+			fields = append(fields, c.name)
+		}
+	}
+	if !reflect.DeepEqual(comparableJSON(current.Settings, true), comparableJSON(desired.Settings, true)) {
+		fields = append(fields, "settings")
+	}
+	if !reflect.DeepEqual(comparableJSON(current.StreamSettings, false), comparableJSON(desired.StreamSettings, false)) {
+		fields = append(fields, "streamSettings")
+	}
+	if !reflect.DeepEqual(comparableJSON(current.Sniffing, false), comparableJSON(desired.Sniffing, false)) {
+		fields = append(fields, "sniffing")
+	}
+	if !reflect.DeepEqual(comparableJSON(current.Extension, false), comparableJSON(desired.Extension, false)) {
+		fields = append(fields, "extension")
+	}
+	return fields
+}
+
+// mergeUndeclaredSettings keeps the inbound settings and client fields the document does not declare,
+// like the subscription ID and defaults the panel filled in, so they are not reset by every apply.
+// Clients are matched by email; new clients are enabled unless the document says otherwise.
+func mergeUndeclaredSettings(currentSettings string, desiredSettings string) string {
+	if desiredSettings == "" {
+		return currentSettings
+	}
+	var current, desired map[string]any
+	if json.Unmarshal([]byte(currentSettings), &current) != nil || json.Unmarshal([]byte(desiredSettings), &desired) != nil {
+		return desiredSettings
+	}
+	for key, value := range current {
+		if _, ok := desired[key]; !ok {
+			desired[key] = value
+		}
+	}
+	currentClients := map[string]map[string]any{}
+	if clients, ok := current["clients"].([]any); ok {
+		for _, client := range clients {
+			if c, ok := client.(map[string]any); ok {
+				if email, ok := c["email"].(string); ok {
+					currentClients[email] = c
+				}
+			}
+		}
+	}
+	if clients, ok := desired["clients"].([]any); ok {
+		for _, client := range clients {
+			c, ok := client.(map[string]any)
+			if !ok {
+				continue
+			}
+			email, _ := c["email"].(string)
+			existing, found := currentClients[email]
+			for key, value := range existing {
+				if _, ok := c[key]; !ok {
+					c[key] = value
+				}
+			}
+			if _, ok := c["enable"]; !ok && !found {
+				c["enable"] = true
+			}
+		}
+	}
+	data, err := json.MarshalIndent(desired, "", "  ")
+	if err != nil {
+		return desiredSettings
+	}
+	return string(data)
+}
+
+// keepStreamSecrets keeps the Reality private key and the TLS certificate keys of the current stream
+// settings when the document leaves them out, as the state endpoint does unless asked for secrets.
+func keepStreamSecrets(currentStream string, desiredStream string) string {
+	var current, desired map[string]any
+	if json.Unmarshal([]byte(currentStream), &current) != nil || json.Unmarshal([]byte(desiredStream), &desired) != nil {
+		return desiredStream
+	}
+	changed := false
+	currentReality, _ := current["realitySettings"].(map[string]any)
+	desiredReality, _ := desired["realitySettings"].(map[string]any)
+	if currentReality != nil && desiredReality != nil {
+		if _, ok := desiredReality["privateKey"]; !ok && currentReality["privateKey"] != nil {
+			desiredReality["privateKey"] = currentReality["privateKey"]
+			changed = true
+		}
+	}
+	currentTls, _ := current["tlsSettings"].(map[string]any)
+	desiredTls, _ := desired["tlsSettings"].(map[string]any)
+	if currentTls != nil && desiredTls != nil {
+		currentCerts, _ := currentTls["certificates"].([]any)
+		desiredCerts, _ := desiredTls["certificates"].([]any)
+		for i := 0; i < len(currentCerts) && i < len(desiredCerts); i++ {
+			currentCert, _ := currentCerts[i].(map[string]any)
+			desiredCert, _ := desiredCerts[i].(map[string]any)
+			if currentCert == nil || desiredCert == nil {
+				continue
+			}
+			if _, ok := desiredCert["key"]; !ok && currentCert["key"] != nil {
+				desiredCert["key"] = currentCert["key"]
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return desiredStream
+	}
+	data, err := json.MarshalIndent(desired, "", "  ")
+	if err != nil {
+		return desiredStream
+	}
+	return string(data)
+}
+
+// comparableJSON decodes stored JSON for comparison. The timestamps the panel adds to clients are
+// dropped, since a document does not declare them.
+func comparableJSON(data string, stripClientTimes bool) any {
+	if strings.TrimSpace(data) == "" {
+		return nil
+	}
+	var value any
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		return data
+	}
+	if settings, ok := value.(map[string]any); ok && stripClientTimes {
+		if clients, ok := settings["clients"].([]any); ok {
+			for _, client := range clients {
+				if c, ok := client.(map[string]any); ok {
+					delete(c, "created_at")
+					delete(c, "updated_at")
+				}
+			}
+		}
+	}
+	return value
+}
+
+// diffClients lists the clients added, removed and changed between the current and desired inbound settings.
+func diffClients(tag string, currentSettings string, desiredSettings string) []entity.ApplyChange {
+	clientsByEmail := func(settings string) (map[string]map[string]any, []string) {
+		byEmail := map[string]map[string]any{}
+		emails := []string{}
+		value, _ := comparableJSON(settings, true).(map[string]any)
+		clients, _ := value["clients"].([]any)
+		for _, client := range clients {
+			if c, ok := client.(map[string]any); ok {
+				email, _ := c["email"].(string)
+				byEmail[email] = c
+				emails = append(emails, email)
+			}
+		}
+		return byEmail, emails
+	}
+	current, currentEmails := clientsByEmail(currentSettings)
+	desired, desiredEmails := clientsByEmail(desiredSettings)
+
+	changes := []entity.ApplyChange{}
+	for _, email := range currentEmails {
+		if _, ok := desired[email]; !ok {
+			changes = append(changes, entity.ApplyChange{Action: ApplyDelete, Kind: ApplyKindClient, Key: email, Inbound: tag})
+		}
+	}
+	for _, email := range desiredEmails {
+		client, ok := current[email]
+		if !ok {
+			changes = append(changes, entity.ApplyChange{Action: ApplyCreate, Kind: ApplyKindClient, Key: email, Inbound: tag})
+			continue
+		}
+		fields := []string{}
+		for key, value := range desired[email] {
+			if !reflect.DeepEqual(client[key], value) {
+				fields = append(fields, key)
+			}
+		}
+		for key := range client {
+			if _, ok := desired[email][key]; !ok {
+				fields = append(fields, key)
+			}
+		}
+		if len(fields) > 0 {
+			sort.Strings(fields)
+			changes = append(changes, entity.ApplyChange{Action: ApplyUpdate, Kind: ApplyKindClient, Key: email, Inbound: tag, Fields: fields})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,281 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/config"
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+)
+
+// Operations held back for approval.
+const (
+	ApprovalDelInbound       = "delInbound"
+	ApprovalResetAllTraffics = "resetAllTraffics"
+	ApprovalImportDB         = "importDB"
+)
+
+// ApprovalService holds destructive operations until a second admin approves them within the
+// approval window. Admins are panel users, approving through the panel or the API, and the
+// Telegram bot admins, who are sent every request with buttons to approve or reject it. The panel
+// has a single user, so the second admin is normally a Telegram bot admin, which only adds a
+// second person when the bot admins are not the panel user.
+//
+// Every service running a gated operation on behalf of an admin, like applying a document that
+// prunes inbounds, goes through Require. Background jobs do not run gated operations, and the
+// scheduled actions deleting clients or traffic are refused while approvals are enabled.
+type ApprovalService struct {
+	settingService SettingService
+	inboundService InboundService
+	serverService  ServerService
+	xrayService    XrayService
+	tgbot          Tgbot
+}
+
+// ApprovalAdmin returns the name approval requests give the panel user with the ID.
+func ApprovalAdmin(userId int) string {
+	return "user:" + strconv.Itoa(userId)
+}
+
+// getApprovalFolder returns the folder uploaded backups wait for approval in.
+func getApprovalFolder() string {
+	return filepath.Join(config.GetDBFolderPath(), "approvals")
+}
+
+// approvalPayloadPath returns the path of the file kept for an approval request.
+func approvalPayloadPath(id int) string {
+	return filepath.Join(getApprovalFolder(), fmt.Sprintf("%d.db", id))
+}
+
+// Require returns a pending approval request for the operation when it needs one, nil when it
+// can go ahead. The payload is only read when a request is created, and kept for the operation
+// until the request is decided.
+func (s *ApprovalService) Require(action string, target string, requestedBy string, payload io.Reader) (*model.Approval, error) {
+	enable, err := s.settingService.GetApprovalEnable()
+	if err != nil || !enable {
+		return nil, err
+	}
+	s.expire()
+
+	var summary string
+	switch action {
+	case ApprovalDelInbound:
+		id, err := strconv.Atoi(target)
+		if err != nil {
+			return nil, err
+		}
+		inbound, err := s.inboundService.GetInbound(id)
+		if err != nil {
+			return nil, err
+		}
+		clients, _ := s.inboundService.GetClients(inbound)
+		minClients, err := s.settingService.GetApprovalMinClients()
+		if err != nil {
+			return nil, err
+		}
+		if len(clients) <= minClients {
+			return nil, nil
+		}
+		summary = fmt.Sprintf("Delete inbound %q (ID %d) with %d clients", inbound.Remark, inbound.Id, len(clients))
+	case ApprovalResetAllTraffics:
+		summary = "Reset the traffic of all inbounds"
+	case ApprovalImportDB:
+		summary = "Restore a database backup"
+	default:
+		return nil, common.NewError("unknown approval action:", action)
+	}
+
+	if err := s.checkApprovers(); err != nil {
+		return nil, err
+	}
+	window, err := s.settingService.GetApprovalWindow()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	approval := &model.Approval{
+		Action:      action,
+		Target:      target,
+		Summary:     summary,
+		Status:      model.ApprovalPending,
+		RequestedBy: requestedBy,
+		CreatedAt:   now.UnixMilli(),
+		ExpiresAt:   now.Add(time.Duration(window) * time.Minute).UnixMilli(),
+	}
+	db := database.GetDB()
+	if err := db.Create(approval).Error; err != nil {
+		return nil, err
+	}
+	if payload != nil {
+		if err := storeApprovalPayload(approval.Id, payload); err != nil {
+			db.Delete(approval)
+			return nil, err
+		}
+	}
+	logger.Infof("Approval %d requested by %s: %s", approval.Id, requestedBy, summary)
+	if s.tgbot.IsRunning() {
+		s.tgbot.SendApprovalRequest(approval)
+	}
+	return approval, nil
+}
+
+// checkApprovers fails when nobody but the requesting panel user could approve a request, which
+// is the case on a single-user panel without the Telegram bot.
+func (s *ApprovalService) checkApprovers() error {
+	var users int64
+	if err := database.GetDB().Model(model.User{}).Count(&users).Error; err != nil {
+		return err
+	}
+	if users < 2 && !s.tgbot.IsRunning() {
+		return common.NewCodeError(common.ErrCodeValidation, nil,
+			"approval needs a second admin: enable the Telegram bot so its admins can approve requests")
+	}
+	return nil
+}
+
+// storeApprovalPayload writes the payload of an approval request to its file.
+func storeApprovalPayload(id int, payload io.Reader) error {
+	if err := os.MkdirAll(getApprovalFolder(), 0o700); err != nil {
+		return err
+	}
+	path := approvalPayloadPath(id)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, payload)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// expire marks the pending requests past their window as expired and removes their payload.
+func (s *ApprovalService) expire() {
+	var ids []int
+	db := database.GetDB()
+	err := db.Model(model.Approval{}).
+		Where("status = ? AND expires_at < ?", model.ApprovalPending, time.Now().UnixMilli()).
+		Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return
+	}
+	db.Model(model.Approval{}).Where("id IN ? AND status = ?", ids, model.ApprovalPending).
+		Update("status", model.ApprovalExpired)
+	for _, id := range ids {
+		os.Remove(approvalPayloadPath(id))
+	}
+}
+
+// GetApprovals returns the approval requests, newest first.
+func (s *ApprovalService) GetApprovals() ([]*model.Approval, error) {
+	s.expire()
+	approvals := []*model.Approval{}
+	err := database.GetDB().Model(model.Approval{}).Order("id DESC").Find(&approvals).Error
+	return approvals, err
+}
+
+// decide moves a pending request to the status, failing when it is no longer pending so each
+// request is only decided once.
+func (s *ApprovalService) decide(id int, status string, decidedBy string) (*model.Approval, error) {
+	s.expire()
+	db := database.GetDB()
+	approval := &model.Approval{}
+	if err := db.First(approval, id).Error; err != nil {
+		return nil, err
+	}
+	if approval.Status != model.ApprovalPending {
+		return nil, common.NewCodeError(common.ErrCodeApprovalDecided, nil, "approval request is already", approval.Status)
+	}
+	result := db.Model(model.Approval{}).Where("id = ? AND status = ?", id, model.ApprovalPending).
+		Updates(map[string]any{"status": status, "decided_by": decidedBy, "decided_at": time.Now().UnixMilli()})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, common.NewCodeError(common.ErrCodeApprovalDecided, nil, "approval request is no longer pending")
+	}
+	approval.Status = status
+	approval.DecidedBy = decidedBy
+	return approval, nil
+}
+
+// Approve approves a pending request and runs its operation. The admin who requested it can
+// not approve it.
+func (s *ApprovalService) Approve(id int, approvedBy string) (*model.Approval, error) {
+	approval := &model.Approval{}
+	if err := database.GetDB().First(approval, id).Error; err != nil {
+		return nil, err
+	}
+	if approval.RequestedBy == approvedBy {
+		return nil, common.NewCodeError(common.ErrCodeApprovalSameAdmin, nil, "approval request has to be approved by a second admin")
+	}
+	approval, err := s.decide(id, model.ApprovalApproved, approvedBy)
+	if err != nil {
+		return nil, err
+	}
+	logger.Infof("Approval %d approved by %s: %s", approval.Id, approvedBy, approval.Summary)
+	if err := s.run(approval); err != nil {
+		logger.Warningf("Approved operation %d failed: %v", approval.Id, err)
+		approval.Status = model.ApprovalFailed
+		approval.Error = err.Error()
+		database.GetDB().Model(model.Approval{}).Where("id = ?", approval.Id).
+			Updates(map[string]any{"status": approval.Status, "error": approval.Error})
+	}
+	return approval, nil
+}
+
+// Reject rejects a pending request, which the admin who requested it can do to withdraw it.
+func (s *ApprovalService) Reject(id int, rejectedBy string) (*model.Approval, error) {
+	approval, err := s.decide(id, model.ApprovalRejected, rejectedBy)
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(approvalPayloadPath(id))
+	logger.Infof("Approval %d rejected by %s: %s", approval.Id, rejectedBy, approval.Summary)
+	return approval, nil
+}
+
+// run carries out the operation of an approved request.
+func (s *ApprovalService) run(approval *model.Approval) error {
+	switch approval.Action {
+	case ApprovalDelInbound:
+		id, err := strconv.Atoi(approval.Target)
+		if err != nil {
+			return err
+		}
+		needRestart, err := s.inboundService.DelInbound(id)
+		if needRestart {
+			s.xrayService.SetToNeedRestart()
+		}
+		return err
+	case ApprovalResetAllTraffics:
+		if err := s.inboundService.ResetAllTraffics(); err != nil {
+			return err
+		}
+		s.xrayService.SetToNeedRestart()
+		return nil
+	case ApprovalImportDB:
+		path := approvalPayloadPath(approval.Id)
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(path)
+		defer file.Close()
+		// The imported database replaces this request, so nothing is stored after it succeeded
+		defer s.serverService.RestartXrayService()
+		return s.serverService.ImportDB(file)
+	}
+	return common.NewError("unknown approval action:", approval.Action)
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/util/crypto"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+
+	"gorm.io/gorm"
+)
+
+// backupRequiredTables are the tables a backup cannot be restored without.
+var backupRequiredTables = []string{"users", "inbounds", "settings", "client_traffics"}
+
+// BackupService checks database backups without touching the live database.
+type BackupService struct{}
+
+// VerifyBackup copies the uploaded backup to a temporary file, opens it read-only and reports
+// whether it can be restored: its schema version, SQLite integrity, the record counts and
+// whether its secret settings can be decrypted with this panel's master key.
+func (s *BackupService) VerifyBackup(file io.ReaderAt, size int64) (*entity.BackupVerification, error) {
+	isValidDb, err := database.IsSQLiteDB(file)
+	if err != nil || !isValidDb {
+		return nil, common.NewCodeError(common.ErrCodeValidation, nil, "the backup is not a SQLite database")
+	}
+
+	tempFile, err := os.CreateTemp("", "x-ui-verify-*.db")
+	if err != nil {
+		return nil, err
+	}
+	tempPath := tempFile.Name()
+	defer os.Remove(tempPath)
+	_, err = io.Copy(tempFile, io.NewSectionReader(file, 0, size))
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := database.OpenReadOnly(tempPath)
+	if err != nil {
+		return nil, common.NewCodeError(common.ErrCodeValidation, nil, "the backup could not be opened:", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	defer sqlDB.Close()
+
+	result := &entity.BackupVerification{CurrentSchemaVersion: database.SchemaVersion}
+	if err := db.Raw("PRAGMA integrity_check;").Scan(&result.Integrity).Error; err != nil {
+		return nil, common.NewCodeError(common.ErrCodeValidation, nil, "the backup could not be read:", err)
+	}
+	if result.Integrity != "ok" {
+		result.Errors = append(result.Errors, "integrity check failed: "+result.Integrity)
+	}
+	db.Raw("PRAGMA user_version;").Scan(&result.SchemaVersion)
+	switch {
+	case result.SchemaVersion > database.SchemaVersion:
+		result.Errors = append(result.Errors, fmt.Sprintf("the backup has schema version %d, newer than %d of this panel", result.SchemaVersion, database.SchemaVersion))
+	case result.SchemaVersion < database.SchemaVersion:
+		result.Warnings = append(result.Warnings, "the backup was made by an older panel version and is migrated when restored")
+	}
+
+	var tables []string
+	db.Raw("SELECT name FROM sqlite_master WHERE type = 'table'").Scan(&tables)
+	for _, table := range backupRequiredTables {
+		if !slices.Contains(tables, table) {
+			result.Errors = append(result.Errors, "missing table: "+table)
+		}
+	}
+	if len(result.Errors) == 0 {
+		s.countRecords(db, result)
+		s.checkSecrets(db, result)
+	}
+	result.Valid = len(result.Errors) == 0
+	return result, nil
+}
+
+// countRecords reports the number of users, inbounds, clients and settings in the backup.
+func (s *BackupService) countRecords(db *gorm.DB, result *entity.BackupVerification) {
+	db.Table("users").Count(&result.Users)
+	db.Table("inbounds").Count(&result.Inbounds)
+	db.Table("client_traffics").Count(&result.ClientTraffics)
+	db.Table("settings").Count(&result.Settings)
+	if result.Users == 0 {
+		result.Warnings = append(result.Warnings, "the backup has no panel users, the default admin is created when restored")
+	}
+
+	var inboundSettings []string
+	db.Table("inbounds").Pluck("settings", &inboundSettings)
+	for _, raw := range inboundSettings {
+		var settings struct {
+			Clients []json.RawMessage `json:"clients"`
+		}
+		if err := json.Unmarshal([]byte(raw), &settings); err != nil {
+			result.Warnings = append(result.Warnings, "an inbound has unreadable settings")
+			continue
+		}
+		result.Clients += len(settings.Clients)
+	}
+}
+
+// checkSecrets reports whether the encrypted secret settings of the backup can be decrypted with this panel's master key.
+func (s *BackupService) checkSecrets(db *gorm.DB, result *entity.BackupVerification) {
+	var settings []model.Setting
+	db.Table("settings").Find(&settings)
+	wrappedKey := ""
+	secrets := []string{}
+	for _, setting := range settings {
+		if setting.Key == secretDataKeySetting {
+			wrappedKey = setting.Value
+		} else if secretSettings[setting.Key] && crypto.IsEncryptedSecret(setting.Value) {
+			secrets = append(secrets, setting.Value)
+		}
+	}
+	result.Secrets = len(secrets)
+	result.SecretsReadable = true
+	if len(secrets) == 0 {
+		return
+	}
+
+	masterKeys, err := getMasterKeys()
+	if err != nil {
+		logger.Warning("backup verification: read master key failed:", err)
+	}
+	var dataKey []byte
+	if err == nil && wrappedKey != "" {
+		dataKey, _, err = unwrapDataKey(masterKeys, wrappedKey)
+	}
+	if dataKey != nil {
+		for _, secret := range secrets {
+			if _, err = crypto.DecryptSecret(dataKey, secret); err != nil {
+				break
+			}
+		}
+	}
+	if dataKey == nil || err != nil {
+		result.SecretsReadable = false
+		result.Warnings = append(result.Warnings, "the secret settings cannot be decrypted with this panel's master key and are lost when restored without it")
+	}
+}
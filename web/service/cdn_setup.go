@@ -0,0 +1,265 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/util/link"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+)
+
+// Ports Cloudflare proxies plain HTTP and HTTPS traffic on.
+var (
+	cloudflareHTTPPorts  = []int{80, 8080, 8880, 2052, 2082, 2086, 2095}
+	cloudflareHTTPSPorts = []int{443, 2053, 2083, 2087, 2096, 8443}
+)
+
+// cdnCheckClient is the HTTP client reachability checks go through.
+var cdnCheckClient = &http.Client{
+	Timeout: 10 * time.Second,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// CdnSetupOptions holds what the CDN assistant needs to set up an inbound behind Cloudflare.
+type CdnSetupOptions struct {
+	Domain    string // Domain in a Cloudflare zone clients connect to
+	ApiToken  string // Cloudflare API token with DNS edit rights, the DNS provider token when empty
+	Transport string // xhttp or ws, xhttp when empty
+	Port      int    // Inbound port, 443 with a certificate and 80 without when 0
+	CertFile  string // Origin certificate file, the inbound serves plain HTTP without it
+	KeyFile   string // Key file of the certificate
+	Remark    string // Inbound remark
+	Email     string // Email of the client, random when empty
+	UserId    int    // Panel user owning the inbound
+}
+
+// CdnSetupService sets up inbounds reached through Cloudflare in one step.
+type CdnSetupService struct {
+	inboundService InboundService
+	settingService SettingService
+	xrayService    XrayService
+	dnsService     DNSService
+}
+
+// cdnProvider returns the Cloudflare provider for the token, or the configured one.
+func (s *CdnSetupService) cdnProvider(token string) (DNSProvider, error) {
+	if token = strings.TrimSpace(token); token != "" {
+		return &cloudflareProvider{token: token}, nil
+	}
+	name, err := s.settingService.GetDnsProvider()
+	if err != nil {
+		return nil, err
+	}
+	if name != "cloudflare" {
+		return nil, common.NewCodeError(common.ErrCodeValidation, nil, "a Cloudflare API token is required")
+	}
+	return s.dnsService.GetProvider()
+}
+
+// Setup creates a WebSocket or XHTTP inbound for the domain with the host and server name
+// Cloudflare forwards, points proxied records of the domain at this server, restarts Xray and
+// checks the inbound is reachable through Cloudflare. The inbound and records are kept when the
+// check fails, since new records can take a while to work.
+func (s *CdnSetupService) Setup(options CdnSetupOptions) (*entity.CdnSetup, error) {
+	options.Domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(options.Domain)), ".")
+	if options.Domain == "" || !strings.Contains(options.Domain, ".") {
+		return nil, common.NewCodeError(common.ErrCodeValidation, nil, "a domain is required")
+	}
+	useTls := strings.TrimSpace(options.CertFile) != ""
+	preset := "xhttp-cdn"
+	switch options.Transport {
+	case "", "xhttp":
+	case "ws":
+		if !useTls {
+			return nil, common.NewCodeError(common.ErrCodeValidation, nil, "WebSocket behind Cloudflare needs an origin certificate")
+		}
+		preset = "ws-tls-cloudflare"
+	default:
+		return nil, common.NewCodeError(common.ErrCodeValidation, nil, "unknown CDN transport:", options.Transport)
+	}
+	port := options.Port
+	if port == 0 {
+		port = 80
+		if useTls {
+			port = 443
+		}
+	}
+	if useTls && !slices.Contains(cloudflareHTTPSPorts, port) {
+		return nil, common.NewCodeError(common.ErrCodeValidation, nil, "Cloudflare does not proxy HTTPS on port", port)
+	}
+	if !useTls && !slices.Contains(cloudflareHTTPPorts, port) {
+		return nil, common.NewCodeError(common.ErrCodeValidation, nil, "Cloudflare does not proxy HTTP on port", port)
+	}
+	provider, err := s.cdnProvider(options.ApiToken)
+	if err != nil {
+		return nil, err
+	}
+	ipv4, ipv6, err := s.dnsService.publicAddresses()
+	if err != nil {
+		return nil, err
+	}
+
+	inbound, err := BuildPresetInbound(InboundPresetOptions{
+		Preset:   preset,
+		Remark:   options.Remark,
+		Port:     port,
+		Domain:   options.Domain,
+		CertFile: options.CertFile,
+		KeyFile:  options.KeyFile,
+		Email:    options.Email,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Behind Flexible SSL Cloudflare takes HTTPS on 443 to an origin on 80, on other ports it
+	// passes the scheme and port through.
+	proxy := map[string]any{"forceTls": "same", "dest": options.Domain, "port": port, "remark": ""}
+	if !useTls && port == 80 {
+		proxy["forceTls"] = "tls"
+		proxy["port"] = 443
+	}
+	if err := setExternalProxy(inbound, proxy); err != nil {
+		return nil, err
+	}
+	inbound.UserId = options.UserId
+	inbound.Tag = fmt.Sprintf("inbound-%v", inbound.Port)
+	inbound, _, err = s.inboundService.AddInbound(inbound)
+	if err != nil {
+		return nil, err
+	}
+	clients, err := s.inboundService.GetClients(inbound)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &entity.CdnSetup{InboundId: inbound.Id, Email: clients[0].Email, SslMode: "flexible", Records: []entity.DNSRecord{}}
+	if useTls {
+		result.SslMode = "full"
+	}
+	for _, record := range []entity.DNSRecord{
+		{Type: "A", Name: options.Domain, Content: ipv4, Proxied: true},
+		{Type: "AAAA", Name: options.Domain, Content: ipv6, Proxied: true},
+	} {
+		if record.Content == "" {
+			continue
+		}
+		if err := provider.UpsertRecord(record); err != nil {
+			return nil, err
+		}
+		result.Records = append(result.Records, record)
+	}
+	if err := s.xrayService.RestartXray(false); err != nil {
+		logger.Warning("Restarting Xray for the CDN inbound failed:", err)
+	}
+	for attempt := 0; attempt < 3; attempt++ {
+		if attempt > 0 {
+			time.Sleep(5 * time.Second)
+		}
+		if result.Check = CheckCdn(inbound); result.Check.Reachable {
+			break
+		}
+	}
+
+	remarkOptions, err := s.settingService.GetRemarkOptions()
+	if err != nil {
+		logger.Warning("Unable to get remark settings, using defaults:", err)
+	}
+	result.Link = link.Generate(inbound, result.Email, link.Options{Address: options.Domain, Remark: remarkOptions.Func()})
+	if subEnable, _ := s.settingService.GetSubEnable(); subEnable {
+		if subURI, _ := s.settingService.GetSubURI(); subURI != "" {
+			result.SubURL = subURI + clients[0].SubID
+		}
+	}
+	return result, nil
+}
+
+// CheckInboundCdn checks that an inbound is reachable through the CDN of its external proxy.
+func (s *CdnSetupService) CheckInboundCdn(id int) (*entity.CdnCheck, error) {
+	inbound, err := s.inboundService.GetInbound(id)
+	if err != nil {
+		return nil, err
+	}
+	check := CheckCdn(inbound)
+	return &check, nil
+}
+
+// setExternalProxy makes the proxy the only external proxy of the inbound.
+func setExternalProxy(inbound *model.Inbound, proxy map[string]any) error {
+	stream := map[string]any{}
+	if err := json.Unmarshal([]byte(inbound.StreamSettings), &stream); err != nil {
+		return err
+	}
+	stream["externalProxy"] = []any{proxy}
+	data, err := json.MarshalIndent(stream, "", "  ")
+	if err != nil {
+		return err
+	}
+	inbound.StreamSettings = string(data)
+	return nil
+}
+
+// CheckCdn requests the WebSocket or XHTTP path of an inbound through its first external proxy.
+// The inbound counts as reachable when Cloudflare answers with anything but its own errors for
+// an unreachable origin (520 to 530).
+func CheckCdn(inbound *model.Inbound) entity.CdnCheck {
+	var stream struct {
+		Network       string `json:"network"`
+		ExternalProxy []struct {
+			ForceTls string `json:"forceTls"`
+			Dest     string `json:"dest"`
+			Port     int    `json:"port"`
+		} `json:"externalProxy"`
+		Security   string `json:"security"`
+		WsSettings struct {
+			Path string `json:"path"`
+		} `json:"wsSettings"`
+		XhttpSettings struct {
+			Path string `json:"path"`
+		} `json:"xhttpSettings"`
+	}
+	check := entity.CdnCheck{}
+	if err := json.Unmarshal([]byte(inbound.StreamSettings), &stream); err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	if len(stream.ExternalProxy) == 0 {
+		check.Error = "the inbound has no external proxy"
+		return check
+	}
+	proxy := stream.ExternalProxy[0]
+	path := stream.XhttpSettings.Path
+	if stream.Network == "ws" {
+		path = stream.WsSettings.Path
+	}
+	scheme := "http"
+	if proxy.ForceTls == "tls" || (proxy.ForceTls == "same" && stream.Security == "tls") {
+		scheme = "https"
+	}
+	check.URL = fmt.Sprintf("%s://%s:%d%s", scheme, proxy.Dest, proxy.Port, path)
+
+	resp, err := cdnCheckClient.Get(check.URL)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	resp.Body.Close()
+	check.Status = resp.StatusCode
+	check.ViaCdn = resp.Header.Get("CF-Ray") != ""
+	check.Reachable = check.ViaCdn && (resp.StatusCode < 520 || resp.StatusCode > 530)
+	switch {
+	case !check.ViaCdn:
+		check.Error = "the domain is not proxied by Cloudflare yet"
+	case !check.Reachable:
+		check.Error = fmt.Sprintf("Cloudflare could not reach the inbound (%d), check the SSL/TLS mode and the firewall", resp.StatusCode)
+	}
+	return check
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/xray"
+)
+
+// ClientExportColumns are the columns a client export can have. Quota and traffic are in GB and
+// times in the panel time zone, so an export with the import columns can be imported again.
+var ClientExportColumns = []string{
+	"inbound", "email", "uuid", "enable", "quota", "usage", "up", "down", "adjusted", "expiry",
+	"lastOnline", "subId", "subLink", "tgId", "comment",
+}
+
+// DefaultClientExportColumns are the columns exported when none are chosen.
+var DefaultClientExportColumns = []string{"email", "uuid", "usage", "expiry", "lastOnline", "subLink"}
+
+// clientExportTimeLayout is how times are written in client exports.
+const clientExportTimeLayout = "2006-01-02 15:04"
+
+// ExportClients returns the clients of the user's inbounds, or of the listed ones of them, as a
+// table with the chosen columns under a header row.
+func (s *InboundService) ExportClients(userId int, inboundIds []int, columns []string) ([][]string, error) {
+	if len(columns) == 0 {
+		columns = DefaultClientExportColumns
+	}
+	for _, column := range columns {
+		if !slices.Contains(ClientExportColumns, column) {
+			return nil, common.NewCodeError(common.ErrCodeValidation, nil, "unknown client export column:", column)
+		}
+	}
+	inbounds, err := s.GetInbounds(userId)
+	if err != nil {
+		return nil, err
+	}
+	if len(inboundIds) > 0 {
+		selected := make([]*model.Inbound, 0, len(inboundIds))
+		for _, id := range inboundIds {
+			index := slices.IndexFunc(inbounds, func(inbound *model.Inbound) bool { return inbound.Id == id })
+			if index < 0 {
+				return nil, common.NewCodeError(common.ErrCodeInboundNotFound, map[string]any{"id": id}, "inbound not found:", id)
+			}
+			selected = append(selected, inbounds[index])
+		}
+		inbounds = selected
+	}
+
+	var settingService SettingService
+	loc, err := settingService.GetTimeLocation()
+	if err != nil {
+		return nil, err
+	}
+	formatTime := func(ms int64) string {
+		if ms <= 0 {
+			return ""
+		}
+		return time.UnixMilli(ms).In(loc).Format(clientExportTimeLayout)
+	}
+	formatGB := func(bytes int64) string {
+		return strconv.FormatFloat(float64(bytes)/(1<<30), 'f', -1, 64)
+	}
+	subURI := ""
+	if subEnable, _ := settingService.GetSubEnable(); subEnable {
+		if subURI, _ = settingService.GetSubURI(); subURI == "" {
+			subURI, _ = subscriptionURLs(&settingService, "")
+		}
+	}
+
+	// Net manual traffic corrections, for billing reports that show support credits
+	adjusted := map[string]int64{}
+	if slices.Contains(columns, "adjusted") {
+		var emails []string
+		for _, inbound := range inbounds {
+			for _, stats := range inbound.ClientStats {
+				emails = append(emails, stats.Email)
+			}
+		}
+		if adjusted, err = getAdjustedTraffic(database.GetDB(), emails); err != nil {
+			return nil, err
+		}
+	}
+
+	rows := [][]string{columns}
+	for _, inbound := range inbounds {
+		clients, err := s.GetClients(inbound)
+		if err != nil {
+			return nil, err
+		}
+		for _, client := range clients {
+			var traffic xray.ClientTraffic
+			for _, stats := range inbound.ClientStats {
+				if strings.EqualFold(stats.Email, client.Email) {
+					traffic = stats
+					break
+				}
+			}
+			row := make([]string, len(columns))
+			for i, column := range columns {
+				switch column {
+				case "inbound":
+					row[i] = inbound.Remark
+				case "email":
+					row[i] = client.Email
+				case "uuid":
+					row[i] = client.ID
+					if row[i] == "" {
+						row[i] = client.Password
+					}
+				case "enable":
+					row[i] = strconv.FormatBool(client.Enable)
+				case "quota":
+					row[i] = formatGB(client.TotalGB)
+				case "usage":
+					row[i] = formatGB(traffic.Up + traffic.Down)
+				case "up":
+					row[i] = formatGB(traffic.Up)
+				case "down":
+					row[i] = formatGB(traffic.Down)
+				case "adjusted":
+					row[i] = formatGB(adjusted[traffic.Email])
+				case "expiry":
+					// A negative expiry counts days from the first connection, as the import reads it
+					if client.ExpiryTime < 0 {
+						row[i] = strconv.FormatInt(client.ExpiryTime/int64(24*time.Hour/time.Millisecond), 10)
+					} else {
+						row[i] = formatTime(client.ExpiryTime)
+					}
+				case "lastOnline":
+					row[i] = formatTime(traffic.LastOnline)
+				case "subId":
+					row[i] = client.SubID
+				case "subLink":
+					if subURI != "" && client.SubID != "" {
+						row[i] = subURI + client.SubID
+					}
+				case "tgId":
+					if client.TgID != 0 {
+						row[i] = strconv.FormatInt(client.TgID, 10)
+					}
+				case "comment":
+					row[i] = client.Comment
+				}
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"slices"
+
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+)
+
+// utlsFingerprints lists the uTLS fingerprints Xray clients accept.
+var utlsFingerprints = []string{
+	"chrome", "firefox", "safari", "ios", "android", "edge", "360", "qq",
+	"random", "randomized", "randomizednoalpn", "unsafe",
+}
+
+// checkClientFingerprints checks the uTLS fingerprints of the clients of an inbound. An empty
+// fingerprint keeps the one of the inbound.
+func (s *InboundService) checkClientFingerprints(inbound *model.Inbound) error {
+	clients, err := s.GetClients(inbound)
+	if err != nil {
+		return err
+	}
+	for _, client := range clients {
+		if client.Fingerprint != "" && !slices.Contains(utlsFingerprints, client.Fingerprint) {
+			return common.NewError("unknown uTLS fingerprint:", client.Fingerprint)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,360 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/util/random"
+	"github.com/mhsanaei/3x-ui/v2/util/spreadsheet"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+)
+
+// How an import handles rows for clients the inbound already has.
+const (
+	ImportSkipDuplicates   = "skip"   // Leave the existing client alone
+	ImportUpdateDuplicates = "update" // Update the existing client with the columns of the row
+	ImportRejectDuplicates = "error"  // Report the row as an error
+)
+
+// maxClientImportRows bounds the number of clients imported at once.
+const maxClientImportRows = 10000
+
+// clientImportColumns are the columns of an import file, in the order they are read when the
+// file has no header row.
+var clientImportColumns = []string{"email", "quota", "expiry", "tgid", "comment"}
+
+// clientImportHeaders maps other header names to the columns they stand for.
+var clientImportHeaders = map[string]string{
+	"totalgb":    "quota",
+	"expirytime": "expiry",
+	"expires":    "expiry",
+	"telegram":   "tgid",
+	"telegramid": "tgid",
+	"note":       "comment",
+}
+
+// clientImportRow is a row of an import file to apply.
+type clientImportRow struct {
+	result *entity.ClientImportRow
+	client model.Client
+}
+
+// ImportClients creates the clients listed in a CSV file or XLSX workbook on an inbound. Columns
+// are email, quota in GB, expiry, Telegram user ID and comment, matched by a header row when the
+// first row names an email column and taken in that order otherwise. Rows for clients the
+// inbound has already are handled as onDuplicate says, and rows that fail validation are reported
+// without stopping the others. A dry run only reports what the import would do.
+// Returns the outcome of every row and whether Xray needs restart.
+func (s *InboundService) ImportClients(inboundId int, data []byte, onDuplicate string, dryRun bool) (*entity.ClientImportResult, bool, error) {
+	switch onDuplicate {
+	case "":
+		onDuplicate = ImportSkipDuplicates
+	case ImportSkipDuplicates, ImportUpdateDuplicates, ImportRejectDuplicates:
+	default:
+		return nil, false, common.NewCodeError(common.ErrCodeValidation, nil, "invalid duplicate handling:", onDuplicate)
+	}
+	inbound, err := s.GetInbound(inboundId)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := s.checkPresetInbound(inboundId); err != nil {
+		return nil, false, common.WithCode(common.ErrCodeValidation, err)
+	}
+	rows, err := spreadsheet.Read(data)
+	if err != nil {
+		return nil, false, common.NewCodeError(common.ErrCodeValidation, nil, "unable to read the file:", err)
+	}
+
+	// A header row names the columns
+	columns := map[string]int{}
+	for i, name := range clientImportColumns {
+		columns[name] = i
+	}
+	first := 0
+	if len(rows) > 0 && isClientImportHeader(rows[0]) {
+		columns = map[string]int{}
+		for i, cell := range rows[0] {
+			name := strings.NewReplacer(" ", "", "_", "", "-", "").Replace(strings.ToLower(strings.TrimSpace(cell)))
+			if alias, ok := clientImportHeaders[name]; ok {
+				name = alias
+			}
+			if _, ok := columns[name]; !ok {
+				columns[name] = i
+			}
+		}
+		first = 1
+	}
+	if len(rows) == first {
+		return nil, false, common.NewCodeError(common.ErrCodeValidation, nil, "the file lists no clients")
+	}
+	if len(rows)-first > maxClientImportRows {
+		return nil, false, common.NewCodeError(common.ErrCodeValidation, nil, "the file lists more than", maxClientImportRows, "clients")
+	}
+
+	var settingService SettingService
+	loc, err := settingService.GetTimeLocation()
+	if err != nil {
+		return nil, false, err
+	}
+	existing, err := s.GetClients(inbound)
+	if err != nil {
+		return nil, false, err
+	}
+	inboundEmails := map[string]model.Client{}
+	for _, client := range existing {
+		inboundEmails[strings.ToLower(client.Email)] = client
+	}
+	allEmails, err := s.getAllEmails()
+	if err != nil {
+		return nil, false, err
+	}
+	usedEmails := map[string]bool{}
+	for _, email := range allEmails {
+		usedEmails[strings.ToLower(email)] = true
+	}
+
+	// Rows has room for every row, so the pointers into it stay valid
+	result := &entity.ClientImportResult{DryRun: dryRun, Rows: make([]entity.ClientImportRow, 0, len(rows)-first)}
+	var creates, updates []clientImportRow
+	seen := map[string]bool{}
+	now := time.Now()
+	for i, row := range rows[first:] {
+		cell := func(name string) (string, bool) {
+			index, ok := columns[name]
+			if !ok || index >= len(row) {
+				return "", ok
+			}
+			return strings.TrimSpace(row[index]), true
+		}
+		email, _ := cell("email")
+		rowResult := entity.ClientImportRow{Row: first + i + 1, Email: email}
+		client, err := parseClientImportRow(cell, now, loc)
+		lowerEmail := strings.ToLower(email)
+		switch {
+		case err != nil:
+		case seen[lowerEmail]:
+			err = common.NewError("the email is listed more than once")
+		case inboundEmails[lowerEmail].Email != "":
+			switch onDuplicate {
+			case ImportSkipDuplicates:
+				rowResult.Action = "skip"
+				rowResult.Error = "the client exists already"
+			case ImportUpdateDuplicates:
+				rowResult.Action = "update"
+				client.Email = inboundEmails[lowerEmail].Email
+			default:
+				err = common.NewError("the client exists already")
+			}
+		case usedEmails[lowerEmail]:
+			err = common.NewError("the email is used by a client of another inbound")
+		default:
+			rowResult.Action = "create"
+		}
+		if email != "" {
+			seen[lowerEmail] = true
+		}
+		if err != nil {
+			rowResult.Action = "error"
+			rowResult.Error = err.Error()
+		}
+		result.Rows = append(result.Rows, rowResult)
+		switch rowResult.Action {
+		case "create":
+			creates = append(creates, clientImportRow{result: &result.Rows[len(result.Rows)-1], client: client})
+		case "update":
+			updates = append(updates, clientImportRow{result: &result.Rows[len(result.Rows)-1], client: client})
+		}
+	}
+
+	needRestart := false
+	if !dryRun {
+		if needRestart, err = s.createImportedClients(inbound, creates); err != nil {
+			return nil, false, err
+		}
+		restart, err := s.updateImportedClients(inbound.Id, updates, columns)
+		needRestart = needRestart || restart
+		if err != nil {
+			return nil, needRestart, err
+		}
+	}
+
+	for _, row := range result.Rows {
+		switch row.Action {
+		case "create":
+			result.Created++
+		case "update":
+			result.Updated++
+		case "skip":
+			result.Skipped++
+		default:
+			result.Failed++
+		}
+	}
+	return result, needRestart, nil
+}
+
+// isClientImportHeader reports whether a row names the columns rather than listing a client.
+func isClientImportHeader(row []string) bool {
+	for _, cell := range row {
+		if strings.EqualFold(strings.TrimSpace(cell), "email") {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClientImportRow reads the client of an import row.
+func parseClientImportRow(cell func(string) (string, bool), now time.Time, loc *time.Location) (model.Client, error) {
+	client := model.Client{Enable: true}
+	client.Email, _ = cell("email")
+	if client.Email == "" {
+		return client, common.NewError("the email is empty")
+	}
+	if strings.ContainsAny(client.Email, " \t\"") {
+		return client, common.NewError("the email contains spaces or quotes")
+	}
+	if quota, _ := cell("quota"); quota != "" {
+		gb, err := strconv.ParseFloat(strings.ReplaceAll(quota, ",", "."), 64)
+		if err != nil || gb < 0 || math.IsInf(gb, 0) {
+			return client, fmt.Errorf("invalid quota %q", quota)
+		}
+		client.TotalGB = int64(gb * (1 << 30))
+	}
+	if expiry, _ := cell("expiry"); expiry != "" {
+		expiryTime, err := parseImportExpiry(expiry, now, loc)
+		if err != nil {
+			return client, err
+		}
+		client.ExpiryTime = expiryTime
+	}
+	if tgId, _ := cell("tgid"); tgId != "" {
+		id, err := strconv.ParseInt(tgId, 10, 64)
+		if err != nil {
+			return client, fmt.Errorf("invalid Telegram user ID %q", tgId)
+		}
+		client.TgID = id
+	}
+	client.Comment, _ = cell("comment")
+	return client, nil
+}
+
+// parseImportExpiry reads an expiry given as a date, a number of days from now, a negative number
+// of days counted from the first connection, a Unix timestamp in milliseconds or a date as Excel
+// stores it. Returns the expiry time as the client stores it, 0 for never.
+func parseImportExpiry(value string, now time.Time, loc *time.Location) (int64, error) {
+	const day = float64(24 * time.Hour)
+	if n, err := strconv.ParseFloat(value, 64); err == nil && !math.IsInf(n, 0) {
+		switch {
+		case n == 0:
+			return 0, nil
+		case n <= -10000:
+		case n < 0:
+			return int64(n * day / float64(time.Millisecond)), nil
+		case n < 10000:
+			return now.Add(time.Duration(n * day)).UnixMilli(), nil
+		case n < 1000000:
+			// Excel counts days from the end of 1899
+			return time.Date(1899, 12, 30, 0, 0, 0, 0, loc).Add(time.Duration(n * day)).UnixMilli(), nil
+		default:
+			return int64(n), nil
+		}
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02", "2006/01/02", "02.01.2006"} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t.UnixMilli(), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid expiry %q", value)
+}
+
+// createImportedClients adds the new clients of an import to the inbound at once.
+// Returns whether Xray needs restart.
+func (s *InboundService) createImportedClients(inbound *model.Inbound, rows []clientImportRow) (bool, error) {
+	if len(rows) == 0 {
+		return false, nil
+	}
+	clients := make([]model.Client, 0, len(rows))
+	for _, row := range rows {
+		client := row.client
+		if err := generateClientCredentials(inbound, &client); err != nil {
+			return false, err
+		}
+		client.SubID = random.Seq(16)
+		clients = append(clients, client)
+	}
+	settings, err := json.Marshal(map[string][]model.Client{"clients": clients})
+	if err != nil {
+		return false, err
+	}
+	return s.AddInboundClient(&model.Inbound{Id: inbound.Id, Settings: string(settings)})
+}
+
+// updateImportedClients sets the columns listed in the import file on the existing clients,
+// reporting the rows whose update failed. Returns whether Xray needs restart.
+func (s *InboundService) updateImportedClients(inboundId int, rows []clientImportRow, columns map[string]int) (bool, error) {
+	needRestart := false
+	for _, row := range rows {
+		inbound, err := s.GetInbound(inboundId)
+		if err != nil {
+			return needRestart, err
+		}
+		var settings map[string]any
+		if err := json.Unmarshal([]byte(inbound.Settings), &settings); err != nil {
+			return needRestart, err
+		}
+		rawClients, _ := settings["clients"].([]any)
+		var rawClient map[string]any
+		for _, c := range rawClients {
+			if m, ok := c.(map[string]any); ok && m["email"] == row.client.Email {
+				rawClient = m
+				break
+			}
+		}
+		if rawClient == nil {
+			row.result.Action = "error"
+			row.result.Error = "the client no longer exists"
+			continue
+		}
+
+		var clientId string
+		switch inbound.Protocol {
+		case model.Trojan:
+			clientId, _ = rawClient["password"].(string)
+		case model.Shadowsocks:
+			clientId = row.client.Email
+		default:
+			clientId, _ = rawClient["id"].(string)
+		}
+		if _, ok := columns["quota"]; ok {
+			rawClient["totalGB"] = row.client.TotalGB
+		}
+		if _, ok := columns["expiry"]; ok {
+			rawClient["expiryTime"] = row.client.ExpiryTime
+		}
+		if _, ok := columns["tgid"]; ok {
+			rawClient["tgId"] = row.client.TgID
+		}
+		if _, ok := columns["comment"]; ok {
+			rawClient["comment"] = row.client.Comment
+		}
+		rawClient["updated_at"] = time.Now().UnixMilli()
+
+		data, err := json.Marshal(map[string][]any{"clients": {rawClient}})
+		if err != nil {
+			return needRestart, err
+		}
+		restart, err := s.UpdateInboundClient(&model.Inbound{Id: inbound.Id, Settings: string(data)}, clientId)
+		needRestart = needRestart || restart
+		if err != nil {
+			row.result.Action = "error"
+			row.result.Error = err.Error()
+		}
+	}
+	return needRestart, nil
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/xray"
+)
+
+// PauseClient disables a client and remembers when it was paused, keeping its traffic counters.
+// Returns whether Xray needs restart.
+func (s *InboundService) PauseClient(email string) (bool, error) {
+	traffic, _, err := s.GetClientInboundByEmail(email)
+	if err != nil {
+		return false, err
+	}
+	if traffic == nil {
+		return false, common.NewCodeError(common.ErrCodeClientNotFound, map[string]any{"email": email}, "Client Not Found For Email:", email)
+	}
+	if traffic.PausedAt > 0 {
+		return false, common.NewError("client is already paused:", email)
+	}
+
+	_, needRestart, err := s.SetClientEnableByEmail(email, false)
+	if err != nil {
+		return needRestart, err
+	}
+	err = database.GetDB().Model(xray.ClientTraffic{}).Where("email = ?", email).
+		Update("paused_at", time.Now().UnixMilli()).Error
+	return needRestart, err
+}
+
+// ResumeClient re-enables a paused client and extends its expiry time by the length of the pause,
+// so the remaining days are the same as when it was paused. Timers that have not started yet are kept.
+// Returns whether Xray needs restart.
+func (s *InboundService) ResumeClient(email string) (bool, error) {
+	traffic, _, err := s.GetClientInboundByEmail(email)
+	if err != nil {
+		return false, err
+	}
+	if traffic == nil {
+		return false, common.NewCodeError(common.ErrCodeClientNotFound, map[string]any{"email": email}, "Client Not Found For Email:", email)
+	}
+	if traffic.PausedAt == 0 {
+		return false, common.NewError("client is not paused:", email)
+	}
+
+	needRestart := false
+	if traffic.ExpiryTime > 0 {
+		paused := time.Now().UnixMilli() - traffic.PausedAt
+		needRestart, err = s.ResetClientExpiryTimeByEmail(email, traffic.ExpiryTime+paused)
+		if err != nil {
+			return needRestart, err
+		}
+	}
+	_, restart, err := s.SetClientEnableByEmail(email, true)
+	needRestart = needRestart || restart
+	if err != nil {
+		return needRestart, err
+	}
+	err = database.GetDB().Model(xray.ClientTraffic{}).Where("email = ?", email).
+		Update("paused_at", 0).Error
+	return needRestart, err
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"slices"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/xray"
+)
+
+// Bulk actions that can be applied to all clients carrying a tag.
+const (
+	ClientActionEnable       = "enable"
+	ClientActionDisable      = "disable"
+	ClientActionResetTraffic = "resetTraffic"
+	ClientActionDelete       = "delete"
+)
+
+var clientActions = []string{ClientActionEnable, ClientActionDisable, ClientActionResetTraffic, ClientActionDelete}
+
+// GetClientTags returns every tag in use with the number of clients carrying it.
+func (s *InboundService) GetClientTags() (map[string]int, error) {
+	db := database.GetDB()
+	var tagLists []xray.TagList
+	err := db.Model(xray.ClientTraffic{}).Where("tags <> ''").Pluck("tags", &tagLists).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int{}
+	for _, tags := range tagLists {
+		for _, tag := range tags {
+			counts[tag]++
+		}
+	}
+	return counts, nil
+}
+
+// GetClientTrafficsByTags returns the traffic records of clients carrying all of the given tags.
+func (s *InboundService) GetClientTrafficsByTags(tags []string) ([]*xray.ClientTraffic, error) {
+	tags = xray.NewTagList(tags)
+	if len(tags) == 0 {
+		return nil, common.NewError("no tag given")
+	}
+	db := database.GetDB()
+	query := db.Model(xray.ClientTraffic{})
+	for _, tag := range tags {
+		query = query.Where("tags LIKE ?", xray.TagPattern(tag))
+	}
+	var traffics []*xray.ClientTraffic
+	if err := query.Order("inbound_id, id").Find(&traffics).Error; err != nil {
+		return nil, err
+	}
+	return traffics, nil
+}
+
+// ApplyClientActionByTags applies a bulk action to all clients carrying all of the given tags.
+// Returns the number of affected clients and whether Xray needs restart.
+// The action stops at the first error; clients handled before it keep their new state.
+func (s *InboundService) ApplyClientActionByTags(tags []string, action string) (int, bool, error) {
+	if !slices.Contains(clientActions, action) {
+		return 0, false, common.NewError("invalid client action:", action)
+	}
+	traffics, err := s.GetClientTrafficsByTags(tags)
+	if err != nil {
+		return 0, false, err
+	}
+
+	affected := 0
+	needRestart := false
+	for _, traffic := range traffics {
+		var changed, restart bool
+		switch action {
+		case ClientActionEnable, ClientActionDisable:
+			changed, restart, err = s.SetClientEnableByEmail(traffic.Email, action == ClientActionEnable)
+		case ClientActionResetTraffic:
+			restart, err = s.ResetClientTraffic(traffic.InboundId, traffic.Email)
+			changed = err == nil
+		case ClientActionDelete:
+			restart, err = s.DelInboundClientByEmail(traffic.InboundId, traffic.Email)
+			changed = err == nil
+		}
+		needRestart = needRestart || restart
+		if err != nil {
+			return affected, needRestart, common.NewErrorf("%s %s: %v", action, traffic.Email, err)
+		}
+		if changed {
+			affected++
+		}
+	}
+	return affected, needRestart, nil
+}
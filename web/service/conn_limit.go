@@ -0,0 +1,121 @@
+package service
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+)
+
+// connLimitChain is the iptables chain owned by the panel for connection limits.
+const connLimitChain = "XUI-CONNLIMIT"
+
+// ConnLimitService enforces the concurrent TCP connection limits of inbounds with the iptables connlimit match.
+// Xray has no connection limit of its own, so new connections above the limit are rejected
+// before they reach it. An inbound may cap its total connections and the connections per source IP.
+type ConnLimitService struct{}
+
+var (
+	connLimitLock  sync.Mutex
+	connLimitRules string
+)
+
+// Apply brings the iptables rules in line with the connection limits of the enabled inbounds.
+// iptables is only invoked when the limits changed since the last call.
+func (s *ConnLimitService) Apply() error {
+	db := database.GetDB()
+	var inbounds []*model.Inbound
+	err := db.Model(model.Inbound{}).
+		Where("enable = ? AND (conn_limit > 0 OR conn_limit_per_ip > 0)", true).
+		Order("id").Find(&inbounds).Error
+	if err != nil {
+		return err
+	}
+
+	var sb strings.Builder
+	for _, inbound := range inbounds {
+		fmt.Fprintf(&sb, "%d,%s:%d:%d\n", inbound.Port, inbound.ExtraPorts, inbound.ConnLimit, inbound.ConnLimitPerIp)
+	}
+	rules := sb.String()
+
+	connLimitLock.Lock()
+	defer connLimitLock.Unlock()
+	if rules == connLimitRules {
+		return nil
+	}
+
+	if _, err = exec.LookPath("iptables"); err != nil {
+		return common.NewError("iptables is required for connection limits:", err)
+	}
+	for _, bin := range []string{"iptables", "ip6tables"} {
+		if _, err := exec.LookPath(bin); err != nil {
+			continue
+		}
+		hostMask := "32"
+		if bin == "ip6tables" {
+			hostMask = "128"
+		}
+		if len(inbounds) == 0 {
+			clearIptablesChain(bin, connLimitChain)
+			continue
+		}
+		if err = resetIptablesChain(bin, connLimitChain, 1); err != nil {
+			return err
+		}
+		for _, inbound := range inbounds {
+			// Inbounds with extra ports are limited on each of their ports
+			for _, port := range inbound.ListenPorts() {
+				if inbound.ConnLimit > 0 {
+					if err = addConnLimitRule(bin, port, inbound.ConnLimit, "0"); err != nil {
+						return err
+					}
+				}
+				if inbound.ConnLimitPerIp > 0 {
+					if err = addConnLimitRule(bin, port, inbound.ConnLimitPerIp, hostMask); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	connLimitRules = rules
+	logger.Infof("Applied connection limits for %d inbounds", len(inbounds))
+	return nil
+}
+
+// resetIptablesChain creates or flushes a panel chain and hooks it into INPUT at the given position once.
+func resetIptablesChain(bin string, chain string, position int) error {
+	exec.Command(bin, "-N", chain).Run()
+	if output, err := exec.Command(bin, "-F", chain).CombinedOutput(); err != nil {
+		return common.NewErrorf("%s: %v: %s", bin, err, strings.TrimSpace(string(output)))
+	}
+	if exec.Command(bin, "-C", "INPUT", "-j", chain).Run() != nil {
+		if output, err := exec.Command(bin, "-I", "INPUT", strconv.Itoa(position), "-j", chain).CombinedOutput(); err != nil {
+			return common.NewErrorf("%s: %v: %s", bin, err, strings.TrimSpace(string(output)))
+		}
+	}
+	return nil
+}
+
+func addConnLimitRule(bin string, port int, limit int, mask string) error {
+	output, err := exec.Command(bin, "-A", connLimitChain, "-p", "tcp", "--syn", "--dport", strconv.Itoa(port),
+		"-m", "connlimit", "--connlimit-above", strconv.Itoa(limit), "--connlimit-mask", mask,
+		"-j", "REJECT", "--reject-with", "tcp-reset").CombinedOutput()
+	if err != nil {
+		return common.NewErrorf("%s: %v: %s", bin, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// clearIptablesChain removes a panel chain. A missing chain is not an error.
+func clearIptablesChain(bin string, chain string) {
+	exec.Command(bin, "-D", "INPUT", "-j", chain).Run()
+	exec.Command(bin, "-F", chain).Run()
+	exec.Command(bin, "-X", chain).Run()
+}
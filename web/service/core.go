@@ -0,0 +1,53 @@
+package service
+
+import (
+	"github.com/mhsanaei/3x-ui/v2/singbox"
+	"github.com/mhsanaei/3x-ui/v2/xray"
+)
+
+// Core types the panel can run its inbounds on.
+const (
+	CoreXray    = "xray"
+	CoreSingBox = "sing-box"
+)
+
+// Core is a proxy core process running the configuration the panel generates.
+type Core interface {
+	Start() error
+	Stop() error
+	IsRunning() bool
+	GetErr() error
+	GetResult() string
+	GetVersion() string
+	GetUptime() uint64
+	// GetAPIPort returns the port of the Xray API, 0 when the core has none and changes
+	// need a restart.
+	GetAPIPort() int
+	GetConfig() *xray.Config
+	GetOnlineClients() []string
+	SetOnlineClients(users []string)
+}
+
+// newCore creates the process of the core type for the configuration.
+func newCore(coreType string, xrayConfig *xray.Config) Core {
+	if coreType == CoreSingBox {
+		return singbox.NewProcess(xrayConfig)
+	}
+	return xray.NewProcess(xrayConfig)
+}
+
+// coreType returns the type of a core process.
+func coreType(core Core) string {
+	if _, ok := core.(*singbox.Process); ok {
+		return CoreSingBox
+	}
+	return CoreXray
+}
+
+// coreAPIPort returns the Xray API port of the running core, 0 when there is none.
+func coreAPIPort() int {
+	if p == nil {
+		return 0
+	}
+	return p.GetAPIPort()
+}
@@ -0,0 +1,311 @@
+package service
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/util/random"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+
+	"gorm.io/gorm"
+)
+
+// CustomerService manages customers, which own the clients sharing their subscription ID on
+// any number of inbounds under one quota and expiry.
+type CustomerService struct {
+	inboundService InboundService
+}
+
+// customerMember is a client of a customer with its traffic record.
+type customerMember struct {
+	SubId      string
+	InboundId  int
+	Tag        string
+	Email      string
+	Up         int64
+	Down       int64
+	Enable     bool
+	LastOnline int64
+}
+
+// getCustomerMembers returns the clients with one of the subscription IDs and their traffic.
+func getCustomerMembers(tx *gorm.DB, subIds []string) ([]customerMember, error) {
+	if len(subIds) == 0 {
+		return nil, nil
+	}
+	var members []customerMember
+	err := tx.Raw(`
+		SELECT client_traffics.sub_id AS sub_id, inbounds.id AS inbound_id, inbounds.tag AS tag,
+			client_traffics.email AS email, client_traffics.up AS up, client_traffics.down AS down,
+			client_traffics.enable AS enable, client_traffics.last_online AS last_online
+		FROM client_traffics
+		JOIN inbounds ON inbounds.id = client_traffics.inbound_id
+		WHERE client_traffics.sub_id IN ?
+		ORDER BY inbounds.id, client_traffics.email`, subIds).Scan(&members).Error
+	if err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// customerDepleted reports whether a customer used up its quota or expired.
+func customerDepleted(customer *model.Customer, used int64, now int64) bool {
+	return (customer.TotalGB > 0 && used >= customer.TotalGB) || (customer.ExpiryTime > 0 && customer.ExpiryTime <= now)
+}
+
+// disableDepletedCustomers disables the clients of the customers that used up their quota or
+// expired, however little traffic each client made on its own.
+func (s *InboundService) disableDepletedCustomers(tx *gorm.DB) (bool, int64, error) {
+	var customers []*model.Customer
+	if err := tx.Where("total_gb > 0 OR expiry_time > 0").Find(&customers).Error; err != nil {
+		return false, 0, err
+	}
+	subIds := make([]string, 0, len(customers))
+	for _, customer := range customers {
+		subIds = append(subIds, customer.SubId)
+	}
+	members, err := getCustomerMembers(tx, subIds)
+	if err != nil {
+		return false, 0, err
+	}
+	used := map[string]int64{}
+	for _, member := range members {
+		used[member.SubId] += member.Up + member.Down
+	}
+	now := time.Now().UnixMilli()
+	depleted := map[string]bool{}
+	for _, customer := range customers {
+		if customerDepleted(customer, used[customer.SubId], now) {
+			depleted[customer.SubId] = true
+		}
+	}
+
+	var disable []clientRef
+	for _, member := range members {
+		if member.Enable && depleted[member.SubId] {
+			disable = append(disable, clientRef{Tag: member.Tag, Email: member.Email})
+		}
+	}
+	return s.disableClientRefs(tx, disable)
+}
+
+func checkCustomer(customer *model.Customer) error {
+	customer.Name = strings.TrimSpace(customer.Name)
+	if customer.Name == "" {
+		return common.NewError("customer name can not be empty")
+	}
+	if customer.TotalGB < 0 {
+		return common.NewError("customer quota must not be negative:", customer.TotalGB)
+	}
+	if customer.ExpiryTime < 0 {
+		return common.NewError("customer expiry time must not be negative:", customer.ExpiryTime)
+	}
+	return nil
+}
+
+// GetCustomers returns all customers with the traffic of their clients.
+func (s *CustomerService) GetCustomers() ([]*entity.CustomerStats, error) {
+	var customers []*model.Customer
+	if err := database.GetDB().Model(model.Customer{}).Order("id").Find(&customers).Error; err != nil {
+		return nil, err
+	}
+	return s.getStats(customers)
+}
+
+// GetCustomer returns a customer with the traffic of its clients.
+func (s *CustomerService) GetCustomer(id int) (*entity.CustomerStats, error) {
+	customer := &model.Customer{}
+	if err := database.GetDB().First(customer, id).Error; err != nil {
+		return nil, err
+	}
+	stats, err := s.getStats([]*model.Customer{customer})
+	if err != nil {
+		return nil, err
+	}
+	return stats[0], nil
+}
+
+// GetCustomerBySubId returns the customer owning a subscription ID, or nil when there is none.
+func (s *CustomerService) GetCustomerBySubId(subId string) (*model.Customer, error) {
+	var customers []*model.Customer
+	if err := database.GetDB().Where("sub_id = ?", subId).Limit(1).Find(&customers).Error; err != nil {
+		return nil, err
+	}
+	if len(customers) == 0 {
+		return nil, nil
+	}
+	return customers[0], nil
+}
+
+func (s *CustomerService) getStats(customers []*model.Customer) ([]*entity.CustomerStats, error) {
+	subIds := make([]string, 0, len(customers))
+	for _, customer := range customers {
+		subIds = append(subIds, customer.SubId)
+	}
+	members, err := getCustomerMembers(database.GetDB(), subIds)
+	if err != nil {
+		return nil, err
+	}
+	emails := make([]string, 0, len(members))
+	for _, member := range members {
+		emails = append(emails, member.Email)
+	}
+	adjusted, err := getAdjustedTraffic(database.GetDB(), emails)
+	if err != nil {
+		return nil, err
+	}
+	onlineClients := s.inboundService.GetOnlineClients()
+	now := time.Now().UnixMilli()
+	result := make([]*entity.CustomerStats, 0, len(customers))
+	for _, customer := range customers {
+		stats := &entity.CustomerStats{Customer: *customer, Clients: []entity.CustomerClient{}}
+		for _, member := range members {
+			if member.SubId != customer.SubId {
+				continue
+			}
+			online := slices.Contains(onlineClients, member.Email)
+			stats.Clients = append(stats.Clients, entity.CustomerClient{
+				InboundId:  member.InboundId,
+				Email:      member.Email,
+				Up:         member.Up,
+				Down:       member.Down,
+				Adjusted:   adjusted[member.Email],
+				Enable:     member.Enable,
+				Online:     online,
+				LastOnline: member.LastOnline,
+			})
+			stats.Up += member.Up
+			stats.Down += member.Down
+			stats.Adjusted += adjusted[member.Email]
+			stats.Online = stats.Online || online
+			stats.LastOnline = max(stats.LastOnline, member.LastOnline)
+		}
+		stats.Depleted = customerDepleted(customer, stats.Up+stats.Down, now)
+		result = append(result, stats)
+	}
+	return result, nil
+}
+
+// checkSubIdFree fails when another customer owns the subscription ID.
+func checkSubIdFree(subId string, id int) error {
+	var count int64
+	err := database.GetDB().Model(model.Customer{}).Where("sub_id = ? AND id != ?", subId, id).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return common.WithCode(common.ErrCodeValidation, common.NewError("subscription ID already belongs to a customer:", subId))
+	}
+	return nil
+}
+
+// AddCustomer validates and stores a new customer. Clients already using its subscription ID
+// become its clients.
+func (s *CustomerService) AddCustomer(customer *model.Customer) error {
+	if err := checkCustomer(customer); err != nil {
+		return common.WithCode(common.ErrCodeValidation, err)
+	}
+	customer.SubId = strings.TrimSpace(customer.SubId)
+	if customer.SubId == "" {
+		customer.SubId = random.Seq(16)
+	}
+	if err := checkSubIdFree(customer.SubId, 0); err != nil {
+		return err
+	}
+	customer.Id = 0
+	customer.CreatedAt = time.Now().UnixMilli()
+	return database.GetDB().Create(customer).Error
+}
+
+// UpdateCustomer updates the name, quota, expiry and comment of a customer. Clients disabled
+// because the customer was depleted are enabled again when the new quota or expiry allows it.
+// Returns whether Xray needs a restart.
+func (s *CustomerService) UpdateCustomer(customer *model.Customer) (bool, error) {
+	if err := checkCustomer(customer); err != nil {
+		return false, common.WithCode(common.ErrCodeValidation, err)
+	}
+	db := database.GetDB()
+	old := &model.Customer{}
+	if err := db.First(old, customer.Id).Error; err != nil {
+		return false, err
+	}
+	old.Name = customer.Name
+	old.TotalGB = customer.TotalGB
+	old.ExpiryTime = customer.ExpiryTime
+	old.Comment = customer.Comment
+	if err := db.Save(old).Error; err != nil {
+		return false, err
+	}
+	*customer = *old
+	return s.enableWithinLimits(customer)
+}
+
+// enableWithinLimits enables the disabled clients of a customer that is not depleted, unless
+// they are paused or over their own limits.
+func (s *CustomerService) enableWithinLimits(customer *model.Customer) (bool, error) {
+	db := database.GetDB()
+	members, err := getCustomerMembers(db, []string{customer.SubId})
+	if err != nil {
+		return false, err
+	}
+	var used int64
+	for _, member := range members {
+		used += member.Up + member.Down
+	}
+	now := time.Now().UnixMilli()
+	if customerDepleted(customer, used, now) {
+		return false, nil
+	}
+	emails := make([]string, 0, len(members))
+	for _, member := range members {
+		emails = append(emails, member.Email)
+	}
+	return s.inboundService.enableWithinLimits(db, emails)
+}
+
+// DelCustomer deletes a customer. Its clients stay with their own quota and expiry.
+func (s *CustomerService) DelCustomer(id int) error {
+	return database.GetDB().Delete(model.Customer{}, id).Error
+}
+
+// AddCustomerClient creates a client with generated credentials and the subscription ID of the
+// customer on an inbound. The client has no quota or expiry of its own.
+// Returns the created client and whether Xray needs a restart.
+func (s *CustomerService) AddCustomerClient(id int, inboundId int, email string) (*model.Client, bool, error) {
+	customer := &model.Customer{}
+	if err := database.GetDB().First(customer, id).Error; err != nil {
+		return nil, false, err
+	}
+	_, client, needRestart, err := s.inboundService.AddPresetClient(inboundId, ClientPreset{
+		Email:   email,
+		SubID:   customer.SubId,
+		Comment: customer.Name,
+	})
+	return client, needRestart, err
+}
+
+// ResetCustomerTraffic resets the traffic of all clients of a customer and enables them again.
+// Returns whether Xray needs a restart.
+func (s *CustomerService) ResetCustomerTraffic(id int) (bool, error) {
+	customer := &model.Customer{}
+	if err := database.GetDB().First(customer, id).Error; err != nil {
+		return false, err
+	}
+	members, err := getCustomerMembers(database.GetDB(), []string{customer.SubId})
+	if err != nil {
+		return false, err
+	}
+	needRestart := false
+	for _, member := range members {
+		restart, err := s.inboundService.ResetClientTraffic(member.InboundId, member.Email)
+		if err != nil {
+			return needRestart, err
+		}
+		needRestart = needRestart || restart
+	}
+	return needRestart, nil
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+)
+
+// updateDDNS points the configured DDNS record at the given addresses. Empty addresses are skipped.
+func (s *PublicIPService) updateDDNS(ipv4 string, ipv6 string) error {
+	provider, err := s.settingService.GetDdnsProvider()
+	if err != nil || provider == "" {
+		return err
+	}
+	domain, err := s.settingService.GetDdnsDomain()
+	if err != nil {
+		return err
+	}
+	token, err := s.settingService.GetDdnsToken()
+	if err != nil {
+		return err
+	}
+	if domain == "" || token == "" {
+		return common.NewError("DDNS domain and token are required")
+	}
+
+	switch provider {
+	case "cloudflare":
+		zoneId, err := s.settingService.GetDdnsZoneId()
+		if err != nil {
+			return err
+		}
+		provider := &cloudflareProvider{token: token, zoneId: zoneId}
+		var errs []error
+		if ipv4 != "" {
+			errs = append(errs, provider.UpsertRecord(entity.DNSRecord{Type: "A", Name: domain, Content: ipv4}))
+		}
+		if ipv6 != "" {
+			errs = append(errs, provider.UpsertRecord(entity.DNSRecord{Type: "AAAA", Name: domain, Content: ipv6}))
+		}
+		return common.Combine(errs...)
+	case "duckdns":
+		return updateDuckDNS(token, domain, ipv4, ipv6)
+	default:
+		return common.NewError("unknown DDNS provider:", provider)
+	}
+}
+
+// updateDuckDNS updates a DuckDNS subdomain. The domain may be given with or without the duckdns.org suffix.
+func updateDuckDNS(token string, domain string, ipv4 string, ipv6 string) error {
+	query := url.Values{}
+	query.Set("domains", strings.TrimSuffix(domain, ".duckdns.org"))
+	query.Set("token", token)
+	if ipv4 != "" {
+		query.Set("ip", ipv4)
+	}
+	if ipv6 != "" {
+		query.Set("ipv6", ipv6)
+	}
+	resp, err := dnsClient.Get("https://www.duckdns.org/update?" + query.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(string(body), "OK") {
+		return common.NewErrorf("DuckDNS update failed: %d %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
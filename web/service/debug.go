@@ -0,0 +1,63 @@
+package service
+
+import (
+	"bytes"
+	"runtime"
+	"runtime/pprof"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+)
+
+// processStartTime is when the panel process started, for the uptime in the process stats.
+var processStartTime = time.Now()
+
+// DebugService collects the memory statistics of the panel process and dumps its goroutines and
+// heap, to find what grows in a long-running panel without a debug build.
+type DebugService struct{}
+
+// GetProcessStats returns the goroutines and memory statistics of the panel process.
+func (s *DebugService) GetProcessStats() *entity.ProcessStats {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	stats := &entity.ProcessStats{
+		GoVersion:   runtime.Version(),
+		Uptime:      int64(time.Since(processStartTime).Seconds()),
+		Goroutines:  runtime.NumGoroutine(),
+		HeapAlloc:   mem.HeapAlloc,
+		HeapInuse:   mem.HeapInuse,
+		HeapObjects: mem.HeapObjects,
+		Sys:         mem.Sys,
+		NumGC:       mem.NumGC,
+	}
+	if mem.LastGC > 0 {
+		stats.LastGC = time.Unix(0, int64(mem.LastGC)).UnixMilli()
+	}
+	return stats
+}
+
+// GetDump returns a goroutine dump with the full stack of every goroutine as text, or a heap
+// profile taken right after a garbage collection in the pprof format, with the file name to save
+// it as.
+func (s *DebugService) GetDump(kind string) (string, []byte, error) {
+	var buf bytes.Buffer
+	name := kind + "-" + time.Now().Format("20060102-150405")
+	switch kind {
+	case "goroutine":
+		name += ".txt"
+		if err := pprof.Lookup("goroutine").WriteTo(&buf, 2); err != nil {
+			return "", nil, err
+		}
+	case "heap":
+		name += ".pprof"
+		// Collect first so the profile shows live objects only
+		runtime.GC()
+		if err := pprof.Lookup("heap").WriteTo(&buf, 0); err != nil {
+			return "", nil, err
+		}
+	default:
+		return "", nil, common.NewCodeError(common.ErrCodeValidation, nil, "unknown dump:", kind)
+	}
+	return name, buf.Bytes(), nil
+}
@@ -0,0 +1,226 @@
+package service
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+)
+
+const (
+	// decoyProbeWindow is the time probes of an address are counted over for the ban threshold.
+	decoyProbeWindow = 10 * time.Minute
+	// decoyProbesMax is the number of recent probes kept for the API.
+	decoyProbesMax = 500
+	// decoyTrackedMax bounds the addresses probe counts and reputations are kept for.
+	decoyTrackedMax = 10000
+	// decoyReputationTTL is how long the reputation of an address is cached.
+	decoyReputationTTL = 24 * time.Hour
+	// decoyBadScore is the AbuseIPDB confidence score from which an address is banned on its
+	// first probe when banning is enabled.
+	decoyBadScore = 75
+)
+
+// decoyReputation is the cached AbuseIPDB score of an address.
+type decoyReputation struct {
+	score     int
+	checkedAt time.Time
+}
+
+var (
+	decoyLock        sync.Mutex
+	decoyProbes      []entity.DecoyProbe
+	decoyProbeTimes  = map[string][]time.Time{}
+	decoyBans        = map[string]*entity.DecoyBan{}
+	decoyReputations = map[string]*decoyReputation{}
+	// decoyLookups limits the concurrent reputation lookups, probes beyond it go unchecked.
+	decoyLookups = make(chan struct{}, 4)
+)
+
+// abuseIpdbClient is the HTTP client reputation lookups go through.
+var abuseIpdbClient = &http.Client{Timeout: 10 * time.Second}
+
+// DecoyService records requests probing the panel outside its secret base path. Probing
+// addresses are looked up on AbuseIPDB when a key is configured and banned once they probe too
+// often or have a bad reputation, if banning is enabled.
+type DecoyService struct {
+	settingService SettingService
+}
+
+// IsBanned reports whether requests from the address are to be dropped.
+func (s *DecoyService) IsBanned(ip string) bool {
+	decoyLock.Lock()
+	defer decoyLock.Unlock()
+	ban, ok := decoyBans[ip]
+	if ok && time.Now().UnixMilli() >= ban.Until {
+		delete(decoyBans, ip)
+		return false
+	}
+	return ok
+}
+
+// RecordProbe logs a probe, counts it towards the ban threshold of the address and looks up
+// the address in the background.
+func (s *DecoyService) RecordProbe(ip string, method string, path string, userAgent string) {
+	now := time.Now()
+	threshold, err := s.settingService.GetDecoyBanThreshold()
+	if err != nil {
+		threshold = 0
+	}
+
+	decoyLock.Lock()
+	score := -1
+	if reputation, ok := decoyReputations[ip]; ok && now.Sub(reputation.checkedAt) < decoyReputationTTL {
+		score = reputation.score
+	}
+	decoyProbes = append(decoyProbes, entity.DecoyProbe{
+		Ip:        ip,
+		Method:    method,
+		Path:      path,
+		UserAgent: userAgent,
+		Time:      now.UnixMilli(),
+		Score:     score,
+	})
+	if len(decoyProbes) > decoyProbesMax {
+		decoyProbes = slices.Clone(decoyProbes[len(decoyProbes)-decoyProbesMax:])
+	}
+	if len(decoyProbeTimes) >= decoyTrackedMax {
+		decoyProbeTimes = map[string][]time.Time{}
+	}
+	times := slices.DeleteFunc(decoyProbeTimes[ip], func(t time.Time) bool { return now.Sub(t) > decoyProbeWindow })
+	times = append(times, now)
+	decoyProbeTimes[ip] = times
+	decoyLock.Unlock()
+
+	logger.Warningf("Panel probe from %s (score %d): %s %s %q", ip, score, method, path, userAgent)
+	if threshold > 0 && len(times) >= threshold {
+		s.ban(ip, fmt.Sprintf("%d probes in %v", len(times), decoyProbeWindow))
+	}
+	if score < 0 {
+		s.lookup(ip, threshold > 0)
+	}
+}
+
+// ban drops the requests of the address for the configured time.
+func (s *DecoyService) ban(ip string, reason string) {
+	minutes, err := s.settingService.GetDecoyBanMinutes()
+	if err != nil || minutes < 1 {
+		minutes = 60
+	}
+	decoyLock.Lock()
+	_, banned := decoyBans[ip]
+	decoyBans[ip] = &entity.DecoyBan{
+		Ip:     ip,
+		Until:  time.Now().Add(time.Duration(minutes) * time.Minute).UnixMilli(),
+		Reason: reason,
+	}
+	decoyLock.Unlock()
+	if !banned {
+		logger.Warningf("Banned %s for %d minutes: %s", ip, minutes, reason)
+	}
+}
+
+// lookup fetches the AbuseIPDB score of the address in the background, banning it when the
+// score is bad and ban is set.
+func (s *DecoyService) lookup(ip string, ban bool) {
+	key, err := s.settingService.GetDecoyAbuseIpdbKey()
+	if err != nil || key == "" {
+		return
+	}
+	select {
+	case decoyLookups <- struct{}{}:
+	default:
+		return
+	}
+	go func() {
+		defer func() { <-decoyLookups }()
+		score, err := abuseIpdbScore(key, ip)
+		if err != nil {
+			logger.Warning("AbuseIPDB lookup of", ip, "failed:", err)
+			return
+		}
+		decoyLock.Lock()
+		if len(decoyReputations) >= decoyTrackedMax {
+			decoyReputations = map[string]*decoyReputation{}
+		}
+		decoyReputations[ip] = &decoyReputation{score: score, checkedAt: time.Now()}
+		for i := range decoyProbes {
+			if decoyProbes[i].Ip == ip {
+				decoyProbes[i].Score = score
+			}
+		}
+		decoyLock.Unlock()
+		logger.Infof("AbuseIPDB score of %s: %d", ip, score)
+		if ban && score >= decoyBadScore {
+			s.ban(ip, fmt.Sprintf("AbuseIPDB score %d", score))
+		}
+	}()
+}
+
+// abuseIpdbScore returns the abuse confidence score AbuseIPDB has for the address.
+func abuseIpdbScore(key string, ip string) (int, error) {
+	req, err := http.NewRequest(http.MethodGet, "https://api.abuseipdb.com/api/v2/check?maxAgeInDays=90&ipAddress="+url.QueryEscape(ip), nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Key", key)
+	req.Header.Set("Accept", "application/json")
+	resp, err := abuseIpdbClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("AbuseIPDB answered %s", resp.Status)
+	}
+	var result struct {
+		Data struct {
+			AbuseConfidenceScore int `json:"abuseConfidenceScore"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, err
+	}
+	return result.Data.AbuseConfidenceScore, nil
+}
+
+// GetProbes returns the most recent probes, newest first.
+func (s *DecoyService) GetProbes() []entity.DecoyProbe {
+	decoyLock.Lock()
+	probes := slices.Clone(decoyProbes)
+	decoyLock.Unlock()
+	slices.Reverse(probes)
+	return probes
+}
+
+// GetBans returns the addresses currently banned, the longest remaining ban first.
+func (s *DecoyService) GetBans() []entity.DecoyBan {
+	now := time.Now().UnixMilli()
+	decoyLock.Lock()
+	bans := make([]entity.DecoyBan, 0, len(decoyBans))
+	for ip, ban := range decoyBans {
+		if now >= ban.Until {
+			delete(decoyBans, ip)
+			continue
+		}
+		bans = append(bans, *ban)
+	}
+	decoyLock.Unlock()
+	slices.SortFunc(bans, func(a, b entity.DecoyBan) int { return cmp.Compare(b.Until, a.Until) })
+	return bans
+}
+
+// Unban lifts the ban of an address and forgets its probes.
+func (s *DecoyService) Unban(ip string) {
+	decoyLock.Lock()
+	defer decoyLock.Unlock()
+	delete(decoyBans, ip)
+	delete(decoyProbeTimes, ip)
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/util/random"
+
+	"gorm.io/gorm"
+)
+
+// DepositService manages deposit tokens, which let an external system such as a payment bot
+// create exactly one client per use on a preset inbound without holding an API key.
+type DepositService struct {
+	inboundService InboundService
+}
+
+func hashDepositToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetDepositTokens returns all deposit tokens.
+func (s *DepositService) GetDepositTokens() ([]*model.DepositToken, error) {
+	db := database.GetDB()
+	var tokens []*model.DepositToken
+	err := db.Model(model.DepositToken{}).Order("id desc").Find(&tokens).Error
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// AddDepositToken validates and stores a deposit token and returns the token string.
+// The token is not stored and can not be retrieved later.
+func (s *DepositService) AddDepositToken(depositToken *model.DepositToken) (string, error) {
+	if depositToken.MaxUses < 1 {
+		return "", common.NewError("invalid maxUses:", depositToken.MaxUses)
+	}
+	if depositToken.TotalGB < 0 || depositToken.ExpiryDays < 0 || depositToken.LimitIP < 0 {
+		return "", common.NewError("quota values can not be negative")
+	}
+	if err := s.inboundService.checkPresetInbound(depositToken.InboundId); err != nil {
+		return "", err
+	}
+
+	token := random.Seq(32)
+	depositToken.Id = 0
+	depositToken.TokenHash = hashDepositToken(token)
+	depositToken.Uses = 0
+	depositToken.CreatedAt = time.Now().UnixMilli()
+
+	db := database.GetDB()
+	if err := db.Create(depositToken).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// DelDepositToken deletes a deposit token. Clients created with it are kept.
+func (s *DepositService) DelDepositToken(id int) error {
+	db := database.GetDB()
+	return db.Delete(model.DepositToken{}, id).Error
+}
+
+// RedeemDepositToken creates a client with the token's preset quota on the token's inbound.
+// An empty email is replaced by a random one, a referral code attributes the client to its referrer.
+// Returns the inbound, the created client and whether Xray needs restart.
+func (s *DepositService) RedeemDepositToken(token string, email string, referral string) (*model.Inbound, *model.Client, bool, error) {
+	db := database.GetDB()
+	depositToken := &model.DepositToken{}
+	err := db.Model(model.DepositToken{}).Where("token_hash = ?", hashDepositToken(token)).First(depositToken).Error
+	if err != nil {
+		if database.IsNotFound(err) {
+			return nil, nil, false, common.NewError("invalid deposit token")
+		}
+		return nil, nil, false, err
+	}
+	if depositToken.ExpiresAt > 0 && depositToken.ExpiresAt < time.Now().UnixMilli() {
+		return nil, nil, false, common.NewError("deposit token expired")
+	}
+
+	// Claim a use before creating the client so concurrent redemptions can not exceed maxUses
+	result := db.Model(model.DepositToken{}).
+		Where("id = ? AND uses < max_uses", depositToken.Id).
+		Update("uses", gorm.Expr("uses + 1"))
+	if result.Error != nil {
+		return nil, nil, false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil, false, common.NewError("deposit token used up")
+	}
+
+	inbound, client, needRestart, err := s.inboundService.AddPresetClient(depositToken.InboundId, ClientPreset{
+		Email:      email,
+		TotalGB:    depositToken.TotalGB,
+		ExpiryDays: depositToken.ExpiryDays,
+		LimitIP:    depositToken.LimitIP,
+		Comment:    depositToken.Remark,
+		Referral:   referral,
+	})
+	if err != nil {
+		if releaseErr := db.Model(model.DepositToken{}).Where("id = ?", depositToken.Id).
+			Update("uses", gorm.Expr("uses - 1")).Error; releaseErr != nil {
+			logger.Warning("Unable to release deposit token use:", releaseErr)
+		}
+		return nil, nil, false, err
+	}
+	return inbound, client, needRestart, nil
+}
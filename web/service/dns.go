@@ -0,0 +1,263 @@
+package service
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+)
+
+// dnsClient is the HTTP client used for DNS and DDNS provider APIs.
+var dnsClient = &http.Client{Timeout: 15 * time.Second}
+
+// DNSProvider manages the records of a DNS hosting provider.
+type DNSProvider interface {
+	// UpsertRecord creates the record or updates the existing record of the same type and name.
+	UpsertRecord(record entity.DNSRecord) error
+	// DeleteRecord removes the records of the given type and name, only those with the given content when it is set.
+	DeleteRecord(record entity.DNSRecord) error
+}
+
+// DNSService manages DNS records for inbound domains and ACME DNS-01 challenges
+// through the DNS provider configured in the settings.
+type DNSService struct {
+	settingService SettingService
+}
+
+// GetProvider returns the configured DNS provider.
+func (s *DNSService) GetProvider() (DNSProvider, error) {
+	name, err := s.settingService.GetDnsProvider()
+	if err != nil {
+		return nil, err
+	}
+	token, err := s.settingService.GetDnsApiToken()
+	if err != nil {
+		return nil, err
+	}
+	zoneId, err := s.settingService.GetDnsZoneId()
+	if err != nil {
+		return nil, err
+	}
+	switch name {
+	case "":
+		return nil, common.NewCodeError(common.ErrCodeValidation, nil, "no DNS provider is configured")
+	case "cloudflare":
+		if token == "" {
+			return nil, common.NewCodeError(common.ErrCodeValidation, nil, "the DNS provider API token is not set")
+		}
+		return &cloudflareProvider{token: token, zoneId: zoneId}, nil
+	default:
+		return nil, common.NewError("unknown DNS provider:", name)
+	}
+}
+
+// checkRecord validates a record before it is sent to the provider.
+func checkRecord(record *entity.DNSRecord, needContent bool) error {
+	record.Type = strings.ToUpper(strings.TrimSpace(record.Type))
+	record.Name = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(record.Name)), ".")
+	record.Content = strings.TrimSpace(record.Content)
+	if record.Name == "" {
+		return common.NewCodeError(common.ErrCodeValidation, nil, "record name is required")
+	}
+	if needContent && record.Content == "" {
+		return common.NewCodeError(common.ErrCodeValidation, nil, "record content is required")
+	}
+	switch record.Type {
+	case "A":
+		if ip := net.ParseIP(record.Content); needContent && (ip == nil || ip.To4() == nil) {
+			return common.NewCodeError(common.ErrCodeValidation, nil, "A record needs an IPv4 address:", record.Content)
+		}
+	case "AAAA":
+		if ip := net.ParseIP(record.Content); needContent && (ip == nil || ip.To4() != nil) {
+			return common.NewCodeError(common.ErrCodeValidation, nil, "AAAA record needs an IPv6 address:", record.Content)
+		}
+	case "CNAME", "TXT":
+	default:
+		return common.NewCodeError(common.ErrCodeValidation, nil, "unsupported record type:", record.Type)
+	}
+	return nil
+}
+
+// SetRecord creates or updates a record.
+func (s *DNSService) SetRecord(record entity.DNSRecord) error {
+	if err := checkRecord(&record, true); err != nil {
+		return err
+	}
+	provider, err := s.GetProvider()
+	if err != nil {
+		return err
+	}
+	return provider.UpsertRecord(record)
+}
+
+// DeleteRecord removes a record.
+func (s *DNSService) DeleteRecord(record entity.DNSRecord) error {
+	if err := checkRecord(&record, false); err != nil {
+		return err
+	}
+	provider, err := s.GetProvider()
+	if err != nil {
+		return err
+	}
+	return provider.DeleteRecord(record)
+}
+
+// acmeChallengeRecord returns the TXT record of an ACME DNS-01 challenge.
+// Wildcard domains share the challenge name of their base domain.
+func acmeChallengeRecord(challenge entity.AcmeChallenge) (entity.DNSRecord, error) {
+	domain := strings.TrimPrefix(strings.TrimSuffix(strings.TrimSpace(challenge.Domain), "."), "*.")
+	if domain == "" {
+		return entity.DNSRecord{}, common.NewCodeError(common.ErrCodeValidation, nil, "challenge domain is required")
+	}
+	return entity.DNSRecord{
+		Type:    "TXT",
+		Name:    "_acme-challenge." + domain,
+		Content: strings.TrimSpace(challenge.Value),
+		TTL:     120,
+	}, nil
+}
+
+// PresentAcmeChallenge publishes the TXT record of an ACME DNS-01 challenge.
+func (s *DNSService) PresentAcmeChallenge(challenge entity.AcmeChallenge) error {
+	record, err := acmeChallengeRecord(challenge)
+	if err != nil {
+		return err
+	}
+	return s.SetRecord(record)
+}
+
+// CleanupAcmeChallenge removes the TXT record of an ACME DNS-01 challenge.
+// All challenge records of the domain are removed when no value is given.
+func (s *DNSService) CleanupAcmeChallenge(challenge entity.AcmeChallenge) error {
+	record, err := acmeChallengeRecord(challenge)
+	if err != nil {
+		return err
+	}
+	return s.DeleteRecord(record)
+}
+
+// inboundDomains returns the domain names an inbound is reached on: the TLS server name
+// and the external proxy destinations. IP addresses are skipped.
+func inboundDomains(inbound *model.Inbound) []string {
+	var stream struct {
+		Security    string `json:"security"`
+		TlsSettings struct {
+			ServerName string `json:"serverName"`
+		} `json:"tlsSettings"`
+		ExternalProxy []struct {
+			Dest string `json:"dest"`
+		} `json:"externalProxy"`
+	}
+	json.Unmarshal([]byte(inbound.StreamSettings), &stream)
+	candidates := []string{}
+	if stream.Security == "tls" {
+		candidates = append(candidates, stream.TlsSettings.ServerName)
+	}
+	for _, proxy := range stream.ExternalProxy {
+		candidates = append(candidates, proxy.Dest)
+	}
+
+	domains := []string{}
+	seen := map[string]bool{}
+	for _, domain := range candidates {
+		domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+		if domain == "" || !strings.Contains(domain, ".") || strings.Contains(domain, "*") || net.ParseIP(domain) != nil || seen[domain] {
+			continue
+		}
+		seen[domain] = true
+		domains = append(domains, domain)
+	}
+	return domains
+}
+
+// SyncInboundRecords points the domains of an inbound at this server, with a CNAME record to the
+// configured target or with A and AAAA records to the public addresses.
+func (s *DNSService) SyncInboundRecords(inbound *model.Inbound) ([]entity.DNSRecord, error) {
+	provider, err := s.GetProvider()
+	if err != nil {
+		return nil, err
+	}
+	domains := inboundDomains(inbound)
+	if len(domains) == 0 {
+		return nil, nil
+	}
+	proxied, err := s.settingService.GetDnsProxied()
+	if err != nil {
+		return nil, err
+	}
+	target, err := s.settingService.GetDnsCnameTarget()
+	if err != nil {
+		return nil, err
+	}
+	ipv4, ipv6 := "", ""
+	if target == "" {
+		if ipv4, ipv6, err = s.publicAddresses(); err != nil {
+			return nil, err
+		}
+	}
+
+	records := []entity.DNSRecord{}
+	var errs []error
+	for _, domain := range domains {
+		var wanted []entity.DNSRecord
+		if target != "" {
+			if domain == target {
+				continue
+			}
+			wanted = append(wanted, entity.DNSRecord{Type: "CNAME", Name: domain, Content: target, Proxied: proxied})
+		} else {
+			if ipv4 != "" {
+				wanted = append(wanted, entity.DNSRecord{Type: "A", Name: domain, Content: ipv4, Proxied: proxied})
+			}
+			if ipv6 != "" {
+				wanted = append(wanted, entity.DNSRecord{Type: "AAAA", Name: domain, Content: ipv6, Proxied: proxied})
+			}
+		}
+		for _, record := range wanted {
+			if err := provider.UpsertRecord(record); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			records = append(records, record)
+		}
+	}
+	return records, common.Combine(errs...)
+}
+
+// publicAddresses returns the public addresses found by the last IP check, detecting them when
+// there was none.
+func (s *DNSService) publicAddresses() (string, string, error) {
+	ipv4, _ := s.settingService.GetPublicIPv4()
+	ipv6, _ := s.settingService.GetPublicIPv6()
+	if ipv4 == "" && ipv6 == "" {
+		ipv4 = detectPublicIP(publicIPv4Services)
+		ipv6 = detectPublicIP(publicIPv6Services)
+	}
+	if ipv4 == "" && ipv6 == "" {
+		return "", "", common.NewError("public IP could not be detected")
+	}
+	return ipv4, ipv6, nil
+}
+
+// AutoRecordInbound syncs the records of an added or updated inbound in the background when
+// automatic records are enabled. Failures are only logged, so they never block saving the inbound.
+func (s *DNSService) AutoRecordInbound(inbound *model.Inbound) {
+	if enabled, err := s.settingService.GetDnsAutoRecord(); err != nil || !enabled || inbound == nil {
+		return
+	}
+	go func() {
+		records, err := s.SyncInboundRecords(inbound)
+		if err != nil {
+			logger.Warning("DNS records of inbound", inbound.Id, "failed:", err)
+		}
+		for _, record := range records {
+			logger.Infof("DNS record %s %s -> %s set for inbound %d", record.Type, record.Name, record.Content, inbound.Id)
+		}
+	}()
+}
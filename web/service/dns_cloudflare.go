@@ -0,0 +1,161 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+)
+
+// cloudflareProvider manages DNS records through the Cloudflare API.
+type cloudflareProvider struct {
+	token  string
+	zoneId string // Looked up from each record name when empty
+}
+
+// cloudflareRecord is a DNS record as returned by the Cloudflare API.
+type cloudflareRecord struct {
+	Id      string `json:"id"`
+	Content string `json:"content"`
+	Proxied bool   `json:"proxied"`
+}
+
+// cloudflareResponse is the envelope of Cloudflare API responses.
+type cloudflareResponse struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result json.RawMessage `json:"result"`
+}
+
+// request calls the Cloudflare API and decodes the result into out when it is not nil.
+func (p *cloudflareProvider) request(method string, path string, body any, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, "https://api.cloudflare.com/client/v4"+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := dnsClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	result := &cloudflareResponse{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(result); err != nil {
+		return common.NewErrorf("Cloudflare API %s %s: %d", method, path, resp.StatusCode)
+	}
+	if !result.Success {
+		messages := make([]string, 0, len(result.Errors))
+		for _, e := range result.Errors {
+			messages = append(messages, e.Message)
+		}
+		return common.NewErrorf("Cloudflare API %s %s: %s", method, path, strings.Join(messages, "; "))
+	}
+	if out != nil {
+		return json.Unmarshal(result.Result, out)
+	}
+	return nil
+}
+
+// zone returns the ID of the zone the name belongs to, trying each parent domain in turn.
+func (p *cloudflareProvider) zone(name string) (string, error) {
+	if p.zoneId != "" {
+		return p.zoneId, nil
+	}
+	labels := strings.Split(strings.TrimSuffix(name, "."), ".")
+	for i := 0; i < len(labels)-1; i++ {
+		var zones []struct {
+			Id string `json:"id"`
+		}
+		domain := strings.Join(labels[i:], ".")
+		if err := p.request(http.MethodGet, "/zones?name="+url.QueryEscape(domain), nil, &zones); err != nil {
+			return "", err
+		}
+		if len(zones) > 0 {
+			return zones[0].Id, nil
+		}
+	}
+	return "", common.NewError("no Cloudflare zone found for", name)
+}
+
+// records returns the path of the zone's records and the records of the given type and name.
+func (p *cloudflareProvider) records(recordType string, name string) (string, []cloudflareRecord, error) {
+	zoneId, err := p.zone(name)
+	if err != nil {
+		return "", nil, err
+	}
+	path := "/zones/" + url.PathEscape(zoneId) + "/dns_records"
+	query := "?type=" + url.QueryEscape(recordType) + "&name=" + url.QueryEscape(name)
+	var records []cloudflareRecord
+	if err := p.request(http.MethodGet, path+query, nil, &records); err != nil {
+		return "", nil, err
+	}
+	return path, records, nil
+}
+
+// UpsertRecord creates the record or updates the existing record of the same type and name.
+// TXT records are only added, since ACME challenges for a domain and its wildcard share the name.
+func (p *cloudflareProvider) UpsertRecord(record entity.DNSRecord) error {
+	path, records, err := p.records(record.Type, record.Name)
+	if err != nil {
+		return err
+	}
+	ttl := record.TTL
+	if ttl <= 0 {
+		ttl = 1
+	}
+	body := map[string]any{
+		"type":    record.Type,
+		"name":    record.Name,
+		"content": record.Content,
+		"ttl":     ttl,
+	}
+	if record.Type != "TXT" {
+		body["proxied"] = record.Proxied
+	}
+	for _, existing := range records {
+		if existing.Content == record.Content && record.Type == "TXT" {
+			return nil
+		}
+	}
+	if len(records) == 0 || record.Type == "TXT" {
+		return p.request(http.MethodPost, path, body, nil)
+	}
+	if records[0].Content == record.Content && records[0].Proxied == record.Proxied {
+		return nil
+	}
+	return p.request(http.MethodPatch, path+"/"+url.PathEscape(records[0].Id), body, nil)
+}
+
+// DeleteRecord removes the records of the given type and name, only those with the given content when it is set.
+func (p *cloudflareProvider) DeleteRecord(record entity.DNSRecord) error {
+	path, records, err := p.records(record.Type, record.Name)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, existing := range records {
+		if record.Content != "" && existing.Content != record.Content {
+			continue
+		}
+		errs = append(errs, p.request(http.MethodDelete, path+"/"+url.PathEscape(existing.Id), nil, nil))
+	}
+	return common.Combine(errs...)
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+)
+
+const (
+	// endpointStatsMaxSubs bounds the number of subscriptions requests are counted for, so
+	// requests for made-up IDs can not grow the counters without end.
+	endpointStatsMaxSubs = 10000
+	// endpointStatsMaxClients bounds the number of addresses counted per subscription.
+	endpointStatsMaxClients = 1000
+)
+
+// subRequestCounter counts the requests for a subscription and the addresses they came from.
+type subRequestCounter struct {
+	stats entity.SubRequestStats
+	ips   map[string]bool
+}
+
+var (
+	endpointStatsLock sync.Mutex
+	endpointStats     = map[string]*entity.EndpointStats{}
+	subRequestStats   = map[string]*subRequestCounter{}
+	endpointStatsFrom = time.Now()
+)
+
+// EndpointStatsService reports the requests and bytes the panel and subscription servers
+// served per endpoint and per subscription since the panel started or the counters were reset.
+type EndpointStatsService struct{}
+
+// EndpointRecorder returns the function the endpoint stats middleware of the server, web or
+// sub, records requests with. Subscription IDs are only counted for the sub server and only
+// for requests that were answered successfully.
+func EndpointRecorder(server string) func(endpoint string, subId string, ip string, status int, bytes int) {
+	return func(endpoint string, subId string, ip string, status int, bytes int) {
+		now := time.Now().UnixMilli()
+		failed := status >= 400
+		endpointStatsLock.Lock()
+		defer endpointStatsLock.Unlock()
+
+		key := server + " " + endpoint
+		stats, ok := endpointStats[key]
+		if !ok {
+			stats = &entity.EndpointStats{Server: server, Endpoint: endpoint}
+			endpointStats[key] = stats
+		}
+		stats.Requests++
+		stats.Bytes += int64(bytes)
+		stats.LastRequest = now
+		if failed {
+			stats.Errors++
+		}
+
+		if server != "sub" || subId == "" || failed {
+			return
+		}
+		counter, ok := subRequestStats[subId]
+		if !ok {
+			if len(subRequestStats) >= endpointStatsMaxSubs {
+				return
+			}
+			counter = &subRequestCounter{stats: entity.SubRequestStats{SubId: subId}, ips: map[string]bool{}}
+			subRequestStats[subId] = counter
+		}
+		counter.stats.Requests++
+		counter.stats.Bytes += int64(bytes)
+		counter.stats.LastRequest = now
+		counter.stats.LastIp = ip
+		if !counter.ips[ip] && len(counter.ips) < endpointStatsMaxClients {
+			counter.ips[ip] = true
+			counter.stats.Clients = len(counter.ips)
+		}
+	}
+}
+
+// GetEndpointStats returns the counters of every endpoint that was requested, by server and
+// endpoint, with the time counting started.
+func (s *EndpointStatsService) GetEndpointStats() *entity.EndpointStatsReport {
+	endpointStatsLock.Lock()
+	defer endpointStatsLock.Unlock()
+	list := make([]entity.EndpointStats, 0, len(endpointStats))
+	for _, stats := range endpointStats {
+		list = append(list, *stats)
+	}
+	slices.SortFunc(list, func(a, b entity.EndpointStats) int {
+		return cmp.Or(cmp.Compare(a.Server, b.Server), cmp.Compare(a.Endpoint, b.Endpoint))
+	})
+	return &entity.EndpointStatsReport{Since: endpointStatsFrom.UnixMilli(), Endpoints: list}
+}
+
+// GetSubRequestStats returns the counters of the most requested subscriptions, at most limit
+// of them when limit is positive.
+func (s *EndpointStatsService) GetSubRequestStats(limit int) []entity.SubRequestStats {
+	endpointStatsLock.Lock()
+	list := make([]entity.SubRequestStats, 0, len(subRequestStats))
+	for _, counter := range subRequestStats {
+		list = append(list, counter.stats)
+	}
+	endpointStatsLock.Unlock()
+	slices.SortFunc(list, func(a, b entity.SubRequestStats) int {
+		return cmp.Or(cmp.Compare(b.Requests, a.Requests), cmp.Compare(a.SubId, b.SubId))
+	})
+	if limit > 0 && len(list) > limit {
+		list = list[:limit]
+	}
+	return list
+}
+
+// Reset clears all counters.
+func (s *EndpointStatsService) Reset() {
+	endpointStatsLock.Lock()
+	defer endpointStatsLock.Unlock()
+	endpointStats = map[string]*entity.EndpointStats{}
+	subRequestStats = map[string]*subRequestCounter{}
+	endpointStatsFrom = time.Now()
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/xray"
+)
+
+// Actions a client can take when its expiry time passes. An empty action means disable.
+const (
+	ExpiryActionDisable  = "disable"
+	ExpiryActionDelete   = "delete"
+	ExpiryActionThrottle = "throttle"
+	ExpiryActionCaptive  = "captive"
+)
+
+// activeExpiryActions returns the expiry actions that keep an expired client connected.
+// Throttling needs speed limits and the captive action needs a captive outbound;
+// without them these clients are disabled like any other.
+func activeExpiryActions() []string {
+	var settingService SettingService
+	var actions []string
+	if iface, _ := settingService.GetSpeedLimitInterface(); iface != "" {
+		actions = append(actions, ExpiryActionThrottle)
+	}
+	if tag, _ := settingService.GetExpiryCaptiveOutbound(); tag != "" {
+		actions = append(actions, ExpiryActionCaptive)
+	}
+	return actions
+}
+
+// ApplyExpiryActions deletes expired clients with the delete action and moves clients with the
+// captive action in and out of the captive outbound. Disabling is done by the traffic job and
+// throttling by the speed limits. Returns whether Xray needs restart.
+func (s *InboundService) ApplyExpiryActions() (bool, error) {
+	now := time.Now().Unix() * 1000
+	db := database.GetDB()
+	needRestart := false
+
+	var expired []xray.ClientTraffic
+	err := db.Model(xray.ClientTraffic{}).
+		Where("expiry_action = ? AND expiry_time > 0 AND expiry_time <= ?", ExpiryActionDelete, now).
+		Find(&expired).Error
+	if err != nil {
+		return false, err
+	}
+	for _, traffic := range expired {
+		restart, err := s.DelInboundClientByEmail(traffic.InboundId, traffic.Email)
+		if err != nil {
+			logger.Warning("Delete expired client", traffic.Email, "failed:", err)
+			continue
+		}
+		logger.Info("Client", traffic.Email, "deleted at expiry")
+		needRestart = needRestart || restart
+	}
+
+	// The captive routing rule lives in the config, so entering or leaving it needs a restart
+	var settingService SettingService
+	captiveTag, err := settingService.GetExpiryCaptiveOutbound()
+	if err != nil {
+		return needRestart, err
+	}
+	if captiveTag != "" {
+		result := db.Model(xray.ClientTraffic{}).
+			Where("expiry_action = ? AND expiry_time > 0 AND expiry_time <= ? AND enable = ? AND captive = ?", ExpiryActionCaptive, now, true, false).
+			Update("captive", true)
+		if result.Error != nil {
+			return needRestart, result.Error
+		}
+		needRestart = needRestart || result.RowsAffected > 0
+	}
+	released := db.Model(xray.ClientTraffic{}).Where("captive = ?", true)
+	if captiveTag != "" {
+		released = released.Where("NOT (expiry_action = ? AND expiry_time > 0 AND expiry_time <= ? AND enable = ?)", ExpiryActionCaptive, now, true)
+	}
+	result := released.Update("captive", false)
+	if result.Error != nil {
+		return needRestart, result.Error
+	}
+	return needRestart || result.RowsAffected > 0, nil
+}
+
+// addCaptiveRule routes the traffic of captive clients to the captive outbound ahead of all other routing rules.
+func (s *XrayService) addCaptiveRule(xrayConfig *xray.Config) error {
+	captiveTag, err := s.settingService.GetExpiryCaptiveOutbound()
+	if err != nil || captiveTag == "" {
+		return err
+	}
+	var emails []string
+	err = database.GetDB().Model(xray.ClientTraffic{}).Where("captive = ?", true).Pluck("email", &emails).Error
+	if err != nil || len(emails) == 0 {
+		return err
+	}
+
+	routing := map[string]any{}
+	if len(xrayConfig.RouterConfig) > 0 {
+		if err := json.Unmarshal(xrayConfig.RouterConfig, &routing); err != nil {
+			return err
+		}
+	}
+	rules, _ := routing["rules"].([]any)
+	rule := map[string]any{
+		"type":        "field",
+		"user":        emails,
+		"outboundTag": captiveTag,
+	}
+	routing["rules"] = append([]any{rule}, rules...)
+	routerConfig, err := json.Marshal(routing)
+	if err != nil {
+		return err
+	}
+	xrayConfig.RouterConfig = routerConfig
+	return nil
+}
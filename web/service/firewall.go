@@ -0,0 +1,381 @@
+package service
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+)
+
+const (
+	// firewallChain is the iptables chain owned by the panel for opened ports.
+	firewallChain = "XUI-FIREWALL"
+	// firewallTable is the nftables table owned by the panel.
+	firewallTable = "xui"
+	// firewallComment marks the ufw rules owned by the panel.
+	firewallComment = "x-ui"
+)
+
+// Supported firewall backends.
+const (
+	FirewallUfw      = "ufw"
+	FirewallNftables = "nftables"
+	FirewallIptables = "iptables"
+)
+
+var (
+	firewallLock    sync.Mutex
+	firewallBackend string
+	firewallApplied string
+
+	ufwNumberRegex = regexp.MustCompile(`^\[\s*(\d+)\]`)
+)
+
+// firewallRules is the desired state of the panel's firewall rules.
+type firewallRules struct {
+	ports     []int    // Ports opened for TCP and UDP
+	panelPort int      // Port of the panel
+	allowIps  []string // IPs and networks the panel port is limited to, empty for everyone
+}
+
+func (r *firewallRules) String() string {
+	return fmt.Sprintf("%v|%d|%v", r.ports, r.panelPort, r.allowIps)
+}
+
+// FirewallService opens the ports of enabled inbounds and of the subscription server in the host firewall
+// and can limit the panel port to admin IPs. It supports ufw, nftables and iptables; the panel only
+// touches rules it owns: ufw rules commented "x-ui", the nftables table "xui" and the iptables chain
+// "XUI-FIREWALL". With nftables, ports are accepted in the panel's table only, so a drop in another
+// table still applies to them.
+type FirewallService struct {
+	settingService SettingService
+}
+
+// Apply brings the firewall rules in line with the enabled inbounds and the panel settings.
+// The firewall is only invoked when the rules changed since the last call.
+func (s *FirewallService) Apply() error {
+	backend, err := s.settingService.GetFirewallBackend()
+	if err != nil {
+		return err
+	}
+	rules, err := s.collectRules()
+	if err != nil {
+		return err
+	}
+
+	firewallLock.Lock()
+	defer firewallLock.Unlock()
+	if firewallBackend != "" && firewallBackend != backend {
+		clearFirewallRules(firewallBackend)
+		firewallBackend = ""
+		firewallApplied = ""
+	}
+	key := rules.String()
+	if backend == "" || key == firewallApplied {
+		return nil
+	}
+
+	switch backend {
+	case FirewallUfw:
+		err = applyUfwRules(rules)
+	case FirewallNftables:
+		err = applyNftRules(rules)
+	case FirewallIptables:
+		err = applyIptablesRules(rules)
+	default:
+		err = common.NewError("unknown firewall backend:", backend)
+	}
+	firewallBackend = backend
+	if err != nil {
+		firewallApplied = ""
+		return err
+	}
+	firewallApplied = key
+	logger.Infof("Applied %s firewall rules for %d ports", backend, len(rules.ports))
+	return nil
+}
+
+// Reapply applies the firewall rules even when they did not change, restoring rules removed by hand.
+func (s *FirewallService) Reapply() error {
+	firewallLock.Lock()
+	firewallApplied = ""
+	firewallLock.Unlock()
+	return s.Apply()
+}
+
+// GetFirewallState returns the desired firewall rules and the rules the backend currently holds.
+func (s *FirewallService) GetFirewallState() (*entity.FirewallState, error) {
+	backend, err := s.settingService.GetFirewallBackend()
+	if err != nil {
+		return nil, err
+	}
+	rules, err := s.collectRules()
+	if err != nil {
+		return nil, err
+	}
+	state := &entity.FirewallState{
+		Backend:       backend,
+		Ports:         rules.ports,
+		PanelPort:     rules.panelPort,
+		PanelAllowIps: rules.allowIps,
+	}
+
+	var output []byte
+	switch backend {
+	case FirewallUfw:
+		output, err = exec.Command("ufw", "status", "numbered").CombinedOutput()
+	case FirewallNftables:
+		output, err = exec.Command("nft", "list", "table", "inet", firewallTable).CombinedOutput()
+	case FirewallIptables:
+		output, err = exec.Command("iptables", "-S", firewallChain).CombinedOutput()
+	default:
+		return state, nil
+	}
+	state.Rules = strings.TrimSpace(string(output))
+	if err != nil {
+		state.Rules = fmt.Sprintf("%v: %s", err, state.Rules)
+	}
+	return state, nil
+}
+
+// collectRules gathers the ports of enabled inbounds, the subscription port, the SSH tunnel port
+// and the panel port.
+func (s *FirewallService) collectRules() (*firewallRules, error) {
+	rules := &firewallRules{}
+	var ports []int
+	err := database.GetDB().Model(model.Inbound{}).Where("enable = ?", true).Distinct().Order("port").Pluck("port", &ports).Error
+	if err != nil {
+		return nil, err
+	}
+	var extraPorts []string
+	err = database.GetDB().Model(model.Inbound{}).Where("enable = ? AND extra_ports != ''", true).Pluck("extra_ports", &extraPorts).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, list := range extraPorts {
+		parsed, _ := model.ParsePortList(list)
+		for _, port := range parsed {
+			if !slices.Contains(ports, port) {
+				ports = append(ports, port)
+			}
+		}
+	}
+	slices.Sort(ports)
+	if subEnable, _ := s.settingService.GetSubEnable(); subEnable {
+		if subPort, err := s.settingService.GetSubPort(); err == nil && !slices.Contains(ports, subPort) {
+			ports = append(ports, subPort)
+			slices.Sort(ports)
+		}
+	}
+	if sshEnable, _ := s.settingService.GetSshEnable(); sshEnable {
+		if sshPort, err := s.settingService.GetSshPort(); err == nil && !slices.Contains(ports, sshPort) {
+			ports = append(ports, sshPort)
+			slices.Sort(ports)
+		}
+	}
+	rules.panelPort, err = s.settingService.GetPort()
+	if err != nil {
+		return nil, err
+	}
+	rules.ports = slices.DeleteFunc(ports, func(port int) bool { return port == rules.panelPort })
+
+	allowIps, err := s.settingService.GetFirewallPanelAllowIps()
+	if err != nil {
+		return nil, err
+	}
+	rules.allowIps = splitFirewallIps(allowIps)
+	return rules, nil
+}
+
+// splitFirewallIps splits a comma separated list of IPs and networks.
+func splitFirewallIps(value string) []string {
+	var ips []string
+	for _, ip := range strings.Split(value, ",") {
+		if ip = strings.TrimSpace(ip); ip != "" {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+func isIPv6Network(ip string) bool {
+	return strings.Contains(ip, ":")
+}
+
+func runFirewallCommand(name string, args ...string) error {
+	output, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return common.NewErrorf("%s %s: %v: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// clearFirewallRules removes the rules the panel added with a backend. Failures are only logged.
+func clearFirewallRules(backend string) {
+	switch backend {
+	case FirewallUfw:
+		if err := deleteUfwRules(); err != nil {
+			logger.Warning("Remove ufw rules failed:", err)
+		}
+	case FirewallNftables:
+		exec.Command("nft", "delete", "table", "inet", firewallTable).Run()
+	case FirewallIptables:
+		clearIptablesChain("iptables", firewallChain)
+		clearIptablesChain("ip6tables", firewallChain)
+	}
+}
+
+// deleteUfwRules deletes all ufw rules commented as owned by the panel.
+func deleteUfwRules() error {
+	output, err := exec.Command("ufw", "status", "numbered").Output()
+	if err != nil {
+		return common.NewError("ufw status failed:", err)
+	}
+	var numbers []int
+	for _, line := range strings.Split(string(output), "\n") {
+		if !strings.HasSuffix(strings.TrimSpace(line), "# "+firewallComment) {
+			continue
+		}
+		if match := ufwNumberRegex.FindStringSubmatch(strings.TrimSpace(line)); match != nil {
+			number, _ := strconv.Atoi(match[1])
+			numbers = append(numbers, number)
+		}
+	}
+	// Delete from the bottom so the remaining numbers stay valid
+	slices.Sort(numbers)
+	for i := len(numbers) - 1; i >= 0; i-- {
+		if err := runFirewallCommand("ufw", "--force", "delete", strconv.Itoa(numbers[i])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyUfwRules deletes the panel's ufw rules and adds the current ones.
+// Panel allow rules are prepended so they precede the panel deny rule.
+func applyUfwRules(rules *firewallRules) error {
+	if _, err := exec.LookPath("ufw"); err != nil {
+		return common.NewError("ufw is not installed:", err)
+	}
+	if err := deleteUfwRules(); err != nil {
+		return err
+	}
+
+	for _, port := range rules.ports {
+		if err := runFirewallCommand("ufw", "allow", strconv.Itoa(port), "comment", firewallComment); err != nil {
+			return err
+		}
+	}
+	panelPort := strconv.Itoa(rules.panelPort)
+	if len(rules.allowIps) == 0 {
+		return runFirewallCommand("ufw", "allow", panelPort+"/tcp", "comment", firewallComment)
+	}
+	if err := runFirewallCommand("ufw", "deny", panelPort+"/tcp", "comment", firewallComment); err != nil {
+		return err
+	}
+	for _, ip := range rules.allowIps {
+		if err := runFirewallCommand("ufw", "prepend", "allow", "proto", "tcp", "from", ip, "to", "any", "port", panelPort, "comment", firewallComment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyNftRules replaces the panel's nftables table in one transaction.
+func applyNftRules(rules *firewallRules) error {
+	if _, err := exec.LookPath("nft"); err != nil {
+		return common.NewError("nft is not installed:", err)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "table inet %s\ndelete table inet %s\n", firewallTable, firewallTable)
+	fmt.Fprintf(&sb, "table inet %s {\n\tchain input {\n\t\ttype filter hook input priority -5; policy accept;\n", firewallTable)
+	if len(rules.allowIps) > 0 {
+		var v4, v6 []string
+		for _, ip := range rules.allowIps {
+			if isIPv6Network(ip) {
+				v6 = append(v6, ip)
+			} else {
+				v4 = append(v4, ip)
+			}
+		}
+		if len(v4) > 0 {
+			fmt.Fprintf(&sb, "\t\tip saddr { %s } tcp dport %d accept\n", strings.Join(v4, ", "), rules.panelPort)
+		}
+		if len(v6) > 0 {
+			fmt.Fprintf(&sb, "\t\tip6 saddr { %s } tcp dport %d accept\n", strings.Join(v6, ", "), rules.panelPort)
+		}
+		fmt.Fprintf(&sb, "\t\ttcp dport %d drop\n", rules.panelPort)
+	} else {
+		fmt.Fprintf(&sb, "\t\ttcp dport %d accept\n", rules.panelPort)
+	}
+	if len(rules.ports) > 0 {
+		ports := make([]string, len(rules.ports))
+		for i, port := range rules.ports {
+			ports[i] = strconv.Itoa(port)
+		}
+		fmt.Fprintf(&sb, "\t\ttcp dport { %s } accept\n", strings.Join(ports, ", "))
+		fmt.Fprintf(&sb, "\t\tudp dport { %s } accept\n", strings.Join(ports, ", "))
+	}
+	sb.WriteString("\t}\n}\n")
+
+	cmd := exec.Command("nft", "-f", "-")
+	cmd.Stdin = strings.NewReader(sb.String())
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return common.NewErrorf("nft failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// applyIptablesRules rebuilds the panel's iptables and ip6tables chains.
+// The chain is hooked in after the connection limit chain so that limits are checked first.
+func applyIptablesRules(rules *firewallRules) error {
+	if _, err := exec.LookPath("iptables"); err != nil {
+		return common.NewError("iptables is not installed:", err)
+	}
+	for _, bin := range []string{"iptables", "ip6tables"} {
+		if _, err := exec.LookPath(bin); err != nil {
+			continue
+		}
+		position := 1
+		if exec.Command(bin, "-C", "INPUT", "-j", connLimitChain).Run() == nil {
+			position = 2
+		}
+		if err := resetIptablesChain(bin, firewallChain, position); err != nil {
+			return err
+		}
+
+		panelPort := strconv.Itoa(rules.panelPort)
+		if len(rules.allowIps) > 0 {
+			for _, ip := range rules.allowIps {
+				if isIPv6Network(ip) != (bin == "ip6tables") {
+					continue
+				}
+				if err := runFirewallCommand(bin, "-A", firewallChain, "-p", "tcp", "-s", ip, "--dport", panelPort, "-j", "ACCEPT"); err != nil {
+					return err
+				}
+			}
+			if err := runFirewallCommand(bin, "-A", firewallChain, "-p", "tcp", "--dport", panelPort, "-j", "DROP"); err != nil {
+				return err
+			}
+		} else if err := runFirewallCommand(bin, "-A", firewallChain, "-p", "tcp", "--dport", panelPort, "-j", "ACCEPT"); err != nil {
+			return err
+		}
+		for _, port := range rules.ports {
+			for _, proto := range []string{"tcp", "udp"} {
+				if err := runFirewallCommand(bin, "-A", firewallChain, "-p", proto, "--dport", strconv.Itoa(port), "-j", "ACCEPT"); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
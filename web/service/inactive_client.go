@@ -0,0 +1,89 @@
+package service
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+)
+
+// GetInactiveClients returns the clients of the user's inbounds, or of one of them when inboundId
+// is not 0, that were not online for the given number of days, longest inactive first. The last
+// time a client was online is stored with its traffic, so it survives restarts. Clients never
+// online count from their creation, so new clients get the days to connect first.
+func (s *InboundService) GetInactiveClients(userId int, inboundId int, days int) ([]entity.InactiveClient, error) {
+	if days < 1 {
+		return nil, common.NewCodeError(common.ErrCodeValidation, nil, "days must be at least 1")
+	}
+	inbounds, err := s.GetInbounds(userId)
+	if err != nil {
+		return nil, err
+	}
+	cutoff := time.Now().AddDate(0, 0, -days).UnixMilli()
+	found := false
+	result := []entity.InactiveClient{}
+	for _, inbound := range inbounds {
+		if inboundId != 0 && inbound.Id != inboundId {
+			continue
+		}
+		found = true
+		clients, err := s.GetClients(inbound)
+		if err != nil {
+			return nil, err
+		}
+		for _, client := range clients {
+			inactive := entity.InactiveClient{
+				InboundId: inbound.Id,
+				Inbound:   inbound.Remark,
+				Email:     client.Email,
+				Enable:    client.Enable,
+				CreatedAt: client.CreatedAt,
+			}
+			for _, traffic := range inbound.ClientStats {
+				if strings.EqualFold(traffic.Email, client.Email) {
+					inactive.Enable = inactive.Enable && traffic.Enable
+					inactive.LastOnline = traffic.LastOnline
+					inactive.Up = traffic.Up
+					inactive.Down = traffic.Down
+					break
+				}
+			}
+			if max(inactive.LastOnline, inactive.CreatedAt) < cutoff {
+				result = append(result, inactive)
+			}
+		}
+	}
+	if inboundId != 0 && !found {
+		return nil, common.NewCodeError(common.ErrCodeInboundNotFound, map[string]any{"id": inboundId}, "inbound not found:", inboundId)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return max(result[i].LastOnline, result[i].CreatedAt) < max(result[j].LastOnline, result[j].CreatedAt)
+	})
+	return result, nil
+}
+
+// DisableInactiveClients disables the enabled clients GetInactiveClients reports.
+// Returns the clients disabled and whether Xray needs restart.
+func (s *InboundService) DisableInactiveClients(userId int, inboundId int, days int) ([]entity.InactiveClient, bool, error) {
+	clients, err := s.GetInactiveClients(userId, inboundId, days)
+	if err != nil {
+		return nil, false, err
+	}
+	disabled := []entity.InactiveClient{}
+	needRestart := false
+	for _, client := range clients {
+		if !client.Enable {
+			continue
+		}
+		_, restart, err := s.SetClientEnableByEmail(client.Email, false)
+		needRestart = needRestart || restart
+		if err != nil {
+			return disabled, needRestart, err
+		}
+		client.Enable = false
+		disabled = append(disabled, client)
+	}
+	return disabled, needRestart, nil
+}
@@ -5,6 +5,8 @@ package service
 import (
 	"encoding/json"
 	"fmt"
+	"os"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -16,6 +18,7 @@ import (
 	"github.com/mhsanaei/3x-ui/v2/util/common"
 	"github.com/mhsanaei/3x-ui/v2/xray"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
@@ -141,6 +144,60 @@ func (s *InboundService) GetClients(inbound *model.Inbound) ([]model.Client, err
 	return clients, nil
 }
 
+// ParseInboundIds parses a comma separated list of inbound IDs, skipping invalid entries.
+func ParseInboundIds(value string) map[int]bool {
+	ids := map[int]bool{}
+	for id := range strings.SplitSeq(value, ",") {
+		if n, err := strconv.Atoi(strings.TrimSpace(id)); err == nil {
+			ids[n] = true
+		}
+	}
+	return ids
+}
+
+// ClientSecret returns the password a client authenticates to the NaiveProxy forward proxy
+// and the SSH tunnel server with: its password, or its ID for protocols without one.
+func ClientSecret(client *model.Client) string {
+	if client.Password != "" {
+		return client.Password
+	}
+	return client.ID
+}
+
+// GetActiveClients returns the enabled clients of the given enabled inbounds that are not
+// disabled by their traffic or expiry, once per email.
+func (s *InboundService) GetActiveClients(inboundIds map[int]bool) ([]model.Client, error) {
+	inbounds, err := s.GetAllInbounds()
+	if err != nil {
+		return nil, err
+	}
+	var active []model.Client
+	seen := map[string]bool{}
+	for _, inbound := range inbounds {
+		if !inboundIds[inbound.Id] || !inbound.Enable {
+			continue
+		}
+		disabled := map[string]bool{}
+		for _, stat := range inbound.ClientStats {
+			if !stat.Enable {
+				disabled[stat.Email] = true
+			}
+		}
+		clients, err := s.GetClients(inbound)
+		if err != nil {
+			continue
+		}
+		for _, client := range clients {
+			if !client.Enable || disabled[client.Email] || client.Email == "" || seen[client.Email] {
+				continue
+			}
+			seen[client.Email] = true
+			active = append(active, client)
+		}
+	}
+	return active, nil
+}
+
 func (s *InboundService) getAllEmails() ([]string, error) {
 	db := database.GetDB()
 	var emails []string
@@ -214,12 +271,53 @@ func (s *InboundService) checkEmailExistForInbound(inbound *model.Inbound) (stri
 // then saves the inbound to the database and optionally adds it to the running Xray instance.
 // Returns the created inbound, whether Xray needs restart, and any error.
 func (s *InboundService) AddInbound(inbound *model.Inbound) (*model.Inbound, bool, error) {
+	if err := checkXhttpSettings(inbound.StreamSettings); err != nil {
+		return inbound, false, common.WithCode(common.ErrCodeValidation, err)
+	}
+	if err := checkPortHop(inbound); err != nil {
+		return inbound, false, common.WithCode(common.ErrCodeValidation, err)
+	}
+	if err := s.checkExtraPorts(inbound); err != nil {
+		return inbound, false, common.WithCode(common.ErrCodeValidation, err)
+	}
+	if err := s.checkClientLevels(inbound); err != nil {
+		return inbound, false, common.WithCode(common.ErrCodeValidation, err)
+	}
+	if err := s.checkClientFingerprints(inbound); err != nil {
+		return inbound, false, common.WithCode(common.ErrCodeValidation, err)
+	}
+	if err := s.checkSpeedUnits(inbound); err != nil {
+		return inbound, false, common.WithCode(common.ErrCodeValidation, err)
+	}
+	if err := checkExtension(inbound); err != nil {
+		return inbound, false, common.WithCode(common.ErrCodeValidation, err)
+	}
+	if err := checkRealityMldsa65(inbound); err != nil {
+		return inbound, false, common.WithCode(common.ErrCodeValidation, err)
+	}
+	if err := checkExternalId(inbound.ExternalId); err != nil {
+		return inbound, false, err
+	}
+	if inbound.ExternalId != "" {
+		// Creating by external ID is idempotent: the inbound created before is returned unchanged
+		if existing, err := s.GetInboundByExternalId(inbound.ExternalId); err == nil {
+			return existing, false, nil
+		}
+	} else {
+		inbound.ExternalId = uuid.NewString()
+	}
+	settings, err := assignClientExternalIds(inbound.Settings, "")
+	if err != nil {
+		return inbound, false, common.WithCode(common.ErrCodeValidation, err)
+	}
+	inbound.Settings = settings
+	inbound.Group = strings.TrimSpace(inbound.Group)
 	exist, err := s.checkPortExist(inbound.Listen, inbound.Port, 0)
 	if err != nil {
 		return inbound, false, err
 	}
 	if exist {
-		return inbound, false, common.NewError("Port already exists:", inbound.Port)
+		return inbound, false, common.NewCodeError(common.ErrCodeInboundPortInUse, map[string]any{"port": inbound.Port}, "Port already exists:", inbound.Port)
 	}
 
 	existEmail, err := s.checkEmailExistForInbound(inbound)
@@ -227,7 +325,7 @@ func (s *InboundService) AddInbound(inbound *model.Inbound) (*model.Inbound, boo
 		return inbound, false, err
 	}
 	if existEmail != "" {
-		return inbound, false, common.NewError("Duplicate email:", existEmail)
+		return inbound, false, common.NewCodeError(common.ErrCodeClientEmailDuplicate, map[string]any{"email": existEmail}, "Duplicate email:", existEmail)
 	}
 
 	clients, err := s.GetClients(inbound)
@@ -264,15 +362,15 @@ func (s *InboundService) AddInbound(inbound *model.Inbound) (*model.Inbound, boo
 		switch inbound.Protocol {
 		case "trojan":
 			if client.Password == "" {
-				return inbound, false, common.NewError("empty client ID")
+				return inbound, false, common.NewCodeError(common.ErrCodeClientIdEmpty, nil, "empty client ID")
 			}
 		case "shadowsocks":
 			if client.Email == "" {
-				return inbound, false, common.NewError("empty client ID")
+				return inbound, false, common.NewCodeError(common.ErrCodeClientIdEmpty, nil, "empty client ID")
 			}
 		default:
 			if client.ID == "" {
-				return inbound, false, common.NewError("empty client ID")
+				return inbound, false, common.NewCodeError(common.ErrCodeClientIdEmpty, nil, "empty client ID")
 			}
 		}
 	}
@@ -293,20 +391,18 @@ func (s *InboundService) AddInbound(inbound *model.Inbound) (*model.Inbound, boo
 			for _, client := range clients {
 				s.AddClientStat(tx, inbound.Id, &client)
 			}
+		} else {
+			err = s.syncClientSubIds(tx, clients)
 		}
-	} else {
+	}
+	if err != nil {
 		return inbound, false, err
 	}
 
 	needRestart := false
 	if inbound.Enable {
-		s.xrayApi.Init(p.GetAPIPort())
-		inboundJson, err1 := json.MarshalIndent(inbound.GenXrayInboundConfig(), "", "  ")
-		if err1 != nil {
-			logger.Debug("Unable to marshal inbound config:", err1)
-		}
-
-		err1 = s.xrayApi.AddInbound(inboundJson)
+		s.xrayApi.Init(coreAPIPort())
+		err1 := s.addInboundByApi(inbound)
 		if err1 == nil {
 			logger.Debug("New inbound added by api:", inbound.Tag)
 		} else {
@@ -329,7 +425,7 @@ func (s *InboundService) DelInbound(id int) (bool, error) {
 	needRestart := false
 	result := db.Model(model.Inbound{}).Select("tag").Where("id = ? and enable = ?", id, true).First(&tag)
 	if result.Error == nil {
-		s.xrayApi.Init(p.GetAPIPort())
+		s.xrayApi.Init(coreAPIPort())
 		err1 := s.xrayApi.DelInbound(tag)
 		if err1 == nil {
 			logger.Debug("Inbound deleted by api:", tag)
@@ -362,7 +458,67 @@ func (s *InboundService) DelInbound(id int) (bool, error) {
 		}
 	}
 
-	return needRestart, db.Delete(model.Inbound{}, id).Error
+	if err := db.Delete(model.Inbound{}, id).Error; err != nil {
+		return needRestart, err
+	}
+	os.RemoveAll(getInboundCertFolder(id))
+	return needRestart, nil
+}
+
+// addInboundByApi adds the Xray inbounds of an inbound, one per listen address, to the running
+// Xray instance.
+func (s *InboundService) addInboundByApi(inbound *model.Inbound) error {
+	for _, config := range inbound.GenXrayInboundConfigs() {
+		inboundJson, err := json.MarshalIndent(config, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err = s.xrayApi.AddInbound(inboundJson); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetInboundEnable enables or disables an inbound without touching the rest of its configuration.
+// The inbound is added to or removed from the running Xray instance through the API.
+// Returns whether the flag changed, whether Xray needs restart, and any error.
+func (s *InboundService) SetInboundEnable(id int, enable bool) (bool, bool, error) {
+	inbound, err := s.GetInbound(id)
+	if err != nil {
+		return false, false, err
+	}
+	if inbound.Enable == enable {
+		return false, false, nil
+	}
+	db := database.GetDB()
+	err = db.Model(model.Inbound{}).Where("id = ?", id).Update("enable", enable).Error
+	if err != nil {
+		return false, false, err
+	}
+	inbound.Enable = enable
+
+	needRestart := false
+	s.xrayApi.Init(coreAPIPort())
+	defer s.xrayApi.Close()
+	if enable {
+		err1 := s.addInboundByApi(inbound)
+		if err1 == nil {
+			logger.Debug("Inbound enabled by api:", inbound.Tag)
+		} else {
+			logger.Debug("Unable to enable inbound by api:", err1)
+			needRestart = true
+		}
+	} else {
+		err1 := s.xrayApi.DelInbound(inbound.Tag)
+		if err1 == nil {
+			logger.Debug("Inbound disabled by api:", inbound.Tag)
+		} else {
+			logger.Debug("Unable to disable inbound by api:", err1)
+			needRestart = true
+		}
+	}
+	return true, needRestart, nil
 }
 
 func (s *InboundService) GetInbound(id int) (*model.Inbound, error) {
@@ -379,12 +535,36 @@ func (s *InboundService) GetInbound(id int) (*model.Inbound, error) {
 // It validates changes, updates the database, and syncs with the running Xray instance.
 // Returns the updated inbound, whether Xray needs restart, and any error.
 func (s *InboundService) UpdateInbound(inbound *model.Inbound) (*model.Inbound, bool, error) {
+	if err := checkXhttpSettings(inbound.StreamSettings); err != nil {
+		return inbound, false, common.WithCode(common.ErrCodeValidation, err)
+	}
+	if err := checkPortHop(inbound); err != nil {
+		return inbound, false, common.WithCode(common.ErrCodeValidation, err)
+	}
+	if err := s.checkExtraPorts(inbound); err != nil {
+		return inbound, false, common.WithCode(common.ErrCodeValidation, err)
+	}
+	if err := s.checkClientLevels(inbound); err != nil {
+		return inbound, false, common.WithCode(common.ErrCodeValidation, err)
+	}
+	if err := s.checkClientFingerprints(inbound); err != nil {
+		return inbound, false, common.WithCode(common.ErrCodeValidation, err)
+	}
+	if err := s.checkSpeedUnits(inbound); err != nil {
+		return inbound, false, common.WithCode(common.ErrCodeValidation, err)
+	}
+	if err := checkExtension(inbound); err != nil {
+		return inbound, false, common.WithCode(common.ErrCodeValidation, err)
+	}
+	if err := checkRealityMldsa65(inbound); err != nil {
+		return inbound, false, common.WithCode(common.ErrCodeValidation, err)
+	}
 	exist, err := s.checkPortExist(inbound.Listen, inbound.Port, inbound.Id)
 	if err != nil {
 		return inbound, false, err
 	}
 	if exist {
-		return inbound, false, common.NewError("Port already exists:", inbound.Port)
+		return inbound, false, common.NewCodeError(common.ErrCodeInboundPortInUse, map[string]any{"port": inbound.Port}, "Port already exists:", inbound.Port)
 	}
 
 	oldInbound, err := s.GetInbound(inbound.Id)
@@ -469,10 +649,31 @@ func (s *InboundService) UpdateInbound(inbound *model.Inbound) (*model.Inbound,
 		}
 	}
 
+	if settings, err2 := assignClientExternalIds(inbound.Settings, oldInbound.Settings); err2 == nil {
+		inbound.Settings = settings
+	} else {
+		err = common.WithCode(common.ErrCodeValidation, err2)
+		return inbound, false, err
+	}
+
 	oldInbound.Up = inbound.Up
 	oldInbound.Down = inbound.Down
 	oldInbound.Total = inbound.Total
 	oldInbound.Remark = inbound.Remark
+	oldInbound.RemarkTemplate = inbound.RemarkTemplate
+	oldInbound.Group = strings.TrimSpace(inbound.Group)
+	oldInbound.SpeedLimit = inbound.SpeedLimit
+	oldInbound.SpeedBurst = inbound.SpeedBurst
+	oldInbound.SpeedUnit = inbound.SpeedUnit
+	oldInbound.ConnLimit = inbound.ConnLimit
+	oldInbound.ConnLimitPerIp = inbound.ConnLimitPerIp
+	oldInbound.PortHopRange = inbound.PortHopRange
+	oldInbound.PortHopInterval = inbound.PortHopInterval
+	oldInbound.ExtraPorts = inbound.ExtraPorts
+	oldInbound.SubPortMode = inbound.SubPortMode
+	oldInbound.SubExclude = inbound.SubExclude
+	oldInbound.ExtraListens = inbound.ExtraListens
+	oldInbound.Extension = inbound.Extension
 	oldInbound.Enable = inbound.Enable
 	oldInbound.ExpiryTime = inbound.ExpiryTime
 	oldInbound.TrafficReset = inbound.TrafficReset
@@ -489,23 +690,17 @@ func (s *InboundService) UpdateInbound(inbound *model.Inbound) (*model.Inbound,
 	}
 
 	needRestart := false
-	s.xrayApi.Init(p.GetAPIPort())
+	s.xrayApi.Init(coreAPIPort())
 	if s.xrayApi.DelInbound(tag) == nil {
 		logger.Debug("Old inbound deleted by api:", tag)
 	}
 	if inbound.Enable {
-		inboundJson, err2 := json.MarshalIndent(oldInbound.GenXrayInboundConfig(), "", "  ")
-		if err2 != nil {
-			logger.Debug("Unable to marshal updated inbound config:", err2)
-			needRestart = true
+		err2 := s.addInboundByApi(oldInbound)
+		if err2 == nil {
+			logger.Debug("Updated inbound added by api:", oldInbound.Tag)
 		} else {
-			err2 = s.xrayApi.AddInbound(inboundJson)
-			if err2 == nil {
-				logger.Debug("Updated inbound added by api:", oldInbound.Tag)
-			} else {
-				logger.Debug("Unable to update inbound by api:", err2)
-				needRestart = true
-			}
+			logger.Debug("Unable to update inbound by api:", err2)
+			needRestart = true
 		}
 	}
 	s.xrayApi.Close()
@@ -550,19 +745,46 @@ func (s *InboundService) updateClientTraffics(tx *gorm.DB, oldInbound *model.Inb
 		}
 		if !emailExists {
 			err = s.AddClientStat(tx, oldInbound.Id, &newClient)
-			if err != nil {
-				return err
-			}
+		} else {
+			err = tx.Model(xray.ClientTraffic{}).Where("email = ?", newClient.Email).
+				Updates(map[string]any{
+					"sub_id":        newClient.SubID,
+					"tags":          xray.NewTagList(newClient.Tags),
+					"expiry_action": newClient.ExpiryAction,
+				}).Error
+		}
+		if err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
 func (s *InboundService) AddInboundClient(data *model.Inbound) (bool, error) {
+	remaining, err := s.dropExistingClients(data)
+	if err != nil {
+		return false, err
+	}
+	if remaining == 0 {
+		return false, nil
+	}
+	data.Settings, err = assignClientExternalIds(data.Settings, "")
+	if err != nil {
+		return false, err
+	}
 	clients, err := s.GetClients(data)
 	if err != nil {
 		return false, err
 	}
+	if err := s.checkClientLevels(data); err != nil {
+		return false, common.WithCode(common.ErrCodeValidation, err)
+	}
+	if err := s.checkClientFingerprints(data); err != nil {
+		return false, common.WithCode(common.ErrCodeValidation, err)
+	}
+	if err := s.checkSpeedUnits(data); err != nil {
+		return false, common.WithCode(common.ErrCodeValidation, err)
+	}
 
 	var settings map[string]any
 	err = json.Unmarshal([]byte(data.Settings), &settings)
@@ -587,7 +809,7 @@ func (s *InboundService) AddInboundClient(data *model.Inbound) (bool, error) {
 		return false, err
 	}
 	if existEmail != "" {
-		return false, common.NewError("Duplicate email:", existEmail)
+		return false, common.NewCodeError(common.ErrCodeClientEmailDuplicate, map[string]any{"email": existEmail}, "Duplicate email:", existEmail)
 	}
 
 	oldInbound, err := s.GetInbound(data.Id)
@@ -600,15 +822,15 @@ func (s *InboundService) AddInboundClient(data *model.Inbound) (bool, error) {
 		switch oldInbound.Protocol {
 		case "trojan":
 			if client.Password == "" {
-				return false, common.NewError("empty client ID")
+				return false, common.NewCodeError(common.ErrCodeClientIdEmpty, nil, "empty client ID")
 			}
 		case "shadowsocks":
 			if client.Email == "" {
-				return false, common.NewError("empty client ID")
+				return false, common.NewCodeError(common.ErrCodeClientIdEmpty, nil, "empty client ID")
 			}
 		default:
 			if client.ID == "" {
-				return false, common.NewError("empty client ID")
+				return false, common.NewCodeError(common.ErrCodeClientIdEmpty, nil, "empty client ID")
 			}
 		}
 	}
@@ -643,7 +865,7 @@ func (s *InboundService) AddInboundClient(data *model.Inbound) (bool, error) {
 	}()
 
 	needRestart := false
-	s.xrayApi.Init(p.GetAPIPort())
+	s.xrayApi.Init(coreAPIPort())
 	for _, client := range clients {
 		if len(client.Email) > 0 {
 			s.AddClientStat(tx, data.Id, &client)
@@ -659,6 +881,7 @@ func (s *InboundService) AddInboundClient(data *model.Inbound) (bool, error) {
 					"flow":     client.Flow,
 					"password": client.Password,
 					"cipher":   cipher,
+					"level":    client.Level,
 				})
 				if err1 == nil {
 					logger.Debug("Client added by api:", client.Email)
@@ -712,7 +935,7 @@ func (s *InboundService) DelInboundClient(inboundId int, clientId string) (bool,
 	}
 
 	if len(newClients) == 0 {
-		return false, common.NewError("no client remained in Inbound")
+		return false, common.NewCodeError(common.ErrCodeClientLastRemaining, nil, "no client remained in Inbound")
 	}
 
 	settings["clients"] = newClients
@@ -745,7 +968,7 @@ func (s *InboundService) DelInboundClient(inboundId int, clientId string) (bool,
 			return false, err
 		}
 		if needApiDel && notDepleted {
-			s.xrayApi.Init(p.GetAPIPort())
+			s.xrayApi.Init(coreAPIPort())
 			err1 := s.xrayApi.RemoveUser(oldInbound.Tag, email)
 			if err1 == nil {
 				logger.Debug("Client deleted by api:", email)
@@ -770,6 +993,15 @@ func (s *InboundService) UpdateInboundClient(data *model.Inbound, clientId strin
 	if err != nil {
 		return false, err
 	}
+	if err := s.checkClientLevels(data); err != nil {
+		return false, common.WithCode(common.ErrCodeValidation, err)
+	}
+	if err := s.checkClientFingerprints(data); err != nil {
+		return false, common.WithCode(common.ErrCodeValidation, err)
+	}
+	if err := s.checkSpeedUnits(data); err != nil {
+		return false, common.WithCode(common.ErrCodeValidation, err)
+	}
 
 	var settings map[string]any
 	err = json.Unmarshal([]byte(data.Settings), &settings)
@@ -814,7 +1046,7 @@ func (s *InboundService) UpdateInboundClient(data *model.Inbound, clientId strin
 
 	// Validate new client ID
 	if newClientId == "" || clientIndex == -1 {
-		return false, common.NewError("empty client ID")
+		return false, common.NewCodeError(common.ErrCodeClientIdEmpty, nil, "empty client ID")
 	}
 
 	if len(clients[0].Email) > 0 && clients[0].Email != oldEmail {
@@ -823,7 +1055,7 @@ func (s *InboundService) UpdateInboundClient(data *model.Inbound, clientId strin
 			return false, err
 		}
 		if existEmail != "" {
-			return false, common.NewError("Duplicate email:", existEmail)
+			return false, common.NewCodeError(common.ErrCodeClientEmailDuplicate, map[string]any{"email": existEmail}, "Duplicate email:", existEmail)
 		}
 	}
 
@@ -835,11 +1067,13 @@ func (s *InboundService) UpdateInboundClient(data *model.Inbound, clientId strin
 	settingsClients := oldSettings["clients"].([]any)
 	// Preserve created_at and set updated_at for the replacing client
 	var preservedCreated any
+	preservedExternalId := ""
 	if clientIndex >= 0 && clientIndex < len(settingsClients) {
 		if oldMap, ok := settingsClients[clientIndex].(map[string]any); ok {
 			if v, ok2 := oldMap["created_at"]; ok2 {
 				preservedCreated = v
 			}
+			preservedExternalId, _ = oldMap["externalId"].(string)
 		}
 	}
 	if len(interfaceClients) > 0 {
@@ -847,6 +1081,14 @@ func (s *InboundService) UpdateInboundClient(data *model.Inbound, clientId strin
 			if preservedCreated == nil {
 				preservedCreated = time.Now().Unix() * 1000
 			}
+			if externalId, _ := newMap["externalId"].(string); externalId == "" {
+				if preservedExternalId == "" {
+					preservedExternalId = uuid.NewString()
+				}
+				newMap["externalId"] = preservedExternalId
+			} else if err := checkExternalId(externalId); err != nil {
+				return false, err
+			}
 			newMap["created_at"] = preservedCreated
 			newMap["updated_at"] = time.Now().Unix() * 1000
 			interfaceClients[0] = newMap
@@ -897,7 +1139,7 @@ func (s *InboundService) UpdateInboundClient(data *model.Inbound, clientId strin
 	}
 	needRestart := false
 	if len(oldEmail) > 0 {
-		s.xrayApi.Init(p.GetAPIPort())
+		s.xrayApi.Init(coreAPIPort())
 		if oldClients[clientIndex].Enable {
 			err1 := s.xrayApi.RemoveUser(oldInbound.Tag, oldEmail)
 			if err1 == nil {
@@ -923,6 +1165,7 @@ func (s *InboundService) UpdateInboundClient(data *model.Inbound, clientId strin
 				"flow":     clients[0].Flow,
 				"password": clients[0].Password,
 				"cipher":   cipher,
+				"level":    clients[0].Level,
 			})
 			if err1 == nil {
 				logger.Debug("Client edited by api:", clients[0].Email)
@@ -940,6 +1183,16 @@ func (s *InboundService) UpdateInboundClient(data *model.Inbound, clientId strin
 }
 
 func (s *InboundService) AddTraffic(inboundTraffics []*xray.Traffic, clientTraffics []*xray.ClientTraffic) (error, bool) {
+	return s.addTraffic(inboundTraffics, clientTraffics, true)
+}
+
+// AddAccountTraffic counts the traffic of clients served outside the core, like the NaiveProxy
+// forward proxy and the SSH tunnel server, leaving the online clients of the core alone.
+func (s *InboundService) AddAccountTraffic(clientTraffics []*xray.ClientTraffic) (error, bool) {
+	return s.addTraffic(nil, clientTraffics, false)
+}
+
+func (s *InboundService) addTraffic(inboundTraffics []*xray.Traffic, clientTraffics []*xray.ClientTraffic, setOnline bool) (error, bool) {
 	var err error
 	db := database.GetDB()
 	tx := db.Begin()
@@ -955,7 +1208,7 @@ func (s *InboundService) AddTraffic(inboundTraffics []*xray.Traffic, clientTraff
 	if err != nil {
 		return err, false
 	}
-	err = s.addClientTraffic(tx, clientTraffics)
+	err = s.addClientTraffic(tx, clientTraffics, setOnline)
 	if err != nil {
 		return err, false
 	}
@@ -980,7 +1233,22 @@ func (s *InboundService) AddTraffic(inboundTraffics []*xray.Traffic, clientTraff
 	} else if count > 0 {
 		logger.Debugf("%v inbounds disabled", count)
 	}
-	return nil, (needRestart0 || needRestart1 || needRestart2)
+
+	// A separate error, so a failing customer check does not roll back the traffic
+	needRestart3, count, customerErr := s.disableDepletedCustomers(tx)
+	if customerErr != nil {
+		logger.Warning("Error in disabling clients of depleted customers:", customerErr)
+	} else if count > 0 {
+		logger.Debugf("%v clients of depleted customers disabled", count)
+	}
+
+	needRestart4, count, poolErr := s.disableDepletedPools(tx)
+	if poolErr != nil {
+		logger.Warning("Error in disabling clients of depleted traffic pools:", poolErr)
+	} else if count > 0 {
+		logger.Debugf("%v clients of depleted traffic pools disabled", count)
+	}
+	return nil, (needRestart0 || needRestart1 || needRestart2 || needRestart3 || needRestart4)
 }
 
 func (s *InboundService) addInboundTraffic(tx *gorm.DB, traffics []*xray.Traffic) error {
@@ -1006,11 +1274,16 @@ func (s *InboundService) addInboundTraffic(tx *gorm.DB, traffics []*xray.Traffic
 	return nil
 }
 
-func (s *InboundService) addClientTraffic(tx *gorm.DB, traffics []*xray.ClientTraffic) (err error) {
+// clientTrafficSaveBatch is the number of client traffic rows saved with one statement.
+const clientTrafficSaveBatch = 500
+
+func (s *InboundService) addClientTraffic(tx *gorm.DB, traffics []*xray.ClientTraffic, setOnline bool) (err error) {
+	detection := getOnlineDetection()
+	now := time.Now().UnixMilli()
 	if len(traffics) == 0 {
-		// Empty onlineUsers
-		if p != nil {
-			p.SetOnlineClients(nil)
+		// Only clients within the idle window stay online
+		if p != nil && setOnline {
+			p.SetOnlineClients(detection.onlineClients(nil, now))
 		}
 		return nil
 	}
@@ -1032,44 +1305,85 @@ func (s *InboundService) addClientTraffic(tx *gorm.DB, traffics []*xray.ClientTr
 		return nil
 	}
 
-	dbClientTraffics, err = s.adjustTraffics(tx, dbClientTraffics)
+	// Deferred expiry timers start with the first observed traffic
+	usedEmails := make(map[string]bool, len(traffics))
+	for _, traffic := range traffics {
+		if traffic.Up+traffic.Down > 0 {
+			usedEmails[traffic.Email] = true
+		}
+	}
+	dbClientTraffics, err = s.adjustTraffics(tx, dbClientTraffics, usedEmails)
 	if err != nil {
 		return err
 	}
 
-	for dbTraffic_index := range dbClientTraffics {
-		for traffic_index := range traffics {
-			if dbClientTraffics[dbTraffic_index].Email == traffics[traffic_index].Email {
-				dbClientTraffics[dbTraffic_index].Up += traffics[traffic_index].Up
-				dbClientTraffics[dbTraffic_index].Down += traffics[traffic_index].Down
-				dbClientTraffics[dbTraffic_index].AllTime += (traffics[traffic_index].Up + traffics[traffic_index].Down)
+	trafficByEmail := make(map[string]*xray.ClientTraffic, len(traffics))
+	for _, traffic := range traffics {
+		trafficByEmail[traffic.Email] = traffic
+	}
+	poolTraffics := map[int]*xray.ClientTraffic{}
+	for _, dbTraffic := range dbClientTraffics {
+		traffic, ok := trafficByEmail[dbTraffic.Email]
+		if !ok {
+			continue
+		}
+		dbTraffic.Up += traffic.Up
+		dbTraffic.Down += traffic.Down
+		dbTraffic.AllTime += (traffic.Up + traffic.Down)
+		if dbTraffic.TrafficPoolId > 0 {
+			pool, ok := poolTraffics[dbTraffic.TrafficPoolId]
+			if !ok {
+				pool = &xray.ClientTraffic{}
+				poolTraffics[dbTraffic.TrafficPoolId] = pool
+			}
+			pool.Up += traffic.Up
+			pool.Down += traffic.Down
+		}
 
-				// Add user in onlineUsers array on traffic
-				if traffics[traffic_index].Up+traffics[traffic_index].Down > 0 {
-					onlineClients = append(onlineClients, traffics[traffic_index].Email)
-					dbClientTraffics[dbTraffic_index].LastOnline = time.Now().UnixMilli()
-				}
-				break
+		// Add user in onlineUsers array on traffic counting as activity
+		if detection.isActive(traffic) {
+			onlineClients = append(onlineClients, traffic.Email)
+			dbTraffic.LastOnline = now
+			if dbTraffic.FirstUsedAt == 0 {
+				dbTraffic.FirstUsedAt = dbTraffic.LastOnline
 			}
 		}
 	}
 
 	// Set onlineUsers
-	p.SetOnlineClients(onlineClients)
+	if p != nil && setOnline {
+		p.SetOnlineClients(detection.onlineClients(onlineClients, now))
+	}
 
-	err = tx.Save(dbClientTraffics).Error
-	if err != nil {
-		logger.Warning("AddClientTraffic update data ", err)
+	// Saved in batches, as one statement for all clients runs over the SQLite variable limit
+	for batch := range slices.Chunk(dbClientTraffics, clientTrafficSaveBatch) {
+		if err = tx.Save(batch).Error; err != nil {
+			logger.Warning("AddClientTraffic update data ", err)
+			break
+		}
+	}
+	for poolId, traffic := range poolTraffics {
+		err = tx.Model(model.TrafficPool{}).Where("id = ?", poolId).Updates(map[string]any{
+			"up":   gorm.Expr("up + ?", traffic.Up),
+			"down": gorm.Expr("down + ?", traffic.Down),
+		}).Error
+		if err != nil {
+			logger.Warning("AddClientTraffic update traffic pool ", err)
+		}
 	}
 
 	return nil
 }
 
-func (s *InboundService) adjustTraffics(tx *gorm.DB, dbClientTraffics []*xray.ClientTraffic) ([]*xray.ClientTraffic, error) {
+// adjustTraffics starts the deferred expiry timers of clients in usedEmails.
+// A negative expiry time holds the duration that starts counting at first use.
+func (s *InboundService) adjustTraffics(tx *gorm.DB, dbClientTraffics []*xray.ClientTraffic, usedEmails map[string]bool) ([]*xray.ClientTraffic, error) {
 	inboundIds := make([]int, 0, len(dbClientTraffics))
+	pendingTraffics := make(map[string]*xray.ClientTraffic)
 	for _, dbClientTraffic := range dbClientTraffics {
-		if dbClientTraffic.ExpiryTime < 0 {
+		if dbClientTraffic.ExpiryTime < 0 && usedEmails[dbClientTraffic.Email] {
 			inboundIds = append(inboundIds, dbClientTraffic.InboundId)
+			pendingTraffics[dbClientTraffic.Email] = dbClientTraffic
 		}
 	}
 
@@ -1087,15 +1401,13 @@ func (s *InboundService) adjustTraffics(tx *gorm.DB, dbClientTraffics []*xray.Cl
 				var newClients []any
 				for client_index := range clients {
 					c := clients[client_index].(map[string]any)
-					for traffic_index := range dbClientTraffics {
-						if dbClientTraffics[traffic_index].ExpiryTime < 0 && c["email"] == dbClientTraffics[traffic_index].Email {
-							oldExpiryTime := c["expiryTime"].(float64)
-							newExpiryTime := (time.Now().Unix() * 1000) - int64(oldExpiryTime)
-							c["expiryTime"] = newExpiryTime
-							c["updated_at"] = time.Now().Unix() * 1000
-							dbClientTraffics[traffic_index].ExpiryTime = newExpiryTime
-							break
-						}
+					email, _ := c["email"].(string)
+					if traffic, ok := pendingTraffics[email]; ok && traffic.ExpiryTime < 0 {
+						oldExpiryTime := c["expiryTime"].(float64)
+						newExpiryTime := (time.Now().Unix() * 1000) - int64(oldExpiryTime)
+						c["expiryTime"] = newExpiryTime
+						c["updated_at"] = time.Now().Unix() * 1000
+						traffic.ExpiryTime = newExpiryTime
 					}
 					// Backfill created_at and updated_at
 					if _, ok := c["created_at"]; !ok {
@@ -1147,8 +1459,10 @@ func (s *InboundService) autoRenewClients(tx *gorm.DB) (bool, int64, error) {
 		client   map[string]any
 	}
 
-	for _, traffic := range traffics {
+	trafficIndexes := make(map[string]int, len(traffics))
+	for traffic_index, traffic := range traffics {
 		inbound_ids = append(inbound_ids, traffic.InboundId)
+		trafficIndexes[traffic.Email] = traffic_index
 	}
 	err = tx.Model(model.Inbound{}).Where("id IN ?", inbound_ids).Find(&inbounds).Error
 	if err != nil {
@@ -1160,33 +1474,33 @@ func (s *InboundService) autoRenewClients(tx *gorm.DB) (bool, int64, error) {
 		clients := settings["clients"].([]any)
 		for client_index := range clients {
 			c := clients[client_index].(map[string]any)
-			for traffic_index, traffic := range traffics {
-				if traffic.Email == c["email"].(string) {
-					newExpiryTime := traffic.ExpiryTime
-					for newExpiryTime < now {
-						newExpiryTime += (int64(traffic.Reset) * 86400000)
-					}
-					c["expiryTime"] = newExpiryTime
-					traffics[traffic_index].ExpiryTime = newExpiryTime
-					traffics[traffic_index].Down = 0
-					traffics[traffic_index].Up = 0
-					if !traffic.Enable {
-						traffics[traffic_index].Enable = true
-						clientsToAdd = append(clientsToAdd,
-							struct {
-								protocol string
-								tag      string
-								client   map[string]any
-							}{
-								protocol: string(inbounds[inbound_index].Protocol),
-								tag:      inbounds[inbound_index].Tag,
-								client:   c,
-							})
-					}
-					clients[client_index] = any(c)
-					break
-				}
+			traffic_index, ok := trafficIndexes[c["email"].(string)]
+			if !ok {
+				continue
+			}
+			traffic := traffics[traffic_index]
+			newExpiryTime := traffic.ExpiryTime
+			for newExpiryTime < now {
+				newExpiryTime += (int64(traffic.Reset) * 86400000)
+			}
+			c["expiryTime"] = newExpiryTime
+			traffic.ExpiryTime = newExpiryTime
+			traffic.Down = 0
+			traffic.Up = 0
+			if !traffic.Enable {
+				traffic.Enable = true
+				clientsToAdd = append(clientsToAdd,
+					struct {
+						protocol string
+						tag      string
+						client   map[string]any
+					}{
+						protocol: string(inbounds[inbound_index].Protocol),
+						tag:      inbounds[inbound_index].Tag,
+						client:   c,
+					})
 			}
+			clients[client_index] = any(c)
 		}
 		settings["clients"] = clients
 		newSettings, err := json.MarshalIndent(settings, "", "  ")
@@ -1204,7 +1518,7 @@ func (s *InboundService) autoRenewClients(tx *gorm.DB) (bool, int64, error) {
 		return false, 0, err
 	}
 	if p != nil {
-		err1 = s.xrayApi.Init(p.GetAPIPort())
+		err1 = s.xrayApi.Init(coreAPIPort())
 		if err1 != nil {
 			return true, int64(len(traffics)), nil
 		}
@@ -1232,7 +1546,7 @@ func (s *InboundService) disableInvalidInbounds(tx *gorm.DB) (bool, int64, error
 		if err != nil {
 			return false, 0, err
 		}
-		s.xrayApi.Init(p.GetAPIPort())
+		s.xrayApi.Init(coreAPIPort())
 		for _, tag := range tags {
 			err1 := s.xrayApi.DelInbound(tag)
 			if err1 == nil {
@@ -1256,6 +1570,11 @@ func (s *InboundService) disableInvalidInbounds(tx *gorm.DB) (bool, int64, error
 func (s *InboundService) disableInvalidClients(tx *gorm.DB) (bool, int64, error) {
 	now := time.Now().Unix() * 1000
 	needRestart := false
+	// Expired clients whose expiry action keeps them connected are handled by ApplyExpiryActions
+	keepActions := ""
+	if actions := activeExpiryActions(); len(actions) > 0 {
+		keepActions = " AND COALESCE(client_traffics.expiry_action, '') NOT IN ('" + strings.Join(actions, "','") + "')"
+	}
 
 	if p != nil {
 		var results []struct {
@@ -1266,12 +1585,12 @@ func (s *InboundService) disableInvalidClients(tx *gorm.DB) (bool, int64, error)
 		err := tx.Table("inbounds").
 			Select("inbounds.tag, client_traffics.email").
 			Joins("JOIN client_traffics ON inbounds.id = client_traffics.inbound_id").
-			Where("((client_traffics.total > 0 AND client_traffics.up + client_traffics.down >= client_traffics.total) OR (client_traffics.expiry_time > 0 AND client_traffics.expiry_time <= ?)) AND client_traffics.enable = ?", now, true).
+			Where("((client_traffics.total > 0 AND client_traffics.up + client_traffics.down >= client_traffics.total) OR (client_traffics.expiry_time > 0 AND client_traffics.expiry_time <= ?"+keepActions+")) AND client_traffics.enable = ?", now, true).
 			Scan(&results).Error
 		if err != nil {
 			return false, 0, err
 		}
-		s.xrayApi.Init(p.GetAPIPort())
+		s.xrayApi.Init(coreAPIPort())
 		for _, result := range results {
 			err1 := s.xrayApi.RemoveUser(result.Tag, result.Email)
 			if err1 == nil {
@@ -1292,13 +1611,66 @@ func (s *InboundService) disableInvalidClients(tx *gorm.DB) (bool, int64, error)
 		s.xrayApi.Close()
 	}
 	result := tx.Model(xray.ClientTraffic{}).
-		Where("((total > 0 and up + down >= total) or (expiry_time > 0 and expiry_time <= ?)) and enable = ?", now, true).
+		Where("((client_traffics.total > 0 and client_traffics.up + client_traffics.down >= client_traffics.total) or (client_traffics.expiry_time > 0 and client_traffics.expiry_time <= ?"+keepActions+")) and client_traffics.enable = ?", now, true).
 		Update("enable", false)
 	err := result.Error
 	count := result.RowsAffected
 	return needRestart, count, err
 }
 
+// clientRef is a client on the inbound with the tag.
+type clientRef struct {
+	Tag   string
+	Email string
+}
+
+// disableClientRefs removes the clients from the running core and disables their traffic
+// records. Returns whether the core needs a restart because a client could not be removed.
+func (s *InboundService) disableClientRefs(tx *gorm.DB, clients []clientRef) (bool, int64, error) {
+	if len(clients) == 0 {
+		return false, 0, nil
+	}
+	needRestart := false
+	if p != nil {
+		s.xrayApi.Init(coreAPIPort())
+		for _, client := range clients {
+			err1 := s.xrayApi.RemoveUser(client.Tag, client.Email)
+			if err1 == nil {
+				logger.Debug("Client disabled by api:", client.Email)
+			} else if strings.Contains(err1.Error(), fmt.Sprintf("User %s not found.", client.Email)) {
+				logger.Debug("User is already disabled. Nothing to do more...")
+			} else {
+				logger.Debug("Error in disabling client by api:", err1)
+				needRestart = true
+			}
+		}
+		s.xrayApi.Close()
+	}
+	emails := make([]string, 0, len(clients))
+	for _, client := range clients {
+		emails = append(emails, client.Email)
+	}
+	result := tx.Model(xray.ClientTraffic{}).Where("email IN ?", emails).Update("enable", false)
+	return needRestart, result.RowsAffected, result.Error
+}
+
+// enableWithinLimits enables the disabled clients with the emails unless they are paused, over
+// their own quota or expiry, or draw from a depleted traffic pool. Customer limits are checked
+// by the caller and again by the next traffic collection. Returns whether a client was enabled,
+// which needs a core restart.
+func (s *InboundService) enableWithinLimits(tx *gorm.DB, emails []string) (bool, error) {
+	if len(emails) == 0 {
+		return false, nil
+	}
+	result := tx.Model(xray.ClientTraffic{}).
+		Where("email IN ? AND enable = ? AND paused_at = 0", emails, false).
+		Where("total = 0 OR up + down < total").
+		Where("expiry_time <= 0 OR expiry_time > ?", time.Now().UnixMilli()).
+		Where("traffic_pool_id = 0 OR traffic_pool_id IN (SELECT id FROM traffic_pools WHERE total_gb = 0 OR up + down < total_gb)").
+		Update("enable", true)
+	return result.RowsAffected > 0, result.Error
+}
+
 func (s *InboundService) GetInboundTags() (string, error) {
 	db := database.GetDB()
 	var inboundTags []string
@@ -1326,12 +1698,15 @@ func (s *InboundService) AddClientStat(tx *gorm.DB, inboundId int, client *model
 	clientTraffic := xray.ClientTraffic{}
 	clientTraffic.InboundId = inboundId
 	clientTraffic.Email = client.Email
+	clientTraffic.SubId = client.SubID
 	clientTraffic.Total = client.TotalGB
 	clientTraffic.ExpiryTime = client.ExpiryTime
 	clientTraffic.Enable = client.Enable
 	clientTraffic.Up = 0
 	clientTraffic.Down = 0
 	clientTraffic.Reset = client.Reset
+	clientTraffic.Tags = xray.NewTagList(client.Tags)
+	clientTraffic.ExpiryAction = client.ExpiryAction
 	result := tx.Create(&clientTraffic)
 	err := result.Error
 	return err
@@ -1341,16 +1716,33 @@ func (s *InboundService) UpdateClientStat(tx *gorm.DB, email string, client *mod
 	result := tx.Model(xray.ClientTraffic{}).
 		Where("email = ?", email).
 		Updates(map[string]any{
-			"enable":      client.Enable,
-			"email":       client.Email,
-			"total":       client.TotalGB,
-			"expiry_time": client.ExpiryTime,
-			"reset":       client.Reset,
+			"enable":        client.Enable,
+			"email":         client.Email,
+			"sub_id":        client.SubID,
+			"total":         client.TotalGB,
+			"expiry_time":   client.ExpiryTime,
+			"reset":         client.Reset,
+			"tags":          xray.NewTagList(client.Tags),
+			"expiry_action": client.ExpiryAction,
 		})
 	err := result.Error
 	return err
 }
 
+// syncClientSubIds copies the subscription IDs of the clients to their traffic rows.
+func (s *InboundService) syncClientSubIds(tx *gorm.DB, clients []model.Client) error {
+	for _, client := range clients {
+		if client.Email == "" {
+			continue
+		}
+		err := tx.Model(xray.ClientTraffic{}).Where("email = ?", client.Email).Update("sub_id", client.SubID).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *InboundService) UpdateClientIPs(tx *gorm.DB, oldEmail string, newEmail string) error {
 	return tx.Model(model.InboundClientIps{}).Where("client_email = ?", oldEmail).Update("client_email", newEmail).Error
 }
@@ -1378,6 +1770,20 @@ func (s *InboundService) GetClientInboundByTrafficID(trafficId int) (traffic *xr
 	return nil, nil, nil
 }
 
+// GetInboundsBySubId returns the inbounds with a client of the subscription, found through the
+// indexed subscription ID of the client traffic rows, with the traffic of the subscription's clients.
+func (s *InboundService) GetInboundsBySubId(subId string) ([]*model.Inbound, error) {
+	db := database.GetDB()
+	var inbounds []*model.Inbound
+	err := db.Model(model.Inbound{}).Preload("ClientStats", "sub_id = ?", subId).
+		Where("id IN (SELECT inbound_id FROM client_traffics WHERE sub_id = ?)", subId).
+		Order("id").Find(&inbounds).Error
+	if err != nil {
+		return nil, err
+	}
+	return inbounds, nil
+}
+
 func (s *InboundService) GetClientInboundByEmail(email string) (traffic *xray.ClientTraffic, inbound *model.Inbound, err error) {
 	db := database.GetDB()
 	var traffics []*xray.ClientTraffic
@@ -1399,7 +1805,7 @@ func (s *InboundService) GetClientByEmail(clientEmail string) (*xray.ClientTraff
 		return nil, nil, err
 	}
 	if inbound == nil {
-		return nil, nil, common.NewError("Inbound Not Found For Email:", clientEmail)
+		return nil, nil, common.NewCodeError(common.ErrCodeInboundNotFound, map[string]any{"email": clientEmail}, "Inbound Not Found For Email:", clientEmail)
 	}
 
 	clients, err := s.GetClients(inbound)
@@ -1413,7 +1819,7 @@ func (s *InboundService) GetClientByEmail(clientEmail string) (*xray.ClientTraff
 		}
 	}
 
-	return nil, nil, common.NewError("Client Not Found In Inbound For Email:", clientEmail)
+	return nil, nil, common.NewCodeError(common.ErrCodeClientNotFound, map[string]any{"email": clientEmail}, "Client Not Found In Inbound For Email:", clientEmail)
 }
 
 func (s *InboundService) SetClientTelegramUserID(trafficId int, tgId int64) (bool, error) {
@@ -1422,7 +1828,7 @@ func (s *InboundService) SetClientTelegramUserID(trafficId int, tgId int64) (boo
 		return false, err
 	}
 	if inbound == nil {
-		return false, common.NewError("Inbound Not Found For Traffic ID:", trafficId)
+		return false, common.NewCodeError(common.ErrCodeInboundNotFound, map[string]any{"trafficId": trafficId}, "Inbound Not Found For Traffic ID:", trafficId)
 	}
 
 	clientEmail := traffic.Email
@@ -1449,7 +1855,7 @@ func (s *InboundService) SetClientTelegramUserID(trafficId int, tgId int64) (boo
 	}
 
 	if len(clientId) == 0 {
-		return false, common.NewError("Client Not Found For Email:", clientEmail)
+		return false, common.NewCodeError(common.ErrCodeClientNotFound, map[string]any{"email": clientEmail}, "Client Not Found For Email:", clientEmail)
 	}
 
 	var settings map[string]any
@@ -1483,7 +1889,7 @@ func (s *InboundService) checkIsEnabledByEmail(clientEmail string) (bool, error)
 		return false, err
 	}
 	if inbound == nil {
-		return false, common.NewError("Inbound Not Found For Email:", clientEmail)
+		return false, common.NewCodeError(common.ErrCodeInboundNotFound, map[string]any{"email": clientEmail}, "Inbound Not Found For Email:", clientEmail)
 	}
 
 	clients, err := s.GetClients(inbound)
@@ -1509,7 +1915,7 @@ func (s *InboundService) ToggleClientEnableByEmail(clientEmail string) (bool, bo
 		return false, false, err
 	}
 	if inbound == nil {
-		return false, false, common.NewError("Inbound Not Found For Email:", clientEmail)
+		return false, false, common.NewCodeError(common.ErrCodeInboundNotFound, map[string]any{"email": clientEmail}, "Inbound Not Found For Email:", clientEmail)
 	}
 
 	oldClients, err := s.GetClients(inbound)
@@ -1536,7 +1942,7 @@ func (s *InboundService) ToggleClientEnableByEmail(clientEmail string) (bool, bo
 	}
 
 	if len(clientId) == 0 {
-		return false, false, common.NewError("Client Not Found For Email:", clientEmail)
+		return false, false, common.NewCodeError(common.ErrCodeClientNotFound, map[string]any{"email": clientEmail}, "Client Not Found For Email:", clientEmail)
 	}
 
 	var settings map[string]any
@@ -1591,7 +1997,7 @@ func (s *InboundService) ResetClientIpLimitByEmail(clientEmail string, count int
 		return false, err
 	}
 	if inbound == nil {
-		return false, common.NewError("Inbound Not Found For Email:", clientEmail)
+		return false, common.NewCodeError(common.ErrCodeInboundNotFound, map[string]any{"email": clientEmail}, "Inbound Not Found For Email:", clientEmail)
 	}
 
 	oldClients, err := s.GetClients(inbound)
@@ -1616,7 +2022,7 @@ func (s *InboundService) ResetClientIpLimitByEmail(clientEmail string, count int
 	}
 
 	if len(clientId) == 0 {
-		return false, common.NewError("Client Not Found For Email:", clientEmail)
+		return false, common.NewCodeError(common.ErrCodeClientNotFound, map[string]any{"email": clientEmail}, "Client Not Found For Email:", clientEmail)
 	}
 
 	var settings map[string]any
@@ -1650,7 +2056,7 @@ func (s *InboundService) ResetClientExpiryTimeByEmail(clientEmail string, expiry
 		return false, err
 	}
 	if inbound == nil {
-		return false, common.NewError("Inbound Not Found For Email:", clientEmail)
+		return false, common.NewCodeError(common.ErrCodeInboundNotFound, map[string]any{"email": clientEmail}, "Inbound Not Found For Email:", clientEmail)
 	}
 
 	oldClients, err := s.GetClients(inbound)
@@ -1675,7 +2081,7 @@ func (s *InboundService) ResetClientExpiryTimeByEmail(clientEmail string, expiry
 	}
 
 	if len(clientId) == 0 {
-		return false, common.NewError("Client Not Found For Email:", clientEmail)
+		return false, common.NewCodeError(common.ErrCodeClientNotFound, map[string]any{"email": clientEmail}, "Client Not Found For Email:", clientEmail)
 	}
 
 	var settings map[string]any
@@ -1705,14 +2111,14 @@ func (s *InboundService) ResetClientExpiryTimeByEmail(clientEmail string, expiry
 
 func (s *InboundService) ResetClientTrafficLimitByEmail(clientEmail string, totalGB int) (bool, error) {
 	if totalGB < 0 {
-		return false, common.NewError("totalGB must be >= 0")
+		return false, common.NewCodeError(common.ErrCodeValidation, map[string]any{"totalGB": totalGB}, "totalGB must be >= 0")
 	}
 	_, inbound, err := s.GetClientInboundByEmail(clientEmail)
 	if err != nil {
 		return false, err
 	}
 	if inbound == nil {
-		return false, common.NewError("Inbound Not Found For Email:", clientEmail)
+		return false, common.NewCodeError(common.ErrCodeInboundNotFound, map[string]any{"email": clientEmail}, "Inbound Not Found For Email:", clientEmail)
 	}
 
 	oldClients, err := s.GetClients(inbound)
@@ -1737,7 +2143,7 @@ func (s *InboundService) ResetClientTrafficLimitByEmail(clientEmail string, tota
 	}
 
 	if len(clientId) == 0 {
-		return false, common.NewError("Client Not Found For Email:", clientEmail)
+		return false, common.NewCodeError(common.ErrCodeClientNotFound, map[string]any{"email": clientEmail}, "Client Not Found For Email:", clientEmail)
 	}
 
 	var settings map[string]any
@@ -1800,7 +2206,7 @@ func (s *InboundService) ResetClientTraffic(id int, clientEmail string) (bool, e
 		}
 		for _, client := range clients {
 			if client.Email == clientEmail && client.Enable {
-				s.xrayApi.Init(p.GetAPIPort())
+				s.xrayApi.Init(coreAPIPort())
 				cipher := ""
 				if string(inbound.Protocol) == "shadowsocks" {
 					var oldSettings map[string]any
@@ -1817,6 +2223,7 @@ func (s *InboundService) ResetClientTraffic(id int, clientEmail string) (bool, e
 					"flow":     client.Flow,
 					"password": client.Password,
 					"cipher":   cipher,
+					"level":    client.Level,
 				})
 				if err1 == nil {
 					logger.Debug("Client enabled due to reset traffic:", clientEmail)
@@ -1891,6 +2298,14 @@ func (s *InboundService) ResetAllTraffics() error {
 	return err
 }
 
+// ResetInboundTraffic resets the traffic counters of one inbound. Unlike ResetAllTraffics it needs
+// no approval, so the periodic traffic reset uses it.
+func (s *InboundService) ResetInboundTraffic(id int) error {
+	return database.GetDB().Model(model.Inbound{}).
+		Where("id = ?", id).
+		Updates(map[string]any{"up": 0, "down": 0}).Error
+}
+
 func (s *InboundService) DelDepletedClients(id int) (err error) {
 	db := database.GetDB()
 	tx := db.Begin()
@@ -1922,7 +2337,10 @@ func (s *InboundService) DelDepletedClients(id int) (err error) {
 	}
 
 	for _, depletedClient := range depletedClients {
-		emails := strings.Split(depletedClient.Email, ",")
+		emails := make(map[string]bool)
+		for _, email := range strings.Split(depletedClient.Email, ",") {
+			emails[email] = true
+		}
 		oldInbound, err := s.GetInbound(depletedClient.InboundId)
 		if err != nil {
 			return err
@@ -1936,15 +2354,8 @@ func (s *InboundService) DelDepletedClients(id int) (err error) {
 		oldClients := oldSettings["clients"].([]any)
 		var newClients []any
 		for _, client := range oldClients {
-			deplete := false
 			c := client.(map[string]any)
-			for _, email := range emails {
-				if email == c["email"].(string) {
-					deplete = true
-					break
-				}
-			}
-			if !deplete {
+			if !emails[c["email"].(string)] {
 				newClients = append(newClients, client)
 			}
 		}
@@ -2013,11 +2424,19 @@ func (s *InboundService) GetClientTrafficTgBot(tgId int64) ([]*xray.ClientTraffi
 	}
 
 	// Populate UUID and other client data for each traffic record
-	for i := range traffics {
-		if ct, client, e := s.GetClientByEmail(traffics[i].Email); e == nil && ct != nil && client != nil {
-			traffics[i].Enable = client.Enable
-			traffics[i].UUID = client.ID
-			traffics[i].SubId = client.SubID
+	inboundIds := make([]int, 0, len(traffics))
+	for _, traffic := range traffics {
+		inboundIds = append(inboundIds, traffic.InboundId)
+	}
+	clients, err := s.clientsByEmail(inboundIds)
+	if err != nil {
+		return nil, err
+	}
+	for _, traffic := range traffics {
+		if client, ok := clients[traffic.Email]; ok {
+			traffic.Enable = client.Enable
+			traffic.UUID = client.ID
+			traffic.SubId = client.SubID
 		}
 	}
 
@@ -2072,8 +2491,16 @@ func (s *InboundService) GetClientTrafficByID(id string) ([]xray.ClientTraffic,
 		return nil, err
 	}
 	// Reconcile enable flag with client settings per email to avoid stale DB value
+	inboundIds := make([]int, 0, len(traffics))
+	for _, traffic := range traffics {
+		inboundIds = append(inboundIds, traffic.InboundId)
+	}
+	clients, err := s.clientsByEmail(inboundIds)
+	if err != nil {
+		return nil, err
+	}
 	for i := range traffics {
-		if ct, client, e := s.GetClientByEmail(traffics[i].Email); e == nil && ct != nil && client != nil {
+		if client, ok := clients[traffics[i].Email]; ok {
 			traffics[i].Enable = client.Enable
 			traffics[i].UUID = client.ID
 			traffics[i].SubId = client.SubID
@@ -2082,6 +2509,29 @@ func (s *InboundService) GetClientTrafficByID(id string) ([]xray.ClientTraffic,
 	return traffics, err
 }
 
+// clientsByEmail loads the clients of the given inbounds with one query, keyed by email.
+func (s *InboundService) clientsByEmail(inboundIds []int) (map[string]model.Client, error) {
+	clients := make(map[string]model.Client)
+	if len(inboundIds) == 0 {
+		return clients, nil
+	}
+	var inbounds []*model.Inbound
+	err := database.GetDB().Model(model.Inbound{}).Where("id IN ?", inboundIds).Find(&inbounds).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, inbound := range inbounds {
+		inboundClients, err := s.GetClients(inbound)
+		if err != nil {
+			continue
+		}
+		for _, client := range inboundClients {
+			clients[client.Email] = client
+		}
+	}
+	return clients, nil
+}
+
 func (s *InboundService) SearchClientTraffic(query string) (traffic *xray.ClientTraffic, err error) {
 	db := database.GetDB()
 	inbound := &model.Inbound{}
@@ -2326,6 +2776,24 @@ func (s *InboundService) MigrationRequirements() {
 func (s *InboundService) MigrateDB() {
 	s.MigrationRequirements()
 	s.MigrationRemoveOrphanedTraffics()
+	s.MigrateExternalIds()
+	s.MigrateClientSubIds()
+}
+
+// MigrateClientSubIds copies the subscription IDs from the inbound settings to the client traffic
+// rows, for rows created before they were indexed or clients edited behind the panel's back.
+func (s *InboundService) MigrateClientSubIds() {
+	err := database.GetDB().Exec(`
+		UPDATE client_traffics SET sub_id = COALESCE((
+			SELECT JSON_EXTRACT(client.value, '$.subId')
+			FROM inbounds,
+				JSON_EACH(JSON_EXTRACT(inbounds.settings, '$.clients')) AS client
+			WHERE JSON_EXTRACT(client.value, '$.email') = client_traffics.email
+			LIMIT 1
+		), '')`).Error
+	if err != nil {
+		logger.Warning("index client subscription IDs failed:", err)
+	}
 }
 
 func (s *InboundService) GetOnlineClients() []string {
@@ -2415,10 +2883,10 @@ func (s *InboundService) DelInboundClientByEmail(inboundId int, email string) (b
 	}
 
 	if !found {
-		return false, common.NewError(fmt.Sprintf("client with email %s not found", email))
+		return false, common.NewCodeError(common.ErrCodeClientNotFound, map[string]any{"email": email}, fmt.Sprintf("client with email %s not found", email))
 	}
 	if len(newClients) == 0 {
-		return false, common.NewError("no client remained in Inbound")
+		return false, common.NewCodeError(common.ErrCodeClientLastRemaining, nil, "no client remained in Inbound")
 	}
 
 	settings["clients"] = newClients
@@ -2453,7 +2921,7 @@ func (s *InboundService) DelInboundClientByEmail(inboundId int, email string) (b
 		}
 
 		if needApiDel {
-			s.xrayApi.Init(p.GetAPIPort())
+			s.xrayApi.Init(coreAPIPort())
 			if err1 := s.xrayApi.RemoveUser(oldInbound.Tag, email); err1 == nil {
 				logger.Debug("Client deleted by api:", email)
 				needRestart = false
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/config"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+)
+
+// getInboundCertFolder returns the folder the certificate uploaded for an inbound is kept in.
+func getInboundCertFolder(id int) string {
+	return filepath.Join(config.GetDBFolderPath(), "certs", "inbound-"+strconv.Itoa(id))
+}
+
+// parseCertChain parses the certificates of a PEM bundle, leaf first, and checks that each one is
+// signed by the next, so a bundle in the wrong order or with a foreign intermediate is rejected.
+func parseCertChain(certPEM []byte) ([]*x509.Certificate, error) {
+	var chain []*x509.Certificate
+	for rest := certPEM; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, cert)
+	}
+	if len(chain) == 0 {
+		return nil, common.NewError("no certificate found in the PEM data")
+	}
+	for i := 0; i+1 < len(chain); i++ {
+		if err := chain[i].CheckSignatureFrom(chain[i+1]); err != nil {
+			return nil, common.NewErrorf("certificate %d of the chain is not signed by the next one: %v", i+1, err)
+		}
+	}
+	return chain, nil
+}
+
+// describeCertChain returns the details of a certificate chain and whether the system trusts it.
+func describeCertChain(id int, chain []*x509.Certificate) *entity.InboundCertificate {
+	leaf := chain[0]
+	info := &entity.InboundCertificate{
+		InboundId: id,
+		Subject:   leaf.Subject.CommonName,
+		Issuer:    leaf.Issuer.CommonName,
+		DNSNames:  leaf.DNSNames,
+		NotBefore: leaf.NotBefore.UnixMilli(),
+		NotAfter:  leaf.NotAfter.UnixMilli(),
+		ChainSize: len(chain),
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{Intermediates: intermediates}); err != nil {
+		info.TrustError = err.Error()
+	} else {
+		info.Trusted = true
+	}
+	return info
+}
+
+// GetInboundCertificate returns the details of the first certificate in the TLS settings of an
+// inbound, read from its file or from the inline PEM lines.
+func (s *InboundService) GetInboundCertificate(id int) (*entity.InboundCertificate, error) {
+	inbound, err := s.GetInbound(id)
+	if err != nil {
+		return nil, err
+	}
+	var stream struct {
+		Security    string `json:"security"`
+		TlsSettings struct {
+			Certificates []struct {
+				CertificateFile string   `json:"certificateFile"`
+				KeyFile         string   `json:"keyFile"`
+				Certificate     []string `json:"certificate"`
+			} `json:"certificates"`
+		} `json:"tlsSettings"`
+	}
+	if inbound.StreamSettings != "" {
+		if err := json.Unmarshal([]byte(inbound.StreamSettings), &stream); err != nil {
+			return nil, err
+		}
+	}
+	if stream.Security != "tls" || len(stream.TlsSettings.Certificates) == 0 {
+		return nil, common.NewError("inbound has no TLS certificate:", id)
+	}
+	certificate := stream.TlsSettings.Certificates[0]
+	certPEM := []byte(strings.Join(certificate.Certificate, "\n"))
+	if certificate.CertificateFile != "" {
+		if certPEM, err = os.ReadFile(certificate.CertificateFile); err != nil {
+			return nil, err
+		}
+	}
+	chain, err := parseCertChain(certPEM)
+	if err != nil {
+		return nil, err
+	}
+	info := describeCertChain(id, chain)
+	info.CertFile = certificate.CertificateFile
+	info.KeyFile = certificate.KeyFile
+	info.Managed = certificate.CertificateFile != "" && filepath.Dir(certificate.CertificateFile) == getInboundCertFolder(id)
+	return info, nil
+}
+
+// SetInboundCertificate checks a PEM certificate chain and its private key, stores them for the
+// inbound in the managed certificate folder, readable by the panel user only, and points the TLS
+// settings of the inbound at them. Uploading again rotates the certificate in place.
+// Returns the details of the certificate and whether Xray needs restart.
+func (s *InboundService) SetInboundCertificate(id int, certPEM []byte, keyPEM []byte) (*entity.InboundCertificate, bool, error) {
+	if _, err := tls.X509KeyPair(certPEM, keyPEM); err != nil {
+		return nil, false, common.NewCodeError(common.ErrCodeValidation, nil, "invalid certificate or key:", err)
+	}
+	chain, err := parseCertChain(certPEM)
+	if err != nil {
+		return nil, false, common.WithCode(common.ErrCodeValidation, err)
+	}
+	if now := time.Now(); now.After(chain[0].NotAfter) || now.Before(chain[0].NotBefore) {
+		return nil, false, common.NewCodeError(common.ErrCodeValidation, nil, "certificate is not valid now, it is valid from",
+			chain[0].NotBefore.Format(time.RFC3339), "to", chain[0].NotAfter.Format(time.RFC3339))
+	}
+
+	inbound, err := s.GetInbound(id)
+	if err != nil {
+		return nil, false, err
+	}
+	stream := map[string]any{}
+	if inbound.StreamSettings != "" {
+		if err := json.Unmarshal([]byte(inbound.StreamSettings), &stream); err != nil {
+			return nil, false, err
+		}
+	}
+	if security, _ := stream["security"].(string); security == "reality" {
+		return nil, false, common.NewCodeError(common.ErrCodeValidation, nil, "REALITY inbounds use no certificate")
+	}
+
+	folder := getInboundCertFolder(id)
+	if err := os.MkdirAll(folder, 0o700); err != nil {
+		return nil, false, err
+	}
+	certFile := filepath.Join(folder, "fullchain.pem")
+	keyFile := filepath.Join(folder, "privkey.pem")
+	for path, data := range map[string][]byte{certFile: certPEM, keyFile: keyPEM} {
+		// Written next to the file and renamed, so Xray never reads half a certificate
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, data, 0o600); err != nil {
+			return nil, false, err
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			os.Remove(tmp)
+			return nil, false, err
+		}
+	}
+
+	tlsSettings, _ := stream["tlsSettings"].(map[string]any)
+	if tlsSettings == nil {
+		tlsSettings = map[string]any{}
+	}
+	certificates, _ := tlsSettings["certificates"].([]any)
+	certificate := map[string]any{}
+	if len(certificates) > 0 {
+		if first, ok := certificates[0].(map[string]any); ok {
+			certificate = first
+		}
+	} else {
+		certificates = []any{certificate}
+	}
+	delete(certificate, "certificate")
+	delete(certificate, "key")
+	certificate["certificateFile"] = certFile
+	certificate["keyFile"] = keyFile
+	certificates[0] = certificate
+	tlsSettings["certificates"] = certificates
+	if serverName, _ := tlsSettings["serverName"].(string); serverName == "" && len(chain[0].DNSNames) > 0 {
+		tlsSettings["serverName"] = chain[0].DNSNames[0]
+	}
+	stream["security"] = "tls"
+	stream["tlsSettings"] = tlsSettings
+
+	data, err := json.MarshalIndent(stream, "", "  ")
+	if err != nil {
+		return nil, false, err
+	}
+	// A rotated certificate keeps its paths, so Xray is restarted to load it
+	rotated := string(data) == inbound.StreamSettings
+	inbound.StreamSettings = string(data)
+	_, needRestart, err := s.UpdateInbound(inbound)
+	if err != nil {
+		return nil, needRestart, err
+	}
+
+	info := describeCertChain(id, chain)
+	info.CertFile = certFile
+	info.KeyFile = keyFile
+	info.Managed = true
+	return info, needRestart || rotated, nil
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"encoding/json"
+	"slices"
+
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+)
+
+// ConvertInbound moves an inbound to another transport and security, such as from WebSocket with
+// TLS to XHTTP with REALITY, generating the keys and paths the new setup needs. The clients, port,
+// tag and traffic stay, so subscriptions hand out the new links from the same save. Values left
+// out of the options keep the current transport and security, REALITY keys are kept when the
+// inbound stays on REALITY and the TLS settings when it stays on TLS without a new certificate.
+// Returns the inbound and whether Xray needs restart.
+func (s *InboundService) ConvertInbound(id int, options InboundWizardOptions) (*model.Inbound, bool, error) {
+	inbound, err := s.GetInbound(id)
+	if err != nil {
+		return nil, false, err
+	}
+	if !slices.Contains(wizardProtocols, inbound.Protocol) {
+		return nil, false, common.NewCodeError(common.ErrCodeValidation, nil, "inbounds of protocol", inbound.Protocol, "cannot be converted")
+	}
+	old := map[string]any{}
+	if inbound.StreamSettings != "" {
+		if err := json.Unmarshal([]byte(inbound.StreamSettings), &old); err != nil {
+			return nil, false, common.NewError("stream settings invalid:", err)
+		}
+	}
+	oldNetwork, _ := old["network"].(string)
+	oldSecurity, _ := old["security"].(string)
+	oldTls, _ := old["tlsSettings"].(map[string]any)
+	oldReality, _ := old["realitySettings"].(map[string]any)
+
+	options.Protocol = inbound.Protocol
+	options.Port = inbound.Port
+	if options.Transport == "" {
+		options.Transport = oldNetwork
+	}
+	if options.Security == "" {
+		options.Security = oldSecurity
+	}
+	if options.Domain == "" && oldTls != nil {
+		options.Domain, _ = oldTls["serverName"].(string)
+	}
+	keepTls := options.Security == "tls" && oldSecurity == "tls" && oldTls != nil && options.CertFile == "" && options.KeyFile == ""
+	if err := resolveWizardOptions(&options, !keepTls); err != nil {
+		return nil, false, err
+	}
+
+	stream, err := wizardStreamSettings(options, inbound.Port)
+	if err != nil {
+		return nil, false, err
+	}
+	if keepTls {
+		stream["tlsSettings"] = oldTls
+	}
+	if options.Security == "reality" && oldReality != nil && options.Target == "" && options.ServerNames == "" {
+		stream["realitySettings"] = oldReality
+	}
+	if sockopt, ok := old["sockopt"]; ok {
+		stream["sockopt"] = sockopt
+	}
+	if externalProxy, ok := old["externalProxy"]; ok && !options.BehindCdn && options.Security != "reality" {
+		stream["externalProxy"] = externalProxy
+	}
+	data, err := json.MarshalIndent(stream, "", "  ")
+	if err != nil {
+		return nil, false, err
+	}
+	inbound.StreamSettings = string(data)
+
+	// The Vision flow works over raw TCP with TLS or REALITY only, a chosen Vision variant is kept
+	if inbound.Protocol == model.VLESS {
+		settings := map[string]any{}
+		if err := json.Unmarshal([]byte(inbound.Settings), &settings); err != nil {
+			return nil, false, err
+		}
+		flow := ""
+		if options.Transport == "tcp" && options.Security != "none" {
+			flow = "xtls-rprx-vision"
+		}
+		clients, _ := settings["clients"].([]any)
+		for _, client := range clients {
+			client, ok := client.(map[string]any)
+			if !ok {
+				continue
+			}
+			if current, _ := client["flow"].(string); flow == "" || current == "" {
+				client["flow"] = flow
+			}
+		}
+		data, err := json.MarshalIndent(settings, "", "  ")
+		if err != nil {
+			return nil, false, err
+		}
+		inbound.Settings = string(data)
+	}
+
+	return s.UpdateInbound(inbound)
+}
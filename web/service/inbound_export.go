@@ -0,0 +1,60 @@
+package service
+
+import (
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+)
+
+// ExportInbound returns an inbound of a user as a self-contained bundle accepted by the import endpoint.
+// Clients are part of the inbound settings. Their traffic records and the inbound counters
+// are only kept when withStats is set; otherwise the import starts them from zero.
+func (s *InboundService) ExportInbound(userId int, id int, withStats bool) (*model.Inbound, error) {
+	db := database.GetDB()
+	inbound := &model.Inbound{}
+	query := db.Model(model.Inbound{})
+	if withStats {
+		query = query.Preload("ClientStats")
+	}
+	err := query.Where("id = ? AND user_id = ?", id, userId).First(inbound).Error
+	if err != nil {
+		return nil, common.NewCodeError(common.ErrCodeInboundNotFound, map[string]any{"id": id}, "inbound not found:", id)
+	}
+	prepareInboundExport(inbound, withStats)
+	return inbound, nil
+}
+
+// ExportInbounds returns all inbounds of a user as bundles accepted by the import endpoint.
+func (s *InboundService) ExportInbounds(userId int, withStats bool) ([]*model.Inbound, error) {
+	db := database.GetDB()
+	var inbounds []*model.Inbound
+	query := db.Model(model.Inbound{})
+	if withStats {
+		query = query.Preload("ClientStats")
+	}
+	err := query.Where("user_id = ?", userId).Order("id").Find(&inbounds).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, inbound := range inbounds {
+		prepareInboundExport(inbound, withStats)
+	}
+	return inbounds, nil
+}
+
+// prepareInboundExport strips the database identity so the bundle can be imported on any panel.
+func prepareInboundExport(inbound *model.Inbound, withStats bool) {
+	inbound.Id = 0
+	inbound.UserId = 0
+	if !withStats {
+		inbound.Up = 0
+		inbound.Down = 0
+		inbound.AllTime = 0
+		inbound.ClientStats = nil
+		return
+	}
+	for i := range inbound.ClientStats {
+		inbound.ClientStats[i].Id = 0
+		inbound.ClientStats[i].InboundId = 0
+	}
+}
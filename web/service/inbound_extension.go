@@ -0,0 +1,47 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/util/json_util"
+	"github.com/mhsanaei/3x-ui/v2/xray"
+)
+
+// extensionReservedKeys are the fields of an Xray inbound the panel manages itself, which an
+// extension cannot override.
+var extensionReservedKeys = []string{"tag", "listen", "port", "protocol"}
+
+// checkExtension normalizes the extension of an inbound and checks it is a JSON object leaving
+// the fields the panel manages alone, and that xray -test accepts the inbound with it merged in.
+func checkExtension(inbound *model.Inbound) error {
+	if strings.TrimSpace(inbound.Extension) == "" {
+		inbound.Extension = ""
+		return nil
+	}
+	var extension map[string]any
+	if err := json.Unmarshal([]byte(inbound.Extension), &extension); err != nil || extension == nil {
+		return common.NewError("extension must be a JSON object")
+	}
+	for _, key := range extensionReservedKeys {
+		if _, ok := extension[key]; ok {
+			return common.NewError("extension can not set the inbound", key)
+		}
+	}
+	data, err := json.MarshalIndent(extension, "", "  ")
+	if err != nil {
+		return err
+	}
+	inbound.Extension = string(data)
+
+	xrayConfig := &xray.Config{
+		LogConfig:       json_util.RawMessage(`{"loglevel": "none"}`),
+		OutboundConfigs: json_util.RawMessage(`[{"protocol": "freedom"}]`),
+	}
+	for _, inboundConfig := range inbound.GenXrayInboundConfigs() {
+		xrayConfig.InboundConfigs = append(xrayConfig.InboundConfigs, *inboundConfig)
+	}
+	return xray.TestConfig(xrayConfig)
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"encoding/json"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+
+	"github.com/google/uuid"
+)
+
+// checkExternalId validates an external ID given by the caller, empty IDs are generated.
+func checkExternalId(externalId string) error {
+	if externalId == "" {
+		return nil
+	}
+	if _, err := uuid.Parse(externalId); err != nil {
+		return common.NewCodeError(common.ErrCodeValidation, map[string]any{"externalId": externalId}, "invalid external ID, expected a UUID:", externalId)
+	}
+	return nil
+}
+
+// assignClientExternalIds gives every client in settings an external ID. A client without one keeps
+// the ID of the client with the same email in previous, so the ID survives edits that omit it, and
+// gets a new one otherwise. The settings are returned unchanged when every client already has an ID.
+func assignClientExternalIds(settings string, previous string) (string, error) {
+	var parsed map[string]any
+	if err := json.Unmarshal([]byte(settings), &parsed); err != nil || parsed == nil {
+		return settings, err
+	}
+	clients, ok := parsed["clients"].([]any)
+	if !ok {
+		return settings, nil
+	}
+
+	previousIds := map[string]string{}
+	var previousSettings struct {
+		Clients []model.Client `json:"clients"`
+	}
+	if previous != "" && json.Unmarshal([]byte(previous), &previousSettings) == nil {
+		for _, client := range previousSettings.Clients {
+			if client.Email != "" && client.ExternalId != "" {
+				previousIds[client.Email] = client.ExternalId
+			}
+		}
+	}
+
+	changed := false
+	for i := range clients {
+		client, ok := clients[i].(map[string]any)
+		if !ok {
+			continue
+		}
+		if externalId, _ := client["externalId"].(string); externalId != "" {
+			if err := checkExternalId(externalId); err != nil {
+				return settings, err
+			}
+			continue
+		}
+		email, _ := client["email"].(string)
+		if externalId, ok := previousIds[email]; ok {
+			client["externalId"] = externalId
+		} else {
+			client["externalId"] = uuid.NewString()
+		}
+		changed = true
+	}
+	if !changed {
+		return settings, nil
+	}
+	bs, err := json.MarshalIndent(parsed, "", "  ")
+	if err != nil {
+		return settings, err
+	}
+	return string(bs), nil
+}
+
+// GetInboundByExternalId returns the inbound with the given external ID.
+func (s *InboundService) GetInboundByExternalId(externalId string) (*model.Inbound, error) {
+	db := database.GetDB()
+	inbound := &model.Inbound{}
+	err := db.Model(model.Inbound{}).Where("external_id = ?", externalId).First(inbound).Error
+	if database.IsNotFound(err) {
+		return nil, common.NewCodeError(common.ErrCodeInboundNotFound, map[string]any{"externalId": externalId}, "Inbound Not Found For External ID:", externalId)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return inbound, nil
+}
+
+// GetClientByExternalId returns the client with the given external ID and the inbound it belongs to.
+func (s *InboundService) GetClientByExternalId(externalId string) (*model.Inbound, *model.Client, error) {
+	db := database.GetDB()
+	var inbounds []*model.Inbound
+	err := db.Model(model.Inbound{}).Where("settings LIKE ?", "%"+externalId+"%").Find(&inbounds).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, inbound := range inbounds {
+		clients, err := s.GetClients(inbound)
+		if err != nil {
+			continue
+		}
+		for _, client := range clients {
+			if client.ExternalId == externalId {
+				return inbound, &client, nil
+			}
+		}
+	}
+	return nil, nil, common.NewCodeError(common.ErrCodeClientNotFound, map[string]any{"externalId": externalId}, "Client Not Found For External ID:", externalId)
+}
+
+// dropExistingClients removes the clients whose external ID is already in use from the settings of
+// data, so creating a client by external ID twice does not fail. It returns the number of clients left.
+func (s *InboundService) dropExistingClients(data *model.Inbound) (int, error) {
+	var settings map[string]any
+	if err := json.Unmarshal([]byte(data.Settings), &settings); err != nil {
+		return 0, err
+	}
+	clients, _ := settings["clients"].([]any)
+	kept := make([]any, 0, len(clients))
+	for _, it := range clients {
+		if client, ok := it.(map[string]any); ok {
+			if externalId, _ := client["externalId"].(string); externalId != "" {
+				if err := checkExternalId(externalId); err != nil {
+					return 0, err
+				}
+				if _, _, err := s.GetClientByExternalId(externalId); err == nil {
+					logger.Debug("Client with external ID already exists:", externalId)
+					continue
+				}
+			}
+		}
+		kept = append(kept, it)
+	}
+	if len(kept) == len(clients) {
+		return len(kept), nil
+	}
+	settings["clients"] = kept
+	bs, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	data.Settings = string(bs)
+	return len(kept), nil
+}
+
+// MigrateExternalIds gives inbounds and clients created before external IDs existed, or added
+// behind the panel's back, a stable external ID.
+func (s *InboundService) MigrateExternalIds() {
+	db := database.GetDB()
+	var inbounds []*model.Inbound
+	if err := db.Model(model.Inbound{}).Find(&inbounds).Error; err != nil {
+		logger.Warning("assign external IDs failed:", err)
+		return
+	}
+	count := 0
+	for _, inbound := range inbounds {
+		updates := map[string]any{}
+		if inbound.ExternalId == "" {
+			updates["external_id"] = uuid.NewString()
+		}
+		settings, err := assignClientExternalIds(inbound.Settings, "")
+		if err != nil {
+			logger.Warningf("assign client external IDs of inbound %d failed: %v", inbound.Id, err)
+		} else if settings != inbound.Settings {
+			updates["settings"] = settings
+		}
+		if len(updates) == 0 {
+			continue
+		}
+		if err := db.Model(model.Inbound{}).Where("id = ?", inbound.Id).Updates(updates).Error; err != nil {
+			logger.Warningf("assign external IDs of inbound %d failed: %v", inbound.Id, err)
+			continue
+		}
+		count++
+	}
+	if count > 0 {
+		logger.Infof("Assigned external IDs to %d inbounds", count)
+	}
+}
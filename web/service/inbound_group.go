@@ -0,0 +1,127 @@
+package service
+
+import (
+	"slices"
+	"sort"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+	"github.com/mhsanaei/3x-ui/v2/xray"
+
+	"gorm.io/gorm"
+)
+
+// Actions that can be applied to all inbounds of a group.
+const (
+	GroupActionEnable       = "enable"
+	GroupActionDisable      = "disable"
+	GroupActionResetTraffic = "resetTraffic"
+)
+
+var groupActions = []string{GroupActionEnable, GroupActionDisable, GroupActionResetTraffic}
+
+// GetInboundGroups returns aggregated statistics per inbound group of a user, sorted by name.
+// Inbounds without a group are reported under an empty name.
+func (s *InboundService) GetInboundGroups(userId int) ([]*entity.InboundGroup, error) {
+	inbounds, err := s.GetInbounds(userId)
+	if err != nil {
+		return nil, err
+	}
+	onlines := s.GetOnlineClients()
+
+	groups := map[string]*entity.InboundGroup{}
+	for _, inbound := range inbounds {
+		group, ok := groups[inbound.Group]
+		if !ok {
+			group = &entity.InboundGroup{Name: inbound.Group}
+			groups[inbound.Group] = group
+		}
+		group.Inbounds++
+		if inbound.Enable {
+			group.EnabledInbounds++
+		}
+		group.Up += inbound.Up
+		group.Down += inbound.Down
+		group.AllTime += inbound.AllTime
+		for _, stat := range inbound.ClientStats {
+			group.Clients++
+			if stat.Enable {
+				group.EnabledClients++
+			}
+			if slices.Contains(onlines, stat.Email) {
+				group.OnlineClients++
+			}
+		}
+	}
+
+	result := make([]*entity.InboundGroup, 0, len(groups))
+	for _, group := range groups {
+		result = append(result, group)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+func (s *InboundService) getGroupInbounds(userId int, group string) ([]*model.Inbound, error) {
+	db := database.GetDB()
+	var inbounds []*model.Inbound
+	err := db.Model(model.Inbound{}).Where("user_id = ? AND `group` = ?", userId, group).Find(&inbounds).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(inbounds) == 0 {
+		return nil, common.NewCodeError(common.ErrCodeNotFound, map[string]any{"group": group}, "inbound group not found:", group)
+	}
+	return inbounds, nil
+}
+
+// ApplyInboundGroupAction enables, disables or resets the traffic of all inbounds in a group.
+// Resetting traffic clears the inbound counters and the counters of their clients.
+// Returns the number of affected inbounds and whether Xray needs restart.
+func (s *InboundService) ApplyInboundGroupAction(userId int, group string, action string) (int, bool, error) {
+	if !slices.Contains(groupActions, action) {
+		return 0, false, common.NewError("invalid group action:", action)
+	}
+	inbounds, err := s.getGroupInbounds(userId, group)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if action == GroupActionResetTraffic {
+		ids := make([]int, 0, len(inbounds))
+		for _, inbound := range inbounds {
+			ids = append(ids, inbound.Id)
+		}
+		err = database.GetDB().Transaction(func(tx *gorm.DB) error {
+			err := tx.Model(model.Inbound{}).Where("id IN ?", ids).
+				Updates(map[string]any{"up": 0, "down": 0}).Error
+			if err != nil {
+				return err
+			}
+			return tx.Model(xray.ClientTraffic{}).Where("inbound_id IN ?", ids).
+				Updates(map[string]any{"enable": true, "up": 0, "down": 0}).Error
+		})
+		if err != nil {
+			return 0, false, err
+		}
+		// Depleted clients were removed from Xray and are re-enabled above
+		return len(inbounds), true, nil
+	}
+
+	enable := action == GroupActionEnable
+	affected := 0
+	needRestart := false
+	for _, inbound := range inbounds {
+		changed, restart, err := s.SetInboundEnable(inbound.Id, enable)
+		needRestart = needRestart || restart
+		if err != nil {
+			return affected, needRestart, err
+		}
+		if changed {
+			affected++
+		}
+	}
+	return affected, needRestart, nil
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"maps"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+)
+
+const (
+	// inboundHealthTimeout bounds the connection and handshake of a single check.
+	inboundHealthTimeout = 5 * time.Second
+	// inboundHealthFailures is the number of consecutive failed checks before an inbound counts as down.
+	inboundHealthFailures = 2
+)
+
+var (
+	inboundHealthLock    sync.RWMutex
+	inboundHealth        = map[int]*entity.InboundHealth{}
+	inboundHealthVersion atomic.Uint64 // Changes whenever an inbound goes down or comes back up
+)
+
+// InboundHealthService checks that the panel's own inbounds accept connections, so subscriptions
+// can move failing inbounds to the end or leave them out. Inbounds are checked locally with a TCP
+// connection, followed by a TLS handshake when the inbound uses TLS or REALITY. UDP based transports
+// and inbounds listening on a unix socket are not checked and always count as healthy.
+type InboundHealthService struct {
+	settingService SettingService
+}
+
+// Check runs a health check on all enabled inbounds and records the results.
+// While health checks are disabled the recorded results are cleared instead.
+func (s *InboundHealthService) Check() error {
+	mode, err := s.settingService.GetHealthCheckMode()
+	if err != nil {
+		return err
+	}
+	if mode == "" {
+		inboundHealthLock.Lock()
+		setInboundHealth(map[int]*entity.InboundHealth{})
+		inboundHealthLock.Unlock()
+		return nil
+	}
+
+	var inbounds []*model.Inbound
+	err = database.GetDB().Model(model.Inbound{}).Where("enable = ?", true).Find(&inbounds).Error
+	if err != nil {
+		return err
+	}
+
+	results := make(map[int]*entity.InboundHealth, len(inbounds))
+	var resultsLock sync.Mutex
+	var wg sync.WaitGroup
+	for _, inbound := range inbounds {
+		if !isInboundCheckable(inbound) {
+			continue
+		}
+		wg.Add(1)
+		go func(inbound *model.Inbound) {
+			defer wg.Done()
+			err := checkInbound(inbound)
+			resultsLock.Lock()
+			results[inbound.Id] = &entity.InboundHealth{InboundId: inbound.Id, Healthy: true, CheckedAt: time.Now().UnixMilli()}
+			if err != nil {
+				results[inbound.Id].Error = err.Error()
+			}
+			resultsLock.Unlock()
+		}(inbound)
+	}
+	wg.Wait()
+
+	inboundHealthLock.Lock()
+	defer inboundHealthLock.Unlock()
+	for id, result := range results {
+		if result.Error != "" {
+			if old, ok := inboundHealth[id]; ok {
+				result.Failures = old.Failures
+			}
+			result.Failures++
+			result.Healthy = result.Failures < inboundHealthFailures
+			if result.Failures == inboundHealthFailures {
+				logger.Warningf("Inbound %d failed its health check: %s", id, result.Error)
+			}
+		} else if old, ok := inboundHealth[id]; ok && !old.Healthy {
+			logger.Infof("Inbound %d passed its health check again", id)
+		}
+	}
+	setInboundHealth(results)
+	return nil
+}
+
+// setInboundHealth replaces the recorded health check results, changing the health version when
+// the inbounds that are down change. The lock must be held.
+func setInboundHealth(results map[int]*entity.InboundHealth) {
+	if !maps.Equal(downInbounds(inboundHealth), downInbounds(results)) {
+		inboundHealthVersion.Add(1)
+	}
+	inboundHealth = results
+}
+
+// downInbounds returns the IDs of the inbounds the health check results count as down.
+func downInbounds(results map[int]*entity.InboundHealth) map[int]bool {
+	down := map[int]bool{}
+	for id, result := range results {
+		if !result.Healthy {
+			down[id] = true
+		}
+	}
+	return down
+}
+
+// HealthVersion returns a counter that changes whenever an inbound goes down or comes back up, so
+// results depending on the health of the inbounds can be cached until then.
+func (s *InboundHealthService) HealthVersion() uint64 {
+	return inboundHealthVersion.Load()
+}
+
+// GetInboundHealth returns the latest health check results of all checked inbounds.
+func (s *InboundHealthService) GetInboundHealth() []entity.InboundHealth {
+	inboundHealthLock.RLock()
+	defer inboundHealthLock.RUnlock()
+	results := make([]entity.InboundHealth, 0, len(inboundHealth))
+	for _, result := range inboundHealth {
+		results = append(results, *result)
+	}
+	return results
+}
+
+// IsInboundDown reports whether an inbound failed enough consecutive health checks to count as down.
+func (s *InboundHealthService) IsInboundDown(id int) bool {
+	inboundHealthLock.RLock()
+	defer inboundHealthLock.RUnlock()
+	result, ok := inboundHealth[id]
+	return ok && !result.Healthy
+}
+
+// ArrangeByHealth combines the subscription entries of healthy and failing inbounds according to the
+// health check mode: failing ones are moved to the end or left out. When all inbounds are failing
+// they are kept, as an empty subscription helps nobody.
+func ArrangeByHealth[T any](mode string, healthy []T, failing []T) []T {
+	if mode == "drop" && len(healthy) > 0 {
+		return healthy
+	}
+	return append(healthy, failing...)
+}
+
+func isInboundCheckable(inbound *model.Inbound) bool {
+	switch inbound.Protocol {
+	case model.WireGuard, model.Tunnel:
+		return false
+	}
+	if len(inbound.Listen) > 0 && (inbound.Listen[0] == '@' || inbound.Listen[0] == '/') {
+		return false
+	}
+	var stream struct {
+		Network string `json:"network"`
+	}
+	json.Unmarshal([]byte(inbound.StreamSettings), &stream)
+	return stream.Network != "kcp"
+}
+
+// checkInbound connects to an inbound and completes a TLS handshake when it uses TLS or REALITY.
+func checkInbound(inbound *model.Inbound) error {
+	host := inbound.Listen
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	address := net.JoinHostPort(host, strconv.Itoa(inbound.Port))
+	conn, err := net.DialTimeout("tcp", address, inboundHealthTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var stream struct {
+		Security    string `json:"security"`
+		TlsSettings struct {
+			ServerName string `json:"serverName"`
+		} `json:"tlsSettings"`
+		RealitySettings struct {
+			ServerNames []string `json:"serverNames"`
+		} `json:"realitySettings"`
+	}
+	json.Unmarshal([]byte(inbound.StreamSettings), &stream)
+	serverName := ""
+	switch stream.Security {
+	case "tls":
+		serverName = stream.TlsSettings.ServerName
+	case "reality":
+		if len(stream.RealitySettings.ServerNames) > 0 {
+			serverName = stream.RealitySettings.ServerNames[0]
+		}
+	default:
+		return nil
+	}
+
+	// Only reachability matters here, the certificate is verified by the clients
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+	tlsConn.SetDeadline(time.Now().Add(inboundHealthTimeout))
+	return tlsConn.Handshake()
+}
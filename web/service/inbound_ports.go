@@ -0,0 +1,103 @@
+package service
+
+import (
+	"net"
+	"strings"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+)
+
+// checkExtraPorts validates the extra ports and listen addresses of an inbound and that no
+// other inbound on an overlapping listen address uses any of its ports. Clashes between the
+// main ports and addresses alone are left to checkPortExist.
+func (s *InboundService) checkExtraPorts(inbound *model.Inbound) error {
+	inbound.ExtraPorts = strings.ReplaceAll(strings.TrimSpace(inbound.ExtraPorts), " ", "")
+	switch inbound.SubPortMode {
+	case "", model.SubPortRandom:
+	default:
+		return common.NewError("invalid subscription port mode:", inbound.SubPortMode)
+	}
+	if err := checkExtraListens(inbound); err != nil {
+		return err
+	}
+	query := database.GetDB().Model(model.Inbound{}).
+		Select("id", "listen", "port", "extra_ports", "extra_listens").
+		Where("id != ?", inbound.Id)
+	if inbound.ExtraPorts == "" && inbound.ExtraListens == "" {
+		query = query.Where("extra_ports != '' OR extra_listens != ''")
+	} else if inbound.ExtraPorts != "" {
+		if inbound.PortHopRange != "" {
+			return common.NewError("extra ports cannot be combined with port hopping")
+		}
+		if _, err := model.ParsePortList(inbound.ExtraPorts); err != nil {
+			return common.NewError("invalid extra ports:", err)
+		}
+	}
+
+	var others []*model.Inbound
+	if err := query.Find(&others).Error; err != nil {
+		return err
+	}
+	ports := map[int]bool{}
+	for _, port := range inbound.ListenPorts() {
+		ports[port] = true
+	}
+	for _, other := range others {
+		if !addressesOverlap(inbound.ListenAddresses(), other.ListenAddresses()) {
+			continue
+		}
+		for _, port := range other.ListenPorts() {
+			if ports[port] {
+				return common.NewCodeError(common.ErrCodeInboundPortInUse, map[string]any{"port": port}, "Port already exists:", port)
+			}
+		}
+	}
+	return nil
+}
+
+// checkExtraListens normalizes the extra listen addresses of an inbound and checks they are
+// distinct IP addresses. An inbound listening on every address has no use for more.
+func checkExtraListens(inbound *model.Inbound) error {
+	listens := inbound.ExtraListenList()
+	if len(listens) == 0 {
+		inbound.ExtraListens = ""
+		return nil
+	}
+	if listensOverlap(inbound.Listen, "") {
+		return common.NewError("extra listen addresses need a specific listen address")
+	}
+	seen := map[string]bool{}
+	for _, listen := range listens {
+		if net.ParseIP(listen) == nil || listensOverlap(listen, "") {
+			return common.NewError("invalid extra listen address:", listen)
+		}
+		if seen[listen] {
+			return common.NewError("duplicate extra listen address:", listen)
+		}
+		seen[listen] = true
+	}
+	inbound.ExtraListens = strings.Join(listens, ",")
+	return nil
+}
+
+// addressesOverlap reports whether any listen address of one inbound overlaps one of another.
+func addressesOverlap(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if listensOverlap(x, y) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// listensOverlap reports whether two inbound listen addresses can accept on the same port.
+func listensOverlap(a, b string) bool {
+	isAny := func(listen string) bool {
+		return listen == "" || listen == "0.0.0.0" || listen == "::" || listen == "::0"
+	}
+	return a == b || isAny(a) || isAny(b)
+}
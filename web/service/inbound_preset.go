@@ -0,0 +1,291 @@
+package service
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/util/random"
+)
+
+// InboundPreset is a ready-made inbound setup with recommended anti-DPI parameters.
+type InboundPreset struct {
+	Name        string `json:"name"`        // Preset name used to create an inbound
+	Title       string `json:"title"`       // Short human-readable title
+	Description string `json:"description"` // What the preset sets up and what it needs
+	NeedsDomain bool   `json:"needsDomain"` // Whether a domain pointing to the CDN is required
+	NeedsCert   bool   `json:"needsCert"`   // Whether certificate and key files are required
+}
+
+// InboundPresets lists the available inbound presets.
+var InboundPresets = []InboundPreset{
+	{
+		Name:        "reality-vision",
+		Title:       "VLESS Reality + Vision",
+		Description: "VLESS over raw TCP with Reality borrowing the TLS handshake of the target site and the xtls-rprx-vision flow. Keys and short IDs are generated. Clients connect to the server directly.",
+	},
+	{
+		Name:        "xhttp-cdn",
+		Title:       "VLESS XHTTP behind a CDN",
+		Description: "VLESS over XHTTP on a random path, for a CDN proxying the domain to this server. Served with TLS when certificate files are given, else in plain HTTP for a CDN terminating TLS. Links point to the domain on port 443.",
+		NeedsDomain: true,
+	},
+	{
+		Name:        "ws-tls-cloudflare",
+		Title:       "VLESS WebSocket + TLS behind Cloudflare",
+		Description: "VLESS over WebSocket with TLS on a random path, for a proxied Cloudflare record of the domain. Needs a certificate for the domain, such as a Cloudflare origin certificate. Links point to the domain on port 443.",
+		NeedsDomain: true,
+		NeedsCert:   true,
+	},
+}
+
+// InboundPresetOptions holds the values an inbound preset is filled in with.
+type InboundPresetOptions struct {
+	Preset      string // Name of the preset
+	Remark      string // Inbound remark, the preset title when empty
+	Port        int    // Inbound port, the preset default when 0
+	Domain      string // Domain clients reach the server at through the CDN
+	Target      string // Reality target site, google.com:443 when empty
+	ServerNames string // Comma separated Reality server names, the target host when empty
+	Mldsa65     bool   // Sign Reality handshakes with a new post-quantum ML-DSA-65 key
+	CertFile    string // Certificate file for TLS
+	KeyFile     string // Key file of the certificate
+	Email       string // Email of the first client, random when empty
+}
+
+// BuildPresetInbound returns a new inbound set up by a preset with one VLESS client and freshly
+// generated keys and paths. The inbound still has to be added.
+func BuildPresetInbound(options InboundPresetOptions) (*model.Inbound, error) {
+	options.Domain = strings.TrimSpace(options.Domain)
+	options.CertFile = strings.TrimSpace(options.CertFile)
+	options.KeyFile = strings.TrimSpace(options.KeyFile)
+	var preset *InboundPreset
+	for i := range InboundPresets {
+		if InboundPresets[i].Name == options.Preset {
+			preset = &InboundPresets[i]
+		}
+	}
+	if preset == nil {
+		return nil, common.WithCode(common.ErrCodeValidation, common.NewError("unknown inbound preset:", options.Preset))
+	}
+	if preset.NeedsDomain && options.Domain == "" {
+		return nil, common.WithCode(common.ErrCodeValidation, common.NewError("inbound preset needs a domain:", preset.Name))
+	}
+	if (preset.NeedsCert || options.CertFile != "") && (options.CertFile == "" || options.KeyFile == "") {
+		return nil, common.WithCode(common.ErrCodeValidation, common.NewError("inbound preset needs certificate and key files:", preset.Name))
+	}
+
+	email := strings.TrimSpace(options.Email)
+	if email == "" {
+		email = strings.ToLower(random.Seq(10))
+	}
+	client := model.Client{
+		ID:     uuid.New().String(),
+		Email:  email,
+		Enable: true,
+		SubID:  random.Seq(16),
+	}
+	path := "/" + strings.ToLower(random.Seq(12))
+	cdnProxy := []any{map[string]any{"forceTls": "tls", "dest": options.Domain, "port": 443, "remark": ""}}
+	port := options.Port
+	var stream map[string]any
+
+	switch preset.Name {
+	case "reality-vision":
+		client.Flow = "xtls-rprx-vision"
+		if port == 0 {
+			port = 443
+		}
+		reality, err := presetRealitySettings(options)
+		if err != nil {
+			return nil, err
+		}
+		stream = map[string]any{
+			"network":         "tcp",
+			"security":        "reality",
+			"tcpSettings":     map[string]any{"acceptProxyProtocol": false, "header": map[string]any{"type": "none"}},
+			"realitySettings": reality,
+		}
+	case "xhttp-cdn":
+		stream = map[string]any{
+			"network":       "xhttp",
+			"security":      "none",
+			"externalProxy": cdnProxy,
+			"xhttpSettings": map[string]any{
+				"path":          path,
+				"host":          options.Domain,
+				"headers":       map[string]any{},
+				"mode":          "auto",
+				"xPaddingBytes": "100-1000",
+				"noSSEHeader":   false,
+			},
+		}
+		if options.CertFile != "" {
+			stream["security"] = "tls"
+			stream["tlsSettings"] = presetTlsSettings(options, []string{"h2", "http/1.1"})
+		}
+		if port == 0 {
+			port = 8080
+			if options.CertFile != "" {
+				port = 443
+			}
+		}
+	case "ws-tls-cloudflare":
+		if port == 0 {
+			port = 443
+		}
+		stream = map[string]any{
+			"network":       "ws",
+			"security":      "tls",
+			"externalProxy": cdnProxy,
+			"wsSettings": map[string]any{
+				"acceptProxyProtocol": false,
+				"path":                path,
+				"host":                options.Domain,
+				"headers":             map[string]any{},
+				"heartbeatPeriod":     0,
+			},
+			"tlsSettings": presetTlsSettings(options, []string{"http/1.1"}),
+		}
+	}
+	if port <= 0 || port > 65535 {
+		return nil, common.WithCode(common.ErrCodeValidation, common.NewError("invalid inbound port:", port))
+	}
+
+	settings, err := json.MarshalIndent(map[string]any{
+		"clients":    []model.Client{client},
+		"decryption": "none",
+		"encryption": "none",
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	streamSettings, err := json.MarshalIndent(stream, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	sniffing, err := json.MarshalIndent(presetSniffing(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	remark := strings.TrimSpace(options.Remark)
+	if remark == "" {
+		remark = preset.Title
+	}
+	return &model.Inbound{
+		Remark:         remark,
+		Enable:         true,
+		Port:           port,
+		Protocol:       model.VLESS,
+		Settings:       string(settings),
+		StreamSettings: string(streamSettings),
+		Sniffing:       string(sniffing),
+	}, nil
+}
+
+// presetRealitySettings returns Reality settings borrowing the handshake of the target site of
+// the options, with new keys and short IDs.
+func presetRealitySettings(options InboundPresetOptions) (map[string]any, error) {
+	privateKey, publicKey, err := newX25519Keys()
+	if err != nil {
+		return nil, err
+	}
+	target := strings.TrimSpace(options.Target)
+	if target == "" {
+		target = "google.com:443"
+	}
+	serverNames := splitTrimmed(options.ServerNames)
+	if len(serverNames) == 0 {
+		serverNames = []string{strings.Split(target, ":")[0]}
+	}
+	reality := map[string]any{
+		"show":        false,
+		"xver":        0,
+		"target":      target,
+		"serverNames": serverNames,
+		"privateKey":  privateKey,
+		"shortIds":    newShortIds(),
+		"settings": map[string]any{
+			"publicKey":   publicKey,
+			"fingerprint": "chrome",
+			"serverName":  "",
+			"spiderX":     "/",
+		},
+	}
+	if options.Mldsa65 {
+		seed, verify, err := newMldsa65Keys("")
+		if err != nil {
+			return nil, common.WithCode(common.ErrCodeValidation, err)
+		}
+		setMldsa65Keys(reality, seed, verify)
+	}
+	return reality, nil
+}
+
+// presetSniffing returns the sniffing settings of preset inbounds, routing by the sniffed domain
+// without changing the destination.
+func presetSniffing() map[string]any {
+	return map[string]any{
+		"enabled":      true,
+		"destOverride": []string{"http", "tls", "quic"},
+		"metadataOnly": false,
+		"routeOnly":    true,
+	}
+}
+
+// presetTlsSettings returns the TLS settings of a preset serving the domain with the given files.
+func presetTlsSettings(options InboundPresetOptions, alpn []string) map[string]any {
+	return map[string]any{
+		"serverName":   options.Domain,
+		"minVersion":   "1.2",
+		"maxVersion":   "1.3",
+		"cipherSuites": "",
+		"certificates": []any{map[string]any{
+			"certificateFile": options.CertFile,
+			"keyFile":         options.KeyFile,
+			"ocspStapling":    3600,
+			"oneTimeLoading":  false,
+			"usage":           "encipherment",
+			"buildChain":      false,
+		}},
+		"alpn":     alpn,
+		"settings": map[string]any{"allowInsecure": false, "fingerprint": "chrome"},
+	}
+}
+
+// newX25519Keys returns a new Reality key pair encoded like xray x25519 prints it.
+func newX25519Keys() (string, string, error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(key.Bytes()), base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()), nil
+}
+
+// newShortIds returns random Reality short IDs of different lengths.
+func newShortIds() []string {
+	ids := make([]string, 0, 4)
+	for _, size := range []int{2, 4, 6, 8} {
+		b := make([]byte, size)
+		rand.Read(b)
+		ids = append(ids, hex.EncodeToString(b))
+	}
+	return ids
+}
+
+// splitTrimmed returns the non-empty items of a comma separated list.
+func splitTrimmed(value string) []string {
+	var items []string
+	for item := range strings.SplitSeq(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
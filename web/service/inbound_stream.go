@@ -0,0 +1,226 @@
+package service
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+)
+
+var (
+	sniffingDestOverrides = []string{"http", "tls", "quic", "fakedns"}
+	sockoptTproxyModes    = []string{"off", "redirect", "tproxy"}
+	xhttpModes            = []string{"auto", "packet-up", "stream-up", "stream-one"}
+	domainStrategies      = []string{
+		"AsIs", "UseIP", "UseIPv6v4", "UseIPv6", "UseIPv4v6", "UseIPv4",
+		"ForceIP", "ForceIPv6v4", "ForceIPv6", "ForceIPv4v6", "ForceIPv4",
+	}
+)
+
+// DefaultSniffing returns the sniffing configuration used for a protocol when none is stored.
+// Tunnel inbounds need the sniffed domain to route transparently forwarded traffic, so sniffing is on by default for them.
+func DefaultSniffing(protocol model.Protocol) *entity.InboundSniffing {
+	return &entity.InboundSniffing{
+		Enabled:      protocol == model.Tunnel,
+		DestOverride: slices.Clone(sniffingDestOverrides),
+	}
+}
+
+// DefaultSockopt returns the sockopt values assumed when an inbound does not set them.
+func DefaultSockopt() *entity.InboundSockopt {
+	return &entity.InboundSockopt{
+		Tproxy:         "off",
+		DomainStrategy: "UseIP",
+	}
+}
+
+func checkSniffing(sniffing *entity.InboundSniffing) error {
+	for _, dest := range sniffing.DestOverride {
+		if !slices.Contains(sniffingDestOverrides, dest) {
+			return common.NewError("invalid sniffing destOverride:", dest)
+		}
+	}
+	if sniffing.Enabled && len(sniffing.DestOverride) == 0 {
+		return common.NewError("sniffing destOverride can not be empty when sniffing is enabled")
+	}
+	return nil
+}
+
+func checkSockopt(sockopt *entity.InboundSockopt) error {
+	if sockopt.Mark < 0 {
+		return common.NewError("invalid sockopt mark:", sockopt.Mark)
+	}
+	if !slices.Contains(sockoptTproxyModes, sockopt.Tproxy) {
+		return common.NewError("invalid sockopt tproxy:", sockopt.Tproxy)
+	}
+	if !slices.Contains(domainStrategies, sockopt.DomainStrategy) {
+		return common.NewError("invalid sockopt domainStrategy:", sockopt.DomainStrategy)
+	}
+	// Linux limits interface names to IFNAMSIZ-1 bytes
+	if len(sockopt.Interface) > 15 {
+		return common.NewError("invalid sockopt interface:", sockopt.Interface)
+	}
+	// and congestion control names to TCP_CA_NAME_MAX-1 bytes
+	if len(sockopt.TcpCongestion) > 15 || strings.ContainsFunc(sockopt.TcpCongestion, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_')
+	}) {
+		return common.NewError("invalid sockopt tcpCongestion:", sockopt.TcpCongestion)
+	}
+	if sockopt.TcpKeepAliveIdle < 0 || sockopt.TcpKeepAliveInterval < 0 || sockopt.TcpUserTimeout < 0 {
+		return common.NewError("sockopt tcp timeouts can not be negative")
+	}
+	return checkSockoptSupport(sockopt)
+}
+
+// checkXhttpSettings validates the xhttp options of a stream settings JSON.
+// The extra object is passed to clients verbatim, so only its download split is checked here.
+func checkXhttpSettings(streamSettings string) error {
+	if streamSettings == "" {
+		return nil
+	}
+	var stream struct {
+		Network       string         `json:"network"`
+		XhttpSettings map[string]any `json:"xhttpSettings"`
+	}
+	if err := json.Unmarshal([]byte(streamSettings), &stream); err != nil {
+		return common.NewError("stream settings invalid:", err)
+	}
+	if stream.Network != "xhttp" || stream.XhttpSettings == nil {
+		return nil
+	}
+	xhttp := stream.XhttpSettings
+	if mode, ok := xhttp["mode"].(string); ok && mode != "" && !slices.Contains(xhttpModes, mode) {
+		return common.NewError("invalid xhttp mode:", mode)
+	}
+	for _, key := range []string{"scMaxEachPostBytes", "scStreamUpServerSecs", "xPaddingBytes"} {
+		switch value := xhttp[key].(type) {
+		case nil, string, float64:
+		default:
+			return common.NewErrorf("invalid xhttp %v: %v", key, value)
+		}
+	}
+	if value, ok := xhttp["noGRPCHeader"]; ok {
+		if _, isBool := value.(bool); !isBool {
+			return common.NewError("invalid xhttp noGRPCHeader:", value)
+		}
+	}
+
+	rawExtra, ok := xhttp["extra"]
+	if !ok || rawExtra == nil {
+		return nil
+	}
+	extra, ok := rawExtra.(map[string]any)
+	if !ok {
+		return common.NewError("xhttp extra must be a JSON object")
+	}
+	rawDownload, ok := extra["downloadSettings"]
+	if !ok {
+		return nil
+	}
+	download, ok := rawDownload.(map[string]any)
+	if !ok {
+		return common.NewError("xhttp downloadSettings must be a JSON object")
+	}
+	if address, _ := download["address"].(string); address == "" {
+		return common.NewError("xhttp downloadSettings address can not be empty")
+	}
+	port, _ := download["port"].(float64)
+	if port < 1 || port > 65535 || port != float64(int(port)) {
+		return common.NewError("invalid xhttp downloadSettings port:", download["port"])
+	}
+	return nil
+}
+
+// GetInboundSniffing returns the sniffing configuration of an inbound, falling back to the protocol default.
+func (s *InboundService) GetInboundSniffing(id int) (*entity.InboundSniffing, error) {
+	inbound, err := s.GetInbound(id)
+	if err != nil {
+		return nil, err
+	}
+	sniffing := DefaultSniffing(inbound.Protocol)
+	if inbound.Sniffing != "" {
+		if err := json.Unmarshal([]byte(inbound.Sniffing), sniffing); err != nil {
+			return nil, err
+		}
+	}
+	return sniffing, nil
+}
+
+// UpdateInboundSniffing validates and stores the sniffing configuration of an inbound.
+// Returns whether Xray needs restart.
+func (s *InboundService) UpdateInboundSniffing(id int, sniffing *entity.InboundSniffing) (bool, error) {
+	if err := checkSniffing(sniffing); err != nil {
+		return false, common.WithCode(common.ErrCodeValidation, err)
+	}
+	inbound, err := s.GetInbound(id)
+	if err != nil {
+		return false, err
+	}
+	data, err := json.MarshalIndent(sniffing, "", "  ")
+	if err != nil {
+		return false, err
+	}
+	inbound.Sniffing = string(data)
+	_, needRestart, err := s.UpdateInbound(inbound)
+	return needRestart, err
+}
+
+// GetInboundSockopt returns the structured sockopt fields of an inbound's stream settings.
+func (s *InboundService) GetInboundSockopt(id int) (*entity.InboundSockopt, error) {
+	inbound, err := s.GetInbound(id)
+	if err != nil {
+		return nil, err
+	}
+	sockopt := DefaultSockopt()
+	if inbound.StreamSettings == "" {
+		return sockopt, nil
+	}
+	var stream struct {
+		Sockopt json.RawMessage `json:"sockopt"`
+	}
+	if err := json.Unmarshal([]byte(inbound.StreamSettings), &stream); err != nil {
+		return nil, err
+	}
+	if len(stream.Sockopt) > 0 {
+		if err := json.Unmarshal(stream.Sockopt, sockopt); err != nil {
+			return nil, err
+		}
+	}
+	return sockopt, nil
+}
+
+// UpdateInboundSockopt validates the structured sockopt fields and merges them into the inbound's stream settings,
+// keeping any other sockopt options untouched. Dialer options are checked against the host and the running core.
+// Returns whether Xray needs restart.
+func (s *InboundService) UpdateInboundSockopt(id int, sockopt *entity.InboundSockopt) (bool, error) {
+	if sockopt.DialerProxy != "" {
+		return false, common.WithCode(common.ErrCodeValidation, common.NewError("sockopt dialerProxy is for outbounds only"))
+	}
+	if err := checkSockopt(sockopt); err != nil {
+		return false, common.WithCode(common.ErrCodeValidation, err)
+	}
+	inbound, err := s.GetInbound(id)
+	if err != nil {
+		return false, err
+	}
+	if inbound.StreamSettings == "" {
+		return false, common.NewError("inbound has no stream settings:", id)
+	}
+	stream := map[string]any{}
+	if err := json.Unmarshal([]byte(inbound.StreamSettings), &stream); err != nil {
+		return false, err
+	}
+	options, _ := stream["sockopt"].(map[string]any)
+	stream["sockopt"] = mergeSockopt(options, sockopt)
+
+	data, err := json.MarshalIndent(stream, "", "  ")
+	if err != nil {
+		return false, err
+	}
+	inbound.StreamSettings = string(data)
+	_, needRestart, err := s.UpdateInbound(inbound)
+	return needRestart, err
+}
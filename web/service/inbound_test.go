@@ -0,0 +1,136 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/dbtest"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/xray"
+)
+
+// clientsOf returns the clients of the inbounds with their inbounds by email, decoding the settings
+// of every inbound like the lookups did before they were indexed.
+func clientsOf(t *testing.T, inbounds []*model.Inbound) (map[string]model.Client, map[string]*model.Inbound) {
+	t.Helper()
+	s := &InboundService{}
+	clients := map[string]model.Client{}
+	clientInbounds := map[string]*model.Inbound{}
+	for _, inbound := range inbounds {
+		inboundClients, err := s.GetClients(inbound)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, client := range inboundClients {
+			clients[client.Email] = client
+			clientInbounds[client.Email] = inbound
+		}
+	}
+	return clients, clientInbounds
+}
+
+func TestGetClientTrafficByID(t *testing.T) {
+	dbtest.Setup(t)
+	s := &InboundService{}
+	inbounds, err := s.GetAllInbounds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A disabled client keeps its traffic row enabled until the next traffic collection
+	disabled := dbtest.Email(1, 7)
+	if _, _, err := s.SetClientEnableByEmail(disabled, false); err != nil {
+		t.Fatal(err)
+	}
+	inbounds, err = s.GetAllInbounds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clients, clientInbounds := clientsOf(t, inbounds)
+
+	for _, email := range []string{dbtest.Email(0, 0), disabled, dbtest.Email(dbtest.Inbounds-1, dbtest.Subs-1)} {
+		client := clients[email]
+		traffics, err := s.GetClientTrafficByID(client.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(traffics) != 1 {
+			t.Fatalf("%s: got %d traffics, want 1", email, len(traffics))
+		}
+		traffic := traffics[0]
+		if traffic.Email != email || traffic.InboundId != clientInbounds[email].Id || traffic.UUID != client.ID ||
+			traffic.SubId != client.SubID || traffic.Enable != client.Enable {
+			t.Errorf("%s: got %+v, want the traffic of %+v", email, traffic, client)
+		}
+	}
+}
+
+func TestAddTraffic(t *testing.T) {
+	emails := dbtest.Setup(t)
+	s := &InboundService{}
+	traffics := make([]*xray.ClientTraffic, 0, len(emails)/2)
+	for _, email := range emails[:len(emails)/2] {
+		traffics = append(traffics, &xray.ClientTraffic{Email: email, Up: 1024, Down: 4096})
+	}
+	for range 2 {
+		if err, _ := s.AddTraffic(nil, traffics); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stored []xray.ClientTraffic
+	if err := database.GetDB().Model(xray.ClientTraffic{}).Find(&stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != len(emails) {
+		t.Fatalf("got %d traffics, want %d", len(stored), len(emails))
+	}
+	counted := map[string]bool{}
+	for _, traffic := range traffics {
+		counted[traffic.Email] = true
+	}
+	for _, traffic := range stored {
+		up, down := int64(0), int64(0)
+		if counted[traffic.Email] {
+			up, down = 2048, 8192
+		}
+		if traffic.Up != up || traffic.Down != down {
+			t.Errorf("%s: got %d/%d, want %d/%d", traffic.Email, traffic.Up, traffic.Down, up, down)
+		}
+	}
+}
+
+func BenchmarkAddTraffic(b *testing.B) {
+	emails := dbtest.Setup(b)
+	s := &InboundService{}
+	for b.Loop() {
+		traffics := make([]*xray.ClientTraffic, 0, len(emails))
+		for _, email := range emails {
+			traffics = append(traffics, &xray.ClientTraffic{Email: email, Up: 1024, Down: 4096})
+		}
+		if err, _ := s.AddTraffic(nil, traffics); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetClientTrafficByID(b *testing.B) {
+	dbtest.Setup(b)
+	s := &InboundService{}
+	var ids []string
+	err := database.GetDB().Raw(`SELECT JSON_EXTRACT(client.value, '$.id')
+		FROM inbounds, JSON_EACH(JSON_EXTRACT(inbounds.settings, '$.clients')) AS client`).Scan(&ids).Error
+	if err != nil {
+		b.Fatal(err)
+	}
+	i := 0
+	for b.Loop() {
+		traffics, err := s.GetClientTrafficByID(ids[i%len(ids)])
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(traffics) != 1 {
+			b.Fatalf("got %d traffics, want 1", len(traffics))
+		}
+		i++
+	}
+}
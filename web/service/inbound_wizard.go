@@ -0,0 +1,314 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/util/random"
+)
+
+var (
+	wizardProtocols  = []model.Protocol{model.VLESS, model.VMESS, model.Trojan, model.Shadowsocks}
+	wizardTransports = []string{"tcp", "ws", "grpc", "xhttp", "httpupgrade"}
+)
+
+// InboundWizardOptions holds the intent the inbound wizard sets up an inbound from.
+type InboundWizardOptions struct {
+	Protocol    model.Protocol // vless, vmess, trojan or shadowsocks, vless when empty
+	Transport   string         // tcp, ws, grpc, xhttp or httpupgrade, xhttp behind a CDN and tcp else when empty
+	Security    string         // none, tls or reality, chosen from the other values when empty
+	Domain      string         // Domain clients reach the server at
+	BehindCdn   bool           // Whether clients connect through a CDN proxying the domain
+	Port        int            // Inbound port, chosen from the security when 0
+	Remark      string         // Inbound remark
+	Target      string         // Reality target site
+	ServerNames string         // Comma separated Reality server names
+	CertFile    string         // Certificate file for TLS, the panel certificate when empty
+	KeyFile     string         // Key file of the certificate
+	Email       string         // Email of the first client, random when empty
+	UserId      int            // Panel user owning the inbound
+}
+
+// BuildWizardInbound turns the intent of the options into a complete inbound with one client,
+// generated keys and paths, the TLS certificate and sniffing defaults. Combinations that do not
+// work, such as REALITY behind a CDN or a certificate not covering the domain, are rejected with
+// the reason. The inbound still has to be added.
+func (s *InboundService) BuildWizardInbound(options InboundWizardOptions) (*model.Inbound, error) {
+	if err := resolveWizardOptions(&options, true); err != nil {
+		return nil, err
+	}
+
+	port := options.Port
+	if port == 0 {
+		switch {
+		case options.Security != "none":
+			port = 443
+		case options.BehindCdn:
+			port = 80
+		default:
+			// A few random high ports are tried so a free one is found
+			for range 10 {
+				port = 10000 + random.Num(50000)
+				if exist, err := s.checkPortExist("", port, 0); err != nil || !exist {
+					break
+				}
+			}
+		}
+	}
+	if port <= 0 || port > 65535 {
+		return nil, common.NewCodeError(common.ErrCodeValidation, nil, "invalid inbound port:", port)
+	}
+	exist, err := s.checkPortExist("", port, 0)
+	if err != nil {
+		return nil, err
+	}
+	if exist {
+		return nil, common.NewCodeError(common.ErrCodeInboundPortInUse, map[string]any{"port": port}, "Port already exists:", port)
+	}
+
+	inbound := &model.Inbound{
+		UserId:   options.UserId,
+		Remark:   strings.TrimSpace(options.Remark),
+		Enable:   true,
+		Port:     port,
+		Protocol: options.Protocol,
+		Tag:      fmt.Sprintf("inbound-%v", port),
+	}
+	if inbound.Remark == "" {
+		inbound.Remark = fmt.Sprintf("%s %s %s", options.Protocol, options.Transport, options.Security)
+	}
+	settings := map[string]any{}
+	switch options.Protocol {
+	case model.VLESS:
+		settings["decryption"] = "none"
+		settings["encryption"] = "none"
+		settings["fallbacks"] = []any{}
+	case model.Trojan:
+		settings["fallbacks"] = []any{}
+	case model.Shadowsocks:
+		key := make([]byte, 32)
+		rand.Read(key)
+		settings["method"] = "2022-blake3-aes-256-gcm"
+		settings["password"] = base64.StdEncoding.EncodeToString(key)
+		settings["network"] = "tcp,udp"
+	}
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+	inbound.Settings = string(data)
+
+	client := model.Client{
+		Email:  strings.TrimSpace(options.Email),
+		Enable: true,
+		SubID:  random.Seq(16),
+	}
+	if client.Email == "" {
+		client.Email = strings.ToLower(random.Seq(10))
+	}
+	if err := generateClientCredentials(inbound, &client); err != nil {
+		return nil, err
+	}
+	if options.Protocol == model.VLESS && options.Transport == "tcp" && options.Security != "none" {
+		client.Flow = "xtls-rprx-vision"
+	}
+	settings["clients"] = []model.Client{client}
+	data, err = json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	inbound.Settings = string(data)
+
+	stream, err := wizardStreamSettings(options, port)
+	if err != nil {
+		return nil, err
+	}
+	data, err = json.MarshalIndent(stream, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	inbound.StreamSettings = string(data)
+	if err := checkXhttpSettings(inbound.StreamSettings); err != nil {
+		return nil, common.WithCode(common.ErrCodeValidation, err)
+	}
+	data, err = json.MarshalIndent(presetSniffing(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	inbound.Sniffing = string(data)
+	return inbound, nil
+}
+
+// resolveWizardOptions fills in the values left out of wizard options to fit the others and
+// rejects combinations that cannot work. The certificate is checked when checkCert is set.
+func resolveWizardOptions(options *InboundWizardOptions, checkCert bool) error {
+	options.Domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(options.Domain)), ".")
+	options.CertFile = strings.TrimSpace(options.CertFile)
+	options.KeyFile = strings.TrimSpace(options.KeyFile)
+	if options.Protocol == "" {
+		options.Protocol = model.VLESS
+	}
+	if !slices.Contains(wizardProtocols, options.Protocol) {
+		return common.NewCodeError(common.ErrCodeValidation, nil, "the wizard does not set up protocol:", options.Protocol)
+	}
+	if options.Transport == "" {
+		options.Transport = "tcp"
+		if options.BehindCdn {
+			options.Transport = "xhttp"
+		}
+	}
+	if !slices.Contains(wizardTransports, options.Transport) {
+		return common.NewCodeError(common.ErrCodeValidation, nil, "unknown transport:", options.Transport)
+	}
+	if options.BehindCdn && options.Domain == "" {
+		return common.NewCodeError(common.ErrCodeValidation, nil, "an inbound behind a CDN needs the domain the CDN proxies")
+	}
+	if options.BehindCdn && options.Transport == "tcp" {
+		return common.NewCodeError(common.ErrCodeValidation, nil, "CDNs do not proxy raw TCP, use ws, grpc, xhttp or httpupgrade")
+	}
+
+	var settingService SettingService
+	if options.CertFile == "" && options.KeyFile == "" && options.Security != "none" && options.Security != "reality" {
+		options.CertFile, _ = settingService.GetCertFile()
+		options.KeyFile, _ = settingService.GetKeyFile()
+	}
+	if options.Security == "" {
+		switch {
+		case options.Domain != "" && options.CertFile != "":
+			options.Security = "tls"
+		case !options.BehindCdn && (options.Protocol == model.VLESS || options.Protocol == model.Trojan) &&
+			slices.Contains([]string{"tcp", "grpc", "xhttp"}, options.Transport):
+			options.Security = "reality"
+		default:
+			options.Security = "none"
+		}
+	}
+	switch options.Security {
+	case "none":
+	case "tls":
+		if options.Domain == "" {
+			return common.NewCodeError(common.ErrCodeValidation, nil, "TLS needs the domain of the certificate")
+		}
+		if !checkCert {
+			break
+		}
+		if err := checkWizardCertificate(options.Domain, options.CertFile, options.KeyFile); err != nil {
+			return common.WithCode(common.ErrCodeValidation, err)
+		}
+	case "reality":
+		if options.BehindCdn {
+			return common.NewCodeError(common.ErrCodeValidation, nil, "REALITY does not work behind a CDN, use TLS")
+		}
+		if options.Protocol != model.VLESS && options.Protocol != model.Trojan {
+			return common.NewCodeError(common.ErrCodeValidation, nil, "REALITY works with vless and trojan only")
+		}
+		if !slices.Contains([]string{"tcp", "grpc", "xhttp"}, options.Transport) {
+			return common.NewCodeError(common.ErrCodeValidation, nil, "REALITY works over tcp, grpc and xhttp only")
+		}
+	default:
+		return common.NewCodeError(common.ErrCodeValidation, nil, "unknown security:", options.Security)
+	}
+	if options.Protocol == model.Shadowsocks && (options.Transport != "tcp" || options.Security != "none") {
+		return common.NewCodeError(common.ErrCodeValidation, nil, "shadowsocks is served over raw TCP without TLS")
+	}
+	return nil
+}
+
+// wizardStreamSettings returns the stream settings of a wizard inbound on the port.
+func wizardStreamSettings(options InboundWizardOptions, port int) (map[string]any, error) {
+	path := "/" + strings.ToLower(random.Seq(12))
+	stream := map[string]any{
+		"network":  options.Transport,
+		"security": options.Security,
+	}
+	alpn := []string{"h2", "http/1.1"}
+	switch options.Transport {
+	case "tcp":
+		stream["tcpSettings"] = map[string]any{"acceptProxyProtocol": false, "header": map[string]any{"type": "none"}}
+	case "ws":
+		alpn = []string{"http/1.1"}
+		stream["wsSettings"] = map[string]any{
+			"acceptProxyProtocol": false,
+			"path":                path,
+			"host":                options.Domain,
+			"headers":             map[string]any{},
+			"heartbeatPeriod":     0,
+		}
+	case "grpc":
+		alpn = []string{"h2"}
+		stream["grpcSettings"] = map[string]any{
+			"serviceName": strings.ToLower(random.Seq(12)),
+			"authority":   options.Domain,
+			"multiMode":   false,
+		}
+	case "xhttp":
+		stream["xhttpSettings"] = map[string]any{
+			"path":          path,
+			"host":          options.Domain,
+			"headers":       map[string]any{},
+			"mode":          "auto",
+			"xPaddingBytes": "100-1000",
+			"noSSEHeader":   false,
+		}
+	case "httpupgrade":
+		alpn = []string{"http/1.1"}
+		stream["httpupgradeSettings"] = map[string]any{
+			"acceptProxyProtocol": false,
+			"path":                path,
+			"host":                options.Domain,
+			"headers":             map[string]any{},
+		}
+	}
+	switch options.Security {
+	case "tls":
+		stream["tlsSettings"] = presetTlsSettings(InboundPresetOptions{
+			Domain:   options.Domain,
+			CertFile: options.CertFile,
+			KeyFile:  options.KeyFile,
+		}, alpn)
+	case "reality":
+		reality, err := presetRealitySettings(InboundPresetOptions{Target: options.Target, ServerNames: options.ServerNames})
+		if err != nil {
+			return nil, err
+		}
+		stream["realitySettings"] = reality
+	}
+	if options.BehindCdn {
+		// Without TLS at the origin the CDN is expected to take HTTPS on 443 and forward plain HTTP
+		proxy := map[string]any{"forceTls": "same", "dest": options.Domain, "port": port, "remark": ""}
+		if options.Security == "none" && port == 80 {
+			proxy["forceTls"] = "tls"
+			proxy["port"] = 443
+		}
+		stream["externalProxy"] = []any{proxy}
+	}
+	return stream, nil
+}
+
+// checkWizardCertificate checks that the certificate and key files load and that the certificate
+// covers the domain.
+func checkWizardCertificate(domain string, certFile string, keyFile string) error {
+	if certFile == "" || keyFile == "" {
+		return common.NewError("TLS needs certificate and key files, and the panel has no certificate set")
+	}
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return common.NewError("unable to load the certificate:", err)
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return common.NewError("unable to parse the certificate:", err)
+	}
+	if err := leaf.VerifyHostname(domain); err != nil {
+		return common.NewError("the certificate does not cover the domain:", err)
+	}
+	return nil
+}
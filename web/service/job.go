@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+)
+
+// jobWorkers is how many background jobs run at the same time, the rest wait in the queue.
+const jobWorkers = 2
+
+// JobProgressFunc reports the completion of a job in percent and what it is doing.
+type JobProgressFunc func(progress int, message string)
+
+// JobFunc is the work of a background job. It reports progress with report, stops early when
+// ctx is canceled and returns a result that is stored as JSON.
+type JobFunc func(ctx context.Context, report JobProgressFunc) (any, error)
+
+var (
+	jobSlots   = make(chan struct{}, jobWorkers)
+	jobMu      sync.Mutex
+	jobCancels = map[int]context.CancelFunc{}
+)
+
+// JobService runs long operations in the background and keeps their status in the database,
+// so requests return at once and clients poll the job instead.
+type JobService struct{}
+
+// Enqueue stores a new job of the given type and runs fn in the background once a worker is free.
+func (s *JobService) Enqueue(jobType string, fn JobFunc) (*model.Job, error) {
+	job := &model.Job{
+		Type:      jobType,
+		Status:    model.JobQueued,
+		CreatedAt: time.Now().UnixMilli(),
+	}
+	if err := database.GetDB().Create(job).Error; err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	jobMu.Lock()
+	jobCancels[job.Id] = cancel
+	jobMu.Unlock()
+
+	snapshot := *job
+	go s.run(ctx, &snapshot, fn)
+	return job, nil
+}
+
+// run waits for a worker slot, runs the job and stores its outcome.
+func (s *JobService) run(ctx context.Context, job *model.Job, fn JobFunc) {
+	defer func() {
+		jobMu.Lock()
+		if cancel, ok := jobCancels[job.Id]; ok {
+			cancel()
+			delete(jobCancels, job.Id)
+		}
+		jobMu.Unlock()
+	}()
+
+	select {
+	case jobSlots <- struct{}{}:
+		defer func() { <-jobSlots }()
+	case <-ctx.Done():
+		s.finish(job, nil, ctx.Err())
+		return
+	}
+
+	job.Status = model.JobRunning
+	job.StartedAt = time.Now().UnixMilli()
+	s.save(job)
+
+	var mu sync.Mutex
+	report := func(progress int, message string) {
+		mu.Lock()
+		defer mu.Unlock()
+		job.Progress = min(max(progress, 0), 100)
+		job.Message = message
+		s.save(job)
+	}
+
+	var result any
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("job panicked: %v", r)
+			}
+		}()
+		result, err = fn(ctx, report)
+		return err
+	}()
+	mu.Lock()
+	defer mu.Unlock()
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	s.finish(job, result, err)
+}
+
+// finish stores the final status of a job.
+func (s *JobService) finish(job *model.Job, result any, err error) {
+	job.FinishedAt = time.Now().UnixMilli()
+	switch {
+	case errors.Is(err, context.Canceled):
+		job.Status = model.JobCanceled
+	case err != nil:
+		job.Status = model.JobFailed
+		job.Error = err.Error()
+	default:
+		job.Status = model.JobSucceeded
+		job.Progress = 100
+		job.Message = ""
+		if result != nil {
+			if data, err := json.Marshal(result); err == nil {
+				job.Result = string(data)
+			}
+		}
+	}
+	s.save(job)
+	if job.Status == model.JobFailed {
+		logger.Warningf("Job %d (%s) failed: %s", job.Id, job.Type, job.Error)
+	}
+}
+
+// save writes the job back, recreating it when the database was replaced meanwhile, e.g. by an import.
+func (s *JobService) save(job *model.Job) {
+	if err := database.GetDB().Save(job).Error; err != nil {
+		logger.Warning("save job failed:", err)
+	}
+}
+
+// GetJob returns a job by ID.
+func (s *JobService) GetJob(id int) (*model.Job, error) {
+	job := &model.Job{}
+	if err := database.GetDB().First(job, id).Error; err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// GetJobs returns the most recent jobs, newest first.
+func (s *JobService) GetJobs(limit int) ([]model.Job, error) {
+	var jobs []model.Job
+	err := database.GetDB().Order("id desc").Limit(limit).Find(&jobs).Error
+	return jobs, err
+}
+
+// CancelJob asks a queued or running job to stop. Jobs stop at their next cancellation point,
+// so a running job may still finish.
+func (s *JobService) CancelJob(id int) error {
+	jobMu.Lock()
+	cancel, ok := jobCancels[id]
+	jobMu.Unlock()
+	if !ok {
+		return common.NewErrorf("job %d is not queued or running", id)
+	}
+	cancel()
+	return nil
+}
+
+// FailInterruptedJobs marks jobs left queued or running by a previous process as failed.
+// Jobs of this process keep running across a restart of the web server.
+func (s *JobService) FailInterruptedJobs() error {
+	query := database.GetDB().Model(&model.Job{}).
+		Where("status IN ?", []string{model.JobQueued, model.JobRunning})
+	jobMu.Lock()
+	active := make([]int, 0, len(jobCancels))
+	for id := range jobCancels {
+		active = append(active, id)
+	}
+	jobMu.Unlock()
+	if len(active) > 0 {
+		query = query.Where("id NOT IN ?", active)
+	}
+	return query.Updates(map[string]any{
+		"status":      model.JobFailed,
+		"error":       "interrupted by a panel restart",
+		"finished_at": time.Now().UnixMilli(),
+	}).Error
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+)
+
+// MailService sends plain text emails through the SMTP server configured in the panel settings.
+type MailService struct {
+	settingService SettingService
+}
+
+// IsConfigured reports whether an SMTP server and sender address are set.
+func (s *MailService) IsConfigured() bool {
+	host, _ := s.settingService.GetSmtpHost()
+	from, _ := s.settingService.GetSmtpFrom()
+	return host != "" && from != ""
+}
+
+// SendMail sends a plain text email. Port 465 uses implicit TLS, other ports upgrade with STARTTLS when offered.
+// When branding is configured the brand name is used as sender name and subject prefix and a support footer is appended.
+func (s *MailService) SendMail(to string, subject string, body string) error {
+	host, err := s.settingService.GetSmtpHost()
+	if err != nil {
+		return err
+	}
+	port, err := s.settingService.GetSmtpPort()
+	if err != nil {
+		return err
+	}
+	username, err := s.settingService.GetSmtpUsername()
+	if err != nil {
+		return err
+	}
+	password, err := s.settingService.GetSmtpPassword()
+	if err != nil {
+		return err
+	}
+	from, err := s.settingService.GetSmtpFrom()
+	if err != nil {
+		return err
+	}
+	if host == "" || from == "" {
+		return common.NewError("SMTP is not configured")
+	}
+	brand := s.settingService.GetBranding()
+	sender := (&mail.Address{Name: brand.Name, Address: from}).String()
+	if brand.Name != "" {
+		subject = "[" + brand.Name + "] " + subject
+	}
+	if footer := strings.TrimSpace(brand.Name + "\n" + brand.Support); footer != "" {
+		body += "\n\n--\n" + footer
+	}
+	// Reject header injection through the recipient or subject
+	if strings.ContainsAny(to, "\r\n") || strings.ContainsAny(subject, "\r\n") {
+		return common.NewError("invalid email header")
+	}
+
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	var conn net.Conn
+	if port == 465 {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, 10*time.Second)
+	}
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && port != 465 {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if username != "" {
+		if err := client.Auth(smtp.PlainAuth("", username, password, host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		sender, to, mime.QEncoding.Encode("utf-8", subject), time.Now().Format(time.RFC1123Z), strings.ReplaceAll(body, "\n", "\r\n"))
+	if _, err := w.Write([]byte(msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/config"
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+	"github.com/mhsanaei/3x-ui/v2/xray"
+
+	"gorm.io/gorm"
+)
+
+// clientEmailsQuery selects the emails of all clients of all inbounds.
+const clientEmailsQuery = `
+	SELECT JSON_EXTRACT(client.value, '$.email')
+	FROM inbounds,
+		JSON_EACH(JSON_EXTRACT(inbounds.settings, '$.clients')) AS client`
+
+// MaintenanceService keeps the database small: it removes rows left behind by deleted clients,
+// trims old payments, deposit tokens and announcements, and compacts the database.
+type MaintenanceService struct {
+	settingService SettingService
+	tgbot          Tgbot
+}
+
+// RunMaintenance runs the database maintenance once and reports the result to the Telegram admins.
+func (s *MaintenanceService) RunMaintenance() (*entity.MaintenanceReport, error) {
+	start := time.Now()
+	dbPath := config.GetDBPath()
+	report := &entity.MaintenanceReport{SizeBefore: fileSize(dbPath) + fileSize(dbPath+"-wal")}
+
+	retentionDays, err := s.settingService.GetMaintenanceRetentionDays()
+	if err != nil {
+		return nil, err
+	}
+
+	db := database.GetDB()
+	err = db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("email NOT IN (" + clientEmailsQuery + ")").Delete(&xray.ClientTraffic{})
+		if result.Error != nil {
+			return result.Error
+		}
+		report.OrphanedTraffics = result.RowsAffected
+
+		result = tx.Where("client_email NOT IN (" + clientEmailsQuery + ")").Delete(&model.InboundClientIps{})
+		if result.Error != nil {
+			return result.Error
+		}
+		report.OrphanedClientIps = result.RowsAffected
+
+		if retentionDays <= 0 {
+			return nil
+		}
+		cutoff := start.AddDate(0, 0, -retentionDays).UnixMilli()
+
+		result = tx.Where("status != ? AND created_at < ?", "pending", cutoff).Delete(&model.Payment{})
+		if result.Error != nil {
+			return result.Error
+		}
+		report.Payments = result.RowsAffected
+
+		result = tx.Where("created_at < ? AND ((expires_at > 0 AND expires_at < ?) OR uses >= max_uses)", cutoff, cutoff).Delete(&model.DepositToken{})
+		if result.Error != nil {
+			return result.Error
+		}
+		report.DepositTokens = result.RowsAffected
+
+		result = tx.Where("expires_at > 0 AND expires_at < ?", cutoff).Delete(&model.Announcement{})
+		if result.Error != nil {
+			return result.Error
+		}
+		report.Announcements = result.RowsAffected
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Exec("ANALYZE;").Error; err != nil {
+		return nil, err
+	}
+	if err := database.Vacuum(); err != nil {
+		return nil, err
+	}
+	resetStorageStatus()
+	report.SizeAfter = fileSize(dbPath) + fileSize(dbPath+"-wal")
+	report.Duration = time.Since(start).Milliseconds()
+
+	logger.Infof("Database maintenance removed %d orphaned traffics, %d orphaned IP logs, %d payments, %d deposit tokens and %d announcements, size %d -> %d bytes",
+		report.OrphanedTraffics, report.OrphanedClientIps, report.Payments, report.DepositTokens, report.Announcements, report.SizeBefore, report.SizeAfter)
+	if s.tgbot.IsRunning() {
+		s.tgbot.SendMsgToTgbotAdmins(s.tgbot.I18nBot("tgbot.messages.maintenanceReport",
+			"Traffics=="+strconv.FormatInt(report.OrphanedTraffics+report.OrphanedClientIps, 10),
+			"Records=="+strconv.FormatInt(report.Payments+report.DepositTokens+report.Announcements, 10),
+			"Before=="+common.FormatTraffic(int64(report.SizeBefore)),
+			"After=="+common.FormatTraffic(int64(report.SizeAfter))))
+	}
+	return report, nil
+}
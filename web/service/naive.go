@@ -0,0 +1,147 @@
+package service
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/naive"
+	"github.com/mhsanaei/3x-ui/v2/xray"
+)
+
+var (
+	naiveProcess   *naive.Process
+	naiveLogOffset int64 = -1
+	naiveLock      sync.Mutex
+)
+
+// NaiveService runs the Caddy forward proxy NaiveProxy clients connect to. The enabled clients
+// of the chosen inbounds authenticate with their email and their ID or password.
+type NaiveService struct {
+	inboundService InboundService
+	settingService SettingService
+}
+
+// GetNaiveInboundIds returns the IDs of the inbounds whose clients get proxy accounts.
+func (s *NaiveService) GetNaiveInboundIds() (map[int]bool, error) {
+	value, err := s.settingService.GetNaiveInboundIds()
+	if err != nil {
+		return nil, err
+	}
+	return ParseInboundIds(value), nil
+}
+
+// getAccounts returns the accounts of the enabled clients of the chosen enabled inbounds.
+func (s *NaiveService) getAccounts() ([]naive.Account, error) {
+	ids, err := s.GetNaiveInboundIds()
+	if err != nil {
+		return nil, err
+	}
+	clients, err := s.inboundService.GetActiveClients(ids)
+	if err != nil {
+		return nil, err
+	}
+	var accounts []naive.Account
+	for _, client := range clients {
+		if password := ClientSecret(&client); password != "" {
+			accounts = append(accounts, naive.Account{User: client.Email, Password: password})
+		}
+	}
+	return accounts, nil
+}
+
+// buildConfig returns the Caddy configuration for the current settings and clients.
+func (s *NaiveService) buildConfig() ([]byte, error) {
+	opts := &naive.Options{}
+	var err error
+	if opts.Port, err = s.settingService.GetNaivePort(); err != nil {
+		return nil, err
+	}
+	if opts.Domain, err = s.settingService.GetNaiveDomain(); err != nil {
+		return nil, err
+	}
+	if opts.CertFile, err = s.settingService.GetNaiveCertFile(); err != nil {
+		return nil, err
+	}
+	if opts.KeyFile, err = s.settingService.GetNaiveKeyFile(); err != nil {
+		return nil, err
+	}
+	if opts.Accounts, err = s.getAccounts(); err != nil {
+		return nil, err
+	}
+	return naive.BuildConfig(opts)
+}
+
+// IsRunning reports whether the forward proxy is running.
+func (s *NaiveService) IsRunning() bool {
+	naiveLock.Lock()
+	defer naiveLock.Unlock()
+	return naiveProcess != nil && naiveProcess.IsRunning()
+}
+
+// Sync starts, stops or restarts the forward proxy so it runs with the current settings and
+// accounts, leaving it alone when nothing changed.
+func (s *NaiveService) Sync() error {
+	enable, err := s.settingService.GetNaiveEnable()
+	if err != nil {
+		return err
+	}
+	naiveLock.Lock()
+	defer naiveLock.Unlock()
+
+	if !enable {
+		if naiveProcess != nil && naiveProcess.IsRunning() {
+			logger.Info("Stopping the naive forward proxy")
+			if err := naiveProcess.Stop(); err != nil {
+				return err
+			}
+		}
+		naiveProcess = nil
+		return nil
+	}
+
+	config, err := s.buildConfig()
+	if err != nil {
+		return err
+	}
+	if naiveProcess != nil && naiveProcess.IsRunning() {
+		if bytes.Equal(naiveProcess.GetConfig(), config) {
+			return nil
+		}
+		if err := naiveProcess.Stop(); err != nil {
+			return err
+		}
+	}
+	logger.Info("Starting the naive forward proxy")
+	naiveProcess = naive.NewProcess(config)
+	return naiveProcess.Start()
+}
+
+// Stop stops the forward proxy if it is running.
+func (s *NaiveService) Stop() error {
+	naiveLock.Lock()
+	defer naiveLock.Unlock()
+	if naiveProcess == nil || !naiveProcess.IsRunning() {
+		return nil
+	}
+	return naiveProcess.Stop()
+}
+
+// CollectTraffic counts the traffic of the accounts written to the access log since the last
+// collection to their clients, and returns whether the core has to restart because clients
+// were disabled.
+func (s *NaiveService) CollectTraffic() (bool, error) {
+	naiveLock.Lock()
+	usage, offset, err := naive.ReadAccessLog(naiveLogOffset)
+	naiveLogOffset = offset
+	naiveLock.Unlock()
+	if err != nil || len(usage) == 0 {
+		return false, err
+	}
+	clientTraffics := make([]*xray.ClientTraffic, 0, len(usage))
+	for email, u := range usage {
+		clientTraffics = append(clientTraffics, &xray.ClientTraffic{Email: email, Up: u.Up, Down: u.Down})
+	}
+	err, needRestart := s.inboundService.AddAccountTraffic(clientTraffics)
+	return needRestart, err
+}
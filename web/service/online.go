@@ -0,0 +1,158 @@
+package service
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/xray"
+)
+
+// OnlineDetectionAPI finds online clients and their IPs with the Xray online stats instead of
+// traffic and the access log.
+const OnlineDetectionAPI = "api"
+
+// OnlineDetectionStrict counts clients online only for traffic of at least the minimum bytes in
+// every counted direction within one collection, without the idle window.
+const OnlineDetectionStrict = "strict"
+
+var (
+	// clientActivity holds when each client recently had traffic counting as activity, in
+	// Unix milliseconds.
+	clientActivity     = map[string]int64{}
+	clientActivityLock sync.Mutex
+)
+
+// onlineDetection is how the traffic of a collection is turned into online clients.
+type onlineDetection struct {
+	strict   bool
+	minBytes int64
+	window   int64 // Milliseconds a client stays online after its last activity
+	uplink   bool  // Whether client uplink traffic is counted
+	downlink bool  // Whether client downlink traffic is counted
+}
+
+// getOnlineDetection reads the online detection settings.
+func getOnlineDetection() onlineDetection {
+	var settingService SettingService
+	mode, _ := settingService.GetOnlineDetectionMode()
+	detection := onlineDetection{strict: mode == OnlineDetectionStrict, minBytes: 1, uplink: true, downlink: true}
+	if minBytes, err := settingService.GetOnlineMinBytes(); err == nil && minBytes > 0 {
+		detection.minBytes = int64(minBytes)
+	}
+	if window, err := settingService.GetOnlineIdleWindow(); err == nil && !detection.strict {
+		detection.window = int64(window) * 1000
+	}
+	if uplink, err := settingService.GetTrafficClientUplink(); err == nil {
+		detection.uplink = uplink
+	}
+	if downlink, err := settingService.GetTrafficClientDownlink(); err == nil {
+		detection.downlink = downlink
+	}
+	return detection
+}
+
+// isActive reports whether the traffic of a client in one collection counts as activity.
+func (d onlineDetection) isActive(traffic *xray.ClientTraffic) bool {
+	if !d.strict {
+		return traffic.Up+traffic.Down >= d.minBytes
+	}
+	if !d.uplink && !d.downlink {
+		return false
+	}
+	return (!d.uplink || traffic.Up >= d.minBytes) && (!d.downlink || traffic.Down >= d.minBytes)
+}
+
+// onlineClients records the clients active in a collection and returns the clients active
+// within the idle window, sorted.
+func (d onlineDetection) onlineClients(active []string, now int64) []string {
+	clientActivityLock.Lock()
+	defer clientActivityLock.Unlock()
+	for _, email := range active {
+		clientActivity[email] = now
+	}
+	online := make([]string, 0, len(clientActivity))
+	for email, last := range clientActivity {
+		if now-last <= d.window {
+			online = append(online, email)
+		} else {
+			delete(clientActivity, email)
+		}
+	}
+	sort.Strings(online)
+	return online
+}
+
+// UsesOnlineStats reports whether online clients are found with the Xray online stats API.
+func (s *XrayService) UsesOnlineStats() bool {
+	mode, err := s.settingService.GetOnlineDetectionMode()
+	return err == nil && mode == OnlineDetectionAPI
+}
+
+// addOnlineStats enables the statsUserOnline policy on every user level, so Xray tracks the
+// connections of each user when online detection uses the stats API.
+func (s *XrayService) addOnlineStats(xrayConfig *xray.Config) error {
+	if !s.UsesOnlineStats() {
+		return nil
+	}
+	return setUserLevelPolicy(xrayConfig, map[string]any{"statsUserOnline": true})
+}
+
+// GetOnlineClientIps asks Xray for the open connections of every enabled client and returns
+// the clients with any and the sorted source IPs of each of them.
+func (s *XrayService) GetOnlineClientIps() (map[string][]string, error) {
+	if !s.IsXrayRunning() {
+		return nil, errors.New("xray is not running")
+	}
+	var emails []string
+	err := database.GetDB().Model(xray.ClientTraffic{}).Where("enable = ?", true).Pluck("email", &emails).Error
+	if err != nil {
+		return nil, err
+	}
+	s.xrayAPI.Init(coreAPIPort())
+	defer s.xrayAPI.Close()
+
+	clientIps := map[string][]string{}
+	for _, email := range emails {
+		ipList, err := s.xrayAPI.GetOnlineIPs(email)
+		if err != nil {
+			return nil, err
+		}
+		if len(ipList) == 0 {
+			continue
+		}
+		ips := make([]string, 0, len(ipList))
+		for ip := range ipList {
+			if ip == "127.0.0.1" || ip == "::1" {
+				continue
+			}
+			ips = append(ips, ip)
+		}
+		sort.Strings(ips)
+		clientIps[email] = ips
+	}
+	return clientIps, nil
+}
+
+// RefreshOnlineClients replaces the online clients with those Xray reports connections for
+// and records that they were online.
+func (s *XrayService) RefreshOnlineClients() error {
+	clientIps, err := s.GetOnlineClientIps()
+	if err != nil {
+		return err
+	}
+	emails := make([]string, 0, len(clientIps))
+	for email := range clientIps {
+		emails = append(emails, email)
+	}
+	sort.Strings(emails)
+	p.SetOnlineClients(emails)
+	if len(emails) == 0 {
+		return nil
+	}
+	return database.GetDB().Model(xray.ClientTraffic{}).
+		Where("email IN ?", emails).
+		Update("last_online", time.Now().UnixMilli()).Error
+}
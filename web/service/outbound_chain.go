@@ -0,0 +1,88 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/util/link"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+)
+
+// ChainOutbound adds an outbound for the upstream server of a share link to the Xray template,
+// with a routing rule sending the traffic of the chosen inbounds through it. The rule goes
+// right after the API rules so it takes precedence over the rest. Returns the new outbound.
+func (s *XraySettingService) ChainOutbound(req *entity.ChainOutboundRequest) (map[string]any, error) {
+	outbound, _, err := link.ParseOutbound(req.Link)
+	if err != nil {
+		return nil, common.WithCode(common.ErrCodeValidation, err)
+	}
+	if len(req.InboundTags) == 0 {
+		return nil, common.WithCode(common.ErrCodeValidation, common.NewError("no inbounds to chain"))
+	}
+	var inboundTags []string
+	if err := database.GetDB().Model(model.Inbound{}).Pluck("tag", &inboundTags).Error; err != nil {
+		return nil, err
+	}
+	for _, tag := range req.InboundTags {
+		if !slices.Contains(inboundTags, tag) {
+			return nil, common.WithCode(common.ErrCodeValidation, common.NewError("inbound not found:", tag))
+		}
+	}
+
+	templateConfig, err := s.GetXrayConfigTemplate()
+	if err != nil {
+		return nil, err
+	}
+	template := map[string]any{}
+	if err := json.Unmarshal([]byte(templateConfig), &template); err != nil {
+		return nil, err
+	}
+	outbounds, _ := template["outbounds"].([]any)
+	tag := req.Tag
+	if tag == "" {
+		tag = "chain"
+		for i := 2; ; i++ {
+			if _, existing := findTemplateOutbound(template, tag); existing == nil {
+				break
+			}
+			tag = fmt.Sprintf("chain-%d", i)
+		}
+	} else if _, existing := findTemplateOutbound(template, tag); existing != nil {
+		return nil, common.WithCode(common.ErrCodeValidation, common.NewError("outbound already exists:", tag))
+	}
+	outbound["tag"] = tag
+	template["outbounds"] = append(outbounds, outbound)
+
+	routing, _ := template["routing"].(map[string]any)
+	if routing == nil {
+		routing = map[string]any{}
+	}
+	rules, _ := routing["rules"].([]any)
+	at := 0
+	for at < len(rules) {
+		if rule, _ := rules[at].(map[string]any); rule["outboundTag"] != "api" {
+			break
+		}
+		at++
+	}
+	rule := map[string]any{
+		"type":        "field",
+		"inboundTag":  req.InboundTags,
+		"outboundTag": tag,
+	}
+	routing["rules"] = slices.Insert(rules, at, any(rule))
+	template["routing"] = routing
+
+	data, err := json.MarshalIndent(template, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := s.SaveXraySetting(string(data)); err != nil {
+		return nil, err
+	}
+	return outbound, nil
+}
@@ -0,0 +1,309 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/util/link"
+	"github.com/mhsanaei/3x-ui/v2/xray"
+)
+
+var (
+	outboundPoolStrategies = []string{"random", "roundRobin", "leastPing"}
+	outboundPoolClient     = &http.Client{Timeout: 30 * time.Second}
+)
+
+// outboundPoolMaxBody bounds the size of a fetched subscription.
+const outboundPoolMaxBody = 4 << 20
+
+// OutboundPoolService keeps outbound pools in sync with their external subscriptions.
+type OutboundPoolService struct{}
+
+// GetPools returns all outbound pools.
+func (s *OutboundPoolService) GetPools() ([]*model.OutboundPool, error) {
+	var pools []*model.OutboundPool
+	err := database.GetDB().Model(model.OutboundPool{}).Order("id").Find(&pools).Error
+	if err != nil {
+		return nil, err
+	}
+	return pools, nil
+}
+
+func checkOutboundPool(pool *model.OutboundPool) error {
+	pool.Tag = strings.TrimSpace(pool.Tag)
+	if pool.Tag == "" {
+		return common.NewError("outbound pool tag can not be empty")
+	}
+	u, err := url.Parse(pool.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return common.NewError("invalid outbound pool url:", pool.Url)
+	}
+	if pool.Interval < 1 {
+		return common.NewError("invalid outbound pool interval:", pool.Interval)
+	}
+	if pool.Strategy == "" {
+		pool.Strategy = "random"
+	}
+	if !slices.Contains(outboundPoolStrategies, pool.Strategy) {
+		return common.NewError("invalid outbound pool strategy:", pool.Strategy)
+	}
+	pool.InboundTags = strings.ReplaceAll(strings.TrimSpace(pool.InboundTags), " ", "")
+	return nil
+}
+
+// AddPool validates and stores a new outbound pool, then fetches its subscription. A failed
+// fetch is recorded on the pool and retried on schedule.
+func (s *OutboundPoolService) AddPool(pool *model.OutboundPool) error {
+	if err := checkOutboundPool(pool); err != nil {
+		return common.WithCode(common.ErrCodeValidation, err)
+	}
+	pool.Id = 0
+	pool.Outbounds = ""
+	pool.FetchedAt = 0
+	pool.LastError = ""
+	if err := database.GetDB().Create(pool).Error; err != nil {
+		return err
+	}
+	s.refresh(pool)
+	return nil
+}
+
+// UpdatePool updates the subscription, schedule and routing of an outbound pool. A changed URL
+// is fetched at once.
+func (s *OutboundPoolService) UpdatePool(pool *model.OutboundPool) error {
+	if err := checkOutboundPool(pool); err != nil {
+		return common.WithCode(common.ErrCodeValidation, err)
+	}
+	db := database.GetDB()
+	old := &model.OutboundPool{}
+	if err := db.First(old, pool.Id).Error; err != nil {
+		return err
+	}
+	urlChanged := old.Url != pool.Url
+	old.Tag = pool.Tag
+	old.Url = pool.Url
+	old.Interval = pool.Interval
+	old.Strategy = pool.Strategy
+	old.InboundTags = pool.InboundTags
+	old.Enable = pool.Enable
+	if err := db.Save(old).Error; err != nil {
+		return err
+	}
+	if urlChanged {
+		s.refresh(old)
+	}
+	*pool = *old
+	return nil
+}
+
+// DelPool deletes an outbound pool.
+func (s *OutboundPoolService) DelPool(id int) error {
+	return database.GetDB().Delete(model.OutboundPool{}, id).Error
+}
+
+// RefreshPool fetches the subscription of an outbound pool now. Returns whether its outbounds changed.
+func (s *OutboundPoolService) RefreshPool(id int) (*model.OutboundPool, bool, error) {
+	pool := &model.OutboundPool{}
+	if err := database.GetDB().First(pool, id).Error; err != nil {
+		return nil, false, err
+	}
+	changed := s.refresh(pool)
+	if pool.LastError != "" {
+		return pool, changed, common.NewError(pool.LastError)
+	}
+	return pool, changed, nil
+}
+
+// RefreshDuePools fetches the subscriptions of the enabled pools whose interval has passed.
+// Returns whether the outbounds of any of them changed.
+func (s *OutboundPoolService) RefreshDuePools() (bool, error) {
+	var pools []*model.OutboundPool
+	if err := database.GetDB().Model(model.OutboundPool{}).Where("enable = ?", true).Find(&pools).Error; err != nil {
+		return false, err
+	}
+	now := time.Now().UnixMilli()
+	changed := false
+	for _, pool := range pools {
+		if now-pool.FetchedAt >= int64(pool.Interval)*60000 && s.refresh(pool) {
+			changed = true
+		}
+	}
+	return changed, nil
+}
+
+// refresh fetches the subscription of a pool and stores the outbounds it converts to, or the
+// error when it fails, keeping the outbounds of the last successful fetch. Returns whether
+// the outbounds changed.
+func (s *OutboundPoolService) refresh(pool *model.OutboundPool) bool {
+	pool.FetchedAt = time.Now().UnixMilli()
+	outbounds, err := fetchPoolOutbounds(pool.Url)
+	changed := false
+	if err != nil {
+		pool.LastError = err.Error()
+		logger.Warning("Unable to fetch outbound pool", pool.Tag, ":", err)
+	} else {
+		pool.LastError = ""
+		data, _ := json.Marshal(outbounds)
+		changed = string(data) != pool.Outbounds
+		pool.Outbounds = string(data)
+	}
+	if err := database.GetDB().Model(pool).Updates(map[string]any{
+		"outbounds":  pool.Outbounds,
+		"fetched_at": pool.FetchedAt,
+		"last_error": pool.LastError,
+	}).Error; err != nil {
+		logger.Warning("Unable to save outbound pool", pool.Tag, ":", err)
+	}
+	return changed && pool.Enable
+}
+
+// fetchPoolOutbounds downloads a subscription and converts the share links it lists into
+// outbounds. Links that cannot be converted are skipped.
+func fetchPoolOutbounds(subUrl string) ([]map[string]any, error) {
+	resp, err := outboundPoolClient.Get(subUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, outboundPoolMaxBody))
+	if err != nil {
+		return nil, err
+	}
+	content := strings.TrimSpace(string(body))
+	if !strings.Contains(content, "://") {
+		if decoded, ok := link.DecodeBase64(strings.Join(strings.Fields(content), "")); ok {
+			content = decoded
+		}
+	}
+	var outbounds []map[string]any
+	skipped := 0
+	for _, line := range strings.Split(content, "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		outbound, _, err := link.ParseOutbound(line)
+		if err != nil {
+			skipped++
+			continue
+		}
+		outbounds = append(outbounds, outbound)
+	}
+	if len(outbounds) == 0 {
+		return nil, fmt.Errorf("no supported links in subscription, %d skipped", skipped)
+	}
+	if skipped > 0 {
+		logger.Debugf("Skipped %d unsupported links of outbound pool %s", skipped, subUrl)
+	}
+	return outbounds, nil
+}
+
+// addOutboundPools adds the outbounds of the enabled pools to the Xray config, each pool with
+// a balancer over its outbounds and, when it names inbounds, a rule routing them to it.
+func (s *XrayService) addOutboundPools(xrayConfig *xray.Config) error {
+	var pools []*model.OutboundPool
+	err := database.GetDB().Model(model.OutboundPool{}).Where("enable = ? AND outbounds != ''", true).Find(&pools).Error
+	if err != nil || len(pools) == 0 {
+		return err
+	}
+	var outbounds []any
+	if len(xrayConfig.OutboundConfigs) > 0 {
+		if err := json.Unmarshal(xrayConfig.OutboundConfigs, &outbounds); err != nil {
+			return err
+		}
+	}
+	routing := map[string]any{}
+	if len(xrayConfig.RouterConfig) > 0 {
+		if err := json.Unmarshal(xrayConfig.RouterConfig, &routing); err != nil {
+			return err
+		}
+	}
+	balancers, _ := routing["balancers"].([]any)
+	rules, _ := routing["rules"].([]any)
+	var poolRules []any
+	var pingSelectors []any
+	for _, pool := range pools {
+		var poolOutbounds []map[string]any
+		if err := json.Unmarshal([]byte(pool.Outbounds), &poolOutbounds); err != nil {
+			logger.Warning("Invalid outbounds of outbound pool", pool.Tag, ":", err)
+			continue
+		}
+		for i, outbound := range poolOutbounds {
+			outbound["tag"] = fmt.Sprintf("%s-%d", pool.Tag, i+1)
+			outbounds = append(outbounds, outbound)
+		}
+		balancers = slices.DeleteFunc(balancers, func(b any) bool {
+			balancer, _ := b.(map[string]any)
+			return balancer["tag"] == pool.Tag
+		})
+		balancers = append(balancers, map[string]any{
+			"tag":      pool.Tag,
+			"selector": []any{pool.Tag + "-"},
+			"strategy": map[string]any{"type": pool.Strategy},
+		})
+		if pool.Strategy == "leastPing" {
+			pingSelectors = append(pingSelectors, pool.Tag+"-")
+		}
+		if pool.InboundTags != "" {
+			poolRules = append(poolRules, map[string]any{
+				"type":        "field",
+				"inboundTag":  strings.Split(pool.InboundTags, ","),
+				"balancerTag": pool.Tag,
+			})
+		}
+	}
+	at := 0
+	for at < len(rules) {
+		if rule, _ := rules[at].(map[string]any); rule["outboundTag"] != "api" {
+			break
+		}
+		at++
+	}
+	routing["rules"] = slices.Insert(rules, at, poolRules...)
+	routing["balancers"] = balancers
+
+	if xrayConfig.OutboundConfigs, err = json.Marshal(outbounds); err != nil {
+		return err
+	}
+	if xrayConfig.RouterConfig, err = json.Marshal(routing); err != nil {
+		return err
+	}
+	if len(pingSelectors) > 0 {
+		return addObservatorySelectors(xrayConfig, pingSelectors)
+	}
+	return nil
+}
+
+// addObservatorySelectors makes the observatory of the Xray config probe the outbounds with the
+// given tag prefixes, which leastPing balancers need.
+func addObservatorySelectors(xrayConfig *xray.Config, selectors []any) error {
+	observatory := map[string]any{}
+	if len(xrayConfig.Observatory) > 0 {
+		if err := json.Unmarshal(xrayConfig.Observatory, &observatory); err != nil {
+			return err
+		}
+	}
+	existing, _ := observatory["subjectSelector"].([]any)
+	observatory["subjectSelector"] = append(existing, selectors...)
+	if _, ok := observatory["probeInterval"]; !ok {
+		observatory["probeInterval"] = "1m"
+	}
+	data, err := json.Marshal(observatory)
+	if err != nil {
+		return err
+	}
+	xrayConfig.Observatory = data
+	return nil
+}
@@ -0,0 +1,384 @@
+package service
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+	"github.com/mhsanaei/3x-ui/v2/xray"
+)
+
+const (
+	// outboundProbeTimeout bounds the TCP connect and the TLS handshake of a probe each.
+	outboundProbeTimeout = 10 * time.Second
+	// outboundProbeWorkers bounds the outbounds probed at the same time.
+	outboundProbeWorkers = 16
+	// outboundProbeHistory is how long probe results are kept.
+	outboundProbeHistory = 7 * 24 * time.Hour
+	// outboundProbeFailures is the number of consecutive failed probes after which an outbound
+	// counts as failing.
+	outboundProbeFailures = 3
+)
+
+// udpNetworks are the transports whose servers cannot be probed with a TCP connection.
+var udpNetworks = []string{"kcp", "mkcp", "quic", "hysteria"}
+
+// OutboundProbeService measures how fast and how reliably the servers of the outbounds accept
+// connections.
+type OutboundProbeService struct {
+	xrayService    XrayService
+	settingService SettingService
+}
+
+// outboundTarget is the server of an outbound and how to handshake with it.
+type outboundTarget struct {
+	tag        string
+	address    string
+	tls        bool
+	serverName string
+	alpn       []string
+	balanced   bool
+}
+
+// ProbeOutbounds probes the servers of all outbounds of the Xray config, stores the results and
+// drops results older than a week. Returns the results and whether the outbounds to take out of
+// balancers changed, which needs an Xray restart.
+func (s *OutboundProbeService) ProbeOutbounds() ([]*model.OutboundProbe, bool, error) {
+	targets, err := s.probeTargets()
+	if err != nil {
+		return nil, false, err
+	}
+	before, err := failingOutbounds()
+	if err != nil {
+		return nil, false, err
+	}
+
+	probes := make([]*model.OutboundProbe, len(targets))
+	sem := make(chan struct{}, outboundProbeWorkers)
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			probes[i] = probeOutbound(target)
+			<-sem
+		}()
+	}
+	wg.Wait()
+
+	db := database.GetDB()
+	if len(probes) > 0 {
+		if err := db.Create(&probes).Error; err != nil {
+			return nil, false, err
+		}
+	}
+	cutoff := time.Now().Add(-outboundProbeHistory).UnixMilli()
+	if err := db.Where("created_at < ?", cutoff).Delete(&model.OutboundProbe{}).Error; err != nil {
+		logger.Warning("Unable to drop old outbound probes:", err)
+	}
+
+	deprioritize, err := s.settingService.GetOutboundProbeDeprioritize()
+	if err != nil || !deprioritize {
+		return probes, false, err
+	}
+	after, err := failingOutbounds()
+	if err != nil {
+		return probes, false, err
+	}
+	changed := false
+	for _, target := range targets {
+		if target.balanced && before[target.tag] != after[target.tag] {
+			changed = true
+		}
+	}
+	return probes, changed, nil
+}
+
+// GetProbes returns the stored probes of an outbound, or of all outbounds when the tag is
+// empty, newest first.
+func (s *OutboundProbeService) GetProbes(tag string, since int64, limit int) ([]*model.OutboundProbe, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = 1000
+	}
+	db := database.GetDB().Model(model.OutboundProbe{}).Where("created_at >= ?", since)
+	if tag != "" {
+		db = db.Where("tag = ?", tag)
+	}
+	var probes []*model.OutboundProbe
+	if err := db.Order("id DESC").Limit(limit).Find(&probes).Error; err != nil {
+		return nil, err
+	}
+	return probes, nil
+}
+
+// GetProbeSummaries returns the success rate and average latency of the outbounds probed in
+// the last 24 hours.
+func (s *OutboundProbeService) GetProbeSummaries() ([]*entity.OutboundProbeSummary, error) {
+	var summaries []*entity.OutboundProbeSummary
+	since := time.Now().Add(-24 * time.Hour).UnixMilli()
+	err := database.GetDB().Raw(`SELECT tag,
+			COUNT(*) AS probes,
+			SUM(success) AS successes,
+			CAST(COALESCE(AVG(CASE WHEN success THEN tcp_latency + tls_latency END), 0) AS INTEGER) AS latency,
+			MAX(created_at) AS last_probe_at
+		FROM outbound_probes WHERE created_at >= ? GROUP BY tag ORDER BY tag`, since).Scan(&summaries).Error
+	if err != nil {
+		return nil, err
+	}
+	failing, err := failingOutbounds()
+	if err != nil {
+		return nil, err
+	}
+	for _, summary := range summaries {
+		summary.SuccessRate = float64(summary.Successes) / float64(summary.Probes)
+		summary.Deprioritized = failing[summary.Tag]
+	}
+	return summaries, nil
+}
+
+// failingOutbounds returns the tags of the outbounds whose last outboundProbeFailures probes
+// all failed.
+func failingOutbounds() (map[string]bool, error) {
+	var tags []string
+	err := database.GetDB().Raw(`SELECT tag FROM (
+			SELECT tag, success, ROW_NUMBER() OVER (PARTITION BY tag ORDER BY id DESC) AS n
+			FROM outbound_probes)
+		WHERE n <= ? GROUP BY tag HAVING COUNT(*) = ? AND MAX(success) = 0`,
+		outboundProbeFailures, outboundProbeFailures).Scan(&tags).Error
+	if err != nil {
+		return nil, err
+	}
+	failing := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		failing[tag] = true
+	}
+	return failing, nil
+}
+
+// probeTargets returns the outbounds of the Xray config that connect to a server over TCP.
+func (s *OutboundProbeService) probeTargets() ([]outboundTarget, error) {
+	xrayConfig, err := s.xrayService.GetXrayConfig()
+	if err != nil {
+		return nil, err
+	}
+	var outbounds []map[string]any
+	if len(xrayConfig.OutboundConfigs) > 0 {
+		if err := json.Unmarshal(xrayConfig.OutboundConfigs, &outbounds); err != nil {
+			return nil, err
+		}
+	}
+	routing := map[string]any{}
+	if len(xrayConfig.RouterConfig) > 0 {
+		if err := json.Unmarshal(xrayConfig.RouterConfig, &routing); err != nil {
+			return nil, err
+		}
+	}
+	for _, outbound := range outbounds {
+		if tag, ok := outbound["tag"].(string); ok {
+			outbound["tag"] = xray.BaseOutboundTag(tag)
+		}
+	}
+	balanced := map[string]bool{}
+	for _, members := range balancerMembers(outbounds, routing) {
+		for _, tag := range members {
+			balanced[tag] = true
+		}
+	}
+
+	var targets []outboundTarget
+	for _, outbound := range outbounds {
+		tag, _ := outbound["tag"].(string)
+		settings, _ := outbound["settings"].(map[string]any)
+		servers, _ := settings["vnext"].([]any)
+		if len(servers) == 0 {
+			servers, _ = settings["servers"].([]any)
+		}
+		if tag == "" || len(servers) == 0 {
+			continue
+		}
+		server, _ := servers[0].(map[string]any)
+		host, _ := server["address"].(string)
+		port, _ := server["port"].(float64)
+		if host == "" || port <= 0 {
+			continue
+		}
+		stream, _ := outbound["streamSettings"].(map[string]any)
+		if network, _ := stream["network"].(string); slices.Contains(udpNetworks, network) {
+			continue
+		}
+		target := outboundTarget{
+			tag:      tag,
+			address:  net.JoinHostPort(host, strconv.Itoa(int(port))),
+			balanced: balanced[tag],
+		}
+		switch stream["security"] {
+		case "tls":
+			tlsSettings, _ := stream["tlsSettings"].(map[string]any)
+			target.tls = true
+			target.serverName, _ = tlsSettings["serverName"].(string)
+			alpn, _ := tlsSettings["alpn"].([]any)
+			for _, proto := range alpn {
+				if p, ok := proto.(string); ok {
+					target.alpn = append(target.alpn, p)
+				}
+			}
+		case "reality":
+			// A REALITY server completes the handshake of its target site for clients without
+			// the key, which tells whether it is reachable.
+			realitySettings, _ := stream["realitySettings"].(map[string]any)
+			target.tls = true
+			target.serverName, _ = realitySettings["serverName"].(string)
+		}
+		if target.tls && target.serverName == "" && net.ParseIP(host) == nil {
+			target.serverName = host
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// probeOutbound connects to the server of an outbound and completes the TLS handshake when
+// the outbound uses TLS, timing both.
+func probeOutbound(target outboundTarget) *model.OutboundProbe {
+	probe := &model.OutboundProbe{
+		Tag:       target.tag,
+		Address:   target.address,
+		CreatedAt: time.Now().UnixMilli(),
+	}
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", target.address, outboundProbeTimeout)
+	if err != nil {
+		probe.Error = err.Error()
+		return probe
+	}
+	defer conn.Close()
+	probe.TcpLatency = time.Since(start).Milliseconds()
+
+	if target.tls {
+		start = time.Now()
+		conn.SetDeadline(start.Add(outboundProbeTimeout))
+		tlsConn := tls.Client(conn, &tls.Config{
+			ServerName:         target.serverName,
+			NextProtos:         target.alpn,
+			InsecureSkipVerify: true,
+		})
+		if err := tlsConn.Handshake(); err != nil {
+			probe.Error = "tls handshake: " + err.Error()
+			return probe
+		}
+		probe.TlsLatency = time.Since(start).Milliseconds()
+	}
+	probe.Success = true
+	return probe
+}
+
+// balancerMembers returns the tags of the outbounds the selectors of each balancer match.
+func balancerMembers(outbounds []map[string]any, routing map[string]any) [][]string {
+	balancers, _ := routing["balancers"].([]any)
+	members := make([][]string, len(balancers))
+	for i, b := range balancers {
+		balancer, _ := b.(map[string]any)
+		selectors, _ := balancer["selector"].([]any)
+		for _, outbound := range outbounds {
+			tag, _ := outbound["tag"].(string)
+			if slices.ContainsFunc(selectors, func(selector any) bool {
+				prefix, ok := selector.(string)
+				return ok && strings.HasPrefix(tag, prefix)
+			}) {
+				members[i] = append(members[i], tag)
+			}
+		}
+	}
+	return members
+}
+
+// deprioritizeFailingOutbounds takes the outbounds whose last probes all failed out of the
+// balancers selecting them. As balancers select by tag prefix, the outbounds are renamed with
+// xray.DeprioritizedTagPrefix and the rules and outbounds naming them are pointed to the new
+// tags. A balancer keeps its outbounds when all of them fail.
+func (s *XrayService) deprioritizeFailingOutbounds(xrayConfig *xray.Config) error {
+	enabled, err := s.settingService.GetOutboundProbeDeprioritize()
+	if err != nil || !enabled || len(xrayConfig.RouterConfig) == 0 {
+		return err
+	}
+	failing, err := failingOutbounds()
+	if err != nil || len(failing) == 0 {
+		return err
+	}
+	var outbounds []map[string]any
+	if len(xrayConfig.OutboundConfigs) > 0 {
+		if err := json.Unmarshal(xrayConfig.OutboundConfigs, &outbounds); err != nil {
+			return err
+		}
+	}
+	routing := map[string]any{}
+	if err := json.Unmarshal(xrayConfig.RouterConfig, &routing); err != nil {
+		return err
+	}
+
+	renamed := map[string]string{}
+	for _, members := range balancerMembers(outbounds, routing) {
+		var down []string
+		for _, tag := range members {
+			if failing[tag] {
+				down = append(down, tag)
+			}
+		}
+		if len(down) == len(members) {
+			continue
+		}
+		for _, tag := range down {
+			renamed[tag] = xray.DeprioritizedTagPrefix + tag
+		}
+	}
+	if len(renamed) == 0 {
+		return nil
+	}
+	logger.Info("Taking failing outbounds out of their balancers:", slices.Sorted(maps.Keys(renamed)))
+
+	rename := func(m map[string]any, key string) {
+		if tag, ok := m[key].(string); ok && renamed[tag] != "" {
+			m[key] = renamed[tag]
+		}
+	}
+	for _, outbound := range outbounds {
+		rename(outbound, "tag")
+		if proxySettings, ok := outbound["proxySettings"].(map[string]any); ok {
+			rename(proxySettings, "tag")
+		}
+		if stream, ok := outbound["streamSettings"].(map[string]any); ok {
+			if sockopt, ok := stream["sockopt"].(map[string]any); ok {
+				rename(sockopt, "dialerProxy")
+			}
+		}
+	}
+	rules, _ := routing["rules"].([]any)
+	for _, r := range rules {
+		if rule, ok := r.(map[string]any); ok {
+			rename(rule, "outboundTag")
+		}
+	}
+	balancers, _ := routing["balancers"].([]any)
+	for _, b := range balancers {
+		if balancer, ok := b.(map[string]any); ok {
+			rename(balancer, "fallbackTag")
+		}
+	}
+
+	if xrayConfig.OutboundConfigs, err = json.Marshal(outbounds); err != nil {
+		return err
+	}
+	xrayConfig.RouterConfig, err = json.Marshal(routing)
+	return err
+}
@@ -6,11 +6,15 @@ import (
 	"time"
 
 	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/web/global"
 )
 
 // PanelService provides business logic for panel management operations.
 // It handles panel restart, updates, and system-level panel controls.
-type PanelService struct{}
+type PanelService struct {
+	settingService SettingService
+}
 
 func (s *PanelService) RestartPanel(delay time.Duration) error {
 	p, err := os.FindProcess(syscall.Getpid())
@@ -26,3 +30,38 @@ func (s *PanelService) RestartPanel(delay time.Duration) error {
 	}()
 	return nil
 }
+
+// ReloadCerts reloads the TLS certificates of the panel and subscription servers from disk
+// without restarting them. Servers that do not run HTTPS are skipped.
+func (s *PanelService) ReloadCerts() error {
+	var errs []error
+	reloaded := false
+	if webServer := global.GetWebServer(); webServer != nil {
+		if err := webServer.ReloadCert(); err == nil {
+			reloaded = true
+		} else if s.usesCert(s.settingService.GetCertFile) {
+			errs = append(errs, common.NewError("panel:", err))
+		}
+	}
+	if subServer := global.GetSubServer(); subServer != nil {
+		if err := subServer.ReloadCert(); err == nil {
+			reloaded = true
+		} else if s.usesCert(s.settingService.GetSubCertFile) {
+			errs = append(errs, common.NewError("subscription:", err))
+		}
+	}
+	if len(errs) > 0 {
+		return common.Combine(errs...)
+	}
+	if !reloaded {
+		return common.NewError("no server is running HTTPS")
+	}
+	logger.Info("Reloaded TLS certificates")
+	return nil
+}
+
+// usesCert reports whether a certificate file is configured.
+func (s *PanelService) usesCert(getCertFile func() (string, error)) bool {
+	certFile, err := getCertFile()
+	return err == nil && certFile != ""
+}
@@ -0,0 +1,458 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+)
+
+// PaymentNotification is a payment reported by a payment provider after its signature was verified.
+type PaymentNotification struct {
+	Reference string // Payment ID at the provider, used to ignore repeated notifications
+	Paid      bool   // Whether the payment is completed; other notifications are acknowledged and ignored
+	PlanId    int
+	InboundId int   // Inbound chosen for the client, 0 for the plan's default
+	Amount    int64 // Paid amount in the currency's smallest unit
+	Currency  string
+	Email     string
+	TgID      int64
+	Referral  string // Referral code the customer came with
+}
+
+// PaymentProvider verifies and parses the webhook requests of a payment provider.
+type PaymentProvider interface {
+	// SecretSetting returns the setting key holding the provider's webhook secret.
+	SecretSetting() string
+	// Verify checks the request signature with secret and parses the notification.
+	Verify(header http.Header, body []byte, secret string) (*PaymentNotification, error)
+}
+
+var paymentProviders = map[string]PaymentProvider{
+	"stripe": stripeProvider{},
+	"hmac":   hmacProvider{},
+}
+
+// RegisterPaymentProvider adds a payment provider whose webhooks are accepted under the given name.
+func RegisterPaymentProvider(name string, provider PaymentProvider) {
+	paymentProviders[name] = provider
+}
+
+// stripeProvider handles Stripe checkout webhooks. The plan is read from the session metadata keys plan_id, inbound_id, tg_id and ref.
+type stripeProvider struct{}
+
+// stripeTolerance is the maximum age of a Stripe signature, matching Stripe's own libraries.
+const stripeTolerance = 5 * time.Minute
+
+// stripePaidEvents are the Checkout events a paid session arrives with: completed for payments
+// settled at checkout, async_payment_succeeded for payments like bank debits that settle later.
+var stripePaidEvents = map[string]bool{
+	"checkout.session.completed":               true,
+	"checkout.session.async_payment_succeeded": true,
+}
+
+func (stripeProvider) SecretSetting() string {
+	return "paymentStripeSecret"
+}
+
+func (stripeProvider) Verify(header http.Header, body []byte, secret string) (*PaymentNotification, error) {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header.Get("Stripe-Signature"), ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return nil, common.NewError("missing Stripe signature")
+	}
+	if age := time.Since(time.Unix(ts, 0)); age > stripeTolerance || age < -stripeTolerance {
+		return nil, common.NewError("Stripe signature timestamp out of tolerance")
+	}
+	expected := signHmac(secret, append([]byte(timestamp+"."), body...))
+	if !slices.ContainsFunc(signatures, func(sig string) bool { return hmac.Equal([]byte(sig), []byte(expected)) }) {
+		return nil, common.NewError("invalid Stripe signature")
+	}
+
+	var event struct {
+		Type string `json:"type"`
+		Data struct {
+			Object struct {
+				Id              string            `json:"id"`
+				AmountTotal     int64             `json:"amount_total"`
+				Currency        string            `json:"currency"`
+				PaymentStatus   string            `json:"payment_status"`
+				Metadata        map[string]string `json:"metadata"`
+				CustomerEmail   string            `json:"customer_email"`
+				CustomerDetails struct {
+					Email string `json:"email"`
+				} `json:"customer_details"`
+			} `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, err
+	}
+	session := event.Data.Object
+	notification := &PaymentNotification{
+		Reference: session.Id,
+		Paid:      stripePaidEvents[event.Type] && session.PaymentStatus == "paid",
+		Amount:    session.AmountTotal,
+		Currency:  session.Currency,
+		Email:     session.CustomerDetails.Email,
+		Referral:  session.Metadata["ref"],
+	}
+	if notification.Email == "" {
+		notification.Email = session.CustomerEmail
+	}
+	if !notification.Paid {
+		return notification, nil
+	}
+	if notification.PlanId, err = strconv.Atoi(session.Metadata["plan_id"]); err != nil {
+		return nil, common.NewError("invalid plan_id metadata:", session.Metadata["plan_id"])
+	}
+	if inboundId := session.Metadata["inbound_id"]; inboundId != "" {
+		if notification.InboundId, err = strconv.Atoi(inboundId); err != nil {
+			return nil, common.NewError("invalid inbound_id metadata:", inboundId)
+		}
+	}
+	if tgId := session.Metadata["tg_id"]; tgId != "" {
+		if notification.TgID, err = strconv.ParseInt(tgId, 10, 64); err != nil {
+			return nil, common.NewError("invalid tg_id metadata:", tgId)
+		}
+	}
+	return notification, nil
+}
+
+// hmacProvider handles a generic webhook format for crypto payment processors and custom bots.
+// The X-Signature header holds the hex HMAC-SHA256 of the body, optionally prefixed with "sha256=".
+type hmacProvider struct{}
+
+func (hmacProvider) SecretSetting() string {
+	return "paymentHmacSecret"
+}
+
+func (hmacProvider) Verify(header http.Header, body []byte, secret string) (*PaymentNotification, error) {
+	signature := strings.TrimPrefix(header.Get("X-Signature"), "sha256=")
+	if !hmac.Equal([]byte(strings.ToLower(signature)), []byte(signHmac(secret, body))) {
+		return nil, common.NewError("invalid webhook signature")
+	}
+	var payment struct {
+		Id        string `json:"id"`
+		Status    string `json:"status"`
+		PlanId    int    `json:"planId"`
+		InboundId int    `json:"inboundId"`
+		Amount    int64  `json:"amount"`
+		Currency  string `json:"currency"`
+		Email     string `json:"email"`
+		TgID      int64  `json:"tgId"`
+		Referral  string `json:"ref"`
+	}
+	if err := json.Unmarshal(body, &payment); err != nil {
+		return nil, err
+	}
+	if payment.Id == "" {
+		return nil, common.NewError("missing payment id")
+	}
+	return &PaymentNotification{
+		Reference: payment.Id,
+		Paid:      slices.Contains([]string{"paid", "finished", "confirmed", "completed"}, strings.ToLower(payment.Status)),
+		PlanId:    payment.PlanId,
+		InboundId: payment.InboundId,
+		Amount:    payment.Amount,
+		Currency:  payment.Currency,
+		Email:     payment.Email,
+		TgID:      payment.TgID,
+		Referral:  payment.Referral,
+	}, nil
+}
+
+func signHmac(secret string, data []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// PaymentService manages plans and provisions clients for verified payments.
+type PaymentService struct {
+	settingService SettingService
+	inboundService InboundService
+	mailService    MailService
+	tgbot          Tgbot
+}
+
+// GetPlans returns all plans.
+func (s *PaymentService) GetPlans() ([]*model.Plan, error) {
+	db := database.GetDB()
+	var plans []*model.Plan
+	err := db.Model(model.Plan{}).Order("id asc").Find(&plans).Error
+	if err != nil {
+		return nil, err
+	}
+	return plans, nil
+}
+
+// GetPlan returns a plan.
+func (s *PaymentService) GetPlan(id int) (*model.Plan, error) {
+	plan := &model.Plan{}
+	err := database.GetDB().Model(model.Plan{}).Where("id = ?", id).First(plan).Error
+	if database.IsNotFound(err) {
+		return nil, common.NewCodeError(common.ErrCodeNotFound, map[string]any{"planId": id}, "plan not found:", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+func (s *PaymentService) checkPlan(plan *model.Plan) error {
+	if strings.TrimSpace(plan.Name) == "" {
+		return common.NewError("plan name can not be empty")
+	}
+	if plan.Price < 0 || plan.TotalGB < 0 || plan.ExpiryDays < 0 || plan.LimitIP < 0 {
+		return common.NewError("plan values can not be negative")
+	}
+	if plan.Currency == "" {
+		return common.NewError("plan currency can not be empty")
+	}
+	currencies := []string{strings.ToLower(plan.Currency)}
+	for _, price := range plan.Prices {
+		currency := strings.ToLower(strings.TrimSpace(price.Currency))
+		if currency == "" || price.Price < 0 {
+			return common.NewError("plan prices need a currency and can not be negative")
+		}
+		if slices.Contains(currencies, currency) {
+			return common.NewError("plan has more than one price in", price.Currency)
+		}
+		currencies = append(currencies, currency)
+	}
+	for _, field := range strings.Split(plan.InboundIds, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		if id, err := strconv.Atoi(field); err != nil || id <= 0 {
+			return common.NewError("invalid inbound ID in plan:", field)
+		}
+	}
+	for _, id := range plan.AllowedInbounds() {
+		if err := s.inboundService.checkPresetInbound(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddPlan validates and stores a new plan.
+func (s *PaymentService) AddPlan(plan *model.Plan) error {
+	if err := s.checkPlan(plan); err != nil {
+		return err
+	}
+	plan.Id = 0
+	db := database.GetDB()
+	return db.Create(plan).Error
+}
+
+// UpdatePlan validates and updates an existing plan. Clients already provisioned are not changed.
+func (s *PaymentService) UpdatePlan(plan *model.Plan) error {
+	if err := s.checkPlan(plan); err != nil {
+		return err
+	}
+	db := database.GetDB()
+	result := db.Model(model.Plan{}).Where("id = ?", plan.Id).Select("*").Updates(plan)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return common.NewCodeError(common.ErrCodeNotFound, map[string]any{"planId": plan.Id}, "plan not found:", plan.Id)
+	}
+	return nil
+}
+
+// DelPlan deletes a plan.
+func (s *PaymentService) DelPlan(id int) error {
+	db := database.GetDB()
+	return db.Delete(model.Plan{}, id).Error
+}
+
+// GetPayments returns all recorded payments, newest first.
+func (s *PaymentService) GetPayments() ([]*model.Payment, error) {
+	db := database.GetDB()
+	var payments []*model.Payment
+	err := db.Model(model.Payment{}).Order("id desc").Find(&payments).Error
+	if err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
+
+// HandleWebhook verifies a payment provider notification and provisions the purchased client.
+// Repeated notifications of a provisioned payment are ignored, while failed ones are retried.
+// Returns whether Xray needs restart.
+func (s *PaymentService) HandleWebhook(providerName string, header http.Header, body []byte) (bool, error) {
+	enable, err := s.settingService.GetPaymentEnable()
+	if err != nil {
+		return false, err
+	}
+	if !enable {
+		return false, common.NewError("payments are disabled")
+	}
+	provider, ok := paymentProviders[providerName]
+	if !ok {
+		return false, common.NewError("unknown payment provider:", providerName)
+	}
+	secret, err := s.settingService.getString(provider.SecretSetting())
+	if err != nil {
+		return false, err
+	}
+	if secret == "" {
+		return false, common.NewError("payment provider is not configured:", providerName)
+	}
+	notification, err := provider.Verify(header, body, secret)
+	if err != nil {
+		return false, err
+	}
+	if !notification.Paid {
+		return false, nil
+	}
+
+	db := database.GetDB()
+	payment := &model.Payment{}
+	err = db.Model(model.Payment{}).
+		Where("provider = ? AND reference = ?", providerName, notification.Reference).
+		First(payment).Error
+	switch {
+	case err == nil:
+		if payment.Status != model.PaymentFailed {
+			return false, nil
+		}
+		// Claim the failed payment before retrying it so concurrent deliveries can not provision it twice
+		result := db.Model(model.Payment{}).
+			Where("id = ? AND status = ?", payment.Id, model.PaymentFailed).
+			Update("status", model.PaymentPending)
+		if result.Error != nil {
+			return false, result.Error
+		}
+		if result.RowsAffected == 0 {
+			return false, nil
+		}
+		payment.Status = model.PaymentPending
+	case database.IsNotFound(err):
+		payment = &model.Payment{
+			Provider:  providerName,
+			Reference: notification.Reference,
+			PlanId:    notification.PlanId,
+			InboundId: notification.InboundId,
+			Amount:    notification.Amount,
+			Currency:  notification.Currency,
+			Email:     notification.Email,
+			TgID:      notification.TgID,
+			Referral:  notification.Referral,
+			Status:    model.PaymentPending,
+			CreatedAt: time.Now().UnixMilli(),
+		}
+		// The unique index on provider and reference rejects concurrent deliveries of the same payment
+		if err := db.Create(payment).Error; err != nil {
+			return false, err
+		}
+	default:
+		return false, err
+	}
+
+	inbound, client, needRestart, err := s.provision(payment)
+	if err != nil {
+		payment.Status = model.PaymentFailed
+		payment.Error = err.Error()
+		if saveErr := db.Save(payment).Error; saveErr != nil {
+			logger.Warning("Unable to save payment:", saveErr)
+		}
+		s.tgbot.SendMsgToTgbotAdmins(html.EscapeString(fmt.Sprintf("Payment %s/%s could not be provisioned: %v", providerName, payment.Reference, err)))
+		return false, err
+	}
+	payment.Status = model.PaymentProvisioned
+	payment.Error = ""
+	payment.ClientEmail = client.Email
+	if err := db.Save(payment).Error; err != nil {
+		logger.Warning("Unable to save payment:", err)
+	}
+	s.deliver(payment, inbound, client)
+	return needRestart, nil
+}
+
+func (s *PaymentService) provision(payment *model.Payment) (*model.Inbound, *model.Client, bool, error) {
+	plan, err := s.GetPlan(payment.PlanId)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	price, ok := plan.PriceIn(payment.Currency)
+	if !ok || payment.Amount < price {
+		return nil, nil, false, common.NewErrorf("paid %d %s does not cover the price of plan %d", payment.Amount, payment.Currency, plan.Id)
+	}
+	return s.ProvisionPlan(plan, payment.InboundId, ClientPreset{
+		TgID:     payment.TgID,
+		Comment:  strings.TrimSpace(plan.Name + " " + payment.Email),
+		Referral: payment.Referral,
+	})
+}
+
+// ProvisionPlan creates the client of a plan on one of its inbounds, the plan's default when
+// inboundId is 0, with the quota, validity and IP limit of the plan. The email, subscription ID,
+// Telegram ID, referral code and comment are taken from the preset, the comment defaults to the plan name, so
+// payment hooks, the Telegram bot and other integrations create the same clients for a plan.
+// Returns the refreshed inbound, the created client and whether Xray needs restart.
+func (s *PaymentService) ProvisionPlan(plan *model.Plan, inboundId int, preset ClientPreset) (*model.Inbound, *model.Client, bool, error) {
+	if !plan.Enable {
+		return nil, nil, false, common.NewCodeError(common.ErrCodeValidation, nil, "plan is disabled:", plan.Id)
+	}
+	if inboundId == 0 {
+		inboundId = plan.InboundId
+	}
+	if !slices.Contains(plan.AllowedInbounds(), inboundId) {
+		return nil, nil, false, common.NewCodeError(common.ErrCodeValidation, map[string]any{"inboundId": inboundId}, "plan", plan.Id, "can not be provisioned on inbound", inboundId)
+	}
+	preset.TotalGB = plan.TotalGB
+	preset.ExpiryDays = plan.ExpiryDays
+	preset.LimitIP = plan.LimitIP
+	if strings.TrimSpace(preset.Comment) == "" {
+		preset.Comment = plan.Name
+	}
+	return s.inboundService.AddPresetClient(inboundId, preset)
+}
+
+// deliver sends the subscription link of a provisioned client to the customer by Telegram and email.
+// Delivery errors are logged only, since the client already exists and can be looked up by admins.
+func (s *PaymentService) deliver(payment *model.Payment, inbound *model.Inbound, client *model.Client) {
+	subURL, _, err := s.tgbot.buildSubscriptionURLs(client.Email)
+	if err != nil {
+		logger.Warning("Unable to build subscription URL for", client.Email, ":", err)
+		return
+	}
+	msg := fmt.Sprintf("Your subscription is ready.\n\nSubscription URL:\n%s", subURL)
+
+	if payment.TgID != 0 && s.tgbot.IsRunning() {
+		s.tgbot.SendMsgToTgbot(payment.TgID, msg)
+	}
+	if payment.Email != "" && s.mailService.IsConfigured() {
+		if err := s.mailService.SendMail(payment.Email, "Your subscription", msg); err != nil {
+			logger.Warning("Unable to email subscription of", client.Email, ":", err)
+		}
+	}
+	s.tgbot.SendMsgToTgbotAdmins(html.EscapeString(fmt.Sprintf("Payment %s/%s provisioned client %s on inbound %s",
+		payment.Provider, payment.Reference, client.Email, inbound.Remark)))
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+)
+
+// maxPolicyLevel bounds the policy levels clients can be assigned to.
+const maxPolicyLevel = 255
+
+// GetPolicyLevels returns the policy levels of the Xray template by level number.
+func (s *SettingService) GetPolicyLevels() (map[string]*entity.PolicyLevel, error) {
+	templateConfig, err := s.GetXrayConfigTemplate()
+	if err != nil {
+		return nil, err
+	}
+	var template struct {
+		Policy struct {
+			Levels map[string]*entity.PolicyLevel `json:"levels"`
+		} `json:"policy"`
+	}
+	if err := json.Unmarshal([]byte(templateConfig), &template); err != nil {
+		return nil, err
+	}
+	if template.Policy.Levels == nil {
+		return map[string]*entity.PolicyLevel{}, nil
+	}
+	return template.Policy.Levels, nil
+}
+
+func checkPolicyLevels(levels map[string]*entity.PolicyLevel) error {
+	for key, level := range levels {
+		n, err := strconv.Atoi(key)
+		if err != nil || n < 0 || n > maxPolicyLevel || strconv.Itoa(n) != key {
+			return common.NewError("invalid policy level:", key)
+		}
+		if level == nil {
+			return common.NewError("policy level can not be empty:", key)
+		}
+		for name, value := range map[string]*int{
+			"handshake":    level.Handshake,
+			"connIdle":     level.ConnIdle,
+			"uplinkOnly":   level.UplinkOnly,
+			"downlinkOnly": level.DownlinkOnly,
+			"bufferSize":   level.BufferSize,
+		} {
+			if value != nil && *value < 0 {
+				return common.NewErrorf("invalid %v of policy level %v: %v", name, key, *value)
+			}
+		}
+	}
+	return nil
+}
+
+// clientLevelsInUse returns the policy levels above 0 clients are assigned to.
+func clientLevelsInUse() ([]int, error) {
+	var levels []int
+	err := database.GetDB().Raw(`SELECT DISTINCT JSON_EXTRACT(client.value, '$.level')
+		FROM inbounds, JSON_EACH(JSON_EXTRACT(inbounds.settings, '$.clients')) AS client
+		WHERE JSON_EXTRACT(client.value, '$.level') > 0`).Scan(&levels).Error
+	return levels, err
+}
+
+// UpdatePolicyLevels validates the policy levels and stores them in the Xray template, keeping
+// the system policy. Levels clients are assigned to cannot be removed.
+func (s *XraySettingService) UpdatePolicyLevels(levels map[string]*entity.PolicyLevel) error {
+	if err := checkPolicyLevels(levels); err != nil {
+		return common.WithCode(common.ErrCodeValidation, err)
+	}
+	inUse, err := clientLevelsInUse()
+	if err != nil {
+		return err
+	}
+	for _, level := range inUse {
+		if _, ok := levels[strconv.Itoa(level)]; !ok {
+			return common.WithCode(common.ErrCodeValidation, common.NewError("policy level is assigned to clients:", level))
+		}
+	}
+
+	templateConfig, err := s.GetXrayConfigTemplate()
+	if err != nil {
+		return err
+	}
+	template := map[string]any{}
+	if err := json.Unmarshal([]byte(templateConfig), &template); err != nil {
+		return err
+	}
+	policy, _ := template["policy"].(map[string]any)
+	if policy == nil {
+		policy = map[string]any{}
+	}
+	policy["levels"] = levels
+	template["policy"] = policy
+
+	data, err := json.MarshalIndent(template, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.SaveXraySetting(string(data))
+}
+
+// checkClientLevels checks the clients of an inbound are assigned to policy levels the Xray
+// template defines. Level 0 is always valid as Xray falls back to its defaults.
+func (s *InboundService) checkClientLevels(inbound *model.Inbound) error {
+	clients, err := s.GetClients(inbound)
+	if err != nil {
+		return err
+	}
+	var levels map[string]*entity.PolicyLevel
+	for _, client := range clients {
+		if client.Level == 0 {
+			continue
+		}
+		if levels == nil {
+			settingService := SettingService{}
+			if levels, err = settingService.GetPolicyLevels(); err != nil {
+				return err
+			}
+		}
+		if _, ok := levels[strconv.Itoa(client.Level)]; !ok {
+			return common.NewError("policy level not defined:", client.Level)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+)
+
+// portHopAttempts bounds the random picks when looking for a free port in the hop range.
+const portHopAttempts = 20
+
+// parsePortHopRange parses a port range like 20000-30000.
+func parsePortHopRange(portRange string) (int, int, error) {
+	from, to, ok := strings.Cut(strings.TrimSpace(portRange), "-")
+	if !ok {
+		return 0, 0, common.NewError("invalid port hop range:", portRange)
+	}
+	start, err1 := strconv.Atoi(strings.TrimSpace(from))
+	end, err2 := strconv.Atoi(strings.TrimSpace(to))
+	if err1 != nil || err2 != nil || start < 1 || end > 65535 || start >= end {
+		return 0, 0, common.NewError("invalid port hop range:", portRange)
+	}
+	return start, end, nil
+}
+
+func checkPortHop(inbound *model.Inbound) error {
+	inbound.PortHopRange = strings.TrimSpace(inbound.PortHopRange)
+	if inbound.PortHopRange == "" {
+		return nil
+	}
+	if _, _, err := parsePortHopRange(inbound.PortHopRange); err != nil {
+		return err
+	}
+	if inbound.PortHopInterval < 1 {
+		return common.NewError("invalid port hop interval:", inbound.PortHopInterval)
+	}
+	return nil
+}
+
+// HopPorts moves every enabled inbound whose hop interval has passed to a random free port in its range.
+// The running Xray is updated through its API and the firewall rules follow the new ports.
+// Subscriptions are generated from the stored port, so they follow right away.
+// Returns whether Xray needs restart.
+func (s *InboundService) HopPorts() (bool, error) {
+	db := database.GetDB()
+	var inbounds []*model.Inbound
+	err := db.Model(model.Inbound{}).Where("enable = ? AND port_hop_range != '' AND port_hop_interval > 0", true).Find(&inbounds).Error
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	needRestart := false
+	hopped := false
+	for _, inbound := range inbounds {
+		if now.Sub(time.UnixMilli(inbound.PortHopAt)) < time.Duration(inbound.PortHopInterval)*time.Minute {
+			continue
+		}
+		restart, err := s.hopInboundPort(inbound)
+		needRestart = needRestart || restart
+		if err != nil {
+			logger.Warningf("Port hop of inbound %d failed: %v", inbound.Id, err)
+			continue
+		}
+		hopped = true
+	}
+	if hopped {
+		var firewallService FirewallService
+		if err := firewallService.Apply(); err != nil {
+			logger.Warning("Apply firewall rules after port hop failed:", err)
+		}
+	}
+	return needRestart, nil
+}
+
+func (s *InboundService) hopInboundPort(inbound *model.Inbound) (bool, error) {
+	start, end, err := parsePortHopRange(inbound.PortHopRange)
+	if err != nil {
+		return false, err
+	}
+	port, err := s.pickHopPort(inbound, start, end)
+	if err != nil {
+		return false, err
+	}
+
+	oldPort, oldTag := inbound.Port, inbound.Tag
+	inbound.Port = port
+	if inbound.Listen == "" || inbound.Listen == "0.0.0.0" || inbound.Listen == "::" || inbound.Listen == "::0" {
+		inbound.Tag = fmt.Sprintf("inbound-%v", inbound.Port)
+	} else {
+		inbound.Tag = fmt.Sprintf("inbound-%v:%v", inbound.Listen, inbound.Port)
+	}
+	inbound.PortHopAt = time.Now().UnixMilli()
+
+	db := database.GetDB()
+	err = db.Model(inbound).Updates(map[string]any{
+		"port":        inbound.Port,
+		"tag":         inbound.Tag,
+		"port_hop_at": inbound.PortHopAt,
+	}).Error
+	if err != nil {
+		return false, err
+	}
+
+	needRestart := false
+	s.xrayApi.Init(coreAPIPort())
+	if s.xrayApi.DelInbound(oldTag) == nil {
+		logger.Debug("Old inbound deleted by api:", oldTag)
+	}
+	if err := s.addInboundByApi(inbound); err != nil {
+		logger.Debug("Unable to add hopped inbound by api:", err)
+		needRestart = true
+	}
+	s.xrayApi.Close()
+
+	logger.Infof("Inbound %d hopped from port %d to %d", inbound.Id, oldPort, port)
+	return needRestart, nil
+}
+
+// pickHopPort picks a random port in the range that differs from the current one,
+// is not used by another inbound and is not bound by another process.
+func (s *InboundService) pickHopPort(inbound *model.Inbound, start int, end int) (int, error) {
+	for range portHopAttempts {
+		port := start + rand.IntN(end-start+1)
+		if port == inbound.Port {
+			continue
+		}
+		exist, err := s.checkPortExist(inbound.Listen, port, inbound.Id)
+		if err != nil {
+			return 0, err
+		}
+		if exist {
+			continue
+		}
+		listener, err := net.Listen("tcp", net.JoinHostPort(inbound.Listen, strconv.Itoa(port)))
+		if err != nil {
+			continue
+		}
+		listener.Close()
+		return port, nil
+	}
+	return 0, common.NewError("no free port found in", inbound.PortHopRange)
+}
@@ -0,0 +1,323 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/util/link"
+	"github.com/mhsanaei/3x-ui/v2/util/random"
+	"github.com/mhsanaei/3x-ui/v2/util/redis"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+)
+
+const (
+	portalCodeTTL         = 5 * time.Minute
+	portalCodeMaxAttempts = 5
+	// portalCodeResendDelay is how long a client waits before another code is sent.
+	portalCodeResendDelay = time.Minute
+	// portalCodeWindow is how long wrong codes are counted, across resent codes, after the first
+	// code was sent. Once too many were entered no code is sent or accepted until it ends.
+	portalCodeWindow = 30 * time.Minute
+)
+
+// portalCode is a pending one-time login code of the self-service portal, with the wrong codes
+// entered for the client since its first code was sent. It is kept in the shared store, so a code
+// sent by one panel replica is accepted by every other.
+type portalCode struct {
+	Code      string    `json:"code"`
+	SubId     string    `json:"subId"`
+	SentAt    time.Time `json:"sentAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Attempts  int       `json:"attempts"`
+	WindowEnd time.Time `json:"windowEnd"`
+}
+
+// ttl returns how long the code is kept, until both the code and the window of its attempts ended.
+func (p *portalCode) ttl(now time.Time) time.Duration {
+	end := p.ExpiresAt
+	if p.WindowEnd.After(end) {
+		end = p.WindowEnd
+	}
+	return end.Sub(now)
+}
+
+// portalCodeKey returns the shared store key of the pending code of a client.
+func portalCodeKey(email string) string {
+	return "portal:code:" + email
+}
+
+// PortalService provides the self-service portal where clients view and manage their own configs.
+// Clients are identified by their subscription ID; every client sharing it belongs to the same customer.
+type PortalService struct {
+	inboundService      InboundService
+	settingService      SettingService
+	announcementService AnnouncementService
+	voucherService      VoucherService
+	tgbot               Tgbot
+}
+
+// GetPortalInfo returns the usage and config links of all clients with the given subscription ID.
+func (s *PortalService) GetPortalInfo(subId string, host string) (*entity.PortalInfo, error) {
+	inbounds, clients, err := s.findClients(subId)
+	if err != nil {
+		return nil, err
+	}
+	remarkOptions, err := s.settingService.GetRemarkOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	info := &entity.PortalInfo{SubId: subId}
+	if subEnable, _ := s.settingService.GetSubEnable(); subEnable {
+		if subURI, _ := s.settingService.GetSubURI(); subURI != "" {
+			info.SubURL = subURI + subId
+		}
+	}
+	for i, client := range clients {
+		inbound := inbounds[i]
+		portalClient := entity.PortalClient{
+			Email:      client.Email,
+			Enable:     client.Enable,
+			Remark:     inbound.Remark,
+			Protocol:   string(inbound.Protocol),
+			Total:      client.TotalGB,
+			ExpiryTime: client.ExpiryTime,
+		}
+		for _, traffic := range inbound.ClientStats {
+			if traffic.Email == client.Email {
+				portalClient.Enable = portalClient.Enable && traffic.Enable
+				portalClient.Up = traffic.Up
+				portalClient.Down = traffic.Down
+				portalClient.ExpiryTime = traffic.ExpiryTime
+				portalClient.ExpiryPending = traffic.ExpiryTime < 0
+				portalClient.Paused = traffic.PausedAt > 0
+				break
+			}
+		}
+		if inbound.Enable {
+			portalClient.Link = link.Generate(inbound, client.Email, link.Options{Address: host, Remark: remarkOptions.Func()})
+		}
+		info.Clients = append(info.Clients, portalClient)
+	}
+	info.Announcements, err = s.announcementService.GetActiveAnnouncements()
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// findClients returns the clients with the given subscription ID together with their inbounds.
+func (s *PortalService) findClients(subId string) ([]*model.Inbound, []model.Client, error) {
+	if subId == "" {
+		return nil, nil, common.NewCodeError(common.ErrCodeNotFound, nil, "subscription not found")
+	}
+	subInbounds, err := s.inboundService.GetInboundsBySubId(subId)
+	if err != nil {
+		return nil, nil, err
+	}
+	var inbounds []*model.Inbound
+	var clients []model.Client
+	for _, inbound := range subInbounds {
+		inboundClients, err := s.inboundService.GetClients(inbound)
+		if err != nil {
+			continue
+		}
+		for _, client := range inboundClients {
+			if client.SubID == subId {
+				inbounds = append(inbounds, inbound)
+				clients = append(clients, client)
+			}
+		}
+	}
+	if len(clients) == 0 {
+		return nil, nil, common.NewCodeError(common.ErrCodeNotFound, nil, "subscription not found")
+	}
+	return inbounds, clients, nil
+}
+
+// CheckSubId verifies that a subscription ID belongs to at least one client.
+func (s *PortalService) CheckSubId(subId string) error {
+	_, _, err := s.findClients(subId)
+	return err
+}
+
+// SendLoginCode sends a one-time login code to the Telegram account linked to a client.
+// Unknown emails and clients without Telegram account fail with the same error to avoid leaking which exist.
+// A client gets at most one code per portalCodeResendDelay, and none once too many wrong codes were entered.
+func (s *PortalService) SendLoginCode(email string) error {
+	notFound := common.NewError("no Telegram account is linked to this client")
+	if !s.tgbot.IsRunning() {
+		return common.NewError("Telegram bot is not running")
+	}
+	_, client, err := s.inboundService.GetClientByEmail(strings.TrimSpace(email))
+	if err != nil || client == nil || client.TgID == 0 || client.SubID == "" {
+		return notFound
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+
+	err = redis.SharedStore().Update(portalCodeKey(client.Email), func(value []byte) ([]byte, time.Duration, error) {
+		now := time.Now()
+		next := &portalCode{
+			Code:      code,
+			SubId:     client.SubID,
+			SentAt:    now,
+			ExpiresAt: now.Add(portalCodeTTL),
+			WindowEnd: now.Add(portalCodeWindow),
+		}
+		pending := &portalCode{}
+		if value != nil && json.Unmarshal(value, pending) == nil {
+			if pending.Attempts >= portalCodeMaxAttempts {
+				return nil, 0, common.NewError("too many wrong codes, try again later")
+			}
+			if now.Sub(pending.SentAt) < portalCodeResendDelay {
+				return nil, 0, common.NewError("a code was sent recently, try again in a minute")
+			}
+			next.Attempts = pending.Attempts
+			next.WindowEnd = pending.WindowEnd
+		}
+		value, err := json.Marshal(next)
+		return value, next.ttl(now), err
+	})
+	if err != nil {
+		return err
+	}
+
+	s.tgbot.SendMsgToTgbot(client.TgID, fmt.Sprintf("Your portal login code: <code>%s</code>\nIt expires in %d minutes.", code, int(portalCodeTTL.Minutes())))
+	return nil
+}
+
+// CheckLoginCode verifies a one-time login code and returns the subscription ID it grants access to.
+// A code can be used once. After too many wrong attempts, counted across resent codes, no code is
+// accepted until the attempt window ends.
+func (s *PortalService) CheckLoginCode(email string, code string) (string, error) {
+	invalid := common.NewError("invalid or expired code")
+	subId := ""
+	err := redis.SharedStore().Update(portalCodeKey(strings.TrimSpace(email)), func(value []byte) ([]byte, time.Duration, error) {
+		now := time.Now()
+		subId = ""
+		pending := &portalCode{}
+		if value == nil || json.Unmarshal(value, pending) != nil {
+			return nil, 0, invalid
+		}
+		if pending.Attempts >= portalCodeMaxAttempts {
+			return nil, 0, common.NewError("too many wrong codes, try again later")
+		}
+		if now.After(pending.ExpiresAt) {
+			return nil, 0, invalid
+		}
+		if subtle.ConstantTimeCompare([]byte(pending.Code), []byte(strings.TrimSpace(code))) != 1 {
+			pending.Attempts++
+			value, err := json.Marshal(pending)
+			if err != nil {
+				return nil, 0, err
+			}
+			// Stored with the wrong attempt counted, but still reported as invalid below
+			return value, pending.ttl(now), nil
+		}
+		subId = pending.SubId
+		return nil, 0, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if subId == "" {
+		return "", invalid
+	}
+	return subId, nil
+}
+
+// RedeemVoucher redeems a voucher for the customer with the given subscription ID. With an email the
+// voucher extends that client, which must belong to the subscription, otherwise it creates a new
+// client in the subscription. Returns the outcome and whether Xray needs restart.
+func (s *PortalService) RedeemVoucher(subId string, code string, email string) (*entity.VoucherRedemption, bool, error) {
+	_, clients, err := s.findClients(subId)
+	if err != nil {
+		return nil, false, err
+	}
+	preset := ClientPreset{SubID: subId}
+	for _, client := range clients {
+		if email != "" && client.Email == email {
+			return s.voucherService.RedeemVoucher(code, email, preset, "portal")
+		}
+		if preset.TgID == 0 {
+			preset.TgID = client.TgID
+		}
+	}
+	if email != "" {
+		return nil, false, common.NewCodeError(common.ErrCodeClientNotFound, map[string]any{"email": email}, "Client Not Found For Email:", email)
+	}
+	return s.voucherService.RedeemVoucher(code, "", preset, "portal")
+}
+
+// RotateCredentials replaces the UUIDs or passwords of all clients with the given subscription ID.
+// Old config links stop working; the subscription ID and traffic counters are kept.
+// Returns whether Xray needs restart.
+func (s *PortalService) RotateCredentials(subId string) (bool, error) {
+	inbounds, clients, err := s.findClients(subId)
+	if err != nil {
+		return false, err
+	}
+	needRestart := false
+	for i, inbound := range inbounds {
+		oldClient := clients[i]
+
+		var settings map[string]any
+		if err := json.Unmarshal([]byte(inbound.Settings), &settings); err != nil {
+			return needRestart, err
+		}
+		rawClients, _ := settings["clients"].([]any)
+		var rawClient map[string]any
+		for _, c := range rawClients {
+			if m, ok := c.(map[string]any); ok && m["email"] == oldClient.Email {
+				rawClient = m
+				break
+			}
+		}
+		if rawClient == nil {
+			continue
+		}
+
+		clientId := oldClient.ID
+		switch inbound.Protocol {
+		case model.VMESS, model.VLESS:
+			rawClient["id"] = uuid.New().String()
+		case model.Trojan:
+			clientId = oldClient.Password
+			rawClient["password"] = random.Seq(10)
+		case model.Shadowsocks:
+			clientId = oldClient.Email
+			password, err := shadowsocksClientPassword(inbound)
+			if err != nil {
+				return needRestart, err
+			}
+			rawClient["password"] = password
+		default:
+			continue
+		}
+		rawClient["updated_at"] = time.Now().UnixMilli()
+
+		data, err := json.Marshal(map[string][]any{"clients": {rawClient}})
+		if err != nil {
+			return needRestart, err
+		}
+		restart, err := s.inboundService.UpdateInboundClient(&model.Inbound{Id: inbound.Id, Settings: string(data)}, clientId)
+		needRestart = needRestart || restart
+		if err != nil {
+			return needRestart, err
+		}
+	}
+	return needRestart, nil
+}
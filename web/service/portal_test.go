@@ -0,0 +1,62 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/dbtest"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+)
+
+func TestFindClients(t *testing.T) {
+	dbtest.Setup(t)
+	// Disabled inbounds are listed in the portal too
+	if err := database.GetDB().Model(model.Inbound{}).Where("port = ?", 10003).Update("enable", false).Error; err != nil {
+		t.Fatal(err)
+	}
+	s := &PortalService{}
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, subId := range []string{dbtest.SubId(0), dbtest.SubId(dbtest.Subs - 1)} {
+		// The clients of the subscription as found by scanning all inbounds
+		var wantInbounds []int
+		var wantEmails []string
+		for _, inbound := range inbounds {
+			clients, err := s.inboundService.GetClients(inbound)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, client := range clients {
+				if client.SubID == subId {
+					wantInbounds = append(wantInbounds, inbound.Id)
+					wantEmails = append(wantEmails, client.Email)
+				}
+			}
+		}
+
+		gotInbounds, gotClients, err := s.findClients(subId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(gotClients) != len(wantEmails) {
+			t.Fatalf("%s: got %d clients, want %d", subId, len(gotClients), len(wantEmails))
+		}
+		for i, client := range gotClients {
+			if client.Email != wantEmails[i] || gotInbounds[i].Id != wantInbounds[i] {
+				t.Errorf("%s: client %d is %s of inbound %d, want %s of inbound %d", subId, i, client.Email, gotInbounds[i].Id, wantEmails[i], wantInbounds[i])
+			}
+			if len(gotInbounds[i].ClientStats) != 1 || gotInbounds[i].ClientStats[0].Email != client.Email {
+				t.Errorf("%s: inbound %d is loaded with %d traffics, want only the one of %s", subId, gotInbounds[i].Id, len(gotInbounds[i].ClientStats), client.Email)
+			}
+		}
+	}
+
+	_, _, err = s.findClients("missing")
+	if code, _ := common.GetErrorCode(err); code != common.ErrCodeNotFound {
+		t.Errorf("unknown subscription: got %v, want a not found error", err)
+	}
+}
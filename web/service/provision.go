@@ -0,0 +1,200 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/util/random"
+)
+
+// ClientPreset describes a client created with generated credentials, as used by deposit tokens and plans.
+type ClientPreset struct {
+	Email      string // Client email, random when empty
+	TotalGB    int64  // Traffic quota in bytes, 0 for unlimited
+	ExpiryDays int    // Validity in days counted from creation, 0 for unlimited
+	LimitIP    int    // IP limit, 0 for unlimited
+	TgID       int64  // Telegram user ID for notifications
+	Comment    string // Client comment
+	SubID      string // Subscription ID, random when empty
+	Referral   string // Referral code the client is attributed to, none when empty
+}
+
+// AddPresetClient creates a client with generated credentials on an inbound.
+// Returns the refreshed inbound, the created client and whether Xray needs restart.
+func (s *InboundService) AddPresetClient(inboundId int, preset ClientPreset) (*model.Inbound, *model.Client, bool, error) {
+	inbound, err := s.GetInbound(inboundId)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	email := strings.TrimSpace(preset.Email)
+	if email == "" {
+		email = strings.ToLower(random.Seq(10))
+	}
+	client := model.Client{
+		Email:   email,
+		LimitIP: preset.LimitIP,
+		TotalGB: preset.TotalGB,
+		Enable:  true,
+		TgID:    preset.TgID,
+		SubID:   preset.SubID,
+		Comment: preset.Comment,
+	}
+	if client.SubID == "" {
+		client.SubID = random.Seq(16)
+	}
+	if preset.ExpiryDays > 0 {
+		client.ExpiryTime = time.Now().AddDate(0, 0, preset.ExpiryDays).UnixMilli()
+	}
+	if err := generateClientCredentials(inbound, &client); err != nil {
+		return nil, nil, false, err
+	}
+
+	settings, err := json.Marshal(map[string][]model.Client{"clients": {client}})
+	if err != nil {
+		return nil, nil, false, err
+	}
+	needRestart, err := s.AddInboundClient(&model.Inbound{
+		Id:       inbound.Id,
+		Settings: string(settings),
+	})
+	if err != nil {
+		return nil, nil, false, err
+	}
+	recordReferral(preset.Referral, client.Email)
+
+	inbound, err = s.GetInbound(inbound.Id)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return inbound, &client, needRestart, nil
+}
+
+// generateClientCredentials sets a new ID or password on a client of the inbound.
+func generateClientCredentials(inbound *model.Inbound, client *model.Client) error {
+	var err error
+	switch inbound.Protocol {
+	case model.VMESS:
+		client.ID = uuid.New().String()
+		client.Security = "auto"
+	case model.VLESS:
+		client.ID = uuid.New().String()
+	case model.Trojan:
+		client.Password = random.Seq(10)
+	case model.Shadowsocks:
+		client.Password, err = shadowsocksClientPassword(inbound)
+	default:
+		err = common.NewError("preset clients are not supported for protocol:", inbound.Protocol)
+	}
+	return err
+}
+
+// checkPresetInbound verifies that preset clients can be created on an inbound.
+func (s *InboundService) checkPresetInbound(inboundId int) error {
+	inbound, err := s.GetInbound(inboundId)
+	if err != nil {
+		return err
+	}
+	switch inbound.Protocol {
+	case model.VMESS, model.VLESS, model.Trojan, model.Shadowsocks:
+		return nil
+	}
+	return common.NewError("preset clients are not supported for protocol:", inbound.Protocol)
+}
+
+// shadowsocksClientPassword generates a client password matching the inbound's method.
+// Shadowsocks 2022 methods need a base64 key of the cipher's key length.
+func shadowsocksClientPassword(inbound *model.Inbound) (string, error) {
+	var settings struct {
+		Method string `json:"method"`
+	}
+	if err := json.Unmarshal([]byte(inbound.Settings), &settings); err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(settings.Method, "2022-blake3-") {
+		return random.Seq(10), nil
+	}
+	key := make([]byte, 32)
+	if settings.Method == "2022-blake3-aes-128-gcm" {
+		key = key[:16]
+	}
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// ExtendClient adds days to the validity and bytes to the traffic quota of a client. Days are
+// counted from now when the client already expired and added to the waiting period when its
+// expiry starts at first use. A client without expiry or without traffic quota can not be
+// extended in that dimension. Returns whether Xray needs restart.
+func (s *InboundService) ExtendClient(email string, days int, traffic int64) (bool, error) {
+	if days < 0 || traffic < 0 {
+		return false, common.NewCodeError(common.ErrCodeValidation, nil, "extension values can not be negative")
+	}
+	_, client, err := s.GetClientByEmail(email)
+	if err != nil {
+		return false, err
+	}
+	_, inbound, err := s.GetClientInboundByEmail(email)
+	if err != nil {
+		return false, err
+	}
+
+	var settings map[string]any
+	if err := json.Unmarshal([]byte(inbound.Settings), &settings); err != nil {
+		return false, err
+	}
+	rawClients, _ := settings["clients"].([]any)
+	var rawClient map[string]any
+	for _, c := range rawClients {
+		if m, ok := c.(map[string]any); ok && m["email"] == email {
+			rawClient = m
+			break
+		}
+	}
+	if rawClient == nil {
+		return false, common.NewCodeError(common.ErrCodeClientNotFound, map[string]any{"email": email}, "Client Not Found For Email:", email)
+	}
+
+	if days > 0 {
+		duration := int64(days) * 24 * 60 * 60000
+		now := time.Now().UnixMilli()
+		switch {
+		case client.ExpiryTime == 0:
+			return false, common.NewCodeError(common.ErrCodeValidation, map[string]any{"email": email}, "client does not expire:", email)
+		case client.ExpiryTime < 0:
+			rawClient["expiryTime"] = client.ExpiryTime - duration
+		case client.ExpiryTime < now:
+			rawClient["expiryTime"] = now + duration
+		default:
+			rawClient["expiryTime"] = client.ExpiryTime + duration
+		}
+	}
+	if traffic > 0 {
+		if client.TotalGB == 0 {
+			return false, common.NewCodeError(common.ErrCodeValidation, map[string]any{"email": email}, "client has no traffic quota:", email)
+		}
+		rawClient["totalGB"] = client.TotalGB + traffic
+	}
+	rawClient["updated_at"] = time.Now().UnixMilli()
+
+	clientId := client.ID
+	switch inbound.Protocol {
+	case model.Trojan:
+		clientId = client.Password
+	case model.Shadowsocks:
+		clientId = client.Email
+	}
+	data, err := json.Marshal(map[string][]any{"clients": {rawClient}})
+	if err != nil {
+		return false, err
+	}
+	return s.UpdateInboundClient(&model.Inbound{Id: inbound.Id, Settings: string(data)}, clientId)
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"html"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+)
+
+// publicIPGeneration counts the public IP changes found, so cached addresses can be dropped.
+var publicIPGeneration atomic.Int64
+
+// PublicIPService detects changes of the server's public IP address. On a change it updates the
+// configured DDNS record, replaces the old address where inbounds and subscription settings embed
+// it, calls the change webhook and notifies the Telegram admins.
+type PublicIPService struct {
+	settingService SettingService
+	xrayService    XrayService
+	tgbot          Tgbot
+}
+
+// detectPublicIP asks the given services for the public address and returns the first valid answer.
+func detectPublicIP(services []string) string {
+	for _, service := range services {
+		if ip := net.ParseIP(getPublicIP(service)); ip != nil {
+			return ip.String()
+		}
+	}
+	return ""
+}
+
+// CheckPublicIP detects the public IPv4 and IPv6 address and handles a change since the last check.
+// The first check only records the addresses.
+func (s *PublicIPService) CheckPublicIP() (*entity.PublicIPCheck, error) {
+	check := &entity.PublicIPCheck{
+		IPv4: detectPublicIP(publicIPv4Services),
+		IPv6: detectPublicIP(publicIPv6Services),
+	}
+	if check.IPv4 == "" && check.IPv6 == "" {
+		return check, common.NewError("public IP could not be detected")
+	}
+	var err error
+	if check.OldIPv4, err = s.settingService.GetPublicIPv4(); err != nil {
+		return check, err
+	}
+	if check.OldIPv6, err = s.settingService.GetPublicIPv6(); err != nil {
+		return check, err
+	}
+
+	// An address that could not be detected this time is kept rather than treated as a change
+	changedIPv4 := check.IPv4 != "" && check.IPv4 != check.OldIPv4
+	changedIPv6 := check.IPv6 != "" && check.IPv6 != check.OldIPv6
+	if !changedIPv4 && !changedIPv6 {
+		return check, nil
+	}
+	if changedIPv4 {
+		if err := s.settingService.SetPublicIPv4(check.IPv4); err != nil {
+			return check, err
+		}
+	}
+	if changedIPv6 {
+		if err := s.settingService.SetPublicIPv6(check.IPv6); err != nil {
+			return check, err
+		}
+	}
+	if (!changedIPv4 || check.OldIPv4 == "") && (!changedIPv6 || check.OldIPv6 == "") {
+		// First detection of the addresses, nothing to update yet
+		return check, nil
+	}
+	changedIPv4 = changedIPv4 && check.OldIPv4 != ""
+	changedIPv6 = changedIPv6 && check.OldIPv6 != ""
+	check.Changed = true
+	publicIPGeneration.Add(1)
+
+	ddnsIPv4, ddnsIPv6 := "", ""
+	if changedIPv4 {
+		ddnsIPv4 = check.IPv4
+		s.replaceAddress(check, check.OldIPv4, check.IPv4)
+	}
+	if changedIPv6 {
+		ddnsIPv6 = check.IPv6
+		s.replaceAddress(check, check.OldIPv6, check.IPv6)
+	}
+	var errs []string
+	if err := s.updateDDNS(ddnsIPv4, ddnsIPv6); err != nil {
+		logger.Warning("DDNS update failed:", err)
+		errs = append(errs, err.Error())
+	} else if provider, _ := s.settingService.GetDdnsProvider(); provider != "" {
+		check.DdnsUpdated = true
+	}
+	if err := s.callWebhook(check); err != nil {
+		logger.Warning("IP change webhook failed:", err)
+		errs = append(errs, err.Error())
+	}
+	check.Errors = errs
+
+	s.notify(check, changedIPv4, changedIPv6)
+	return check, nil
+}
+
+// replaceAddress replaces the old address with the new one in the inbound listen addresses and external
+// proxies, and in the subscription domain and URIs, so generated subscriptions carry the new address.
+func (s *PublicIPService) replaceAddress(check *entity.PublicIPCheck, oldIP string, newIP string) {
+	if oldIP == "" {
+		return
+	}
+	db := database.GetDB()
+	var inbounds []*model.Inbound
+	if err := db.Model(model.Inbound{}).Find(&inbounds).Error; err != nil {
+		logger.Warning("IP change: get inbounds failed:", err)
+		return
+	}
+	needRestart := false
+	for _, inbound := range inbounds {
+		changed := false
+		if inbound.Listen == oldIP {
+			inbound.Listen = newIP
+			changed = true
+			needRestart = true
+		}
+		if stream, ok := replaceExternalProxy(inbound.StreamSettings, oldIP, newIP); ok {
+			inbound.StreamSettings = stream
+			changed = true
+		}
+		if !changed {
+			continue
+		}
+		if err := db.Model(model.Inbound{}).Where("id = ?", inbound.Id).
+			Updates(map[string]any{"listen": inbound.Listen, "stream_settings": inbound.StreamSettings}).Error; err != nil {
+			logger.Warning("IP change: update inbound", inbound.Id, "failed:", err)
+			continue
+		}
+		check.UpdatedInbounds = append(check.UpdatedInbounds, inbound.Id)
+	}
+	if needRestart {
+		s.xrayService.SetToNeedRestart()
+	}
+
+	for _, key := range []string{"subDomain", "subURI", "subJsonURI"} {
+		value, err := s.settingService.getString(key)
+		if err != nil || !strings.Contains(value, oldIP) {
+			continue
+		}
+		if key == "subDomain" && value != oldIP {
+			continue
+		}
+		if err := s.settingService.setString(key, strings.ReplaceAll(value, oldIP, newIP)); err != nil {
+			logger.Warning("IP change: update", key, "failed:", err)
+			continue
+		}
+		check.UpdatedSettings = append(check.UpdatedSettings, key)
+	}
+}
+
+// replaceExternalProxy replaces the old address in the external proxy destinations of the stream settings.
+func replaceExternalProxy(streamSettings string, oldIP string, newIP string) (string, bool) {
+	if !strings.Contains(streamSettings, oldIP) {
+		return streamSettings, false
+	}
+	stream := map[string]any{}
+	if err := json.Unmarshal([]byte(streamSettings), &stream); err != nil {
+		return streamSettings, false
+	}
+	proxies, _ := stream["externalProxy"].([]any)
+	changed := false
+	for _, proxy := range proxies {
+		if p, ok := proxy.(map[string]any); ok && p["dest"] == oldIP {
+			p["dest"] = newIP
+			changed = true
+		}
+	}
+	if !changed {
+		return streamSettings, false
+	}
+	data, err := json.MarshalIndent(stream, "", "  ")
+	if err != nil {
+		return streamSettings, false
+	}
+	return string(data), true
+}
+
+// callWebhook posts the change to the configured webhook URL as JSON.
+func (s *PublicIPService) callWebhook(check *entity.PublicIPCheck) error {
+	webhook, err := s.settingService.GetIpChangeWebhook()
+	if err != nil || webhook == "" {
+		return err
+	}
+	data, err := json.Marshal(check)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(webhook, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return common.NewErrorf("IP change webhook answered %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// notify logs the change and reports it to the Telegram admins.
+func (s *PublicIPService) notify(check *entity.PublicIPCheck, changedIPv4 bool, changedIPv6 bool) {
+	msg := ""
+	if changedIPv4 {
+		msg += s.tgbot.I18nBot("tgbot.messages.publicIpChanged", "Old=="+check.OldIPv4, "New=="+check.IPv4)
+	}
+	if changedIPv6 {
+		msg += s.tgbot.I18nBot("tgbot.messages.publicIpChanged", "Old=="+check.OldIPv6, "New=="+check.IPv6)
+	}
+	if check.DdnsUpdated {
+		msg += s.tgbot.I18nBot("tgbot.messages.ddnsUpdated")
+	}
+	for _, e := range check.Errors {
+		msg += s.tgbot.I18nBot("tgbot.messages.ipChangeFailed", "Error=="+html.EscapeString(e))
+	}
+	logger.Warning(msg)
+	if s.tgbot.IsRunning() {
+		s.tgbot.SendMsgToTgbotAdmins(msg)
+	}
+}
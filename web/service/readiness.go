@@ -0,0 +1,42 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+)
+
+// CheckReadiness reports whether the panel can serve clients: the database answers, Xray is
+// running and the Xray configuration can be generated from the stored inbounds and template.
+func (s *ServerService) CheckReadiness() *entity.Readiness {
+	readiness := &entity.Readiness{Ready: true}
+	check := func(name string, err error) {
+		result := entity.ReadinessCheck{Name: name, Ok: err == nil}
+		if err != nil {
+			result.Error = strings.TrimSpace(err.Error())
+			readiness.Ready = false
+		}
+		readiness.Checks = append(readiness.Checks, result)
+	}
+
+	check("database", database.GetDB().Exec("SELECT 1").Error)
+
+	var xrayErr error
+	if !s.xrayService.IsXrayRunning() {
+		xrayErr = s.xrayService.GetXrayErr()
+		if xrayErr == nil {
+			xrayErr = common.NewError("xray is not running")
+		}
+	}
+	check("xray", xrayErr)
+
+	config, err := s.xrayService.GetXrayConfig()
+	if err == nil {
+		_, err = json.Marshal(config)
+	}
+	check("config", err)
+	return readiness
+}
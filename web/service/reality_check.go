@@ -0,0 +1,270 @@
+package service
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"html"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+)
+
+const (
+	// realityCheckTimeout bounds the connection and handshake with a target.
+	realityCheckTimeout = 10 * time.Second
+	// realityCheckFailures is the number of consecutive failed checks before a target counts as bad.
+	realityCheckFailures = 2
+)
+
+var (
+	realityCheckLock sync.Mutex
+	realityChecks    = map[int]*entity.RealityCheck{}
+)
+
+// RealityCheckService checks that the targets of the REALITY inbounds still complete a TLS 1.3
+// handshake for their server names in time and are not on the blocked list. Targets failing in
+// a row are reported to the Telegram admins and, when enabled, replaced with the first healthy
+// fallback target.
+type RealityCheckService struct {
+	settingService SettingService
+	tgbot          Tgbot
+}
+
+// realityStream is the part of the stream settings of a REALITY inbound the check needs.
+type realityStream struct {
+	Security        string `json:"security"`
+	RealitySettings struct {
+		Target      string   `json:"target"`
+		Dest        string   `json:"dest"` // Name of the target in older configs
+		ServerNames []string `json:"serverNames"`
+	} `json:"realitySettings"`
+}
+
+// target returns the target address of the stream, with port 443 when it has none.
+func (s *realityStream) target() string {
+	target := s.RealitySettings.Target
+	if target == "" {
+		target = s.RealitySettings.Dest
+	}
+	if _, _, err := net.SplitHostPort(target); err != nil && target != "" {
+		target = net.JoinHostPort(target, "443")
+	}
+	return target
+}
+
+// serverName returns the first server name of the stream, or the host of its target.
+func (s *realityStream) serverName() string {
+	for _, name := range s.RealitySettings.ServerNames {
+		if name != "" {
+			return name
+		}
+	}
+	host, _, _ := net.SplitHostPort(s.target())
+	return host
+}
+
+// isBlockedDomain reports whether the host is one of the blocked domains or below one of them.
+func isBlockedDomain(host string, blocked []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, domain := range blocked {
+		domain = strings.ToLower(strings.TrimPrefix(domain, "*."))
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRealityTarget completes a TLS handshake with the target for the server name and checks it
+// negotiates TLS 1.3 with a valid certificate within the latency limit.
+func checkRealityTarget(target string, serverName string, maxLatency int, blocked []string) *entity.RealityCheck {
+	check := &entity.RealityCheck{Target: target, ServerName: serverName, CheckedAt: time.Now().UnixMilli()}
+	host, _, err := net.SplitHostPort(target)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	for _, name := range []string{host, serverName} {
+		if isBlockedDomain(name, blocked) {
+			check.Error = "blocked domain: " + name
+			return check
+		}
+	}
+
+	start := time.Now()
+	dialer := &net.Dialer{Timeout: realityCheckTimeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", target, &tls.Config{
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS13,
+		NextProtos: []string{"h2", "http/1.1"},
+	})
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	conn.Close()
+	check.LatencyMs = time.Since(start).Milliseconds()
+	if maxLatency > 0 && check.LatencyMs > int64(maxLatency) {
+		check.Error = "handshake took " + strconv.FormatInt(check.LatencyMs, 10) + " ms"
+		return check
+	}
+	check.Healthy = true
+	return check
+}
+
+// Check checks the targets of all enabled REALITY inbounds and records the results. Targets that
+// just went bad are reported and, when rotation is enabled, replaced with a healthy fallback.
+// Returns whether Xray needs a restart because a target was replaced.
+func (s *RealityCheckService) Check() (bool, error) {
+	var inbounds []*model.Inbound
+	err := database.GetDB().Model(model.Inbound{}).Where("enable = ? AND stream_settings LIKE ?", true, "%reality%").Find(&inbounds).Error
+	if err != nil {
+		return false, err
+	}
+	maxLatency, err := s.settingService.GetRealityMaxLatency()
+	if err != nil {
+		return false, err
+	}
+	blockedValue, err := s.settingService.GetRealityBlockedDomains()
+	if err != nil {
+		return false, err
+	}
+	blocked := splitTrimmed(blockedValue)
+
+	results := map[int]*entity.RealityCheck{}
+	var resultsLock sync.Mutex
+	var wg sync.WaitGroup
+	for _, inbound := range inbounds {
+		stream := &realityStream{}
+		if json.Unmarshal([]byte(inbound.StreamSettings), stream) != nil || stream.Security != "reality" || stream.target() == "" {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			check := checkRealityTarget(stream.target(), stream.serverName(), maxLatency, blocked)
+			check.InboundId = inbound.Id
+			check.Remark = inbound.Remark
+			resultsLock.Lock()
+			results[inbound.Id] = check
+			resultsLock.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	var failed []*entity.RealityCheck
+	realityCheckLock.Lock()
+	for id, check := range results {
+		if old, ok := realityChecks[id]; ok && !check.Healthy && old.Target == check.Target {
+			check.Failures = old.Failures
+		}
+		if !check.Healthy {
+			check.Failures++
+			if check.Failures == realityCheckFailures {
+				failed = append(failed, check)
+			}
+		}
+	}
+	realityChecks = results
+	realityCheckLock.Unlock()
+
+	needRestart := false
+	for _, check := range failed {
+		fallback := ""
+		if rotate, err := s.settingService.GetRealityAutoRotate(); err == nil && rotate {
+			fallback, err = s.rotate(check.InboundId, maxLatency, blocked)
+			if err != nil {
+				logger.Warning("Unable to rotate the REALITY target of inbound", check.InboundId, ":", err)
+			}
+			needRestart = needRestart || fallback != ""
+		}
+		s.notify(check, fallback)
+	}
+	return needRestart, nil
+}
+
+// rotate replaces the target and server names of an inbound with the first fallback target
+// passing the check. Returns the new target, or an empty string when none passed.
+func (s *RealityCheckService) rotate(inboundId int, maxLatency int, blocked []string) (string, error) {
+	fallbacks, err := s.settingService.GetRealityFallbackTargets()
+	if err != nil {
+		return "", err
+	}
+	db := database.GetDB()
+	inbound := &model.Inbound{}
+	if err := db.First(inbound, inboundId).Error; err != nil {
+		return "", err
+	}
+	stream := map[string]any{}
+	if err := json.Unmarshal([]byte(inbound.StreamSettings), &stream); err != nil {
+		return "", err
+	}
+	reality, _ := stream["realitySettings"].(map[string]any)
+	if reality == nil {
+		return "", common.NewError("inbound has no REALITY settings:", inboundId)
+	}
+	parsed := &realityStream{}
+	json.Unmarshal([]byte(inbound.StreamSettings), parsed)
+	current := parsed.target()
+
+	for _, fallback := range splitTrimmed(fallbacks) {
+		if _, _, err := net.SplitHostPort(fallback); err != nil {
+			fallback = net.JoinHostPort(fallback, "443")
+		}
+		host, _, _ := net.SplitHostPort(fallback)
+		if fallback == current || !checkRealityTarget(fallback, host, maxLatency, blocked).Healthy {
+			continue
+		}
+		reality["target"] = fallback
+		delete(reality, "dest")
+		reality["serverNames"] = []string{host}
+		data, err := json.MarshalIndent(stream, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		if err := db.Model(inbound).Update("stream_settings", string(data)).Error; err != nil {
+			return "", err
+		}
+		realityCheckLock.Lock()
+		delete(realityChecks, inboundId)
+		realityCheckLock.Unlock()
+		return fallback, nil
+	}
+	return "", nil
+}
+
+// notify logs a target that went bad and reports it to the Telegram admins.
+func (s *RealityCheckService) notify(check *entity.RealityCheck, fallback string) {
+	msg := s.tgbot.I18nBot("tgbot.messages.realityTargetFailed",
+		"Inbound=="+html.EscapeString(check.Remark),
+		"Target=="+html.EscapeString(check.Target),
+		"Error=="+html.EscapeString(check.Error))
+	if fallback != "" {
+		msg += s.tgbot.I18nBot("tgbot.messages.realityTargetRotated", "Target=="+html.EscapeString(fallback))
+	}
+	logger.Warning(msg)
+	if s.tgbot.IsRunning() {
+		s.tgbot.SendMsgToTgbotAdmins(msg)
+	}
+}
+
+// GetChecks returns the latest check results of the REALITY inbounds.
+func (s *RealityCheckService) GetChecks() []entity.RealityCheck {
+	realityCheckLock.Lock()
+	defer realityCheckLock.Unlock()
+	checks := make([]entity.RealityCheck, 0, len(realityChecks))
+	for _, check := range realityChecks {
+		checks = append(checks, *check)
+	}
+	slices.SortFunc(checks, func(a, b entity.RealityCheck) int { return a.InboundId - b.InboundId })
+	return checks
+}
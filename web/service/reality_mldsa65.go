@@ -0,0 +1,149 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"os/exec"
+	"strings"
+
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/xray"
+)
+
+// newMldsa65Keys returns an ML-DSA-65 seed and its verify key as the Xray core prints them. A new
+// seed is generated when none is given, otherwise the verify key of the seed is derived, which
+// also checks the seed. Fails when the core has no ML-DSA-65 support.
+func newMldsa65Keys(seed string) (string, string, error) {
+	args := []string{"mldsa65"}
+	if seed != "" {
+		args = append(args, "-i", seed)
+	}
+	cmd := exec.Command(xray.GetBinaryPath(), args...)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return "", "", common.NewError("the Xray core does not support ML-DSA-65 keys or the seed is invalid:", strings.TrimSpace(out.String()), err)
+	}
+	keys := map[string]string{}
+	for _, line := range strings.Split(out.String(), "\n") {
+		name, value, found := strings.Cut(line, ":")
+		if found {
+			keys[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(value)
+		}
+	}
+	if keys["seed"] == "" || keys["verify"] == "" {
+		return "", "", common.NewError("the Xray core does not support ML-DSA-65 keys:", strings.TrimSpace(out.String()))
+	}
+	return keys["seed"], keys["verify"], nil
+}
+
+// getRealitySettings returns the stream settings of an inbound and its reality settings, nil when
+// the inbound does not use REALITY.
+func getRealitySettings(inbound *model.Inbound) (map[string]any, map[string]any, error) {
+	stream := map[string]any{}
+	if inbound.StreamSettings != "" {
+		if err := json.Unmarshal([]byte(inbound.StreamSettings), &stream); err != nil {
+			return nil, nil, common.NewError("stream settings invalid:", err)
+		}
+	}
+	if security, _ := stream["security"].(string); security != "reality" {
+		return stream, nil, nil
+	}
+	reality, _ := stream["realitySettings"].(map[string]any)
+	if reality == nil {
+		reality = map[string]any{}
+		stream["realitySettings"] = reality
+	}
+	return stream, reality, nil
+}
+
+// setMldsa65Keys stores an ML-DSA-65 seed in the reality settings and its verify key in the
+// settings handed to clients. Empty keys remove post-quantum signing.
+func setMldsa65Keys(reality map[string]any, seed string, verify string) {
+	settings, _ := reality["settings"].(map[string]any)
+	if settings == nil {
+		settings = map[string]any{}
+		reality["settings"] = settings
+	}
+	if seed == "" {
+		delete(reality, "mldsa65Seed")
+		delete(settings, "mldsa65Verify")
+		return
+	}
+	reality["mldsa65Seed"] = seed
+	settings["mldsa65Verify"] = verify
+}
+
+// checkRealityMldsa65 checks the ML-DSA-65 seed of a REALITY inbound with the Xray core and sets
+// the verify key clients get to the one of the seed, so a core without post-quantum support or a
+// seed and verify key that do not belong together are caught before Xray fails to start.
+func checkRealityMldsa65(inbound *model.Inbound) error {
+	stream, reality, err := getRealitySettings(inbound)
+	if err != nil || reality == nil {
+		return err
+	}
+	seed, _ := reality["mldsa65Seed"].(string)
+	if seed = strings.TrimSpace(seed); seed == "" {
+		return nil
+	}
+	_, verify, err := newMldsa65Keys(seed)
+	if err != nil {
+		return err
+	}
+	if settings, _ := reality["settings"].(map[string]any); settings != nil && settings["mldsa65Verify"] == verify {
+		return nil
+	}
+	setMldsa65Keys(reality, seed, verify)
+	data, err := json.MarshalIndent(stream, "", "  ")
+	if err != nil {
+		return err
+	}
+	inbound.StreamSettings = string(data)
+	return nil
+}
+
+// setInboundMldsa65 stores new ML-DSA-65 keys in a REALITY inbound. Returns whether Xray needs restart.
+func (s *InboundService) setInboundMldsa65(id int, seed string, verify string) (bool, error) {
+	inbound, err := s.GetInbound(id)
+	if err != nil {
+		return false, err
+	}
+	stream, reality, err := getRealitySettings(inbound)
+	if err != nil {
+		return false, err
+	}
+	if reality == nil {
+		return false, common.NewCodeError(common.ErrCodeValidation, nil, "inbound does not use REALITY:", id)
+	}
+	setMldsa65Keys(reality, seed, verify)
+	data, err := json.MarshalIndent(stream, "", "  ")
+	if err != nil {
+		return false, err
+	}
+	inbound.StreamSettings = string(data)
+	_, needRestart, err := s.UpdateInbound(inbound)
+	return needRestart, err
+}
+
+// RotateInboundMldsa65 generates a new ML-DSA-65 seed for a REALITY inbound, turning on
+// post-quantum signing when it was off. Clients need the new verify key from their links or
+// subscriptions afterwards. Returns the verify key and whether Xray needs restart.
+func (s *InboundService) RotateInboundMldsa65(id int) (string, bool, error) {
+	seed, verify, err := newMldsa65Keys("")
+	if err != nil {
+		return "", false, common.WithCode(common.ErrCodeValidation, err)
+	}
+	needRestart, err := s.setInboundMldsa65(id, seed, verify)
+	if err != nil {
+		return "", needRestart, err
+	}
+	return verify, needRestart, nil
+}
+
+// DelInboundMldsa65 turns off post-quantum signing of a REALITY inbound.
+// Returns whether Xray needs restart.
+func (s *InboundService) DelInboundMldsa65(id int) (bool, error) {
+	return s.setInboundMldsa65(id, "", "")
+}
@@ -0,0 +1,268 @@
+package service
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/util/random"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+
+	"gorm.io/gorm"
+)
+
+// referralCodeRegex matches the characters Telegram allows in a start parameter, so codes can be
+// passed through bot deep links unchanged.
+var referralCodeRegex = regexp.MustCompile(`^[a-z0-9_-]{3,32}$`)
+
+// ReferralService manages referrers and attributes the clients created with their referral code
+// by payments, plans and deposit tokens to them.
+type ReferralService struct {
+	settingService SettingService
+	inboundService InboundService
+}
+
+// normalizeReferralCode makes referral codes case-insensitive.
+func normalizeReferralCode(code string) string {
+	return strings.ToLower(strings.TrimSpace(code))
+}
+
+// GetReferrers returns all referrers.
+func (s *ReferralService) GetReferrers() ([]*model.Referrer, error) {
+	referrers := []*model.Referrer{}
+	err := database.GetDB().Model(model.Referrer{}).Order("id asc").Find(&referrers).Error
+	return referrers, err
+}
+
+// GetReferrer returns a referrer.
+func (s *ReferralService) GetReferrer(id int) (*model.Referrer, error) {
+	referrer := &model.Referrer{}
+	err := database.GetDB().Model(model.Referrer{}).Where("id = ?", id).First(referrer).Error
+	if database.IsNotFound(err) {
+		return nil, common.NewCodeError(common.ErrCodeNotFound, map[string]any{"referrerId": id}, "referrer not found:", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return referrer, nil
+}
+
+func (s *ReferralService) checkReferrer(referrer *model.Referrer) error {
+	referrer.Code = normalizeReferralCode(referrer.Code)
+	if !referralCodeRegex.MatchString(referrer.Code) {
+		return common.NewCodeError(common.ErrCodeValidation, map[string]any{"code": referrer.Code},
+			"a referral code needs 3 to 32 letters, digits, _ or -")
+	}
+	var count int64
+	err := database.GetDB().Model(model.Referrer{}).
+		Where("code = ? AND id != ?", referrer.Code, referrer.Id).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return common.NewCodeError(common.ErrCodeValidation, map[string]any{"code": referrer.Code}, "referral code already in use:", referrer.Code)
+	}
+	return nil
+}
+
+// AddReferrer validates and stores a new referrer, with a random referral code when none is given.
+func (s *ReferralService) AddReferrer(referrer *model.Referrer) error {
+	referrer.Id = 0
+	if strings.TrimSpace(referrer.Code) == "" {
+		referrer.Code = random.Seq(8)
+	}
+	if err := s.checkReferrer(referrer); err != nil {
+		return err
+	}
+	referrer.CreatedAt = time.Now().UnixMilli()
+	return database.GetDB().Create(referrer).Error
+}
+
+// UpdateReferrer validates and updates a referrer. Clients attributed to its old code stay attributed.
+func (s *ReferralService) UpdateReferrer(referrer *model.Referrer) error {
+	if err := s.checkReferrer(referrer); err != nil {
+		return err
+	}
+	result := database.GetDB().Model(model.Referrer{}).Where("id = ?", referrer.Id).
+		Select("code", "name", "enable", "remark").
+		Updates(referrer)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return common.NewCodeError(common.ErrCodeNotFound, map[string]any{"referrerId": referrer.Id}, "referrer not found:", referrer.Id)
+	}
+	return nil
+}
+
+// DelReferrer deletes a referrer and the attribution of its clients. The clients are kept.
+func (s *ReferralService) DelReferrer(id int) error {
+	return database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("referrer_id = ?", id).Delete(model.Referral{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(model.Referrer{}, id).Error
+	})
+}
+
+// GetReferralLink returns the referral link of a referrer from the referral link template.
+func (s *ReferralService) GetReferralLink(id int) (*entity.ReferralLink, error) {
+	referrer, err := s.GetReferrer(id)
+	if err != nil {
+		return nil, err
+	}
+	template, err := s.settingService.GetReferralLinkTemplate()
+	if err != nil {
+		return nil, err
+	}
+	link := &entity.ReferralLink{Code: referrer.Code}
+	if template != "" {
+		link.Link = strings.ReplaceAll(template, "{code}", referrer.Code)
+	}
+	return link, nil
+}
+
+// setReferral attributes a client to a referrer, replacing an earlier attribution of the email.
+func setReferral(tx *gorm.DB, referrerId int, email string) error {
+	if err := tx.Where("email = ?", email).Delete(model.Referral{}).Error; err != nil {
+		return err
+	}
+	return tx.Create(&model.Referral{
+		ReferrerId: referrerId,
+		Email:      email,
+		CreatedAt:  time.Now().UnixMilli(),
+	}).Error
+}
+
+// recordReferral attributes a newly created client to the enabled referrer with the given code.
+// Unknown codes are only logged, since a client must not fail to be created over its referral.
+func recordReferral(code string, email string) {
+	if code = normalizeReferralCode(code); code == "" {
+		return
+	}
+	db := database.GetDB()
+	referrer := &model.Referrer{}
+	err := db.Model(model.Referrer{}).Where("code = ? AND enable = ?", code, true).First(referrer).Error
+	if err != nil {
+		logger.Warning("Client", email, "was created with unknown or disabled referral code", code)
+		return
+	}
+	if err := db.Transaction(func(tx *gorm.DB) error { return setReferral(tx, referrer.Id, email) }); err != nil {
+		logger.Warning("Unable to record referral of", email, ":", err)
+	}
+}
+
+// AttachReferral attributes an existing client to the referrer with the given code, replacing an
+// earlier attribution. Disabled referrers are accepted so admins can correct past attributions.
+func (s *ReferralService) AttachReferral(email string, code string) error {
+	if _, _, err := s.inboundService.GetClientByEmail(email); err != nil {
+		return err
+	}
+	referrer := &model.Referrer{}
+	db := database.GetDB()
+	err := db.Model(model.Referrer{}).Where("code = ?", normalizeReferralCode(code)).First(referrer).Error
+	if database.IsNotFound(err) {
+		return common.NewCodeError(common.ErrCodeNotFound, map[string]any{"code": code}, "referral code not found:", code)
+	}
+	if err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error { return setReferral(tx, referrer.Id, email) })
+}
+
+// DetachReferral removes the attribution of a client.
+func (s *ReferralService) DetachReferral(email string) error {
+	return database.GetDB().Where("email = ?", email).Delete(model.Referral{}).Error
+}
+
+// GetReferrals returns the attributed clients, newest first, of one referrer when an ID is given
+// and attributed from the start time until before the end time when they are set.
+func (s *ReferralService) GetReferrals(referrerId int, from int64, to int64) ([]*model.Referral, error) {
+	db := referralsBetween(database.GetDB().Model(model.Referral{}), from, to)
+	if referrerId > 0 {
+		db = db.Where("referrer_id = ?", referrerId)
+	}
+	referrals := []*model.Referral{}
+	err := db.Order("id DESC").Find(&referrals).Error
+	return referrals, err
+}
+
+// referralsBetween limits a query on referrals to the ones attributed within a time range.
+func referralsBetween(db *gorm.DB, from int64, to int64) *gorm.DB {
+	if from > 0 {
+		db = db.Where("referrals.created_at >= ?", from)
+	}
+	if to > 0 {
+		db = db.Where("referrals.created_at < ?", to)
+	}
+	return db
+}
+
+// GetReferralReport returns for every referrer the clients attributed from the start time until
+// before the end time when they are set, how many of them were paid for and the revenue by currency.
+// Only payments not yet removed by the database maintenance are counted.
+func (s *ReferralService) GetReferralReport(from int64, to int64) ([]entity.ReferrerReport, error) {
+	referrers, err := s.GetReferrers()
+	if err != nil {
+		return nil, err
+	}
+	db := database.GetDB()
+
+	var clients []struct {
+		ReferrerId   int
+		Clients      int
+		LastReferral int64
+	}
+	err = referralsBetween(db.Model(model.Referral{}), from, to).
+		Select("referrer_id, COUNT(*) AS clients, MAX(created_at) AS last_referral").
+		Group("referrer_id").
+		Scan(&clients).Error
+	if err != nil {
+		return nil, err
+	}
+	var paid []struct {
+		ReferrerId  int
+		Currency    string
+		PaidClients int
+		Amount      int64
+	}
+	err = referralsBetween(db.Model(model.Referral{}), from, to).
+		Select("referrals.referrer_id, payments.currency, COUNT(DISTINCT referrals.email) AS paid_clients, SUM(payments.amount) AS amount").
+		Joins("JOIN payments ON payments.client_email = referrals.email AND payments.status = ?", model.PaymentProvisioned).
+		Group("referrals.referrer_id, payments.currency").
+		Scan(&paid).Error
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make([]entity.ReferrerReport, 0, len(referrers))
+	index := make(map[int]int, len(referrers))
+	for _, referrer := range referrers {
+		index[referrer.Id] = len(reports)
+		reports = append(reports, entity.ReferrerReport{
+			ReferrerId: referrer.Id,
+			Code:       referrer.Code,
+			Name:       referrer.Name,
+			Enable:     referrer.Enable,
+			Revenue:    []entity.ReferralRevenue{},
+		})
+	}
+	for _, row := range clients {
+		if i, ok := index[row.ReferrerId]; ok {
+			reports[i].Clients = row.Clients
+			reports[i].LastReferral = row.LastReferral
+		}
+	}
+	for _, row := range paid {
+		if i, ok := index[row.ReferrerId]; ok {
+			reports[i].PaidClients += row.PaidClients
+			reports[i].Revenue = append(reports[i].Revenue, entity.ReferralRevenue{Currency: row.Currency, Amount: row.Amount})
+		}
+	}
+	return reports, nil
+}
@@ -0,0 +1,286 @@
+package service
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
+)
+
+// scheduledActions are the operations actions can be scheduled for.
+var scheduledActions = []string{
+	"enableInbound", "disableInbound", "resetInboundTraffic",
+	"resetClientTraffic", "enableClient", "disableClient", "delClient",
+	"backup",
+}
+
+// scheduledDestructiveActions are the scheduled operations deleting clients or traffic. Background
+// jobs do not run operations an admin would need approval for, so they are refused while approvals
+// are enabled, both when scheduled and when their time comes.
+var scheduledDestructiveActions = []string{"resetInboundTraffic", "resetClientTraffic", "delClient"}
+
+// scheduledRunsMax bounds the execution history kept for scheduled actions.
+const scheduledRunsMax = 1000
+
+// ScheduleService runs one-off and recurring operations at their time and keeps a history of
+// their executions, so inbounds and clients can be changed on a schedule without external cron
+// jobs calling the API.
+type ScheduleService struct {
+	settingService SettingService
+	inboundService InboundService
+	xrayService    XrayService
+	tgbot          Tgbot
+}
+
+// nextRun returns when an action runs next after the time, 0 when it does not run again.
+func (s *ScheduleService) nextRun(action *model.ScheduledAction, after time.Time) (int64, error) {
+	if action.Schedule == "" {
+		if action.RunAt > after.UnixMilli() {
+			return action.RunAt, nil
+		}
+		return 0, nil
+	}
+	schedule, err := cron.ParseStandard(action.Schedule)
+	if err != nil {
+		return 0, common.NewError("invalid schedule:", action.Schedule, err)
+	}
+	loc, err := s.settingService.GetTimeLocation()
+	if err != nil {
+		return 0, err
+	}
+	return schedule.Next(after.In(loc)).UnixMilli(), nil
+}
+
+// checkScheduledAction validates an action and sets when it runs next.
+func (s *ScheduleService) checkScheduledAction(action *model.ScheduledAction) error {
+	action.Name = strings.TrimSpace(action.Name)
+	action.Email = strings.TrimSpace(action.Email)
+	action.Schedule = strings.TrimSpace(action.Schedule)
+	if !slices.Contains(scheduledActions, action.Action) {
+		return common.NewError("invalid scheduled action:", action.Action)
+	}
+	switch action.Action {
+	case "enableInbound", "disableInbound", "resetInboundTraffic":
+		if _, err := s.inboundService.GetInbound(action.InboundId); err != nil {
+			return common.NewError("scheduled action inbound not found:", action.InboundId)
+		}
+	case "resetClientTraffic", "delClient":
+		if _, err := s.inboundService.GetInbound(action.InboundId); err != nil {
+			return common.NewError("scheduled action inbound not found:", action.InboundId)
+		}
+		fallthrough
+	case "enableClient", "disableClient":
+		if action.Email == "" {
+			return common.NewError("scheduled action needs a client email")
+		}
+	}
+	if err := s.checkApproval(action); err != nil {
+		return err
+	}
+	if action.Schedule == "" && action.RunAt <= 0 {
+		return common.NewError("scheduled action needs a run time or a schedule")
+	}
+	if action.Schedule == "" {
+		// A one-off action set in the past runs right away
+		action.NextRunAt = action.RunAt
+		return nil
+	}
+	action.RunAt = 0
+	next, err := s.nextRun(action, time.Now())
+	if err != nil {
+		return err
+	}
+	action.NextRunAt = next
+	return nil
+}
+
+// checkApproval refuses a destructive action while approvals are enabled.
+func (s *ScheduleService) checkApproval(action *model.ScheduledAction) error {
+	if !slices.Contains(scheduledDestructiveActions, action.Action) {
+		return nil
+	}
+	enable, err := s.settingService.GetApprovalEnable()
+	if err != nil {
+		return err
+	}
+	if enable {
+		return common.NewError("scheduled action is not allowed while approvals are enabled:", action.Action)
+	}
+	return nil
+}
+
+// GetActions returns the scheduled actions in the order they run next.
+func (s *ScheduleService) GetActions() ([]*model.ScheduledAction, error) {
+	actions := []*model.ScheduledAction{}
+	err := database.GetDB().Model(model.ScheduledAction{}).
+		Order("next_run_at = 0").Order("next_run_at").Order("id").Find(&actions).Error
+	return actions, err
+}
+
+// AddAction validates and stores a new scheduled action.
+func (s *ScheduleService) AddAction(action *model.ScheduledAction) error {
+	if err := s.checkScheduledAction(action); err != nil {
+		return common.WithCode(common.ErrCodeValidation, err)
+	}
+	action.Id = 0
+	action.LastRunAt = 0
+	action.LastError = ""
+	return database.GetDB().Create(action).Error
+}
+
+// UpdateAction validates and updates a scheduled action, keeping the outcome of its last run.
+func (s *ScheduleService) UpdateAction(action *model.ScheduledAction) error {
+	if err := s.checkScheduledAction(action); err != nil {
+		return common.WithCode(common.ErrCodeValidation, err)
+	}
+	db := database.GetDB()
+	old := &model.ScheduledAction{}
+	if err := db.First(old, action.Id).Error; err != nil {
+		return err
+	}
+	action.LastRunAt = old.LastRunAt
+	action.LastError = old.LastError
+	return db.Save(action).Error
+}
+
+// DelAction deletes a scheduled action with its execution history.
+func (s *ScheduleService) DelAction(id int) error {
+	return database.GetDB().Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(model.ScheduledAction{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Where("action_id = ?", id).Delete(model.ScheduledActionRun{}).Error
+	})
+}
+
+// GetRuns returns the latest executions, of one action when actionId is not 0, newest first.
+func (s *ScheduleService) GetRuns(actionId int, limit int) ([]*model.ScheduledActionRun, error) {
+	db := database.GetDB().Model(model.ScheduledActionRun{})
+	if actionId != 0 {
+		db = db.Where("action_id = ?", actionId)
+	}
+	runs := []*model.ScheduledActionRun{}
+	err := db.Order("id DESC").Limit(limit).Find(&runs).Error
+	return runs, err
+}
+
+// RunDueActions runs the enabled actions whose time has come.
+func (s *ScheduleService) RunDueActions() error {
+	var actions []*model.ScheduledAction
+	err := database.GetDB().Model(model.ScheduledAction{}).
+		Where("enable = ? AND next_run_at > 0 AND next_run_at <= ?", true, time.Now().UnixMilli()).
+		Order("next_run_at").Find(&actions).Error
+	if err != nil {
+		return err
+	}
+	needRestart := false
+	for _, action := range actions {
+		if s.run(action) {
+			needRestart = true
+		}
+	}
+	if needRestart {
+		s.xrayService.SetToNeedRestart()
+	}
+	return nil
+}
+
+// RunAction runs a scheduled action right away without changing when it runs next.
+func (s *ScheduleService) RunAction(id int) (*model.ScheduledActionRun, error) {
+	action := &model.ScheduledAction{}
+	if err := database.GetDB().First(action, id).Error; err != nil {
+		return nil, err
+	}
+	run, needRestart := s.execute(action)
+	if needRestart {
+		s.xrayService.SetToNeedRestart()
+	}
+	return run, nil
+}
+
+// run executes a due action and moves it to its next run, disabling one-off actions. Returns
+// whether Xray needs a restart.
+func (s *ScheduleService) run(action *model.ScheduledAction) bool {
+	_, needRestart := s.execute(action)
+	next, err := s.nextRun(action, time.Now())
+	if err != nil {
+		logger.Warning("Unable to schedule action", action.Id, ":", err)
+	}
+	updates := map[string]any{"next_run_at": next}
+	if action.Schedule == "" {
+		updates["enable"] = false
+	}
+	if err := database.GetDB().Model(model.ScheduledAction{}).Where("id = ?", action.Id).Updates(updates).Error; err != nil {
+		logger.Warning("Unable to save scheduled action", action.Id, ":", err)
+	}
+	return needRestart
+}
+
+// execute carries out an action and records the execution. Returns the execution and whether
+// Xray needs a restart.
+func (s *ScheduleService) execute(action *model.ScheduledAction) (*model.ScheduledActionRun, bool) {
+	start := time.Now()
+	needRestart, err := s.apply(action)
+	run := &model.ScheduledActionRun{
+		ActionId:  action.Id,
+		Action:    action.Action,
+		StartedAt: start.UnixMilli(),
+		Duration:  time.Since(start).Milliseconds(),
+		Success:   err == nil,
+	}
+	if err != nil {
+		run.Error = err.Error()
+		logger.Warningf("Scheduled action %d (%s) failed: %v", action.Id, action.Action, err)
+	} else {
+		logger.Infof("Scheduled action %d (%s) ran", action.Id, action.Action)
+	}
+
+	db := database.GetDB()
+	if err := db.Create(run).Error; err != nil {
+		logger.Warning("Unable to save scheduled action run:", err)
+	}
+	db.Model(model.ScheduledAction{}).Where("id = ?", action.Id).
+		Updates(map[string]any{"last_run_at": run.StartedAt, "last_error": run.Error})
+	// Keep the latest runs only
+	db.Where("id <= ?", run.Id-scheduledRunsMax).Delete(model.ScheduledActionRun{})
+	return run, needRestart
+}
+
+// apply carries out the operation of an action. Returns whether Xray needs a restart.
+func (s *ScheduleService) apply(action *model.ScheduledAction) (bool, error) {
+	if err := s.checkApproval(action); err != nil {
+		return false, err
+	}
+	switch action.Action {
+	case "enableInbound", "disableInbound":
+		_, needRestart, err := s.inboundService.SetInboundEnable(action.InboundId, action.Action == "enableInbound")
+		return needRestart, err
+	case "resetInboundTraffic":
+		return true, s.inboundService.ResetAllClientTraffics(action.InboundId)
+	case "resetClientTraffic":
+		return s.inboundService.ResetClientTraffic(action.InboundId, action.Email)
+	case "enableClient", "disableClient":
+		_, needRestart, err := s.inboundService.SetClientEnableByEmail(action.Email, action.Action == "enableClient")
+		return needRestart, err
+	case "delClient":
+		return s.inboundService.DelInboundClientByEmail(action.InboundId, action.Email)
+	case "backup":
+		if !s.tgbot.IsRunning() {
+			return false, common.NewError("the Telegram bot is not running")
+		}
+		s.tgbot.SendBackupToAdmins()
+		return false, nil
+	}
+	return false, common.NewError("invalid scheduled action:", action.Action)
+}
@@ -4,6 +4,7 @@ import (
 	"archive/zip"
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -66,10 +67,12 @@ type Status struct {
 		Current uint64 `json:"current"`
 		Total   uint64 `json:"total"`
 	} `json:"disk"`
-	Xray struct {
+	Storage StorageStatus `json:"storage"`
+	Xray    struct {
 		State    ProcessState `json:"state"`
 		ErrorMsg string       `json:"errorMsg"`
 		Version  string       `json:"version"`
+		Core     string       `json:"core"` // Core type of the process, xray or sing-box
 	} `json:"xray"`
 	Uptime   uint64    `json:"uptime"`
 	Loads    []float64 `json:"loads"`
@@ -107,6 +110,7 @@ type ServerService struct {
 	cachedIPv4         string
 	cachedIPv6         string
 	noIPv6             bool
+	ipGeneration       int64
 	mu                 sync.Mutex
 	lastCPUTimes       cpu.TimesStat
 	hasLastCPUSample   bool
@@ -193,6 +197,25 @@ type LogEntry struct {
 	Event       int
 }
 
+// Services answering with the public IPv4 or IPv6 address of the caller as plain text.
+var (
+	publicIPv4Services = []string{
+		"https://api4.ipify.org",
+		"https://ipv4.icanhazip.com",
+		"https://v4.api.ipinfo.io/ip",
+		"https://ipv4.myexternalip.com/raw",
+		"https://4.ident.me",
+		"https://check-host.net/ip",
+	}
+	publicIPv6Services = []string{
+		"https://api6.ipify.org",
+		"https://ipv6.icanhazip.com",
+		"https://v6.api.ipinfo.io/ip",
+		"https://ipv6.myexternalip.com/raw",
+		"https://6.ident.me",
+	}
+)
+
 func getPublicIP(url string) string {
 	client := &http.Client{
 		Timeout: 3 * time.Second,
@@ -305,6 +328,7 @@ func (s *ServerService) GetStatus(lastStatus *Status) *Status {
 		status.Disk.Current = diskInfo.Used
 		status.Disk.Total = diskInfo.Total
 	}
+	status.Storage = s.GetStorageStatus()
 
 	// Load averages
 	avgState, err := load.Avg()
@@ -346,25 +370,16 @@ func (s *ServerService) GetStatus(lastStatus *Status) *Status {
 		logger.Warning("get udp connections failed:", err)
 	}
 
-	// IP fetching with caching
-	showIp4ServiceLists := []string{
-		"https://api4.ipify.org",
-		"https://ipv4.icanhazip.com",
-		"https://v4.api.ipinfo.io/ip",
-		"https://ipv4.myexternalip.com/raw",
-		"https://4.ident.me",
-		"https://check-host.net/ip",
-	}
-	showIp6ServiceLists := []string{
-		"https://api6.ipify.org",
-		"https://ipv6.icanhazip.com",
-		"https://v6.api.ipinfo.io/ip",
-		"https://ipv6.myexternalip.com/raw",
-		"https://6.ident.me",
+	// IP fetching with caching, dropped when the public IP check found a change
+	if generation := publicIPGeneration.Load(); generation != s.ipGeneration {
+		s.ipGeneration = generation
+		s.cachedIPv4 = ""
+		s.cachedIPv6 = ""
+		s.noIPv6 = false
 	}
 
 	if s.cachedIPv4 == "" {
-		for _, ip4Service := range showIp4ServiceLists {
+		for _, ip4Service := range publicIPv4Services {
 			s.cachedIPv4 = getPublicIP(ip4Service)
 			if s.cachedIPv4 != "N/A" {
 				break
@@ -373,7 +388,7 @@ func (s *ServerService) GetStatus(lastStatus *Status) *Status {
 	}
 
 	if s.cachedIPv6 == "" && !s.noIPv6 {
-		for _, ip6Service := range showIp6ServiceLists {
+		for _, ip6Service := range publicIPv6Services {
 			s.cachedIPv6 = getPublicIP(ip6Service)
 			if s.cachedIPv6 != "N/A" {
 				break
@@ -402,6 +417,7 @@ func (s *ServerService) GetStatus(lastStatus *Status) *Status {
 		status.Xray.ErrorMsg = s.xrayService.GetXrayResult()
 	}
 	status.Xray.Version = s.xrayService.GetXrayVersion()
+	status.Xray.Core = s.xrayService.GetCoreType()
 
 	// Application stats
 	var rtm runtime.MemStats
@@ -1005,6 +1021,16 @@ func (s *ServerService) ImportDB(file multipart.File) error {
 	}
 
 	s.inboundService.MigrateDB()
+	// The imported database carries its own data key for secret settings
+	resetSecretDataKey()
+	settingService := SettingService{}
+	if err := settingService.MigrateSecretSettings(); err != nil {
+		logger.Warning("encrypt secret settings failed:", err)
+	}
+	userService := UserService{}
+	if err := userService.MigrateApiKeys(); err != nil {
+		logger.Warning("hash API keys failed:", err)
+	}
 
 	// Start Xray
 	if err = s.RestartXrayService(); err != nil {
@@ -1044,6 +1070,12 @@ func (s *ServerService) IsValidGeofileName(filename string) bool {
 }
 
 func (s *ServerService) UpdateGeofile(fileName string) error {
+	return s.UpdateGeofileWithProgress(context.Background(), fileName, nil)
+}
+
+// UpdateGeofileWithProgress downloads one or all geofiles and restarts Xray, reporting the file
+// being downloaded to report when it is not nil. Remaining downloads are skipped once ctx is done.
+func (s *ServerService) UpdateGeofileWithProgress(ctx context.Context, fileName string, report JobProgressFunc) error {
 	files := []struct {
 		URL      string
 		FileName string
@@ -1099,7 +1131,14 @@ func (s *ServerService) UpdateGeofile(fileName string) error {
 	var errorMessages []string
 
 	if fileName == "" {
-		for _, file := range files {
+		for i, file := range files {
+			if ctx.Err() != nil {
+				errorMessages = append(errorMessages, fmt.Sprintf("Skipped Geofile '%s': %v", file.FileName, ctx.Err()))
+				continue
+			}
+			if report != nil {
+				report(i*100/len(files), file.FileName)
+			}
 			// Sanitize the filename from our allowlist as an extra precaution
 			destPath := filepath.Join(config.GetBinFolderPath(), filepath.Base(file.FileName))
 
@@ -1168,23 +1207,11 @@ func (s *ServerService) GetNewX25519Cert() (any, error) {
 }
 
 func (s *ServerService) GetNewmldsa65() (any, error) {
-	// Run the command
-	cmd := exec.Command(xray.GetBinaryPath(), "mldsa65")
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
+	seed, verify, err := newMldsa65Keys("")
 	if err != nil {
 		return nil, err
 	}
 
-	lines := strings.Split(out.String(), "\n")
-
-	SeedLine := strings.Split(lines[0], ":")
-	VerifyLine := strings.Split(lines[1], ":")
-
-	seed := strings.TrimSpace(SeedLine[1])
-	verify := strings.TrimSpace(VerifyLine[1])
-
 	keyPair := map[string]any{
 		"seed":   seed,
 		"verify": verify,
@@ -14,6 +14,7 @@ import (
 	"github.com/mhsanaei/3x-ui/v2/database/model"
 	"github.com/mhsanaei/3x-ui/v2/logger"
 	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/util/link"
 	"github.com/mhsanaei/3x-ui/v2/util/random"
 	"github.com/mhsanaei/3x-ui/v2/util/reflect_util"
 	"github.com/mhsanaei/3x-ui/v2/web/entity"
@@ -28,6 +29,8 @@ var defaultValueMap = map[string]string{
 	"webListen":                   "",
 	"webDomain":                   "",
 	"webPort":                     "2053",
+	"webSocket":                   "",
+	"webHttp3":                    "false",
 	"webCertFile":                 "",
 	"webKeyFile":                  "",
 	"secret":                      random.Seq(32),
@@ -37,6 +40,8 @@ var defaultValueMap = map[string]string{
 	"expireDiff":                  "0",
 	"trafficDiff":                 "0",
 	"remarkModel":                 "-ieo",
+	"remarkTemplate":              "",
+	"remarkEmoji":                 "true",
 	"timeLocation":                "Local",
 	"tgBotEnable":                 "false",
 	"tgBotToken":                  "",
@@ -47,6 +52,8 @@ var defaultValueMap = map[string]string{
 	"tgBotBackup":                 "false",
 	"tgBotLoginNotify":            "true",
 	"tgCpu":                       "80",
+	"tgDisk":                      "90",
+	"tgDbSize":                    "0",
 	"tgLang":                      "en-US",
 	"twoFactorEnable":             "false",
 	"twoFactorToken":              "",
@@ -56,13 +63,19 @@ var defaultValueMap = map[string]string{
 	"subTitle":                    "",
 	"subListen":                   "",
 	"subPort":                     "2096",
+	"subSocket":                   "",
+	"subHttp3":                    "false",
 	"subPath":                     "/sub/",
 	"subDomain":                   "",
 	"subCertFile":                 "",
 	"subKeyFile":                  "",
+	"subRateLimit":                "0",
+	"subCloudflareOnly":           "false",
 	"subUpdates":                  "12",
 	"subEncrypt":                  "true",
 	"subShowInfo":                 "true",
+	"subRandomize":                "false",
+	"subSign":                     "false",
 	"subURI":                      "",
 	"subJsonPath":                 "/json/",
 	"subJsonURI":                  "",
@@ -95,6 +108,129 @@ var defaultValueMap = map[string]string{
 	"ldapDefaultTotalGB":    "0",
 	"ldapDefaultExpiryDays": "0",
 	"ldapDefaultLimitIP":    "0",
+	// Payment defaults
+	"paymentEnable":        "false",
+	"paymentStripeSecret":  "",
+	"paymentHmacSecret":    "",
+	"referralLinkTemplate": "",
+	"smtpHost":             "",
+	"smtpPort":             "587",
+	"smtpUsername":         "",
+	"smtpPassword":         "",
+	"smtpFrom":             "",
+	// Speed limit defaults
+	"speedLimitInterface": "",
+	// Expiry action defaults
+	"expiryThrottleSpeed":   "16",
+	"expiryCaptiveOutbound": "",
+	// Client portal defaults
+	"portalEnable": "false",
+	// Inbound health check defaults
+	"healthCheckMode": "",
+	// Firewall defaults
+	"firewallBackend":       "",
+	"firewallPanelAllowIps": "",
+	// Branding defaults
+	"brandName":           "",
+	"brandLogoUrl":        "",
+	"brandFaviconUrl":     "",
+	"brandPrimaryColor":   "",
+	"brandSupportContact": "",
+	// Public IP change detection and DDNS defaults
+	"ipCheckEnable":   "false",
+	"ipCheckInterval": "5",
+	"ipChangeWebhook": "",
+	"ddnsProvider":    "",
+	"ddnsDomain":      "",
+	"ddnsToken":       "",
+	"ddnsZoneId":      "",
+	// DNS provider defaults
+	"dnsProvider":    "",
+	"dnsApiToken":    "",
+	"dnsZoneId":      "",
+	"dnsAutoRecord":  "false",
+	"dnsProxied":     "false",
+	"dnsCnameTarget": "",
+	// Public addresses found by the last IP check
+	"publicIPv4": "",
+	"publicIPv6": "",
+	// Database maintenance defaults
+	"maintenanceEnable":        "false",
+	"maintenanceHour":          "4",
+	"maintenanceRetentionDays": "90",
+	// Seconds without further changes before Xray is restarted to apply them
+	"xrayRestartDelay": "5",
+	// Proxy core the inbounds run on: xray or sing-box
+	"coreType": "xray",
+	// Online clients and their IPs are found from traffic and the access log unless set to "api"
+	"onlineDetectionMode": "",
+	// Seconds a client stays online after its last traffic, 0 for one traffic interval
+	"onlineIdleWindow": "0",
+	// Bytes of traffic in one collection that count as activity
+	"onlineMinBytes": "1",
+	// Seconds between scans of the access log for client IPs
+	"onlineLogScanInterval": "10",
+	// Traffic statistics collection defaults
+	"trafficInterval":       "10",
+	"trafficClientUplink":   "true",
+	"trafficClientDownlink": "true",
+	"trafficResetOnRead":    "true",
+	// Outbound probing defaults, an interval of 0 disables probing
+	"outboundProbeInterval":     "5",
+	"outboundProbeDeprioritize": "false",
+	// NaiveProxy forward proxy defaults, serving the clients of the listed inbound IDs
+	"naiveEnable":     "false",
+	"naivePort":       "8443",
+	"naiveDomain":     "",
+	"naiveCertFile":   "",
+	"naiveKeyFile":    "",
+	"naiveInboundIds": "",
+	// SSH tunnel defaults, serving the clients of the listed inbound IDs
+	"sshEnable":     "false",
+	"sshPort":       "2222",
+	"sshHost":       "",
+	"sshInboundIds": "",
+	// Host key of the SSH tunnel server, generated on first start
+	"sshHostKey": "",
+	// Ad and malware blocking defaults, blocking the geosite lists on all inbounds but the excluded IDs
+	"adBlockEnable":            "false",
+	"adBlockCategories":        "geosite:category-ads-all,ext:geosite_IR.dat:malware,ext:geosite_IR.dat:phishing",
+	"adBlockExcludeInboundIds": "",
+	// Hours between automatic geofile updates, 0 to update them only by hand
+	"geofileUpdateInterval": "0",
+	// REALITY target check defaults, an interval of 0 disables the check
+	"realityCheckInterval":   "0",
+	"realityMaxLatency":      "1000",
+	"realityBlockedDomains":  "",
+	"realityFallbackTargets": "",
+	"realityAutoRotate":      "false",
+	// Decoy defaults for requests outside the web base path, banning probing addresses when enabled
+	"decoyMode":         "",
+	"decoyUrl":          "",
+	"decoyBanThreshold": "0",
+	"decoyBanMinutes":   "60",
+	"decoyAbuseIpdbKey": "",
+	// Tunnel defaults, publishing the panel through Cloudflare or Tor when a mode is set
+	"tunnelMode":     "",
+	"tunnelToken":    "",
+	"tunnelHostname": "",
+	// Key of the onion service the panel is published as, generated on first start
+	"tunnelOnionKey": "",
+	// Two-person approval defaults for destructive operations, off by default
+	"approvalEnable":     "false",
+	"approvalMinClients": "10",
+	"approvalWindow":     "60",
+	// Read-only mode, toggled through its own endpoint rather than the settings form
+	"readOnlyMode": "false",
+	// Ed25519 key subscriptions are signed with, generated on first use
+	"subSignKey": "",
+	// Update check defaults, looking for new panel and Xray releases twice a day
+	"updateCheckEnable": "true",
+	"updateCheckNotify": "false",
+	// Versions the Telegram admins were last told about
+	"updateNotifiedVersions": "",
+	// Profiling and debug dump routes for the super admin, off by default
+	"profilingEnable": "false",
 }
 
 // SettingService provides business logic for application settings management.
@@ -165,7 +301,12 @@ func (s *SettingService) GetAllSetting() (*entity.AllSetting, error) {
 
 	keyMap := map[string]bool{}
 	for _, setting := range settings {
-		err := setSetting(setting.Key, setting.Value)
+		value, err := decodeSetting(setting.Key, setting.Value)
+		if err != nil {
+			logger.Warning("decrypt setting", setting.Key, "failed:", err)
+			value = ""
+		}
+		err = setSetting(setting.Key, value)
 		if err != nil {
 			return nil, err
 		}
@@ -182,6 +323,14 @@ func (s *SettingService) GetAllSetting() (*entity.AllSetting, error) {
 		}
 	}
 
+	// Environment and settings file overrides take precedence over stored values
+	for key, override := range loadSettingOverrides() {
+		err := setSetting(key, override.value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return allSetting, nil
 }
 
@@ -206,6 +355,10 @@ func (s *SettingService) getSetting(key string) (*model.Setting, error) {
 }
 
 func (s *SettingService) saveSetting(key string, value string) error {
+	value, err := encodeSetting(key, value)
+	if err != nil {
+		return err
+	}
 	setting, err := s.getSetting(key)
 	db := database.GetDB()
 	if database.IsNotFound(err) {
@@ -222,6 +375,9 @@ func (s *SettingService) saveSetting(key string, value string) error {
 }
 
 func (s *SettingService) getString(key string) (string, error) {
+	if override, ok := getSettingOverride(key); ok {
+		return override.value, nil
+	}
 	setting, err := s.getSetting(key)
 	if database.IsNotFound(err) {
 		value, ok := defaultValueMap[key]
@@ -232,7 +388,7 @@ func (s *SettingService) getString(key string) (string, error) {
 	} else if err != nil {
 		return "", err
 	}
-	return setting.Value, nil
+	return decodeSetting(key, setting.Value)
 }
 
 func (s *SettingService) setString(key string, value string) error {
@@ -271,6 +427,14 @@ func (s *SettingService) GetListen() (string, error) {
 	return s.getString("webListen")
 }
 
+func (s *SettingService) GetSocket() (string, error) {
+	return s.getString("webSocket")
+}
+
+func (s *SettingService) GetHttp3() (bool, error) {
+	return s.getBool("webHttp3")
+}
+
 func (s *SettingService) SetListen(ip string) error {
 	return s.setString("webListen", ip)
 }
@@ -339,6 +503,14 @@ func (s *SettingService) GetTgCpu() (int, error) {
 	return s.getInt("tgCpu")
 }
 
+func (s *SettingService) GetTgDisk() (int, error) {
+	return s.getInt("tgDisk")
+}
+
+func (s *SettingService) GetTgDbSize() (int, error) {
+	return s.getInt("tgDbSize")
+}
+
 func (s *SettingService) GetTgLang() (string, error) {
 	return s.getString("tgLang")
 }
@@ -407,6 +579,33 @@ func (s *SettingService) GetRemarkModel() (string, error) {
 	return s.getString("remarkModel")
 }
 
+func (s *SettingService) GetRemarkTemplate() (string, error) {
+	return s.getString("remarkTemplate")
+}
+
+func (s *SettingService) GetRemarkEmoji() (bool, error) {
+	return s.getBool("remarkEmoji")
+}
+
+// GetRemarkOptions collects the settings that control how link remarks are built.
+func (s *SettingService) GetRemarkOptions() (link.RemarkOptions, error) {
+	var opts link.RemarkOptions
+	var err error
+	if opts.Model, err = s.GetRemarkModel(); err != nil {
+		return opts, err
+	}
+	if opts.Template, err = s.GetRemarkTemplate(); err != nil {
+		return opts, err
+	}
+	if opts.ShowInfo, err = s.GetSubShowInfo(); err != nil {
+		return opts, err
+	}
+	if opts.Emoji, err = s.GetRemarkEmoji(); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
 func (s *SettingService) GetSecret() ([]byte, error) {
 	secret, err := s.getString("secret")
 	if secret == defaultValueMap["secret"] {
@@ -472,6 +671,14 @@ func (s *SettingService) GetSubListen() (string, error) {
 	return s.getString("subListen")
 }
 
+func (s *SettingService) GetSubSocket() (string, error) {
+	return s.getString("subSocket")
+}
+
+func (s *SettingService) GetSubHttp3() (bool, error) {
+	return s.getBool("subHttp3")
+}
+
 func (s *SettingService) GetSubPort() (int, error) {
 	return s.getInt("subPort")
 }
@@ -504,10 +711,34 @@ func (s *SettingService) GetSubEncrypt() (bool, error) {
 	return s.getBool("subEncrypt")
 }
 
+func (s *SettingService) GetSubRateLimit() (int, error) {
+	return s.getInt("subRateLimit")
+}
+
+func (s *SettingService) GetSubCloudflareOnly() (bool, error) {
+	return s.getBool("subCloudflareOnly")
+}
+
 func (s *SettingService) GetSubShowInfo() (bool, error) {
 	return s.getBool("subShowInfo")
 }
 
+func (s *SettingService) GetSubRandomize() (bool, error) {
+	return s.getBool("subRandomize")
+}
+
+func (s *SettingService) GetSubSign() (bool, error) {
+	return s.getBool("subSign")
+}
+
+func (s *SettingService) GetSubSignKey() (string, error) {
+	return s.getString("subSignKey")
+}
+
+func (s *SettingService) SetSubSignKey(key string) error {
+	return s.setString("subSignKey", key)
+}
+
 func (s *SettingService) GetPageSize() (int, error) {
 	return s.getInt("pageSize")
 }
@@ -572,6 +803,19 @@ func (s *SettingService) GetIpLimitEnable() (bool, error) {
 	return (accessLogPath != "none" && accessLogPath != ""), nil
 }
 
+// HasClientIpSource reports whether the IPs of clients are found, from the Xray access log or
+// the Xray online stats, so client speed limits can be applied.
+func (s *SettingService) HasClientIpSource() (bool, error) {
+	mode, err := s.GetOnlineDetectionMode()
+	if err != nil {
+		return false, err
+	}
+	if mode == OnlineDetectionAPI {
+		return true, nil
+	}
+	return s.GetIpLimitEnable()
+}
+
 // LDAP exported getters
 func (s *SettingService) GetLdapEnable() (bool, error) {
 	return s.getBool("ldapEnable")
@@ -653,9 +897,380 @@ func (s *SettingService) GetLdapDefaultLimitIP() (int, error) {
 	return s.getInt("ldapDefaultLimitIP")
 }
 
+func (s *SettingService) GetPaymentEnable() (bool, error) {
+	return s.getBool("paymentEnable")
+}
+
+func (s *SettingService) GetReferralLinkTemplate() (string, error) {
+	return s.getString("referralLinkTemplate")
+}
+
+func (s *SettingService) GetSmtpHost() (string, error) {
+	return s.getString("smtpHost")
+}
+
+func (s *SettingService) GetSmtpPort() (int, error) {
+	return s.getInt("smtpPort")
+}
+
+func (s *SettingService) GetSmtpUsername() (string, error) {
+	return s.getString("smtpUsername")
+}
+
+func (s *SettingService) GetSmtpPassword() (string, error) {
+	return s.getString("smtpPassword")
+}
+
+func (s *SettingService) GetSmtpFrom() (string, error) {
+	return s.getString("smtpFrom")
+}
+
+func (s *SettingService) GetSpeedLimitInterface() (string, error) {
+	return s.getString("speedLimitInterface")
+}
+
+func (s *SettingService) GetExpiryThrottleSpeed() (int, error) {
+	return s.getInt("expiryThrottleSpeed")
+}
+
+func (s *SettingService) GetExpiryCaptiveOutbound() (string, error) {
+	return s.getString("expiryCaptiveOutbound")
+}
+
+func (s *SettingService) GetPortalEnable() (bool, error) {
+	return s.getBool("portalEnable")
+}
+
+func (s *SettingService) GetHealthCheckMode() (string, error) {
+	return s.getString("healthCheckMode")
+}
+
+func (s *SettingService) GetFirewallBackend() (string, error) {
+	return s.getString("firewallBackend")
+}
+
+func (s *SettingService) GetFirewallPanelAllowIps() (string, error) {
+	return s.getString("firewallPanelAllowIps")
+}
+
+// GetBranding returns the branding settings. Unreadable settings fall back to the default branding.
+func (s *SettingService) GetBranding() *entity.Branding {
+	brand := &entity.Branding{}
+	brand.Name, _ = s.getString("brandName")
+	brand.LogoUrl, _ = s.getString("brandLogoUrl")
+	brand.FaviconUrl, _ = s.getString("brandFaviconUrl")
+	brand.PrimaryColor, _ = s.getString("brandPrimaryColor")
+	brand.Support, _ = s.getString("brandSupportContact")
+	switch support := strings.TrimSpace(brand.Support); {
+	case strings.HasPrefix(support, "https://"), strings.HasPrefix(support, "http://"):
+		brand.SupportLink = support
+	case strings.HasPrefix(support, "@") && len(support) > 1:
+		brand.SupportLink = "https://t.me/" + support[1:]
+	case strings.Contains(support, "@") && !strings.ContainsAny(support, " :/"):
+		brand.SupportLink = "mailto:" + support
+	}
+	return brand
+}
+
+func (s *SettingService) GetIpCheckEnable() (bool, error) {
+	return s.getBool("ipCheckEnable")
+}
+
+func (s *SettingService) GetIpCheckInterval() (int, error) {
+	return s.getInt("ipCheckInterval")
+}
+
+func (s *SettingService) GetIpChangeWebhook() (string, error) {
+	return s.getString("ipChangeWebhook")
+}
+
+func (s *SettingService) GetDdnsProvider() (string, error) {
+	return s.getString("ddnsProvider")
+}
+
+func (s *SettingService) GetDdnsDomain() (string, error) {
+	return s.getString("ddnsDomain")
+}
+
+func (s *SettingService) GetDdnsToken() (string, error) {
+	return s.getString("ddnsToken")
+}
+
+func (s *SettingService) GetDdnsZoneId() (string, error) {
+	return s.getString("ddnsZoneId")
+}
+
+func (s *SettingService) GetDnsProvider() (string, error) {
+	return s.getString("dnsProvider")
+}
+
+func (s *SettingService) GetDnsApiToken() (string, error) {
+	return s.getString("dnsApiToken")
+}
+
+func (s *SettingService) GetDnsZoneId() (string, error) {
+	return s.getString("dnsZoneId")
+}
+
+func (s *SettingService) GetDnsAutoRecord() (bool, error) {
+	return s.getBool("dnsAutoRecord")
+}
+
+func (s *SettingService) GetDnsProxied() (bool, error) {
+	return s.getBool("dnsProxied")
+}
+
+func (s *SettingService) GetDnsCnameTarget() (string, error) {
+	return s.getString("dnsCnameTarget")
+}
+
+func (s *SettingService) GetPublicIPv4() (string, error) {
+	return s.getString("publicIPv4")
+}
+
+func (s *SettingService) SetPublicIPv4(ip string) error {
+	return s.setString("publicIPv4", ip)
+}
+
+func (s *SettingService) GetPublicIPv6() (string, error) {
+	return s.getString("publicIPv6")
+}
+
+func (s *SettingService) SetPublicIPv6(ip string) error {
+	return s.setString("publicIPv6", ip)
+}
+
+func (s *SettingService) GetMaintenanceEnable() (bool, error) {
+	return s.getBool("maintenanceEnable")
+}
+
+func (s *SettingService) GetMaintenanceHour() (int, error) {
+	return s.getInt("maintenanceHour")
+}
+
+func (s *SettingService) GetMaintenanceRetentionDays() (int, error) {
+	return s.getInt("maintenanceRetentionDays")
+}
+
+func (s *SettingService) GetXrayRestartDelay() (int, error) {
+	return s.getInt("xrayRestartDelay")
+}
+
+func (s *SettingService) GetCoreType() (string, error) {
+	return s.getString("coreType")
+}
+
+func (s *SettingService) GetOnlineDetectionMode() (string, error) {
+	return s.getString("onlineDetectionMode")
+}
+
+func (s *SettingService) GetOnlineIdleWindow() (int, error) {
+	return s.getInt("onlineIdleWindow")
+}
+
+func (s *SettingService) GetOnlineMinBytes() (int, error) {
+	return s.getInt("onlineMinBytes")
+}
+
+func (s *SettingService) GetOnlineLogScanInterval() (int, error) {
+	return s.getInt("onlineLogScanInterval")
+}
+
+func (s *SettingService) GetTrafficInterval() (int, error) {
+	return s.getInt("trafficInterval")
+}
+
+func (s *SettingService) GetTrafficClientUplink() (bool, error) {
+	return s.getBool("trafficClientUplink")
+}
+
+func (s *SettingService) GetTrafficClientDownlink() (bool, error) {
+	return s.getBool("trafficClientDownlink")
+}
+
+func (s *SettingService) GetTrafficResetOnRead() (bool, error) {
+	return s.getBool("trafficResetOnRead")
+}
+
+func (s *SettingService) GetOutboundProbeInterval() (int, error) {
+	return s.getInt("outboundProbeInterval")
+}
+
+func (s *SettingService) GetOutboundProbeDeprioritize() (bool, error) {
+	return s.getBool("outboundProbeDeprioritize")
+}
+
+func (s *SettingService) GetNaiveEnable() (bool, error) {
+	return s.getBool("naiveEnable")
+}
+
+func (s *SettingService) GetNaivePort() (int, error) {
+	return s.getInt("naivePort")
+}
+
+func (s *SettingService) GetNaiveDomain() (string, error) {
+	return s.getString("naiveDomain")
+}
+
+func (s *SettingService) GetNaiveCertFile() (string, error) {
+	return s.getString("naiveCertFile")
+}
+
+func (s *SettingService) GetNaiveKeyFile() (string, error) {
+	return s.getString("naiveKeyFile")
+}
+
+func (s *SettingService) GetNaiveInboundIds() (string, error) {
+	return s.getString("naiveInboundIds")
+}
+
+func (s *SettingService) GetSshEnable() (bool, error) {
+	return s.getBool("sshEnable")
+}
+
+func (s *SettingService) GetSshPort() (int, error) {
+	return s.getInt("sshPort")
+}
+
+func (s *SettingService) GetSshHost() (string, error) {
+	return s.getString("sshHost")
+}
+
+func (s *SettingService) GetSshInboundIds() (string, error) {
+	return s.getString("sshInboundIds")
+}
+
+func (s *SettingService) GetSshHostKey() (string, error) {
+	return s.getString("sshHostKey")
+}
+
+func (s *SettingService) SetSshHostKey(key string) error {
+	return s.setString("sshHostKey", key)
+}
+
+func (s *SettingService) GetAdBlockEnable() (bool, error) {
+	return s.getBool("adBlockEnable")
+}
+
+func (s *SettingService) SetAdBlockEnable(value bool) error {
+	return s.setBool("adBlockEnable", value)
+}
+
+func (s *SettingService) GetAdBlockCategories() (string, error) {
+	return s.getString("adBlockCategories")
+}
+
+func (s *SettingService) GetAdBlockExcludeInboundIds() (string, error) {
+	return s.getString("adBlockExcludeInboundIds")
+}
+
+func (s *SettingService) GetGeofileUpdateInterval() (int, error) {
+	return s.getInt("geofileUpdateInterval")
+}
+
+func (s *SettingService) GetRealityCheckInterval() (int, error) {
+	return s.getInt("realityCheckInterval")
+}
+
+func (s *SettingService) GetRealityMaxLatency() (int, error) {
+	return s.getInt("realityMaxLatency")
+}
+
+func (s *SettingService) GetRealityBlockedDomains() (string, error) {
+	return s.getString("realityBlockedDomains")
+}
+
+func (s *SettingService) GetRealityFallbackTargets() (string, error) {
+	return s.getString("realityFallbackTargets")
+}
+
+func (s *SettingService) GetRealityAutoRotate() (bool, error) {
+	return s.getBool("realityAutoRotate")
+}
+
+func (s *SettingService) GetDecoyMode() (string, error) {
+	return s.getString("decoyMode")
+}
+
+func (s *SettingService) GetDecoyUrl() (string, error) {
+	return s.getString("decoyUrl")
+}
+
+func (s *SettingService) GetDecoyBanThreshold() (int, error) {
+	return s.getInt("decoyBanThreshold")
+}
+
+func (s *SettingService) GetDecoyBanMinutes() (int, error) {
+	return s.getInt("decoyBanMinutes")
+}
+
+func (s *SettingService) GetDecoyAbuseIpdbKey() (string, error) {
+	return s.getString("decoyAbuseIpdbKey")
+}
+
+func (s *SettingService) GetTunnelMode() (string, error) {
+	return s.getString("tunnelMode")
+}
+
+func (s *SettingService) GetTunnelToken() (string, error) {
+	return s.getString("tunnelToken")
+}
+
+func (s *SettingService) GetTunnelHostname() (string, error) {
+	return s.getString("tunnelHostname")
+}
+
+func (s *SettingService) GetTunnelOnionKey() (string, error) {
+	return s.getString("tunnelOnionKey")
+}
+
+func (s *SettingService) SetTunnelOnionKey(key string) error {
+	return s.setString("tunnelOnionKey", key)
+}
+
+func (s *SettingService) GetApprovalEnable() (bool, error) {
+	return s.getBool("approvalEnable")
+}
+
+func (s *SettingService) GetApprovalMinClients() (int, error) {
+	return s.getInt("approvalMinClients")
+}
+
+func (s *SettingService) GetApprovalWindow() (int, error) {
+	return s.getInt("approvalWindow")
+}
+
+func (s *SettingService) GetReadOnlyMode() (bool, error) {
+	return s.getBool("readOnlyMode")
+}
+
+func (s *SettingService) SetReadOnlyMode(value bool) error {
+	return s.setBool("readOnlyMode", value)
+}
+
+func (s *SettingService) GetUpdateCheckEnable() (bool, error) {
+	return s.getBool("updateCheckEnable")
+}
+
+func (s *SettingService) GetUpdateCheckNotify() (bool, error) {
+	return s.getBool("updateCheckNotify")
+}
+
+func (s *SettingService) GetUpdateNotifiedVersions() (string, error) {
+	return s.getString("updateNotifiedVersions")
+}
+
+func (s *SettingService) SetUpdateNotifiedVersions(versions string) error {
+	return s.setString("updateNotifiedVersions", versions)
+}
+
+func (s *SettingService) GetProfilingEnable() (bool, error) {
+	return s.getBool("profilingEnable")
+}
+
 func (s *SettingService) UpdateAllSetting(allSetting *entity.AllSetting) error {
 	if err := allSetting.CheckValid(); err != nil {
-		return err
+		return common.WithCode(common.ErrCodeSettingInvalid, err)
 	}
 
 	v := reflect.ValueOf(allSetting).Elem()
@@ -686,20 +1301,23 @@ func (s *SettingService) GetDefaultXrayConfig() (any, error) {
 func (s *SettingService) GetDefaultSettings(host string) (any, error) {
 	type settingFunc func() (any, error)
 	settings := map[string]settingFunc{
-		"expireDiff":    func() (any, error) { return s.GetExpireDiff() },
-		"trafficDiff":   func() (any, error) { return s.GetTrafficDiff() },
-		"pageSize":      func() (any, error) { return s.GetPageSize() },
-		"defaultCert":   func() (any, error) { return s.GetCertFile() },
-		"defaultKey":    func() (any, error) { return s.GetKeyFile() },
-		"tgBotEnable":   func() (any, error) { return s.GetTgbotEnabled() },
-		"subEnable":     func() (any, error) { return s.GetSubEnable() },
-		"subJsonEnable": func() (any, error) { return s.GetSubJsonEnable() },
-		"subTitle":      func() (any, error) { return s.GetSubTitle() },
-		"subURI":        func() (any, error) { return s.GetSubURI() },
-		"subJsonURI":    func() (any, error) { return s.GetSubJsonURI() },
-		"remarkModel":   func() (any, error) { return s.GetRemarkModel() },
-		"datepicker":    func() (any, error) { return s.GetDatepicker() },
-		"ipLimitEnable": func() (any, error) { return s.GetIpLimitEnable() },
+		"expireDiff":     func() (any, error) { return s.GetExpireDiff() },
+		"trafficDiff":    func() (any, error) { return s.GetTrafficDiff() },
+		"pageSize":       func() (any, error) { return s.GetPageSize() },
+		"defaultCert":    func() (any, error) { return s.GetCertFile() },
+		"defaultKey":     func() (any, error) { return s.GetKeyFile() },
+		"tgBotEnable":    func() (any, error) { return s.GetTgbotEnabled() },
+		"subEnable":      func() (any, error) { return s.GetSubEnable() },
+		"subJsonEnable":  func() (any, error) { return s.GetSubJsonEnable() },
+		"subTitle":       func() (any, error) { return s.GetSubTitle() },
+		"subURI":         func() (any, error) { return s.GetSubURI() },
+		"subJsonURI":     func() (any, error) { return s.GetSubJsonURI() },
+		"remarkModel":    func() (any, error) { return s.GetRemarkModel() },
+		"remarkTemplate": func() (any, error) { return s.GetRemarkTemplate() },
+		"datepicker":     func() (any, error) { return s.GetDatepicker() },
+		"ipLimitEnable":  func() (any, error) { return s.GetIpLimitEnable() },
+		"clientIpSource": func() (any, error) { return s.HasClientIpSource() },
+		"coreType":       func() (any, error) { return s.GetCoreType() },
 	}
 
 	result := make(map[string]any)
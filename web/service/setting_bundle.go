@@ -0,0 +1,198 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/config"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/util/reflect_util"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+	"github.com/mhsanaei/3x-ui/v2/xray"
+)
+
+// Setting sections that can be selected when exporting or importing a settings bundle.
+const (
+	SettingSectionPanel        = "panel"
+	SettingSectionSecurity     = "security"
+	SettingSectionTelegram     = "telegram"
+	SettingSectionSubscription = "subscription"
+	SettingSectionLdap         = "ldap"
+	SettingSectionPayment      = "payment"
+)
+
+// SettingSections lists every section known to the settings bundle in a stable order.
+var SettingSections = []string{
+	SettingSectionPanel,
+	SettingSectionSecurity,
+	SettingSectionTelegram,
+	SettingSectionSubscription,
+	SettingSectionLdap,
+	SettingSectionPayment,
+}
+
+// settingSection returns the bundle section a setting key belongs to.
+func settingSection(key string) string {
+	switch {
+	case strings.HasPrefix(key, "tg"):
+		return SettingSectionTelegram
+	case strings.HasPrefix(key, "sub"), strings.HasPrefix(key, "externalTraffic"):
+		return SettingSectionSubscription
+	case strings.HasPrefix(key, "ldap"):
+		return SettingSectionLdap
+	case strings.HasPrefix(key, "payment"), strings.HasPrefix(key, "smtp"):
+		return SettingSectionPayment
+	case strings.HasPrefix(key, "twoFactor"), key == "swaggerEnable":
+		return SettingSectionSecurity
+	default:
+		return SettingSectionPanel
+	}
+}
+
+// ParseSettingSections splits a comma separated section list and validates every entry.
+// An empty input selects all sections.
+func ParseSettingSections(raw string) ([]string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return SettingSections, nil
+	}
+	var sections []string
+	for _, section := range strings.Split(raw, ",") {
+		section = strings.ToLower(strings.TrimSpace(section))
+		if section == "" {
+			continue
+		}
+		if !slices.Contains(SettingSections, section) {
+			return nil, common.NewError("unknown settings section:", section)
+		}
+		if !slices.Contains(sections, section) {
+			sections = append(sections, section)
+		}
+	}
+	return sections, nil
+}
+
+// allSettingToMap converts the settings struct to a key/value map using its json tags.
+func allSettingToMap(allSetting *entity.AllSetting) (map[string]any, error) {
+	data, err := json.Marshal(allSetting)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]any{}
+	err = json.Unmarshal(data, &values)
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// ExportSettings builds a settings bundle for the given sections, optionally including the Xray template.
+func (s *SettingService) ExportSettings(sections []string, includeXray bool) (*entity.SettingsBundle, error) {
+	allSetting, err := s.GetAllSetting()
+	if err != nil {
+		return nil, err
+	}
+	values, err := allSettingToMap(allSetting)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := &entity.SettingsBundle{
+		Version:    config.GetVersion(),
+		ExportedAt: time.Now().Unix(),
+		Sections:   make(map[string]map[string]any, len(sections)),
+	}
+	for _, section := range sections {
+		bundle.Sections[section] = map[string]any{}
+	}
+	for key, value := range values {
+		if section, ok := bundle.Sections[settingSection(key)]; ok {
+			section[key] = value
+		}
+	}
+
+	if includeXray {
+		template, err := s.GetXrayConfigTemplate()
+		if err != nil {
+			return nil, err
+		}
+		bundle.XrayTemplateConfig = json.RawMessage(template)
+	}
+	return bundle, nil
+}
+
+// ImportSettings applies the selected sections of a settings bundle on top of the current settings.
+// The merged result is validated before anything is written. It reports whether the Xray template was replaced.
+func (s *SettingService) ImportSettings(bundle *entity.SettingsBundle, sections []string, includeXray bool) (bool, error) {
+	allSetting, err := s.GetAllSetting()
+	if err != nil {
+		return false, err
+	}
+	values, err := allSettingToMap(allSetting)
+	if err != nil {
+		return false, err
+	}
+
+	imported := map[string]bool{}
+	for _, section := range sections {
+		sectionValues, ok := bundle.Sections[section]
+		if !ok {
+			continue
+		}
+		for key, value := range sectionValues {
+			if _, known := values[key]; !known || settingSection(key) != section {
+				return false, common.NewErrorf("setting <%v> does not belong to section <%v>", key, section)
+			}
+			values[key] = value
+			imported[key] = true
+		}
+	}
+
+	var xrayTemplate string
+	if includeXray && len(bundle.XrayTemplateConfig) > 0 {
+		xrayConfig := &xray.Config{}
+		if err := json.Unmarshal(bundle.XrayTemplateConfig, xrayConfig); err != nil {
+			return false, common.NewError("xray template config invalid:", err)
+		}
+		xrayTemplate = string(bundle.XrayTemplateConfig)
+	}
+
+	if len(imported) == 0 && xrayTemplate == "" {
+		return false, common.NewError("nothing to import for the selected sections")
+	}
+
+	data, err := json.Marshal(values)
+	if err != nil {
+		return false, err
+	}
+	merged := &entity.AllSetting{}
+	if err := json.Unmarshal(data, merged); err != nil {
+		return false, common.NewError("settings bundle invalid:", err)
+	}
+	if err := merged.CheckValid(); err != nil {
+		return false, common.WithCode(common.ErrCodeSettingInvalid, err)
+	}
+
+	v := reflect.ValueOf(merged).Elem()
+	fields := reflect_util.GetFields(reflect.TypeOf(merged).Elem())
+	errs := make([]error, 0)
+	for _, field := range fields {
+		key := field.Tag.Get("json")
+		if !imported[key] {
+			continue
+		}
+		value := fmt.Sprint(v.FieldByName(field.Name).Interface())
+		if err := s.saveSetting(key, value); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if xrayTemplate != "" {
+		if err := s.saveSetting("xrayTemplateConfig", xrayTemplate); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return xrayTemplate != "", common.Combine(errs...)
+}
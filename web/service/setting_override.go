@@ -0,0 +1,190 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/goccy/go-yaml"
+	"github.com/mhsanaei/3x-ui/v2/config"
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/reflect_util"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+)
+
+// Sources a setting value can come from, in order of decreasing precedence.
+const (
+	SettingSourceEnv      = "env"
+	SettingSourceFile     = "file"
+	SettingSourceDatabase = "database"
+	SettingSourceDefault  = "default"
+)
+
+// settingEnvPrefix is prepended to the upper snake case setting key to form its environment variable,
+// e.g. webPort is read from XUI_SETTING_WEB_PORT.
+const settingEnvPrefix = "XUI_SETTING_"
+
+type settingOverride struct {
+	value  string
+	source string
+}
+
+var (
+	settingOverrides     map[string]settingOverride
+	settingOverridesOnce sync.Once
+)
+
+// SettingEnvName returns the environment variable that overrides the given setting key.
+func SettingEnvName(key string) string {
+	runes := []rune(key)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return settingEnvPrefix + b.String()
+}
+
+// settingFieldKinds returns the value kind of every overridable setting keyed by its json name.
+func settingFieldKinds() map[string]reflect.Kind {
+	fields := reflect_util.GetFields(reflect.TypeOf(entity.AllSetting{}))
+	kinds := make(map[string]reflect.Kind, len(fields))
+	for _, field := range fields {
+		kinds[field.Tag.Get("json")] = field.Type.Kind()
+	}
+	return kinds
+}
+
+// normalizeSettingValue checks that value fits the setting kind and returns it in the stored string form.
+func normalizeSettingValue(kind reflect.Kind, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	switch kind {
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return "", err
+		}
+		return strconv.Itoa(n), nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatBool(b), nil
+	default:
+		return value, nil
+	}
+}
+
+// loadSettingOverrides reads the settings file and the environment once.
+// Invalid or unknown entries are logged and ignored so a bad override never prevents startup.
+func loadSettingOverrides() map[string]settingOverride {
+	settingOverridesOnce.Do(func() {
+		kinds := settingFieldKinds()
+		overrides := map[string]settingOverride{}
+
+		path := config.GetSettingsFilePath()
+		data, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			logger.Warning("read settings file failed:", err)
+		} else if err == nil {
+			fileValues := map[string]any{}
+			if err := yaml.Unmarshal(data, &fileValues); err != nil {
+				logger.Warning("parse settings file failed:", err)
+			}
+			for key, raw := range fileValues {
+				kind, ok := kinds[key]
+				if !ok {
+					logger.Warningf("settings file %v: unknown setting <%v>", path, key)
+					continue
+				}
+				value, err := normalizeSettingValue(kind, fmt.Sprint(raw))
+				if err != nil {
+					logger.Warningf("settings file %v: invalid value for <%v>: %v", path, key, err)
+					continue
+				}
+				overrides[key] = settingOverride{value: value, source: SettingSourceFile}
+			}
+		}
+
+		for key, kind := range kinds {
+			name := SettingEnvName(key)
+			raw, ok := os.LookupEnv(name)
+			if !ok {
+				continue
+			}
+			value, err := normalizeSettingValue(kind, raw)
+			if err != nil {
+				logger.Warningf("environment %v: invalid value: %v", name, err)
+				continue
+			}
+			overrides[key] = settingOverride{value: value, source: SettingSourceEnv}
+		}
+
+		for key, override := range overrides {
+			logger.Infof("setting <%v> is overridden by %v", key, override.source)
+		}
+		settingOverrides = overrides
+	})
+	return settingOverrides
+}
+
+// getSettingOverride returns the environment or file override for a setting key, if any.
+func getSettingOverride(key string) (settingOverride, bool) {
+	override, ok := loadSettingOverrides()[key]
+	return override, ok
+}
+
+// GetEffectiveSettings returns the value in effect for every setting together with where it came from.
+// Precedence is environment, then settings file, then database, then built-in default.
+func (s *SettingService) GetEffectiveSettings() ([]entity.EffectiveSetting, error) {
+	allSetting, err := s.GetAllSetting()
+	if err != nil {
+		return nil, err
+	}
+	values, err := allSettingToMap(allSetting)
+	if err != nil {
+		return nil, err
+	}
+
+	var storedKeys []string
+	err = database.GetDB().Model(&model.Setting{}).Pluck("key", &storedKeys).Error
+	if err != nil {
+		return nil, err
+	}
+	stored := make(map[string]bool, len(storedKeys))
+	for _, key := range storedKeys {
+		stored[key] = true
+	}
+
+	fields := reflect_util.GetFields(reflect.TypeOf(entity.AllSetting{}))
+	result := make([]entity.EffectiveSetting, 0, len(fields))
+	for _, field := range fields {
+		key := field.Tag.Get("json")
+		source := SettingSourceDefault
+		if override, ok := getSettingOverride(key); ok {
+			source = override.source
+		} else if stored[key] {
+			source = SettingSourceDatabase
+		}
+		result = append(result, entity.EffectiveSetting{
+			Key:    key,
+			Value:  values[key],
+			Source: source,
+			EnvVar: SettingEnvName(key),
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"os"
+	"sync"
+
+	"github.com/mhsanaei/3x-ui/v2/config"
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/util/crypto"
+)
+
+// secretSettings are the settings stored encrypted in the database. They are decrypted
+// transparently when read, so callers always see the plaintext value.
+var secretSettings = map[string]bool{
+	"tgBotToken":          true,
+	"twoFactorToken":      true,
+	"warp":                true,
+	"ldapPassword":        true,
+	"paymentStripeSecret": true,
+	"paymentHmacSecret":   true,
+	"smtpPassword":        true,
+	"ddnsToken":           true,
+	"dnsApiToken":         true,
+	"sshHostKey":          true,
+	"subSignKey":          true,
+	"decoyAbuseIpdbKey":   true,
+	"tunnelToken":         true,
+	"tunnelOnionKey":      true,
+}
+
+// secretDataKeySetting is the setting holding the data key, encrypted with the master key.
+const secretDataKeySetting = "secretDataKey"
+
+var (
+	secretDataKey   []byte
+	secretDataKeyMu sync.Mutex
+)
+
+// getMasterKeys returns the master keys, the one new data keys are encrypted with first. The master key
+// is derived from XUI_SECRET_KEY when it is set, otherwise it is read from the key file, which is created
+// on first use. When XUI_SECRET_KEY is set an existing key file is kept as a fallback, so a data key
+// encrypted with it is moved over to the new master key.
+func getMasterKeys() ([][]byte, error) {
+	keys := make([][]byte, 0, 2)
+	if secret := config.GetSecretKey(); secret != "" {
+		sum := sha256.Sum256([]byte(secret))
+		keys = append(keys, sum[:])
+		if key, err := os.ReadFile(config.GetSecretKeyPath()); err == nil && len(key) == crypto.SecretKeySize {
+			keys = append(keys, key)
+		}
+		return keys, nil
+	}
+	key, err := crypto.LoadOrCreateSecretKey(config.GetSecretKeyPath())
+	if err != nil {
+		return nil, err
+	}
+	return append(keys, key), nil
+}
+
+// getDataKey returns the key secret settings are encrypted with. It is generated on first use and
+// stored in the settings table encrypted with the master key, so the master key can be changed
+// without encrypting every secret again.
+func getDataKey() ([]byte, error) {
+	secretDataKeyMu.Lock()
+	defer secretDataKeyMu.Unlock()
+	if secretDataKey != nil {
+		return secretDataKey, nil
+	}
+	masterKeys, err := getMasterKeys()
+	if err != nil {
+		return nil, err
+	}
+	settingService := &SettingService{}
+
+	setting, err := settingService.getSetting(secretDataKeySetting)
+	if database.IsNotFound(err) {
+		key := make([]byte, crypto.SecretKeySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		wrapped, err := crypto.EncryptSecret(masterKeys[0], base64.StdEncoding.EncodeToString(key))
+		if err != nil {
+			return nil, err
+		}
+		if err := settingService.saveSetting(secretDataKeySetting, wrapped); err != nil {
+			return nil, err
+		}
+		secretDataKey = key
+		return secretDataKey, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	key, i, err := unwrapDataKey(masterKeys, setting.Value)
+	if err != nil {
+		return nil, err
+	}
+	if i > 0 {
+		wrapped, err := crypto.EncryptSecret(masterKeys[0], base64.StdEncoding.EncodeToString(key))
+		if err == nil {
+			err = settingService.saveSetting(secretDataKeySetting, wrapped)
+		}
+		if err != nil {
+			logger.Warning("re-encrypt secret data key failed:", err)
+		} else {
+			logger.Info("Secret data key re-encrypted with the master key from XUI_SECRET_KEY")
+		}
+	}
+	secretDataKey = key
+	return secretDataKey, nil
+}
+
+// unwrapDataKey decrypts a stored data key with the first matching master key and returns the key
+// with the index of that master key.
+func unwrapDataKey(masterKeys [][]byte, wrapped string) ([]byte, int, error) {
+	for i, masterKey := range masterKeys {
+		encoded, err := crypto.DecryptSecret(masterKey, wrapped)
+		if err != nil {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != crypto.SecretKeySize {
+			return nil, 0, common.NewError("the stored secret data key is invalid")
+		}
+		return key, i, nil
+	}
+	return nil, 0, common.NewError("secret settings were encrypted with another master key, set XUI_SECRET_KEY or restore", config.GetSecretKeyPath())
+}
+
+// resetSecretDataKey drops the cached data key, so it is read again after the database was replaced.
+func resetSecretDataKey() {
+	secretDataKeyMu.Lock()
+	defer secretDataKeyMu.Unlock()
+	secretDataKey = nil
+}
+
+// decodeSetting decrypts the stored value of a secret setting. Values encrypted before the data key
+// was introduced were encrypted with the master key directly and are still read.
+func decodeSetting(key string, value string) (string, error) {
+	if !secretSettings[key] || !crypto.IsEncryptedSecret(value) {
+		return value, nil
+	}
+	dataKey, err := getDataKey()
+	if err != nil {
+		return "", err
+	}
+	decoded, err := crypto.DecryptSecret(dataKey, value)
+	if err == nil {
+		return decoded, nil
+	}
+	if legacy, legacyErr := decodeLegacySecret(value); legacyErr == nil {
+		return legacy, nil
+	}
+	return "", err
+}
+
+// decodeLegacySecret decrypts a value encrypted with a master key directly.
+func decodeLegacySecret(value string) (string, error) {
+	masterKeys, err := getMasterKeys()
+	if err != nil {
+		return "", err
+	}
+	for _, masterKey := range masterKeys {
+		if decoded, err := crypto.DecryptSecret(masterKey, value); err == nil {
+			return decoded, nil
+		}
+	}
+	return "", common.NewError("secret setting was encrypted with an unknown key")
+}
+
+// encodeSetting encrypts the value of a secret setting before it is stored.
+func encodeSetting(key string, value string) (string, error) {
+	if !secretSettings[key] {
+		return value, nil
+	}
+	dataKey, err := getDataKey()
+	if err != nil {
+		return "", err
+	}
+	return crypto.EncryptSecret(dataKey, value)
+}
+
+// MigrateSecretSettings encrypts secret settings still stored in plaintext and encrypts the ones
+// encrypted with the master key directly again with the data key.
+func (s *SettingService) MigrateSecretSettings() error {
+	dataKey, err := getDataKey()
+	if err != nil {
+		return err
+	}
+	count := 0
+	var errs []error
+	for key := range secretSettings {
+		setting, err := s.getSetting(key)
+		if database.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		value := setting.Value
+		if value == "" {
+			continue
+		}
+		if crypto.IsEncryptedSecret(value) {
+			if _, err := crypto.DecryptSecret(dataKey, value); err == nil {
+				continue
+			}
+			if value, err = decodeLegacySecret(value); err != nil {
+				errs = append(errs, common.NewErrorf("%s: %v", key, err))
+				continue
+			}
+		}
+		if err := s.saveSetting(key, value); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		count++
+	}
+	if count > 0 {
+		logger.Infof("Encrypted %d secret settings", count)
+	}
+	return common.Combine(errs...)
+}
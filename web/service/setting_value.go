@@ -0,0 +1,73 @@
+package service
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+)
+
+// GetSettingValues returns the settings keyed like the settings API, with the keys sorted.
+func (s *SettingService) GetSettingValues() (map[string]any, []string, error) {
+	allSetting, err := s.GetAllSetting()
+	if err != nil {
+		return nil, nil, err
+	}
+	values, err := allSettingToMap(allSetting)
+	if err != nil {
+		return nil, nil, err
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return values, keys, nil
+}
+
+// IsSecretSetting reports whether a setting is stored encrypted.
+func IsSecretSetting(key string) bool {
+	return secretSettings[key]
+}
+
+// SetSettingValue parses value as the type of the setting, checks that the settings stay valid
+// and stores it.
+func (s *SettingService) SetSettingValue(key string, value string) error {
+	values, _, err := s.GetSettingValues()
+	if err != nil {
+		return err
+	}
+	current, known := values[key]
+	if !known {
+		return common.NewCodeError(common.ErrCodeSettingInvalid, map[string]any{"key": key}, "unknown setting:", key)
+	}
+	if _, overridden := getSettingOverride(key); overridden {
+		return common.NewCodeError(common.ErrCodeSettingInvalid, map[string]any{"key": key}, "setting is overridden by the environment or settings file:", key)
+	}
+	switch current.(type) {
+	case bool:
+		values[key], err = strconv.ParseBool(value)
+	case float64:
+		values[key], err = strconv.ParseInt(value, 10, 64)
+	default:
+		values[key] = value
+	}
+	if err != nil {
+		return common.NewCodeError(common.ErrCodeSettingInvalid, map[string]any{"key": key}, "invalid value for", key+":", value)
+	}
+
+	data, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	merged := &entity.AllSetting{}
+	if err := json.Unmarshal(data, merged); err != nil {
+		return common.NewCodeError(common.ErrCodeSettingInvalid, map[string]any{"key": key}, "invalid value for", key+":", err)
+	}
+	if err := merged.CheckValid(); err != nil {
+		return common.WithCode(common.ErrCodeSettingInvalid, err)
+	}
+	return s.saveSetting(key, settingStrings(merged)[key])
+}
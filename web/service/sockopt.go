@@ -0,0 +1,162 @@
+package service
+
+import (
+	"encoding/json"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+)
+
+// mptcpMinXrayVersion is the first Xray release with the tcpMptcp sockopt.
+var mptcpMinXrayVersion = [3]int{1, 8, 6}
+
+// mergeSockopt writes the structured sockopt fields into the sockopt options of a stream,
+// keeping any other option. Dialer options left at their zero value are removed so Xray
+// falls back to the system defaults.
+func mergeSockopt(options map[string]any, sockopt *entity.InboundSockopt) map[string]any {
+	if options == nil {
+		options = map[string]any{}
+	}
+	options["mark"] = sockopt.Mark
+	options["tproxy"] = sockopt.Tproxy
+	options["domainStrategy"] = sockopt.DomainStrategy
+	for key, value := range map[string]any{
+		"interface":            sockopt.Interface,
+		"tcpMptcp":             sockopt.TcpMptcp,
+		"tcpNoDelay":           sockopt.TcpNoDelay,
+		"tcpCongestion":        sockopt.TcpCongestion,
+		"tcpKeepAliveIdle":     sockopt.TcpKeepAliveIdle,
+		"tcpKeepAliveInterval": sockopt.TcpKeepAliveInterval,
+		"tcpUserTimeout":       sockopt.TcpUserTimeout,
+		"dialerProxy":          sockopt.DialerProxy,
+	} {
+		switch value {
+		case "", false, 0:
+			delete(options, key)
+		default:
+			options[key] = value
+		}
+	}
+	return options
+}
+
+// checkSockoptSupport checks the dialer options against what the host and the running Xray
+// core support. Multipath TCP needs Linux with net.mptcp.enabled and a recent enough core.
+func checkSockoptSupport(sockopt *entity.InboundSockopt) error {
+	if !sockopt.TcpMptcp {
+		return nil
+	}
+	if runtime.GOOS != "linux" {
+		return common.NewError("sockopt tcpMptcp is only supported on Linux")
+	}
+	enabled, err := os.ReadFile("/proc/sys/net/mptcp/enabled")
+	if err != nil || strings.TrimSpace(string(enabled)) != "1" {
+		return common.NewError("sockopt tcpMptcp needs Multipath TCP enabled in the kernel (net.mptcp.enabled=1)")
+	}
+	if p != nil && coreType(p) == CoreXray && !xrayVersionAtLeast(p.GetVersion(), mptcpMinXrayVersion) {
+		return common.NewError("sockopt tcpMptcp is not supported by Xray", p.GetVersion())
+	}
+	return nil
+}
+
+// xrayVersionAtLeast reports whether an Xray version like 25.10.15 is not older than min.
+// Versions that cannot be parsed are assumed to be recent.
+func xrayVersionAtLeast(version string, min [3]int) bool {
+	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	if len(parts) != 3 {
+		return true
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return true
+		}
+		if n != min[i] {
+			return n > min[i]
+		}
+	}
+	return true
+}
+
+// findTemplateOutbound returns the outbounds of an Xray template and the one with the tag.
+func findTemplateOutbound(template map[string]any, tag string) ([]any, map[string]any) {
+	outbounds, _ := template["outbounds"].([]any)
+	for _, o := range outbounds {
+		if outbound, ok := o.(map[string]any); ok && outbound["tag"] == tag {
+			return outbounds, outbound
+		}
+	}
+	return outbounds, nil
+}
+
+// GetOutboundSockopt returns the structured sockopt fields of an outbound of the Xray template.
+func (s *XraySettingService) GetOutboundSockopt(tag string) (*entity.InboundSockopt, error) {
+	templateConfig, err := s.GetXrayConfigTemplate()
+	if err != nil {
+		return nil, err
+	}
+	template := map[string]any{}
+	if err := json.Unmarshal([]byte(templateConfig), &template); err != nil {
+		return nil, err
+	}
+	_, outbound := findTemplateOutbound(template, tag)
+	if outbound == nil {
+		return nil, common.NewError("outbound not found:", tag)
+	}
+	sockopt := DefaultSockopt()
+	stream, _ := outbound["streamSettings"].(map[string]any)
+	if options, ok := stream["sockopt"]; ok {
+		data, err := json.Marshal(options)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, sockopt); err != nil {
+			return nil, err
+		}
+	}
+	return sockopt, nil
+}
+
+// UpdateOutboundSockopt validates the structured sockopt fields and merges them into the
+// stream settings of an outbound of the Xray template, keeping any other sockopt options.
+// The dialer proxy has to be another outbound of the template.
+func (s *XraySettingService) UpdateOutboundSockopt(tag string, sockopt *entity.InboundSockopt) error {
+	if err := checkSockopt(sockopt); err != nil {
+		return common.WithCode(common.ErrCodeValidation, err)
+	}
+	templateConfig, err := s.GetXrayConfigTemplate()
+	if err != nil {
+		return err
+	}
+	template := map[string]any{}
+	if err := json.Unmarshal([]byte(templateConfig), &template); err != nil {
+		return err
+	}
+	outbounds, outbound := findTemplateOutbound(template, tag)
+	if outbound == nil {
+		return common.NewError("outbound not found:", tag)
+	}
+	if sockopt.DialerProxy != "" {
+		if _, proxy := findTemplateOutbound(template, sockopt.DialerProxy); proxy == nil || sockopt.DialerProxy == tag {
+			return common.WithCode(common.ErrCodeValidation, common.NewError("invalid sockopt dialerProxy:", sockopt.DialerProxy))
+		}
+	}
+	stream, _ := outbound["streamSettings"].(map[string]any)
+	if stream == nil {
+		stream = map[string]any{}
+	}
+	options, _ := stream["sockopt"].(map[string]any)
+	stream["sockopt"] = mergeSockopt(options, sockopt)
+	outbound["streamSettings"] = stream
+	template["outbounds"] = outbounds
+
+	data, err := json.MarshalIndent(template, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.SaveXraySetting(string(data))
+}
@@ -0,0 +1,254 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+)
+
+// SpeedLimitService enforces inbound and client speed limits with Linux traffic control (tc).
+// Traffic sent to clients is shaped by HTB classes on the root qdisc of the configured interface,
+// traffic received from them is policed on its ingress qdisc.
+// Inbounds are matched by port and clients by the IPs recorded from the Xray access log or the
+// Xray online stats, so client limits only apply while one of them is enabled. Limits are given
+// in KB/s or Mbit/s. A client limit takes precedence over the limit of the inbound it connects
+// to. While limits are active the panel owns the root qdisc of the interface and replaces any
+// qdisc set up by other tools.
+type SpeedLimitService struct {
+	settingService SettingService
+	inboundService InboundService
+}
+
+// speedRule caps the traffic of an inbound port or of a client IP.
+type speedRule struct {
+	port  int
+	ip    string
+	rate  int64 // kbit/s
+	burst int64 // KB
+}
+
+// Units speed limits are given in.
+const (
+	SpeedUnitKBps = ""
+	SpeedUnitMbps = "mbit"
+)
+
+var (
+	speedLimitLock   sync.Mutex
+	speedLimitIface  string
+	speedLimitScript string
+
+	ifaceNameRegex = regexp.MustCompile(`^[A-Za-z0-9_.:@-]{1,15}$`)
+)
+
+// Apply brings the tc configuration in line with the current limits.
+// tc is only invoked when the interface or the rules changed since the last call.
+func (s *SpeedLimitService) Apply() error {
+	iface, err := s.settingService.GetSpeedLimitInterface()
+	if err != nil {
+		return err
+	}
+	if iface != "" && !ifaceNameRegex.MatchString(iface) {
+		return common.NewError("invalid network interface:", iface)
+	}
+
+	speedLimitLock.Lock()
+	defer speedLimitLock.Unlock()
+
+	if speedLimitIface != "" && speedLimitIface != iface {
+		clearSpeedLimits(speedLimitIface)
+		speedLimitIface = ""
+		speedLimitScript = ""
+	}
+	if iface == "" {
+		return nil
+	}
+
+	rules, err := s.collectRules()
+	if err != nil {
+		return err
+	}
+	script := buildSpeedLimitScript(iface, rules)
+	if iface == speedLimitIface && script == speedLimitScript {
+		return nil
+	}
+	if script == "" && speedLimitScript == "" {
+		// Nothing installed and nothing to install: leave the qdiscs of the interface alone
+		speedLimitIface = iface
+		return nil
+	}
+
+	if _, err = exec.LookPath("tc"); err != nil {
+		return common.NewError("tc is required for speed limits:", err)
+	}
+	clearSpeedLimits(iface)
+	speedLimitIface = iface
+	speedLimitScript = ""
+	if script != "" {
+		if err = runTc(script); err != nil {
+			clearSpeedLimits(iface)
+			return err
+		}
+		logger.Infof("Applied %d speed limit rules on %s", len(rules), iface)
+	}
+	speedLimitScript = script
+	return nil
+}
+
+// collectRules gathers the limits of enabled inbounds and of their enabled clients with known IPs.
+func (s *SpeedLimitService) collectRules() ([]speedRule, error) {
+	db := database.GetDB()
+	var inbounds []*model.Inbound
+	err := db.Model(model.Inbound{}).Where("enable = ?", true).Order("id").Find(&inbounds).Error
+	if err != nil {
+		return nil, err
+	}
+
+	throttleSpeed, err := s.settingService.GetExpiryThrottleSpeed()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix() * 1000
+
+	var rules []speedRule
+	seenIps := map[string]bool{}
+	for _, inbound := range inbounds {
+		if inbound.SpeedLimit > 0 {
+			// Inbounds with extra ports are capped on each of their ports
+			for _, port := range inbound.ListenPorts() {
+				rules = append(rules, speedRule{port: port, rate: speedRateKbit(inbound.SpeedLimit, inbound.SpeedUnit), burst: inbound.SpeedBurst})
+			}
+		}
+		clients, err := s.inboundService.GetClients(inbound)
+		if err != nil {
+			continue
+		}
+		for _, client := range clients {
+			rate, burst := speedRateKbit(client.SpeedLimit, client.SpeedUnit), client.SpeedBurst
+			if client.ExpiryAction == ExpiryActionThrottle && client.ExpiryTime > 0 && client.ExpiryTime <= now && throttleSpeed > 0 {
+				rate, burst = speedRateKbit(int64(throttleSpeed), SpeedUnitKBps), 0
+			}
+			if !client.Enable || rate <= 0 {
+				continue
+			}
+			for _, ip := range s.getClientIps(client.Email) {
+				if seenIps[ip] {
+					continue
+				}
+				seenIps[ip] = true
+				rules = append(rules, speedRule{ip: ip, rate: rate, burst: burst})
+			}
+		}
+	}
+	return rules, nil
+}
+
+// speedRateKbit converts a speed limit given in the unit to kbit/s.
+func speedRateKbit(rate int64, unit string) int64 {
+	if unit == SpeedUnitMbps {
+		return rate * 1000
+	}
+	return rate * 8
+}
+
+// checkSpeedUnits rejects speed limits of the inbound or its clients given in an unknown unit.
+func (s *InboundService) checkSpeedUnits(inbound *model.Inbound) error {
+	if inbound.SpeedUnit != SpeedUnitKBps && inbound.SpeedUnit != SpeedUnitMbps {
+		return common.NewError("unknown speed limit unit:", inbound.SpeedUnit)
+	}
+	clients, err := s.GetClients(inbound)
+	if err != nil {
+		return err
+	}
+	for _, client := range clients {
+		if client.SpeedUnit != SpeedUnitKBps && client.SpeedUnit != SpeedUnitMbps {
+			return common.NewErrorf("unknown speed limit unit of client %s: %s", client.Email, client.SpeedUnit)
+		}
+	}
+	return nil
+}
+
+func (s *SpeedLimitService) getClientIps(email string) []string {
+	raw, err := s.inboundService.GetInboundClientIps(email)
+	if err != nil || raw == "" {
+		return nil
+	}
+	var entries []string
+	if json.Unmarshal([]byte(raw), &entries) != nil {
+		return nil
+	}
+	ips := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		if ip := net.ParseIP(fields[0]); ip != nil {
+			ips = append(ips, ip.String())
+		}
+	}
+	return ips
+}
+
+// buildSpeedLimitScript renders the rules as a tc batch script. Client rules get a higher priority than port rules.
+func buildSpeedLimitScript(iface string, rules []speedRule) string {
+	if len(rules) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "qdisc add dev %s root handle 1: htb default 1\n", iface)
+	fmt.Fprintf(&sb, "class add dev %s parent 1: classid 1:1 htb rate 10gbit\n", iface)
+	fmt.Fprintf(&sb, "qdisc add dev %s handle ffff: ingress\n", iface)
+	for i, rule := range rules {
+		classId := i + 0x10
+		rate := rule.rate
+		burst := rule.burst
+		if burst <= 0 {
+			burst = max(rule.rate/8, 1)
+		}
+		fmt.Fprintf(&sb, "class add dev %s parent 1: classid 1:%x htb rate %dkbit ceil %dkbit burst %dk\n", iface, classId, rate, rate, burst)
+		police := fmt.Sprintf("police rate %dkbit burst %dk drop flowid :1", rate, burst)
+
+		if rule.ip != "" {
+			if ip := net.ParseIP(rule.ip); ip.To4() != nil {
+				fmt.Fprintf(&sb, "filter add dev %s parent 1: protocol ip prio 1 u32 match ip dst %s/32 flowid 1:%x\n", iface, rule.ip, classId)
+				fmt.Fprintf(&sb, "filter add dev %s parent ffff: protocol ip prio 1 u32 match ip src %s/32 %s\n", iface, rule.ip, police)
+			} else {
+				fmt.Fprintf(&sb, "filter add dev %s parent 1: protocol ipv6 prio 2 u32 match ip6 dst %s/128 flowid 1:%x\n", iface, rule.ip, classId)
+				fmt.Fprintf(&sb, "filter add dev %s parent ffff: protocol ipv6 prio 2 u32 match ip6 src %s/128 %s\n", iface, rule.ip, police)
+			}
+			continue
+		}
+		fmt.Fprintf(&sb, "filter add dev %s parent 1: protocol ip prio 3 u32 match ip sport %d 0xffff flowid 1:%x\n", iface, rule.port, classId)
+		fmt.Fprintf(&sb, "filter add dev %s parent 1: protocol ipv6 prio 4 u32 match ip6 sport %d 0xffff flowid 1:%x\n", iface, rule.port, classId)
+		fmt.Fprintf(&sb, "filter add dev %s parent ffff: protocol ip prio 3 u32 match ip dport %d 0xffff %s\n", iface, rule.port, police)
+		fmt.Fprintf(&sb, "filter add dev %s parent ffff: protocol ipv6 prio 4 u32 match ip6 dport %d 0xffff %s\n", iface, rule.port, police)
+	}
+	return sb.String()
+}
+
+// clearSpeedLimits removes the qdiscs installed by the panel. Missing qdiscs are not an error.
+func clearSpeedLimits(iface string) {
+	exec.Command("tc", "qdisc", "del", "dev", iface, "root").Run()
+	exec.Command("tc", "qdisc", "del", "dev", iface, "ingress").Run()
+}
+
+func runTc(script string) error {
+	cmd := exec.Command("tc", "-batch", "-")
+	cmd.Stdin = strings.NewReader(script)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return common.NewErrorf("tc failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
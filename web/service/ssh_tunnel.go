@@ -0,0 +1,156 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/sshtunnel"
+	"github.com/mhsanaei/3x-ui/v2/xray"
+)
+
+var (
+	sshServer     *sshtunnel.Server
+	sshServerPort int
+	sshLock       sync.Mutex
+)
+
+// SSHTunnelService runs the embedded SSH server that forwards connections for the clients of
+// the chosen inbounds. Clients log in with their email and their ID or password, their IP limit
+// caps their concurrent SSH connections, and their traffic counts against their quota.
+type SSHTunnelService struct {
+	inboundService InboundService
+	settingService SettingService
+}
+
+// GetSshInboundIds returns the IDs of the inbounds whose clients get SSH accounts.
+func (s *SSHTunnelService) GetSshInboundIds() (map[int]bool, error) {
+	value, err := s.settingService.GetSshInboundIds()
+	if err != nil {
+		return nil, err
+	}
+	return ParseInboundIds(value), nil
+}
+
+// getAccounts returns the accounts of the enabled clients of the chosen enabled inbounds.
+func (s *SSHTunnelService) getAccounts() ([]sshtunnel.Account, error) {
+	ids, err := s.GetSshInboundIds()
+	if err != nil {
+		return nil, err
+	}
+	clients, err := s.inboundService.GetActiveClients(ids)
+	if err != nil {
+		return nil, err
+	}
+	var accounts []sshtunnel.Account
+	for _, client := range clients {
+		if password := ClientSecret(&client); password != "" {
+			accounts = append(accounts, sshtunnel.Account{User: client.Email, Password: password, MaxConns: client.LimitIP})
+		}
+	}
+	return accounts, nil
+}
+
+// getHostKey returns the host key of the server, generating and storing it on first use so
+// clients keep seeing the same key.
+func (s *SSHTunnelService) getHostKey() (string, error) {
+	key, err := s.settingService.GetSshHostKey()
+	if err != nil || key != "" {
+		return key, err
+	}
+	key, err = sshtunnel.GenerateHostKey()
+	if err != nil {
+		return "", err
+	}
+	return key, s.settingService.SetSshHostKey(key)
+}
+
+// Sync starts or stops the server to match the settings and updates its accounts.
+func (s *SSHTunnelService) Sync() error {
+	enable, err := s.settingService.GetSshEnable()
+	if err != nil {
+		return err
+	}
+	port, err := s.settingService.GetSshPort()
+	if err != nil {
+		return err
+	}
+	sshLock.Lock()
+	defer sshLock.Unlock()
+
+	if sshServer != nil && (!enable || port != sshServerPort) {
+		logger.Info("Stopping the SSH tunnel server")
+		sshServer.Close()
+		sshServer = nil
+	}
+	if !enable {
+		return nil
+	}
+
+	accounts, err := s.getAccounts()
+	if err != nil {
+		return err
+	}
+	if sshServer == nil {
+		hostKey, err := s.getHostKey()
+		if err != nil {
+			return err
+		}
+		server, err := sshtunnel.NewServer(hostKey)
+		if err != nil {
+			return err
+		}
+		server.SetAccounts(accounts)
+		if err := server.Listen(port); err != nil {
+			return err
+		}
+		logger.Infof("SSH tunnel server listening on port %d", port)
+		sshServer = server
+		sshServerPort = port
+		return nil
+	}
+	sshServer.SetAccounts(accounts)
+	return nil
+}
+
+// Stop stops the server if it is running.
+func (s *SSHTunnelService) Stop() error {
+	sshLock.Lock()
+	defer sshLock.Unlock()
+	if sshServer == nil {
+		return nil
+	}
+	err := sshServer.Close()
+	sshServer = nil
+	return err
+}
+
+// GetSessions returns the open SSH sessions.
+func (s *SSHTunnelService) GetSessions() []sshtunnel.Session {
+	sshLock.Lock()
+	defer sshLock.Unlock()
+	if sshServer == nil {
+		return []sshtunnel.Session{}
+	}
+	return sshServer.Sessions()
+}
+
+// CollectTraffic counts the traffic forwarded since the last collection to the clients, and
+// returns whether the core has to restart because clients were disabled.
+func (s *SSHTunnelService) CollectTraffic() (bool, error) {
+	sshLock.Lock()
+	if sshServer == nil {
+		sshLock.Unlock()
+		return false, nil
+	}
+	usage := sshServer.TakeTraffic()
+	sshLock.Unlock()
+	if len(usage) == 0 {
+		return false, nil
+	}
+	clientTraffics := make([]*xray.ClientTraffic, 0, len(usage))
+	for email, u := range usage {
+		clientTraffics = append(clientTraffics, &xray.ClientTraffic{Email: email, Up: u.Up, Down: u.Down})
+	}
+	err, needRestart := s.inboundService.AddAccountTraffic(clientTraffics)
+	return needRestart, err
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+)
+
+// stateClientSecrets are the client fields holding credentials, left out of the state unless requested.
+var stateClientSecrets = []string{"id", "password", "auth"}
+
+// State returns the panel state as a document the apply endpoint accepts, with its ETag. The document
+// is deterministic: inbounds are sorted by tag, object keys are sorted, and traffic counters and client
+// timestamps are left out, so the ETag only changes when the configuration does. Secret settings, client
+// credentials and private keys are left out unless includeSecrets is set; applying the document keeps
+// what it does not declare, so a document without secrets can still be applied.
+func (s *ApplyService) State(includeSecrets bool) (*entity.PanelState, string, error) {
+	allSetting, err := s.settingService.GetAllSetting()
+	if err != nil {
+		return nil, "", err
+	}
+	settings, err := allSettingToMap(allSetting)
+	if err != nil {
+		return nil, "", err
+	}
+	for key := range settings {
+		if _, overridden := getSettingOverride(key); overridden || (!includeSecrets && secretSettings[key]) {
+			delete(settings, key)
+		}
+	}
+
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return nil, "", err
+	}
+	sort.Slice(inbounds, func(i, j int) bool { return inbounds[i].Tag < inbounds[j].Tag })
+	state := &entity.PanelState{
+		Settings: settings,
+		Inbounds: make([]entity.ApplyInbound, 0, len(inbounds)),
+		Secrets:  includeSecrets,
+	}
+	for _, inbound := range inbounds {
+		state.Inbounds = append(state.Inbounds, stateInbound(inbound, includeSecrets))
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(data)
+	return state, `"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+// stateInbound converts an inbound to its declared form.
+func stateInbound(inbound *model.Inbound, includeSecrets bool) entity.ApplyInbound {
+	enable := inbound.Enable
+	declared := entity.ApplyInbound{
+		ExternalId:      inbound.ExternalId,
+		Remark:          inbound.Remark,
+		RemarkTemplate:  inbound.RemarkTemplate,
+		Group:           inbound.Group,
+		Enable:          &enable,
+		Listen:          inbound.Listen,
+		Port:            inbound.Port,
+		Protocol:        inbound.Protocol,
+		Total:           inbound.Total,
+		ExpiryTime:      inbound.ExpiryTime,
+		TrafficReset:    inbound.TrafficReset,
+		SpeedLimit:      inbound.SpeedLimit,
+		SpeedBurst:      inbound.SpeedBurst,
+		SpeedUnit:       inbound.SpeedUnit,
+		ConnLimit:       inbound.ConnLimit,
+		ConnLimitPerIp:  inbound.ConnLimitPerIp,
+		PortHopRange:    inbound.PortHopRange,
+		PortHopInterval: inbound.PortHopInterval,
+		ExtraPorts:      inbound.ExtraPorts,
+		SubPortMode:     inbound.SubPortMode,
+		SubExclude:      inbound.SubExclude,
+		ExtraListens:    inbound.ExtraListens,
+		Settings:        comparableJSON(inbound.Settings, true),
+		StreamSettings:  comparableJSON(inbound.StreamSettings, false),
+		Sniffing:        comparableJSON(inbound.Sniffing, false),
+		Extension:       comparableJSON(inbound.Extension, false),
+	}
+	if !includeSecrets {
+		redactInboundSecrets(declared.Settings, declared.StreamSettings)
+	}
+	return declared
+}
+
+// redactInboundSecrets removes the client credentials, the inbound password and the TLS and
+// Reality private keys from decoded inbound settings.
+func redactInboundSecrets(settings any, streamSettings any) {
+	if settings, ok := settings.(map[string]any); ok {
+		delete(settings, "password")
+		if clients, ok := settings["clients"].([]any); ok {
+			for _, client := range clients {
+				if c, ok := client.(map[string]any); ok {
+					for _, key := range stateClientSecrets {
+						delete(c, key)
+					}
+				}
+			}
+		}
+	}
+	stream, ok := streamSettings.(map[string]any)
+	if !ok {
+		return
+	}
+	if reality, ok := stream["realitySettings"].(map[string]any); ok {
+		delete(reality, "privateKey")
+	}
+	if tls, ok := stream["tlsSettings"].(map[string]any); ok {
+		if certificates, ok := tls["certificates"].([]any); ok {
+			for _, certificate := range certificates {
+				if c, ok := certificate.(map[string]any); ok {
+					delete(c, "key")
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/config"
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+
+	"github.com/shirou/gopsutil/v4/disk"
+)
+
+// storageStatusTTL bounds how often the storage status is collected, as walking the log directory is not free.
+const storageStatusTTL = time.Minute
+
+// StorageStatus describes the disk usage of the panel's data.
+type StorageStatus struct {
+	Current       uint64 `json:"current"`       // Used bytes of the file system holding the data directory
+	Total         uint64 `json:"total"`         // Size of the file system holding the data directory
+	InodesCurrent uint64 `json:"inodesCurrent"` // Used inodes of the file system holding the data directory
+	InodesTotal   uint64 `json:"inodesTotal"`   // Inodes of the file system holding the data directory
+	DbSize        uint64 `json:"dbSize"`        // Size of the SQLite database
+	WalSize       uint64 `json:"walSize"`       // Size of the SQLite write-ahead log
+	LogSize       uint64 `json:"logSize"`       // Size of the log directory
+}
+
+var (
+	storageStatusLock sync.Mutex
+	storageStatus     StorageStatus
+	storageStatusAt   time.Time
+)
+
+// GetStorageStatus returns the disk usage of the data directory, the database and the log directory.
+// The result is cached for a minute.
+func (s *ServerService) GetStorageStatus() StorageStatus {
+	storageStatusLock.Lock()
+	defer storageStatusLock.Unlock()
+	if time.Since(storageStatusAt) < storageStatusTTL {
+		return storageStatus
+	}
+
+	status := StorageStatus{}
+	usage, err := disk.Usage(config.GetDBFolderPath())
+	if err != nil {
+		logger.Warning("get data directory usage failed:", err)
+	} else {
+		status.Current = usage.Used
+		status.Total = usage.Total
+		status.InodesCurrent = usage.InodesUsed
+		status.InodesTotal = usage.InodesTotal
+	}
+	status.DbSize = fileSize(config.GetDBPath())
+	status.WalSize = fileSize(config.GetDBPath() + "-wal")
+	status.LogSize = dirSize(config.GetLogFolder())
+
+	storageStatus = status
+	storageStatusAt = time.Now()
+	return status
+}
+
+// VacuumDB compacts the database and truncates its WAL file.
+func (s *ServerService) VacuumDB() (*entity.VacuumResult, error) {
+	dbPath := config.GetDBPath()
+	result := &entity.VacuumResult{SizeBefore: fileSize(dbPath) + fileSize(dbPath+"-wal")}
+	if err := database.Vacuum(); err != nil {
+		return nil, err
+	}
+	result.SizeAfter = fileSize(dbPath) + fileSize(dbPath+"-wal")
+	resetStorageStatus()
+	logger.Infof("Database compacted from %d to %d bytes", result.SizeBefore, result.SizeAfter)
+	return result, nil
+}
+
+// resetStorageStatus makes the next GetStorageStatus collect fresh numbers.
+func resetStorageStatus() {
+	storageStatusLock.Lock()
+	storageStatusAt = time.Time{}
+	storageStatusLock.Unlock()
+}
+
+func fileSize(path string) uint64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return uint64(info.Size())
+}
+
+func dirSize(path string) uint64 {
+	var size uint64
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += uint64(info.Size())
+			}
+		}
+		return nil
+	})
+	return size
+}
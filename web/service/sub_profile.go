@@ -0,0 +1,106 @@
+package service
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/util/link"
+
+	"gorm.io/gorm"
+)
+
+// subProfileName matches the names profiles can have in URLs.
+var subProfileName = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// SubProfileService manages subscription profiles, named views of subscriptions selecting some
+// of their inbounds and the output format.
+type SubProfileService struct{}
+
+func checkSubProfile(profile *model.SubProfile) error {
+	profile.SubId = strings.TrimSpace(profile.SubId)
+	profile.Name = strings.ToLower(strings.TrimSpace(profile.Name))
+	if !subProfileName.MatchString(profile.Name) {
+		return common.NewError("invalid subscription profile name, use up to 32 letters, digits, - and _:", profile.Name)
+	}
+	for _, id := range splitTrimmed(profile.InboundIds) {
+		if _, err := strconv.Atoi(id); err != nil {
+			return common.NewError("invalid subscription profile inbound id:", id)
+		}
+	}
+	switch profile.Format {
+	case "", "base64", "plain", "json":
+	default:
+		return common.NewError("invalid subscription profile format:", profile.Format)
+	}
+	values, err := url.ParseQuery(profile.Options)
+	if err != nil {
+		return common.NewError("invalid subscription profile options:", err)
+	}
+	if _, err := link.ParseQuery(values); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetProfiles returns the subscription profiles, those of one subscription and the shared ones
+// when subId is given.
+func (s *SubProfileService) GetProfiles(subId string) ([]*model.SubProfile, error) {
+	db := database.GetDB().Model(model.SubProfile{})
+	if subId != "" {
+		db = db.Where("sub_id = ? OR sub_id = ?", subId, "")
+	}
+	profiles := []*model.SubProfile{}
+	err := db.Order("sub_id").Order("name").Find(&profiles).Error
+	return profiles, err
+}
+
+// GetProfile returns the profile of a subscription with the name, preferring its own profile
+// over a shared one. Nil is returned when there is none.
+func (s *SubProfileService) GetProfile(subId string, name string) (*model.SubProfile, error) {
+	var profiles []*model.SubProfile
+	err := database.GetDB().Model(model.SubProfile{}).
+		Where("name = ? AND (sub_id = ? OR sub_id = ?)", strings.ToLower(name), subId, "").
+		Order("sub_id DESC").Limit(1).Find(&profiles).Error
+	if err != nil || len(profiles) == 0 {
+		return nil, err
+	}
+	return profiles[0], nil
+}
+
+// AddProfile validates and stores a new subscription profile.
+func (s *SubProfileService) AddProfile(profile *model.SubProfile) error {
+	if err := checkSubProfile(profile); err != nil {
+		return common.WithCode(common.ErrCodeValidation, err)
+	}
+	profile.Id = 0
+	return database.GetDB().Create(profile).Error
+}
+
+// UpdateProfile validates and updates a subscription profile.
+func (s *SubProfileService) UpdateProfile(profile *model.SubProfile) error {
+	if err := checkSubProfile(profile); err != nil {
+		return common.WithCode(common.ErrCodeValidation, err)
+	}
+	db := database.GetDB()
+	if err := db.First(&model.SubProfile{}, profile.Id).Error; err != nil {
+		return err
+	}
+	return db.Save(profile).Error
+}
+
+// DelProfile deletes a subscription profile.
+func (s *SubProfileService) DelProfile(id int) error {
+	result := database.GetDB().Delete(model.SubProfile{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
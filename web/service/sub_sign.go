@@ -0,0 +1,107 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"sync"
+
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+)
+
+// subSignKeyLock keeps concurrent requests from generating different keys on first use.
+var subSignKeyLock sync.Mutex
+
+// SubSignature is the detached signature of a subscription payload with the headers it is sent in.
+type SubSignature struct {
+	KeyId     string // ID of the key the payload was signed with
+	Signature string // Ed25519 signature of the payload in standard base64
+	Digest    string // SHA-256 digest of the payload in standard base64
+}
+
+// SubSignService signs subscription payloads with the Ed25519 key of the panel, so clients and
+// middleboxes can check the payload was not changed on the way through a CDN or proxy.
+type SubSignService struct {
+	settingService SettingService
+}
+
+// key returns the signing key, generating and storing it on first use so signatures keep
+// verifying with the published public key.
+func (s *SubSignService) key() (ed25519.PrivateKey, error) {
+	subSignKeyLock.Lock()
+	defer subSignKeyLock.Unlock()
+	value, err := s.settingService.GetSubSignKey()
+	if err != nil {
+		return nil, err
+	}
+	if value != "" {
+		seed, err := base64.StdEncoding.DecodeString(value)
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, common.NewError("invalid subscription signing key")
+		}
+		return ed25519.NewKeyFromSeed(seed), nil
+	}
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return key, s.settingService.SetSubSignKey(base64.StdEncoding.EncodeToString(key.Seed()))
+}
+
+// subSignKeyId returns the ID of a public key, the first bytes of its SHA-256 hash in hex.
+func subSignKeyId(publicKey ed25519.PublicKey) string {
+	sum := sha256.Sum256(publicKey)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Sign returns the signature of a subscription payload, or nil when signing is disabled.
+func (s *SubSignService) Sign(payload []byte) (*SubSignature, error) {
+	enabled, err := s.settingService.GetSubSign()
+	if err != nil || !enabled {
+		return nil, err
+	}
+	key, err := s.key()
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(payload)
+	return &SubSignature{
+		KeyId:     subSignKeyId(key.Public().(ed25519.PublicKey)),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload)),
+		Digest:    base64.StdEncoding.EncodeToString(digest[:]),
+	}, nil
+}
+
+// GetPublicKey returns the public key signatures verify with.
+func (s *SubSignService) GetPublicKey() (*entity.SubSignKey, error) {
+	key, err := s.key()
+	if err != nil {
+		return nil, err
+	}
+	enabled, err := s.settingService.GetSubSign()
+	if err != nil {
+		return nil, err
+	}
+	publicKey := key.Public().(ed25519.PublicKey)
+	return &entity.SubSignKey{
+		Algorithm: "ed25519",
+		KeyId:     subSignKeyId(publicKey),
+		PublicKey: base64.StdEncoding.EncodeToString(publicKey),
+		Enabled:   enabled,
+	}, nil
+}
+
+// RotateKey replaces the signing key with a new one. Clients have to fetch the new public key,
+// signatures made with the old one no longer verify.
+func (s *SubSignService) RotateKey() (*entity.SubSignKey, error) {
+	subSignKeyLock.Lock()
+	err := s.settingService.SetSubSignKey("")
+	subSignKeyLock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return s.GetPublicKey()
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/mhsanaei/3x-ui/v2/config"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+)
+
+// sysctlTuneFile persists the tuned values across reboots.
+const sysctlTuneFile = "/etc/sysctl.d/99-x-ui.conf"
+
+// sysctlTunes is the curated set of network settings applied by TuneSysctls, in the order they are applied.
+var sysctlTunes = []struct {
+	key   string
+	value string
+}{
+	{"net.core.default_qdisc", "fq"},
+	{"net.ipv4.tcp_congestion_control", "bbr"},
+	{"fs.file-max", "1048576"},
+	{"fs.nr_open", "1048576"},
+	{"net.core.somaxconn", "32768"},
+	{"net.core.netdev_max_backlog", "16384"},
+	{"net.core.rmem_max", "16777216"},
+	{"net.core.wmem_max", "16777216"},
+	{"net.ipv4.tcp_rmem", "4096 87380 16777216"},
+	{"net.ipv4.tcp_wmem", "4096 65536 16777216"},
+	{"net.ipv4.tcp_fastopen", "3"},
+	{"net.ipv4.tcp_mtu_probing", "1"},
+	{"net.ipv4.tcp_slow_start_after_idle", "0"},
+	{"net.ipv4.ip_local_port_range", "10000 65000"},
+}
+
+func sysctlBackupPath() string {
+	return filepath.Join(config.GetDBFolderPath(), "sysctl-backup.json")
+}
+
+func sysctlPath(key string) string {
+	return filepath.Join("/proc/sys", strings.ReplaceAll(key, ".", "/"))
+}
+
+func readSysctl(key string) (string, error) {
+	data, err := os.ReadFile(sysctlPath(key))
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(strings.Fields(string(data)), " "), nil
+}
+
+func writeSysctl(key string, value string) error {
+	return os.WriteFile(sysctlPath(key), []byte(value), 0o644)
+}
+
+// ensureBBR loads the BBR congestion control module when the kernel does not offer it yet.
+func ensureBBR() error {
+	available, _ := readSysctl("net.ipv4.tcp_available_congestion_control")
+	if strings.Contains(" "+available+" ", " bbr ") {
+		return nil
+	}
+	if output, err := exec.Command("modprobe", "tcp_bbr").CombinedOutput(); err != nil {
+		return common.NewErrorf("BBR is not available: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// TuneSysctls applies the curated network settings: BBR congestion control with the fq qdisc,
+// higher file descriptor limits and larger TCP buffers. In preview mode nothing is changed and the
+// returned list shows what would change. The previous values are saved so RollbackSysctls can restore
+// them, and the tuned values are written to /etc/sysctl.d so they survive a reboot.
+func (s *ServerService) TuneSysctls(preview bool) ([]entity.SysctlChange, error) {
+	if runtime.GOOS != "linux" {
+		return nil, common.NewError("sysctl tuning is only supported on Linux")
+	}
+
+	changes := make([]entity.SysctlChange, 0, len(sysctlTunes))
+	for _, tune := range sysctlTunes {
+		change := entity.SysctlChange{Key: tune.key, New: tune.value}
+		old, err := readSysctl(tune.key)
+		if err != nil {
+			change.Error = err.Error()
+		}
+		change.Old = old
+		change.Changed = err == nil && old != tune.value
+		changes = append(changes, change)
+	}
+	if preview {
+		return changes, nil
+	}
+
+	// Keep the values from before the first tuning, so repeated tuning does not lose them
+	backup := map[string]string{}
+	if data, err := os.ReadFile(sysctlBackupPath()); err == nil {
+		json.Unmarshal(data, &backup)
+	}
+	var conf strings.Builder
+	conf.WriteString("# Network tuning applied by the x-ui panel\n")
+	for i := range changes {
+		change := &changes[i]
+		if change.Error != "" {
+			continue
+		}
+		if change.Key == "net.ipv4.tcp_congestion_control" && change.Changed {
+			if err := ensureBBR(); err != nil {
+				change.Error = err.Error()
+				change.Changed = false
+				continue
+			}
+		}
+		if change.Changed {
+			if err := writeSysctl(change.Key, change.New); err != nil {
+				change.Error = err.Error()
+				change.Changed = false
+				continue
+			}
+			if _, ok := backup[change.Key]; !ok {
+				backup[change.Key] = change.Old
+			}
+		}
+		fmt.Fprintf(&conf, "%s = %s\n", change.Key, change.New)
+	}
+
+	data, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return changes, err
+	}
+	if err := os.WriteFile(sysctlBackupPath(), data, 0o600); err != nil {
+		return changes, err
+	}
+	if err := os.WriteFile(sysctlTuneFile, []byte(conf.String()), 0o644); err != nil {
+		return changes, err
+	}
+	logger.Info("Network sysctls tuned")
+	return changes, nil
+}
+
+// RollbackSysctls restores the values saved by TuneSysctls and removes the persisted settings.
+// In preview mode nothing is changed and the returned list shows what would change.
+func (s *ServerService) RollbackSysctls(preview bool) ([]entity.SysctlChange, error) {
+	data, err := os.ReadFile(sysctlBackupPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, common.NewError("no sysctl tuning to roll back")
+		}
+		return nil, err
+	}
+	backup := map[string]string{}
+	if err := json.Unmarshal(data, &backup); err != nil {
+		return nil, err
+	}
+
+	changes := make([]entity.SysctlChange, 0, len(backup))
+	for _, tune := range sysctlTunes {
+		value, ok := backup[tune.key]
+		if !ok {
+			continue
+		}
+		change := entity.SysctlChange{Key: tune.key, New: value}
+		old, err := readSysctl(tune.key)
+		change.Old = old
+		change.Changed = err == nil && old != value
+		if err != nil {
+			change.Error = err.Error()
+		} else if change.Changed && !preview {
+			if err := writeSysctl(tune.key, value); err != nil {
+				change.Error = err.Error()
+				change.Changed = false
+			}
+		}
+		changes = append(changes, change)
+	}
+	if preview {
+		return changes, nil
+	}
+
+	if err := os.Remove(sysctlTuneFile); err != nil && !os.IsNotExist(err) {
+		return changes, err
+	}
+	if err := os.Remove(sysctlBackupPath()); err != nil {
+		return changes, err
+	}
+	logger.Info("Network sysctl tuning rolled back")
+	return changes, nil
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+)
+
+// maxJournalLines bounds the journal tail returned by GetUnitJournal.
+const maxJournalLines = 10000
+
+// systemUnits are the systemd units that can be queried. Xray normally runs as a child of
+// the x-ui service, the xray unit only exists when Xray was installed as its own service.
+var systemUnits = map[string]bool{
+	"x-ui": true,
+	"xray": true,
+}
+
+func checkSystemUnit(unit string) error {
+	if runtime.GOOS != "linux" {
+		return common.NewError("systemd is only supported on Linux")
+	}
+	if !systemUnits[unit] {
+		return common.NewError("unknown unit:", unit)
+	}
+	return nil
+}
+
+// GetUnitStatus returns the state of the x-ui or xray systemd unit.
+func (s *ServerService) GetUnitStatus(unit string) (*entity.UnitStatus, error) {
+	if err := checkSystemUnit(unit); err != nil {
+		return nil, err
+	}
+	output, err := exec.Command("systemctl", "show", unit+".service", "--no-pager",
+		"--property=Description,LoadState,ActiveState,SubState,MainPID,NRestarts,ActiveEnterTimestamp").Output()
+	if err != nil {
+		return nil, common.NewErrorf("systemctl show %s failed: %v", unit, err)
+	}
+
+	status := &entity.UnitStatus{Unit: unit}
+	for _, line := range strings.Split(string(output), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Description":
+			status.Description = value
+		case "LoadState":
+			status.LoadState = value
+		case "ActiveState":
+			status.ActiveState = value
+		case "SubState":
+			status.SubState = value
+		case "MainPID":
+			status.MainPID, _ = strconv.Atoi(value)
+		case "NRestarts":
+			status.Restarts, _ = strconv.Atoi(value)
+		case "ActiveEnterTimestamp":
+			status.ActiveSince = value
+		}
+	}
+	return status, nil
+}
+
+// GetUnitJournal returns the last lines of the journal of the x-ui or xray systemd unit.
+func (s *ServerService) GetUnitJournal(unit string, lines int) ([]string, error) {
+	if err := checkSystemUnit(unit); err != nil {
+		return nil, err
+	}
+	if lines < 1 || lines > maxJournalLines {
+		return nil, common.NewErrorf("lines must be between 1 and %d", maxJournalLines)
+	}
+	output, err := exec.Command("journalctl", "-u", unit+".service", "--no-pager", "-o", "short-iso", "-n", strconv.Itoa(lines)).Output()
+	if err != nil {
+		return nil, common.NewErrorf("journalctl -u %s failed: %v", unit, err)
+	}
+	return strings.Split(strings.TrimRight(string(output), "\n"), "\n"), nil
+}
+
+// RebootHost reboots the machine after a delay, so the response still reaches the caller.
+func (s *ServerService) RebootHost(delay time.Duration) error {
+	if runtime.GOOS != "linux" {
+		return common.NewError("rebooting the host is only supported on Linux")
+	}
+	path, err := exec.LookPath("systemctl")
+	args := []string{"reboot"}
+	if err != nil {
+		if path, err = exec.LookPath("reboot"); err != nil {
+			return common.NewError("neither systemctl nor reboot is available")
+		}
+		args = nil
+	}
+	logger.Warning("Host reboot requested through the panel")
+	go func() {
+		time.Sleep(delay)
+		if output, err := exec.Command(path, args...).CombinedOutput(); err != nil {
+			logger.Errorf("failed to reboot host: %v: %s", err, strings.TrimSpace(string(output)))
+		}
+	}()
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"html"
 	"io"
 	"math/big"
 	"net"
@@ -237,6 +238,7 @@ func (t *Tgbot) Start(i18nFS embed.FS) error {
 			{Command: "help", Description: t.I18nBot("tgbot.commands.helpDesc")},
 			{Command: "status", Description: t.I18nBot("tgbot.commands.statusDesc")},
 			{Command: "id", Description: t.I18nBot("tgbot.commands.idDesc")},
+			{Command: "redeem", Description: t.I18nBot("tgbot.commands.redeemDesc")},
 		},
 	})
 	if err != nil {
@@ -544,11 +546,16 @@ func (t *Tgbot) answerCommand(message *telego.Message, chatId int64, isAdmin boo
 	switch command {
 	case "help":
 		msg += t.I18nBot("tgbot.commands.help")
+		if !isAdmin {
+			msg += t.getSupportContact()
+		}
 		msg += t.I18nBot("tgbot.commands.pleaseChoose")
 	case "start":
 		msg += t.I18nBot("tgbot.commands.start", "Firstname=="+message.From.FirstName)
 		if isAdmin {
-			msg += t.I18nBot("tgbot.commands.welcome", "Hostname=="+hostname)
+			msg += t.I18nBot("tgbot.commands.welcome", "Hostname=="+t.getBrandName())
+		} else {
+			msg += t.getSupportContact()
 		}
 		msg += "\n\n" + t.I18nBot("tgbot.commands.pleaseChoose")
 	case "status":
@@ -589,6 +596,19 @@ func (t *Tgbot) answerCommand(message *telego.Message, chatId int64, isAdmin boo
 				} else {
 					msg += t.I18nBot("tgbot.commands.xrayNotRunning")
 				}
+			} else if len(commandArgs) == 1 && (commandArgs[0] == "panel" || commandArgs[0] == "host") {
+				var err error
+				if commandArgs[0] == "panel" {
+					var panelService PanelService
+					err = panelService.RestartPanel(time.Second * 3)
+				} else {
+					err = t.serverService.RebootHost(time.Second * 3)
+				}
+				if err != nil {
+					msg += t.I18nBot("tgbot.commands.restartFailed", "Error=="+err.Error())
+				} else {
+					msg += t.I18nBot("tgbot.commands.restartSuccess")
+				}
 			} else {
 				handleUnknownCommand()
 				msg += t.I18nBot("tgbot.commands.restartUsage")
@@ -596,6 +616,25 @@ func (t *Tgbot) answerCommand(message *telego.Message, chatId int64, isAdmin boo
 		} else {
 			handleUnknownCommand()
 		}
+	case "redeem":
+		onlyMessage = true
+		if len(commandArgs) > 0 {
+			msg += t.redeemVoucher(message.From.ID, isAdmin, commandArgs[0], commandArgs[1:]...)
+		} else {
+			msg += t.I18nBot("tgbot.commands.redeemUsage")
+		}
+	case "service":
+		onlyMessage = true
+		if isAdmin {
+			if len(commandArgs) == 1 {
+				msg += t.getUnitStatus(commandArgs[0])
+			} else {
+				handleUnknownCommand()
+				msg += t.I18nBot("tgbot.commands.serviceUsage")
+			}
+		} else {
+			handleUnknownCommand()
+		}
 	default:
 		handleUnknownCommand()
 	}
@@ -605,6 +644,89 @@ func (t *Tgbot) answerCommand(message *telego.Message, chatId int64, isAdmin boo
 	}
 }
 
+// redeemVoucher redeems a voucher for a Telegram user. With an email the voucher extends that client,
+// which for users other than admins must be linked to their Telegram account, otherwise it creates a
+// new client linked to the account.
+func (t *Tgbot) redeemVoucher(tgUserID int64, isAdmin bool, code string, email ...string) string {
+	target := ""
+	if len(email) > 0 {
+		target = email[0]
+		if !isAdmin {
+			traffics, err := t.inboundService.GetClientTrafficTgBot(tgUserID)
+			if err != nil {
+				logger.Warning(err)
+				return t.I18nBot("tgbot.wentWrong")
+			}
+			linked := false
+			for _, traffic := range traffics {
+				linked = linked || traffic.Email == target
+			}
+			if !linked {
+				return t.I18nBot("tgbot.noResult")
+			}
+		}
+	}
+
+	var voucherService VoucherService
+	redemption, needRestart, err := voucherService.RedeemVoucher(code, target, ClientPreset{TgID: tgUserID}, "telegram")
+	if err != nil {
+		return t.I18nBot("tgbot.commands.redeemFailed", "Error=="+html.EscapeString(err.Error()))
+	}
+	if needRestart {
+		t.xrayService.SetToNeedRestart()
+	}
+	unit := "GB"
+	if redemption.Type == model.VoucherDays {
+		unit = t.I18nBot("tgbot.days")
+	}
+	msg := t.I18nBot("tgbot.commands.redeemSuccess",
+		"Email=="+html.EscapeString(redemption.Email),
+		"Value=="+strconv.Itoa(redemption.Value),
+		"Unit=="+unit)
+	if redemption.NewClient {
+		msg += t.I18nBot("tgbot.commands.redeemNewClient", "SubId=="+redemption.SubId)
+	}
+	return msg
+}
+
+// getUnitStatus formats the systemd state and the journal tail of a unit for a Telegram message.
+// getBrandName returns the configured brand name, or the host name when no branding is set.
+func (t *Tgbot) getBrandName() string {
+	if brand := t.settingService.GetBranding(); brand.Name != "" {
+		return html.EscapeString(brand.Name)
+	}
+	return hostname
+}
+
+// getSupportContact returns the support contact line for clients, or an empty string when none is set.
+func (t *Tgbot) getSupportContact() string {
+	brand := t.settingService.GetBranding()
+	if brand.Support == "" {
+		return ""
+	}
+	contact := html.EscapeString(brand.Support)
+	if brand.SupportLink != "" {
+		contact = fmt.Sprintf("<a href=\"%s\">%s</a>", html.EscapeString(brand.SupportLink), contact)
+	}
+	return t.I18nBot("tgbot.commands.support", "Contact=="+contact)
+}
+
+func (t *Tgbot) getUnitStatus(unit string) string {
+	status, err := t.serverService.GetUnitStatus(unit)
+	if err != nil {
+		return t.I18nBot("tgbot.commands.restartFailed", "Error=="+err.Error())
+	}
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "<b>%s</b>: %s (%s)\r\n", html.EscapeString(status.Unit), html.EscapeString(status.ActiveState), html.EscapeString(status.SubState))
+	if status.ActiveSince != "" {
+		fmt.Fprintf(&msg, "%s\r\n", html.EscapeString(status.ActiveSince))
+	}
+	if journal, err := t.serverService.GetUnitJournal(unit, 10); err == nil {
+		fmt.Fprintf(&msg, "\r\n<code>%s</code>", html.EscapeString(strings.Join(journal, "\n")))
+	}
+	return msg.String()
+}
+
 // sendResponse sends the response message based on the onlyMessage flag.
 func (t *Tgbot) sendResponse(chatId int64, msg string, onlyMessage, isAdmin bool) {
 	if onlyMessage {
@@ -693,6 +815,9 @@ func (t *Tgbot) answerCallback(callbackQuery *telego.CallbackQuery, isAdmin bool
 				}
 				inbound, _ := t.inboundService.GetInbound(inboundIdInt)
 				t.SendMsgToTgbot(chatId, t.I18nBot("tgbot.answers.chooseClient", "Inbound=="+inbound.Remark), clientsKB)
+			case "approval_approve", "approval_reject":
+				t.decideApproval(callbackQuery, dataArray[0] == "approval_approve", dataArray[1])
+				return
 			case "client_sub_links":
 				t.sendClientSubLinks(chatId, email)
 				return
@@ -2198,15 +2323,21 @@ func (t *Tgbot) buildSubscriptionURLs(email string) (string, string, error) {
 	if err != nil || client == nil {
 		return "", "", errors.New("client not found")
 	}
+	subURL, subJsonURL := subscriptionURLs(&t.settingService, client.SubID)
+	return subURL, subJsonURL, nil
+}
 
+// subscriptionURLs builds the HTML sub page URL and JSON subscription URL of a subscription
+// ID from the subscription server settings. The JSON URL is empty when JSON subscriptions are off.
+func subscriptionURLs(settingService *SettingService, subId string) (string, string) {
 	// Gather settings to construct absolute URLs
-	subDomain, _ := t.settingService.GetSubDomain()
-	subPort, _ := t.settingService.GetSubPort()
-	subPath, _ := t.settingService.GetSubPath()
-	subJsonPath, _ := t.settingService.GetSubJsonPath()
-	subJsonEnable, _ := t.settingService.GetSubJsonEnable()
-	subKeyFile, _ := t.settingService.GetSubKeyFile()
-	subCertFile, _ := t.settingService.GetSubCertFile()
+	subDomain, _ := settingService.GetSubDomain()
+	subPort, _ := settingService.GetSubPort()
+	subPath, _ := settingService.GetSubPath()
+	subJsonPath, _ := settingService.GetSubJsonPath()
+	subJsonEnable, _ := settingService.GetSubJsonEnable()
+	subKeyFile, _ := settingService.GetSubKeyFile()
+	subCertFile, _ := settingService.GetSubCertFile()
 
 	tls := (subKeyFile != "" && subCertFile != "")
 	scheme := "http"
@@ -2217,7 +2348,7 @@ func (t *Tgbot) buildSubscriptionURLs(email string) (string, string, error) {
 	// Fallbacks
 	if subDomain == "" {
 		// try panel domain, otherwise OS hostname
-		if d, err := t.settingService.GetWebDomain(); err == nil && d != "" {
+		if d, err := settingService.GetWebDomain(); err == nil && d != "" {
 			subDomain = d
 		} else if hostname != "" {
 			subDomain = hostname
@@ -2247,12 +2378,12 @@ func (t *Tgbot) buildSubscriptionURLs(email string) (string, string, error) {
 		subJsonPath = subJsonPath + "/"
 	}
 
-	subURL := fmt.Sprintf("%s://%s%s%s", scheme, host, subPath, client.SubID)
-	subJsonURL := fmt.Sprintf("%s://%s%s%s", scheme, host, subJsonPath, client.SubID)
+	subURL := fmt.Sprintf("%s://%s%s%s", scheme, host, subPath, subId)
+	subJsonURL := fmt.Sprintf("%s://%s%s%s", scheme, host, subJsonPath, subId)
 	if !subJsonEnable {
 		subJsonURL = ""
 	}
-	return subURL, subJsonURL, nil
+	return subURL, subJsonURL
 }
 
 // sendClientSubLinks sends the subscription links for the client to the chat.
@@ -2467,6 +2598,48 @@ func (t *Tgbot) SendMsgToTgbotAdmins(msg string, replyMarkup ...telego.ReplyMark
 	}
 }
 
+// SendApprovalRequest sends an approval request to the admin chats with buttons to approve or
+// reject it.
+func (t *Tgbot) SendApprovalRequest(approval *model.Approval) {
+	id := strconv.Itoa(approval.Id)
+	msg := html.EscapeString(fmt.Sprintf("Approval %d requested by %s:\r\n%s\r\nExpires at %s",
+		approval.Id, approval.RequestedBy, approval.Summary, time.UnixMilli(approval.ExpiresAt).Format("2006-01-02 15:04:05")))
+	inlineKeyboard := tu.InlineKeyboard(
+		tu.InlineKeyboardRow(
+			tu.InlineKeyboardButton("✅ Approve").WithCallbackData(t.encodeQuery("approval_approve "+id)),
+			tu.InlineKeyboardButton("❌ Reject").WithCallbackData(t.encodeQuery("approval_reject "+id)),
+		),
+	)
+	t.SendMsgToTgbotAdmins(msg, inlineKeyboard)
+}
+
+// decideApproval approves or rejects an approval request for the admin who pressed its button.
+func (t *Tgbot) decideApproval(callbackQuery *telego.CallbackQuery, approve bool, id string) {
+	approvalId, err := strconv.Atoi(id)
+	if err != nil {
+		t.sendCallbackAnswerTgBot(callbackQuery.ID, err.Error())
+		return
+	}
+	var approvalService ApprovalService
+	decidedBy := fmt.Sprintf("telegram:%d", callbackQuery.From.ID)
+	var approval *model.Approval
+	if approve {
+		approval, err = approvalService.Approve(approvalId, decidedBy)
+	} else {
+		approval, err = approvalService.Reject(approvalId, decidedBy)
+	}
+	if err != nil {
+		t.sendCallbackAnswerTgBot(callbackQuery.ID, err.Error())
+		return
+	}
+	msg := fmt.Sprintf("Approval %d %s by %s:\r\n%s", approval.Id, approval.Status, decidedBy, approval.Summary)
+	if approval.Error != "" {
+		msg += "\r\n" + approval.Error
+	}
+	t.sendCallbackAnswerTgBot(callbackQuery.ID, approval.Status)
+	t.editMessageTgBot(callbackQuery.Message.GetChat().ID, callbackQuery.Message.GetMessageID(), html.EscapeString(msg))
+}
+
 // SendReport sends a periodic report to admin chats.
 func (t *Tgbot) SendReport() {
 	runTime, err := t.settingService.GetTgbotRuntime()
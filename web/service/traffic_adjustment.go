@@ -0,0 +1,106 @@
+package service
+
+import (
+	"strings"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/xray"
+
+	"gorm.io/gorm"
+)
+
+// AdjustClientTraffic changes the traffic counters of a client by the given number of bytes,
+// negative to credit traffic back, and records the correction with its reason and the admin who
+// made it. Counters are not taken below zero, the recorded change is the one applied.
+func (s *InboundService) AdjustClientTraffic(email string, up int64, down int64, reason string, adjustedBy string) (*model.TrafficAdjustment, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, common.NewCodeError(common.ErrCodeValidation, nil, "a reason for the traffic correction is required")
+	}
+	if up == 0 && down == 0 {
+		return nil, common.NewCodeError(common.ErrCodeValidation, nil, "the traffic correction changes nothing")
+	}
+
+	adjustment := &model.TrafficAdjustment{
+		Email:      email,
+		Reason:     reason,
+		AdjustedBy: adjustedBy,
+		CreatedAt:  time.Now().UnixMilli(),
+	}
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		traffic := &xray.ClientTraffic{}
+		err := tx.Model(xray.ClientTraffic{}).Where("email = ?", email).First(traffic).Error
+		if database.IsNotFound(err) {
+			return common.NewCodeError(common.ErrCodeClientNotFound, map[string]any{"email": email}, "Client Not Found For Email:", email)
+		}
+		if err != nil {
+			return err
+		}
+		adjustment.InboundId = traffic.InboundId
+		adjustment.Up = max(up, -traffic.Up)
+		adjustment.Down = max(down, -traffic.Down)
+		// Relative updates keep the traffic collected in the meantime
+		err = tx.Model(xray.ClientTraffic{}).Where("id = ?", traffic.Id).Updates(map[string]any{
+			"up":   gorm.Expr("up + ?", adjustment.Up),
+			"down": gorm.Expr("down + ?", adjustment.Down),
+		}).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(xray.ClientTraffic{}).Where("id = ?", traffic.Id).First(traffic).Error; err != nil {
+			return err
+		}
+		adjustment.UpAfter = traffic.Up
+		adjustment.DownAfter = traffic.Down
+		return tx.Create(adjustment).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	logger.Infof("Traffic of %s corrected by %s: up %+d, down %+d bytes, reason: %s",
+		email, adjustedBy, adjustment.Up, adjustment.Down, reason)
+	return adjustment, nil
+}
+
+// GetTrafficAdjustments returns the traffic corrections, newest first, of one client when an
+// email is given and made from the start time until before the end time when they are set.
+func (s *InboundService) GetTrafficAdjustments(email string, from int64, to int64) ([]*model.TrafficAdjustment, error) {
+	db := database.GetDB().Model(model.TrafficAdjustment{})
+	if email != "" {
+		db = db.Where("email = ?", email)
+	}
+	if from > 0 {
+		db = db.Where("created_at >= ?", from)
+	}
+	if to > 0 {
+		db = db.Where("created_at < ?", to)
+	}
+	adjustments := []*model.TrafficAdjustment{}
+	err := db.Order("id DESC").Find(&adjustments).Error
+	return adjustments, err
+}
+
+// getAdjustedTraffic returns the net traffic corrections of the clients, in bytes by email.
+func getAdjustedTraffic(tx *gorm.DB, emails []string) (map[string]int64, error) {
+	var rows []struct {
+		Email    string
+		Adjusted int64
+	}
+	err := tx.Model(model.TrafficAdjustment{}).
+		Select("email, SUM(up + down) AS adjusted").
+		Where("email IN ?", emails).
+		Group("email").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	adjusted := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		adjusted[row.Email] = row.Adjusted
+	}
+	return adjusted, nil
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+	"github.com/mhsanaei/3x-ui/v2/xray"
+
+	"gorm.io/gorm"
+)
+
+// TrafficPoolService manages traffic pools, budgets shared by clients on any inbounds.
+type TrafficPoolService struct {
+	inboundService InboundService
+}
+
+// disableDepletedPools disables the clients of the traffic pools that are used up.
+func (s *InboundService) disableDepletedPools(tx *gorm.DB) (bool, int64, error) {
+	var clients []clientRef
+	err := tx.Table("client_traffics").
+		Select("inbounds.tag AS tag, client_traffics.email AS email").
+		Joins("JOIN inbounds ON inbounds.id = client_traffics.inbound_id").
+		Joins("JOIN traffic_pools ON traffic_pools.id = client_traffics.traffic_pool_id").
+		Where("traffic_pools.total_gb > 0 AND traffic_pools.up + traffic_pools.down >= traffic_pools.total_gb AND client_traffics.enable = ?", true).
+		Scan(&clients).Error
+	if err != nil {
+		return false, 0, err
+	}
+	return s.disableClientRefs(tx, clients)
+}
+
+func checkTrafficPool(pool *model.TrafficPool) error {
+	pool.Name = strings.TrimSpace(pool.Name)
+	if pool.Name == "" {
+		return common.NewError("traffic pool name can not be empty")
+	}
+	if pool.TotalGB < 0 {
+		return common.NewError("traffic pool budget must not be negative:", pool.TotalGB)
+	}
+	return nil
+}
+
+// GetPools returns all traffic pools with the traffic of their clients.
+func (s *TrafficPoolService) GetPools() ([]*entity.TrafficPoolStats, error) {
+	db := database.GetDB()
+	var pools []*model.TrafficPool
+	if err := db.Model(model.TrafficPool{}).Order("id").Find(&pools).Error; err != nil {
+		return nil, err
+	}
+	var traffics []*xray.ClientTraffic
+	if err := db.Model(xray.ClientTraffic{}).Where("traffic_pool_id > 0").Order("email").Find(&traffics).Error; err != nil {
+		return nil, err
+	}
+	onlineClients := s.inboundService.GetOnlineClients()
+	result := make([]*entity.TrafficPoolStats, 0, len(pools))
+	for _, pool := range pools {
+		stats := &entity.TrafficPoolStats{
+			TrafficPool: *pool,
+			Depleted:    pool.TotalGB > 0 && pool.Up+pool.Down >= pool.TotalGB,
+			Clients:     []entity.TrafficPoolClient{},
+		}
+		if pool.TotalGB > 0 {
+			stats.Remaining = max(pool.TotalGB-pool.Up-pool.Down, 0)
+		}
+		for _, traffic := range traffics {
+			if traffic.TrafficPoolId != pool.Id {
+				continue
+			}
+			stats.Clients = append(stats.Clients, entity.TrafficPoolClient{
+				InboundId: traffic.InboundId,
+				Email:     traffic.Email,
+				Up:        traffic.Up,
+				Down:      traffic.Down,
+				Enable:    traffic.Enable,
+				Online:    slices.Contains(onlineClients, traffic.Email),
+			})
+		}
+		result = append(result, stats)
+	}
+	return result, nil
+}
+
+// AddPool validates and stores a new traffic pool.
+func (s *TrafficPoolService) AddPool(pool *model.TrafficPool) error {
+	if err := checkTrafficPool(pool); err != nil {
+		return common.WithCode(common.ErrCodeValidation, err)
+	}
+	pool.Id = 0
+	pool.Up = 0
+	pool.Down = 0
+	pool.CreatedAt = time.Now().UnixMilli()
+	pool.ResetAt = 0
+	return database.GetDB().Create(pool).Error
+}
+
+// UpdatePool updates the name, budget and comment of a traffic pool. Clients disabled because
+// the pool was used up are enabled again when the new budget allows it.
+// Returns whether Xray needs a restart.
+func (s *TrafficPoolService) UpdatePool(pool *model.TrafficPool) (bool, error) {
+	if err := checkTrafficPool(pool); err != nil {
+		return false, common.WithCode(common.ErrCodeValidation, err)
+	}
+	db := database.GetDB()
+	old := &model.TrafficPool{}
+	if err := db.First(old, pool.Id).Error; err != nil {
+		return false, err
+	}
+	old.Name = pool.Name
+	old.TotalGB = pool.TotalGB
+	old.Comment = pool.Comment
+	if err := db.Save(old).Error; err != nil {
+		return false, err
+	}
+	*pool = *old
+	return s.enableMembers(db, pool.Id)
+}
+
+// enableMembers enables the disabled clients of a pool that are within their limits.
+func (s *TrafficPoolService) enableMembers(tx *gorm.DB, id int) (bool, error) {
+	var emails []string
+	if err := tx.Model(xray.ClientTraffic{}).Where("traffic_pool_id = ?", id).Pluck("email", &emails).Error; err != nil {
+		return false, err
+	}
+	return s.inboundService.enableWithinLimits(tx, emails)
+}
+
+// DelPool deletes a traffic pool. Its clients keep their own limits and are enabled again when
+// they are within them. Returns whether Xray needs a restart.
+func (s *TrafficPoolService) DelPool(id int) (bool, error) {
+	needRestart := false
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var emails []string
+		if err := tx.Model(xray.ClientTraffic{}).Where("traffic_pool_id = ?", id).Pluck("email", &emails).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(xray.ClientTraffic{}).Where("traffic_pool_id = ?", id).Update("traffic_pool_id", 0).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(model.TrafficPool{}, id).Error; err != nil {
+			return err
+		}
+		var err error
+		needRestart, err = s.inboundService.enableWithinLimits(tx, emails)
+		return err
+	})
+	return needRestart, err
+}
+
+// SetPoolClients makes the clients with the emails the clients of a traffic pool, replacing its
+// current clients. A client belongs to one pool at most, so clients of other pools move over.
+// Clients leaving the pool are enabled again when they are within their own limits.
+// Returns whether Xray needs a restart.
+func (s *TrafficPoolService) SetPoolClients(id int, emails []string) (bool, error) {
+	db := database.GetDB()
+	pool := &model.TrafficPool{}
+	if err := db.First(pool, id).Error; err != nil {
+		return false, err
+	}
+	emails = slices.Compact(slices.Sorted(slices.Values(emails)))
+	var found []string
+	if err := db.Model(xray.ClientTraffic{}).Where("email IN ?", emails).Pluck("email", &found).Error; err != nil {
+		return false, err
+	}
+	for _, email := range emails {
+		if !slices.Contains(found, email) {
+			return false, common.WithCode(common.ErrCodeValidation, common.NewError("client not found:", email))
+		}
+	}
+
+	needRestart := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Model(xray.ClientTraffic{}).Where("traffic_pool_id = ?", id)
+		if len(emails) > 0 {
+			query = query.Where("email NOT IN ?", emails)
+		}
+		var leaving []string
+		if err := query.Pluck("email", &leaving).Error; err != nil {
+			return err
+		}
+		if len(leaving) > 0 {
+			if err := tx.Model(xray.ClientTraffic{}).Where("email IN ?", leaving).Update("traffic_pool_id", 0).Error; err != nil {
+				return err
+			}
+		}
+		if len(emails) > 0 {
+			if err := tx.Model(xray.ClientTraffic{}).Where("email IN ?", emails).Update("traffic_pool_id", id).Error; err != nil {
+				return err
+			}
+		}
+		var err error
+		needRestart, err = s.inboundService.enableWithinLimits(tx, leaving)
+		return err
+	})
+	return needRestart, err
+}
+
+// ResetPool resets the usage of a traffic pool and enables its clients again when they are
+// within their own limits. Returns whether Xray needs a restart.
+func (s *TrafficPoolService) ResetPool(id int) (bool, error) {
+	db := database.GetDB()
+	result := db.Model(model.TrafficPool{}).Where("id = ?", id).Updates(map[string]any{
+		"up":       0,
+		"down":     0,
+		"reset_at": time.Now().UnixMilli(),
+	})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, gorm.ErrRecordNotFound
+	}
+	return s.enableMembers(db, id)
+}
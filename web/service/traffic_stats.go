@@ -0,0 +1,150 @@
+package service
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+	"github.com/mhsanaei/3x-ui/v2/xray"
+)
+
+var (
+	trafficCountersMu      sync.Mutex
+	trafficCounters        = map[string]int64{} // Last read value of each Xray counter when counters are not reset on read
+	trafficCountersProcess Core                 // Process the counters were read from
+
+	clientSpeedsMu      sync.Mutex
+	clientSpeeds        []entity.ClientSpeed // Rates of the clients with traffic in the last collection, fastest first
+	clientSpeedSampleAt time.Time            // Time of the last collection
+)
+
+// setUserLevelPolicy sets policy options on every user level of the Xray config, adding level 0
+// when the template defines none.
+func setUserLevelPolicy(xrayConfig *xray.Config, options map[string]any) error {
+	policy := map[string]any{}
+	if len(xrayConfig.Policy) > 0 {
+		if err := json.Unmarshal(xrayConfig.Policy, &policy); err != nil {
+			return err
+		}
+	}
+	levels, _ := policy["levels"].(map[string]any)
+	if levels == nil {
+		levels = map[string]any{}
+	}
+	if _, ok := levels["0"]; !ok {
+		levels["0"] = map[string]any{}
+	}
+	for _, level := range levels {
+		if l, ok := level.(map[string]any); ok {
+			for key, value := range options {
+				l[key] = value
+			}
+		}
+	}
+	policy["levels"] = levels
+	policyConfig, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	xrayConfig.Policy = policyConfig
+	return nil
+}
+
+// addTrafficStats enables the per-client uplink and downlink counters chosen in the settings.
+func (s *XrayService) addTrafficStats(xrayConfig *xray.Config) error {
+	uplink, err := s.settingService.GetTrafficClientUplink()
+	if err != nil {
+		return err
+	}
+	downlink, err := s.settingService.GetTrafficClientDownlink()
+	if err != nil {
+		return err
+	}
+	return setUserLevelPolicy(xrayConfig, map[string]any{
+		"statsUserUplink":   uplink,
+		"statsUserDownlink": downlink,
+	})
+}
+
+// trafficSinceLastRead turns counters into the traffic since the previous read. Counters that
+// are not reset on read keep growing, so the last read values are subtracted; they start over
+// when Xray restarts, so a new process or a smaller value counts from zero. The first read
+// after switching to reset on read still subtracts the values counted before.
+func trafficSinceLastRead(traffics []*xray.Traffic, clientTraffics []*xray.ClientTraffic, reset bool) {
+	trafficCountersMu.Lock()
+	defer trafficCountersMu.Unlock()
+	if trafficCountersProcess != p {
+		trafficCountersProcess = p
+		trafficCounters = map[string]int64{}
+	}
+	delta := func(key string, value int64) int64 {
+		last, ok := trafficCounters[key]
+		trafficCounters[key] = value
+		if !ok || value < last {
+			return value
+		}
+		return value - last
+	}
+	for _, traffic := range traffics {
+		prefix := "outbound>>>"
+		if traffic.IsInbound {
+			prefix = "inbound>>>"
+		}
+		traffic.Up = delta(prefix+traffic.Tag+">>>uplink", traffic.Up)
+		traffic.Down = delta(prefix+traffic.Tag+">>>downlink", traffic.Down)
+	}
+	for _, traffic := range clientTraffics {
+		traffic.Up = delta("user>>>"+traffic.Email+">>>uplink", traffic.Up)
+		traffic.Down = delta("user>>>"+traffic.Email+">>>downlink", traffic.Down)
+	}
+	if reset {
+		trafficCounters = map[string]int64{}
+	}
+}
+
+// recordClientSpeeds turns the traffic of a collection into rates per client. The first
+// collection only sets the starting time, as its traffic may span any period.
+func recordClientSpeeds(clientTraffics []*xray.ClientTraffic) {
+	clientSpeedsMu.Lock()
+	defer clientSpeedsMu.Unlock()
+	now := time.Now()
+	elapsed := now.Sub(clientSpeedSampleAt).Seconds()
+	first := clientSpeedSampleAt.IsZero()
+	clientSpeedSampleAt = now
+	if first || elapsed <= 0 {
+		clientSpeeds = nil
+		return
+	}
+	speeds := make([]entity.ClientSpeed, 0, len(clientTraffics))
+	for _, traffic := range clientTraffics {
+		if traffic.Up+traffic.Down == 0 {
+			continue
+		}
+		speeds = append(speeds, entity.ClientSpeed{
+			Email: traffic.Email,
+			Up:    int64(float64(traffic.Up) / elapsed),
+			Down:  int64(float64(traffic.Down) / elapsed),
+		})
+	}
+	sort.Slice(speeds, func(i, j int) bool {
+		return speeds[i].Up+speeds[i].Down > speeds[j].Up+speeds[j].Down
+	})
+	clientSpeeds = speeds
+}
+
+// GetClientSpeeds returns the current rates of the clients transferring data, fastest first,
+// at most limit of them when limit is positive.
+func (s *XrayService) GetClientSpeeds(limit int) []entity.ClientSpeed {
+	if !s.IsXrayRunning() {
+		return []entity.ClientSpeed{}
+	}
+	clientSpeedsMu.Lock()
+	defer clientSpeedsMu.Unlock()
+	speeds := clientSpeeds
+	if limit > 0 && len(speeds) > limit {
+		speeds = speeds[:limit]
+	}
+	return append([]entity.ClientSpeed{}, speeds...)
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/xray"
+
+	"github.com/shirou/gopsutil/v4/process"
+)
+
+// tuiOnlineWindow is how recently a client must have had traffic to count as online. The panel
+// records traffic every 10 seconds, so a client is online for two of its intervals.
+const tuiOnlineWindow = 20 * time.Second
+
+// TuiXray is the state of the panel's Xray process, found among the running processes since the
+// terminal status screen runs outside the panel.
+type TuiXray struct {
+	Running bool
+	Pid     int32
+	Uptime  time.Duration
+}
+
+// TuiInbound is an inbound with its throughput since the previous snapshot.
+type TuiInbound struct {
+	Id       int
+	Tag      string
+	Remark   string
+	Protocol string
+	Port     int
+	Enable   bool
+	Clients  int
+	Online   int
+	UpRate   int64 // Bytes per second
+	DownRate int64 // Bytes per second
+	up, down int64
+}
+
+// TuiSnapshot is one refresh of the terminal status screen.
+type TuiSnapshot struct {
+	T        time.Time
+	Status   *Status
+	Xray     TuiXray
+	Online   []string
+	Inbounds []TuiInbound
+	Logs     []string
+}
+
+// TuiService collects what the terminal status screen shows from the same services as the web
+// dashboard. Xray state, traffic and online clients are read from the process table and the
+// database the running panel keeps up to date.
+type TuiService struct {
+	serverService  ServerService
+	inboundService InboundService
+}
+
+// Snapshot collects the current state. Throughput is computed against the previous snapshot, so
+// it is zero on the first call.
+func (s *TuiService) Snapshot(last *TuiSnapshot, logLines int) (*TuiSnapshot, error) {
+	snapshot := &TuiSnapshot{T: time.Now()}
+	var lastStatus *Status
+	if last != nil {
+		lastStatus = last.Status
+	}
+	snapshot.Status = s.serverService.GetStatus(lastStatus)
+	snapshot.Xray = findXrayProcess()
+
+	lastOnline, err := s.inboundService.GetClientsLastOnline()
+	if err != nil {
+		return nil, err
+	}
+	online := map[string]bool{}
+	since := snapshot.T.Add(-tuiOnlineWindow).UnixMilli()
+	for email, at := range lastOnline {
+		if at >= since {
+			online[email] = true
+			snapshot.Online = append(snapshot.Online, email)
+		}
+	}
+	sort.Strings(snapshot.Online)
+
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return nil, err
+	}
+	lastInbounds := map[int]TuiInbound{}
+	if last != nil {
+		for _, inbound := range last.Inbounds {
+			lastInbounds[inbound.Id] = inbound
+		}
+	}
+	for _, inbound := range inbounds {
+		row := TuiInbound{
+			Id:       inbound.Id,
+			Tag:      inbound.Tag,
+			Remark:   inbound.Remark,
+			Protocol: string(inbound.Protocol),
+			Port:     inbound.Port,
+			Enable:   inbound.Enable,
+			up:       inbound.Up,
+			down:     inbound.Down,
+		}
+		if clients, err := s.inboundService.GetClients(inbound); err == nil {
+			row.Clients = len(clients)
+			for _, client := range clients {
+				if online[client.Email] {
+					row.Online++
+				}
+			}
+		}
+		if previous, ok := lastInbounds[inbound.Id]; ok {
+			seconds := snapshot.T.Sub(last.T).Seconds()
+			if seconds > 0 && row.up >= previous.up && row.down >= previous.down {
+				row.UpRate = int64(float64(row.up-previous.up) / seconds)
+				row.DownRate = int64(float64(row.down-previous.down) / seconds)
+			}
+		}
+		snapshot.Inbounds = append(snapshot.Inbounds, row)
+	}
+
+	snapshot.Logs = tailFile(logger.GetLogFilePath(), logLines)
+	return snapshot, nil
+}
+
+// findXrayProcess looks for the Xray binary of the panel among the running processes.
+func findXrayProcess() TuiXray {
+	binaryPath, err := filepath.Abs(xray.GetBinaryPath())
+	if err != nil {
+		binaryPath = xray.GetBinaryPath()
+	}
+	processes, err := process.Processes()
+	if err != nil {
+		return TuiXray{}
+	}
+	for _, proc := range processes {
+		exe, err := proc.Exe()
+		if err != nil || (exe != binaryPath && filepath.Base(exe) != xray.GetBinaryName()) {
+			continue
+		}
+		found := TuiXray{Running: true, Pid: proc.Pid}
+		if created, err := proc.CreateTime(); err == nil {
+			found.Uptime = time.Since(time.UnixMilli(created)).Truncate(time.Second)
+		}
+		return found
+	}
+	return TuiXray{}
+}
+
+// tailFile returns the last n lines of a file, nothing when it cannot be read. Only the end of the
+// file is read, so a large log does not slow down every refresh.
+func tailFile(path string, n int) []string {
+	if n <= 0 {
+		return nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	const tailSize = 64 << 10
+	partial := false
+	if info, err := file.Stat(); err == nil && info.Size() > tailSize {
+		if _, err := file.Seek(info.Size()-tailSize, io.SeekStart); err == nil {
+			partial = true
+		}
+	}
+	lines := make([]string, 0, n)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if partial {
+			// The first line read from the middle of the file is cut off
+			partial = false
+			continue
+		}
+		if len(lines) == n {
+			copy(lines, lines[1:])
+			lines = lines[:n-1]
+		}
+		lines = append(lines, scanner.Text())
+	}
+	return lines
+}
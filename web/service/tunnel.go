@@ -0,0 +1,180 @@
+package service
+
+import (
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/tunnel"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+	"github.com/mhsanaei/3x-ui/v2/web/network"
+)
+
+var (
+	tunnelProcess *tunnel.Process
+	tunnelLock    sync.Mutex
+)
+
+// TunnelService publishes the panel through a Cloudflare Tunnel or a Tor onion service, for
+// admins who can not expose the panel port directly.
+type TunnelService struct {
+	settingService SettingService
+}
+
+// getOnionKey returns the key of the onion service, generating and storing it on first use so
+// the panel keeps its onion address.
+func (s *TunnelService) getOnionKey() (string, error) {
+	key, err := s.settingService.GetTunnelOnionKey()
+	if err != nil || key != "" {
+		return key, err
+	}
+	key, err = tunnel.GenerateOnionKey()
+	if err != nil {
+		return "", err
+	}
+	return key, s.settingService.SetTunnelOnionKey(key)
+}
+
+// buildOptions returns the tunnel options for the mode and the address the panel listens on.
+func (s *TunnelService) buildOptions(mode string) (tunnel.Options, error) {
+	opts := tunnel.Options{Mode: mode, Scheme: "http"}
+	certFile, err := s.settingService.GetCertFile()
+	if err != nil {
+		return opts, err
+	}
+	keyFile, err := s.settingService.GetKeyFile()
+	if err != nil {
+		return opts, err
+	}
+	if certFile != "" || keyFile != "" {
+		opts.Scheme = "https"
+	}
+	listen, err := s.settingService.GetListen()
+	if err != nil {
+		return opts, err
+	}
+	port, err := s.settingService.GetPort()
+	if err != nil {
+		return opts, err
+	}
+	socket, err := s.settingService.GetSocket()
+	if err != nil {
+		return opts, err
+	}
+	if socket != "" && socket != network.SocketSystemd {
+		opts.Socket = socket
+	}
+	// A panel listening on all addresses is reached over loopback
+	if ip := net.ParseIP(listen); listen == "" || (ip != nil && ip.IsUnspecified()) {
+		listen = "127.0.0.1"
+	}
+	opts.Address = net.JoinHostPort(listen, strconv.Itoa(port))
+
+	switch mode {
+	case tunnel.Cloudflare:
+		opts.Token, err = s.settingService.GetTunnelToken()
+	case tunnel.Tor:
+		opts.OnionKey, err = s.getOnionKey()
+	}
+	return opts, err
+}
+
+// Sync starts, stops or restarts the tunnel so it runs with the current settings, leaving it
+// alone when nothing changed.
+func (s *TunnelService) Sync() error {
+	mode, err := s.settingService.GetTunnelMode()
+	if err != nil {
+		return err
+	}
+	tunnelLock.Lock()
+	defer tunnelLock.Unlock()
+
+	if mode == "" {
+		if tunnelProcess != nil && tunnelProcess.IsRunning() {
+			logger.Info("Stopping the panel tunnel")
+			if err := tunnelProcess.Stop(); err != nil {
+				return err
+			}
+		}
+		tunnelProcess = nil
+		return nil
+	}
+
+	opts, err := s.buildOptions(mode)
+	if err != nil {
+		return err
+	}
+	if tunnelProcess != nil && tunnelProcess.IsRunning() {
+		if tunnelProcess.GetOptions() == opts {
+			return nil
+		}
+		if err := tunnelProcess.Stop(); err != nil {
+			return err
+		}
+	}
+	logger.Info("Starting the", mode, "panel tunnel")
+	tunnelProcess = tunnel.NewProcess(opts)
+	return tunnelProcess.Start()
+}
+
+// Stop stops the tunnel if it is running.
+func (s *TunnelService) Stop() error {
+	tunnelLock.Lock()
+	defer tunnelLock.Unlock()
+	if tunnelProcess == nil || !tunnelProcess.IsRunning() {
+		return nil
+	}
+	return tunnelProcess.Stop()
+}
+
+// GetStatus returns the state of the tunnel with the public hostname and URL of the panel. The
+// hostname of a Cloudflare tunnel with a token is the one set for it, that of a quick tunnel is
+// known once cloudflared reported it.
+func (s *TunnelService) GetStatus() (*entity.TunnelStatus, error) {
+	mode, err := s.settingService.GetTunnelMode()
+	if err != nil {
+		return nil, err
+	}
+	status := &entity.TunnelStatus{Mode: mode}
+	if mode == "" {
+		return status, nil
+	}
+	opts, err := s.buildOptions(mode)
+	if err != nil {
+		return nil, err
+	}
+
+	tunnelLock.Lock()
+	if tunnelProcess != nil {
+		status.Running = tunnelProcess.IsRunning()
+		if err := tunnelProcess.GetErr(); err != nil {
+			status.Error = err.Error()
+		}
+		if mode == tunnel.Cloudflare && opts.Token == "" {
+			status.Hostname = tunnelProcess.GetHostname()
+		}
+	}
+	tunnelLock.Unlock()
+
+	scheme := "https"
+	switch {
+	case mode == tunnel.Tor:
+		scheme = opts.Scheme
+		if status.Hostname, err = tunnel.OnionHostname(opts.OnionKey); err != nil {
+			return nil, err
+		}
+	case opts.Token != "":
+		if status.Hostname, err = s.settingService.GetTunnelHostname(); err != nil {
+			return nil, err
+		}
+	}
+	if status.Hostname != "" {
+		basePath, err := s.settingService.GetBasePath()
+		if err != nil {
+			return nil, err
+		}
+		status.Url = scheme + "://" + status.Hostname + basePath
+	}
+	return status, nil
+}
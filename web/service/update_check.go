@@ -0,0 +1,234 @@
+package service
+
+import (
+	"encoding/json"
+	"html"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/config"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+)
+
+const (
+	panelReleasesURL = "https://api.github.com/repos/ByteProvider/3x-ui/releases?per_page=20"
+	xrayReleasesURL  = "https://api.github.com/repos/XTLS/Xray-core/releases?per_page=20"
+	// updateCheckMaxAge is how long the result of a check is served before the releases are fetched again.
+	updateCheckMaxAge = time.Hour
+)
+
+var (
+	updateCheckLock sync.Mutex
+	lastUpdateInfo  *entity.UpdateInfo
+
+	updateCheckClient = &http.Client{Timeout: 15 * time.Second}
+	securityNoteRegex = regexp.MustCompile(`(?i)\bsecurity\b|\bvulnerab|\bCVE-\d{4}-\d+`)
+)
+
+// UpdateCheckService looks for panel and Xray releases newer than the installed versions on
+// GitHub and, when enabled, tells the Telegram admins about each new release once.
+type UpdateCheckService struct {
+	settingService SettingService
+	xrayService    XrayService
+	tgbot          Tgbot
+}
+
+// githubRelease is the part of a GitHub release the check needs.
+type githubRelease struct {
+	TagName     string `json:"tag_name"`
+	Name        string `json:"name"`
+	Body        string `json:"body"`
+	HtmlUrl     string `json:"html_url"`
+	PublishedAt string `json:"published_at"`
+	Draft       bool   `json:"draft"`
+	Prerelease  bool   `json:"prerelease"`
+}
+
+// parseVersion returns the numeric parts of a version such as v25.9.11 or 2.8.5, nil when it has none.
+func parseVersion(version string) []int {
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	version, _, _ = strings.Cut(version, "-")
+	if version == "" {
+		return nil
+	}
+	var parts []int
+	for _, part := range strings.Split(version, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil
+		}
+		parts = append(parts, n)
+	}
+	return parts
+}
+
+// isNewerVersion reports whether version is newer than current. Versions that can not be parsed
+// are never newer.
+func isNewerVersion(version string, current string) bool {
+	a, b := parseVersion(version), parseVersion(current)
+	if a == nil || b == nil {
+		return false
+	}
+	for len(a) < len(b) {
+		a = append(a, 0)
+	}
+	for len(b) < len(a) {
+		b = append(b, 0)
+	}
+	return slices.Compare(a, b) > 0
+}
+
+// fetchNewerReleases returns the published releases newer than the current version, newest first.
+func fetchNewerReleases(url string, current string) ([]entity.ReleaseNote, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := updateCheckClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, common.NewErrorf("GitHub answered %d for %s", resp.StatusCode, url)
+	}
+	var releases []githubRelease
+	if err := json.NewDecoder(resp.Body).Decode(&releases); err != nil {
+		return nil, err
+	}
+	notes := []entity.ReleaseNote{}
+	for _, release := range releases {
+		if release.Draft || release.Prerelease || !isNewerVersion(release.TagName, current) {
+			continue
+		}
+		notes = append(notes, entity.ReleaseNote{
+			Version:     release.TagName,
+			Name:        release.Name,
+			PublishedAt: release.PublishedAt,
+			Url:         release.HtmlUrl,
+			Notes:       release.Body,
+			Security:    securityNoteRegex.MatchString(release.Name + "\n" + release.Body),
+		})
+	}
+	slices.SortStableFunc(notes, func(a, b entity.ReleaseNote) int {
+		return slices.Compare(parseVersion(b.Version), parseVersion(a.Version))
+	})
+	return notes, nil
+}
+
+// Check fetches the panel and Xray releases newer than the installed versions and notifies the
+// Telegram admins about the ones they were not told about yet, when enabled.
+func (s *UpdateCheckService) Check() (*entity.UpdateInfo, error) {
+	info := &entity.UpdateInfo{
+		PanelVersion: config.GetVersion(),
+		XrayVersion:  s.xrayService.GetXrayVersion(),
+		Panel:        []entity.ReleaseNote{},
+		Xray:         []entity.ReleaseNote{},
+		CheckedAt:    time.Now().UnixMilli(),
+	}
+	var errs []string
+	panel, err := fetchNewerReleases(panelReleasesURL, info.PanelVersion)
+	if err != nil {
+		errs = append(errs, err.Error())
+	} else {
+		info.Panel = panel
+	}
+	// The version of a core that never started is unknown
+	if parseVersion(info.XrayVersion) != nil {
+		xray, err := fetchNewerReleases(xrayReleasesURL, info.XrayVersion)
+		if err != nil {
+			errs = append(errs, err.Error())
+		} else {
+			info.Xray = xray
+		}
+	}
+	for _, release := range slices.Concat(info.Panel, info.Xray) {
+		info.Security = info.Security || release.Security
+	}
+	info.Error = strings.Join(errs, "; ")
+
+	updateCheckLock.Lock()
+	lastUpdateInfo = info
+	updateCheckLock.Unlock()
+
+	if len(errs) > 0 && len(info.Panel) == 0 && len(info.Xray) == 0 {
+		return info, common.NewError("update check failed:", info.Error)
+	}
+	s.notify(info)
+	return info, nil
+}
+
+// GetUpdates returns the result of the last check, checking again when it is older than an hour
+// or refresh is set.
+func (s *UpdateCheckService) GetUpdates(refresh bool) (*entity.UpdateInfo, error) {
+	updateCheckLock.Lock()
+	info := lastUpdateInfo
+	updateCheckLock.Unlock()
+	if !refresh && info != nil && time.Since(time.UnixMilli(info.CheckedAt)) < updateCheckMaxAge {
+		return info, nil
+	}
+	return s.Check()
+}
+
+// notify tells the Telegram admins about the newest panel and Xray releases, once for each version.
+func (s *UpdateCheckService) notify(info *entity.UpdateInfo) {
+	if enable, err := s.settingService.GetUpdateCheckNotify(); err != nil || !enable {
+		return
+	}
+	notified, err := s.settingService.GetUpdateNotifiedVersions()
+	if err != nil {
+		return
+	}
+	versions := strings.Split(notified, ",")
+	msg := ""
+	for _, update := range []struct {
+		name     string
+		current  string
+		releases []entity.ReleaseNote
+	}{
+		{"3X-UI", info.PanelVersion, info.Panel},
+		{"Xray", info.XrayVersion, info.Xray},
+	} {
+		if len(update.releases) == 0 {
+			continue
+		}
+		latest := update.releases[0]
+		key := update.name + "=" + latest.Version
+		if slices.Contains(versions, key) {
+			continue
+		}
+		security := slices.ContainsFunc(update.releases, func(release entity.ReleaseNote) bool { return release.Security })
+		msg += s.tgbot.I18nBot("tgbot.messages.updateAvailable",
+			"Name=="+update.name,
+			"Current=="+html.EscapeString(update.current),
+			"Version=="+html.EscapeString(latest.Version),
+			"Url=="+html.EscapeString(latest.Url))
+		if security {
+			msg += s.tgbot.I18nBot("tgbot.messages.securityUpdate")
+		}
+		// Only the latest notified version of each component is remembered
+		versions = slices.DeleteFunc(versions, func(version string) bool {
+			return version == "" || strings.HasPrefix(version, update.name+"=")
+		})
+		versions = append(versions, key)
+	}
+	if msg == "" {
+		return
+	}
+	logger.Info(msg)
+	if !s.tgbot.IsRunning() {
+		return
+	}
+	s.tgbot.SendMsgToTgbotAdmins(msg)
+	if err := s.settingService.SetUpdateNotifiedVersions(strings.Join(versions, ",")); err != nil {
+		logger.Warning("saving the notified versions failed:", err)
+	}
+}
@@ -34,6 +34,13 @@ func (s *UserService) GetFirstUser() (*model.User, error) {
 	return user, nil
 }
 
+// IsSuperAdmin reports whether the user is the super admin, the first user of the panel, who
+// alone may use the routes that expose the internals of the process.
+func (s *UserService) IsSuperAdmin(userId int) bool {
+	user, err := s.GetFirstUser()
+	return err == nil && user.Id == userId
+}
+
 func (s *UserService) CheckUser(username string, password string, twoFactorCode string) *model.User {
 	db := database.GetDB()
 
@@ -156,7 +163,7 @@ func (s *UserService) UpdateFirstUser(username string, password string) error {
 	return db.Save(user).Error
 }
 
-// GetUserByApiKey retrieves a user by their API key
+// GetUserByApiKey retrieves a user by their API key, which is stored hashed
 func (s *UserService) GetUserByApiKey(apiKey string) (*model.User, error) {
 	if apiKey == "" {
 		return nil, errors.New("api key is empty")
@@ -164,14 +171,15 @@ func (s *UserService) GetUserByApiKey(apiKey string) (*model.User, error) {
 	
 	db := database.GetDB()
 	user := &model.User{}
-	err := db.Model(model.User{}).Where("api_key = ?", apiKey).First(user).Error
+	err := db.Model(model.User{}).Where("api_key = ?", crypto.HashApiKey(apiKey)).First(user).Error
 	if err != nil {
 		return nil, err
 	}
 	return user, nil
 }
 
-// GenerateApiKey generates a new API key for a user
+// GenerateApiKey generates a new API key for a user. Only its hash is stored, so the returned
+// key can not be read again later
 func (s *UserService) GenerateApiKey(userId int) (string, error) {
 	db := database.GetDB()
 	
@@ -179,7 +187,7 @@ func (s *UserService) GenerateApiKey(userId int) (string, error) {
 	apiKey := random.Seq(64)
 	
 	// Update the user's API key
-	err := db.Model(model.User{}).Where("id = ?", userId).Update("api_key", apiKey).Error
+	err := db.Model(model.User{}).Where("id = ?", userId).Update("api_key", crypto.HashApiKey(apiKey)).Error
 	if err != nil {
 		return "", err
 	}
@@ -187,13 +195,51 @@ func (s *UserService) GenerateApiKey(userId int) (string, error) {
 	return apiKey, nil
 }
 
-// GetApiKey retrieves the current API key for a user
-func (s *UserService) GetApiKey(userId int) (string, error) {
+// HasApiKey reports whether an API key was generated for a user
+func (s *UserService) HasApiKey(userId int) (bool, error) {
 	db := database.GetDB()
 	user := &model.User{}
 	err := db.Model(model.User{}).Where("id = ?", userId).First(user).Error
 	if err != nil {
-		return "", err
+		return false, err
+	}
+	return user.ApiKey != "", nil
+}
+
+// MigrateApiKeys replaces API keys still stored in plaintext with their hash.
+func (s *UserService) MigrateApiKeys() error {
+	db := database.GetDB()
+	var users []*model.User
+	err := db.Model(model.User{}).Where("api_key IS NOT NULL AND api_key != ''").Find(&users).Error
+	if err != nil {
+		return err
+	}
+	count := 0
+	for _, user := range users {
+		if crypto.IsHashedApiKey(user.ApiKey) {
+			continue
+		}
+		err := db.Model(model.User{}).Where("id = ?", user.Id).Update("api_key", crypto.HashApiKey(user.ApiKey)).Error
+		if err != nil {
+			return err
+		}
+		count++
+	}
+	if count > 0 {
+		logger.Infof("Hashed %d stored API keys", count)
+	}
+	return nil
+}
+
+// CheckTwoFactorCode reports whether two-factor authentication is enabled and the code is currently valid.
+func (s *UserService) CheckTwoFactorCode(twoFactorCode string) bool {
+	twoFactorEnable, err := s.settingService.GetTwoFactorEnable()
+	if err != nil || !twoFactorEnable {
+		return false
+	}
+	twoFactorToken, err := s.settingService.GetTwoFactorToken()
+	if err != nil || twoFactorToken == "" {
+		return false
 	}
-	return user.ApiKey, nil
+	return gotp.NewDefaultTOTP(twoFactorToken).Now() == twoFactorCode
 }
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mhsanaei/3x-ui/v2/database"
+	"github.com/mhsanaei/3x-ui/v2/database/model"
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/common"
+	"github.com/mhsanaei/3x-ui/v2/util/random"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+)
+
+const (
+	maxVoucherBatch = 1000
+	// voucherAlphabet leaves out characters that are easily confused when a code is typed in.
+	voucherAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+var voucherPrefixRegex = regexp.MustCompile(`^[A-Z0-9]{0,16}$`)
+
+// VoucherService manages vouchers, single-use codes sold or handed out to customers that add days
+// or traffic to their client or create a new client when redeemed.
+type VoucherService struct {
+	inboundService InboundService
+}
+
+// newVoucherCode returns a random code in groups of four characters, after the prefix when one is given.
+func newVoucherCode(prefix string) string {
+	groups := make([]string, 0, 4)
+	if prefix != "" {
+		groups = append(groups, prefix)
+	}
+	for range 3 {
+		group := make([]byte, 4)
+		for i := range group {
+			group[i] = voucherAlphabet[random.Num(len(voucherAlphabet))]
+		}
+		groups = append(groups, string(group))
+	}
+	return strings.Join(groups, "-")
+}
+
+// normalizeVoucherCode makes codes typed in lowercase or with surrounding spaces match.
+func normalizeVoucherCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// GenerateVouchers creates count vouchers with the type, value, inbound and client template of the
+// given voucher in one batch. The batch is named after the time when no name is given.
+func (s *VoucherService) GenerateVouchers(template *model.Voucher, count int, prefix string) ([]*model.Voucher, error) {
+	if count < 1 || count > maxVoucherBatch {
+		return nil, common.NewCodeError(common.ErrCodeValidation, map[string]any{"count": count}, "the number of vouchers must be between 1 and", maxVoucherBatch)
+	}
+	if template.Type != model.VoucherDays && template.Type != model.VoucherGB {
+		return nil, common.NewCodeError(common.ErrCodeValidation, map[string]any{"type": template.Type}, "invalid voucher type:", template.Type)
+	}
+	if template.Value < 1 {
+		return nil, common.NewCodeError(common.ErrCodeValidation, map[string]any{"value": template.Value}, "invalid voucher value:", template.Value)
+	}
+	if template.TotalGB < 0 || template.ExpiryDays < 0 || template.LimitIP < 0 {
+		return nil, common.NewCodeError(common.ErrCodeValidation, nil, "quota values can not be negative")
+	}
+	prefix = strings.ToUpper(strings.TrimSpace(prefix))
+	if !voucherPrefixRegex.MatchString(prefix) {
+		return nil, common.NewCodeError(common.ErrCodeValidation, map[string]any{"prefix": prefix}, "the prefix may only hold up to 16 letters and digits")
+	}
+	if template.InboundId > 0 {
+		if err := s.inboundService.checkPresetInbound(template.InboundId); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	batch := strings.TrimSpace(template.Batch)
+	if batch == "" {
+		batch = now.Format("20060102-150405")
+	}
+	vouchers := make([]*model.Voucher, 0, count)
+	for range count {
+		vouchers = append(vouchers, &model.Voucher{
+			Code:       newVoucherCode(prefix),
+			Batch:      batch,
+			Type:       template.Type,
+			Value:      template.Value,
+			InboundId:  template.InboundId,
+			TotalGB:    template.TotalGB,
+			ExpiryDays: template.ExpiryDays,
+			LimitIP:    template.LimitIP,
+			ExpiresAt:  template.ExpiresAt,
+			CreatedAt:  now.UnixMilli(),
+		})
+	}
+	if err := database.GetDB().CreateInBatches(vouchers, 100).Error; err != nil {
+		return nil, err
+	}
+	return vouchers, nil
+}
+
+// GetVouchers returns the vouchers, newest first, of one batch when a batch is given and with the
+// given status when it is available, redeemed or expired.
+func (s *VoucherService) GetVouchers(batch string, status string) ([]*model.Voucher, error) {
+	db := database.GetDB().Model(model.Voucher{})
+	if batch != "" {
+		db = db.Where("batch = ?", batch)
+	}
+	now := time.Now().UnixMilli()
+	switch status {
+	case "":
+	case "available":
+		db = db.Where("redeemed_at = 0 AND (expires_at = 0 OR expires_at >= ?)", now)
+	case "redeemed":
+		db = db.Where("redeemed_at > 0")
+	case "expired":
+		db = db.Where("redeemed_at = 0 AND expires_at > 0 AND expires_at < ?", now)
+	default:
+		return nil, common.NewCodeError(common.ErrCodeValidation, map[string]any{"status": status}, "invalid voucher status:", status)
+	}
+	vouchers := []*model.Voucher{}
+	err := db.Order("id DESC").Find(&vouchers).Error
+	return vouchers, err
+}
+
+// GetVoucherReport returns the redemption status of every batch, newest first.
+func (s *VoucherService) GetVoucherReport() ([]entity.VoucherBatchReport, error) {
+	now := time.Now().UnixMilli()
+	reports := []entity.VoucherBatchReport{}
+	err := database.GetDB().Model(model.Voucher{}).
+		Select(`batch, type, value, inbound_id, COUNT(*) AS total,
+			SUM(CASE WHEN redeemed_at > 0 THEN 1 ELSE 0 END) AS redeemed,
+			SUM(CASE WHEN redeemed_at > 0 AND new_client THEN 1 ELSE 0 END) AS new_clients,
+			SUM(CASE WHEN redeemed_at = 0 AND expires_at > 0 AND expires_at < ? THEN 1 ELSE 0 END) AS expired,
+			MIN(created_at) AS created_at`, now).
+		Group("batch, type, value, inbound_id").
+		Order("created_at DESC").
+		Scan(&reports).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range reports {
+		reports[i].Available = reports[i].Total - reports[i].Redeemed - reports[i].Expired
+	}
+	return reports, nil
+}
+
+// DelVoucher deletes a voucher. Clients it was applied to are kept.
+func (s *VoucherService) DelVoucher(id int) error {
+	return database.GetDB().Delete(model.Voucher{}, id).Error
+}
+
+// DelVoucherBatch deletes the unused vouchers of a batch, the redeemed ones are kept for reporting.
+// Returns the number of vouchers deleted.
+func (s *VoucherService) DelVoucherBatch(batch string) (int64, error) {
+	result := database.GetDB().Where("batch = ? AND redeemed_at = 0", batch).Delete(model.Voucher{})
+	return result.RowsAffected, result.Error
+}
+
+// RedeemVoucher applies a voucher to the client with the given email, or creates a new client from
+// the voucher's template and the preset's Telegram and subscription IDs when no email is given. via
+// records where the voucher was redeemed. Returns the outcome and whether Xray needs restart.
+func (s *VoucherService) RedeemVoucher(code string, email string, preset ClientPreset, via string) (*entity.VoucherRedemption, bool, error) {
+	db := database.GetDB()
+	voucher := &model.Voucher{}
+	err := db.Model(model.Voucher{}).Where("code = ?", normalizeVoucherCode(code)).First(voucher).Error
+	if database.IsNotFound(err) {
+		return nil, false, common.NewCodeError(common.ErrCodeNotFound, nil, "invalid voucher code")
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if voucher.RedeemedAt > 0 {
+		return nil, false, common.NewCodeError(common.ErrCodeValidation, nil, "voucher already redeemed")
+	}
+	if voucher.ExpiresAt > 0 && voucher.ExpiresAt < time.Now().UnixMilli() {
+		return nil, false, common.NewCodeError(common.ErrCodeValidation, nil, "voucher expired")
+	}
+	email = strings.TrimSpace(email)
+	if email == "" && voucher.InboundId == 0 {
+		return nil, false, common.NewCodeError(common.ErrCodeValidation, nil, "the voucher only extends an existing client, a client email is required")
+	}
+
+	// Claim the voucher before applying it so concurrent redemptions can not use it twice
+	result := db.Model(model.Voucher{}).
+		Where("id = ? AND redeemed_at = 0", voucher.Id).
+		Update("redeemed_at", time.Now().UnixMilli())
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, false, common.NewCodeError(common.ErrCodeValidation, nil, "voucher already redeemed")
+	}
+
+	days, traffic := 0, int64(0)
+	if voucher.Type == model.VoucherDays {
+		days = voucher.Value
+	} else {
+		traffic = int64(voucher.Value) * 1024 * 1024 * 1024
+	}
+	redemption := &entity.VoucherRedemption{
+		Code:  voucher.Code,
+		Email: email,
+		Type:  voucher.Type,
+		Value: voucher.Value,
+	}
+	needRestart := false
+	if email != "" {
+		needRestart, err = s.inboundService.ExtendClient(email, days, traffic)
+	} else {
+		preset.Email = ""
+		preset.TotalGB = voucher.TotalGB + traffic
+		preset.ExpiryDays = voucher.ExpiryDays + days
+		preset.LimitIP = voucher.LimitIP
+		var client *model.Client
+		_, client, needRestart, err = s.inboundService.AddPresetClient(voucher.InboundId, preset)
+		if err == nil {
+			redemption.Email = client.Email
+			redemption.SubId = client.SubID
+			redemption.NewClient = true
+		}
+	}
+	if err != nil {
+		if releaseErr := db.Model(model.Voucher{}).Where("id = ?", voucher.Id).
+			Update("redeemed_at", 0).Error; releaseErr != nil {
+			logger.Warning("Unable to release voucher:", releaseErr)
+		}
+		return nil, false, err
+	}
+
+	err = db.Model(model.Voucher{}).Where("id = ?", voucher.Id).Updates(map[string]any{
+		"redeemed_by":  redemption.Email,
+		"redeemed_via": via,
+		"new_client":   redemption.NewClient,
+	}).Error
+	if err != nil {
+		logger.Warning("Unable to record voucher redemption:", err)
+	}
+	logger.Infof("Voucher %s redeemed via %s for %s: +%d %s", voucher.Code, via, redemption.Email, voucher.Value, voucher.Type)
+	return redemption, needRestart, nil
+}
@@ -5,21 +5,31 @@ import (
 	"errors"
 	"runtime"
 	"sync"
+	"time"
 
 	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/singbox"
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
 	"github.com/mhsanaei/3x-ui/v2/xray"
 
 	"go.uber.org/atomic"
 )
 
 var (
-	p                 *xray.Process
+	p                 Core
 	lock              sync.Mutex
 	isNeedXrayRestart atomic.Bool // Indicates that restart was requested for Xray
 	isManuallyStopped atomic.Bool // Indicates that Xray was stopped manually from the panel
 	result            string
+
+	xrayChanges       atomic.Int64 // Number of changes waiting for a restart
+	xrayFirstChangeAt atomic.Int64 // Time of the first pending change in milliseconds, 0 when none
+	xrayLastChangeAt  atomic.Int64 // Time of the last pending change in milliseconds
 )
 
+// xrayRestartMaxWait bounds how long a steady stream of changes can postpone a restart.
+const xrayRestartMaxWait = 2 * time.Minute
+
 // XrayService provides business logic for Xray process management.
 // It handles starting, stopping, restarting Xray, and managing its configuration.
 type XrayService struct {
@@ -81,6 +91,14 @@ func (s *XrayService) GetXrayVersion() string {
 	return p.GetVersion()
 }
 
+// GetCoreType returns the type of the core process, xray before one was started.
+func (s *XrayService) GetCoreType() string {
+	if p == nil {
+		return CoreXray
+	}
+	return coreType(p)
+}
+
 // RemoveIndex removes an element at the specified index from a slice.
 // Returns a new slice with the element removed.
 func RemoveIndex(s []any, index int) []any {
@@ -185,12 +203,71 @@ func (s *XrayService) GetXrayConfig() (*xray.Config, error) {
 			inbound.StreamSettings = string(newStream)
 		}
 
-		inboundConfig := inbound.GenXrayInboundConfig()
-		xrayConfig.InboundConfigs = append(xrayConfig.InboundConfigs, *inboundConfig)
+		for _, inboundConfig := range inbound.GenXrayInboundConfigs() {
+			xrayConfig.InboundConfigs = append(xrayConfig.InboundConfigs, *inboundConfig)
+		}
+	}
+	if err := s.addOutboundPools(xrayConfig); err != nil {
+		logger.Warning("Unable to add outbound pools:", err)
+	}
+	if err := s.addAdBlockRule(xrayConfig); err != nil {
+		logger.Warning("Unable to add the ad block rule:", err)
+	}
+	if err := s.deprioritizeFailingOutbounds(xrayConfig); err != nil {
+		logger.Warning("Unable to deprioritize failing outbounds:", err)
+	}
+	if err := addListenTagsToRules(xrayConfig); err != nil {
+		logger.Warning("Unable to route extra listen addresses:", err)
+	}
+	if err := s.addCaptiveRule(xrayConfig); err != nil {
+		logger.Warning("Unable to route captive clients:", err)
+	}
+	if err := s.addTrafficStats(xrayConfig); err != nil {
+		logger.Warning("Unable to configure traffic stats:", err)
+	}
+	if err := s.addOnlineStats(xrayConfig); err != nil {
+		logger.Warning("Unable to enable online stats:", err)
 	}
 	return xrayConfig, nil
 }
 
+// addListenTagsToRules extends the routing rules matching the tag of an inbound to the Xray
+// inbounds serving its extra listen addresses.
+func addListenTagsToRules(xrayConfig *xray.Config) error {
+	aliases := map[string][]any{}
+	for _, inbound := range xrayConfig.InboundConfigs {
+		if base := xray.BaseTag(inbound.Tag); base != inbound.Tag {
+			aliases[base] = append(aliases[base], inbound.Tag)
+		}
+	}
+	if len(aliases) == 0 || len(xrayConfig.RouterConfig) == 0 {
+		return nil
+	}
+	routing := map[string]any{}
+	if err := json.Unmarshal(xrayConfig.RouterConfig, &routing); err != nil {
+		return err
+	}
+	rules, _ := routing["rules"].([]any)
+	for _, r := range rules {
+		rule, _ := r.(map[string]any)
+		tags, _ := rule["inboundTag"].([]any)
+		for _, tag := range tags {
+			if name, ok := tag.(string); ok {
+				tags = append(tags, aliases[name]...)
+			}
+		}
+		if len(tags) > 0 {
+			rule["inboundTag"] = tags
+		}
+	}
+	routerConfig, err := json.Marshal(routing)
+	if err != nil {
+		return err
+	}
+	xrayConfig.RouterConfig = routerConfig
+	return nil
+}
+
 // GetXrayTraffic fetches the current traffic statistics from the running Xray process.
 func (s *XrayService) GetXrayTraffic() ([]*xray.Traffic, []*xray.ClientTraffic, error) {
 	if !s.IsXrayRunning() {
@@ -198,15 +275,29 @@ func (s *XrayService) GetXrayTraffic() ([]*xray.Traffic, []*xray.ClientTraffic,
 		logger.Debug("Attempted to fetch Xray traffic, but Xray is not running:", err)
 		return nil, nil, err
 	}
+	if box, ok := p.(*singbox.Process); ok {
+		traffic, err := box.GetTraffic()
+		if err != nil {
+			logger.Debug("Failed to fetch sing-box traffic:", err)
+			return nil, nil, err
+		}
+		return traffic, nil, nil
+	}
 	apiPort := p.GetAPIPort()
 	s.xrayAPI.Init(apiPort)
 	defer s.xrayAPI.Close()
 
-	traffic, clientTraffic, err := s.xrayAPI.GetTraffic(true)
+	reset, err := s.settingService.GetTrafficResetOnRead()
+	if err != nil {
+		reset = true
+	}
+	traffic, clientTraffic, err := s.xrayAPI.GetTraffic(reset)
 	if err != nil {
 		logger.Debug("Failed to fetch Xray traffic:", err)
 		return nil, nil, err
 	}
+	trafficSinceLastRead(traffic, clientTraffic, reset)
+	recordClientSpeeds(clientTraffic)
 	return traffic, clientTraffic, nil
 }
 
@@ -221,16 +312,23 @@ func (s *XrayService) RestartXray(isForce bool) error {
 	if err != nil {
 		return err
 	}
+	wantedCore, err := s.settingService.GetCoreType()
+	if err != nil {
+		return err
+	}
+	if wantedCore != CoreSingBox {
+		wantedCore = CoreXray
+	}
 
 	if s.IsXrayRunning() {
-		if !isForce && p.GetConfig().Equals(xrayConfig) && !isNeedXrayRestart.Load() {
+		if !isForce && coreType(p) == wantedCore && p.GetConfig().Equals(xrayConfig) && !isNeedXrayRestart.Load() {
 			logger.Debug("It does not need to restart Xray")
 			return nil
 		}
 		p.Stop()
 	}
 
-	p = xray.NewProcess(xrayConfig)
+	p = newCore(wantedCore, xrayConfig)
 	result = ""
 	err = p.Start()
 	if err != nil {
@@ -252,14 +350,77 @@ func (s *XrayService) StopXray() error {
 	return errors.New("xray is not running")
 }
 
-// SetToNeedRestart marks that Xray needs to be restarted.
+// SetToNeedRestart marks that Xray needs to be restarted. The restart is debounced, so
+// changes made in quick succession are applied by a single restart.
 func (s *XrayService) SetToNeedRestart() {
+	now := time.Now().UnixMilli()
+	xrayLastChangeAt.Store(now)
+	xrayFirstChangeAt.CompareAndSwap(0, now)
+	xrayChanges.Inc()
 	isNeedXrayRestart.Store(true)
 }
 
 // IsNeedRestartAndSetFalse checks if restart is needed and resets the flag to false.
 func (s *XrayService) IsNeedRestartAndSetFalse() bool {
-	return isNeedXrayRestart.CompareAndSwap(true, false)
+	if !isNeedXrayRestart.CompareAndSwap(true, false) {
+		return false
+	}
+	xrayChanges.Store(0)
+	xrayFirstChangeAt.Store(0)
+	return true
+}
+
+// GetPendingChanges describes the changes waiting for a restart and when they will be applied.
+func (s *XrayService) GetPendingChanges() *entity.PendingChanges {
+	pending := &entity.PendingChanges{Pending: isNeedXrayRestart.Load()}
+	if !pending.Pending {
+		return pending
+	}
+	pending.Changes = xrayChanges.Load()
+	pending.FirstChangeAt = xrayFirstChangeAt.Load()
+	pending.LastChangeAt = xrayLastChangeAt.Load()
+	pending.ApplyAt = s.applyAt(s.restartDelay()).UnixMilli()
+	return pending
+}
+
+// ApplyChanges restarts Xray at once when changes are pending, without waiting for the
+// restart delay. It reports whether there was anything to apply.
+func (s *XrayService) ApplyChanges() (bool, error) {
+	if !s.IsNeedRestartAndSetFalse() {
+		return false, nil
+	}
+	return true, s.RestartXray(false)
+}
+
+// RestartIfDue applies pending changes once no further change was made for the restart
+// delay, or the first of them waited for too long.
+func (s *XrayService) RestartIfDue() error {
+	if !isNeedXrayRestart.Load() || time.Now().Before(s.applyAt(s.restartDelay())) {
+		return nil
+	}
+	_, err := s.ApplyChanges()
+	return err
+}
+
+// restartDelay returns how long Xray waits for further changes before restarting.
+func (s *XrayService) restartDelay() time.Duration {
+	delay, err := s.settingService.GetXrayRestartDelay()
+	if err != nil || delay < 0 {
+		return 0
+	}
+	return time.Duration(delay) * time.Second
+}
+
+// applyAt returns the time pending changes are applied at with the given restart delay.
+func (s *XrayService) applyAt(delay time.Duration) time.Time {
+	applyAt := time.UnixMilli(xrayLastChangeAt.Load()).Add(delay)
+	if first := xrayFirstChangeAt.Load(); first != 0 {
+		deadline := time.UnixMilli(first).Add(max(delay, xrayRestartMaxWait))
+		if deadline.Before(applyAt) {
+			applyAt = deadline
+		}
+	}
+	return applyAt
 }
 
 // DidXrayCrash checks if Xray crashed by verifying it's not running and wasn't manually stopped.
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strconv"
+
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+	"github.com/mhsanaei/3x-ui/v2/xray"
+)
+
+// redactedConfigKeys are the keys of secrets in an Xray configuration, such as client IDs and
+// passwords and private keys, left out of redacted configurations.
+var redactedConfigKeys = []string{
+	"id", "password", "pass", "privateKey", "secretKey", "preSharedKey", "mldsa65Seed",
+	"seed", "key", "decryption", "token", "accessToken",
+}
+
+// redactedValue replaces secrets in redacted configurations.
+const redactedValue = "<redacted>"
+
+// configJSON converts an Xray configuration to plain JSON values, with the secrets replaced when
+// redact is set.
+func configJSON(config *xray.Config, redact bool) (any, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	if redact {
+		redactConfig(value)
+	}
+	return value, nil
+}
+
+// redactConfig replaces the values of secret keys in a JSON value.
+func redactConfig(value any) {
+	switch value := value.(type) {
+	case map[string]any:
+		for key, item := range value {
+			if slices.Contains(redactedConfigKeys, key) {
+				// Inline keys are lists of PEM lines
+				switch item.(type) {
+				case string, []any:
+					value[key] = redactedValue
+					continue
+				}
+			}
+			redactConfig(item)
+		}
+	case []any:
+		for _, item := range value {
+			redactConfig(item)
+		}
+	}
+}
+
+// GetEffectiveConfig returns the configuration the panel hands to Xray on its next start, built
+// from the template and the enabled inbounds, with the secrets redacted when redact is set.
+func (s *XrayService) GetEffectiveConfig(redact bool) (any, error) {
+	config, err := s.GetXrayConfig()
+	if err != nil {
+		return nil, err
+	}
+	return configJSON(config, redact)
+}
+
+// DiffEffectiveConfig compares the configuration the panel would hand to Xray now with the one
+// the running core was started with, listing the differences by their path in the JSON, so a
+// change that did not take effect yet can be spotted.
+func (s *XrayService) DiffEffectiveConfig(redact bool) (*entity.XrayConfigDiff, error) {
+	effective, err := s.GetEffectiveConfig(redact)
+	if err != nil {
+		return nil, err
+	}
+	diff := &entity.XrayConfigDiff{
+		Running:     s.IsXrayRunning(),
+		NeedRestart: isNeedXrayRestart.Load(),
+		Changes:     []entity.XrayConfigChange{},
+	}
+	if p == nil || p.GetConfig() == nil {
+		diff.Changes = append(diff.Changes, entity.XrayConfigChange{Path: "", Type: "added", Effective: effective})
+		return diff, nil
+	}
+	running, err := configJSON(p.GetConfig(), redact)
+	if err != nil {
+		return nil, err
+	}
+	diffConfig("", running, effective, &diff.Changes)
+	diff.Equal = len(diff.Changes) == 0
+	return diff, nil
+}
+
+// diffConfig appends the differences between two JSON values under the path to the changes.
+// Lists of objects with tags, such as inbounds and outbounds, are matched by tag, so adding one
+// in the middle shows as one change.
+func diffConfig(path string, running any, effective any, changes *[]entity.XrayConfigChange) {
+	switch {
+	case running == nil && effective == nil:
+		return
+	case running == nil:
+		*changes = append(*changes, entity.XrayConfigChange{Path: path, Type: "added", Effective: effective})
+		return
+	case effective == nil:
+		*changes = append(*changes, entity.XrayConfigChange{Path: path, Type: "removed", Running: running})
+		return
+	}
+	switch runningValue := running.(type) {
+	case map[string]any:
+		effectiveValue, ok := effective.(map[string]any)
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(runningValue)+len(effectiveValue))
+		for key := range runningValue {
+			keys = append(keys, key)
+		}
+		for key := range effectiveValue {
+			if _, ok := runningValue[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			diffConfig(joinConfigPath(path, key), runningValue[key], effectiveValue[key], changes)
+		}
+		return
+	case []any:
+		effectiveValue, ok := effective.([]any)
+		if !ok {
+			break
+		}
+		runningTags, effectiveTags := configTags(runningValue), configTags(effectiveValue)
+		if runningTags == nil || effectiveTags == nil {
+			for i := 0; i < max(len(runningValue), len(effectiveValue)); i++ {
+				var runningItem, effectiveItem any
+				if i < len(runningValue) {
+					runningItem = runningValue[i]
+				}
+				if i < len(effectiveValue) {
+					effectiveItem = effectiveValue[i]
+				}
+				diffConfig(path+"["+strconv.Itoa(i)+"]", runningItem, effectiveItem, changes)
+			}
+			return
+		}
+		for i, tag := range runningTags {
+			var effectiveItem any
+			if j := slices.Index(effectiveTags, tag); j >= 0 {
+				effectiveItem = effectiveValue[j]
+			}
+			diffConfig(path+"["+tag+"]", runningValue[i], effectiveItem, changes)
+		}
+		for j, tag := range effectiveTags {
+			if !slices.Contains(runningTags, tag) {
+				diffConfig(path+"["+tag+"]", nil, effectiveValue[j], changes)
+			}
+		}
+		return
+	}
+	if !reflect.DeepEqual(running, effective) {
+		*changes = append(*changes, entity.XrayConfigChange{Path: path, Type: "changed", Running: running, Effective: effective})
+	}
+}
+
+// configTags returns the tags of a list of tagged objects, nil when an item has no unique tag.
+func configTags(items []any) []string {
+	tags := make([]string, 0, len(items))
+	for _, item := range items {
+		object, ok := item.(map[string]any)
+		if !ok {
+			return nil
+		}
+		tag, _ := object["tag"].(string)
+		if tag == "" || slices.Contains(tags, tag) {
+			return nil
+		}
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// joinConfigPath returns the path of a key under a JSON path.
+func joinConfigPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
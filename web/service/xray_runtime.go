@@ -0,0 +1,101 @@
+package service
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/mhsanaei/3x-ui/v2/web/entity"
+)
+
+// GetRuntime asks the running Xray core for its loaded inbounds and outbounds, the users each
+// inbound holds and the goroutines and memory of the process, and compares them with the
+// configuration the panel hands to Xray, so inbounds and users added or removed through the API
+// without a restart can be confirmed.
+func (s *XrayService) GetRuntime() (*entity.XrayRuntime, error) {
+	if !s.IsXrayRunning() {
+		return nil, errors.New("xray is not running")
+	}
+	if err := s.xrayAPI.Init(coreAPIPort()); err != nil {
+		return nil, err
+	}
+	defer s.xrayAPI.Close()
+
+	runtime := &entity.XrayRuntime{
+		Inbounds:         []entity.XrayRuntimeInbound{},
+		MissingInbounds:  []string{},
+		MissingOutbounds: []string{},
+	}
+	var err error
+	if runtime.Stats, err = s.xrayAPI.GetSysStats(); err != nil {
+		return nil, err
+	}
+	inboundTags, err := s.xrayAPI.ListInboundTags()
+	if err != nil {
+		return nil, err
+	}
+	if runtime.Outbounds, err = s.xrayAPI.ListOutboundTags(); err != nil {
+		return nil, err
+	}
+
+	config, err := s.GetEffectiveConfig(false)
+	if err != nil {
+		return nil, err
+	}
+	expectedUsers := map[string]int{}
+	var expectedInbounds, expectedOutbounds []string
+	if config, ok := config.(map[string]any); ok {
+		inbounds, _ := config["inbounds"].([]any)
+		for _, inbound := range inbounds {
+			inbound, _ := inbound.(map[string]any)
+			tag, _ := inbound["tag"].(string)
+			if tag == "" {
+				continue
+			}
+			expectedInbounds = append(expectedInbounds, tag)
+			settings, _ := inbound["settings"].(map[string]any)
+			if clients, ok := settings["clients"].([]any); ok {
+				expectedUsers[tag] = len(clients)
+			}
+		}
+		outbounds, _ := config["outbounds"].([]any)
+		for _, outbound := range outbounds {
+			outbound, _ := outbound.(map[string]any)
+			if tag, _ := outbound["tag"].(string); tag != "" {
+				expectedOutbounds = append(expectedOutbounds, tag)
+			}
+		}
+	}
+
+	runtime.InSync = true
+	for _, tag := range inboundTags {
+		inbound := entity.XrayRuntimeInbound{Tag: tag}
+		if count, err := s.xrayAPI.GetInboundUsersCount(tag); err == nil {
+			inbound.Users = &count
+		}
+		// An inbound left loaded after it was removed from the configuration
+		if !slices.Contains(expectedInbounds, tag) {
+			runtime.InSync = false
+		}
+		if expected, ok := expectedUsers[tag]; ok {
+			inbound.ExpectedUsers = &expected
+			if inbound.Users != nil && *inbound.Users != int64(expected) {
+				runtime.InSync = false
+			}
+		}
+		runtime.Inbounds = append(runtime.Inbounds, inbound)
+	}
+	for _, tag := range expectedInbounds {
+		if !slices.Contains(inboundTags, tag) {
+			runtime.MissingInbounds = append(runtime.MissingInbounds, tag)
+		}
+	}
+	for _, tag := range expectedOutbounds {
+		if !slices.Contains(runtime.Outbounds, tag) {
+			runtime.MissingOutbounds = append(runtime.MissingOutbounds, tag)
+		}
+	}
+	if len(runtime.MissingInbounds) > 0 || len(runtime.MissingOutbounds) > 0 {
+		runtime.InSync = false
+	}
+	return runtime, nil
+}
@@ -13,8 +13,9 @@ import (
 )
 
 const (
-	loginUserKey = "LOGIN_USER"
-	defaultPath  = "/"
+	loginUserKey   = "LOGIN_USER"
+	portalSubIdKey = "PORTAL_SUB_ID"
+	defaultPath    = "/"
 )
 
 func init() {
@@ -78,3 +79,24 @@ func ClearSession(c *gin.Context) {
 		SameSite: http.SameSiteLaxMode,
 	})
 }
+
+// SetPortalSubId stores the subscription ID of a client logged in to the self-service portal.
+// Portal logins are kept in the portal session, see PortalSessions, and grant no access to the panel.
+func SetPortalSubId(c *gin.Context, subId string) {
+	s := sessions.Default(c)
+	s.Set(portalSubIdKey, subId)
+}
+
+// GetPortalSubId retrieves the subscription ID of the logged in portal client.
+// Returns an empty string if no client is logged in to the portal.
+func GetPortalSubId(c *gin.Context) string {
+	s := sessions.Default(c)
+	subId, _ := s.Get(portalSubIdKey).(string)
+	return subId
+}
+
+// ClearPortalSubId logs the client out of the portal.
+func ClearPortalSubId(c *gin.Context) {
+	s := sessions.Default(c)
+	s.Delete(portalSubIdKey)
+}
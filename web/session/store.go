@@ -0,0 +1,60 @@
+package session
+
+import (
+	"crypto/sha256"
+	"net/http"
+
+	"github.com/mhsanaei/3x-ui/v2/logger"
+	"github.com/mhsanaei/3x-ui/v2/util/redis"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	redisstore "github.com/gin-contrib/sessions/redis"
+	"github.com/gin-gonic/gin"
+)
+
+// redisKeyPrefix namespaces the session keys of the panel in a shared Redis database.
+const redisKeyPrefix = "x-ui:session:"
+
+// portalCookieName is the name of the session cookie of the self-service portal.
+const portalCookieName = "3x-ui-portal"
+
+// NewStore returns the session store of the panel. Sessions are kept in signed cookies unless
+// XUI_SESSION_REDIS points to a Redis server, in which case the cookie only holds a signed
+// session ID and the session lives in Redis, shared by every panel replica and revoked on logout.
+func NewStore(secret []byte) (sessions.Store, error) {
+	pool, err := redis.Shared()
+	if err != nil {
+		return nil, err
+	}
+	if pool == nil {
+		return cookie.NewStore(secret), nil
+	}
+	store, err := redisstore.NewStoreWithPool(pool, secret)
+	if err != nil {
+		return nil, err
+	}
+	if err := redisstore.SetKeyPrefix(store, redisKeyPrefix); err != nil {
+		return nil, err
+	}
+	logger.Info("Storing sessions in Redis")
+	return store, nil
+}
+
+// PortalSessions returns the session middleware of the self-service portal. Portal logins live in a
+// cookie of their own, limited to the portal path and signed with a key derived from the panel
+// secret, so they never share a session with a panel login.
+func PortalSessions(secret []byte, path string, maxAge int) (gin.HandlerFunc, error) {
+	key := sha256.Sum256(append([]byte("portal\x00"), secret...))
+	store, err := NewStore(key[:])
+	if err != nil {
+		return nil, err
+	}
+	store.Options(sessions.Options{
+		Path:     path,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return sessions.Sessions(portalCookieName, store), nil
+}
@@ -6,6 +6,7 @@ import (
 	"context"
 	"crypto/tls"
 	"embed"
+	"fmt"
 	"html/template"
 	"io"
 	"io/fs"
@@ -25,10 +26,9 @@ import (
 	"github.com/mhsanaei/3x-ui/v2/web/middleware"
 	"github.com/mhsanaei/3x-ui/v2/web/network"
 	"github.com/mhsanaei/3x-ui/v2/web/service"
+	"github.com/mhsanaei/3x-ui/v2/web/session"
 
-	"github.com/gin-contrib/gzip"
 	"github.com/gin-contrib/sessions"
-	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-gonic/gin"
 	"github.com/robfig/cron/v3"
 )
@@ -92,17 +92,25 @@ func EmbeddedAssets() embed.FS {
 
 // Server represents the main web server for the 3x-ui panel with controllers, services, and scheduled jobs.
 type Server struct {
-	httpServer *http.Server
-	listener   net.Listener
+	httpServer   *http.Server
+	listener     net.Listener
+	certReloader *network.CertReloader
+	http3Server  *network.Http3Server
 
 	index   *controller.IndexController
 	panel   *controller.XUIController
 	api     *controller.APIController
 	swagger *controller.SwaggerController
+	portal  *controller.PortalController
+	health  *controller.HealthController
 
 	xrayService    service.XrayService
 	settingService service.SettingService
+	naiveService   service.NaiveService
+	sshService     service.SSHTunnelService
+	tunnelService  service.TunnelService
 	tgbotService   service.Tgbot
+	decoyService   service.DecoyService
 
 	cron *cron.Cron
 
@@ -178,6 +186,34 @@ func (s *Server) initRouter() (*gin.Engine, error) {
 	}
 
 	engine := gin.Default()
+	engine.Use(middleware.EndpointStatsMiddleware(service.EndpointRecorder("web")))
+
+	decoyMode, err := s.settingService.GetDecoyMode()
+	if err != nil {
+		return nil, err
+	}
+	decoyUrl, err := s.settingService.GetDecoyUrl()
+	if err != nil {
+		return nil, err
+	}
+	decoy := middleware.DecoyHandler(decoyMode, decoyUrl)
+	if decoy != nil {
+		// Addresses banned for probing get nothing back, not even from the probes
+		engine.Use(func(c *gin.Context) {
+			if s.decoyService.IsBanned(middleware.RealClientIP(c)) {
+				middleware.DropConnection(c)
+			}
+		})
+	}
+
+	basePath, err := s.settingService.GetBasePath()
+	if err != nil {
+		return nil, err
+	}
+
+	// Probes are registered before the domain check, so local probes pass it. They are served under
+	// the web base path, so the panel does not give itself away to requests that do not know it
+	s.health = controller.NewHealthController(engine.Group(basePath))
 
 	webDomain, err := s.settingService.GetWebDomain()
 	if err != nil {
@@ -193,14 +229,13 @@ func (s *Server) initRouter() (*gin.Engine, error) {
 		return nil, err
 	}
 
-	basePath, err := s.settingService.GetBasePath()
+	engine.Use(middleware.CompressMiddleware())
+	assetsBasePath := basePath + "assets/"
+
+	store, err := session.NewStore(secret)
 	if err != nil {
 		return nil, err
 	}
-	engine.Use(gzip.Gzip(gzip.DefaultCompression, gzip.WithExcludedPaths([]string{basePath + "panel/api/"})))
-	assetsBasePath := basePath + "assets/"
-
-	store := cookie.NewStore(secret)
 	// Configure default session cookie options, including expiration (MaxAge)
 	if sessionMaxAge, err := s.settingService.GetSessionMaxAge(); err == nil {
 		store.Options(sessions.Options{
@@ -211,6 +246,12 @@ func (s *Server) initRouter() (*gin.Engine, error) {
 		})
 	}
 	engine.Use(sessions.Sessions("3x-ui", store))
+	// The self-service portal keeps its logins in a session of its own
+	portalMaxAge, _ := s.settingService.GetSessionMaxAge()
+	portalSessions, err := session.PortalSessions(secret, basePath+"portal", portalMaxAge*60)
+	if err != nil {
+		return nil, err
+	}
 	engine.Use(func(c *gin.Context) {
 		c.Set("base_path", basePath)
 	})
@@ -247,7 +288,7 @@ func (s *Server) initRouter() (*gin.Engine, error) {
 		}
 		// Use the registered func map with the loaded templates
 		engine.LoadHTMLFiles(files...)
-		engine.StaticFS(basePath+"assets", http.FS(os.DirFS("web/assets")))
+		engine.Group(basePath+"assets", middleware.ETagMiddleware()).StaticFS("", http.FS(os.DirFS("web/assets")))
 	} else {
 		// for production
 		template, err := s.getHtmlTemplate(funcMap)
@@ -255,26 +296,36 @@ func (s *Server) initRouter() (*gin.Engine, error) {
 			return nil, err
 		}
 		engine.SetHTMLTemplate(template)
-		engine.StaticFS(basePath+"assets", http.FS(&wrapAssetsFS{FS: assetsFS}))
+		engine.Group(basePath+"assets", middleware.ETagMiddleware()).StaticFS("", http.FS(&wrapAssetsFS{FS: assetsFS}))
 	}
 
 	// Apply the redirect middleware (`/xui` to `/panel`)
 	engine.Use(middleware.RedirectMiddleware(basePath))
 
+	// Reject changes while the panel is in read-only mode
+	engine.Use(middleware.ReadOnlyMiddleware())
+
 	g := engine.Group(basePath)
 
 	s.index = controller.NewIndexController(g)
 	s.panel = controller.NewXUIController(g)
 	s.api = controller.NewAPIController(g)
 	s.swagger = controller.NewSwaggerController(g)
+	s.portal = controller.NewPortalController(g, portalSessions)
 
 	// Chrome DevTools endpoint for debugging web apps
 	engine.GET("/.well-known/appspecific/com.chrome.devtools.json", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{})
 	})
 
-	// Add a catch-all route to handle undefined paths and return 404
+	// Add a catch-all route to handle undefined paths and return 404, or the decoy for
+	// requests that do not know the base path
 	engine.NoRoute(func(c *gin.Context) {
+		if decoy != nil && !strings.HasPrefix(c.Request.URL.Path, basePath) {
+			s.decoyService.RecordProbe(middleware.RealClientIP(c), c.Request.Method, c.Request.URL.RequestURI(), c.Request.UserAgent())
+			decoy(c)
+			return
+		}
 		c.AbortWithStatus(http.StatusNotFound)
 	})
 
@@ -291,24 +342,88 @@ func (s *Server) startTask() {
 	// Check whether xray is running every second
 	s.cron.AddJob("@every 1s", job.NewCheckXrayRunningJob())
 
-	// Check if xray needs to be restarted every 30 seconds
-	s.cron.AddFunc("@every 30s", func() {
-		if s.xrayService.IsNeedRestartAndSetFalse() {
-			err := s.xrayService.RestartXray(false)
-			if err != nil {
-				logger.Error("restart xray failed:", err)
-			}
+	// Apply changes that need an xray restart once they stop coming in
+	s.cron.AddFunc("@every 1s", func() {
+		if err := s.xrayService.RestartIfDue(); err != nil {
+			logger.Error("restart xray failed:", err)
 		}
 	})
 
+	trafficInterval, err := s.settingService.GetTrafficInterval()
+	if err != nil || trafficInterval < 1 {
+		trafficInterval = 10
+	}
 	go func() {
 		time.Sleep(time.Second * 5)
-		// Statistics every 10 seconds, start the delay for 5 seconds for the first time, and staggered with the time to restart xray
-		s.cron.AddJob("@every 10s", job.NewXrayTrafficJob())
+		// Statistics at the configured interval, start the delay for 5 seconds for the first time, and staggered with the time to restart xray
+		s.cron.AddJob(fmt.Sprintf("@every %ds", trafficInterval), job.NewXrayTrafficJob())
 	}()
 
-	// check client ips from log file every 10 sec
-	s.cron.AddJob("@every 10s", job.NewCheckClientIpJob())
+	// check client ips from log file in the configured interval
+	logScanInterval, err := s.settingService.GetOnlineLogScanInterval()
+	if err != nil || logScanInterval < 1 {
+		logScanInterval = 10
+	}
+	s.cron.AddJob(fmt.Sprintf("@every %ds", logScanInterval), job.NewCheckClientIpJob())
+
+	// Apply inbound and client speed limits every 30 sec
+	s.cron.AddJob("@every 30s", job.NewSpeedLimitJob())
+	// Apply inbound connection limits every 30 sec
+	s.cron.AddJob("@every 30s", job.NewConnLimitJob())
+	// Open the ports of enabled inbounds in the firewall every 30 sec
+	s.cron.AddJob("@every 30s", job.NewFirewallJob())
+	// Check that the inbounds accept connections every minute
+	s.cron.AddJob("@every 1m", job.NewInboundHealthJob())
+	// Hop the ports of inbounds with port hopping every minute
+	s.cron.AddJob("@every 1m", job.NewPortHopJob())
+	// Refetch the subscriptions of outbound pools that are due every minute
+	s.cron.AddJob("@every 1m", job.NewOutboundPoolJob())
+	// Run the NaiveProxy forward proxy and count its traffic every 30 seconds
+	s.cron.AddJob("@every 30s", job.NewNaiveJob())
+	// Run the SSH tunnel server and count its traffic every 30 seconds
+	s.cron.AddJob("@every 30s", job.NewSSHTunnelJob())
+	// Publish the panel through Cloudflare or Tor and restart the tunnel when it exited every 30 seconds
+	s.cron.AddJob("@every 30s", job.NewTunnelJob())
+	// Run the scheduled actions that are due every 30 seconds
+	s.cron.AddJob("@every 30s", job.NewScheduledActionJob())
+	// Probe the latency and availability of the outbounds in the configured interval
+	if interval, err := s.settingService.GetOutboundProbeInterval(); err == nil && interval > 0 {
+		s.cron.AddJob(fmt.Sprintf("@every %dm", interval), job.NewOutboundProbeJob())
+	}
+	// Check the targets of the REALITY inbounds in the configured interval
+	if interval, err := s.settingService.GetRealityCheckInterval(); err == nil && interval > 0 {
+		s.cron.AddJob(fmt.Sprintf("@every %dm", interval), job.NewRealityCheckJob())
+	}
+	// Check the public IP address for changes in the configured interval
+	if enable, err := s.settingService.GetIpCheckEnable(); err == nil && enable {
+		interval, err := s.settingService.GetIpCheckInterval()
+		if err != nil || interval < 1 {
+			interval = 5
+		}
+		s.cron.AddJob(fmt.Sprintf("@every %dm", interval), job.NewCheckPublicIPJob())
+	}
+	// Update the geofiles in the configured interval, daily while ad blocking relies on them
+	geofileInterval, _ := s.settingService.GetGeofileUpdateInterval()
+	if adBlock, err := s.settingService.GetAdBlockEnable(); err == nil && adBlock && geofileInterval <= 0 {
+		geofileInterval = 24
+	}
+	if geofileInterval > 0 {
+		s.cron.AddJob(fmt.Sprintf("@every %dh", geofileInterval), job.NewGeofileUpdateJob())
+	}
+	// Look for new panel and Xray releases twice a day
+	if enable, err := s.settingService.GetUpdateCheckEnable(); err == nil && enable {
+		s.cron.AddJob("@every 12h", job.NewUpdateCheckJob())
+	}
+	// Check the disk usage of the data directory and the database size every 10 min
+	s.cron.AddJob("@every 10m", job.NewCheckStorageJob())
+	// Prune and compact the database once a day in the configured hour
+	if enable, err := s.settingService.GetMaintenanceEnable(); err == nil && enable {
+		hour, err := s.settingService.GetMaintenanceHour()
+		if err != nil || hour < 0 || hour > 23 {
+			hour = 4
+		}
+		s.cron.AddJob(fmt.Sprintf("0 0 %d * * *", hour), job.NewMaintenanceJob())
+	}
 
 	// check client ips from log file every day
 	s.cron.AddJob("@daily", job.NewClearLogsJob())
@@ -377,6 +492,21 @@ func (s *Server) Start() (err error) {
 	s.cron = cron.New(cron.WithLocation(loc), cron.WithSeconds())
 	s.cron.Start()
 
+	if err := s.settingService.MigrateSecretSettings(); err != nil {
+		logger.Warning("encrypt secret settings failed:", err)
+	}
+	userService := service.UserService{}
+	if err := userService.MigrateApiKeys(); err != nil {
+		logger.Warning("hash API keys failed:", err)
+	}
+	inboundService := service.InboundService{}
+	inboundService.MigrateExternalIds()
+	inboundService.MigrateClientSubIds()
+	jobService := service.JobService{}
+	if err := jobService.FailInterruptedJobs(); err != nil {
+		logger.Warning("mark interrupted jobs failed:", err)
+	}
+
 	engine, err := s.initRouter()
 	if err != nil {
 		return err
@@ -398,19 +528,22 @@ func (s *Server) Start() (err error) {
 	if err != nil {
 		return err
 	}
+	socket, err := s.settingService.GetSocket()
+	if err != nil {
+		return err
+	}
 	listenAddr := net.JoinHostPort(listen, strconv.Itoa(port))
-	listener, err := net.Listen("tcp", listenAddr)
+	listener, err := network.Listen(listenAddr, socket, "web", 0)
 	if err != nil {
 		return err
 	}
 	if certFile != "" || keyFile != "" {
-		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		certReloader, err := network.NewCertReloader(certFile, keyFile)
 		if err == nil {
-			c := &tls.Config{
-				Certificates: []tls.Certificate{cert},
-			}
+			s.certReloader = certReloader
+			go certReloader.Watch(s.ctx, network.CertWatchInterval)
 			listener = network.NewAutoHttpsListener(listener)
-			listener = tls.NewListener(listener, c)
+			listener = tls.NewListener(listener, certReloader.TLSConfig())
 			logger.Info("Web server running HTTPS on", listener.Addr())
 		} else {
 			logger.Error("Error loading certificates:", err)
@@ -421,8 +554,22 @@ func (s *Server) Start() (err error) {
 	}
 	s.listener = listener
 
+	var handler http.Handler = engine
+	if s.certReloader != nil && socket == "" {
+		if http3Enable, err := s.settingService.GetHttp3(); err == nil && http3Enable {
+			http3Server, err := network.NewHttp3Server(listenAddr, engine, s.certReloader.TLSConfig())
+			if err == nil {
+				s.http3Server = http3Server
+				handler = http3Server.AltSvc(engine)
+				logger.Info("Web server running HTTP/3 on", listenAddr)
+			} else {
+				logger.Warning("Error starting HTTP/3 server:", err)
+			}
+		}
+	}
+
 	s.httpServer = &http.Server{
-		Handler: engine,
+		Handler: handler,
 	}
 
 	go func() {
@@ -443,10 +590,26 @@ func (s *Server) Start() (err error) {
 // Stop gracefully shuts down the web server, stops Xray, cron jobs, and Telegram bot.
 func (s *Server) Stop() error {
 	s.cancel()
-	s.xrayService.StopXray()
 	if s.cron != nil {
-		s.cron.Stop()
+		// Wait for running jobs, so traffic they are storing is not lost or counted twice
+		select {
+		case <-s.cron.Stop().Done():
+		case <-time.After(10 * time.Second):
+			logger.Warning("Timed out waiting for running jobs to finish")
+		}
 	}
+	// Store the traffic counted since the last traffic job before Xray and its counters go away
+	job.NewXrayTrafficJob().Run()
+	s.xrayService.StopXray()
+	if _, err := s.naiveService.CollectTraffic(); err != nil {
+		logger.Warning("Collecting naive traffic failed:", err)
+	}
+	s.naiveService.Stop()
+	if _, err := s.sshService.CollectTraffic(); err != nil {
+		logger.Warning("Collecting SSH tunnel traffic failed:", err)
+	}
+	s.sshService.Stop()
+	s.tunnelService.Stop()
 	if s.tgbotService.IsRunning() {
 		s.tgbotService.Stop()
 	}
@@ -458,9 +621,20 @@ func (s *Server) Stop() error {
 	if s.listener != nil {
 		err2 = s.listener.Close()
 	}
+	if s.http3Server != nil {
+		s.http3Server.Close()
+	}
 	return common.Combine(err1, err2)
 }
 
+// ReloadCert reloads the TLS certificate from disk. It fails when the server is not serving HTTPS.
+func (s *Server) ReloadCert() error {
+	if s.certReloader == nil {
+		return common.NewError("server is not running HTTPS")
+	}
+	return s.certReloader.Reload()
+}
+
 // GetCtx returns the server's context for cancellation and deadline management.
 func (s *Server) GetCtx() context.Context {
 	return s.ctx
@@ -25,7 +25,9 @@ import (
 	"github.com/xtls/xray-core/proxy/vless"
 	"github.com/xtls/xray-core/proxy/vmess"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 )
 
 // XrayAPI is a gRPC client for managing Xray core configuration, inbounds, outbounds, and statistics.
@@ -72,6 +74,9 @@ func (x *XrayAPI) Close() {
 
 // AddInbound adds a new inbound configuration to the Xray core via gRPC.
 func (x *XrayAPI) AddInbound(inbound []byte) error {
+	if x.HandlerServiceClient == nil {
+		return common.NewError("xray api is not initialized")
+	}
 	client := *x.HandlerServiceClient
 
 	conf := new(conf.InboundDetourConfig)
@@ -94,13 +99,130 @@ func (x *XrayAPI) AddInbound(inbound []byte) error {
 
 // DelInbound removes an inbound configuration from the Xray core by tag.
 func (x *XrayAPI) DelInbound(tag string) error {
+	if x.HandlerServiceClient == nil {
+		return common.NewError("xray api is not initialized")
+	}
 	client := *x.HandlerServiceClient
+	for _, alias := range x.listenTags(tag)[1:] {
+		if _, err := client.RemoveInbound(context.Background(), &command.RemoveInboundRequest{Tag: alias}); err != nil {
+			logger.Debug("Failed to remove inbound", alias, ":", err)
+		}
+	}
 	_, err := client.RemoveInbound(context.Background(), &command.RemoveInboundRequest{
 		Tag: tag,
 	})
 	return err
 }
 
+// listenTags returns the tag of an inbound followed by the tags of the Xray inbounds serving
+// its extra listen addresses.
+func (x *XrayAPI) listenTags(tag string) []string {
+	tags := []string{tag}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := (*x.HandlerServiceClient).ListInbounds(ctx, &command.ListInboundsRequest{IsOnlyTags: true})
+	if err != nil {
+		logger.Debug("Failed to list inbounds:", err)
+		return tags
+	}
+	for _, inbound := range resp.GetInbounds() {
+		if alias := inbound.GetTag(); alias != tag && BaseTag(alias) == tag {
+			tags = append(tags, alias)
+		}
+	}
+	return tags
+}
+
+// ListInboundTags returns the tags of the inbounds loaded in the Xray core.
+func (x *XrayAPI) ListInboundTags() ([]string, error) {
+	if x.HandlerServiceClient == nil {
+		return nil, common.NewError("xray api is not initialized")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := (*x.HandlerServiceClient).ListInbounds(ctx, &command.ListInboundsRequest{IsOnlyTags: true})
+	if err != nil {
+		return nil, err
+	}
+	tags := make([]string, 0, len(resp.GetInbounds()))
+	for _, inbound := range resp.GetInbounds() {
+		tags = append(tags, inbound.GetTag())
+	}
+	return tags, nil
+}
+
+// ListOutboundTags returns the tags of the outbounds loaded in the Xray core.
+func (x *XrayAPI) ListOutboundTags() ([]string, error) {
+	if x.HandlerServiceClient == nil {
+		return nil, common.NewError("xray api is not initialized")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := (*x.HandlerServiceClient).ListOutbounds(ctx, &command.ListOutboundsRequest{})
+	if err != nil {
+		return nil, err
+	}
+	tags := make([]string, 0, len(resp.GetOutbounds()))
+	for _, outbound := range resp.GetOutbounds() {
+		tags = append(tags, outbound.GetTag())
+	}
+	return tags, nil
+}
+
+// GetInboundUsersCount returns the number of users an inbound of the Xray core holds. Fails for
+// inbounds without users.
+func (x *XrayAPI) GetInboundUsersCount(tag string) (int64, error) {
+	if x.HandlerServiceClient == nil {
+		return 0, common.NewError("xray api is not initialized")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := (*x.HandlerServiceClient).GetInboundUsersCount(ctx, &command.GetInboundUserRequest{Tag: tag})
+	if err != nil {
+		return 0, err
+	}
+	return resp.GetCount(), nil
+}
+
+// SysStats are the runtime statistics of the Xray core process.
+type SysStats struct {
+	NumGoroutine uint32 `json:"numGoroutine"` // Goroutines running
+	NumGC        uint32 `json:"numGC"`        // Completed garbage collections
+	Alloc        uint64 `json:"alloc"`        // Bytes of allocated heap objects
+	TotalAlloc   uint64 `json:"totalAlloc"`   // Bytes allocated for heap objects in total
+	Sys          uint64 `json:"sys"`          // Bytes of memory obtained from the system
+	Mallocs      uint64 `json:"mallocs"`      // Heap objects allocated in total
+	Frees        uint64 `json:"frees"`        // Heap objects freed in total
+	LiveObjects  uint64 `json:"liveObjects"`  // Heap objects alive
+	PauseTotalNs uint64 `json:"pauseTotalNs"` // Nanoseconds spent in garbage collection pauses
+	Uptime       uint32 `json:"uptime"`       // Seconds the core has been running
+}
+
+// GetSysStats returns the runtime statistics of the Xray core process.
+func (x *XrayAPI) GetSysStats() (*SysStats, error) {
+	if x.StatsServiceClient == nil {
+		return nil, common.NewError("xray StatusServiceClient is not initialized")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := (*x.StatsServiceClient).GetSysStats(ctx, &statsService.SysStatsRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return &SysStats{
+		NumGoroutine: resp.GetNumGoroutine(),
+		NumGC:        resp.GetNumGC(),
+		Alloc:        resp.GetAlloc(),
+		TotalAlloc:   resp.GetTotalAlloc(),
+		Sys:          resp.GetSys(),
+		Mallocs:      resp.GetMallocs(),
+		Frees:        resp.GetFrees(),
+		LiveObjects:  resp.GetLiveObjects(),
+		PauseTotalNs: resp.GetPauseTotalNs(),
+		Uptime:       resp.GetUptime(),
+	}, nil
+}
+
 // AddUser adds a user to an inbound in the Xray core using the specified protocol and user data.
 func (x *XrayAPI) AddUser(Protocol string, inboundTag string, user map[string]any) error {
 	var account *serial.TypedMessage
@@ -148,34 +270,60 @@ func (x *XrayAPI) AddUser(Protocol string, inboundTag string, user map[string]an
 		return nil
 	}
 
+	if x.HandlerServiceClient == nil {
+		return common.NewError("xray api is not initialized")
+	}
 	client := *x.HandlerServiceClient
 
-	_, err := client.AlterInbound(context.Background(), &command.AlterInboundRequest{
-		Tag: inboundTag,
-		Operation: serial.ToTypedMessage(&command.AddUserOperation{
-			User: &protocol.User{
-				Email:   user["email"].(string),
-				Account: account,
-			},
-		}),
-	})
-	return err
+	for _, tag := range x.listenTags(inboundTag) {
+		_, err := client.AlterInbound(context.Background(), &command.AlterInboundRequest{
+			Tag: tag,
+			Operation: serial.ToTypedMessage(&command.AddUserOperation{
+				User: &protocol.User{
+					Level:   userLevel(user),
+					Email:   user["email"].(string),
+					Account: account,
+				},
+			}),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// userLevel returns the policy level of a user, which is an int for clients built by the panel
+// and a float64 for clients decoded from the inbound settings.
+func userLevel(user map[string]any) uint32 {
+	switch level := user["level"].(type) {
+	case int:
+		return uint32(max(level, 0))
+	case float64:
+		return uint32(max(level, 0))
+	}
+	return 0
 }
 
 // RemoveUser removes a user from an inbound in the Xray core by email.
 func (x *XrayAPI) RemoveUser(inboundTag, email string) error {
+	if x.HandlerServiceClient == nil {
+		return common.NewError("xray api is not initialized")
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	op := &command.RemoveUserOperation{Email: email}
-	req := &command.AlterInboundRequest{
-		Tag:       inboundTag,
-		Operation: serial.ToTypedMessage(op),
-	}
+	for _, tag := range x.listenTags(inboundTag) {
+		req := &command.AlterInboundRequest{
+			Tag:       tag,
+			Operation: serial.ToTypedMessage(op),
+		}
 
-	_, err := (*x.HandlerServiceClient).AlterInbound(ctx, req)
-	if err != nil {
-		return fmt.Errorf("failed to remove user: %w", err)
+		_, err := (*x.HandlerServiceClient).AlterInbound(ctx, req)
+		if err != nil {
+			return fmt.Errorf("failed to remove user: %w", err)
+		}
 	}
 
 	return nil
@@ -216,11 +364,39 @@ func (x *XrayAPI) GetTraffic(reset bool) ([]*Traffic, []*ClientTraffic, error) {
 	return mapToSlice(tagTrafficMap), mapToSlice(emailTrafficMap), nil
 }
 
-// processTraffic aggregates a traffic stat into trafficMap using regex matches and value.
+// GetOnlineIPs returns the source IPs of the open connections of a user, mapped to the
+// Unix time they were last seen at. It needs the statsUserOnline policy of the user's level,
+// users Xray has not seen a connection of yet have none.
+func (x *XrayAPI) GetOnlineIPs(email string) (map[string]int64, error) {
+	if x.StatsServiceClient == nil {
+		return nil, common.NewError("xray StatusServiceClient is not initialized")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	resp, err := (*x.StatsServiceClient).GetStatsOnlineIpList(ctx, &statsService.GetStatsRequest{
+		Name: "user>>>" + email + ">>>online",
+	})
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp.GetIps(), nil
+}
+
+// processTraffic aggregates a traffic stat into trafficMap using regex matches and value. The
+// Xray inbounds serving the extra listen addresses of an inbound count towards the inbound.
 func processTraffic(matches []string, value int64, trafficMap map[string]*Traffic) {
 	isInbound := matches[1] == "inbound"
 	tag := matches[2]
 	isDown := matches[3] == "downlink"
+	if isInbound {
+		tag = BaseTag(tag)
+	} else {
+		tag = BaseOutboundTag(tag)
+	}
 
 	if tag == "api" {
 		return
@@ -237,9 +413,9 @@ func processTraffic(matches []string, value int64, trafficMap map[string]*Traffi
 	}
 
 	if isDown {
-		traffic.Down = value
+		traffic.Down += value
 	} else {
-		traffic.Up = value
+		traffic.Up += value
 	}
 }
 
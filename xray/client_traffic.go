@@ -1,19 +1,86 @@
 package xray
 
+import (
+	"database/sql/driver"
+	"fmt"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
 // ClientTraffic represents traffic statistics and limits for a specific client.
 // It tracks upload/download usage, expiry times, and online status for inbound clients.
 type ClientTraffic struct {
-	Id         int    `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
-	InboundId  int    `json:"inboundId" form:"inboundId"`
-	Enable     bool   `json:"enable" form:"enable"`
-	Email      string `json:"email" form:"email" gorm:"unique"`
-	UUID       string `json:"uuid" form:"uuid" gorm:"-"`
-	SubId      string `json:"subId" form:"subId" gorm:"-"`
-	Up         int64  `json:"up" form:"up"`
-	Down       int64  `json:"down" form:"down"`
-	AllTime    int64  `json:"allTime" form:"allTime"`
-	ExpiryTime int64  `json:"expiryTime" form:"expiryTime"`
-	Total      int64  `json:"total" form:"total"`
-	Reset      int    `json:"reset" form:"reset" gorm:"default:0"`
-	LastOnline int64  `json:"lastOnline" form:"lastOnline" gorm:"default:0"`
+	Id            int     `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
+	InboundId     int     `json:"inboundId" form:"inboundId" gorm:"index"`
+	Enable        bool    `json:"enable" form:"enable"`
+	Email         string  `json:"email" form:"email" gorm:"unique"`
+	UUID          string  `json:"uuid" form:"uuid" gorm:"-"`
+	SubId         string  `json:"subId" form:"subId" gorm:"index"` // Subscription ID of the client, copied from the inbound settings so subscriptions are looked up by index
+	Up            int64   `json:"up" form:"up"`
+	Down          int64   `json:"down" form:"down"`
+	AllTime       int64   `json:"allTime" form:"allTime"`
+	ExpiryTime    int64   `json:"expiryTime" form:"expiryTime" gorm:"index"`
+	Total         int64   `json:"total" form:"total"`
+	Reset         int     `json:"reset" form:"reset" gorm:"default:0"`
+	LastOnline    int64   `json:"lastOnline" form:"lastOnline" gorm:"default:0"`
+	Tags          TagList `json:"tags" form:"tags" gorm:"type:text;index"`
+	ExpiryAction  string  `json:"expiryAction" form:"expiryAction" gorm:"default:''"`
+	Captive       bool    `json:"captive" form:"captive" gorm:"default:false"`
+	FirstUsedAt   int64   `json:"firstUsedAt" form:"firstUsedAt" gorm:"default:0"`
+	PausedAt      int64   `json:"pausedAt" form:"pausedAt" gorm:"default:0"`                 // When the client was paused, 0 if it is not
+	TrafficPoolId int     `json:"trafficPoolId" form:"trafficPoolId" gorm:"index;default:0"` // Traffic pool the client draws from, 0 for none
+	ExpiryPending bool    `json:"expiryPending" form:"expiryPending" gorm:"-"`               // Expiry timer waits for the first use
+}
+
+// AfterFind derives the pending expiry state from the stored expiry time.
+func (c *ClientTraffic) AfterFind(tx *gorm.DB) error {
+	c.ExpiryPending = c.ExpiryTime < 0
+	return nil
+}
+
+// TagList is a set of client tags. It is stored as a comma separated string
+// wrapped in commas (",plan:pro,origin:telegram,") so single tags can be matched with LIKE.
+type TagList []string
+
+// NewTagList trims and deduplicates tags, dropping empty ones. Commas are not allowed inside tags and are removed.
+func NewTagList(tags []string) TagList {
+	list := TagList{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(strings.ReplaceAll(tag, ",", ""))
+		if tag != "" && !slices.Contains(list, tag) {
+			list = append(list, tag)
+		}
+	}
+	return list
+}
+
+// TagPattern returns the LIKE pattern matching rows that carry tag.
+func TagPattern(tag string) string {
+	return "%," + strings.TrimSpace(tag) + ",%"
+}
+
+// Value implements driver.Valuer.
+func (t TagList) Value() (driver.Value, error) {
+	if len(t) == 0 {
+		return "", nil
+	}
+	return "," + strings.Join(t, ",") + ",", nil
+}
+
+// Scan implements sql.Scanner.
+func (t *TagList) Scan(value any) error {
+	var raw string
+	switch v := value.(type) {
+	case nil:
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	default:
+		return fmt.Errorf("unsupported tag list type %T", value)
+	}
+	*t = NewTagList(strings.Split(raw, ","))
+	return nil
 }
@@ -2,6 +2,8 @@ package xray
 
 import (
 	"bytes"
+	"encoding/json"
+	"strings"
 
 	"github.com/mhsanaei/3x-ui/v2/util/json_util"
 )
@@ -11,11 +13,49 @@ import (
 type InboundConfig struct {
 	Listen         json_util.RawMessage `json:"listen"` // listen cannot be an empty string
 	Port           int                  `json:"port"`
+	Ports          string               `json:"-"` // Port list like 443,20000-20100 listened on instead of Port, empty for Port alone
 	Protocol       string               `json:"protocol"`
 	Settings       json_util.RawMessage `json:"settings"`
 	StreamSettings json_util.RawMessage `json:"streamSettings"`
 	Tag            string               `json:"tag"`
 	Sniffing       json_util.RawMessage `json:"sniffing"`
+	Extension      json_util.RawMessage `json:"-"` // JSON object deep-merged into the inbound when it is written
+}
+
+// ListenTagSeparator joins the tag of an inbound and an extra listen address into the tag of
+// the Xray inbound serving that address.
+const ListenTagSeparator = "#"
+
+// ListenTag returns the tag of the Xray inbound serving an extra listen address of an inbound.
+func ListenTag(tag, listen string) string {
+	return tag + ListenTagSeparator + listen
+}
+
+// BaseTag returns the tag of the inbound an Xray inbound tag belongs to, stripping the extra
+// listen address.
+func BaseTag(tag string) string {
+	base, _, _ := strings.Cut(tag, ListenTagSeparator)
+	return base
+}
+
+// MarshalJSON writes the port list in place of the port when the inbound listens on several ports,
+// and merges the extension into the result.
+func (c InboundConfig) MarshalJSON() ([]byte, error) {
+	type inboundConfig InboundConfig
+	var data []byte
+	var err error
+	if c.Ports == "" {
+		data, err = json.Marshal(inboundConfig(c))
+	} else {
+		data, err = json.Marshal(struct {
+			inboundConfig
+			Port string `json:"port"`
+		}{inboundConfig(c), c.Ports})
+	}
+	if err != nil || len(c.Extension) == 0 {
+		return data, err
+	}
+	return json_util.Merge(data, c.Extension)
 }
 
 // Equals compares two InboundConfig instances for deep equality.
@@ -23,7 +63,7 @@ func (c *InboundConfig) Equals(other *InboundConfig) bool {
 	if !bytes.Equal(c.Listen, other.Listen) {
 		return false
 	}
-	if c.Port != other.Port {
+	if c.Port != other.Port || c.Ports != other.Ports {
 		return false
 	}
 	if c.Protocol != other.Protocol {
@@ -41,5 +81,8 @@ func (c *InboundConfig) Equals(other *InboundConfig) bool {
 	if !bytes.Equal(c.Sniffing, other.Sniffing) {
 		return false
 	}
+	if !bytes.Equal(c.Extension, other.Extension) {
+		return false
+	}
 	return true
 }
@@ -0,0 +1,13 @@
+package xray
+
+import "strings"
+
+// DeprioritizedTagPrefix is put in front of the tags of outbounds taken out of their balancers
+// because they keep failing their probes, so the prefix selectors of the balancers no longer
+// match them.
+const DeprioritizedTagPrefix = "down~"
+
+// BaseOutboundTag returns the configured tag of an Xray outbound, stripping DeprioritizedTagPrefix.
+func BaseOutboundTag(tag string) string {
+	return strings.TrimPrefix(tag, DeprioritizedTagPrefix)
+}
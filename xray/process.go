@@ -33,6 +33,33 @@ func GetConfigPath() string {
 	return config.GetBinFolderPath() + "/config.json"
 }
 
+// TestConfig checks a configuration with xray -test without running it.
+func TestConfig(xrayConfig *Config) error {
+	data, err := json.MarshalIndent(xrayConfig, "", "  ")
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(config.GetBinFolderPath(), "test-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(data)
+	file.Close()
+	if err != nil {
+		return err
+	}
+	output, err := exec.Command(GetBinaryPath(), "-test", "-c", file.Name()).CombinedOutput()
+	if err != nil {
+		if len(output) == 0 {
+			return err
+		}
+		lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+		return common.NewErrorf("xray -test failed: %v", lines[len(lines)-1])
+	}
+	return nil
+}
+
 // GetGeositePath returns the path to the geosite data file used by Xray.
 func GetGeositePath() string {
 	return config.GetBinFolderPath() + "/geosite.dat"
@@ -165,6 +192,9 @@ func (p *process) GetVersion() string {
 
 // GetAPIPort returns the API port used by the Xray process.
 func (p *Process) GetAPIPort() int {
+	if p == nil {
+		return 0
+	}
 	return p.apiPort
 }
 